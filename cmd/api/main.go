@@ -2,13 +2,22 @@ package main
 
 import (
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 
 	_ "go-media-center-example/docs" // Import swagger docs
 	"go-media-center-example/internal/api"
+	"go-media-center-example/internal/api/handlers"
+	"go-media-center-example/internal/cdn"
 	"go-media-center-example/internal/config"
 	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/events"
+	"go-media-center-example/internal/scheduler"
+	"go-media-center-example/internal/storage"
 
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
@@ -35,10 +44,11 @@ import (
 // @description Type "Bearer" followed by a space and JWT token
 
 func main() {
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal("Failed to load configuration:", err)
+	// Load configuration, stopping on values the server can't run with rather than
+	// failing requests later
+	cfg := config.GetConfig()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
 	}
 
 	// Initialize Router
@@ -67,6 +77,42 @@ func main() {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	// Set up the storage backends now instead of on first use
+	if err := storage.Init(); err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+
+	// Publish media lifecycle events to the configured broker, if any
+	if err := events.Start(cfg.Events); err != nil {
+		log.Fatal("Failed to initialize event publishing:", err)
+	}
+
+	// Purge changed media from the configured CDN, if any
+	if err := cdn.Start(cfg.CDN); err != nil {
+		log.Fatal("Failed to initialize CDN purging:", err)
+	}
+
+	// Suggest tags for new images with the configured classifier, if any
+	if err := handlers.StartAutoTagging(cfg.Tagging); err != nil {
+		log.Fatal("Failed to initialize auto-tagging:", err)
+	}
+
+	// Finish batch jobs interrupted by a shutdown, of this instance or another one
+	go handlers.ResumeImportJobs()
+
+	// Delete the objects of purges interrupted by the previous shutdown
+	go storage.ResumePurges()
+
+	// Periodic jobs: orphan cleanup, derivative eviction, lifecycle rules and replica
+	// reconciliation. With several instances, only one should run them on schedule.
+	handlers.RegisterJobs()
+	if cfg.Scheduler.Enabled {
+		scheduler.Start()
+	}
+
+	// Rate limits, presets, the upload size limit and allowlists are reloaded on SIGHUP
+	go reloadOnHangup()
+
 	// Initialize Routes
 	api.SetupRoutes(router)
 
@@ -78,3 +124,21 @@ func main() {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// reloadOnHangup applies the reloadable settings of the environment and .env each time
+// the process receives SIGHUP
+func reloadOnHangup() {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		changed, err := config.Reload()
+		switch {
+		case err != nil:
+			log.Printf("Failed to reload configuration: %v", err)
+		case len(changed) == 0:
+			log.Printf("Configuration reloaded, nothing changed")
+		default:
+			log.Printf("Configuration reloaded: %s", strings.Join(changed, ", "))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"go-media-center-example/pkg/client"
+)
+
+// runLogin exchanges a username and password for a token and saves it
+func runLogin(ctx context.Context, args []string) error {
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+
+	flags := newFlagSet("login", "")
+	server := flags.String("server", s.Server, "Server URL")
+	username := flags.String("user", "", "Username")
+	password := flags.String("password", "", "Password (default $MEDIACTL_PASSWORD, or read from stdin)")
+	flags.Parse(args)
+
+	if *username == "" {
+		return errors.New("-user is required")
+	}
+	if *password == "" {
+		*password = os.Getenv("MEDIACTL_PASSWORD")
+	}
+	if *password == "" {
+		if *password, err = readPassword(); err != nil {
+			return err
+		}
+	}
+
+	c := client.New(*server)
+	result, err := c.Login(ctx, *username, *password)
+	if err != nil {
+		return err
+	}
+	if err := saveSettings(settings{Server: *server, Token: result.Token}); err != nil {
+		return err
+	}
+	fmt.Printf("Logged in to %s as %s\n", *server, result.User.Username)
+	return nil
+}
+
+// runLogout removes the saved token but keeps the server URL
+func runLogout(ctx context.Context, args []string) error {
+	flags := newFlagSet("logout", "")
+	flags.Parse(args)
+
+	s, err := loadSettings()
+	if err != nil {
+		return err
+	}
+	return saveSettings(settings{Server: s.Server})
+}
+
+// readPassword reads one line from stdin. The standard library cannot turn off the
+// terminal echo, so prefer MEDIACTL_PASSWORD or a pipe in shared sessions.
+func readPassword() (string, error) {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,172 @@
+// Command mediactl is a command-line client for the Media Center API, built on pkg/client.
+//
+//	go run ./cmd/mediactl login -server http://localhost:8080 -user demo
+//	go run ./cmd/mediactl upload -parallel 4 -folder 3 photos/
+//	go run ./cmd/mediactl sync -folder 3 ./photos
+//	go run ./cmd/mediactl watch ./photos=3 ./scans
+//
+// login saves the server URL and token in the user config directory. MEDIACTL_URL and
+// MEDIACTL_TOKEN override the saved values, e.g. in CI.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"go-media-center-example/pkg/client"
+)
+
+// defaultServer is used until login saves another server URL
+const defaultServer = "http://localhost:8080"
+
+// command is one mediactl subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"login", "Log in and save the token", runLogin},
+	{"logout", "Forget the saved token", runLogout},
+	{"upload", "Upload files and directories", runUpload},
+	{"sync", "Upload new and changed files of a local directory", runSync},
+	{"watch", "Keep uploading new and changed files of local directories", runWatch},
+	{"list", "List media", runList},
+	{"download", "Download original files", runDownload},
+	{"transform", "Save a transformed copy of a media item", runTransform},
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mediactl: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(ctx, flag.Args()[1:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	log.Printf("unknown command %q", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: mediactl <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun mediactl <command> -h for the flags of a command.")
+}
+
+// newFlagSet creates the flag set of a subcommand. Usage lines describe the arguments
+// after the flags.
+func newFlagSet(name, args string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: mediactl %s [flags] %s\n", name, args)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// settings are saved by login
+type settings struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+// settingsPath returns the file login saves to
+func settingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mediactl", "config.json"), nil
+}
+
+// loadSettings reads the saved settings and applies the environment overrides
+func loadSettings() (settings, error) {
+	s := settings{Server: defaultServer}
+	path, err := settingsPath()
+	if err != nil {
+		return s, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return s, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return s, fmt.Errorf("reading %s: %w", path, err)
+		}
+	}
+	if server := os.Getenv("MEDIACTL_URL"); server != "" {
+		s.Server = server
+	}
+	if token := os.Getenv("MEDIACTL_TOKEN"); token != "" {
+		s.Token = token
+	}
+	return s, nil
+}
+
+// saveSettings writes the settings readable by the current user only
+func saveSettings(s settings) error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// newClient returns a client for the saved server, failing when nobody is logged in
+func newClient() (*client.Client, error) {
+	s, err := loadSettings()
+	if err != nil {
+		return nil, err
+	}
+	if s.Token == "" {
+		return nil, errors.New("not logged in; run mediactl login or set MEDIACTL_TOKEN")
+	}
+	return client.New(s.Server, client.WithToken(s.Token)), nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"go-media-center-example/pkg/client"
+)
+
+// runList prints media as a table, or as one JSON object per line
+func runList(ctx context.Context, args []string) error {
+	flags := newFlagSet("list", "")
+	folder := flags.String("folder", "", "Folder ID")
+	search := flags.String("search", "", "Filename search")
+	mimeType := flags.String("type", "", "MIME type")
+	tags := flags.String("tags", "", "Comma-separated tags")
+	classes := flags.String("class", "", "Comma-separated content classes: photo, screenshot, scan, graphic")
+	limit := flags.Int("limit", 0, "Maximum number of items (default all)")
+	asJSON := flags.Bool("json", false, "Print JSON lines")
+	flags.Parse(args)
+
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	opts := client.ListMediaOptions{
+		Limit:    pageSize,
+		Type:     *mimeType,
+		Search:   *search,
+		FolderID: *folder,
+		Tags:     splitList(*tags),
+		Classes:  splitList(*classes),
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	if !*asJSON {
+		fmt.Fprintln(table, "ID\tSIZE\tTYPE\tCREATED\tFILENAME")
+	}
+
+	errLimit := errors.New("limit reached")
+	count := 0
+	err = c.EachMedia(ctx, opts, func(media client.Media) error {
+		if *limit > 0 && count == *limit {
+			return errLimit
+		}
+		count++
+		if *asJSON {
+			return encoder.Encode(media)
+		}
+		_, err := fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", media.ID, formatBytes(media.Size),
+			media.MimeType, media.CreatedAt.Local().Format("2006-01-02 15:04"), media.Filename)
+		return err
+	})
+	if err != nil && err != errLimit {
+		return err
+	}
+	if *asJSON {
+		return nil
+	}
+	return table.Flush()
+}
+
+// runDownload saves the original files of media items, or of every item in a folder
+func runDownload(ctx context.Context, args []string) error {
+	flags := newFlagSet("download", "<media-id>...")
+	folder := flags.String("folder", "", "Download every media item in this folder")
+	dir := flags.String("o", ".", "Output directory")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 && *folder == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	ids := flags.Args()
+	if *folder != "" {
+		err := c.EachMedia(ctx, client.ListMediaOptions{Limit: pageSize, FolderID: *folder}, func(media client.Media) error {
+			ids = append(ids, media.ID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, id := range ids {
+		path, err := downloadOne(ctx, c, id, *dir)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			failed++
+			fmt.Fprintf(os.Stderr, "failed    %s: %v\n", id, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "saved     %s -> %s\n", id, path)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d downloads failed", failed, len(ids))
+	}
+	return nil
+}
+
+// downloadOne saves a media item below dir under its filename. The file is written
+// under a temporary name first so an interrupted download never looks complete.
+func downloadOne(ctx context.Context, c *client.Client, id, dir string) (string, error) {
+	body, media, err := c.Download(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	path := filepath.Join(dir, filepath.Base(media.Filename))
+	if err := writeFile(path, body); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// runTransform renders a transformed copy of a media item into a file
+func runTransform(ctx context.Context, args []string) error {
+	flags := newFlagSet("transform", "<media-id>")
+	output := flags.String("o", "", "Output file, - for stdout (required)")
+	params := url.Values{}
+	for _, name := range []string{"width", "height", "quality"} {
+		flags.Func(name, "Output "+name, func(value string) error {
+			if _, err := strconv.Atoi(value); err != nil {
+				return errors.New("must be an integer")
+			}
+			params.Set(name, value)
+			return nil
+		})
+	}
+	flags.Func("format", "Output format: jpeg, png or webp", func(value string) error {
+		params.Set("format", value)
+		return nil
+	})
+	flags.Func("fit", "Resize mode: contain, cover or fill", func(value string) error {
+		params.Set("fit", value)
+		return nil
+	})
+	flags.Func("param", "Any other transformation as name=value, e.g. blur=2 (repeatable)", func(value string) error {
+		name, v, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return errors.New("must be name=value")
+		}
+		params.Add(name, v)
+		return nil
+	})
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *output == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	body, contentType, err := c.Transform(ctx, flags.Arg(0), params)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	if *output == "-" {
+		_, err = io.Copy(os.Stdout, body)
+		return err
+	}
+	if err := writeFile(*output, body); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "saved     %s (%s)\n", *output, contentType)
+	return nil
+}
+
+// writeFile copies r into a temporary file next to path and renames it into place
+func writeFile(path string, r io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-media-center-example/pkg/client"
+)
+
+// maxPresignedParts is how many parts PresignUploadParts presigns at a time
+const maxPresignedParts = 100
+
+// pendingUpload is a multipart upload in progress, saved so an interrupted upload
+// continues with the parts not stored yet
+type pendingUpload struct {
+	SessionID string           `json:"session_id"`
+	Size      int64            `json:"size"`
+	ModTime   time.Time        `json:"mod_time"`
+	Parts     map[int32]string `json:"parts"` // ETag by stored part number
+}
+
+// resumableUpload uploads a file with a direct upload, which sends the content straight
+// to storage. A multipart upload is resumed from pending unless the file changed since.
+// save is called whenever the pending upload changes, and with nil once it is done.
+// Servers without direct upload storage get a regular upload.
+func resumableUpload(ctx context.Context, c *client.Client, path, name string, opts client.UploadOptions, pending *pendingUpload, save func(*pendingUpload) error) (*client.MediaResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if pending != nil {
+		if pending.Size == info.Size() && pending.ModTime.Equal(info.ModTime()) {
+			session, err := c.GetUploadSession(ctx, pending.SessionID)
+			if err == nil && canResume(session) {
+				return sendParts(ctx, c, file, session, pending, save)
+			}
+		} else {
+			// The stored parts belong to an older version of the file
+			c.AbortUploadSession(ctx, pending.SessionID)
+		}
+		if err := save(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if info.Size() == 0 {
+		return c.UploadFile(ctx, name, file, opts)
+	}
+	direct, err := c.PresignUpload(ctx, name, info.Size(), mime.TypeByExtension(filepath.Ext(name)), opts)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotImplemented {
+		return c.UploadFile(ctx, name, file, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case direct.Skipped:
+		return &client.MediaResult{Skipped: true, Media: direct.Media}, nil
+	case direct.Session != nil:
+		pending = &pendingUpload{
+			SessionID: direct.Session.ID,
+			Size:      info.Size(),
+			ModTime:   info.ModTime(),
+			Parts:     map[int32]string{},
+		}
+		if err := save(pending); err != nil {
+			return nil, err
+		}
+		return sendParts(ctx, c, file, direct.Session, pending, save)
+	default:
+		if _, err := c.SendPresigned(ctx, *direct.Upload, io.NewSectionReader(file, 0, info.Size()), info.Size()); err != nil {
+			return nil, err
+		}
+		return c.CompleteUpload(ctx, direct.UploadToken)
+	}
+}
+
+// canResume reports whether a multipart upload can still be completed
+func canResume(session *client.UploadSession) bool {
+	switch session.Status {
+	case "completed":
+		return true
+	case "active", "assembled":
+		return time.Now().Before(session.ExpiresAt)
+	}
+	return false
+}
+
+// sendParts stores the parts of a multipart upload that are not stored yet and
+// completes it
+func sendParts(ctx context.Context, c *client.Client, file *os.File, session *client.UploadSession, pending *pendingUpload, save func(*pendingUpload) error) (*client.MediaResult, error) {
+	if session.Status == "active" {
+		var missing []int32
+		for number := int32(1); number <= int32(session.PartCount); number++ {
+			if pending.Parts[number] == "" {
+				missing = append(missing, number)
+			}
+		}
+		for len(missing) > 0 {
+			batch := missing[:min(len(missing), maxPresignedParts)]
+			missing = missing[len(batch):]
+
+			parts, err := c.PresignUploadParts(ctx, session.ID, batch)
+			if err != nil {
+				return nil, err
+			}
+			for _, part := range parts {
+				offset := int64(part.PartNumber-1) * session.PartSize
+				length := min(session.PartSize, session.Size-offset)
+				etag, err := c.SendPresigned(ctx, part.PresignedUpload, io.NewSectionReader(file, offset, length), length)
+				if err != nil {
+					return nil, fmt.Errorf("part %d: %w", part.PartNumber, err)
+				}
+				pending.Parts[part.PartNumber] = etag
+				if err := save(pending); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	completed := make([]client.CompletedPart, 0, session.PartCount)
+	for number := int32(1); number <= int32(session.PartCount); number++ {
+		completed = append(completed, client.CompletedPart{PartNumber: number, ETag: pending.Parts[number]})
+	}
+	result, err := c.CompleteMultipartUpload(ctx, session.ID, completed)
+	if err != nil {
+		return nil, err
+	}
+	return result, save(nil)
+}
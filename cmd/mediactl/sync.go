@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go-media-center-example/pkg/client"
+)
+
+// pageSize is the page size of the listings the CLI pages through
+const pageSize = 100
+
+// runSync uploads the files of a local directory that are missing from a folder or
+// differ in size, mirroring subdirectories as subfolders. Remote files are never deleted.
+func runSync(ctx context.Context, args []string) error {
+	flags := newFlagSet("sync", "<directory>")
+	folder := flags.String("folder", "", "Folder ID to sync into (default: the root)")
+	tags := flags.String("tags", "", "Comma-separated tags for uploaded files")
+	parallel := flags.Int("parallel", 4, "Concurrent uploads")
+	dryRun := flags.Bool("dry-run", false, "Print the changes without uploading")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	s := &syncer{c: c, tags: splitList(*tags), dryRun: *dryRun}
+	if err := s.plan(ctx, flags.Arg(0), *folder, true); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d files up to date, %d to upload\n", s.unchanged, len(s.tasks))
+	if s.dryRun {
+		return nil
+	}
+	return uploadAll(ctx, c, s.tasks, *parallel)
+}
+
+// syncer compares a local directory tree with a folder tree and collects the uploads
+type syncer struct {
+	c         *client.Client
+	tags      []string
+	dryRun    bool
+	tasks     []uploadTask
+	unchanged int
+}
+
+// plan compares dir with a folder, "" being the root. exists is false for folders a dry
+// run would have created, which are known to be empty.
+func (s *syncer) plan(ctx context.Context, dir, folderID string, exists bool) error {
+	remote := map[string]client.Media{}
+	subfolders := map[string]uint{}
+	if exists {
+		var err error
+		if remote, err = remoteFiles(ctx, s.c, folderID); err != nil {
+			return err
+		}
+		if subfolders, err = remoteFolders(ctx, s.c, folderID); err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+
+		if entry.IsDir() {
+			if id, ok := subfolders[entry.Name()]; ok {
+				if err := s.plan(ctx, path, strconv.FormatUint(uint64(id), 10), true); err != nil {
+					return err
+				}
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "create    %s/\n", path)
+			if s.dryRun {
+				if err := s.plan(ctx, path, "", false); err != nil {
+					return err
+				}
+				continue
+			}
+			created, err := s.c.CreateFolder(ctx, client.FolderInput{Name: entry.Name(), ParentID: parseFolderID(folderID)})
+			if err != nil {
+				return fmt.Errorf("creating folder for %s: %w", path, err)
+			}
+			if err := s.plan(ctx, path, strconv.FormatUint(uint64(created.ID), 10), true); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		task := uploadTask{path: path, name: entry.Name(), size: info.Size()}
+		task.opts = client.UploadOptions{FolderID: folderID, Tags: s.tags, Conflict: client.ConflictSkip}
+		media, ok := remote[entry.Name()]
+		switch {
+		case !ok:
+			if s.dryRun {
+				fmt.Fprintf(os.Stderr, "new       %s\n", path)
+			}
+		case media.Size != info.Size():
+			task.opts.Conflict = client.ConflictReplace
+			if s.dryRun {
+				fmt.Fprintf(os.Stderr, "changed   %s\n", path)
+			}
+		default:
+			s.unchanged++
+			continue
+		}
+		s.tasks = append(s.tasks, task)
+	}
+	return nil
+}
+
+// remoteFiles returns the media items directly in a folder, "" being the root, by
+// filename. Media lists cannot be narrowed to the root, so that pages through all media.
+func remoteFiles(ctx context.Context, c *client.Client, folderID string) (map[string]client.Media, error) {
+	files := map[string]client.Media{}
+	err := c.EachMedia(ctx, client.ListMediaOptions{Limit: pageSize, FolderID: folderID}, func(media client.Media) error {
+		inFolder := media.FolderID == nil
+		if folderID != "" {
+			inFolder = media.FolderID != nil && *media.FolderID == folderID
+		}
+		if inFolder {
+			files[media.Filename] = media
+		}
+		return nil
+	})
+	return files, err
+}
+
+// remoteFolders returns the IDs of the subfolders of a folder by name
+func remoteFolders(ctx context.Context, c *client.Client, folderID string) (map[string]uint, error) {
+	parentID := folderID
+	if parentID == "" {
+		parentID = "root"
+	}
+	ids := map[string]uint{}
+	err := c.EachFolder(ctx, client.ListFoldersOptions{Limit: pageSize, ParentID: parentID}, func(folder client.Folder) error {
+		ids[folder.Name] = folder.ID
+		return nil
+	})
+	return ids, err
+}
+
+// parseFolderID converts a folder ID for FolderInput.ParentID, nil being the root
+func parseFolderID(folderID string) *uint {
+	id, err := strconv.ParseUint(folderID, 10, 0)
+	if err != nil {
+		return nil
+	}
+	parentID := uint(id)
+	return &parentID
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go-media-center-example/pkg/client"
+)
+
+// uploadTask is one local file to upload
+type uploadTask struct {
+	path string
+	name string // Filename sent to the server
+	size int64
+	opts client.UploadOptions
+}
+
+// runUpload uploads files, and the files below directories, into one folder
+func runUpload(ctx context.Context, args []string) error {
+	flags := newFlagSet("upload", "<file|directory>...")
+	folder := flags.String("folder", "", "Folder ID")
+	tags := flags.String("tags", "", "Comma-separated tags")
+	conflict := flags.String("conflict", client.ConflictRename, "Duplicate filename policy: rename, skip or replace")
+	parallel := flags.Int("parallel", 4, "Concurrent uploads")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	opts := client.UploadOptions{FolderID: *folder, Tags: splitList(*tags), Conflict: *conflict}
+	var tasks []uploadTask
+	for _, root := range flags.Args() {
+		err := walkFiles(root, func(path string, info os.FileInfo) {
+			tasks = append(tasks, uploadTask{path: path, name: info.Name(), size: info.Size(), opts: opts})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return uploadAll(ctx, c, tasks, *parallel)
+}
+
+// walkFiles calls fn for root if it is a file, or for every file below it. Hidden
+// files and directories are skipped.
+func walkFiles(root string, fn func(path string, info os.FileInfo)) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fn(path, info)
+		return nil
+	})
+}
+
+// uploadAll uploads tasks with parallel workers and reports progress on stderr. It
+// fails when any upload failed, after trying all of them.
+func uploadAll(ctx context.Context, c *client.Client, tasks []uploadTask, parallel int) error {
+	if len(tasks) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to upload")
+		return nil
+	}
+
+	p := newProgress(tasks)
+	queue := make(chan uploadTask)
+	var wg sync.WaitGroup
+	for range max(parallel, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				result, read, err := uploadOne(ctx, c, task, p)
+				p.finish(task, read, result, err)
+			}
+		}()
+	}
+
+feed:
+	for _, task := range tasks {
+		select {
+		case queue <- task:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	p.close()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if p.failed > 0 {
+		return fmt.Errorf("%d of %d uploads failed", p.failed, len(tasks))
+	}
+	return nil
+}
+
+// uploadOne streams one file, counting the bytes read towards the progress. It returns
+// how many bytes were read.
+func uploadOne(ctx context.Context, c *client.Client, task uploadTask, p *progress) (*client.MediaResult, int64, error) {
+	file, err := os.Open(task.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	reader := &countingReader{r: file, p: p}
+	result, err := c.UploadFile(ctx, task.name, reader, task.opts)
+	return result, reader.read, err
+}
+
+// countingReader reports the bytes read from r
+type countingReader struct {
+	r    io.Reader
+	p    *progress
+	read int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.read += int64(n)
+	r.p.add(int64(n))
+	return n, err
+}
+
+// progressWidth is the number of cells in the progress bar
+const progressWidth = 30
+
+// progress draws a bar of the bytes uploaded on stderr and logs each finished file
+// above it. Without a terminal only the log lines are written.
+type progress struct {
+	mu       sync.Mutex
+	out      *os.File
+	tty      bool
+	total    int64
+	done     int64
+	files    int
+	finished int
+	failed   int
+	drawn    time.Time
+}
+
+func newProgress(tasks []uploadTask) *progress {
+	p := &progress{out: os.Stderr, files: len(tasks)}
+	for _, task := range tasks {
+		p.total += task.size
+	}
+	if info, err := p.out.Stat(); err == nil {
+		p.tty = info.Mode()&os.ModeCharDevice != 0
+	}
+	return p
+}
+
+// add counts uploaded bytes, redrawing the bar at most ten times a second
+func (p *progress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done += n
+	if time.Since(p.drawn) >= 100*time.Millisecond {
+		p.draw()
+	}
+}
+
+// finish logs the outcome of a task and counts its whole size as done, since a failed
+// or skipped upload may not have read the file to the end
+func (p *progress) finish(task uploadTask, read int64, result *client.MediaResult, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.finished++
+	switch {
+	case errors.Is(err, context.Canceled):
+		p.failed++
+	case err != nil:
+		p.failed++
+		p.log("failed    %s: %v", task.path, err)
+	case result.Skipped:
+		p.log("skipped   %s (exists)", task.path)
+	case result.Replaced:
+		p.log("replaced  %s -> %s", task.path, result.Media.ID)
+	default:
+		p.log("uploaded  %s -> %s", task.path, result.Media.ID)
+	}
+	p.done += max(task.size-read, 0)
+	p.draw()
+}
+
+// close finishes the bar with a summary line
+func (p *progress) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	fmt.Fprintf(p.out, "%d files, %s, %d failed\n", p.finished, formatBytes(p.done), p.failed)
+}
+
+// log writes a line above the bar
+func (p *progress) log(format string, args ...interface{}) {
+	p.clear()
+	fmt.Fprintf(p.out, format+"\n", args...)
+}
+
+func (p *progress) clear() {
+	if p.tty {
+		fmt.Fprint(p.out, "\r\033[K")
+	}
+}
+
+func (p *progress) draw() {
+	p.drawn = time.Now()
+	if !p.tty {
+		return
+	}
+	ratio := 1.0
+	if p.total > 0 {
+		ratio = min(float64(p.done)/float64(p.total), 1) // Files may grow while uploading
+	}
+	filled := int(ratio * progressWidth)
+	fmt.Fprintf(p.out, "\r\033[K[%s%s] %3.0f%%  %s / %s  %d/%d files",
+		strings.Repeat("#", filled), strings.Repeat(".", progressWidth-filled), ratio*100,
+		formatBytes(p.done), formatBytes(p.total), p.finished, p.files)
+}
+
+// formatBytes formats a size with a binary unit, e.g. 1.5 MB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-media-center-example/pkg/client"
+)
+
+// runWatch polls local directories and uploads new and changed files, mirroring
+// subdirectories as subfolders. Files are uploaded once they stopped changing for one
+// interval, through resumable direct uploads. Deleting a local file keeps its media.
+func runWatch(ctx context.Context, args []string) error {
+	flags := newFlagSet("watch", "<directory>[=<folder-id>]...")
+	interval := flags.Duration("interval", 10*time.Second, "Time between scans")
+	conflict := flags.String("conflict", client.ConflictReplace, "When a folder already has a different file of the same name: replace, rename or skip")
+	tags := flags.String("tags", "", "Comma-separated tags for uploaded files")
+	once := flags.Bool("once", false, "Scan once, without waiting for files to settle, and exit")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	switch *conflict {
+	case client.ConflictReplace, client.ConflictRename, client.ConflictSkip:
+	default:
+		return fmt.Errorf("invalid -conflict %q", *conflict)
+	}
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	var watchers []*watcher
+	for _, arg := range flags.Args() {
+		dir, folderID, _ := strings.Cut(arg, "=")
+		w, err := newWatcher(c, dir, folderID)
+		if err != nil {
+			return err
+		}
+		w.conflict = *conflict
+		w.tags = splitList(*tags)
+		w.settle = !*once
+		watchers = append(watchers, w)
+	}
+
+	log.SetFlags(log.LstdFlags)
+	for {
+		failed := false
+		for _, w := range watchers {
+			if err := w.scan(ctx); err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				log.Printf("%s: %v", w.dir, err)
+				failed = true
+			}
+		}
+		if *once {
+			if failed {
+				return errors.New("some uploads failed")
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// watchState is what a watcher remembers between runs
+type watchState struct {
+	Files   map[string]*watchedFile `json:"files"`   // By slash-separated path below the directory
+	Folders map[string]string       `json:"folders"` // Folder ID by slash-separated directory path
+}
+
+// watchedFile is the version of a local file last uploaded
+type watchedFile struct {
+	Size    int64          `json:"size"`
+	ModTime time.Time      `json:"mod_time"`
+	MediaID string         `json:"media_id,omitempty"`
+	Pending *pendingUpload `json:"pending,omitempty"` // Multipart upload not completed yet
+}
+
+// fileStamp tells versions of a file apart
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+func (s fileStamp) matches(size int64, modTime time.Time) bool {
+	return s.size == size && s.modTime.Equal(modTime)
+}
+
+// watcher mirrors one local directory into a folder
+type watcher struct {
+	c         *client.Client
+	dir       string
+	folderID  string // "" is the root
+	conflict  string
+	tags      []string
+	settle    bool // Wait until files stop changing
+	statePath string
+	state     watchState
+	seen      map[string]fileStamp // Files as of the previous scan
+}
+
+// newWatcher loads the state of a directory watched into folderID before
+func newWatcher(c *client.Client, dir, folderID string) (*watcher, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(dir + "=" + folderID))
+	w := &watcher{
+		c:         c,
+		dir:       dir,
+		folderID:  folderID,
+		statePath: filepath.Join(configDir, "mediactl", "watch", hex.EncodeToString(sum[:8])+".json"),
+	}
+
+	data, err := os.ReadFile(w.statePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &w.state); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", w.statePath, err)
+		}
+	}
+	if w.state.Files == nil {
+		w.state.Files = map[string]*watchedFile{}
+	}
+	if w.state.Folders == nil {
+		w.state.Folders = map[string]string{}
+	}
+	return w, nil
+}
+
+// save writes the state, replacing the previous file atomically
+func (w *watcher) save() error {
+	data, err := json.Marshal(w.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(w.statePath), 0o700); err != nil {
+		return err
+	}
+	return writeFile(w.statePath, bytes.NewReader(data))
+}
+
+// scan uploads the files that are new or changed since their last upload and have not
+// changed since the previous scan
+func (w *watcher) scan(ctx context.Context) error {
+	current := map[string]fileStamp{}
+	err := walkFiles(w.dir, func(file string, info os.FileInfo) {
+		rel, _ := filepath.Rel(w.dir, file)
+		current[filepath.ToSlash(rel)] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+	})
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	for rel, known := range w.state.Files {
+		if _, ok := current[rel]; !ok {
+			if known.Pending != nil {
+				w.c.AbortUploadSession(ctx, known.Pending.SessionID)
+			}
+			delete(w.state.Files, rel)
+			removed = true
+		}
+	}
+	if removed {
+		if err := w.save(); err != nil {
+			return err
+		}
+	}
+
+	paths := make([]string, 0, len(current))
+	for rel := range current {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	listings := map[string]map[string]client.Media{}
+	failed := 0
+	for _, rel := range paths {
+		stamp := current[rel]
+		known := w.state.Files[rel]
+		if known != nil && known.Pending == nil && stamp.matches(known.Size, known.ModTime) {
+			continue
+		}
+		if previous, ok := w.seen[rel]; w.settle && (!ok || !previous.matches(stamp.size, stamp.modTime)) {
+			continue
+		}
+		if err := w.upload(ctx, rel, stamp, listings); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("failed    %s: %v", filepath.Join(w.dir, rel), err)
+			failed++
+		}
+	}
+	w.seen = current
+
+	if failed > 0 {
+		return fmt.Errorf("%d uploads failed", failed)
+	}
+	return nil
+}
+
+// upload uploads one file. Files seen for the first time that match a media item of the
+// same name and size, e.g. from an earlier sync, are recorded instead. listings caches
+// the media of folders for this.
+func (w *watcher) upload(ctx context.Context, rel string, stamp fileStamp, listings map[string]map[string]client.Media) error {
+	folderID, err := w.folder(ctx, path.Dir(rel))
+	if err != nil {
+		return err
+	}
+	name := path.Base(rel)
+	entry := &watchedFile{Size: stamp.size, ModTime: stamp.modTime}
+	opts := client.UploadOptions{FolderID: folderID, Tags: w.tags, Conflict: client.ConflictReplace}
+
+	known := w.state.Files[rel]
+	if known != nil {
+		entry.MediaID = known.MediaID
+		entry.Pending = known.Pending
+	}
+	if entry.MediaID == "" {
+		files, ok := listings[folderID]
+		if !ok {
+			if files, err = remoteFiles(ctx, w.c, folderID); err != nil {
+				return err
+			}
+			listings[folderID] = files
+		}
+		if media, ok := files[name]; ok && media.Size == stamp.size && entry.Pending == nil {
+			entry.MediaID = media.ID
+			w.state.Files[rel] = entry
+			return w.save()
+		}
+		opts.Conflict = w.conflict
+	}
+
+	result, err := resumableUpload(ctx, w.c, filepath.Join(w.dir, filepath.FromSlash(rel)), name, opts, entry.Pending, func(pending *pendingUpload) error {
+		entry.Pending = pending
+		w.state.Files[rel] = entry
+		return w.save()
+	})
+	if err != nil {
+		// The folder may have been deleted; look the folders up again next time
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) && hasFieldError(apiErr, "folder_id") {
+			w.state.Folders = map[string]string{}
+			w.save()
+		}
+		return err
+	}
+
+	switch {
+	case result.Skipped:
+		log.Printf("skipped   %s (exists)", filepath.Join(w.dir, rel))
+	case result.Replaced:
+		log.Printf("replaced  %s -> %s", filepath.Join(w.dir, rel), result.Media.ID)
+	default:
+		log.Printf("uploaded  %s -> %s", filepath.Join(w.dir, rel), result.Media.ID)
+	}
+	entry.MediaID = result.Media.ID
+	entry.Pending = nil
+	w.state.Files[rel] = entry
+	return w.save()
+}
+
+// folder returns the ID of the folder mirroring a directory below the watched one,
+// creating it and its parents when missing
+func (w *watcher) folder(ctx context.Context, relDir string) (string, error) {
+	if relDir == "." {
+		return w.folderID, nil
+	}
+	if id, ok := w.state.Folders[relDir]; ok {
+		return id, nil
+	}
+
+	parentID, err := w.folder(ctx, path.Dir(relDir))
+	if err != nil {
+		return "", err
+	}
+	subfolders, err := remoteFolders(ctx, w.c, parentID)
+	if err != nil {
+		return "", err
+	}
+	id, ok := subfolders[path.Base(relDir)]
+	if !ok {
+		created, err := w.c.CreateFolder(ctx, client.FolderInput{Name: path.Base(relDir), ParentID: parseFolderID(parentID)})
+		if err != nil {
+			return "", fmt.Errorf("creating folder for %s: %w", relDir, err)
+		}
+		log.Printf("created   %s/ -> folder %d", filepath.Join(w.dir, relDir), created.ID)
+		id = created.ID
+	}
+
+	w.state.Folders[relDir] = strconv.FormatUint(uint64(id), 10)
+	return w.state.Folders[relDir], w.save()
+}
+
+// hasFieldError reports whether an API error rejected the given field
+func hasFieldError(err *client.APIError, field string) bool {
+	for _, f := range err.Fields {
+		if f.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// Command migrate applies and rolls back the versioned SQL migrations in
+// database/migrations against the configured database.
+//
+//	go run ./cmd/migrate up [ID]      apply pending migrations, optionally only up to ID
+//	go run ./cmd/migrate down [ID]    roll back the last migration, or those applied after ID
+//	go run ./cmd/migrate reset        roll back every migration and apply them again
+//	go run ./cmd/migrate status       list migrations and whether they were applied
+//	go run ./cmd/migrate baseline ID  record migrations up to ID as applied without running them
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"go-media-center-example/database/migrations"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: migrate {up [ID] | down [ID] | reset | status | baseline ID}")
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 || len(args) > 2 {
+		usage()
+	}
+	command, id := args[0], ""
+	if len(args) == 2 {
+		id = args[1]
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+	if err := database.Initialize(cfg); err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+
+	switch command {
+	case "up":
+		if id == "" {
+			err = migrations.Migrate()
+		} else {
+			err = migrations.MigrateTo(id)
+		}
+	case "down":
+		if id == "" {
+			err = migrations.Rollback()
+		} else {
+			err = migrations.RollbackTo(id)
+		}
+	case "reset":
+		err = migrations.Reset()
+	case "status":
+		err = printStatus()
+	case "baseline":
+		if id == "" {
+			usage()
+		}
+		err = migrations.Baseline(id)
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("Migrate %s failed: %v", command, err)
+	}
+	if command != "status" {
+		log.Printf("Migrate %s finished", command)
+	}
+}
+
+// printStatus lists every migration with whether it was applied
+func printStatus() error {
+	statuses, err := migrations.Status()
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied"
+		}
+		fmt.Printf("%-8s %s\n", state, status.ID)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Command openapi writes the OpenAPI 3 document of the API without starting the server
+// or connecting to a database. The document feeds the generated TypeScript and Python
+// clients:
+//
+//	go run ./cmd/openapi -out build/openapi.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api"
+)
+
+func main() {
+	out := flag.String("out", "", "Output file (default stdout)")
+	flag.Parse()
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	api.SetupRoutes(router)
+
+	data, err := json.MarshalIndent(api.OpenAPIDocument(router), "", "  ")
+	if err != nil {
+		log.Fatal("Failed to encode OpenAPI document:", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(*out), 0755); err != nil {
+		log.Fatal("Failed to create output directory:", err)
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatal("Failed to write OpenAPI document:", err)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	folderNames = []string{
+		"Projects", "Campaigns", "Clients", "Archive", "Drafts", "Events",
+		"Products", "Team", "Social", "Press", "Website", "Raw",
+	}
+	filenameWords = []string{
+		"sunset", "beach", "mountain", "portrait", "studio", "product", "launch",
+		"office", "team", "street", "skyline", "coffee", "garden", "winter",
+		"summer", "conference", "banner", "hero", "detail", "lifestyle",
+	}
+)
+
+// seeder generates demo data according to a Spec
+type seeder struct {
+	spec   *Spec
+	rng    *rand.Rand
+	tags   []models.Tag
+	dryRun bool
+}
+
+// run creates every user in the spec along with their folders and media
+func (s *seeder) run() error {
+	if err := s.createTags(); err != nil {
+		return err
+	}
+
+	for _, userSpec := range s.spec.Users {
+		if err := s.seedUser(userSpec); err != nil {
+			return fmt.Errorf("user %s: %v", userSpec.Username, err)
+		}
+	}
+	return nil
+}
+
+// createTags finds or creates the tag pool
+func (s *seeder) createTags() error {
+	for _, name := range s.spec.Tags {
+		tag := models.Tag{Name: name}
+		if !s.dryRun {
+			if err := database.GetDB().Where("name = ?", name).FirstOrCreate(&tag, models.Tag{Name: name}).Error; err != nil {
+				return fmt.Errorf("failed to create tag %s: %v", name, err)
+			}
+		}
+		s.tags = append(s.tags, tag)
+	}
+	return nil
+}
+
+// seedUser creates one user, skipping users that already exist so the seed can be re-run
+func (s *seeder) seedUser(spec UserSpec) error {
+	var existing models.User
+	if err := database.GetDB().Where("username = ? OR email = ?", spec.Username, spec.Email).First(&existing).Error; err == nil {
+		log.Printf("User %s already exists, skipping", spec.Username)
+		return nil
+	}
+
+	folderCount := 0
+	for level, width := 0, 1; level < spec.Folders.Depth; level++ {
+		width *= spec.Folders.PerLevel
+		folderCount += width
+	}
+	log.Printf("Seeding user %s (%s): %d folders, %d media", spec.Username, spec.Role, folderCount, spec.Media)
+	if s.dryRun {
+		return nil
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(s.spec.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	user := models.User{
+		Username: spec.Username,
+		Password: string(hashedPassword),
+		Email:    spec.Email,
+		Role:     spec.Role,
+	}
+	if err := database.GetDB().Create(&user).Error; err != nil {
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+
+	folders, err := s.createFolders(user.ID, nil, spec.Folders, 1)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < spec.Media; i++ {
+		// Roughly a fifth of the library stays at the root
+		var folderID *string
+		if len(folders) > 0 && s.rng.Intn(5) > 0 {
+			id := strconv.FormatUint(uint64(folders[s.rng.Intn(len(folders))].ID), 10)
+			folderID = &id
+		}
+		if err := s.createMedia(user.ID, folderID, i); err != nil {
+			return err
+		}
+		if (i+1)%50 == 0 {
+			log.Printf("  %s: %d/%d media", spec.Username, i+1, spec.Media)
+		}
+	}
+	return nil
+}
+
+// createFolders builds the folder tree below parentID and returns every folder created
+func (s *seeder) createFolders(userID uint, parentID *uint, spec FolderSpec, level int) ([]models.Folder, error) {
+	if level > spec.Depth {
+		return nil, nil
+	}
+
+	var created []models.Folder
+	names := s.rng.Perm(len(folderNames))
+	for i := 0; i < spec.PerLevel; i++ {
+		name := folderNames[names[i%len(names)]]
+		if i >= len(folderNames) {
+			name = fmt.Sprintf("%s %d", name, i/len(folderNames)+1)
+		}
+
+		folder := models.Folder{
+			Name:        name,
+			Description: fmt.Sprintf("Demo folder (level %d)", level),
+			ParentID:    parentID,
+			UserID:      userID,
+		}
+		if err := database.GetDB().Create(&folder).Error; err != nil {
+			return nil, fmt.Errorf("failed to create folder: %v", err)
+		}
+		created = append(created, folder)
+
+		children, err := s.createFolders(userID, &folder.ID, spec, level+1)
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, children...)
+	}
+	return created, nil
+}
+
+// objectName is a storage key for a seeded file that no other upload or seeding run
+// shares, in the form uploads use
+func objectName(filename string) string {
+	b := make([]byte, 8)
+	crand.Read(b)
+	return "media-" + hex.EncodeToString(b) + "-" + filename
+}
+
+// createMedia generates a synthetic image, stores it and records it like an upload would
+func (s *seeder) createMedia(userID uint, folderID *string, index int) error {
+	format := s.spec.Images.Formats[s.rng.Intn(len(s.spec.Images.Formats))]
+	width := s.spec.Images.MinWidth + s.rng.Intn(s.spec.Images.MaxWidth-s.spec.Images.MinWidth+1)
+	height := s.spec.Images.MinHeight + s.rng.Intn(s.spec.Images.MaxHeight-s.spec.Images.MinHeight+1)
+
+	data, err := s.syntheticImage(width, height, format)
+	if err != nil {
+		return fmt.Errorf("failed to generate image: %v", err)
+	}
+
+	ext, mimeType := ".jpg", "image/jpeg"
+	if format == "png" {
+		ext, mimeType = ".png", "image/png"
+	}
+	filename := fmt.Sprintf("%s-%s-%04d%s",
+		filenameWords[s.rng.Intn(len(filenameWords))],
+		filenameWords[s.rng.Intn(len(filenameWords))],
+		index+1, ext)
+
+	analysis, err := utils.AnalyzeImage(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to analyze image: %v", err)
+	}
+
+	backendName, storageProvider := storage.SelectUploadBackend()
+	fileID, err := storageProvider.UploadBytes(context.Background(), data, objectName(filename))
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", filename, err)
+	}
+
+	// Spread creation dates over the past year so sorting and pagination have something to work with
+	createdAt := time.Now().Add(-time.Duration(s.rng.Int63n(int64(365 * 24 * time.Hour))))
+
+	orientation := "square"
+	if width > height {
+		orientation = "landscape"
+	} else if width < height {
+		orientation = "portrait"
+	}
+	metadata := map[string]interface{}{
+		"original_name": filename,
+		"file_id":       fileID,
+		"seeded":        true,
+		"technical": &utils.MediaMetadata{
+			FileType:     "image",
+			MimeType:     mimeType,
+			Size:         int64(len(data)),
+			UploadedAt:   createdAt.Format(time.RFC3339),
+			Dimensions:   &utils.Dimensions{Width: width, Height: height},
+			Format:       strings.TrimPrefix(ext, "."),
+			ColorSpace:   "RGB",
+			Orientation:  orientation,
+			ContentClass: analysis.ContentClass,
+			Colors:       analysis.Colors,
+		},
+	}
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+
+	media := models.Media{
+		ID:             fileID,
+		UserID:         userID,
+		FolderID:       folderID,
+		Filename:       filename,
+		Path:           fileID,
+		StorageBackend: backendName,
+		MimeType:       mimeType,
+		Size:           int64(len(data)),
+		Metadata:       metadataJSON,
+		CreatedAt:      createdAt,
+		UpdatedAt:      createdAt,
+		Tags:           s.pickTags(),
+	}
+	if err := database.GetDB().Create(&media).Error; err != nil {
+		storageProvider.Delete(context.Background(), fileID)
+		return fmt.Errorf("failed to save media %s: %v", filename, err)
+	}
+	return nil
+}
+
+// pickTags returns up to three distinct tags from the pool
+func (s *seeder) pickTags() []models.Tag {
+	if len(s.tags) == 0 {
+		return nil
+	}
+	count := s.rng.Intn(min(3, len(s.tags)) + 1)
+	var picked []models.Tag
+	for _, i := range s.rng.Perm(len(s.tags))[:count] {
+		picked = append(picked, s.tags[i])
+	}
+	return picked
+}
+
+// syntheticImage draws a gradient background with a few shapes so transforms and smart
+// crops have real edges and colors to work on
+func (s *seeder) syntheticImage(width, height int, format string) ([]byte, error) {
+	from, to := s.randomColor(), s.randomColor()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		t := float64(y) / float64(height)
+		row := color.NRGBA{
+			R: uint8(float64(from.R)*(1-t) + float64(to.R)*t),
+			G: uint8(float64(from.G)*(1-t) + float64(to.G)*t),
+			B: uint8(float64(from.B)*(1-t) + float64(to.B)*t),
+			A: 255,
+		}
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, row)
+		}
+	}
+
+	for i := 0; i < 3+s.rng.Intn(5); i++ {
+		shapeW := width/10 + s.rng.Intn(width/3+1)
+		shapeH := height/10 + s.rng.Intn(height/3+1)
+		pos := image.Pt(s.rng.Intn(width), s.rng.Intn(height))
+		fill := s.randomColor()
+		fill.A = uint8(160 + s.rng.Intn(96))
+
+		if s.rng.Intn(2) == 0 {
+			img = imaging.Overlay(img, imaging.New(shapeW, shapeH, fill), pos, float64(fill.A)/255)
+			continue
+		}
+
+		// Ellipse, drawn opaque
+		fill.A = 255
+		cx, cy := float64(pos.X), float64(pos.Y)
+		rx, ry := float64(shapeW)/2, float64(shapeH)/2
+		for y := max(0, pos.Y-shapeH/2); y < min(height, pos.Y+shapeH/2); y++ {
+			for x := max(0, pos.X-shapeW/2); x < min(width, pos.X+shapeW/2); x++ {
+				dx, dy := (float64(x)-cx)/rx, (float64(y)-cy)/ry
+				if dx*dx+dy*dy <= 1 {
+					img.SetNRGBA(x, y, fill)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = imaging.Encode(&buf, img, imaging.PNG)
+	} else {
+		err = imaging.Encode(&buf, img, imaging.JPEG, imaging.JPEGQuality(80))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// randomColor returns an opaque random color
+func (s *seeder) randomColor() color.NRGBA {
+	return color.NRGBA{R: uint8(s.rng.Intn(256)), G: uint8(s.rng.Intn(256)), B: uint8(s.rng.Intn(256)), A: 255}
+}
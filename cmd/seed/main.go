@@ -0,0 +1,52 @@
+// Command seed fills a local database and storage backend with demo data described by a
+// JSON spec: users, nested folders and tagged media backed by synthetic images.
+//
+//	go run ./cmd/seed -spec database/seeds/demo.json
+package main
+
+import (
+	"flag"
+	"log"
+	"math/rand"
+	"time"
+
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+)
+
+func main() {
+	specPath := flag.String("spec", "database/seeds/demo.json", "Path to the seed spec")
+	mediaPerUser := flag.Int("media", -1, "Override the number of media generated per user")
+	dryRun := flag.Bool("dry-run", false, "Print what would be generated without writing anything")
+	flag.Parse()
+
+	spec, err := loadSpec(*specPath)
+	if err != nil {
+		log.Fatal("Failed to load seed spec:", err)
+	}
+	if *mediaPerUser >= 0 {
+		for i := range spec.Users {
+			spec.Users[i].Media = *mediaPerUser
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Failed to load configuration:", err)
+	}
+	if err := database.Initialize(cfg); err != nil {
+		log.Fatal("Failed to initialize database:", err)
+	}
+
+	seed := spec.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	s := &seeder{spec: spec, rng: rand.New(rand.NewSource(seed)), dryRun: *dryRun}
+	start := time.Now()
+	if err := s.run(); err != nil {
+		log.Fatal("Seeding failed:", err)
+	}
+	log.Printf("Seeding finished in %s (seed %d)", time.Since(start).Round(time.Millisecond), seed)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"go-media-center-example/internal/models"
+)
+
+// Spec declares the demo data to generate
+type Spec struct {
+	Seed     int64      `json:"seed"`     // Random seed; the same spec always produces the same data
+	Password string     `json:"password"` // Password shared by all seeded users
+	Tags     []string   `json:"tags"`     // Tag pool media are tagged from
+	Images   ImageSpec  `json:"images"`
+	Users    []UserSpec `json:"users"`
+}
+
+// ImageSpec bounds the synthetic images
+type ImageSpec struct {
+	MinWidth  int      `json:"min_width"`
+	MaxWidth  int      `json:"max_width"`
+	MinHeight int      `json:"min_height"`
+	MaxHeight int      `json:"max_height"`
+	Formats   []string `json:"formats"` // jpeg and/or png
+}
+
+// UserSpec declares one user and the library generated for them
+type UserSpec struct {
+	Username string     `json:"username"`
+	Email    string     `json:"email"`
+	Role     string     `json:"role"`
+	Folders  FolderSpec `json:"folders"`
+	Media    int        `json:"media"`
+}
+
+// FolderSpec describes a folder tree of per_level folders at each of depth levels
+type FolderSpec struct {
+	Depth    int `json:"depth"`
+	PerLevel int `json:"per_level"`
+}
+
+// loadSpec reads a seed spec from path and fills in defaults
+func loadSpec(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec: %v", err)
+	}
+
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %v", err)
+	}
+
+	if spec.Password == "" {
+		spec.Password = "password123"
+	}
+	if spec.Images.MinWidth <= 0 {
+		spec.Images.MinWidth = 320
+	}
+	if spec.Images.MaxWidth < spec.Images.MinWidth {
+		spec.Images.MaxWidth = spec.Images.MinWidth
+	}
+	if spec.Images.MinHeight <= 0 {
+		spec.Images.MinHeight = 240
+	}
+	if spec.Images.MaxHeight < spec.Images.MinHeight {
+		spec.Images.MaxHeight = spec.Images.MinHeight
+	}
+	if len(spec.Images.Formats) == 0 {
+		spec.Images.Formats = []string{"jpeg"}
+	}
+
+	for _, format := range spec.Images.Formats {
+		if format != "jpeg" && format != "png" {
+			return nil, fmt.Errorf("unsupported image format: %s (expected jpeg or png)", format)
+		}
+	}
+	for i, user := range spec.Users {
+		if user.Username == "" || user.Email == "" {
+			return nil, fmt.Errorf("user %d: username and email are required", i)
+		}
+		if user.Role == "" {
+			spec.Users[i].Role = models.RoleUser
+		} else if user.Role != models.RoleUser && user.Role != models.RoleAdmin {
+			return nil, fmt.Errorf("user %s: invalid role %s", user.Username, user.Role)
+		}
+	}
+
+	return &spec, nil
+}
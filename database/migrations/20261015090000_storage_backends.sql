@@ -0,0 +1,5 @@
+-- Storage backend holding each media object (empty = primary provider)
+ALTER TABLE media ADD COLUMN storage_backend VARCHAR(50) NOT NULL DEFAULT '';
+
+-- User roles
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
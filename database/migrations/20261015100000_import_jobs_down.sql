@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_import_job_items_job_id;
+DROP INDEX IF EXISTS idx_import_jobs_status;
+DROP INDEX IF EXISTS idx_import_jobs_user_id;
+
+DROP TABLE IF EXISTS import_job_items;
+DROP TABLE IF EXISTS import_jobs;
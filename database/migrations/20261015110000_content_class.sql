@@ -0,0 +1,2 @@
+-- Content class (photo, screenshot, scan, graphic) detected on upload, used to filter listings
+CREATE INDEX idx_media_content_class ON media ((metadata->'technical'->>'content_class'));
@@ -0,0 +1,16 @@
+-- Cached transforms and thumbnails stored next to their originals
+CREATE TABLE derivatives (
+    id SERIAL PRIMARY KEY,
+    media_id VARCHAR(255) NOT NULL,
+    cache_key VARCHAR(512) NOT NULL,
+    storage_backend VARCHAR(50),
+    path VARCHAR(512) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    hits BIGINT NOT NULL DEFAULT 0,
+    last_accessed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_derivatives_cache_key ON derivatives(cache_key);
+CREATE INDEX idx_derivatives_media_id ON derivatives(media_id);
+CREATE INDEX idx_derivatives_last_accessed_at ON derivatives(last_accessed_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_derivatives_last_accessed_at;
+DROP INDEX IF EXISTS idx_derivatives_media_id;
+DROP INDEX IF EXISTS idx_derivatives_cache_key;
+
+DROP TABLE IF EXISTS derivatives;
@@ -0,0 +1,8 @@
+-- Import jobs become generic background batch jobs: URL imports and transforms
+ALTER TABLE import_jobs ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'url_import';
+
+-- Source media and transformation options of transform items
+ALTER TABLE import_job_items ADD COLUMN source_id VARCHAR(255);
+ALTER TABLE import_job_items ADD COLUMN options JSONB;
+
+CREATE INDEX idx_import_jobs_kind ON import_jobs(kind);
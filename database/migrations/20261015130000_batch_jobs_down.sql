@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_import_jobs_kind;
+
+ALTER TABLE import_job_items DROP COLUMN IF EXISTS options;
+ALTER TABLE import_job_items DROP COLUMN IF EXISTS source_id;
+
+DELETE FROM import_jobs WHERE kind <> 'url_import';
+ALTER TABLE import_jobs DROP COLUMN IF EXISTS kind;
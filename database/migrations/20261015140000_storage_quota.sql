@@ -0,0 +1,2 @@
+-- Per-user storage quota overriding STORAGE_QUOTA; NULL uses the default
+ALTER TABLE users ADD COLUMN storage_quota BIGINT;
@@ -0,0 +1,25 @@
+-- Multipart direct uploads from their start until the media item is created or aborted
+CREATE TABLE upload_sessions (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    storage_backend VARCHAR(50),
+    key VARCHAR(512) NOT NULL,
+    upload_id VARCHAR(1024) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(255),
+    size BIGINT NOT NULL,
+    part_size BIGINT NOT NULL,
+    part_count INTEGER NOT NULL,
+    folder_id VARCHAR(255),
+    tags JSONB,
+    conflict VARCHAR(20),
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    media_id VARCHAR(255),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_upload_sessions_user_id ON upload_sessions(user_id);
+CREATE INDEX idx_upload_sessions_status ON upload_sessions(status);
+CREATE INDEX idx_upload_sessions_expires_at ON upload_sessions(expires_at);
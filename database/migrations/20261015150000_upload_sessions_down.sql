@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_upload_sessions_expires_at;
+DROP INDEX IF EXISTS idx_upload_sessions_status;
+DROP INDEX IF EXISTS idx_upload_sessions_user_id;
+
+DROP TABLE IF EXISTS upload_sessions;
@@ -0,0 +1,32 @@
+-- Folder lifecycle rules and the log of actions they applied
+CREATE TABLE lifecycle_rules (
+    id SERIAL PRIMARY KEY,
+    folder_id INTEGER NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    action VARCHAR(20) NOT NULL,
+    after_days INTEGER NOT NULL,
+    storage_class VARCHAR(50),
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE lifecycle_actions (
+    id SERIAL PRIMARY KEY,
+    rule_id INTEGER NOT NULL,
+    folder_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    media_id VARCHAR(255) NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    detail VARCHAR(255),
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_lifecycle_rules_folder_id ON lifecycle_rules(folder_id);
+CREATE INDEX idx_lifecycle_rules_user_id ON lifecycle_rules(user_id);
+CREATE INDEX idx_lifecycle_actions_rule_id ON lifecycle_actions(rule_id);
+CREATE INDEX idx_lifecycle_actions_folder_id ON lifecycle_actions(folder_id);
+CREATE INDEX idx_lifecycle_actions_media_id ON lifecycle_actions(media_id);
+CREATE INDEX idx_lifecycle_actions_created_at ON lifecycle_actions(created_at);
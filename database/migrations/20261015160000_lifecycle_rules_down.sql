@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_lifecycle_actions_created_at;
+DROP INDEX IF EXISTS idx_lifecycle_actions_media_id;
+DROP INDEX IF EXISTS idx_lifecycle_actions_folder_id;
+DROP INDEX IF EXISTS idx_lifecycle_actions_rule_id;
+DROP INDEX IF EXISTS idx_lifecycle_rules_user_id;
+DROP INDEX IF EXISTS idx_lifecycle_rules_folder_id;
+
+DROP TABLE IF EXISTS lifecycle_actions;
+DROP TABLE IF EXISTS lifecycle_rules;
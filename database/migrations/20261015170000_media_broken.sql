@@ -0,0 +1,5 @@
+-- Media whose stored object the consistency check found missing
+ALTER TABLE media ADD COLUMN broken BOOLEAN NOT NULL DEFAULT false;
+
+-- Folder descriptions were only ever created by AutoMigrate
+ALTER TABLE folders ADD COLUMN IF NOT EXISTS description TEXT;
@@ -0,0 +1,4 @@
+-- URLs are built when media are returned; drop the copies stored in metadata, which
+-- exposed internal storage addresses
+UPDATE media SET metadata = metadata - 'internal_url' - 'public_url'
+WHERE jsonb_typeof(metadata) = 'object';
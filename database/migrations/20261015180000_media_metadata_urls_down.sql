@@ -0,0 +1 @@
+-- The removed URLs are not restored; responses carry them as fields instead
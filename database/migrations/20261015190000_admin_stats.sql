@@ -0,0 +1,6 @@
+-- How long a derivative took to render, for the slowest transforms in the admin stats
+ALTER TABLE derivatives ADD COLUMN render_ms BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX idx_derivatives_render_ms ON derivatives(render_ms);
+
+-- Uploads per day are counted over a range of creation times
+CREATE INDEX idx_media_created_at ON media(created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_media_created_at;
+DROP INDEX IF EXISTS idx_derivatives_render_ms;
+ALTER TABLE derivatives DROP COLUMN IF EXISTS render_ms;
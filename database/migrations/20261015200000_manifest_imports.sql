@@ -0,0 +1,4 @@
+-- Manifest import items register existing objects and carry their own folder and metadata
+ALTER TABLE import_job_items ADD COLUMN storage_key VARCHAR(1024);
+ALTER TABLE import_job_items ADD COLUMN folder_id VARCHAR(255);
+ALTER TABLE import_job_items ADD COLUMN metadata JSONB;
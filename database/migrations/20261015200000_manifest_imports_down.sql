@@ -0,0 +1,5 @@
+DELETE FROM import_jobs WHERE kind = 'manifest';
+
+ALTER TABLE import_job_items DROP COLUMN IF EXISTS metadata;
+ALTER TABLE import_job_items DROP COLUMN IF EXISTS folder_id;
+ALTER TABLE import_job_items DROP COLUMN IF EXISTS storage_key;
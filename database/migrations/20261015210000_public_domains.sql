@@ -0,0 +1,3 @@
+-- Custom hostname serving a user's media URLs; NULL uses the backend's public URL
+ALTER TABLE users ADD COLUMN public_domain VARCHAR(253);
+CREATE UNIQUE INDEX idx_users_public_domain ON users (public_domain);
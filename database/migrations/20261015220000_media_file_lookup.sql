@@ -0,0 +1,4 @@
+-- File URLs look media up by exact storage key, or by filename for URLs built before
+-- keys were unique
+CREATE INDEX idx_media_user_path ON media(user_id, path);
+CREATE INDEX idx_media_user_filename ON media(user_id, filename);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_media_user_filename;
+DROP INDEX IF EXISTS idx_media_user_path;
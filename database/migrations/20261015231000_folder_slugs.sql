@@ -0,0 +1,34 @@
+-- Folder names become unique among the folders of a parent, and folders get URL-safe slugs
+-- for path lookups
+ALTER TABLE folders ADD COLUMN slug VARCHAR(255);
+
+-- Folders named like an older sibling are numbered like renamed uploads
+WITH duplicates AS (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id, COALESCE(parent_id, 0), name ORDER BY id) - 1 AS n
+    FROM folders
+    WHERE deleted_at IS NULL
+)
+UPDATE folders SET name = LEFT(folders.name, 240) || ' (' || duplicates.n || ')'
+FROM duplicates
+WHERE folders.id = duplicates.id AND duplicates.n > 0;
+
+-- Existing folders get slugs of the ASCII letters and digits of their names; folders named
+-- from now on also keep accented letters, without their accents
+UPDATE folders SET slug = COALESCE(
+    NULLIF(TRIM(BOTH '-' FROM LEFT(regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'), 240)), ''),
+    'folder'
+);
+
+WITH duplicates AS (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id, COALESCE(parent_id, 0), slug ORDER BY id) AS n
+    FROM folders
+    WHERE deleted_at IS NULL
+)
+UPDATE folders SET slug = folders.slug || '-' || duplicates.n
+FROM duplicates
+WHERE folders.id = duplicates.id AND duplicates.n > 1;
+
+ALTER TABLE folders ALTER COLUMN slug SET NOT NULL;
+
+CREATE UNIQUE INDEX idx_folders_user_parent_name ON folders(user_id, COALESCE(parent_id, 0), name) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_folders_user_parent_slug ON folders(user_id, COALESCE(parent_id, 0), slug) WHERE deleted_at IS NULL;
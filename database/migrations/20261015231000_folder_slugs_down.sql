@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_folders_user_parent_slug;
+DROP INDEX IF EXISTS idx_folders_user_parent_name;
+
+ALTER TABLE folders DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,17 @@
+-- Media and folders admins transferred between users, kept as an audit log
+CREATE TABLE ownership_transfers (
+    id SERIAL PRIMARY KEY,
+    admin_id INTEGER NOT NULL REFERENCES users(id),
+    from_user_id INTEGER NOT NULL REFERENCES users(id),
+    to_user_id INTEGER NOT NULL REFERENCES users(id),
+    media_count INTEGER NOT NULL DEFAULT 0,
+    folder_count INTEGER NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    media_ids JSONB NOT NULL DEFAULT '[]',
+    folder_ids JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_ownership_transfers_from_user_id ON ownership_transfers(from_user_id);
+CREATE INDEX idx_ownership_transfers_to_user_id ON ownership_transfers(to_user_id);
+CREATE INDEX idx_ownership_transfers_created_at ON ownership_transfers(created_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_ownership_transfers_created_at;
+DROP INDEX IF EXISTS idx_ownership_transfers_to_user_id;
+DROP INDEX IF EXISTS idx_ownership_transfers_from_user_id;
+
+DROP TABLE IF EXISTS ownership_transfers;
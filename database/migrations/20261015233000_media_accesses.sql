@@ -0,0 +1,14 @@
+-- How often each user viewed, served and downloaded each media item, and when they last did
+CREATE TABLE media_accesses (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    media_id VARCHAR(255) NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    views BIGINT NOT NULL DEFAULT 0,
+    serves BIGINT NOT NULL DEFAULT 0,
+    downloads BIGINT NOT NULL DEFAULT 0,
+    last_access VARCHAR(20) NOT NULL,
+    last_accessed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, media_id)
+);
+
+CREATE INDEX idx_media_accesses_user_last_accessed_at ON media_accesses(user_id, last_accessed_at DESC);
+CREATE INDEX idx_media_accesses_media_id ON media_accesses(media_id);
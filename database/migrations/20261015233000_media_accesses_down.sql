@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_media_accesses_media_id;
+DROP INDEX IF EXISTS idx_media_accesses_user_last_accessed_at;
+
+DROP TABLE IF EXISTS media_accesses;
@@ -0,0 +1,15 @@
+-- Views and downloads through signed embed links, reported to the owner of the media
+CREATE TABLE embed_link_events (
+    id BIGSERIAL PRIMARY KEY,
+    media_id VARCHAR(255) NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    link_expires BIGINT NOT NULL DEFAULT 0,
+    referrer VARCHAR(512),
+    country VARCHAR(2),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_embed_link_events_media_id_created_at ON embed_link_events(media_id, created_at);
+CREATE INDEX idx_embed_link_events_user_id ON embed_link_events(user_id);
+CREATE INDEX idx_embed_link_events_created_at ON embed_link_events(created_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_embed_link_events_created_at;
+DROP INDEX IF EXISTS idx_embed_link_events_user_id;
+DROP INDEX IF EXISTS idx_embed_link_events_media_id_created_at;
+
+DROP TABLE IF EXISTS embed_link_events;
@@ -0,0 +1,18 @@
+-- Review workflow of media. Media stored before it count as approved, so they stay
+-- published when publishing is limited to approved media.
+ALTER TABLE media ADD COLUMN workflow_status VARCHAR(20) NOT NULL DEFAULT 'draft';
+UPDATE media SET workflow_status = 'approved';
+
+CREATE INDEX idx_media_user_id_workflow_status ON media(user_id, workflow_status);
+
+CREATE TABLE workflow_transitions (
+    id SERIAL PRIMARY KEY,
+    media_id VARCHAR(255) NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    from_status VARCHAR(20) NOT NULL,
+    to_status VARCHAR(20) NOT NULL,
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_workflow_transitions_media_id ON workflow_transitions(media_id);
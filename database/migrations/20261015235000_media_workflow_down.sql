@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_workflow_transitions_media_id;
+DROP TABLE IF EXISTS workflow_transitions;
+
+DROP INDEX IF EXISTS idx_media_user_id_workflow_status;
+ALTER TABLE media DROP COLUMN IF EXISTS workflow_status;
@@ -0,0 +1,11 @@
+-- Typed custom metadata fields admins define, validated on media updates
+CREATE TABLE metadata_fields (
+    id SERIAL PRIMARY KEY,
+    key VARCHAR(64) NOT NULL UNIQUE,
+    label VARCHAR(255) NOT NULL,
+    type VARCHAR(20) NOT NULL,
+    options JSONB,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
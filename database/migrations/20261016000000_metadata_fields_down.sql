@@ -0,0 +1 @@
+DROP TABLE IF EXISTS metadata_fields;
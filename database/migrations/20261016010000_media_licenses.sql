@@ -0,0 +1,6 @@
+-- License of media: type, rights holder and the last day it may be used
+ALTER TABLE media ADD COLUMN license_type VARCHAR(32) NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN rights_holder VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE media ADD COLUMN license_expires_at DATE;
+
+CREATE INDEX idx_media_license_expires_at ON media(license_expires_at) WHERE license_expires_at IS NOT NULL;
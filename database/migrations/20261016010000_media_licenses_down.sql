@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_media_license_expires_at;
+
+ALTER TABLE media DROP COLUMN IF EXISTS license_expires_at;
+ALTER TABLE media DROP COLUMN IF EXISTS rights_holder;
+ALTER TABLE media DROP COLUMN IF EXISTS license_type;
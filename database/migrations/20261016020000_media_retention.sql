@@ -0,0 +1,19 @@
+-- Legal holds and retention periods keeping media from being deleted, with their audit log
+ALTER TABLE media ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE media ADD COLUMN retain_until TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE retention_events (
+    id SERIAL PRIMARY KEY,
+    media_id VARCHAR(255) NOT NULL REFERENCES media(id) ON DELETE CASCADE,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id),
+    action VARCHAR(32) NOT NULL,
+    retain_until TIMESTAMP WITH TIME ZONE,
+    override BOOLEAN NOT NULL DEFAULT FALSE,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_retention_events_media_id ON retention_events(media_id);
+CREATE INDEX idx_retention_events_owner_id ON retention_events(owner_id);
+CREATE INDEX idx_retention_events_created_at ON retention_events(created_at);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_retention_events_created_at;
+DROP INDEX IF EXISTS idx_retention_events_owner_id;
+DROP INDEX IF EXISTS idx_retention_events_media_id;
+
+DROP TABLE IF EXISTS retention_events;
+
+ALTER TABLE media DROP COLUMN IF EXISTS retain_until;
+ALTER TABLE media DROP COLUMN IF EXISTS legal_hold;
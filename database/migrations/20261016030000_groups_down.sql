@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_group_memberships_user_id;
+DROP TABLE IF EXISTS group_memberships;
+
+DROP INDEX IF EXISTS idx_groups_owner_id_name;
+DROP TABLE IF EXISTS groups;
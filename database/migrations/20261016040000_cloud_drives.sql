@@ -0,0 +1,18 @@
+-- Cloud drive accounts users connected over OAuth, and the imports reading from them
+CREATE TABLE cloud_drive_connections (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(32) NOT NULL,
+    account_id VARCHAR(255) NOT NULL,
+    account_name VARCHAR(255),
+    account_email VARCHAR(255),
+    access_token TEXT NOT NULL,
+    refresh_token TEXT,
+    token_expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_cloud_drive_connections_account ON cloud_drive_connections(user_id, provider, account_id);
+
+ALTER TABLE import_jobs ADD COLUMN drive_id INTEGER REFERENCES cloud_drive_connections(id) ON DELETE SET NULL;
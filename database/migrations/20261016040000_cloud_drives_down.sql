@@ -0,0 +1,5 @@
+DELETE FROM import_jobs WHERE kind = 'cloud_drive';
+ALTER TABLE import_jobs DROP COLUMN IF EXISTS drive_id;
+
+DROP INDEX IF EXISTS idx_cloud_drive_connections_account;
+DROP TABLE IF EXISTS cloud_drive_connections;
@@ -0,0 +1,19 @@
+-- Scoped, short-lived tokens for upload widgets embedded in other sites
+CREATE TABLE widget_tokens (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255),
+    token_hash VARCHAR(64) NOT NULL,
+    folder_id VARCHAR(255),
+    max_size BIGINT NOT NULL,
+    allowed_types JSONB,
+    allowed_origins JSONB,
+    max_uploads INTEGER NOT NULL DEFAULT 0,
+    uploads INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_widget_tokens_token_hash ON widget_tokens(token_hash);
+CREATE INDEX idx_widget_tokens_user_id ON widget_tokens(user_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_widget_tokens_user_id;
+DROP INDEX IF EXISTS idx_widget_tokens_token_hash;
+DROP TABLE IF EXISTS widget_tokens;
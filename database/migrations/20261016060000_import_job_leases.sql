@@ -0,0 +1,3 @@
+-- Batch jobs are leased by the instance running them, so only one instance resumes
+-- a job and jobs of instances that went down are taken over
+ALTER TABLE import_jobs ADD COLUMN lease_expires_at TIMESTAMP WITH TIME ZONE;
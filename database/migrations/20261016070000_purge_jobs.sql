@@ -0,0 +1,23 @@
+-- Background deletions of stored objects, kept so a restart doesn't drop them
+CREATE TABLE purge_jobs (
+    id VARCHAR(32) PRIMARY KEY,
+    owner_id INTEGER NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL,
+    total INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE purge_items (
+    id SERIAL PRIMARY KEY,
+    job_id VARCHAR(32) NOT NULL REFERENCES purge_jobs(id) ON DELETE CASCADE,
+    backend VARCHAR(255) NOT NULL DEFAULT '',
+    path TEXT NOT NULL,
+    ref VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL,
+    error TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX idx_purge_jobs_owner_id ON purge_jobs(owner_id);
+CREATE INDEX idx_purge_jobs_status ON purge_jobs(status);
+CREATE INDEX idx_purge_items_job_id_status ON purge_items(job_id, status);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_purge_items_job_id_status;
+DROP INDEX IF EXISTS idx_purge_jobs_status;
+DROP INDEX IF EXISTS idx_purge_jobs_owner_id;
+DROP TABLE IF EXISTS purge_items;
+DROP TABLE IF EXISTS purge_jobs;
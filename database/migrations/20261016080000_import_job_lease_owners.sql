@@ -0,0 +1,3 @@
+-- Leases of batch jobs name their holder, so an instance whose lease ran out and was
+-- taken over can't renew it again
+ALTER TABLE import_jobs ADD COLUMN lease_owner VARCHAR(255) NOT NULL DEFAULT '';
@@ -1,18 +1,223 @@
+// Package migrations applies the versioned SQL migrations kept in this directory. Every
+// <version>_<name>.sql is undone by its <version>_<name>_down.sql, and the versions
+// applied to a database are recorded in the schema_migrations table.
 package migrations
 
 import (
+	"embed"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
 	"go-media-center-example/internal/database"
-	"go-media-center-example/internal/models"
 )
 
+// TableName is the table recording applied migrations
+const TableName = "schema_migrations"
+
+// ErrNothingToRollback is returned when rolling back a database without applied migrations
+var ErrNothingToRollback = errors.New("no migration to roll back")
+
+//go:embed *.sql
+var files embed.FS
+
+// MigrationStatus reports whether a migration was applied
+type MigrationStatus struct {
+	ID      string
+	Applied bool
+}
+
+// load reads the embedded SQL files into migrations ordered by version. A migration's ID
+// is its up file name without the extension.
+func load() ([]*gormigrate.Migration, error) {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []*gormigrate.Migration
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, "_down.sql") {
+			continue
+		}
+		id := strings.TrimSuffix(name, ".sql")
+		up, err := files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		down, err := files.ReadFile(id + "_down.sql")
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no down file: %v", id, err)
+		}
+		migrations = append(migrations, &gormigrate.Migration{
+			ID:       id,
+			Migrate:  execSQL(string(up)),
+			Rollback: execSQL(string(down)),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].ID < migrations[j].ID
+	})
+	return migrations, nil
+}
+
+// execSQL returns a step running the statements of a migration file
+func execSQL(sql string) func(*gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		if strings.TrimSpace(sql) == "" {
+			return nil
+		}
+		return tx.Exec(sql).Error
+	}
+}
+
+// newMigrator prepares the migrations for the connected database. Each run is applied
+// in a single transaction, so a failing migration leaves the schema untouched.
+func newMigrator() (*gormigrate.Gormigrate, error) {
+	migrations, err := load()
+	if err != nil {
+		return nil, err
+	}
+	return gormigrate.New(database.GetDB(), &gormigrate.Options{
+		TableName:      TableName,
+		IDColumnName:   "id",
+		IDColumnSize:   255,
+		UseTransaction: true,
+	}, migrations), nil
+}
+
+// Migrate applies every pending migration
 func Migrate() error {
+	m, err := newMigrator()
+	if err != nil {
+		return err
+	}
+	return m.Migrate()
+}
+
+// MigrateTo applies pending migrations up to and including id
+func MigrateTo(id string) error {
+	m, err := newMigrator()
+	if err != nil {
+		return err
+	}
+	return m.MigrateTo(id)
+}
+
+// Rollback undoes the last applied migration
+func Rollback() error {
+	if !database.GetDB().Migrator().HasTable(TableName) {
+		return ErrNothingToRollback
+	}
+	m, err := newMigrator()
+	if err != nil {
+		return err
+	}
+	if err := m.RollbackLast(); errors.Is(err, gormigrate.ErrNoRunMigration) {
+		return ErrNothingToRollback
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// RollbackTo undoes the migrations applied after id, leaving id itself applied
+func RollbackTo(id string) error {
+	m, err := newMigrator()
+	if err != nil {
+		return err
+	}
+	return m.RollbackTo(id)
+}
+
+// Reset undoes every applied migration and applies them all again
+func Reset() error {
+	for {
+		err := Rollback()
+		if errors.Is(err, ErrNothingToRollback) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return Migrate()
+}
+
+// Status lists every migration in version order with whether it was applied
+func Status() ([]MigrationStatus, error) {
+	migrations, err := load()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		statuses = append(statuses, MigrationStatus{ID: migration.ID, Applied: applied[migration.ID]})
+	}
+	return statuses, nil
+}
+
+// Baseline records the migrations up to and including id as applied without running
+// them, for databases whose schema was created before migrations were tracked
+func Baseline(id string) error {
+	migrations, err := load()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, migration := range migrations {
+		if migration.ID == id {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return gormigrate.ErrMigrationIDDoesNotExist
+	}
+
+	return database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (id VARCHAR(255) PRIMARY KEY)", TableName)).Error; err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if migration.ID > id {
+				break
+			}
+			if err := tx.Table(TableName).Clauses(clause.OnConflict{DoNothing: true}).
+				Create(map[string]interface{}{"id": migration.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// appliedIDs returns the IDs recorded in the migrations table
+func appliedIDs() (map[string]bool, error) {
 	db := database.GetDB()
-	
-	// Auto migrate tables
-	return db.AutoMigrate(
-		&models.User{},
-		&models.Folder{},
-		&models.Media{},
-		&models.Tag{},
-	)
-}
\ No newline at end of file
+	applied := map[string]bool{}
+	if !db.Migrator().HasTable(TableName) {
+		return applied, nil
+	}
+
+	var ids []string
+	if err := db.Table(TableName).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		applied[id] = true
+	}
+	return applied, nil
+}
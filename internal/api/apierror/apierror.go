@@ -0,0 +1,138 @@
+// Package apierror is the error type handlers report failures with. Each error carries a
+// status, a machine-readable code and a message that is safe to show clients; the
+// internal cause is only logged, with the request's correlation ID.
+package apierror
+
+import "net/http"
+
+// Error codes, stable for clients to match on
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeUnsupportedType      = "unsupported_media_type"
+	CodeFileTypeNotAllowed   = "file_type_not_allowed"
+	CodeUnsupportedVersion   = "unsupported_version"
+	CodeRateLimited          = "rate_limited"
+	CodeUpstreamFailed       = "upstream_failed"
+	CodeInternal             = "internal_error"
+	CodeServiceUnavailable   = "service_unavailable"
+	CodeNotImplemented       = "not_implemented"
+	CodeRangeNotSatisfiable  = "range_not_satisfiable"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+)
+
+// statusCodes is the default code of each status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:                   CodeInvalidRequest,
+	http.StatusUnauthorized:                 CodeUnauthorized,
+	http.StatusForbidden:                    CodeForbidden,
+	http.StatusNotFound:                     CodeNotFound,
+	http.StatusConflict:                     CodeConflict,
+	http.StatusRequestEntityTooLarge:        CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:         CodeUnsupportedType,
+	http.StatusRequestedRangeNotSatisfiable: CodeRangeNotSatisfiable,
+	http.StatusTooManyRequests:              CodeRateLimited,
+	http.StatusNotImplemented:               CodeNotImplemented,
+	http.StatusBadGateway:                   CodeUpstreamFailed,
+	http.StatusServiceUnavailable:           CodeServiceUnavailable,
+}
+
+// Error is a failure to answer a request
+type Error struct {
+	Status  int
+	Code    string
+	Message string       // Shown to the client
+	Details string       // Optional explanation shown to the client, such as which parameter is invalid
+	Fields  []FieldError // Invalid fields of a validation_failed error
+	Err     error        // Internal cause, logged but never shown
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New creates an error whose code follows from its status
+func New(status int, message string) *Error {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+		if status < http.StatusInternalServerError {
+			code = CodeInvalidRequest
+		}
+	}
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Wrap creates an error with an internal cause that is logged instead of shown
+func Wrap(status int, message string, err error) *Error {
+	e := New(status, message)
+	e.Err = err
+	return e
+}
+
+// WithCode replaces the code derived from the status
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// WithDetails adds an explanation for the client
+func (e *Error) WithDetails(details string) *Error {
+	e.Details = details
+	return e
+}
+
+// BadRequest reports a request the client has to fix
+func BadRequest(message string) *Error { return New(http.StatusBadRequest, message) }
+
+// Unauthorized reports a missing or invalid token
+func Unauthorized(message string) *Error { return New(http.StatusUnauthorized, message) }
+
+// Forbidden reports an authenticated user lacking permission
+func Forbidden(message string) *Error { return New(http.StatusForbidden, message) }
+
+// NotFound reports a missing resource, or one the user may not see
+func NotFound(message string) *Error { return New(http.StatusNotFound, message) }
+
+// Conflict reports a request clashing with the current state
+func Conflict(message string) *Error { return New(http.StatusConflict, message) }
+
+// Internal reports a server-side failure; err is logged and message shown
+func Internal(message string, err error) *Error {
+	return Wrap(http.StatusInternalServerError, message, err)
+}
+
+// Response is the body of /api/v1 error responses. Error keeps the message where clients
+// have always found it.
+type Response struct {
+	Error     string       `json:"error" example:"Media not found"`
+	Code      string       `json:"code" example:"not_found"`
+	Details   string       `json:"details,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty" example:"3f1c9a52-6a2b-4c8e-9d1e-2b7f0a4c5d6e"`
+}
+
+// EnvelopeResponse is the body of /api/v2 error responses
+type EnvelopeResponse struct {
+	Error EnvelopeError `json:"error"`
+}
+
+// EnvelopeError is the error member of an /api/v2 error response
+type EnvelopeError struct {
+	Code      string       `json:"code" example:"not_found"`
+	Message   string       `json:"message" example:"Media not found"`
+	Details   string       `json:"details,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty" example:"3f1c9a52-6a2b-4c8e-9d1e-2b7f0a4c5d6e"`
+}
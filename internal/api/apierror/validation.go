@@ -0,0 +1,174 @@
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError is one invalid field of a request. Field is its name as the client sent it,
+// with the path to it for nested bodies, such as urls[2].url.
+type FieldError struct {
+	Field   string `json:"field" example:"email"`
+	Message string `json:"message" example:"must be a valid email address"`
+}
+
+func init() {
+	// Name fields in validation errors the way clients send them rather than by Go name
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(fieldName)
+	}
+}
+
+// fieldName is the JSON name of a struct field, or its form name for multipart bodies
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		if name, _, _ := strings.Cut(field.Tag.Get(tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// Invalid reports a request failing validation, one entry per invalid field. The message
+// lists them so clients that only show the message still say what to fix.
+func Invalid(fields ...FieldError) *Error {
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field.Field + ": " + field.Message
+	}
+	e := New(http.StatusBadRequest, strings.Join(messages, "; "))
+	e.Code = CodeValidationFailed
+	e.Fields = fields
+	return e
+}
+
+// InvalidField reports a single invalid field, such as a query parameter or multipart part
+func InvalidField(field, message string) *Error {
+	return Invalid(FieldError{Field: field, Message: message})
+}
+
+// Validation turns an error from binding a request body into an error clients can act on:
+// validation rule violations and mistyped JSON values become field errors and malformed
+// bodies say so, without echoing Go type names.
+func Validation(err error) *Error {
+	var fields []FieldError
+	collectFieldErrors(err, &fields)
+	if len(fields) > 0 {
+		return Invalid(fields...)
+	}
+
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.Is(err, io.EOF):
+		return BadRequest("Request body is empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return BadRequest("Malformed JSON body").WithDetails(err.Error())
+	default:
+		return BadRequest("Invalid request").WithDetails(err.Error())
+	}
+}
+
+// collectFieldErrors appends the field errors err holds to fields
+func collectFieldErrors(err error, fields *[]FieldError) {
+	var validationErrs validator.ValidationErrors
+	var sliceErrs binding.SliceValidationError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		for _, fe := range validationErrs {
+			*fields = append(*fields, FieldError{Field: fieldPath(fe), Message: ruleMessage(fe)})
+		}
+	case errors.As(err, &sliceErrs):
+		// Each element of an array body is validated on its own
+		for _, elemErr := range sliceErrs {
+			collectFieldErrors(elemErr, fields)
+		}
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		*fields = append(*fields, FieldError{Field: field, Message: "must be " + jsonKind(typeErr.Type)})
+	}
+}
+
+// fieldPath is the path of a field below the request body, without the body's type name
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+// ruleMessage describes the validation rule a field broke
+func ruleMessage(fe validator.FieldError) string {
+	var unit string
+	switch fe.Kind() {
+	case reflect.String:
+		unit = " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = " items"
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url", "http_url":
+		return "must be a valid URL"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min", "gte":
+		if unit == " items" && fe.Param() == "1" {
+			return "must not be empty"
+		}
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), unit)
+	case "max", "lte":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), unit)
+	case "len":
+		return fmt.Sprintf("must be exactly %s%s", fe.Param(), unit)
+	case "gt":
+		return fmt.Sprintf("must be more than %s%s", fe.Param(), unit)
+	case "lt":
+		return fmt.Sprintf("must be less than %s%s", fe.Param(), unit)
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
+
+// jsonKind names the JSON type a Go type is decoded from
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "a base64 string"
+		}
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a " + t.String()
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+// maxRecentMedia bounds the recently accessed media listed at once
+const maxRecentMedia = 100
+
+// accessCounters maps each kind of access to the column counting it
+var accessCounters = map[string]string{
+	models.AccessView:     "views",
+	models.AccessServe:    "serves",
+	models.AccessDownload: "downloads",
+}
+
+// recordMediaAccess counts an access of a user to a media item, unless tracking is
+// disabled. Failures are logged, as they shouldn't fail the request.
+func recordMediaAccess(userID uint, mediaID, kind string) {
+	if !config.GetConfig().Access.Tracking {
+		return
+	}
+
+	counter := accessCounters[kind]
+	access := models.MediaAccess{
+		UserID:         userID,
+		MediaID:        mediaID,
+		LastAccess:     kind,
+		LastAccessedAt: time.Now(),
+	}
+	switch kind {
+	case models.AccessView:
+		access.Views = 1
+	case models.AccessServe:
+		access.Serves = 1
+	case models.AccessDownload:
+		access.Downloads = 1
+	}
+	if err := database.GetDB().Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "media_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			counter:            gorm.Expr("media_accesses." + counter + " + 1"),
+			"last_access":      kind,
+			"last_accessed_at": access.LastAccessedAt,
+		}),
+	}).Create(&access).Error; err != nil {
+		log.Printf("Failed to record %s of media %s: %v", kind, mediaID, err)
+	}
+}
+
+// mediaAccessOf returns how often a user accessed a media item, nil when they never did
+// or tracking is disabled
+func mediaAccessOf(userID uint, mediaID string) *models.MediaAccess {
+	if !config.GetConfig().Access.Tracking {
+		return nil
+	}
+	var access models.MediaAccess
+	if err := database.GetDB().Where("user_id = ? AND media_id = ?", userID, mediaID).
+		First(&access).Error; err != nil {
+		return nil
+	}
+	return &access
+}
+
+// ListRecentMedia godoc
+// @Summary      Recently accessed media
+// @Description  Media the current user viewed, served or downloaded, most recent first, with how often they did. Empty while ACCESS_TRACKING_ENABLED is off.
+// @Tags         media
+// @Produce      json
+// @Param        kind   query     string  false  "Only media accessed this way at least once (view, serve, download)"
+// @Param        limit  query     int     false  "Media to return (default 20, at most 100)"
+// @Success      200    {object}  handlers.RecentMediaResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /media/recent [get]
+// @Security     BearerAuth
+func ListRecentMedia(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > maxRecentMedia {
+		c.Error(apierror.InvalidField("limit", "Must be between 1 and 100"))
+		return
+	}
+	kind := c.Query("kind")
+	counter, ok := accessCounters[kind]
+	if kind != "" && !ok {
+		c.Error(apierror.InvalidField("kind", "Must be view, serve or download"))
+		return
+	}
+
+	response := RecentMediaResponse{Media: []RecentMediaItem{}}
+	if !config.GetConfig().Access.Tracking {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Media transferred to another user since, or deleted, drop out of the list
+	query := database.GetDB().Model(&models.MediaAccess{}).
+		Joins("JOIN media ON media.id = media_accesses.media_id AND media.user_id = media_accesses.user_id AND media.deleted_at IS NULL").
+		Where("media_accesses.user_id = ?", userID)
+	if kind != "" {
+		query = query.Where("media_accesses." + counter + " > 0")
+	}
+	var accesses []models.MediaAccess
+	if err := query.Order("media_accesses.last_accessed_at DESC, media_accesses.media_id DESC").Limit(limit).
+		Find(&accesses).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch recent media", err))
+		return
+	}
+	if len(accesses) == 0 {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	ids := make([]string, len(accesses))
+	for i := range accesses {
+		ids[i] = accesses[i].MediaID
+	}
+	var media []models.Media
+	if err := database.GetDB().Preload("Tags").Where("id IN ?", ids).Find(&media).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch recent media", err))
+		return
+	}
+	byID := make(map[string]*models.Media, len(media))
+	for i := range media {
+		byID[media[i].ID] = &media[i]
+	}
+
+	urls := newMediaURLBuilder()
+	for i := range accesses {
+		if m, ok := byID[accesses[i].MediaID]; ok {
+			response.Media = append(response.Media, RecentMediaItem{
+				Media:  urls.item(m),
+				Access: accesses[i],
+			})
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+)
+
+// Archive formats
+const (
+	ArchiveZip = "zip"
+	ArchiveTar = "tar"
+)
+
+// Archive job statuses
+const (
+	ArchiveRunning   = "running"
+	ArchiveCompleted = "completed"
+	ArchiveFailed    = "failed"
+)
+
+// archiveErrorsName is the entry listing the media that could not be read
+const archiveErrorsName = "export_errors.txt"
+
+// ArchiveJob is an archive built in the background, downloadable from DownloadURL once
+// completed until ExpiresAt
+type ArchiveJob struct {
+	ID          string     `json:"id"`
+	OwnerID     uint       `json:"-"`
+	Status      string     `json:"status"`
+	Format      string     `json:"format"`
+	Total       int        `json:"total"`
+	Added       int        `json:"added"`
+	Failed      int        `json:"failed"` // Media whose objects could not be read, listed in export_errors.txt
+	Size        int64      `json:"size"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+var (
+	archiveMu   sync.Mutex
+	archiveJobs = map[string]*ArchiveJob{}
+)
+
+// archiveWriter adds entries to a ZIP or tar stream
+type archiveWriter interface {
+	// create starts an entry of size bytes and returns the writer for its content
+	create(name string, size int64, modified time.Time, compress bool) (io.Writer, error)
+	Close() error
+}
+
+type zipArchive struct{ *zip.Writer }
+
+func (a zipArchive) create(name string, _ int64, modified time.Time, compress bool) (io.Writer, error) {
+	method := zip.Store
+	if compress {
+		method = zip.Deflate
+	}
+	return a.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified})
+}
+
+type tarArchive struct{ *tar.Writer }
+
+func (a tarArchive) create(name string, size int64, modified time.Time, _ bool) (io.Writer, error) {
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0644, ModTime: modified}
+	if err := a.WriteHeader(header); err != nil {
+		return nil, err
+	}
+	return a.Writer, nil
+}
+
+// newArchiveWriter starts an archive of format on w
+func newArchiveWriter(w io.Writer, format string) archiveWriter {
+	if format == ArchiveTar {
+		return tarArchive{tar.NewWriter(w)}
+	}
+	return zipArchive{zip.NewWriter(w)}
+}
+
+// archiveContentType is the Content-Type archives of format are served with
+func archiveContentType(format string) string {
+	if format == ArchiveTar {
+		return "application/x-tar"
+	}
+	return "application/zip"
+}
+
+// archiveCompressed reports whether content of mimeType is worth deflating; images,
+// video, audio and archives are stored as they are
+func archiveCompressed(mimeType string) bool {
+	for _, prefix := range []string{"image/", "video/", "audio/", "application/zip", "application/gzip", "application/x-"} {
+		if strings.HasPrefix(mimeType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// archiveName turns a filename into an entry name without directories, numbering repeats
+// the way conflicting uploads are renamed
+func archiveName(media *models.Media, used map[string]bool) string {
+	name := path.Base(strings.ReplaceAll(media.Filename, "\\", "/"))
+	if name == "." || name == "/" || name == archiveErrorsName {
+		name = media.ID
+	}
+
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// writeArchive streams the originals of items into a ZIP or tar archive on w, one object
+// at a time. Media whose objects can't be opened are left out and listed in a trailing
+// export_errors.txt; a failure while copying an object ends the archive. progress is
+// called after every item.
+func writeArchive(ctx context.Context, w io.Writer, format string, items []models.Media, progress func(added bool)) error {
+	archive := newArchiveWriter(w, format)
+	used := make(map[string]bool, len(items))
+	var failures []string
+
+	for i := range items {
+		media := &items[i]
+		name := archiveName(media, used)
+
+		reader, err := storage.GetBackend(media.StorageBackend).Download(ctx, media.Path)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s (%s): %v", name, media.ID, err))
+			progress(false)
+			continue
+		}
+		entry, err := archive.create(name, media.Size, media.UpdatedAt, archiveCompressed(media.MimeType))
+		if err == nil {
+			if format == ArchiveTar {
+				// tar headers announce the size, so the copy must match it exactly
+				_, err = io.CopyN(entry, reader, media.Size)
+			} else {
+				_, err = io.Copy(entry, reader)
+			}
+		}
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %v", media.ID, err)
+		}
+		progress(true)
+	}
+
+	if len(failures) > 0 {
+		report := strings.Join(failures, "\n") + "\n"
+		entry, err := archive.create(archiveErrorsName, int64(len(report)), time.Now(), true)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(entry, report); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// archiveItems loads the media an archive request names, owned by userID
+func archiveItems(c *gin.Context, userID uint, input *ExportArchiveRequest) ([]models.Media, bool) {
+	db := database.GetDB()
+	query := db.Select("id", "filename", "path", "storage_backend", "mime_type", "size", "updated_at").
+		Where("user_id = ?", userID)
+
+	switch {
+	case len(input.MediaIDs) > 0:
+		query = query.Where("id IN ?", input.MediaIDs)
+	case input.FolderID != "":
+		var folder models.Folder
+		if err := db.Where("id = ? AND user_id = ?", input.FolderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.NotFound("Folder not found"))
+			return nil, false
+		}
+		query = query.Where("folder_id = ?", folder.ID)
+	default:
+		c.Error(apierror.BadRequest("media_ids or folder_id is required"))
+		return nil, false
+	}
+
+	maxItems := config.GetConfig().Export.MaxItems
+	var items []models.Media
+	if err := query.Order("filename, id").Limit(maxItems + 1).Find(&items).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch media", err))
+		return nil, false
+	}
+	if len(items) == 0 {
+		c.Error(apierror.NotFound("No media found"))
+		return nil, false
+	}
+	if len(items) > maxItems {
+		c.Error(apierror.BadRequest(fmt.Sprintf("An archive holds at most %d media", maxItems)))
+		return nil, false
+	}
+	return items, true
+}
+
+// ExportArchive godoc
+// @Summary      Export original files as an archive
+// @Description  Stream a ZIP or tar of the original files of the given media or of a folder's media. Objects are read one at a time, so memory use doesn't grow with the archive. With async=true the archive is built in the background instead and 202 returns a job whose download_url works once it completed.
+// @Tags         export
+// @Accept       json
+// @Produce      application/zip,application/x-tar,json
+// @Param        input  body      handlers.ExportArchiveRequest  true  "Media to archive"
+// @Success      200    {file}    binary
+// @Success      202    {object}  handlers.ArchiveJobResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /export/zip [post]
+// @Security     BearerAuth
+func ExportArchive(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID, _ := c.Get("user_id")
+
+	var input ExportArchiveRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.Format == "" {
+		input.Format = ArchiveZip
+	}
+
+	items, ok := archiveItems(c, userID.(uint), &input)
+	if !ok {
+		return
+	}
+
+	if input.Async {
+		job, err := startArchiveJob(userID.(uint), input.Format, items)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to start archive", err))
+			return
+		}
+		c.JSON(http.StatusAccepted, ArchiveJobResponse{Job: job})
+		return
+	}
+
+	c.Header("Content-Type", archiveContentType(input.Format))
+	c.Header("Content-Disposition", "attachment;filename=media_export."+input.Format)
+	c.Status(http.StatusOK)
+	// The status is sent with the first bytes, so failures can only cut the archive short
+	if err := writeArchive(ctx, c.Writer, input.Format, items, func(bool) {}); err != nil {
+		log.Printf("Archive of %d media for user %v failed: %v", len(items), userID, err)
+	}
+}
+
+// startArchiveJob writes the archive of items to the archive directory in the background
+func startArchiveJob(ownerID uint, format string, items []models.Media) (ArchiveJob, error) {
+	dir := config.GetConfig().Export.ArchiveDir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ArchiveJob{}, err
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	job := &ArchiveJob{
+		ID:        hex.EncodeToString(id),
+		OwnerID:   ownerID,
+		Status:    ArchiveRunning,
+		Format:    format,
+		Total:     len(items),
+		StartedAt: time.Now(),
+	}
+	file, err := os.Create(archivePath(job))
+	if err != nil {
+		return ArchiveJob{}, err
+	}
+
+	archiveMu.Lock()
+	archiveJobs[job.ID] = job
+	snapshot := *job
+	archiveMu.Unlock()
+
+	go func() {
+		err := writeArchive(context.Background(), file, format, items, func(added bool) {
+			archiveMu.Lock()
+			defer archiveMu.Unlock()
+			if added {
+				job.Added++
+			} else {
+				job.Failed++
+			}
+		})
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		finishArchiveJob(job, err)
+	}()
+	return snapshot, nil
+}
+
+// finishArchiveJob records the outcome of a background archive and signs its download
+func finishArchiveJob(job *ArchiveJob, err error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+
+	now := time.Now()
+	job.CompletedAt = &now
+	if err != nil {
+		job.Status = ArchiveFailed
+		job.Error = err.Error()
+		os.Remove(archivePath(job))
+		log.Printf("Archive %s failed: %v", job.ID, err)
+		return
+	}
+
+	if info, err := os.Stat(archivePath(job)); err == nil {
+		job.Size = info.Size()
+	}
+	expiresAt := now.Add(config.GetConfig().Export.ArchiveTTL)
+	job.Status = ArchiveCompleted
+	job.ExpiresAt = &expiresAt
+	job.DownloadURL = signedArchiveURL(config.GetConfig().JWT.Secret, job.ID, expiresAt.Unix())
+	log.Printf("Archive %s finished: %d added, %d failed, %d bytes", job.ID, job.Added, job.Failed, job.Size)
+}
+
+// archivePath is where the archive of job is written
+func archivePath(job *ArchiveJob) string {
+	return filepath.Join(config.GetConfig().Export.ArchiveDir, job.ID+"."+job.Format)
+}
+
+// signedArchiveURL builds a download URL for an archive that needs no Authorization header
+func signedArchiveURL(secret, id string, expires int64) string {
+	expiresStr := strconv.FormatInt(expires, 10)
+	query := url.Values{}
+	query.Set("expires", expiresStr)
+	query.Set("token", utils.SignParams(secret, "archive", id, expiresStr))
+	return fmt.Sprintf("/api/v1/export/archives/%s/download?%s", url.PathEscape(id), query.Encode())
+}
+
+// VerifyArchiveToken checks the signature and expiry of a signed archive download
+func VerifyArchiveToken(c *gin.Context) bool {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return utils.VerifyParams(config.GetConfig().JWT.Secret, c.Query("token"), "archive", c.Param("id"), c.Query("expires"))
+}
+
+// removeExpiredArchives deletes archives past their download expiry, including those
+// left behind by a previous process
+func removeExpiredArchives() error {
+	cfg := config.GetConfig().Export
+	now := time.Now()
+
+	archiveMu.Lock()
+	for id, job := range archiveJobs {
+		if job.CompletedAt != nil && now.Sub(*job.CompletedAt) > cfg.ArchiveTTL {
+			delete(archiveJobs, id)
+		}
+	}
+	archiveMu.Unlock()
+
+	entries, err := os.ReadDir(cfg.ArchiveDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || now.Sub(info.ModTime()) <= cfg.ArchiveTTL {
+			continue
+		}
+		if err := os.Remove(filepath.Join(cfg.ArchiveDir, entry.Name())); err != nil {
+			log.Printf("Failed to remove expired archive %s: %v", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// GetArchiveJob godoc
+// @Summary      Get an archive job
+// @Description  Progress of an archive built in the background, with its download URL once completed. Jobs are kept in memory until their archives expire.
+// @Tags         export
+// @Produce      json
+// @Param        id   path      string  true  "Archive job ID"
+// @Success      200  {object}  handlers.ArchiveJobResponse
+// @Failure      404  {object}  object{error=string}
+// @Router       /export/archives/{id} [get]
+// @Security     BearerAuth
+func GetArchiveJob(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	archiveMu.Lock()
+	job, ok := archiveJobs[c.Param("id")]
+	var snapshot ArchiveJob
+	if ok {
+		snapshot = *job
+	}
+	archiveMu.Unlock()
+
+	if !ok || snapshot.OwnerID != userID.(uint) {
+		c.Error(apierror.NotFound("Archive not found"))
+		return
+	}
+	c.JSON(http.StatusOK, ArchiveJobResponse{Job: snapshot})
+}
+
+// DownloadArchive godoc
+// @Summary      Download an archive
+// @Description  Download an archive built in the background. Accepts either a Bearer token or the signed query of the job's download_url.
+// @Tags         export
+// @Produce      application/zip,application/x-tar
+// @Param        id       path      string  true   "Archive job ID"
+// @Param        expires  query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token    query     string  false  "Signed URL token"
+// @Success      200      {file}    binary
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Router       /export/archives/{id}/download [get]
+// @Security     BearerAuth
+func DownloadArchive(c *gin.Context) {
+	archiveMu.Lock()
+	job, ok := archiveJobs[c.Param("id")]
+	var snapshot ArchiveJob
+	if ok {
+		snapshot = *job
+	}
+	archiveMu.Unlock()
+
+	// Signed URLs stand in for the owner; bearer requests must come from them
+	if _, signed := c.Get("signed_access"); !signed {
+		userID, _ := c.Get("user_id")
+		ok = ok && snapshot.OwnerID == userID.(uint)
+	}
+	if !ok || snapshot.Status != ArchiveCompleted {
+		c.Error(apierror.NotFound("Archive not found"))
+		return
+	}
+
+	c.Header("Content-Type", archiveContentType(snapshot.Format))
+	c.FileAttachment(archivePath(&snapshot), "media_export."+snapshot.Format)
+}
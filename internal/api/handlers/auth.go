@@ -1,31 +1,27 @@
 package handlers
 
 import (
-	"net/http"
-	"golang.org/x/crypto/bcrypt"
 	"github.com/gin-gonic/gin"
+	"go-media-center-example/internal/api/apierror"
 	"go-media-center-example/internal/config"
 	"go-media-center-example/internal/database"
 	"go-media-center-example/internal/models"
 	"go-media-center-example/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
 )
 
 func Register(c *gin.Context) {
-	var input struct {
-		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required"`
-		Email    string `json:"email" binding:"required,email"`
-	}
+	var input RegisterRequest
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		c.Error(apierror.Internal("Failed to hash password", err))
 		return
 	}
 
@@ -37,15 +33,15 @@ func Register(c *gin.Context) {
 	}
 
 	if err := database.GetDB().Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		c.Error(apierror.Internal("Failed to create user", err))
 		return
 	}
 
 	// Generate token
-	cfg, _ := config.Load()
+	cfg := config.GetConfig()
 	token, err := utils.GenerateToken(user.ID, cfg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.Error(apierror.Internal("Failed to generate token", err))
 		return
 	}
 
@@ -61,34 +57,30 @@ func Register(c *gin.Context) {
 }
 
 func Login(c *gin.Context) {
-	var input struct {
-		Username string `json:"username" binding:"required"`
-		Password string `json:"password" binding:"required"`
-	}
+	var input LoginRequest
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	// Find user
 	var user models.User
 	if err := database.GetDB().Where("username = ?", input.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		c.Error(apierror.Unauthorized("Invalid credentials"))
 		return
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		c.Error(apierror.Unauthorized("Invalid credentials"))
 		return
 	}
 
 	// Generate token
-	cfg, _ := config.Load()
+	cfg := config.GetConfig()
 	token, err := utils.GenerateToken(user.ID, cfg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.Error(apierror.Internal("Failed to generate token", err))
 		return
 	}
 
@@ -101,4 +93,4 @@ func Login(c *gin.Context) {
 			"email":    user.Email,
 		},
 	})
-}
\ No newline at end of file
+}
@@ -1,18 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm/clause"
 
+	"go-media-center-example/internal/api/apierror"
 	"go-media-center-example/internal/config"
 	"go-media-center-example/internal/database"
 	"go-media-center-example/internal/models"
@@ -20,9 +23,12 @@ import (
 	"go-media-center-example/internal/utils"
 )
 
-// BatchOperation represents a batch operation request
+// tagLinkBatchSize is how many media-tag links a batch tag operation inserts per query
+const tagLinkBatchSize = 1000
+
+// BatchOperation is one media item of a batch transform
 type BatchOperation struct {
-	MediaID         uint                        `json:"media_id"`
+	MediaID         string                      `json:"media_id" binding:"required"`
 	Transformations utils.TransformationOptions `json:"transformations"`
 }
 
@@ -33,23 +39,15 @@ type URLUploadRequest struct {
 	Tags     []string `json:"tags"`
 }
 
-// BulkURLUpload handles uploading multiple files from URLs
+// BulkURLUpload handles uploading multiple files from URLs. The import is persisted as a
+// batch job and runs in the background, so it can resume after a restart; see ResumeImportJobs.
 func BulkURLUpload(c *gin.Context) {
-	cfg, _ := config.Load()
+	cfg := config.GetConfig()
 	userID, _ := c.Get("user_id")
 
-	var input struct {
-		URLs     []URLUploadRequest `json:"urls" binding:"required"`
-		FolderID string             `json:"folder_id"`
-	}
+	var input BulkURLUploadRequest
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
-		return
-	}
-
-	if len(input.URLs) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No URLs provided"})
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -59,62 +57,48 @@ func BulkURLUpload(c *gin.Context) {
 		fID = &input.FolderID
 		var folder models.Folder
 		if err := database.GetDB().Where("id = ? AND user_id = ?", input.FolderID, userID).First(&folder).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+			c.Error(apierror.InvalidField("folder_id", "is not one of your folders"))
 			return
 		}
 	}
 
-	// Initialize storage
-	storageProvider, err := initializeStorage()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to initialize storage: %v", err)})
-		return
+	// Persist the job before touching any URL
+	job := models.ImportJob{
+		UserID:         userID.(uint),
+		Kind:           models.BatchKindURLImport,
+		FolderID:       fID,
+		Status:         models.ImportJobRunning,
+		LeaseOwner:     newLeaseOwner(),
+		LeaseExpiresAt: importLease(),
+		Total:          len(input.URLs),
 	}
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 60 * time.Second, // Longer timeout for potentially large files
-	}
-
-	// Process URLs concurrently with a limit
-	maxConcurrent := 5
-	sem := make(chan struct{}, maxConcurrent)
-	var wg sync.WaitGroup
-
-	results := make([]gin.H, len(input.URLs))
 	for i, urlReq := range input.URLs {
-		wg.Add(1)
-		sem <- struct{}{} // Acquire semaphore
-
-		go func(i int, urlReq URLUploadRequest) {
-			defer wg.Done()
-			defer func() { <-sem }() // Release semaphore
-
-			result := processURLUpload(client, storageProvider, urlReq, fID, userID.(uint), cfg.Storage.MaxUploadSize)
-			results[i] = result
-		}(i, urlReq)
+		tags, _ := json.Marshal(urlReq.Tags)
+		job.Items = append(job.Items, models.ImportJobItem{
+			Position: i,
+			URL:      urlReq.URL,
+			Filename: urlReq.Filename,
+			Tags:     tags,
+			Status:   models.ImportItemPending,
+		})
 	}
-
-	wg.Wait()
-
-	// Count successful uploads
-	successCount := 0
-	for _, result := range results {
-		if result["success"].(bool) {
-			successCount++
-		}
+	if err := database.GetDB().Create(&job).Error; err != nil {
+		c.Error(apierror.Internal("Failed to create import job", err))
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":       "Bulk URL upload completed",
-		"total":         len(input.URLs),
-		"success_count": successCount,
-		"results":       results,
-	})
+	// The job outlives the request; ResumeImportJobs picks it up again after a restart
+	go runImportJob(&job, cfg.Storage.MaxUploadSize)
+
+	c.JSON(http.StatusAccepted, batchAccepted(&job, "Bulk URL upload started"))
 }
 
 // processURLUpload handles a single URL upload
-func processURLUpload(client *http.Client, storageProvider storage.Storage, urlReq URLUploadRequest, folderID *string, userID uint, maxUploadSize int64) gin.H {
+func processURLUpload(ctx context.Context, client *http.Client, backendName string, storageProvider storage.Storage, item *models.ImportJobItem, folderID *string, userID uint, maxUploadSize int64) gin.H {
+	urlReq := URLUploadRequest{URL: item.URL, Filename: item.Filename}
+	json.Unmarshal(item.Tags, &urlReq.Tags)
+	updateImportItem(item, map[string]interface{}{"status": models.ImportItemProcessing})
+
 	// Download file from URL
 	resp, err := client.Get(urlReq.URL)
 	if err != nil {
@@ -178,85 +162,62 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 		}
 	}
 
-	// Upload file to storage
-	fileID, err := storageProvider.Upload(resp.Body, filename)
-	if err != nil {
-		return gin.H{
-			"url":     urlReq.URL,
-			"success": false,
-			"error":   fmt.Sprintf("Failed to upload file: %v", err),
-		}
-	}
-
-	// Get file size and metadata
-	// We need to download the file again to get metadata
-	fileResp, err := client.Get(storageProvider.GetInternalURL(fileID))
+	// Sniff the start of the body without consuming it
+	body, contentType, err := checkStreamFileType(resp.Body, filename)
 	if err != nil {
-		// Clean up the uploaded file if we can't get metadata
-		storageProvider.Delete(fileID)
 		return gin.H{
 			"url":     urlReq.URL,
 			"success": false,
-			"error":   fmt.Sprintf("Failed to process file: %v", err),
+			"error":   err.Error(),
 		}
 	}
-	defer fileResp.Body.Close()
 
-	// Create a temporary file to extract metadata
-	tempFile, err := os.CreateTemp("", "url-download-*")
-	if err != nil {
-		storageProvider.Delete(fileID)
-		return gin.H{
-			"url":     urlReq.URL,
-			"success": false,
-			"error":   fmt.Sprintf("Failed to process file: %v", err),
+	// The size is only known up front when the server sends a content length
+	if resp.ContentLength > 0 {
+		if err := checkQuota(userID, resp.ContentLength); err != nil {
+			return gin.H{
+				"url":     urlReq.URL,
+				"success": false,
+				"error":   err.Error(),
+			}
 		}
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
 
-	// Copy the file content to the temp file
-	fileSize, err := io.Copy(tempFile, fileResp.Body)
+	// Upload, hash, size and sniff the body in a single pass
+	tracked := trackUpload(userID, filename, body, resp.ContentLength)
+	upload, err := streamUpload(ctx, storageProvider, tracked, filename, contentType, maxUploadSize)
 	if err != nil {
-		storageProvider.Delete(fileID)
-		return gin.H{
-			"url":     urlReq.URL,
-			"success": false,
-			"error":   fmt.Sprintf("Failed to process file: %v", err),
+		message := fmt.Sprintf("Failed to upload file: %v", err)
+		if errors.Is(err, errUploadTooLarge) {
+			message = "File too large"
 		}
-	}
-
-	// Check file size again
-	if fileSize > maxUploadSize {
-		storageProvider.Delete(fileID)
 		return gin.H{
 			"url":     urlReq.URL,
 			"success": false,
-			"error":   "File too large",
+			"error":   message,
 		}
 	}
+	defer upload.Close()
+	fileID, fileSize := upload.FileID, upload.Size
+
+	// Record the object so a restart before the media record exists can clean it up
+	updateImportItem(item, map[string]interface{}{
+		"status":          models.ImportItemStored,
+		"file_id":         fileID,
+		"storage_backend": backendName,
+	})
 
-	// Rewind the temp file
-	tempFile.Seek(0, 0)
-
-	// Read the first 512 bytes to detect content type
-	buffer := make([]byte, 512)
-	_, err = tempFile.Read(buffer)
-	if err != nil && err != io.EOF {
-		storageProvider.Delete(fileID)
-		return gin.H{
-			"url":     urlReq.URL,
-			"success": false,
-			"error":   fmt.Sprintf("Failed to process file: %v", err),
+	if resp.ContentLength < 0 {
+		if err := checkQuota(userID, fileSize); err != nil {
+			discardObject(ctx, storageProvider, fileID)
+			return gin.H{
+				"url":     urlReq.URL,
+				"success": false,
+				"error":   err.Error(),
+			}
 		}
 	}
 
-	// Reset file pointer
-	tempFile.Seek(0, 0)
-
-	// Detect content type
-	contentType := http.DetectContentType(buffer)
-
 	// Create basic metadata
 	mediaMetadata := &utils.MediaMetadata{
 		FileType:   utils.GetFileType(filename),
@@ -264,11 +225,13 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 		Size:       fileSize,
 		UploadedAt: time.Now().Format(time.RFC3339),
 		Format:     strings.TrimPrefix(filepath.Ext(filename), "."),
+		SHA256:     upload.SHA256,
+	}
+	if analysis, err := upload.Analyze(); err == nil {
+		analysis.Apply(mediaMetadata)
+	} else {
+		log.Printf("Failed to analyze %s: %v", filename, err)
 	}
-
-	// Get both internal and public URLs for the file
-	fileInternalURL := storageProvider.GetInternalURL(fileID)
-	filePublicURL := storageProvider.GetPublicURL(fileID)
 
 	// Handle tags if provided
 	var tags []models.Tag
@@ -278,7 +241,7 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 			// Find or create tag
 			result := database.GetDB().Where("name = ?", name).FirstOrCreate(&tag, models.Tag{Name: name})
 			if result.Error != nil {
-				storageProvider.Delete(fileID)
+				discardObject(ctx, storageProvider, fileID)
 				return gin.H{
 					"url":     urlReq.URL,
 					"success": false,
@@ -294,15 +257,14 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 		"original_name": filename,
 		"source_url":    urlReq.URL,
 		"file_id":       fileID,
-		"internal_url":  fileInternalURL,
-		"public_url":    filePublicURL,
 		"technical":     mediaMetadata,
 	}
+	mergeManifestMetadata(metadata, item.Metadata)
 
 	// Convert metadata to JSON
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
-		storageProvider.Delete(fileID)
+		discardObject(ctx, storageProvider, fileID)
 		return gin.H{
 			"url":     urlReq.URL,
 			"success": false,
@@ -312,14 +274,15 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 
 	// Save to database
 	media := models.Media{
-		ID:       fileID,
-		UserID:   userID,
-		FolderID: folderID,
-		Filename: filename,
-		Path:     fileID,
-		MimeType: mediaMetadata.MimeType,
-		Size:     fileSize,
-		Metadata: metadataJSON,
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		FolderID:       folderID,
+		Filename:       filename,
+		Path:           fileID,
+		MimeType:       mediaMetadata.MimeType,
+		StorageBackend: backendName,
+		Size:           fileSize,
+		Metadata:       metadataJSON,
 	}
 
 	// Create with transaction
@@ -327,7 +290,7 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 	if err := tx.Model(&models.Media{}).Create(&media).Error; err != nil {
 		tx.Rollback()
 		// Clean up uploaded file
-		storageProvider.Delete(fileID)
+		discardObject(ctx, storageProvider, fileID)
 		return gin.H{
 			"url":     urlReq.URL,
 			"success": false,
@@ -339,7 +302,7 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 	if len(tags) > 0 {
 		if err := tx.Model(&media).Association("Tags").Append(&tags); err != nil {
 			tx.Rollback()
-			storageProvider.Delete(fileID)
+			discardObject(ctx, storageProvider, fileID)
 			return gin.H{
 				"url":     urlReq.URL,
 				"success": false,
@@ -348,7 +311,23 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 		}
 	}
 
+	// Completing the item in the same transaction keeps a media record from being created twice
+	if err := tx.Model(item).Updates(map[string]interface{}{
+		"status":   models.ImportItemCompleted,
+		"media_id": media.ID,
+		"filename": filename,
+	}).Error; err != nil {
+		tx.Rollback()
+		discardObject(ctx, storageProvider, fileID)
+		return gin.H{
+			"url":     urlReq.URL,
+			"success": false,
+			"error":   "Failed to update import job",
+		}
+	}
+
 	tx.Commit()
+	notifyMediaCreated(&media)
 
 	return gin.H{
 		"url":      urlReq.URL,
@@ -358,184 +337,454 @@ func processURLUpload(client *http.Client, storageProvider storage.Storage, urlR
 	}
 }
 
-// HandleBatchOperation handles batch operations on media files
+// HandleBatchOperation godoc
+// @Summary      Delete, move, copy or tag media in bulk
+// @Description  Apply an operation to many media items. copy stores a new object for every item, in folder_id when given or next to the original, and maps source IDs to copy IDs in copies. add_tags and remove_tags change the tags of every item in one transaction. Deletes, copies and tag operations report a result per requested ID; deleted records disappear immediately while their stored objects and cached derivatives are removed by a background purge job, reported as purge_job, whose failures name the media ID they belong to.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        input  body      object{operation=string,media_ids=[]string,folder_id=string,tags=[]string}  true  "Operation (delete, move, copy, add_tags, remove_tags), media IDs, target folder for move and copy, and tags for tag operations"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      200    {object}  object{message=string,operation=string,affected_ids=[]string,results=[]object{media_id=string,success=bool,error=string},copies=object,tags=[]string,purge_job=storage.PurgeJob}
+// @Failure      400    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /media/batch/operation [post]
+// @Security     BearerAuth
 func HandleBatchOperation(c *gin.Context) {
-	var input struct {
-		Operation string   `json:"operation" binding:"required"`
-		MediaIDs  []string `json:"media_ids" binding:"required"`
-		FolderID  *string  `json:"folder_id"`
-	}
+	ctx := c.Request.Context()
+	var input BatchOperationRequest
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	userID, _ := c.Get("user_id")
+	response := gin.H{
+		"message":      "Batch operation completed",
+		"operation":    input.Operation,
+		"affected_ids": input.MediaIDs,
+	}
 
 	switch input.Operation {
 	case "delete":
-		if err := database.GetDB().Where("id IN ? AND user_id = ?", input.MediaIDs, userID).Delete(&models.Media{}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media"})
+		var found []models.Media
+		if err := database.GetDB().Select("id", "user_id", "path", "storage_backend", "legal_hold", "retain_until").
+			Where("id IN ? AND user_id = ?", input.MediaIDs, userID).
+			Find(&found).Error; err != nil {
+			c.Error(apierror.Internal("Failed to delete media", err))
 			return
 		}
+		// Media under legal hold or retention stay, and fail on their own
+		media := make([]models.Media, 0, len(found))
+		retained := make(map[string]bool)
+		for _, item := range found {
+			if mediaRetained(&item) {
+				retained[item.ID] = true
+			} else {
+				media = append(media, item)
+			}
+		}
+
+		// Only delete what was resolved, so every deleted record has its objects queued
+		mediaIDs := make([]string, len(media))
+		objects := make([]storage.PurgeObject, len(media))
+		for i, item := range media {
+			mediaIDs[i] = item.ID
+			objects[i] = storage.PurgeObject{Backend: item.StorageBackend, Path: item.Path, Ref: item.ID}
+		}
+		if len(mediaIDs) > 0 {
+			if err := database.GetDB().Where("id IN ?", mediaIDs).Delete(&models.Media{}).Error; err != nil {
+				c.Error(apierror.Internal("Failed to delete media", err))
+				return
+			}
+
+			derivatives, err := detachDerivatives(mediaIDs)
+			if err != nil {
+				log.Printf("Failed to invalidate derivatives of deleted media: %v", err)
+			}
+			objects = append(objects, derivatives...)
+			purgeFromCDN(media...)
+			notifyMediaDeleted(userID.(uint), mediaIDs...)
+		}
+
+		results := batchResults(input.MediaIDs, mediaIDs)
+		for i := range results {
+			if retained[results[i].MediaID] {
+				results[i].Error = "Media are under legal hold or retention"
+			}
+		}
+		response["affected_ids"] = mediaIDs
+		response["results"] = results
+		// Stored objects go away in the background; thousands of deletes would outlive the request
+		response["purge_job"] = storage.SubmitPurge(userID.(uint), objects)
 	case "move":
 		if input.FolderID == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Folder ID required for move operation"})
+			c.Error(apierror.InvalidField("folder_id", "is required for move"))
+			return
+		}
+		// An empty folder_id moves media out of their folders
+		var folderID *string
+		if *input.FolderID != "" {
+			if err := checkTargetFolder(databaseFolders{}, userID.(uint), *input.FolderID); err != nil {
+				c.Error(err)
+				return
+			}
+			folderID = input.FolderID
+		}
+
+		var mediaIDs []string
+		if err := database.GetDB().Model(&models.Media{}).
+			Where("id IN ? AND user_id = ?", input.MediaIDs, userID).
+			Pluck("id", &mediaIDs).Error; err != nil {
+			c.Error(apierror.Internal("Failed to move media", err))
+			return
+		}
+		if len(mediaIDs) > 0 {
+			if err := database.GetDB().Model(&models.Media{}).Where("id IN ?", mediaIDs).
+				Update("folder_id", folderID).Error; err != nil {
+				c.Error(apierror.Internal("Failed to move media", err))
+				return
+			}
+			notifyMediaUpdatedByID(userID.(uint), mediaIDs)
+		}
+
+		response["affected_ids"] = mediaIDs
+		response["results"] = batchResults(input.MediaIDs, mediaIDs)
+	case "copy":
+		if input.FolderID != nil {
+			if err := checkTargetFolder(databaseFolders{}, userID.(uint), *input.FolderID); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+
+		var sources []models.Media
+		if err := database.GetDB().Preload("Tags").
+			Where("id IN ? AND user_id = ?", input.MediaIDs, userID).
+			Find(&sources).Error; err != nil {
+			c.Error(apierror.Internal("Failed to copy media", err))
 			return
 		}
-		if err := database.GetDB().Model(&models.Media{}).Where("id IN ? AND user_id = ?", input.MediaIDs, userID).
-			Update("folder_id", input.FolderID).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move media"})
+
+		copies, failures := copyMediaItems(ctx, sources, input.FolderID)
+		copiedIDs := make([]string, 0, len(copies))
+		for _, source := range sources {
+			if _, ok := copies[source.ID]; ok {
+				copiedIDs = append(copiedIDs, source.ID)
+			}
+		}
+
+		results := batchResults(input.MediaIDs, copiedIDs)
+		for i := range results {
+			if failure, ok := failures[results[i].MediaID]; ok {
+				results[i].Error = failure
+			}
+		}
+		response["affected_ids"] = copiedIDs
+		response["results"] = results
+		response["copies"] = copies
+	case "add_tags", "remove_tags":
+		names := normalizeTagNames(input.Tags)
+		if len(names) == 0 {
+			c.Error(apierror.InvalidField("tags", "are required for tag operations"))
 			return
 		}
+
+		var mediaIDs []string
+		if err := database.GetDB().Model(&models.Media{}).
+			Where("id IN ? AND user_id = ?", input.MediaIDs, userID).
+			Pluck("id", &mediaIDs).Error; err != nil {
+			c.Error(apierror.Internal("Failed to update tags", err))
+			return
+		}
+		if len(mediaIDs) > 0 {
+			if err := applyBatchTags(input.Operation, mediaIDs, names); err != nil {
+				log.Printf("Batch %s failed: %v", input.Operation, err)
+				c.Error(apierror.Internal("Failed to update tags", nil))
+				return
+			}
+			notifyMediaUpdatedByID(userID.(uint), mediaIDs)
+		}
+
+		response["affected_ids"] = mediaIDs
+		response["results"] = batchResults(input.MediaIDs, mediaIDs)
+		response["tags"] = names
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid operation"})
+		c.Error(apierror.BadRequest("Invalid operation"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":      "Batch operation completed",
-		"operation":    input.Operation,
-		"affected_ids": input.MediaIDs,
-	})
+	c.JSON(http.StatusOK, response)
 }
 
-// BatchTransformMedia handles batch transformation of multiple media files
-func BatchTransformMedia(c *gin.Context) {
-	userID, _ := c.Get("user_id")
-
-	var operations []BatchOperation
-	if err := c.ShouldBindJSON(&operations); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
-		return
+// batchResults reports, for every requested ID, whether the operation applied to it
+func batchResults(requested, applied []string) []BatchResult {
+	found := make(map[string]bool, len(applied))
+	for _, id := range applied {
+		found[id] = true
 	}
 
-	results := make([]gin.H, 0)
-	for _, op := range operations {
-		// Find media by ID
-		var media models.Media
-		if err := database.GetDB().Where("id = ? AND user_id = ?", op.MediaID, userID).
-			First(&media).Error; err != nil {
-			results = append(results, gin.H{
-				"media_id": op.MediaID,
-				"error":    "Media not found",
-			})
+	seen := make(map[string]bool, len(requested))
+	results := make([]BatchResult, 0, len(requested))
+	for _, id := range requested {
+		if seen[id] {
 			continue
 		}
+		seen[id] = true
 
-		// Initialize storage
-		storageProvider, err := initializeStorage()
-		if err != nil {
-			results = append(results, gin.H{
-				"media_id": op.MediaID,
-				"error":    fmt.Sprintf("Failed to initialize storage: %v", err),
-			})
-			continue
+		if found[id] {
+			results = append(results, BatchResult{MediaID: id, Success: true})
+		} else {
+			results = append(results, BatchResult{MediaID: id, Success: false, Error: "Media not found"})
 		}
+	}
+	return results
+}
 
-		// Get internal URL
-		internalURL := storageProvider.GetInternalURL(media.Path)
-
-		// Fetch file
-		client := &http.Client{Timeout: 10 * time.Second}
-		resp, err := client.Get(internalURL)
-		if err != nil {
-			results = append(results, gin.H{
-				"media_id": op.MediaID,
-				"error":    fmt.Sprintf("Failed to fetch file: %v", err),
-			})
+// normalizeTagNames trims tag names and drops empty and duplicate ones
+func normalizeTagNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
 			continue
 		}
-		defer resp.Body.Close()
+		seen[name] = true
+		normalized = append(normalized, name)
+	}
+	return normalized
+}
 
-		// Check if it's an image
-		contentType := media.MimeType
-		if !strings.HasPrefix(contentType, "image/") {
-			results = append(results, gin.H{
-				"media_id": op.MediaID,
-				"error":    "Not an image file",
-			})
-			continue
-		}
+// applyBatchTags adds or removes tags on many media items in one transaction. Links are
+// written to the join table directly; loading every item's associations would take a
+// query per item.
+func applyBatchTags(operation string, mediaIDs, names []string) error {
+	db := database.GetDB()
 
-		// Apply transformations
-		transformedImage, err := utils.TransformImage(resp.Body, op.Transformations)
+	var tags []models.Tag
+	if operation == "add_tags" {
+		created, err := findOrCreateTags(names)
 		if err != nil {
-			results = append(results, gin.H{
-				"media_id": op.MediaID,
-				"error":    fmt.Sprintf("Failed to transform image: %v", err),
-			})
-			continue
+			return err
 		}
+		tags = created
+	} else if err := db.Where("name IN ?", names).Find(&tags).Error; err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
 
-		// Generate unique filename for transformed image
-		ext := ".jpg"
-		if op.Transformations.Format == "png" {
-			ext = ".png"
-		} else if op.Transformations.Format == "webp" {
-			ext = ".webp"
-		}
-		transformedFilename := fmt.Sprintf("%s_transformed_%d%s",
-			strings.TrimSuffix(strings.Split(media.Path, "/")[len(strings.Split(media.Path, "/"))-1], ext),
-			time.Now().UnixNano(),
-			ext,
-		)
+	tagIDs := make([]uint, len(tags))
+	for i, tag := range tags {
+		tagIDs[i] = tag.ID
+	}
 
-		// Upload transformed image
-		transformedURL, err := storageProvider.UploadBytes(transformedImage, transformedFilename)
-		if err != nil {
-			results = append(results, gin.H{
-				"media_id": op.MediaID,
-				"error":    fmt.Sprintf("Failed to upload transformed image: %v", err),
-			})
-			continue
+	tx := db.Begin()
+	if operation == "add_tags" {
+		links := make([]map[string]interface{}, 0, len(mediaIDs)*len(tagIDs))
+		for _, mediaID := range mediaIDs {
+			for _, tagID := range tagIDs {
+				links = append(links, map[string]interface{}{"media_id": mediaID, "tag_id": tagID})
+			}
 		}
-
-		// Create metadata for transformed image
-		metadata := map[string]interface{}{
-			"original_media_id": media.ID,
-			"transformations":   op.Transformations,
+		if err := tx.Table("media_tags").Clauses(clause.OnConflict{DoNothing: true}).
+			CreateInBatches(links, tagLinkBatchSize).Error; err != nil {
+			tx.Rollback()
+			return err
 		}
-		metadataJSON, err := json.Marshal(metadata)
-		if err != nil {
-			results = append(results, gin.H{
-				"media_id": op.MediaID,
-				"error":    fmt.Sprintf("Failed to marshal metadata: %v", err),
-			})
-			continue
+	} else {
+		if err := tx.Exec("DELETE FROM media_tags WHERE media_id IN ? AND tag_id IN ?", mediaIDs, tagIDs).Error; err != nil {
+			tx.Rollback()
+			return err
 		}
+	}
 
-		// Create new media record for transformed image
-		transformedMedia := models.Media{
-			ID:       transformedURL,
-			UserID:   userID.(uint),
-			FolderID: media.FolderID,
-			Filename: transformedFilename,
-			Path:     transformedURL,
-			MimeType: fmt.Sprintf("image/%s", strings.TrimPrefix(ext, ".")),
-			Size:     int64(len(transformedImage)),
-			Metadata: metadataJSON,
-		}
+	return tx.Commit().Error
+}
 
-		if err := database.GetDB().Create(&transformedMedia).Error; err != nil {
-			results = append(results, gin.H{
-				"media_id": op.MediaID,
-				"error":    fmt.Sprintf("Failed to save transformed media: %v", err),
-			})
-			continue
+// BatchTransformMedia godoc
+// @Summary      Transform media in bulk
+// @Description  Store a transformed copy of every listed image as a new media item. The work runs as a background batch job, returned immediately; follow it with GET /batches/{id} or the /batches/{id}/events websocket.
+// @Tags         batches
+// @Accept       json
+// @Produce      json
+// @Param        input  body      []handlers.BatchOperation  true  "Media IDs and their transformations"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      202    {object}  handlers.BatchAcceptedResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /media/batch/transform [post]
+// @Security     BearerAuth
+func BatchTransformMedia(c *gin.Context) {
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
+	userID, _ := c.Get("user_id")
+
+	var operations []BatchOperation
+	if !bindJSON(c, &operations) {
+		return
+	}
+	if len(operations) == 0 {
+		c.Error(apierror.BadRequest("No media provided"))
+		return
+	}
+
+	// Reject invalid options up front rather than failing every item in the background
+	for i, op := range operations {
+		prefix := fmt.Sprintf("[%d].transformations.", i)
+		if err := op.Transformations.Validate(); err != nil {
+			c.Error(optionsError(prefix, err))
+			return
 		}
+		operations[i].Transformations.ApplyDPR()
+		if _, err := resolveWatermark(ctx, &op.Transformations, userID); err != nil {
+			c.Error(watermarkError(prefix, err))
+			return
+		}
+	}
 
-		results = append(results, gin.H{
-			"media_id":             op.MediaID,
-			"transformed_id":       transformedMedia.ID,
-			"transformed_url":      storageProvider.GetPublicURL(transformedURL),
-			"original_filename":    media.Filename,
-			"transformed_filename": transformedMedia.Filename,
+	job := models.ImportJob{
+		UserID:         userID.(uint),
+		Kind:           models.BatchKindTransform,
+		Status:         models.ImportJobRunning,
+		LeaseOwner:     newLeaseOwner(),
+		LeaseExpiresAt: importLease(),
+		Total:          len(operations),
+	}
+	for i, op := range operations {
+		options, _ := json.Marshal(op.Transformations)
+		job.Items = append(job.Items, models.ImportJobItem{
+			Position: i,
+			SourceID: op.MediaID,
+			Options:  options,
+			Status:   models.ImportItemPending,
 		})
 	}
+	if err := database.GetDB().Create(&job).Error; err != nil {
+		c.Error(apierror.Internal("Failed to create transform job", err))
+		return
+	}
+
+	go runImportJob(&job, cfg.Storage.MaxUploadSize)
+
+	c.JSON(http.StatusAccepted, batchAccepted(&job, "Batch transform started"))
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"results": results,
+// processTransformItem stores a transformed copy of one media item as a new media record
+func processTransformItem(ctx context.Context, item *models.ImportJobItem, userID uint) gin.H {
+	failed := func(message string) gin.H {
+		return gin.H{"media_id": item.SourceID, "success": false, "error": message}
+	}
+	updateImportItem(item, map[string]interface{}{"status": models.ImportItemProcessing})
+
+	var options utils.TransformationOptions
+	if err := json.Unmarshal(item.Options, &options); err != nil {
+		return failed(fmt.Sprintf("Invalid transformations: %v", err))
+	}
+
+	var media models.Media
+	if err := database.GetDB().Where("id = ? AND user_id = ?", item.SourceID, userID).First(&media).Error; err != nil {
+		return failed("Media not found")
+	}
+	if !strings.HasPrefix(media.MimeType, "image/") {
+		return failed("Not an image file")
+	}
+	if _, err := resolveWatermark(ctx, &options, userID); err != nil {
+		return failed(err.Error())
+	}
+
+	// Transformed copies live alongside the original
+	storageProvider := storage.GetBackend(media.StorageBackend)
+	reader, err := storageProvider.Download(ctx, media.Path)
+	if err != nil {
+		return failed(fmt.Sprintf("Failed to fetch file: %v", err))
+	}
+	defer reader.Close()
+
+	transformedImage, err := utils.TransformImage(reader, options)
+	if err != nil {
+		return failed(fmt.Sprintf("Failed to transform image: %v", err))
+	}
+
+	// Generate unique filename for transformed image
+	ext := ".jpg"
+	if options.Format == "png" {
+		ext = ".png"
+	} else if options.Format == "webp" {
+		ext = ".webp"
+	}
+	transformedFilename := fmt.Sprintf("%s_transformed_%d%s",
+		strings.TrimSuffix(filepath.Base(media.Path), filepath.Ext(media.Path)),
+		time.Now().UnixNano(),
+		ext,
+	)
+
+	if err := checkQuota(userID, int64(len(transformedImage))); err != nil {
+		return failed(err.Error())
+	}
+
+	fileID, err := storageProvider.UploadBytes(ctx, transformedImage, mediaObjectName(transformedFilename))
+	if err != nil {
+		return failed(fmt.Sprintf("Failed to upload transformed image: %v", err))
+	}
+
+	// Record the object so a restart before the media record exists can clean it up
+	updateImportItem(item, map[string]interface{}{
+		"status":          models.ImportItemStored,
+		"file_id":         fileID,
+		"storage_backend": media.StorageBackend,
+	})
+
+	metadataJSON, err := json.Marshal(map[string]interface{}{
+		"original_media_id": media.ID,
+		"transformations":   options,
 	})
+	if err != nil {
+		discardObject(ctx, storageProvider, fileID)
+		return failed(fmt.Sprintf("Failed to marshal metadata: %v", err))
+	}
+
+	transformedMedia := models.Media{
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		FolderID:       media.FolderID,
+		Filename:       transformedFilename,
+		Path:           fileID,
+		StorageBackend: media.StorageBackend,
+		MimeType:       fmt.Sprintf("image/%s", strings.TrimPrefix(ext, ".")),
+		Size:           int64(len(transformedImage)),
+		Metadata:       metadataJSON,
+		// The rights to the content go with it
+		LicenseType:      media.LicenseType,
+		RightsHolder:     media.RightsHolder,
+		LicenseExpiresAt: media.LicenseExpiresAt,
+	}
+
+	// Completing the item in the same transaction keeps a media record from being created twice
+	tx := database.GetDB().Begin()
+	if err := tx.Create(&transformedMedia).Error; err != nil {
+		tx.Rollback()
+		discardObject(ctx, storageProvider, fileID)
+		return failed(fmt.Sprintf("Failed to save transformed media: %v", err))
+	}
+	if err := tx.Model(item).Updates(map[string]interface{}{
+		"status":   models.ImportItemCompleted,
+		"media_id": transformedMedia.ID,
+		"filename": transformedMedia.Filename,
+	}).Error; err != nil {
+		tx.Rollback()
+		discardObject(ctx, storageProvider, fileID)
+		return failed("Failed to update transform job")
+	}
+	tx.Commit()
+	notifyMediaCreated(&transformedMedia)
+
+	return gin.H{
+		"media_id":             item.SourceID,
+		"success":              true,
+		"transformed_id":       transformedMedia.ID,
+		"transformed_filename": transformedMedia.Filename,
+	}
 }
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+const (
+	// batchEventBuffer is how many events a slow websocket subscriber may lag behind
+	// before further events are dropped for it
+	batchEventBuffer = 256
+	// batchPingInterval keeps idle websocket connections alive through proxies
+	batchPingInterval = 30 * time.Second
+	// batchWriteTimeout bounds a single websocket write
+	batchWriteTimeout = 10 * time.Second
+)
+
+// Batch event types sent over the websocket
+const (
+	BatchEventSnapshot  = "snapshot"
+	BatchEventProgress  = "progress"
+	BatchEventCompleted = "completed"
+)
+
+// batchSubscribers holds the event channels of websocket clients by job ID
+var batchSubscribers = struct {
+	sync.Mutex
+	channels map[uint]map[chan BatchEvent]struct{}
+}{channels: make(map[uint]map[chan BatchEvent]struct{})}
+
+// batchUpgrader accepts cross-origin connections: they are authenticated by bearer token,
+// not cookies, so another site can't ride on a user's session
+var batchUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// subscribeBatch registers for the events of a job until unsubscribe is called
+func subscribeBatch(jobID uint) (<-chan BatchEvent, func()) {
+	ch := make(chan BatchEvent, batchEventBuffer)
+
+	batchSubscribers.Lock()
+	if batchSubscribers.channels[jobID] == nil {
+		batchSubscribers.channels[jobID] = make(map[chan BatchEvent]struct{})
+	}
+	batchSubscribers.channels[jobID][ch] = struct{}{}
+	batchSubscribers.Unlock()
+
+	return ch, func() {
+		batchSubscribers.Lock()
+		delete(batchSubscribers.channels[jobID], ch)
+		if len(batchSubscribers.channels[jobID]) == 0 {
+			delete(batchSubscribers.channels, jobID)
+		}
+		batchSubscribers.Unlock()
+	}
+}
+
+// publishBatchEvent notifies subscribers of a job's progress. item is the item that just
+// finished, or nil once the whole job completed.
+func publishBatchEvent(job *models.ImportJob, item *models.ImportJobItem) {
+	event := BatchEvent{Type: BatchEventProgress, Batch: progressOf(job)}
+	if item != nil {
+		copied := *item
+		event.Item = &copied
+	} else {
+		event.Type = BatchEventCompleted
+	}
+
+	batchSubscribers.Lock()
+	defer batchSubscribers.Unlock()
+	for ch := range batchSubscribers.channels[job.ID] {
+		select {
+		case ch <- event:
+		default: // Never let a slow client hold up the job
+		}
+	}
+}
+
+// progressOf summarizes a job for events and acknowledgements
+func progressOf(job *models.ImportJob) BatchProgress {
+	return BatchProgress{
+		ID:        job.ID,
+		Kind:      job.Kind,
+		Status:    job.Status,
+		Total:     job.Total,
+		Succeeded: job.Succeeded,
+		Failed:    job.Failed,
+	}
+}
+
+// batchAccepted is the response of a request that started a batch job
+func batchAccepted(job *models.ImportJob, message string) BatchAcceptedResponse {
+	id := strconv.FormatUint(uint64(job.ID), 10)
+	return BatchAcceptedResponse{
+		Message:   message,
+		BatchID:   job.ID,
+		Kind:      job.Kind,
+		Status:    job.Status,
+		Total:     job.Total,
+		StatusURL: "/api/v1/batches/" + id,
+		EventsURL: "/api/v1/batches/" + id + "/events",
+	}
+}
+
+// ListBatches godoc
+// @Summary      List batch jobs
+// @Description  Get the current user's background batch jobs (URL imports, transforms, manifest imports and cloud drive imports), newest first
+// @Tags         batches
+// @Produce      json
+// @Param        kind   query     string  false  "Job kind (url_import, transform, manifest, cloud_drive)"
+// @Param        page   query     int     false  "Page number (default 1)"
+// @Param        limit  query     int     false  "Items per page (default 10)"
+// @Success      200    {object}  handlers.BatchListResponse
+// @Failure      500    {object}  object{error=string}
+// @Router       /batches [get]
+// @Security     BearerAuth
+func ListBatches(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	query := database.GetDB().Where("user_id = ?", userID)
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var jobs []models.ImportJob
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&jobs).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch batch jobs", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"batches": jobs})
+}
+
+// GetBatch godoc
+// @Summary      Get a batch job
+// @Description  Get a batch job with the state of each item
+// @Tags         batches
+// @Produce      json
+// @Param        id   path      int  true  "Batch ID"
+// @Success      200  {object}  handlers.BatchResponse
+// @Failure      404  {object}  object{error=string}
+// @Router       /batches/{id} [get]
+// @Security     BearerAuth
+func GetBatch(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var job models.ImportJob
+	if err := database.GetDB().
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&job).Error; err != nil {
+		c.Error(apierror.NotFound("Batch job not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"batch": job})
+}
+
+// BatchEvents godoc
+// @Summary      Follow a batch job over a websocket
+// @Description  Upgrade to a websocket that sends a snapshot of the job, a progress event per finished item and a final completed event, then closes. Browsers that can't set headers may pass the token as access_token.
+// @Tags         batches
+// @Param        id            path   int     true   "Batch ID"
+// @Param        access_token  query  string  false  "JWT, when an Authorization header can't be sent"
+// @Success      101  {object}  handlers.BatchEvent
+// @Failure      404  {object}  object{error=string}
+// @Router       /batches/{id}/events [get]
+// @Security     BearerAuth
+func BatchEvents(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	db := database.GetDB()
+
+	var job models.ImportJob
+	if err := db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&job).Error; err != nil {
+		c.Error(apierror.NotFound("Batch job not found"))
+		return
+	}
+
+	conn, err := batchUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // The upgrader already answered with an error status
+	}
+	defer conn.Close()
+
+	events, unsubscribe := subscribeBatch(job.ID)
+	defer unsubscribe()
+
+	// Reload after subscribing so progress made in between is not missed
+	if err := db.First(&job, job.ID).Error; err != nil {
+		return
+	}
+	snapshot := BatchEvent{Type: BatchEventSnapshot, Batch: progressOf(&job)}
+	if job.Status == models.ImportJobCompleted {
+		snapshot.Type = BatchEventCompleted
+	}
+	if writeBatchEvent(conn, snapshot) != nil || snapshot.Type == BatchEventCompleted {
+		return
+	}
+
+	// Reading is only needed to notice the client going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(batchPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event := <-events:
+			if writeBatchEvent(conn, event) != nil || event.Type == BatchEventCompleted {
+				return
+			}
+		case <-ticker.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(batchWriteTimeout)) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// writeBatchEvent sends one event as a JSON text message
+func writeBatchEvent(conn *websocket.Conn, event BatchEvent) error {
+	conn.SetWriteDeadline(time.Now().Add(batchWriteTimeout))
+	return conn.WriteJSON(event)
+}
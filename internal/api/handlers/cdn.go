@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/cdn"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/models"
+)
+
+// setCacheControl sets the Cache-Control policy of mimeType on a response, if one matches
+func setCacheControl(c *gin.Context, mimeType string) {
+	if cacheControl := config.GetConfig().CDN.CacheControl.For(mimeType); cacheControl != "" {
+		c.Header("Cache-Control", cacheControl)
+	}
+}
+
+// purgeFromCDN drops the CDN's copies of media that changed or were deleted: the stored
+// object on the media domain and, with EMBED_BASE_URL set, its file URLs on the API, which
+// transforms are served from. The records need their ID, user, path and storage backend.
+func purgeFromCDN(media ...models.Media) {
+	if !cdn.Enabled() || len(media) == 0 {
+		return
+	}
+
+	builder := newMediaURLBuilder()
+	apiBase := strings.TrimRight(config.GetConfig().Embed.BaseURL, "/")
+	var urls []string
+	for i := range media {
+		// Without a domain the URL points straight at the backend, which no CDN caches
+		if builder.domain(media[i].UserID) != "" {
+			urls = append(urls, builder.url(&media[i]))
+		}
+		if apiBase != "" {
+			// Files are served by media ID and by storage keys that fit in a path segment
+			urls = append(urls, apiBase+"/api/v1/media/files/"+url.PathEscape(media[i].ID))
+			if key := media[i].Path; key != media[i].ID && !strings.Contains(key, "/") {
+				urls = append(urls, apiBase+"/api/v1/media/files/"+url.PathEscape(key))
+			}
+		}
+	}
+	cdn.Purge(urls...)
+}
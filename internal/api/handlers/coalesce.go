@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/utils"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// transformFlights coalesces identical concurrent renders. When a new image goes live,
+// requests for the same derivative arrive before the cache is warm; only the first one
+// computes it and the rest wait for its result.
+var transformFlights singleflight.Group
+
+// transformFailure is an error from a coalesced render, carrying the message for the client
+type transformFailure struct {
+	message string
+	err     error
+}
+
+func (f *transformFailure) Error() string {
+	return f.message + ": " + f.err.Error()
+}
+
+func (f *transformFailure) Unwrap() error {
+	return f.err
+}
+
+// transformError reports a failed transform with the message of its failing step
+func transformError(err error) *apierror.Error {
+	switch {
+	case errors.Is(err, errTransformsBusy):
+		return apierror.New(http.StatusServiceUnavailable, "Too many transforms in progress, retry shortly")
+	case errors.Is(err, errTransformTimeout):
+		return apierror.New(http.StatusServiceUnavailable, "Transform is taking too long, retry shortly")
+	case errors.Is(err, utils.ErrImageTooLarge):
+		return apierror.New(http.StatusRequestEntityTooLarge, "Image is too large to transform").WithDetails(err.Error())
+	}
+
+	var failure *transformFailure
+	if errors.As(err, &failure) {
+		return apierror.Internal(failure.message, failure.err)
+	}
+	return apierror.Internal("Failed to transform image", err)
+}
+
+// coalesceTransform runs render once for all concurrent callers with the same key, which
+// must identify the media and every option affecting the output. shared reports whether
+// the result was computed for another request. The render isn't cancelled with the
+// request that started it, as other requests wait for it too and its result is usually
+// cached, but a caller whose ctx is done stops waiting.
+func coalesceTransform(ctx context.Context, key string, render func(ctx context.Context) ([]byte, error)) (data []byte, shared bool, err error) {
+	detached := context.WithoutCancel(ctx)
+	flight := transformFlights.DoChan(key, func() (interface{}, error) {
+		return render(detached)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case result := <-flight:
+		if result.Err != nil {
+			return nil, result.Shared, result.Err
+		}
+		return result.Val.([]byte), result.Shared, nil
+	}
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Duplicate filename policies accepted by the conflict parameter
+const (
+	ConflictRename  = "rename"
+	ConflictReplace = "replace"
+	ConflictSkip    = "skip"
+	ConflictFail    = "fail"
+)
+
+var errFilenameConflict = errors.New("a file with this name already exists in the destination folder")
+
+// conflictResolution describes how an upload should proceed after checking for duplicates
+type conflictResolution struct {
+	Filename string        // Filename to store the upload under
+	Existing *models.Media // Media with the same name, set for replace and skip
+	Skip     bool          // Upload should not be stored at all
+}
+
+// conflictPolicy reads the conflict policy from the query string or multipart form
+func conflictPolicy(c *gin.Context) (string, error) {
+	policy := c.Query("conflict")
+	if policy == "" {
+		policy = c.PostForm("conflict")
+	}
+	return parseConflictPolicy(policy)
+}
+
+// parseConflictPolicy validates a conflict policy, defaulting to rename
+func parseConflictPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return ConflictRename, nil
+	case ConflictRename, ConflictReplace, ConflictSkip, ConflictFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid conflict policy: %s (expected rename, replace, skip or fail)", policy)
+	}
+}
+
+// resolveFilenameConflict applies policy when filename already exists in the user's destination folder
+func resolveFilenameConflict(userID uint, folderID *string, filename, policy string) (*conflictResolution, error) {
+	existing, err := findMediaByFilename(userID, folderID, filename)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return &conflictResolution{Filename: filename}, nil
+	}
+
+	switch policy {
+	case ConflictFail:
+		return nil, errFilenameConflict
+	case ConflictSkip:
+		return &conflictResolution{Filename: filename, Existing: existing, Skip: true}, nil
+	case ConflictReplace:
+		if mediaRetained(existing) {
+			return nil, errMediaRetained
+		}
+		return &conflictResolution{Filename: filename, Existing: existing}, nil
+	}
+
+	// Rename: append a counter until the name is free, e.g. "photo (2).jpg"
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		taken, err := findMediaByFilename(userID, folderID, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if taken == nil {
+			return &conflictResolution{Filename: candidate}, nil
+		}
+	}
+}
+
+// findMediaByFilename looks up a user's media by exact filename within a folder (or the root)
+func findMediaByFilename(userID uint, folderID *string, filename string) (*models.Media, error) {
+	query := database.GetDB().Where("user_id = ? AND filename = ?", userID, filename)
+	if folderID != nil {
+		query = query.Where("folder_id = ?", *folderID)
+	} else {
+		query = query.Where("folder_id IS NULL")
+	}
+
+	var media models.Media
+	if err := query.First(&media).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &media, nil
+}
+
+// replaceMediaContent points an existing media record at a newly uploaded object,
+// removing the previous object when it was stored under a different key or backend. New
+// content goes back to draft, as what was reviewed is gone.
+func replaceMediaContent(ctx context.Context, backendName string, storageProvider storage.Storage, existing *models.Media, fileID, mimeType string, size int64, metadata []byte) error {
+	previous := *existing
+	oldPath, oldBackend := existing.Path, existing.StorageBackend
+	updates := map[string]interface{}{
+		"path":            fileID,
+		"storage_backend": backendName,
+		"mime_type":       mimeType,
+		"size":            size,
+		"metadata":        metadata,
+		"workflow_status": models.WorkflowDraft,
+	}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(existing).Updates(updates).Error; err != nil {
+			return err
+		}
+		if previous.WorkflowStatus == models.WorkflowDraft {
+			return nil
+		}
+		return tx.Create(&models.WorkflowTransition{
+			MediaID:    existing.ID,
+			UserID:     existing.UserID,
+			FromStatus: previous.WorkflowStatus,
+			ToStatus:   models.WorkflowDraft,
+			Note:       "Content replaced",
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if oldPath != fileID || oldBackend != backendName {
+		discardObject(ctx, storage.GetBackend(oldBackend), oldPath)
+	}
+
+	// Transforms of the previous content must not be served for the new one
+	invalidateDerivatives(existing.UserID, existing.ID)
+	purgeFromCDN(previous)
+	notifyMediaUpdated(existing)
+	if err := queueAutoTagging(existing, true); err != nil {
+		log.Printf("Failed to queue media %s for tag suggestions: %v", existing.ID, err)
+	}
+	return nil
+}
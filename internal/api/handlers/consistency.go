@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+)
+
+const (
+	// consistencyBatchSize is how many records are checked against storage at a time
+	consistencyBatchSize = 500
+	// maxConsistencyFindings caps the orphans and missing objects listed in a report
+	maxConsistencyFindings = 1000
+)
+
+// Consistency check statuses
+const (
+	ConsistencyRunning   = "running"
+	ConsistencyCompleted = "completed"
+	ConsistencyFailed    = "failed"
+)
+
+// errConsistencyRunning is returned when a check is started while one is running
+var errConsistencyRunning = errors.New("consistency check already running")
+
+// OrphanObject is a stored object no database record refers to
+type OrphanObject struct {
+	Backend      string    `json:"backend"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// MissingObject is a database record whose stored object is gone
+type MissingObject struct {
+	Kind    string `json:"kind"` // media or derivative
+	ID      string `json:"id"`
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+}
+
+// ConsistencyReport is the outcome of comparing stored objects with database records
+type ConsistencyReport struct {
+	Status         string          `json:"status"`
+	Repair         bool            `json:"repair"` // Orphans are deleted and broken records marked
+	ObjectsChecked int             `json:"objects_checked"`
+	RecordsChecked int             `json:"records_checked"`
+	Orphans        int             `json:"orphans"`
+	OrphanBytes    int64           `json:"orphan_bytes"`
+	OrphanObjects  []OrphanObject  `json:"orphan_objects,omitempty"`
+	Missing        int             `json:"missing"`
+	MissingObjects []MissingObject `json:"missing_objects,omitempty"`
+	Repaired       int             `json:"repaired"`
+	Errors         int             `json:"errors"`                      // Objects storage couldn't be asked about
+	Unlisted       []string        `json:"unlisted_backends,omitempty"` // Backends that can't list objects, so their orphans go unnoticed
+	Error          string          `json:"error,omitempty"`
+	StartedAt      time.Time       `json:"started_at"`
+	CompletedAt    *time.Time      `json:"completed_at,omitempty"`
+}
+
+var (
+	consistencyMu     sync.Mutex
+	consistencyReport *ConsistencyReport
+)
+
+// runConsistencyCheck looks for stored objects without records and records without
+// objects. With repair, orphans are deleted, media without objects are marked broken
+// (and unmarked once their object is back) and derivatives without objects are dropped.
+func runConsistencyCheck(ctx context.Context, repair bool) (ConsistencyReport, error) {
+	consistencyMu.Lock()
+	if consistencyReport != nil && consistencyReport.Status == ConsistencyRunning {
+		consistencyMu.Unlock()
+		return ConsistencyReport{}, errConsistencyRunning
+	}
+	report := &ConsistencyReport{Status: ConsistencyRunning, Repair: repair, StartedAt: time.Now()}
+	consistencyReport = report
+	consistencyMu.Unlock()
+
+	err := findOrphanObjects(ctx, report)
+	if err == nil {
+		err = checkMediaObjects(ctx, report)
+	}
+	if err == nil {
+		err = checkDerivativeObjects(ctx, report)
+	}
+
+	consistencyMu.Lock()
+	defer consistencyMu.Unlock()
+	now := time.Now()
+	report.Status = ConsistencyCompleted
+	if err != nil {
+		report.Status = ConsistencyFailed
+		report.Error = err.Error()
+	}
+	report.CompletedAt = &now
+	log.Printf("Consistency check finished: %d orphans, %d missing objects, %d repaired, %d errors",
+		report.Orphans, report.Missing, report.Repaired, report.Errors)
+	return report.snapshot(), err
+}
+
+// findOrphanObjects lists every backend that can enumerate its objects and reports those
+// no record refers to. Objects younger than the grace period are left alone, as their
+// records may not exist yet.
+func findOrphanObjects(ctx context.Context, report *ConsistencyReport) error {
+	cutoff := time.Now().Add(-config.GetConfig().Storage.Consistency.GracePeriod)
+
+	for _, backend := range storage.BackendsHealth() {
+		listed, err := storage.ListBackendObjects(ctx, backend.Name, func(objects []storage.ListedObject) error {
+			keys := make([]string, 0, len(objects))
+			for _, object := range objects {
+				if object.LastModified.Before(cutoff) {
+					keys = append(keys, object.Key)
+				}
+			}
+			referenced, err := referencedKeys(backend, keys)
+			if err != nil {
+				return err
+			}
+
+			for _, object := range objects {
+				if !object.LastModified.Before(cutoff) || referenced[object.Key] {
+					consistencyMu.Lock()
+					report.ObjectsChecked++
+					consistencyMu.Unlock()
+					continue
+				}
+
+				repaired := false
+				if report.Repair {
+					if err := storage.GetBackend(backend.Name).Delete(ctx, object.Key); err != nil {
+						log.Printf("Failed to delete orphan %s from %s: %v", object.Key, backend.Name, err)
+					} else {
+						repaired = true
+					}
+				}
+
+				consistencyMu.Lock()
+				report.ObjectsChecked++
+				report.Orphans++
+				report.OrphanBytes += object.Size
+				if repaired {
+					report.Repaired++
+				}
+				if len(report.OrphanObjects) < maxConsistencyFindings {
+					report.OrphanObjects = append(report.OrphanObjects, OrphanObject{
+						Backend:      backend.Name,
+						Key:          object.Key,
+						Size:         object.Size,
+						LastModified: object.LastModified,
+					})
+				}
+				consistencyMu.Unlock()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if !listed {
+			consistencyMu.Lock()
+			report.Unlisted = append(report.Unlisted, backend.Name)
+			consistencyMu.Unlock()
+		}
+	}
+	return nil
+}
+
+// referencedKeys returns which of keys on backend a media item, derivative or unfinished
+// upload session refers to. Objects on the replica may belong to any backend.
+func referencedKeys(backend storage.BackendHealth, keys []string) (map[string]bool, error) {
+	referenced := make(map[string]bool, len(keys))
+	if len(keys) == 0 {
+		return referenced, nil
+	}
+
+	db := database.GetDB()
+	scope := func(query string, args ...interface{}) *gorm.DB {
+		q := db.Where(query, args...)
+		if backend.Replica {
+			return q
+		}
+		names := []string{backend.Name}
+		if backend.Primary {
+			names = append(names, "")
+		}
+		return q.Where("storage_backend IN ?", names)
+	}
+
+	var paths []string
+	if err := scope("path IN ?", keys).Model(&models.Media{}).Pluck("path", &paths).Error; err != nil {
+		return nil, err
+	}
+	var derivativePaths []string
+	if err := scope("path IN ?", keys).Model(&models.Derivative{}).Pluck("path", &derivativePaths).Error; err != nil {
+		return nil, err
+	}
+	var sessionKeys []string
+	if err := scope("key IN ? AND status IN ?", keys, []string{models.UploadSessionActive, models.UploadSessionAssembled}).
+		Model(&models.UploadSession{}).Pluck("key", &sessionKeys).Error; err != nil {
+		return nil, err
+	}
+
+	for _, list := range [][]string{paths, derivativePaths, sessionKeys} {
+		for _, key := range list {
+			referenced[key] = true
+		}
+	}
+	return referenced, nil
+}
+
+// checkMediaObjects checks that the object of every media item exists
+func checkMediaObjects(ctx context.Context, report *ConsistencyReport) error {
+	db := database.GetDB()
+	lastID := ""
+	for {
+		var batch []models.Media
+		if err := db.Select("id", "path", "storage_backend", "broken").
+			Where("id > ?", lastID).Order("id").Limit(consistencyBatchSize).
+			Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+
+		for _, media := range batch {
+			exists, err := storage.ObjectExists(ctx, media.StorageBackend, media.Path)
+
+			// Broken marks follow what storage says, so restored objects are unmarked
+			repaired := false
+			if err == nil && report.Repair && media.Broken == exists {
+				if db.Model(&media).UpdateColumn("broken", !exists).Error == nil {
+					repaired = true
+				}
+			}
+
+			consistencyMu.Lock()
+			report.RecordsChecked++
+			switch {
+			case err != nil:
+				report.Errors++
+			case !exists:
+				report.recordMissingLocked(MissingObject{Kind: "media", ID: media.ID, Backend: media.StorageBackend, Path: media.Path})
+			}
+			if repaired {
+				report.Repaired++
+			}
+			consistencyMu.Unlock()
+		}
+	}
+}
+
+// checkDerivativeObjects checks that the object of every cached derivative exists
+func checkDerivativeObjects(ctx context.Context, report *ConsistencyReport) error {
+	db := database.GetDB()
+	var lastID uint
+	for {
+		var batch []models.Derivative
+		if err := db.Where("id > ?", lastID).Order("id").Limit(consistencyBatchSize).
+			Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+
+		for _, derivative := range batch {
+			exists, err := storage.ObjectExists(ctx, derivative.StorageBackend, derivative.Path)
+
+			// A derivative is only a cache entry; without its object the record goes
+			repaired := false
+			if err == nil && !exists && report.Repair {
+				if db.Delete(&derivative).Error == nil {
+					repaired = true
+				}
+			}
+
+			consistencyMu.Lock()
+			report.RecordsChecked++
+			switch {
+			case err != nil:
+				report.Errors++
+			case !exists:
+				report.recordMissingLocked(MissingObject{Kind: "derivative", ID: derivative.CacheKey, Backend: derivative.StorageBackend, Path: derivative.Path})
+			}
+			if repaired {
+				report.Repaired++
+			}
+			consistencyMu.Unlock()
+		}
+	}
+}
+
+// recordMissingLocked counts a record whose object is gone. Callers hold consistencyMu.
+func (r *ConsistencyReport) recordMissingLocked(missing MissingObject) {
+	r.Missing++
+	if len(r.MissingObjects) < maxConsistencyFindings {
+		r.MissingObjects = append(r.MissingObjects, missing)
+	}
+}
+
+// snapshot copies the report so it can be read without holding the lock
+func (r *ConsistencyReport) snapshot() ConsistencyReport {
+	copied := *r
+	copied.OrphanObjects = append([]OrphanObject(nil), r.OrphanObjects...)
+	copied.MissingObjects = append([]MissingObject(nil), r.MissingObjects...)
+	copied.Unlisted = append([]string(nil), r.Unlisted...)
+	return copied
+}
+
+// GetConsistencyReport godoc
+// @Summary      Storage consistency report
+// @Description  The last check comparing stored objects with database records: orphan objects no record refers to and records whose objects are missing, up to 1000 of each
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  handlers.ConsistencyResponse
+// @Failure      403  {object}  object{error=string}
+// @Router       /admin/consistency [get]
+// @Security     BearerAuth
+func GetConsistencyReport(c *gin.Context) {
+	consistencyMu.Lock()
+	defer consistencyMu.Unlock()
+
+	if consistencyReport == nil {
+		c.JSON(http.StatusOK, ConsistencyResponse{})
+		return
+	}
+	report := consistencyReport.snapshot()
+	c.JSON(http.StatusOK, ConsistencyResponse{Report: &report})
+}
+
+// CheckConsistency godoc
+// @Summary      Check storage consistency
+// @Description  Start comparing stored objects with database records in the background. With repair=true, orphan objects are deleted, media whose objects are missing are marked broken and derivatives whose objects are missing are dropped. The report appears in GET /admin/consistency.
+// @Tags         admin
+// @Produce      json
+// @Param        repair  query     bool  false  "Delete orphans and mark broken records"
+// @Success      202     {object}  handlers.MessageResponse
+// @Failure      403     {object}  object{error=string}
+// @Failure      409     {object}  object{error=string}
+// @Router       /admin/consistency/check [post]
+// @Security     BearerAuth
+func CheckConsistency(c *gin.Context) {
+	consistencyMu.Lock()
+	running := consistencyReport != nil && consistencyReport.Status == ConsistencyRunning
+	consistencyMu.Unlock()
+	if running {
+		c.Error(apierror.Conflict("A consistency check is already running"))
+		return
+	}
+
+	repair := c.Query("repair") == "true"
+	go func() {
+		if _, err := runConsistencyCheck(context.Background(), repair); err != nil && !errors.Is(err, errConsistencyRunning) {
+			log.Printf("Consistency check failed: %v", err)
+		}
+	}()
+	c.JSON(http.StatusAccepted, MessageResponse{Message: "Consistency check started"})
+}
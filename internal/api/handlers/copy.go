@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+)
+
+// copyNameMu serializes filename resolution, quota checks and record creation of copies,
+// so copies landing in the same folder concurrently never pick the same "name (n)" filename
+var copyNameMu sync.Mutex
+
+// copyMediaItems duplicates media into folderID, or each item's own folder when nil.
+// It returns the ID of every copy keyed by source ID, and the error of every failed item.
+func copyMediaItems(ctx context.Context, sources []models.Media, folderID *string) (map[string]string, map[string]string) {
+	copies := make(map[string]string, len(sources))
+	failures := make(map[string]string)
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, 5)
+	)
+	for i := range sources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(source *models.Media) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			target := source.FolderID
+			if folderID != nil {
+				target = folderID
+			}
+			copied, err := copyMedia(ctx, source, target)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures[source.ID] = err.Error()
+				return
+			}
+			copies[source.ID] = copied.ID
+		}(&sources[i])
+	}
+	wg.Wait()
+
+	return copies, failures
+}
+
+// copyMedia stores a new object with the content of source and records it as a new
+// media item with the same metadata and tags. The copy never shares the source's object,
+// so deleting either one leaves the other intact.
+func copyMedia(ctx context.Context, source *models.Media, folderID *string) (*models.Media, error) {
+	reader, err := storage.GetBackend(source.StorageBackend).Download(ctx, source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source: %v", err)
+	}
+	defer reader.Close()
+
+	// Object keys derive from the filename on some backends, so a copy gets a unique prefix
+	backendName, storageProvider := storage.SelectUploadBackend()
+	fileID, err := storageProvider.Upload(ctx, reader, copyObjectName(source.Filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store copy: %v", err)
+	}
+
+	metadata := map[string]interface{}{}
+	if len(source.Metadata) > 0 {
+		json.Unmarshal(source.Metadata, &metadata)
+	}
+	metadata["file_id"] = fileID
+	metadata["copied_from"] = source.ID
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		discardObject(ctx, storageProvider, fileID)
+		return nil, fmt.Errorf("failed to marshal metadata: %v", err)
+	}
+
+	copyNameMu.Lock()
+	defer copyNameMu.Unlock()
+
+	// Checked under the lock so concurrent copies can't overshoot the quota together
+	if err := checkQuota(source.UserID, source.Size); err != nil {
+		discardObject(ctx, storageProvider, fileID)
+		return nil, err
+	}
+
+	resolution, err := resolveFilenameConflict(source.UserID, folderID, source.Filename, ConflictRename)
+	if err != nil {
+		discardObject(ctx, storageProvider, fileID)
+		return nil, fmt.Errorf("failed to resolve filename: %v", err)
+	}
+
+	copied := models.Media{
+		ID:             uuid.NewString(),
+		UserID:         source.UserID,
+		FolderID:       folderID,
+		Filename:       resolution.Filename,
+		Path:           fileID,
+		StorageBackend: backendName,
+		MimeType:       source.MimeType,
+		Size:           source.Size,
+		Metadata:       metadataJSON,
+		// The rights to the content go with it
+		LicenseType:      source.LicenseType,
+		RightsHolder:     source.RightsHolder,
+		LicenseExpiresAt: source.LicenseExpiresAt,
+	}
+
+	tx := database.GetDB().Begin()
+	if err := tx.Create(&copied).Error; err != nil {
+		tx.Rollback()
+		discardObject(ctx, storageProvider, fileID)
+		return nil, fmt.Errorf("failed to save copy: %v", err)
+	}
+	if tags := source.Tags; len(tags) > 0 {
+		if err := tx.Model(&copied).Association("Tags").Append(&tags); err != nil {
+			tx.Rollback()
+			discardObject(ctx, storageProvider, fileID)
+			return nil, fmt.Errorf("failed to copy tags: %v", err)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		discardObject(ctx, storageProvider, fileID)
+		return nil, fmt.Errorf("failed to save copy: %v", err)
+	}
+	notifyMediaCreated(&copied)
+
+	return &copied, nil
+}
+
+// copyObjectName returns a storage name for a copy of filename that can't collide with
+// the source object
+func copyObjectName(filename string) string {
+	return uniqueObjectName("copy", filename)
+}
@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deepZoomStoreWorkers is how many tiles of a render are stored at a time
+const deepZoomStoreWorkers = 8
+
+var (
+	errDeepZoomUnsupported = errors.New("deep zoom is only available for JPEG, PNG and GIF images")
+	errDeepZoomTooLarge    = errors.New("image is too large to tile")
+	errTileNotCached       = errors.New("tile was rendered but could not be cached")
+)
+
+// deepZoomRenders limits how many images are decoded for tiling at once; a 200MP
+// original takes close to a gigabyte of memory
+var (
+	deepZoomRenders     chan struct{}
+	deepZoomRendersOnce sync.Once
+)
+
+func acquireDeepZoomRender() func() {
+	deepZoomRendersOnce.Do(func() {
+		deepZoomRenders = make(chan struct{}, max(config.GetConfig().DeepZoom.MaxRenders, 1))
+	})
+	deepZoomRenders <- struct{}{}
+	return func() { <-deepZoomRenders }
+}
+
+// deepZoomSupported reports whether tiles can be rendered for media
+func deepZoomSupported(media *models.Media) bool {
+	switch media.MimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// deepZoomFormat is the tile format: PNG keeps transparency, JPEG for everything else
+func deepZoomFormat(media *models.Media) string {
+	if thumbnailFormat(media) == "png" {
+		return "png"
+	}
+	return "jpg"
+}
+
+// tileCacheKey identifies a cached tile of the current version of media
+func tileCacheKey(media *models.Media, level, col, row int) string {
+	return fmt.Sprintf("tile_%s_%s_%d_%d_%d", media.ID, thumbnailVersion(media), level, col, row)
+}
+
+// signDeepZoom signs the query values of a deep zoom URL, shared by the descriptor and
+// its tiles
+func signDeepZoom(secret, mediaID, version, expires string) string {
+	return utils.SignParams(secret, "tiles", mediaID, version, expires)
+}
+
+// VerifyDeepZoomToken checks the signature and expiry of a signed descriptor or tile request
+func VerifyDeepZoomToken(c *gin.Context) bool {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	cfg := config.GetConfig()
+	return utils.VerifyParams(cfg.JWT.Secret, c.Query("token"), "tiles", c.Param("id"), c.Query("v"), c.Query("expires"))
+}
+
+// signedDeepZoomURL builds a descriptor URL that can be fetched without an Authorization
+// header. Viewers repeat its query on every tile URL, which signs the tiles too.
+func signedDeepZoomURL(secret string, media *models.Media, expires int64) string {
+	version := thumbnailVersion(media)
+	expiresStr := strconv.FormatInt(expires, 10)
+
+	query := url.Values{}
+	query.Set("v", version)
+	query.Set("expires", expiresStr)
+	query.Set("token", signDeepZoom(secret, media.ID, version, expiresStr))
+	return fmt.Sprintf("/api/v1/media/%s/tiles.dzi?%s", url.PathEscape(media.ID), query.Encode())
+}
+
+// loadDeepZoomImage returns the descriptor of media, reading the image size from the
+// header of the original the first time
+func loadDeepZoomImage(ctx context.Context, media *models.Media) (utils.DeepZoomImage, error) {
+	if !deepZoomSupported(media) {
+		return utils.DeepZoomImage{}, errDeepZoomUnsupported
+	}
+
+	cacheKey := fmt.Sprintf("dzi_%s_%s", media.ID, thumbnailVersion(media))
+	data, ok := loadDerivative(ctx, cacheKey)
+	if !ok {
+		var err error
+		data, _, err = coalesceTransform(ctx, cacheKey, func(ctx context.Context) ([]byte, error) {
+			started := time.Now()
+			reader, err := storage.GetBackend(media.StorageBackend).Download(ctx, media.Path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read original file: %v", err)
+			}
+			defer reader.Close()
+
+			imageConfig, _, err := image.DecodeConfig(reader)
+			if err != nil {
+				return nil, errDeepZoomUnsupported
+			}
+			data, err := utils.NewDeepZoomImage(imageConfig.Width, imageConfig.Height, deepZoomFormat(media)).Marshal()
+			if err != nil {
+				return nil, err
+			}
+			if err := storeDerivative(ctx, media, cacheKey, data, time.Since(started)); err != nil {
+				log.Printf("Failed to cache deep zoom descriptor %s: %v", cacheKey, err)
+			}
+			return data, nil
+		})
+		if err != nil {
+			return utils.DeepZoomImage{}, err
+		}
+	}
+
+	dz, err := utils.ParseDeepZoomImage(data)
+	if err != nil {
+		return dz, err
+	}
+	if int64(dz.Size.Width)*int64(dz.Size.Height) > config.GetConfig().DeepZoom.MaxPixels {
+		return dz, errDeepZoomTooLarge
+	}
+	return dz, nil
+}
+
+// loadTile returns a cached tile, rendering its level on a miss
+func loadTile(ctx context.Context, media *models.Media, dz utils.DeepZoomImage, level, col, row int) (data []byte, hit bool, err error) {
+	cacheKey := tileCacheKey(media, level, col, row)
+	if data, ok := loadDerivative(ctx, cacheKey); ok {
+		return data, true, nil
+	}
+
+	// Renders of one image are coalesced whatever their level, so a 200MP original is
+	// never decoded twice at once. A request that joined the render of a level above its
+	// own finds its tile cached; one that joined a lower level renders again.
+	for attempt := 0; attempt < 2; attempt++ {
+		_, _, err := coalesceTransform(ctx, "tiles_"+media.ID+"_"+thumbnailVersion(media), func(ctx context.Context) ([]byte, error) {
+			return nil, renderDeepZoomLevels(ctx, media, dz, level)
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		if data, ok := loadDerivative(ctx, cacheKey); ok {
+			return data, false, nil
+		}
+	}
+	return nil, false, errTileNotCached
+}
+
+// renderDeepZoomLevels decodes the original and caches every tile of a level, along
+// with the levels below it that are not cached yet, which a viewer will request next
+// when zooming out and which cost a third of the level at most
+func renderDeepZoomLevels(ctx context.Context, media *models.Media, dz utils.DeepZoomImage, level int) error {
+	// The last tile of a level is stored last, so its presence marks a complete level
+	bottom := level
+	for bottom > 0 {
+		cols, rows := dz.LevelTiles(bottom - 1)
+		if derivativeCached(tileCacheKey(media, bottom-1, cols-1, rows-1)) {
+			break
+		}
+		bottom--
+	}
+
+	release := acquireDeepZoomRender()
+	defer release()
+
+	reader, err := storage.GetBackend(media.StorageBackend).Download(ctx, media.Path)
+	if err != nil {
+		return &transformFailure{message: "Failed to read original file", err: err}
+	}
+	defer reader.Close()
+
+	last := time.Now()
+	src, _, err := image.Decode(reader)
+	if err != nil {
+		return &transformFailure{message: "Failed to decode image", err: err}
+	}
+
+	type tile struct {
+		cacheKey   string
+		data       []byte
+		renderTime time.Duration
+	}
+	store := func(t tile) {
+		if err := storeDerivative(ctx, media, t.cacheKey, t.data, t.renderTime); err != nil {
+			log.Printf("Failed to cache tile %s: %v", t.cacheKey, err)
+		}
+	}
+
+	tiles := make(chan tile)
+	var wg sync.WaitGroup
+	for i := 0; i < deepZoomStoreWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tiles {
+				store(t)
+			}
+		}()
+	}
+
+	// Last tiles are held back until the rest of their level is stored
+	var lastTiles []tile
+	err = utils.RenderDeepZoomLevels(src, dz, level, bottom, config.GetConfig().DeepZoom.Quality, func(l, col, row int, data []byte) error {
+		now := time.Now()
+		t := tile{cacheKey: tileCacheKey(media, l, col, row), data: data, renderTime: now.Sub(last)}
+		last = now
+
+		if cols, rows := dz.LevelTiles(l); col == cols-1 && row == rows-1 {
+			lastTiles = append(lastTiles, t)
+			return nil
+		}
+		tiles <- t
+		return nil
+	})
+	close(tiles)
+	wg.Wait()
+	if err != nil {
+		return &transformFailure{message: "Failed to render tiles", err: err}
+	}
+
+	for _, t := range lastTiles {
+		store(t)
+	}
+	return nil
+}
+
+// deepZoomMedia looks up the media of a descriptor or tile request, which signed
+// requests may read without owning it
+func deepZoomMedia(c *gin.Context) (*models.Media, bool) {
+	query := database.GetDB().
+		Select("id", "user_id", "filename", "path", "storage_backend", "mime_type", "updated_at").
+		Where("id = ?", c.Param("id"))
+	if c.GetBool("signed_access") {
+		// Signed links only reach published media with a current license
+		query = publiclyShared(query)
+	} else {
+		userID, _ := c.Get("user_id")
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var media models.Media
+	if err := query.First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return nil, false
+	}
+	return &media, true
+}
+
+// deepZoomNotModified sets the caching headers of a descriptor or tile and reports
+// whether the client's copy is current
+func deepZoomNotModified(c *gin.Context, media *models.Media, etag string) bool {
+	// Versioned URLs never change content, so they can be cached indefinitely
+	if c.Query("v") == thumbnailVersion(media) {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "private, max-age=300")
+	}
+	c.Header("ETag", etag)
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// deepZoomError reports a failure to describe or tile an image
+func deepZoomError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errDeepZoomUnsupported):
+		c.Error(apierror.New(http.StatusUnsupportedMediaType, errDeepZoomUnsupported.Error()))
+	case errors.Is(err, errDeepZoomTooLarge):
+		c.Error(apierror.New(http.StatusRequestEntityTooLarge, errDeepZoomTooLarge.Error()))
+	case errors.Is(err, errTileNotCached):
+		c.Error(apierror.Internal("Failed to cache tile", err))
+	default:
+		c.Error(transformError(err))
+	}
+}
+
+// GetDeepZoomDescriptor godoc
+// @Summary      Get the deep zoom descriptor of an image
+// @Description  Serve the Deep Zoom (DZI) descriptor of a JPEG, PNG or GIF image, for viewers like OpenSeadragon. Tiles are listed below tiles_files/ and rendered on first request. Accepts either a Bearer token or the signed query of deep_zoom_url, which viewers carry over to the tiles.
+// @Tags         media
+// @Produce      xml
+// @Param        id       path      string  true   "Media ID"
+// @Param        v        query     string  false  "Content version from a signed URL"
+// @Param        expires  query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token    query     string  false  "Signed URL token"
+// @Success      200      {string}  string
+// @Success      304      "Not modified"
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Failure      413      {object}  object{error=string}
+// @Failure      415      {object}  object{error=string}
+// @Router       /media/{id}/tiles.dzi [get]
+// @Security     BearerAuth
+func GetDeepZoomDescriptor(c *gin.Context) {
+	ctx := c.Request.Context()
+	media, ok := deepZoomMedia(c)
+	if !ok {
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-dzi-%s"`, media.ID, thumbnailVersion(media))
+	if deepZoomNotModified(c, media, etag) {
+		return
+	}
+
+	dz, err := loadDeepZoomImage(ctx, media)
+	if err != nil {
+		deepZoomError(c, err)
+		return
+	}
+	data, err := dz.Marshal()
+	if err != nil {
+		c.Error(apierror.Internal("Failed to write deep zoom descriptor", err))
+		return
+	}
+	c.Data(http.StatusOK, "application/xml", data)
+}
+
+// GetDeepZoomTile godoc
+// @Summary      Get a deep zoom tile
+// @Description  Serve one tile of the Deep Zoom pyramid of an image. The first request for a level renders and caches all of its tiles, and those of the levels below it.
+// @Tags         media
+// @Produce      image/jpeg,image/png
+// @Param        id       path      string  true   "Media ID"
+// @Param        level    path      int     true   "Pyramid level; the highest is the full image"
+// @Param        tile     path      string  true   "Column and row with the descriptor's format, e.g. 3_2.jpg"
+// @Param        v        query     string  false  "Content version from a signed URL"
+// @Param        expires  query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token    query     string  false  "Signed URL token"
+// @Success      200      {file}    binary
+// @Success      304      "Not modified"
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Failure      413      {object}  object{error=string}
+// @Failure      415      {object}  object{error=string}
+// @Failure      500      {object}  object{error=string}
+// @Router       /media/{id}/tiles_files/{level}/{tile} [get]
+// @Security     BearerAuth
+func GetDeepZoomTile(c *gin.Context) {
+	ctx := c.Request.Context()
+	media, ok := deepZoomMedia(c)
+	if !ok {
+		return
+	}
+
+	level, err := strconv.Atoi(c.Param("level"))
+	name, format, _ := strings.Cut(c.Param("tile"), ".")
+	colStr, rowStr, _ := strings.Cut(name, "_")
+	col, colErr := strconv.Atoi(colStr)
+	row, rowErr := strconv.Atoi(rowStr)
+	if err != nil || colErr != nil || rowErr != nil || level < 0 || col < 0 || row < 0 {
+		c.Error(apierror.NotFound("Tile not found"))
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d-%d_%d-%s"`, media.ID, level, col, row, thumbnailVersion(media))
+	if deepZoomNotModified(c, media, etag) {
+		return
+	}
+
+	dz, err := loadDeepZoomImage(ctx, media)
+	if err != nil {
+		deepZoomError(c, err)
+		return
+	}
+	if level > dz.MaxLevel() || format != dz.Format {
+		c.Error(apierror.NotFound("Tile not found"))
+		return
+	}
+	if cols, rows := dz.LevelTiles(level); col >= cols || row >= rows {
+		c.Error(apierror.NotFound("Tile not found"))
+		return
+	}
+
+	data, hit, err := loadTile(ctx, media, dz, level, col, row)
+	if err != nil {
+		deepZoomError(c, err)
+		return
+	}
+
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	c.Data(http.StatusOK, "image/"+thumbnailFormat(media), data)
+}
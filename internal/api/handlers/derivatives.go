@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// derivativeEvictBatch is how many derivatives are evicted per query
+const derivativeEvictBatch = 100
+
+// Derivative cache counters since startup
+var (
+	derivativeHits      atomic.Int64
+	derivativeMisses    atomic.Int64
+	derivativeEvictions atomic.Int64
+	derivativeSweeping  atomic.Bool
+)
+
+// loadDerivative returns a cached derivative, or false on a miss
+func loadDerivative(ctx context.Context, cacheKey string) ([]byte, bool) {
+	db := database.GetDB()
+
+	var derivative models.Derivative
+	if err := db.Where("cache_key = ?", cacheKey).First(&derivative).Error; err != nil {
+		derivativeMisses.Add(1)
+		return nil, false
+	}
+
+	reader, err := storage.GetBackend(derivative.StorageBackend).Download(ctx, derivative.Path)
+	if err != nil {
+		// The object is gone; drop the record so the next render replaces it. A request
+		// that was cancelled learned nothing about the object.
+		if ctx.Err() == nil {
+			db.Delete(&derivative)
+		}
+		derivativeMisses.Add(1)
+		return nil, false
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		derivativeMisses.Add(1)
+		return nil, false
+	}
+
+	db.Model(&derivative).UpdateColumns(map[string]interface{}{
+		"hits":             gorm.Expr("hits + 1"),
+		"last_accessed_at": time.Now(),
+	})
+	derivativeHits.Add(1)
+	return data, true
+}
+
+// derivativeCached reports whether a derivative is recorded, without reading it
+func derivativeCached(cacheKey string) bool {
+	var count int64
+	database.GetDB().Model(&models.Derivative{}).Where("cache_key = ?", cacheKey).Count(&count)
+	return count > 0
+}
+
+// storeDerivative uploads a derivative of media next to the original and records it
+// with the time it took to render
+func storeDerivative(ctx context.Context, media *models.Media, cacheKey string, data []byte, renderTime time.Duration) error {
+	db := database.GetDB()
+	provider := storage.GetBackend(media.StorageBackend)
+
+	path, err := storage.ReplaceBytes(ctx, provider, data, cacheKey)
+	if err != nil {
+		return err
+	}
+
+	// A fresh render replaces the previous one; providers that assign their own IDs
+	// leave the old object behind unless it is deleted
+	var previous models.Derivative
+	hadPrevious := db.Where("cache_key = ?", cacheKey).First(&previous).Error == nil
+
+	derivative := models.Derivative{
+		MediaID:        media.ID,
+		CacheKey:       cacheKey,
+		StorageBackend: media.StorageBackend,
+		Path:           path,
+		Size:           int64(len(data)),
+		RenderMs:       renderTime.Milliseconds(),
+		LastAccessedAt: time.Now(),
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"storage_backend", "path", "size", "render_ms", "last_accessed_at"}),
+	}).Create(&derivative).Error; err != nil {
+		discardObject(ctx, provider, path)
+		return err
+	}
+
+	if hadPrevious && (previous.Path != path || previous.StorageBackend != media.StorageBackend) {
+		storage.SubmitPurge(0, []storage.PurgeObject{{Backend: previous.StorageBackend, Path: previous.Path, Ref: media.ID}})
+	}
+
+	go sweepDerivatives()
+	return nil
+}
+
+// removeDerivatives deletes derivative records and purges their objects in the background
+func removeDerivatives(ownerID uint, derivatives []models.Derivative) (storage.PurgeJob, error) {
+	objects, err := deleteDerivativeRecords(derivatives)
+	if err != nil {
+		return storage.PurgeJob{}, err
+	}
+	return storage.SubmitPurge(ownerID, objects), nil
+}
+
+// detachDerivatives deletes the derivative records of the given media and returns the
+// objects left to purge
+func detachDerivatives(mediaIDs []string) ([]storage.PurgeObject, error) {
+	var derivatives []models.Derivative
+	if err := database.GetDB().Where("media_id IN ?", mediaIDs).Find(&derivatives).Error; err != nil {
+		return nil, err
+	}
+	return deleteDerivativeRecords(derivatives)
+}
+
+// deleteDerivativeRecords deletes derivative records and returns their stored objects
+func deleteDerivativeRecords(derivatives []models.Derivative) ([]storage.PurgeObject, error) {
+	if len(derivatives) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(derivatives))
+	objects := make([]storage.PurgeObject, len(derivatives))
+	for i, derivative := range derivatives {
+		ids[i] = derivative.ID
+		objects[i] = storage.PurgeObject{Backend: derivative.StorageBackend, Path: derivative.Path, Ref: derivative.MediaID}
+	}
+	if err := database.GetDB().Where("id IN ?", ids).Delete(&models.Derivative{}).Error; err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+// invalidateDerivatives drops the cached derivatives of media whose content changed or
+// that was deleted, so stale renders are never served again
+func invalidateDerivatives(ownerID uint, mediaIDs ...string) {
+	objects, err := detachDerivatives(mediaIDs)
+	if err != nil {
+		log.Printf("Failed to invalidate derivatives of %v: %v", mediaIDs, err)
+		return
+	}
+	if len(objects) > 0 {
+		storage.SubmitPurge(ownerID, objects)
+	}
+}
+
+// sweepDerivatives evicts derivatives past the TTL, then least recently used ones until
+// the cache fits its size limit. Concurrent calls return immediately.
+func sweepDerivatives() {
+	if !derivativeSweeping.CompareAndSwap(false, true) {
+		return
+	}
+	defer derivativeSweeping.Store(false)
+
+	cfg := config.GetConfig().Storage.Derivatives
+	db := database.GetDB()
+
+	if cfg.TTL > 0 {
+		cutoff := time.Now().Add(-cfg.TTL)
+		for {
+			var expired []models.Derivative
+			if err := db.Where("last_accessed_at < ?", cutoff).Limit(derivativeEvictBatch).Find(&expired).Error; err != nil {
+				log.Printf("Failed to load expired derivatives: %v", err)
+				return
+			}
+			if len(expired) == 0 {
+				break
+			}
+			if _, err := removeDerivatives(0, expired); err != nil {
+				log.Printf("Failed to evict expired derivatives: %v", err)
+				return
+			}
+			derivativeEvictions.Add(int64(len(expired)))
+		}
+	}
+
+	if cfg.MaxSize <= 0 {
+		return
+	}
+	var total int64
+	if err := db.Model(&models.Derivative{}).Select("COALESCE(SUM(size), 0)").Scan(&total).Error; err != nil {
+		log.Printf("Failed to measure derivative cache: %v", err)
+		return
+	}
+	for total > cfg.MaxSize {
+		var oldest []models.Derivative
+		if err := db.Order("last_accessed_at").Limit(derivativeEvictBatch).Find(&oldest).Error; err != nil {
+			log.Printf("Failed to load derivatives to evict: %v", err)
+			return
+		}
+		if len(oldest) == 0 {
+			return
+		}
+
+		// Evict only as many as needed to get back under the limit
+		count := 0
+		for count < len(oldest) && total > cfg.MaxSize {
+			total -= oldest[count].Size
+			count++
+		}
+		if _, err := removeDerivatives(0, oldest[:count]); err != nil {
+			log.Printf("Failed to evict derivatives: %v", err)
+			return
+		}
+		derivativeEvictions.Add(int64(count))
+	}
+}
+
+// purgeOrphanedDerivatives removes derivatives left behind by media that no longer
+// exist, such as those whose deletion failed to invalidate them. Proxied remote images
+// belong to no media and are left to eviction.
+func purgeOrphanedDerivatives() error {
+	for {
+		var orphans []models.Derivative
+		if err := database.GetDB().
+			Where("media_id <> ''").
+			Where("NOT EXISTS (SELECT 1 FROM media WHERE media.id = derivatives.media_id AND media.deleted_at IS NULL)").
+			Limit(derivativeEvictBatch).Find(&orphans).Error; err != nil {
+			return err
+		}
+		if len(orphans) == 0 {
+			return nil
+		}
+		if _, err := removeDerivatives(0, orphans); err != nil {
+			return err
+		}
+	}
+}
+
+// PurgeMediaDerivatives godoc
+// @Summary      Purge cached derivatives of a media item
+// @Description  Delete every cached transform and thumbnail of a media item, also from the CDN when purges are configured; the next request renders them again
+// @Tags         media
+// @Produce      json
+// @Param        id   path      string  true  "Media ID"
+// @Success      200  {object}  object{removed=int,purge_job=storage.PurgeJob}
+// @Failure      404  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /media/{id}/derivatives [delete]
+// @Security     BearerAuth
+func PurgeMediaDerivatives(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	db := database.GetDB()
+
+	var media models.Media
+	if err := db.Select("id", "user_id", "path", "storage_backend").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+
+	objects, err := detachDerivatives([]string{media.ID})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to purge derivatives", err))
+		return
+	}
+	purgeFromCDN(media)
+
+	c.JSON(http.StatusOK, gin.H{"removed": len(objects), "purge_job": storage.SubmitPurge(userID.(uint), objects)})
+}
+
+// GetDerivativeCacheStats godoc
+// @Summary      Derivative cache statistics
+// @Description  Size, limits and hit counters of the cache of transformed images and thumbnails
+// @Tags         storage
+// @Produce      json
+// @Success      200  {object}  object{entries=int,total_size=int,max_size=int,ttl=string,hits=int,misses=int,evictions=int}
+// @Failure      500  {object}  object{error=string}
+// @Router       /storage/derivatives/stats [get]
+// @Security     BearerAuth
+func GetDerivativeCacheStats(c *gin.Context) {
+	cfg := config.GetConfig().Storage.Derivatives
+
+	var totals struct {
+		Entries   int64
+		TotalSize int64
+	}
+	if err := database.GetDB().Model(&models.Derivative{}).
+		Select("COUNT(*) AS entries, COALESCE(SUM(size), 0) AS total_size").
+		Scan(&totals).Error; err != nil {
+		c.Error(apierror.Internal("Failed to read derivative cache stats", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":    totals.Entries,
+		"total_size": totals.TotalSize,
+		"max_size":   cfg.MaxSize,
+		"ttl":        cfg.TTL.String(),
+		"hits":       derivativeHits.Load(),
+		"misses":     derivativeMisses.Load(),
+		"evictions":  derivativeEvictions.Load(),
+	})
+}
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+)
+
+// directUploadCompleteWindow is how long after its URL expires an upload may still be completed
+const directUploadCompleteWindow = time.Hour
+
+// directUploadClaims is what an upload token vouches for between presign and complete
+type directUploadClaims struct {
+	UserID   uint     `json:"uid"`
+	Backend  string   `json:"backend"`
+	Key      string   `json:"key"`
+	Filename string   `json:"filename"`
+	Size     int64    `json:"size"`
+	FolderID string   `json:"folder_id,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Conflict string   `json:"conflict"`
+	Expires  int64    `json:"exp"`
+}
+
+// signUploadToken encodes claims into a token only this server can have issued
+func signUploadToken(secret string, claims directUploadClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + utils.SignParams(secret, "upload", payload), nil
+}
+
+// parseUploadToken checks the signature and expiry of an upload token and returns its claims
+func parseUploadToken(secret, token string) (*directUploadClaims, error) {
+	payload, signature, found := strings.Cut(token, ".")
+	if !found || !utils.VerifyParams(secret, signature, "upload", payload) {
+		return nil, errors.New("invalid upload token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.New("invalid upload token")
+	}
+	var claims directUploadClaims
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, errors.New("invalid upload token")
+	}
+	if time.Now().Unix() > claims.Expires {
+		return nil, errors.New("upload token expired")
+	}
+	return &claims, nil
+}
+
+// directUploadMaxSize is the largest file accepted through a direct upload
+func directUploadMaxSize(cfg *config.Config) int64 {
+	if cfg.Storage.DirectUpload.MaxSize > 0 {
+		return cfg.Storage.DirectUpload.MaxSize
+	}
+	return cfg.Storage.MaxUploadSize
+}
+
+// directObjectName is the storage key of a direct upload
+func directObjectName(filename string) string {
+	return uniqueObjectName("upload", filename)
+}
+
+// PresignUpload godoc
+// @Summary      Start a direct upload
+// @Description  Check a planned upload and return a presigned request that stores the file straight in storage, bypassing the API server. Send the file with the returned method, URL and headers, then call POST /media/uploads/complete with the upload token. Files above the multipart threshold get an upload session instead, whose parts are presigned with POST /media/uploads/{id}/parts.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        input  body      handlers.PresignUploadRequest  true  "File to upload"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      200    {object}  handlers.PresignUploadResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      413    {object}  object{error=string}
+// @Failure      415    {object}  object{error=string}
+// @Failure      501    {object}  object{error=string}
+// @Router       /media/uploads/presign [post]
+// @Security     BearerAuth
+func PresignUpload(c *gin.Context) {
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
+	userID := c.GetUint("user_id")
+
+	var input PresignUploadRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	input.Filename = filepath.Base(input.Filename)
+
+	if input.Size > directUploadMaxSize(cfg) {
+		c.Error(apierror.New(http.StatusRequestEntityTooLarge, "File too large"))
+		return
+	}
+
+	// Content can only be sniffed once it is stored; the extension is checked now
+	if err := utils.CheckFileExtension(cfg.Storage.FileTypes, input.Filename); err != nil {
+		c.Error(fileTypeError(err))
+		return
+	}
+
+	policy, err := parseConflictPolicy(input.Conflict)
+	if err != nil {
+		c.Error(apierror.InvalidField("conflict", err.Error()))
+		return
+	}
+
+	var fID *string
+	if input.FolderID != "" {
+		fID = &input.FolderID
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", input.FolderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.InvalidField("folder_id", "is not one of your folders"))
+			return
+		}
+	}
+
+	// Fail early on conflicts and quota; both are checked again on completion
+	resolution, err := resolveFilenameConflict(userID, fID, input.Filename, policy)
+	if err != nil {
+		if errors.Is(err, errFilenameConflict) {
+			c.Error(apierror.Conflict(err.Error()))
+			return
+		}
+		c.Error(apierror.Internal("Failed to check for duplicate filenames", err))
+		return
+	}
+	if resolution.Skip {
+		c.JSON(http.StatusOK, MediaResponse{
+			Message: "File skipped: a file with this name already exists",
+			Skipped: true,
+			Media:   newMediaItem(resolution.Existing),
+		})
+		return
+	}
+	if err := checkQuota(userID, input.Size-resolution.replacedSize()); err != nil {
+		c.Error(quotaError(err))
+		return
+	}
+
+	backendName, uploader, ok := storage.SelectDirectUploadBackend()
+	if !ok {
+		c.Error(apierror.New(http.StatusNotImplemented, "No storage backend accepts direct uploads"))
+		return
+	}
+
+	key := directObjectName(input.Filename)
+	if threshold := cfg.Storage.DirectUpload.MultipartThreshold; threshold > 0 && input.Size > threshold {
+		if multipart, ok := uploader.(storage.MultipartUploader); ok {
+			startMultipartUpload(c, backendName, multipart, key, &input, fID, policy)
+			return
+		}
+	}
+
+	upload, err := uploader.PresignUpload(ctx, key, input.ContentType, input.Size, input.objectOptions(), cfg.Storage.DirectUpload.URLExpiration)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to presign upload", err))
+		return
+	}
+
+	expiresAt := upload.ExpiresAt.Add(directUploadCompleteWindow)
+	token, err := signUploadToken(cfg.JWT.Secret, directUploadClaims{
+		UserID:   userID,
+		Backend:  backendName,
+		Key:      key,
+		Filename: input.Filename,
+		Size:     input.Size,
+		FolderID: input.FolderID,
+		Tags:     input.Tags,
+		Conflict: policy,
+		Expires:  expiresAt.Unix(),
+	})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to sign upload token", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, PresignUploadResponse{
+		UploadToken: token,
+		Upload:      upload,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// CompleteUpload godoc
+// @Summary      Complete a direct upload
+// @Description  Verify the object stored through a presigned upload and create its media item. The object's size must match the presigned size and its content must pass the file type policy; otherwise it is deleted. Completing the same upload again returns the media item created the first time.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        input  body      handlers.CompleteUploadRequest  true  "Upload token from POST /media/uploads/presign"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      200    {object}  handlers.MediaResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      413    {object}  object{error=string}
+// @Failure      415    {object}  object{error=string}
+// @Router       /media/uploads/complete [post]
+// @Security     BearerAuth
+func CompleteUpload(c *gin.Context) {
+	cfg := config.GetConfig()
+	userID := c.GetUint("user_id")
+
+	var input CompleteUploadRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	claims, err := parseUploadToken(cfg.JWT.Secret, input.UploadToken)
+	if err != nil || claims.UserID != userID {
+		c.Error(apierror.InvalidField("upload_token", "is invalid or expired"))
+		return
+	}
+
+	if response := finishDirectUpload(c, claims); response != nil {
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// finishDirectUpload verifies an object a client stored directly and creates its media
+// item, or points the conflicting item at it under the replace policy. A rejected object
+// is deleted. It returns nil once it reported an error on c.
+func finishDirectUpload(c *gin.Context, claims *directUploadClaims) *MediaResponse {
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
+	userID := claims.UserID
+
+	// A retried completion answers with the media item the first one created
+	var existing models.Media
+	if err := database.GetDB().Preload("Tags").Where("path = ? AND storage_backend = ? AND user_id = ?", claims.Key, claims.Backend, userID).First(&existing).Error; err == nil {
+		return &MediaResponse{Message: "File uploaded successfully", Media: newMediaItem(&existing)}
+	}
+
+	uploader, ok := storage.DirectUploadBackend(claims.Backend)
+	if !ok {
+		c.Error(apierror.Internal("Storage backend of the upload is no longer available", nil))
+		return nil
+	}
+	storageProvider := storage.GetBackend(claims.Backend)
+
+	info, err := uploader.StatObject(ctx, claims.Key)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			c.Error(apierror.NotFound("Nothing was uploaded"))
+			return nil
+		}
+		c.Error(apierror.Internal("Failed to check the uploaded object", err))
+		return nil
+	}
+
+	// From here on a rejected upload is removed again
+	reject := func(e *apierror.Error) {
+		discardObject(ctx, storageProvider, claims.Key)
+		c.Error(e)
+	}
+
+	if info.Size != claims.Size {
+		reject(apierror.InvalidField("size", fmt.Sprintf("uploaded %d bytes, %d were announced", info.Size, claims.Size)))
+		return nil
+	}
+
+	head, err := uploader.ReadHead(ctx, claims.Key, sniffLength)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to read the uploaded object", err))
+		return nil
+	}
+	mimeType, err := utils.CheckFileType(cfg.Storage.FileTypes, claims.Filename, head)
+	if err != nil {
+		reject(fileTypeError(err))
+		return nil
+	}
+
+	var fID *string
+	if claims.FolderID != "" {
+		fID = &claims.FolderID
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", claims.FolderID, userID).First(&folder).Error; err != nil {
+			reject(apierror.InvalidField("folder_id", "is not one of your folders"))
+			return nil
+		}
+	}
+
+	resolution, err := resolveFilenameConflict(userID, fID, claims.Filename, claims.Conflict)
+	if err != nil {
+		if errors.Is(err, errFilenameConflict) {
+			reject(apierror.Conflict(err.Error()))
+			return nil
+		}
+		c.Error(apierror.Internal("Failed to check for duplicate filenames", err))
+		return nil
+	}
+	if resolution.Skip {
+		discardObject(ctx, storageProvider, claims.Key)
+		return &MediaResponse{
+			Message: "File skipped: a file with this name already exists",
+			Skipped: true,
+			Media:   newMediaItem(resolution.Existing),
+		}
+	}
+	if err := checkQuota(userID, info.Size-resolution.replacedSize()); err != nil {
+		reject(quotaError(err))
+		return nil
+	}
+
+	tags, err := findOrCreateTags(claims.Tags)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to process tags", err))
+		return nil
+	}
+
+	// The content never passed through this server, so only what the head tells is known
+	mediaMetadata := &utils.MediaMetadata{
+		FileType:   utils.GetFileType(claims.Filename),
+		MimeType:   mimeType,
+		Size:       info.Size,
+		UploadedAt: time.Now().Format(time.RFC3339),
+		Format:     strings.TrimPrefix(filepath.Ext(claims.Filename), "."),
+	}
+	metadataJSON, err := json.Marshal(map[string]interface{}{
+		"original_name": claims.Filename,
+		"file_id":       claims.Key,
+		"direct_upload": true,
+		"technical":     mediaMetadata,
+	})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to marshal metadata", err))
+		return nil
+	}
+
+	// Replace policy: the existing record becomes a new version of the file
+	if resolution.Existing != nil {
+		if err := replaceMediaContent(ctx, claims.Backend, storageProvider, resolution.Existing, claims.Key, mimeType, info.Size, metadataJSON); err != nil {
+			reject(apierror.Internal("Failed to replace media", err))
+			return nil
+		}
+		storage.ReplicateObject(claims.Backend, claims.Key)
+		return &MediaResponse{
+			Message:  "File replaced successfully",
+			Replaced: true,
+			Media:    newMediaItem(resolution.Existing),
+		}
+	}
+
+	media := models.Media{
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		FolderID:       fID,
+		Filename:       resolution.Filename,
+		Path:           claims.Key,
+		MimeType:       mimeType,
+		StorageBackend: claims.Backend,
+		Size:           info.Size,
+		Metadata:       metadataJSON,
+	}
+
+	tx := database.GetDB().Begin()
+	if err := tx.Create(&media).Error; err != nil {
+		tx.Rollback()
+		reject(apierror.Internal("Failed to save media metadata", err))
+		return nil
+	}
+	if len(tags) > 0 {
+		if err := tx.Model(&media).Association("Tags").Append(&tags); err != nil {
+			tx.Rollback()
+			reject(apierror.Internal("Failed to associate tags", err))
+			return nil
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		reject(apierror.Internal("Failed to save media metadata", err))
+		return nil
+	}
+	storage.ReplicateObject(claims.Backend, claims.Key)
+	log.Printf("Direct upload %s completed for user %d (%d bytes)", claims.Key, userID, info.Size)
+	notifyMediaCreated(&media)
+
+	return &MediaResponse{Message: "File uploaded successfully", Media: newMediaItem(&media)}
+}
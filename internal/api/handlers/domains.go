@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+// hostnamePattern matches lowercase DNS hostnames with at least two labels
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z][a-z0-9-]{0,61}[a-z0-9]$`)
+
+// checkPublicDomain validates a custom public domain and, with STORAGE_DOMAIN_TARGET set,
+// that it is a CNAME of the target
+func checkPublicDomain(domain string) error {
+	if len(domain) > 253 || !hostnamePattern.MatchString(domain) {
+		return fmt.Errorf("%s is not a valid hostname", domain)
+	}
+
+	target := strings.TrimSuffix(strings.ToLower(config.GetConfig().Storage.DomainTarget), ".")
+	if target == "" {
+		return nil
+	}
+	cname, err := net.LookupCNAME(domain)
+	if err != nil || strings.TrimSuffix(strings.ToLower(cname), ".") != target {
+		return fmt.Errorf("%s must be a CNAME of %s", domain, target)
+	}
+	return nil
+}
+
+// GetPublicDomain godoc
+// @Summary      Custom media domain
+// @Description  The hostname the current user's media URLs are served from, null for the storage backend's public URL
+// @Tags         account
+// @Produce      json
+// @Success      200  {object}  handlers.PublicDomainResponse
+// @Failure      500  {object}  object{error=string}
+// @Router       /account/domain [get]
+// @Security     BearerAuth
+func GetPublicDomain(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var user models.User
+	if err := database.GetDB().Select("id", "public_domain").First(&user, userID).Error; err != nil {
+		c.Error(apierror.Internal("Failed to load account", err))
+		return
+	}
+	c.JSON(http.StatusOK, PublicDomainResponse{
+		PublicDomain: user.PublicDomain,
+		Target:       config.GetConfig().Storage.DomainTarget,
+	})
+}
+
+// SetPublicDomain godoc
+// @Summary      Set the custom media domain
+// @Description  Serve the current user's media URLs from a custom hostname, such as a CDN in front of the storage bucket; null goes back to the backend's public URL. With STORAGE_DOMAIN_TARGET set, the hostname must be a CNAME of it.
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Param        input  body      handlers.PublicDomainRequest  true  "Hostname, or null"
+// @Success      200    {object}  handlers.PublicDomainResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /account/domain [put]
+// @Security     BearerAuth
+func SetPublicDomain(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var input PublicDomainRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.PublicDomain != nil {
+		domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(*input.PublicDomain)), ".")
+		if err := checkPublicDomain(domain); err != nil {
+			c.Error(apierror.InvalidField("public_domain", err.Error()))
+			return
+		}
+		input.PublicDomain = &domain
+	}
+
+	db := database.GetDB()
+	if input.PublicDomain != nil {
+		var taken int64
+		if err := db.Model(&models.User{}).Where("public_domain = ? AND id <> ?", *input.PublicDomain, userID).Count(&taken).Error; err != nil {
+			c.Error(apierror.Internal("Failed to check domain", err))
+			return
+		}
+		if taken > 0 {
+			c.Error(apierror.Conflict("Domain is already used by another account"))
+			return
+		}
+	}
+	if err := db.Model(&models.User{}).Where("id = ?", userID).Update("public_domain", input.PublicDomain).Error; err != nil {
+		c.Error(apierror.Internal("Failed to update domain", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, PublicDomainResponse{
+		PublicDomain: input.PublicDomain,
+		Target:       config.GetConfig().Storage.DomainTarget,
+	})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+)
+
+// errRangeNotSatisfiable is a Range that starts past the end of the file
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange is the part of a file a download asks for
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// parseRange parses a Range header for a file of size bytes. Like net/http it serves
+// malformed headers and multiple ranges whole, returning nil for them.
+func parseRange(header string, size int64) (*byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, nil
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, nil
+	}
+
+	// A suffix range asks for the last bytes of the file
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		n = min(n, size)
+		if n == 0 {
+			return nil, errRangeNotSatisfiable
+		}
+		return &byteRange{start: size - n, length: n}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	if start >= size {
+		return nil, errRangeNotSatisfiable
+	}
+	end := size - 1
+	if last != "" {
+		e, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || e < start {
+			return nil, nil
+		}
+		end = min(e, end)
+	}
+	return &byteRange{start: start, length: end - start + 1}, nil
+}
+
+// attachmentDisposition is a Content-Disposition saving the response as filename,
+// encoded for names that aren't plain ASCII
+func attachmentDisposition(filename string) string {
+	if disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); disposition != "" {
+		return disposition
+	}
+	return "attachment"
+}
+
+// DownloadMedia godoc
+// @Summary      Download the original file
+// @Description  Stream the original bytes of a media item as an attachment, never transformed. Supports single byte ranges, with If-Range, so interrupted downloads can resume.
+// @Tags         media
+// @Produce      application/octet-stream
+// @Param        id     path      string  true   "Media ID"
+// @Param        Range  header    string  false  "Byte range, e.g. bytes=1048576-"
+// @Success      200    {file}    binary
+// @Success      206    {file}    binary
+// @Failure      404    {object}  object{error=string}
+// @Failure      416    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /media/{id}/download [get]
+// @Security     BearerAuth
+func DownloadMedia(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var media models.Media
+	if err := database.GetDB().
+		Select("id", "filename", "path", "storage_backend", "mime_type", "size", "updated_at").
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+
+	sendDownload(c, &media, func() {
+		recordMediaAccess(userID.(uint), media.ID, models.AccessDownload)
+	})
+}
+
+// sendDownload streams the original of media as an attachment, or the range requested of
+// it. started is called when a download starts, but not when one is resumed.
+func sendDownload(c *gin.Context, media *models.Media, started func()) {
+	ctx := c.Request.Context()
+	etag := fmt.Sprintf(`"%s-%s"`, media.ID, thumbnailVersion(media))
+	contentType := media.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", attachmentDisposition(media.Filename))
+	c.Header("Cache-Control", "private, no-cache")
+	c.Header("ETag", etag)
+	c.Header("Last-Modified", media.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Accept-Ranges", "bytes")
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	// A resumed download only gets a range of the version it started with
+	requested := c.GetHeader("Range")
+	if ifRange := c.GetHeader("If-Range"); ifRange != "" && ifRange != etag &&
+		ifRange != media.UpdatedAt.UTC().Format(http.TimeFormat) {
+		requested = ""
+	}
+	byteRange, err := parseRange(requested, media.Size)
+	if err != nil {
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", media.Size))
+		c.Error(apierror.New(http.StatusRequestedRangeNotSatisfiable, "Requested range is not satisfiable"))
+		return
+	}
+	if byteRange == nil || byteRange.start == 0 {
+		started()
+	}
+
+	if byteRange == nil {
+		reader, err := storage.GetBackend(media.StorageBackend).Download(ctx, media.Path)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to fetch file", err))
+			return
+		}
+		defer reader.Close()
+
+		// Originals in the disk cache are sent straight from the file
+		if file, ok := reader.(*os.File); ok {
+			http.ServeContent(passthroughWriter{c.Writer}, c.Request, "", media.UpdatedAt, file)
+			return
+		}
+		c.DataFromReader(http.StatusOK, media.Size, contentType, reader, nil)
+		return
+	}
+
+	reader, err := openRange(ctx, media, byteRange)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch file", err))
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", byteRange.start, byteRange.start+byteRange.length-1, media.Size))
+	c.DataFromReader(http.StatusPartialContent, byteRange.length, contentType, reader, nil)
+}
+
+// openRange reads a range of a media item's file, from storage directly when its backend
+// reads ranges and otherwise by skipping through the whole file
+func openRange(ctx context.Context, media *models.Media, r *byteRange) (io.ReadCloser, error) {
+	if ranges, ok := storage.RangeBackend(media.StorageBackend); ok {
+		return ranges.DownloadRange(ctx, media.Path, r.start, r.length)
+	}
+
+	reader, err := storage.GetBackend(media.StorageBackend).Download(ctx, media.Path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, reader, r.start); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(reader, r.length), reader}, nil
+}
@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/clouddrive"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+)
+
+// driveTokenMargin is how long before it expires an access token is refreshed, so it
+// doesn't run out during a request
+const driveTokenMargin = time.Minute
+
+// driveAccess reads a connected drive, refreshing its access token as needed. It is
+// shared by the workers of an import job.
+type driveAccess struct {
+	mu       sync.Mutex
+	conn     *models.CloudDriveConnection
+	provider clouddrive.Provider
+}
+
+// token returns a valid access token, refreshing and saving it when it is about to expire
+func (d *driveAccess) token(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.conn.TokenExpiresAt == nil || time.Until(*d.conn.TokenExpiresAt) > driveTokenMargin {
+		return d.conn.AccessToken, nil
+	}
+
+	token, err := d.provider.Refresh(ctx, d.conn.RefreshToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh the access token: %v", err)
+	}
+	d.conn.AccessToken = token.AccessToken
+	d.conn.RefreshToken = token.RefreshToken
+	d.conn.TokenExpiresAt = token.ExpiresAt
+	if err := database.GetDB().Model(d.conn).Updates(map[string]interface{}{
+		"access_token":     token.AccessToken,
+		"refresh_token":    token.RefreshToken,
+		"token_expires_at": token.ExpiresAt,
+	}).Error; err != nil {
+		log.Printf("Failed to save the refreshed token of cloud drive %d: %v", d.conn.ID, err)
+	}
+	return token.AccessToken, nil
+}
+
+// driveState signs the state of a connection started by a user, so completing it checks
+// that the same user started it, for the same provider and redirect, and not too long ago
+func driveState(secret, provider string, userID uint, expires int64, redirectURI string) string {
+	user, expiry := strconv.FormatUint(uint64(userID), 10), strconv.FormatInt(expires, 10)
+	return user + "." + expiry + "." + utils.SignParams(secret, "cloud_drive", provider, user, expiry, redirectURI)
+}
+
+// verifyDriveState checks a state returned by a provider against the user completing
+// the connection
+func verifyDriveState(secret, provider, state string, userID uint, redirectURI string) error {
+	parts := strings.Split(state, ".")
+	if len(parts) != 3 {
+		return errors.New("is malformed")
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return errors.New("is malformed")
+	}
+	if parts[0] != strconv.FormatUint(uint64(userID), 10) ||
+		!utils.VerifyParams(secret, parts[2], "cloud_drive", provider, parts[0], parts[1], redirectURI) {
+		return errors.New("was not issued to you for this drive")
+	}
+	if time.Now().Unix() > expires {
+		return errors.New("expired; connect the drive again")
+	}
+	return nil
+}
+
+// driveRedirectURI returns the redirect a connection uses, the one of the request or the
+// configured one
+func driveRedirectURI(c *gin.Context, requested string) (string, bool) {
+	if requested != "" {
+		return requested, true
+	}
+	if configured := config.GetConfig().Drives.RedirectURL; configured != "" {
+		return configured, true
+	}
+	c.Error(apierror.InvalidField("redirect_uri", "is required as CLOUD_DRIVE_REDIRECT_URL is not set"))
+	return "", false
+}
+
+// driveProvider returns the configured provider named by the provider parameter
+func driveProvider(c *gin.Context) (clouddrive.Provider, bool) {
+	provider, err := clouddrive.NewProvider(c.Param("provider"), config.GetConfig().Drives)
+	if err != nil {
+		c.Error(apierror.New(http.StatusNotImplemented, "This cloud drive is not available").WithDetails(err.Error()))
+		return nil, false
+	}
+	return provider, true
+}
+
+// loadDrive loads the current user's connection named by the id parameter
+func loadDrive(c *gin.Context) (*driveAccess, bool) {
+	var conn models.CloudDriveConnection
+	if err := database.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).First(&conn).Error; err != nil {
+		c.Error(apierror.NotFound("Cloud drive not found"))
+		return nil, false
+	}
+	provider, err := clouddrive.NewProvider(conn.Provider, config.GetConfig().Drives)
+	if err != nil {
+		c.Error(apierror.New(http.StatusNotImplemented, "This cloud drive is not available").WithDetails(err.Error()))
+		return nil, false
+	}
+	return &driveAccess{conn: &conn, provider: provider}, true
+}
+
+// openJobDrive returns the drive a cloud drive import reads from, or nil once it was
+// disconnected or its provider is no longer configured
+func openJobDrive(job *models.ImportJob) *driveAccess {
+	if job.DriveID == nil {
+		return nil
+	}
+	var conn models.CloudDriveConnection
+	if err := database.GetDB().Where("id = ? AND user_id = ?", *job.DriveID, job.UserID).First(&conn).Error; err != nil {
+		log.Printf("Cloud drive %d of import job %d is gone: %v", *job.DriveID, job.ID, err)
+		return nil
+	}
+	provider, err := clouddrive.NewProvider(conn.Provider, config.GetConfig().Drives)
+	if err != nil {
+		log.Printf("Cloud drive %d of import job %d can't be read: %v", conn.ID, job.ID, err)
+		return nil
+	}
+	return &driveAccess{conn: &conn, provider: provider}
+}
+
+// processDriveItem imports one file of a cloud drive import. The file is looked up first,
+// to name it and turn away folders and files too large, then downloaded like a URL import
+// through a client that authorizes requests to the drive.
+func processDriveItem(ctx context.Context, drive *driveAccess, client *http.Client, item *models.ImportJobItem, job *models.ImportJob, maxUploadSize int64) gin.H {
+	failed := func(message string) gin.H {
+		return gin.H{"url": item.URL, "success": false, "error": message}
+	}
+	if drive == nil {
+		return failed("The cloud drive was disconnected")
+	}
+
+	token, err := drive.token(ctx)
+	if err != nil {
+		return failed(err.Error())
+	}
+	file, err := drive.provider.File(ctx, token, item.SourceID)
+	if err != nil {
+		return failed(fmt.Sprintf("Failed to read drive file: %v", err))
+	}
+	if file.Size > maxUploadSize {
+		return failed("File too large")
+	}
+	if item.Filename == "" {
+		item.Filename = file.Name
+		updateImportItem(item, map[string]interface{}{"filename": file.Name})
+	}
+
+	backendName, storageProvider := storage.SelectUploadBackend()
+	return processURLUpload(ctx, client, backendName, storageProvider, item, job.FolderID, job.UserID, maxUploadSize)
+}
+
+// ListDrives godoc
+// @Summary      List connected cloud drives
+// @Description  The cloud drive accounts you connected, and the drives that can be connected
+// @Tags         drives
+// @Produce      json
+// @Success      200  {object}  handlers.DrivesResponse
+// @Failure      500  {object}  object{error=string}
+// @Router       /drives [get]
+// @Security     BearerAuth
+func ListDrives(c *gin.Context) {
+	drives := []models.CloudDriveConnection{}
+	if err := database.GetDB().Where("user_id = ?", c.GetUint("user_id")).Order("created_at, id").Find(&drives).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch cloud drives", err))
+		return
+	}
+	providers := clouddrive.Configured(config.GetConfig().Drives)
+	if providers == nil {
+		providers = []string{}
+	}
+	c.JSON(http.StatusOK, DrivesResponse{Providers: providers, Drives: drives})
+}
+
+// ConnectDrive godoc
+// @Summary      Start connecting a cloud drive
+// @Description  Returns the URL to send the user to, where they grant read access to their Google Drive, Dropbox or OneDrive. The provider then sends them to redirect_uri, CLOUD_DRIVE_REDIRECT_URL by default, with a code and the state, which the client completes the connection with.
+// @Tags         drives
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string                         true   "google_drive, dropbox or onedrive"
+// @Param        input     body      handlers.ConnectDriveRequest  false  "Redirect"
+// @Success      200       {object}  handlers.ConnectDriveResponse
+// @Failure      400       {object}  object{error=string}
+// @Failure      501       {object}  object{error=string}
+// @Router       /drives/connect/{provider} [post]
+// @Security     BearerAuth
+func ConnectDrive(c *gin.Context) {
+	var input ConnectDriveRequest
+	if c.Request.ContentLength != 0 && !bindJSON(c, &input) {
+		return
+	}
+	provider, ok := driveProvider(c)
+	if !ok {
+		return
+	}
+	redirectURI, ok := driveRedirectURI(c, input.RedirectURI)
+	if !ok {
+		return
+	}
+
+	cfg := config.GetConfig()
+	expires := time.Now().Add(cfg.Drives.StateExpiration)
+	state := driveState(cfg.JWT.Secret, provider.Name(), c.GetUint("user_id"), expires.Unix(), redirectURI)
+	c.JSON(http.StatusOK, ConnectDriveResponse{
+		AuthorizeURL: provider.AuthURL(state, redirectURI),
+		State:        state,
+		ExpiresAt:    expires.UTC().Truncate(time.Second),
+	})
+}
+
+// CompleteDriveConnection godoc
+// @Summary      Finish connecting a cloud drive
+// @Description  Exchanges the code the provider sent the user back with for a token and saves the connection. The state must be the one POST /drives/connect/{provider} issued to the same user. Connecting an account again replaces its tokens.
+// @Tags         drives
+// @Accept       json
+// @Produce      json
+// @Param        provider  path      string                                    true  "google_drive, dropbox or onedrive"
+// @Param        input     body      handlers.CompleteDriveConnectionRequest  true  "Code and state"
+// @Success      200       {object}  handlers.DriveResponse
+// @Success      201       {object}  handlers.DriveResponse
+// @Failure      400       {object}  object{error=string}
+// @Failure      502       {object}  object{error=string}
+// @Failure      501       {object}  object{error=string}
+// @Router       /drives/connect/{provider}/complete [post]
+// @Security     BearerAuth
+func CompleteDriveConnection(c *gin.Context) {
+	var input CompleteDriveConnectionRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	provider, ok := driveProvider(c)
+	if !ok {
+		return
+	}
+	redirectURI, ok := driveRedirectURI(c, input.RedirectURI)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+	if err := verifyDriveState(config.GetConfig().JWT.Secret, provider.Name(), input.State, userID, redirectURI); err != nil {
+		c.Error(apierror.InvalidField("state", err.Error()))
+		return
+	}
+
+	ctx := c.Request.Context()
+	token, err := provider.Exchange(ctx, input.Code, redirectURI)
+	if err != nil {
+		c.Error(apierror.Wrap(http.StatusBadGateway, "The cloud drive refused the authorization code", err))
+		return
+	}
+	account, err := provider.Account(ctx, token.AccessToken)
+	if err != nil {
+		c.Error(apierror.Wrap(http.StatusBadGateway, "Failed to read the cloud drive account", err))
+		return
+	}
+
+	db := database.GetDB()
+	conn := models.CloudDriveConnection{UserID: userID, Provider: provider.Name(), AccountID: account.ID}
+	status := http.StatusCreated
+	if err := db.Where(&conn).First(&conn).Error; err == nil {
+		status = http.StatusOK
+	}
+	conn.AccountName = account.Name
+	conn.AccountEmail = account.Email
+	conn.AccessToken = token.AccessToken
+	conn.TokenExpiresAt = token.ExpiresAt
+	// Some providers only issue a refresh token the first time access is granted
+	if token.RefreshToken != "" {
+		conn.RefreshToken = token.RefreshToken
+	}
+	if err := db.Save(&conn).Error; err != nil {
+		c.Error(apierror.Internal("Failed to save cloud drive", err))
+		return
+	}
+
+	c.JSON(status, DriveResponse{Drive: conn})
+}
+
+// DisconnectDrive godoc
+// @Summary      Disconnect a cloud drive
+// @Description  Forgets the tokens of a connected account. Files of running imports not yet downloaded fail. Access stays granted at the provider until revoked in the account's settings there.
+// @Tags         drives
+// @Produce      json
+// @Param        id   path      int  true  "Drive ID"
+// @Success      200  {object}  handlers.MessageResponse
+// @Failure      404  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /drives/{id} [delete]
+// @Security     BearerAuth
+func DisconnectDrive(c *gin.Context) {
+	result := database.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).Delete(&models.CloudDriveConnection{})
+	if result.Error != nil {
+		c.Error(apierror.Internal("Failed to disconnect cloud drive", result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.Error(apierror.NotFound("Cloud drive not found"))
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Cloud drive disconnected successfully"})
+}
+
+// ListDriveFiles godoc
+// @Summary      Browse a connected cloud drive
+// @Description  A page of the files and folders in a folder of the drive, its root by default. Pass the returned cursor for the next page. Google Docs, Sheets and Slides are left out, as they have no file to import.
+// @Tags         drives
+// @Produce      json
+// @Param        id      path      int     true   "Drive ID"
+// @Param        folder  query     string  false  "Folder ID (a path also works for Dropbox)"
+// @Param        cursor  query     string  false  "Cursor of the next page"
+// @Success      200     {object}  handlers.DriveFilesResponse
+// @Failure      404     {object}  object{error=string}
+// @Failure      502     {object}  object{error=string}
+// @Router       /drives/{id}/files [get]
+// @Security     BearerAuth
+func ListDriveFiles(c *gin.Context) {
+	drive, ok := loadDrive(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	token, err := drive.token(ctx)
+	if err != nil {
+		c.Error(apierror.Wrap(http.StatusBadGateway, "Failed to refresh access to the cloud drive", err))
+		return
+	}
+	files, cursor, err := drive.provider.List(ctx, token, c.Query("folder"), c.Query("cursor"))
+	if err != nil {
+		c.Error(apierror.Wrap(http.StatusBadGateway, "Failed to list the cloud drive", err))
+		return
+	}
+	c.JSON(http.StatusOK, DriveFilesResponse{Files: files, Cursor: cursor})
+}
+
+// ImportDriveFiles godoc
+// @Summary      Import files from a connected cloud drive
+// @Description  Starts a background batch job downloading the files straight from the drive, so they never pass through the client. Each file keeps its name in the drive unless filename is given, and the media metadata records the drive and file under cloud_drive. Folders and files larger than the upload limit fail.
+// @Tags         drives
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                               true  "Drive ID"
+// @Param        input  body      handlers.ImportDriveFilesRequest  true  "Files and target folder"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      202    {object}  handlers.BatchAcceptedResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /drives/{id}/import [post]
+// @Security     BearerAuth
+func ImportDriveFiles(c *gin.Context) {
+	var input ImportDriveFilesRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	drive, ok := loadDrive(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	var fID *string
+	if input.FolderID != "" {
+		fID = &input.FolderID
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", input.FolderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.InvalidField("folder_id", "is not one of your folders"))
+			return
+		}
+	}
+
+	job := models.ImportJob{
+		UserID:         userID,
+		Kind:           models.BatchKindCloudDrive,
+		FolderID:       fID,
+		DriveID:        &drive.conn.ID,
+		Status:         models.ImportJobRunning,
+		LeaseOwner:     newLeaseOwner(),
+		LeaseExpiresAt: importLease(),
+		Total:          len(input.Files),
+	}
+	for i, file := range input.Files {
+		tags, _ := json.Marshal(file.Tags)
+		source, _ := json.Marshal(map[string]interface{}{
+			"cloud_drive": map[string]interface{}{
+				"provider": drive.conn.Provider,
+				"account":  drive.conn.AccountEmail,
+				"file_id":  file.ID,
+			},
+		})
+		job.Items = append(job.Items, models.ImportJobItem{
+			Position: i,
+			URL:      drive.provider.DownloadURL(file.ID),
+			Filename: file.Filename,
+			Tags:     tags,
+			SourceID: file.ID,
+			Metadata: source,
+			Status:   models.ImportItemPending,
+		})
+	}
+	if err := database.GetDB().Create(&job).Error; err != nil {
+		c.Error(apierror.Internal("Failed to create import job", err))
+		return
+	}
+
+	// The job outlives the request; ResumeImportJobs picks it up again after a restart
+	go runImportJob(&job, config.GetConfig().Storage.MaxUploadSize)
+
+	c.JSON(http.StatusAccepted, batchAccepted(&job, "Cloud drive import started"))
+}
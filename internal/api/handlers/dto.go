@@ -0,0 +1,940 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"go-media-center-example/internal/clouddrive"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/scheduler"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/tagging"
+)
+
+// Request bodies bound by the handlers. The OpenAPI document is generated from these
+// types, so a field added here shows up in the published schema as well.
+
+// RegisterRequest is the body of POST /auth/register
+type RegisterRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+}
+
+// LoginRequest is the body of POST /auth/login
+type LoginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// CreateFolderRequest is the body of POST /folders
+type CreateFolderRequest struct {
+	Name        string `json:"name" binding:"required,min=1,max=255"`
+	Description string `json:"description"`
+	ParentID    *uint  `json:"parent_id,omitempty"`
+}
+
+// CreateGroupRequest is the body of POST /groups
+type CreateGroupRequest struct {
+	Name        string `json:"name" binding:"required,min=1,max=255" example:"Design team"`
+	Description string `json:"description"`
+}
+
+// UpdateGroupRequest is the body of PUT /groups/:id
+type UpdateGroupRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Description *string `json:"description"`
+}
+
+// AddGroupMembersRequest is the body of POST /groups/:id/members
+type AddGroupMembersRequest struct {
+	UserIDs   []uint   `json:"user_ids"`
+	Usernames []string `json:"usernames"`
+	Role      string   `json:"role" binding:"omitempty,oneof=member manager"` // member by default
+}
+
+// UpdateGroupMemberRequest is the body of PUT /groups/:id/members/:user_id
+type UpdateGroupMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=member manager"`
+}
+
+// ConnectDriveRequest is the body of POST /drives/connect/:provider
+type ConnectDriveRequest struct {
+	RedirectURI string `json:"redirect_uri" binding:"omitempty,url"` // Page the provider sends the user back to; CLOUD_DRIVE_REDIRECT_URL by default
+}
+
+// CompleteDriveConnectionRequest is the body of POST /drives/connect/:provider/complete
+type CompleteDriveConnectionRequest struct {
+	Code        string `json:"code" binding:"required"`              // Code the provider sent the user back with
+	State       string `json:"state" binding:"required"`             // State the provider sent the user back with
+	RedirectURI string `json:"redirect_uri" binding:"omitempty,url"` // The redirect_uri connecting started with, if any
+}
+
+// ImportDriveFilesRequest is the body of POST /drives/:id/import
+type ImportDriveFilesRequest struct {
+	Files    []DriveFileImport `json:"files" binding:"required,min=1,max=1000,dive"`
+	FolderID string            `json:"folder_id"`
+}
+
+// DriveFileImport is a file of a cloud drive import
+type DriveFileImport struct {
+	ID       string   `json:"id" binding:"required"` // File ID from GET /drives/:id/files
+	Filename string   `json:"filename"`              // The file's name in the drive by default
+	Tags     []string `json:"tags"`
+}
+
+// CreateWidgetTokenRequest is the body of POST /widget-tokens
+type CreateWidgetTokenRequest struct {
+	Name           string   `json:"name" binding:"max=255" example:"Contest entries"`
+	FolderID       string   `json:"folder_id"`                                          // Folder uploads land in; the root by default
+	MaxSize        int64    `json:"max_size" binding:"min=0" example:"10485760"`        // Largest file in bytes; MAX_UPLOAD_SIZE by default and at most
+	AllowedTypes   []string `json:"allowed_types" example:"image/*"`                    // MIME types, image/* matching a family; any by default
+	AllowedOrigins []string `json:"allowed_origins" example:"https://shop.example.com"` // Sites the widget may run on; any by default
+	MaxUploads     int      `json:"max_uploads" binding:"min=0"`                        // Files the token accepts; 0 for no limit
+	ExpiresIn      int64    `json:"expires_in" binding:"min=0" example:"3600"`          // Lifetime in seconds; WIDGET_TOKEN_TTL by default
+}
+
+// UpdateFolderRequest is the body of PUT /folders/:id
+type UpdateFolderRequest struct {
+	Name        string `json:"name" binding:"max=255"`
+	Description string `json:"description"`
+	ParentID    *uint  `json:"parent_id"` // 0 moves the folder to the root
+}
+
+// CreateLifecycleRuleRequest is the body of POST /folders/:id/lifecycle
+type CreateLifecycleRuleRequest struct {
+	Action       string `json:"action" binding:"required,oneof=archive delete purge_trash"`
+	AfterDays    int    `json:"after_days" binding:"required,min=1,max=36500" example:"90"`                                                         // Age of media, or days since deletion for purge_trash
+	StorageClass string `json:"storage_class" binding:"omitempty,oneof=STANDARD_IA ONEZONE_IA INTELLIGENT_TIERING GLACIER_IR" example:"GLACIER_IR"` // Required for archive
+	Enabled      *bool  `json:"enabled"`                                                                                                            // Defaults to true
+}
+
+// UpdateLifecycleRuleRequest is the body of PUT /folders/:id/lifecycle/:rule_id
+type UpdateLifecycleRuleRequest struct {
+	AfterDays    *int    `json:"after_days" binding:"omitempty,min=1,max=36500"`
+	StorageClass *string `json:"storage_class" binding:"omitempty,oneof=STANDARD_IA ONEZONE_IA INTELLIGENT_TIERING GLACIER_IR"`
+	Enabled      *bool   `json:"enabled"`
+}
+
+// CreateMetadataFieldRequest is the body of POST /admin/metadata-fields
+type CreateMetadataFieldRequest struct {
+	Key      string   `json:"key" binding:"required" example:"campaign"` // Key of the value under metadata.custom
+	Label    string   `json:"label" binding:"required" example:"Campaign"`
+	Type     string   `json:"type" binding:"required,oneof=text number date select"`
+	Options  []string `json:"options"` // Values of a select field
+	Required bool     `json:"required"`
+}
+
+// UpdateMetadataFieldRequest is the body of PUT /admin/metadata-fields/:id
+type UpdateMetadataFieldRequest struct {
+	Label    *string  `json:"label"`
+	Options  []string `json:"options"` // Replaces the options of a select field
+	Required *bool    `json:"required"`
+}
+
+// URLImportRequest is the body of POST /media/url
+type URLImportRequest struct {
+	URL      string   `json:"url" binding:"required"`
+	Filename string   `json:"filename"`
+	FolderID string   `json:"folder_id"`
+	Tags     []string `json:"tags"`
+	Conflict string   `json:"conflict" binding:"omitempty,oneof=rename replace skip fail"`
+	StorageOptions
+}
+
+// StorageOptions override the S3 storage class and server-side encryption an upload is
+// stored with by default. Setting either routes the upload to an S3 backend.
+type StorageOptions struct {
+	StorageClass string `json:"storage_class" binding:"omitempty,oneof=STANDARD STANDARD_IA ONEZONE_IA INTELLIGENT_TIERING GLACIER_IR" example:"STANDARD_IA"`
+	Encryption   string `json:"encryption" binding:"omitempty,oneof=AES256 aws:kms" example:"aws:kms"` // AES256 for SSE-S3, aws:kms for SSE-KMS
+}
+
+// PresignUploadRequest is the body of POST /media/uploads/presign
+type PresignUploadRequest struct {
+	Filename    string   `json:"filename" binding:"required,max=255"`
+	Size        int64    `json:"size" binding:"required,gt=0"` // Exact size in bytes of the file to upload
+	ContentType string   `json:"content_type"`                 // Sent by the client with the upload; sniffed again on completion
+	FolderID    string   `json:"folder_id"`
+	Tags        []string `json:"tags"`
+	Conflict    string   `json:"conflict" binding:"omitempty,oneof=rename replace skip fail"`
+	StorageOptions
+}
+
+// CompleteUploadRequest is the body of POST /media/uploads/complete
+type CompleteUploadRequest struct {
+	UploadToken string `json:"upload_token" binding:"required"`
+}
+
+// UploadPartsRequest is the body of POST /media/uploads/{id}/parts
+type UploadPartsRequest struct {
+	PartNumbers []int32 `json:"part_numbers" binding:"required,min=1,max=100,dive,min=1" example:"1,2,3"`
+}
+
+// CompletedPart is a part of a multipart upload as stored by the client
+type CompletedPart struct {
+	PartNumber int32  `json:"part_number" binding:"required,min=1" example:"1"`
+	ETag       string `json:"etag" binding:"required"` // ETag header storage answered the part's upload with
+}
+
+// CompleteMultipartUploadRequest is the body of POST /media/uploads/{id}/complete
+type CompleteMultipartUploadRequest struct {
+	Parts []CompletedPart `json:"parts" binding:"required,min=1,dive"`
+}
+
+// BulkURLUploadRequest is the body of POST /media/url/batch
+type BulkURLUploadRequest struct {
+	URLs     []URLUploadRequest `json:"urls" binding:"required,min=1,dive"`
+	FolderID string             `json:"folder_id"`
+}
+
+// ManifestRow is one row of a manifest imported by POST /import: a URL to download or an
+// existing object to register
+type ManifestRow struct {
+	URL        string          `json:"url"`
+	StorageKey string          `json:"storage_key"`
+	Backend    string          `json:"backend"` // Backend of storage_key, the primary one by default
+	Filename   string          `json:"filename"`
+	FolderID   json.Number     `json:"folder_id"`
+	Folder     string          `json:"folder"` // Slash-separated folder path, created as needed
+	Tags       ManifestTags    `json:"tags"`
+	Metadata   json.RawMessage `json:"metadata"`
+}
+
+// UpdateMediaRequest is the body of PUT /media/:id
+type UpdateMediaRequest struct {
+	Filename string   `json:"filename"`
+	FolderID *string  `json:"folder_id"`
+	Metadata []byte   `json:"metadata"`
+	Tags     []string `json:"tags"`
+}
+
+// BatchOperationRequest is the body of POST /media/batch/operation
+type BatchOperationRequest struct {
+	Operation string   `json:"operation" binding:"required,oneof=delete move copy add_tags remove_tags"`
+	MediaIDs  []string `json:"media_ids" binding:"required,min=1"`
+	FolderID  *string  `json:"folder_id"` // Target folder of a move or copy, one of the user's; empty moves media out of folders
+	Tags      []string `json:"tags"`      // Tag names of add_tags and remove_tags
+}
+
+// ThumbnailsRequest is the body of POST /media/thumbs
+type ThumbnailsRequest struct {
+	IDs    []string `json:"ids" binding:"required,min=1"`
+	Size   int      `json:"size"`
+	Inline bool     `json:"inline"`
+}
+
+// ExportArchiveRequest is the body of POST /export/zip. Either media_ids or folder_id names
+// the media to archive.
+type ExportArchiveRequest struct {
+	MediaIDs []string `json:"media_ids"`
+	FolderID string   `json:"folder_id"`                                              // The folder's own media, without subfolders
+	Format   string   `json:"format" binding:"omitempty,oneof=zip tar" example:"zip"` // zip by default
+	Async    bool     `json:"async"`                                                  // Build the archive in the background and return a download link
+}
+
+// UploadBackendRequest is the body of PUT /admin/storage/upload-backend
+type UploadBackendRequest struct {
+	Backend string `json:"backend"` // Empty restores automatic selection
+}
+
+// UserQuotaRequest is the body of PUT /admin/users/:id/quota
+type UserQuotaRequest struct {
+	Quota *int64 `json:"quota"` // Bytes, 0 for unlimited; null restores the default
+}
+
+// OwnershipTransferRequest is the body of POST /admin/users/:id/transfer. Folders are
+// transferred with their subfolders and the media in them.
+type OwnershipTransferRequest struct {
+	ToUserID    uint     `json:"to_user_id" binding:"required"`
+	MediaIDs    []string `json:"media_ids"`
+	FolderIDs   []uint   `json:"folder_ids"`
+	All         bool     `json:"all"`          // Everything the user owns
+	IgnoreQuota bool     `json:"ignore_quota"` // Transfer even past the recipient's quota
+}
+
+// MediaWorkflowRequest is the body of POST /media/:id/workflow
+type MediaWorkflowRequest struct {
+	Status string `json:"status" binding:"required" example:"in_review"` // draft, in_review, approved or rejected
+	Note   string `json:"note"`                                          // Kept with the transition, e.g. why media were rejected
+}
+
+// Response bodies, used to document the JSON the handlers write
+
+// HealthResponse reports that the API is up, and degraded while a storage backend's
+// circuit breaker isn't closed
+type HealthResponse struct {
+	Status  string            `json:"status" example:"healthy"`
+	Version string            `json:"version" example:"1.0.0"`
+	Storage map[string]string `json:"storage"` // Circuit breaker state of each storage backend
+}
+
+// MessageResponse acknowledges an operation without returning data
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// AuthUser is the public part of a user returned on login
+type AuthUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// AuthResponse is returned by register and login
+type AuthResponse struct {
+	Message string   `json:"message"`
+	Token   string   `json:"token"`
+	User    AuthUser `json:"user"`
+}
+
+// TagItem is a tag as returned with media
+type TagItem struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// MediaItem is the public part of a media item. Where the object is stored stays
+// internal; clients fetch it through the URLs built for the response.
+type MediaItem struct {
+	ID                   string          `json:"id"`
+	UserID               uint            `json:"user_id"`
+	FolderID             *string         `json:"folder_id"`
+	Filename             string          `json:"filename"`
+	MimeType             string          `json:"mime_type"`
+	Size                 int64           `json:"size"`
+	Metadata             json.RawMessage `json:"metadata,omitempty"`
+	Tags                 []TagItem       `json:"tags"`
+	Broken               bool            `json:"broken,omitempty"`        // The stored object is missing
+	WorkflowStatus       string          `json:"workflow_status"`         // draft, in_review, approved or rejected
+	License              *MediaLicense   `json:"license,omitempty"`       // Only once a license was recorded
+	LegalHold            bool            `json:"legal_hold,omitempty"`    // Can't be deleted until released
+	RetainUntil          *time.Time      `json:"retain_until,omitempty"`  // Can't be deleted before then
+	URL                  string          `json:"url"`                     // Public URL of the stored object
+	ThumbnailURL         string          `json:"thumbnail_url,omitempty"` // Signed thumbnail URL, for images and documents
+	BlurHash             string          `json:"blurhash,omitempty"`      // Placeholder to draw while loading, for images and videos
+	DownloadURL          string          `json:"download_url,omitempty"`  // Presigned storage URL, on GET /media/:id only
+	DownloadURLExpiresAt *time.Time      `json:"download_url_expires_at,omitempty"`
+	FileURL              string          `json:"file_url,omitempty"`      // Signed URL serving the file through the API, on GET /media/:id only
+	DeepZoomURL          string          `json:"deep_zoom_url,omitempty"` // Signed Deep Zoom descriptor URL, for images on GET /media/:id only
+	EmbedURL             string          `json:"embed_url,omitempty"`     // Signed embed page link to share, on GET /media/:id only
+	CreatedAt            time.Time       `json:"created_at"`
+	UpdatedAt            time.Time       `json:"updated_at"`
+}
+
+// MediaLicense is the license media are used under
+type MediaLicense struct {
+	Type         string  `json:"type,omitempty" example:"royalty_free"`
+	RightsHolder string  `json:"rights_holder,omitempty"`
+	ExpiresAt    *string `json:"expires_at,omitempty" example:"2027-06-30"` // Last day the media may be used
+	Expired      bool    `json:"expired"`
+}
+
+// SetMediaLicenseRequest is the body of PUT /media/:id/license
+type SetMediaLicenseRequest struct {
+	Type         string  `json:"type" example:"rights_managed"` // One of the license types, empty for none
+	RightsHolder string  `json:"rights_holder" binding:"max=255" example:"Jane Doe Photography"`
+	ExpiresAt    *string `json:"expires_at" example:"2027-06-30"` // Last day the media may be used (YYYY-MM-DD), null if it doesn't end
+}
+
+// OEmbedResponse describes a shared media link, see https://oembed.com
+type OEmbedResponse struct {
+	Type            string `json:"type"` // photo, video, rich (audio) or link
+	Version         string `json:"version"`
+	Title           string `json:"title"`
+	ProviderName    string `json:"provider_name"`
+	ProviderURL     string `json:"provider_url"`
+	URL             string `json:"url,omitempty"`  // Image URL of photos
+	HTML            string `json:"html,omitempty"` // Player iframe of video and rich media
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	ThumbnailURL    string `json:"thumbnail_url,omitempty"`
+	ThumbnailWidth  int    `json:"thumbnail_width,omitempty"`
+	ThumbnailHeight int    `json:"thumbnail_height,omitempty"`
+}
+
+// EmbedCounts counts the views and downloads through embed links
+type EmbedCounts struct {
+	Views     int64 `json:"views"`
+	Downloads int64 `json:"downloads"`
+}
+
+// EmbedDailyCount counts the views and downloads through embed links of a day
+type EmbedDailyCount struct {
+	Day string `json:"day" example:"2026-10-15"`
+	EmbedCounts
+}
+
+// EmbedSourceCount counts the views and downloads through embed links from a referrer
+// or country
+type EmbedSourceCount struct {
+	Value string `json:"value"`
+	EmbedCounts
+}
+
+// EmbedAnalyticsResponse is returned by GET /media/:id/embed/analytics
+type EmbedAnalyticsResponse struct {
+	MediaID string    `json:"media_id"`
+	Since   time.Time `json:"since"`
+	EmbedCounts
+	PerDay    []EmbedDailyCount       `json:"per_day"`   // Oldest day first, days without events left out
+	Referrers []EmbedSourceCount      `json:"referrers"` // Pages the link was opened from, most used first
+	Countries []EmbedSourceCount      `json:"countries"` // Viewers' countries, most common first
+	Recent    []models.EmbedLinkEvent `json:"recent"`    // Latest events first
+}
+
+// FeedLinksRequest is the body of POST /feeds
+type FeedLinksRequest struct {
+	FolderID string `json:"folder_id"` // The folder's own media, without subfolders; empty for all media
+}
+
+// FeedLinksResponse holds signed links to a feed of recent uploads
+type FeedLinksResponse struct {
+	RSSURL    string    `json:"rss_url"`
+	AtomURL   string    `json:"atom_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ProxyLinkRequest is the body of POST /proxy/links
+type ProxyLinkRequest struct {
+	URL     string            `json:"url" binding:"required"` // Remote image on an allowed host
+	Options map[string]string `json:"options"`                // Transformation query parameters, such as {"width": "300"}
+}
+
+// ProxyLinkResponse holds a signed link to a transformed remote image
+type ProxyLinkResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FolderItem is the public part of a folder
+type FolderItem struct {
+	ID              uint      `json:"id"`
+	Name            string    `json:"name"`
+	Slug            string    `json:"slug"` // URL-safe name, unique among its siblings, for GET /folders/by-path
+	Description     string    `json:"description"`
+	ParentID        *uint     `json:"parent_id"`
+	UserID          uint      `json:"user_id"`
+	MediaCount      int64     `json:"media_count"`
+	TotalMediaCount *int64    `json:"total_media_count,omitempty"` // Also counts the media of subfolders, with include_subfolders
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Pagination describes the page of a list response
+type Pagination struct {
+	CurrentPage int   `json:"current_page"`
+	TotalPages  int64 `json:"total_pages"`
+	TotalItems  int64 `json:"total_items"`
+	PerPage     int   `json:"per_page"`
+}
+
+// MediaListResponse is returned by GET /media/list
+type MediaListResponse struct {
+	Media      []MediaItem `json:"media"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// FolderRef names the folder a media item is in
+type FolderRef struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// MediaResponse wraps a single media item
+type MediaResponse struct {
+	Message  string     `json:"message,omitempty"`
+	Skipped  bool       `json:"skipped,omitempty"`  // Conflict policy skip kept the existing item
+	Replaced bool       `json:"replaced,omitempty"` // Conflict policy replace overwrote the existing item
+	Media    MediaItem  `json:"media"`
+	Folder   *FolderRef `json:"folder,omitempty"`
+	// How often the current user accessed the item, on GET /media/:id with access tracking on
+	Access *models.MediaAccess `json:"access,omitempty"`
+}
+
+// MediaWorkflowResponse is returned by GET and POST /media/:id/workflow
+type MediaWorkflowResponse struct {
+	MediaID     string                      `json:"media_id"`
+	Status      string                      `json:"status"`
+	Allowed     []string                    `json:"allowed"`     // Statuses the media may move to; approving and rejecting is up to admins
+	Transitions []models.WorkflowTransition `json:"transitions"` // Newest first
+}
+
+// RecentMediaItem is a media item with how often the current user accessed it
+type RecentMediaItem struct {
+	Media  MediaItem          `json:"media"`
+	Access models.MediaAccess `json:"access"`
+}
+
+// RecentMediaResponse is returned by GET /media/recent
+type RecentMediaResponse struct {
+	Media []RecentMediaItem `json:"media"`
+}
+
+// PresignUploadResponse is returned by POST /media/uploads/presign. Files above the
+// multipart threshold get a Session instead of an UploadToken and Upload. Skip policy
+// conflicts answer with a MediaResponse instead.
+type PresignUploadResponse struct {
+	UploadToken string                   `json:"upload_token,omitempty"` // Passed to POST /media/uploads/complete once the upload finished
+	Upload      *storage.PresignedUpload `json:"upload,omitempty"`
+	Session     *models.UploadSession    `json:"session,omitempty"` // Multipart upload to request part URLs for
+	ExpiresAt   time.Time                `json:"expires_at"`        // When the upload token or session stops being accepted
+}
+
+// ReplicationStatusResponse is returned by GET /admin/storage/replication
+type ReplicationStatusResponse struct {
+	Enabled bool                       `json:"enabled"`
+	Status  *storage.ReplicationStatus `json:"status,omitempty"`
+}
+
+// ConsistencyResponse is returned by GET /admin/consistency
+type ConsistencyResponse struct {
+	Report *ConsistencyReport `json:"report"` // Null until a check ran
+}
+
+// JobsResponse is returned by GET /admin/jobs
+type JobsResponse struct {
+	Enabled bool                  `json:"enabled"` // Jobs run on their schedule; otherwise only when started
+	Jobs    []scheduler.JobStatus `json:"jobs"`
+}
+
+// ConfigReloadResponse is returned by POST /admin/config/reload
+type ConfigReloadResponse struct {
+	Changed []string `json:"changed"` // Variables whose new values now apply
+}
+
+// UserStorage is the storage taken by one user's media
+type UserStorage struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Count    int64  `json:"count"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// DailyUploads counts the media uploaded on one day
+type DailyUploads struct {
+	Day     string `json:"day" example:"2026-10-15"`
+	Uploads int64  `json:"uploads"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// SlowTransform is a cached transform or thumbnail with how long it took to render
+type SlowTransform struct {
+	MediaID   string    `json:"media_id"`
+	CacheKey  string    `json:"cache_key"`
+	MimeType  string    `json:"mime_type"` // Of the original
+	Size      int64     `json:"size"`
+	RenderMs  int64     `json:"render_ms"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AdminStatsResponse is returned by GET /admin/stats
+type AdminStatsResponse struct {
+	Users             int64                 `json:"users"`
+	Media             int64                 `json:"media"`
+	Bytes             int64                 `json:"bytes"`
+	StorageByUser     []UserStorage         `json:"storage_by_user"` // Users storing the most first
+	UploadsPerDay     []DailyUploads        `json:"uploads_per_day"` // Oldest day first, days without uploads left out
+	TopMimeTypes      []MimeTypeUsage       `json:"top_mime_types"`
+	FailedJobs        []scheduler.JobStatus `json:"failed_jobs"`    // Background jobs with failed runs
+	FailedBatches     []models.ImportJob    `json:"failed_batches"` // Recent imports and batch transforms with failed items
+	SlowestTransforms []SlowTransform       `json:"slowest_transforms"`
+	TransformPool     TransformPoolStats    `json:"transform_pool"`
+}
+
+// TransformPoolStats is the load of the workers rendering transforms on request
+type TransformPoolStats struct {
+	Workers int   `json:"workers"`
+	Active  int64 `json:"active"`  // Transforms rendering now
+	Queued  int   `json:"queued"`  // Transforms waiting for a worker
+	Queue   int   `json:"queue"`   // Transforms that may wait
+	Refused int64 `json:"refused"` // Requests refused with 503 by a full queue since startup
+	Expired int64 `json:"expired"` // Requests that gave up waiting, with 503, since startup
+}
+
+// ArchiveJobResponse is returned by POST /export/zip with async and GET /export/archives/:id
+type ArchiveJobResponse struct {
+	Job ArchiveJob `json:"job"`
+}
+
+// UploadSessionResponse is returned by GET /media/uploads/:id
+type UploadSessionResponse struct {
+	Session models.UploadSession `json:"session"`
+}
+
+// UploadPartURL is a presigned request storing one part of a multipart upload
+type UploadPartURL struct {
+	PartNumber int32 `json:"part_number"`
+	storage.PresignedUpload
+}
+
+// UploadPartsResponse is returned by POST /media/uploads/{id}/parts
+type UploadPartsResponse struct {
+	Parts []UploadPartURL `json:"parts"`
+}
+
+// FolderListResponse is returned by GET /folders
+type FolderListResponse struct {
+	Folders    []FolderItem `json:"folders"`
+	Pagination Pagination   `json:"pagination"`
+}
+
+// LifecycleRulesResponse is returned by GET /folders/:id/lifecycle
+type LifecycleRulesResponse struct {
+	Rules []models.LifecycleRule `json:"rules"`
+}
+
+// LifecycleActionsResponse is returned by GET /folders/:id/lifecycle/actions
+type LifecycleActionsResponse struct {
+	Actions    []models.LifecycleAction `json:"actions"`
+	Pagination Pagination               `json:"pagination"`
+}
+
+// GroupItem is a group with the role of the current user in it
+type GroupItem struct {
+	models.Group
+	Role        string `json:"role,omitempty"` // member or manager, empty when not a member
+	MemberCount int64  `json:"member_count"`
+}
+
+// GroupMemberItem is a member of a group
+type GroupMemberItem struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	AddedBy   uint      `json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupsResponse is returned by GET /groups
+type GroupsResponse struct {
+	Groups []GroupItem `json:"groups"`
+}
+
+// GroupResponse is returned by the group endpoints
+type GroupResponse struct {
+	Group   GroupItem         `json:"group"`
+	Members []GroupMemberItem `json:"members"`
+}
+
+// AddGroupMembersResponse is returned by POST /groups/:id/members
+type AddGroupMembersResponse struct {
+	Added    []uint            `json:"added"`     // IDs of the users added
+	NotFound []string          `json:"not_found"` // User IDs and usernames matching no user
+	Members  []GroupMemberItem `json:"members"`
+}
+
+// DrivesResponse is returned by GET /drives
+type DrivesResponse struct {
+	Providers []string                      `json:"providers"` // Drives that can be connected
+	Drives    []models.CloudDriveConnection `json:"drives"`
+}
+
+// ConnectDriveResponse is returned by POST /drives/connect/:provider
+type ConnectDriveResponse struct {
+	AuthorizeURL string    `json:"authorize_url"` // Send the user here to grant access
+	State        string    `json:"state"`
+	ExpiresAt    time.Time `json:"expires_at"` // Connecting must be completed by then
+}
+
+// DriveResponse is returned by POST /drives/connect/:provider/complete
+type DriveResponse struct {
+	Drive models.CloudDriveConnection `json:"drive"`
+}
+
+// DriveFilesResponse is returned by GET /drives/:id/files
+type DriveFilesResponse struct {
+	Files  []clouddrive.File `json:"files"`
+	Cursor string            `json:"cursor,omitempty"` // Pass as cursor for the next page; empty after the last one
+}
+
+// WidgetTokenResponse is returned by POST /widget-tokens
+type WidgetTokenResponse struct {
+	WidgetToken models.WidgetToken `json:"widget_token"`
+	Token       string             `json:"token"`      // Only returned here; send it as a bearer token or ?token=
+	UploadURL   string             `json:"upload_url"` // Where the widget posts files
+}
+
+// WidgetTokensResponse is returned by GET /widget-tokens
+type WidgetTokensResponse struct {
+	WidgetTokens []models.WidgetToken `json:"widget_tokens"`
+}
+
+// SetMediaRetentionRequest is the body of PUT /media/:id/retention
+type SetMediaRetentionRequest struct {
+	LegalHold   *bool   `json:"legal_hold"`                        // Place or, for admins, release a legal hold
+	RetainUntil *string `json:"retain_until" example:"2033-12-31"` // RFC 3339 time or YYYY-MM-DD date retained through; empty clears it
+	Reason      string  `json:"reason" binding:"max=1000"`         // Required for admin overrides
+}
+
+// MediaRetentionResponse is returned by GET and PUT /media/:id/retention
+type MediaRetentionResponse struct {
+	MediaID     string                  `json:"media_id"`
+	LegalHold   bool                    `json:"legal_hold"`
+	RetainUntil *time.Time              `json:"retain_until"`
+	Retained    bool                    `json:"retained"` // The media can't be deleted or replaced
+	Events      []models.RetentionEvent `json:"events"`
+}
+
+// RetentionEventsResponse is returned by GET /admin/retention/events
+type RetentionEventsResponse struct {
+	Events     []models.RetentionEvent `json:"events"`
+	Pagination Pagination              `json:"pagination"`
+}
+
+// ExpiringLicensesResponse is returned by GET /media/licenses/expiring
+type ExpiringLicensesResponse struct {
+	Until      string      `json:"until" example:"2026-11-14"` // Last day covered
+	Media      []MediaItem `json:"media"`
+	Pagination Pagination  `json:"pagination"`
+}
+
+// MetadataFieldsResponse is returned by GET /metadata-fields
+type MetadataFieldsResponse struct {
+	Fields []models.MetadataField `json:"fields"`
+}
+
+// OwnershipTransfersResponse is returned by GET /admin/transfers
+type OwnershipTransfersResponse struct {
+	Transfers  []models.OwnershipTransfer `json:"transfers"`
+	Pagination Pagination                 `json:"pagination"`
+}
+
+// BatchResult reports the outcome for one item of a bulk request
+type BatchResult struct {
+	URL      string `json:"url,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	MediaID  string `json:"media_id,omitempty"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BulkResponse is returned by bulk file uploads
+type BulkResponse struct {
+	Message      string        `json:"message"`
+	Total        int           `json:"total"`
+	SuccessCount int           `json:"success_count"`
+	Results      []BatchResult `json:"results"`
+}
+
+// BatchOperationResponse is returned by POST /media/batch/operation
+type BatchOperationResponse struct {
+	Message     string            `json:"message"`
+	Operation   string            `json:"operation"`
+	AffectedIDs []string          `json:"affected_ids"`
+	Results     []BatchResult     `json:"results,omitempty"` // Per requested ID, all operations but move
+	Copies      map[string]string `json:"copies,omitempty"`  // Copy ID by source ID
+	Tags        []string          `json:"tags,omitempty"`    // Tags added or removed
+	PurgeJob    *storage.PurgeJob `json:"purge_job,omitempty"`
+}
+
+// PurgeJobResponse wraps a purge job
+type PurgeJobResponse struct {
+	Job storage.PurgeJob `json:"job"`
+}
+
+// DerivativePurgeResponse is returned by DELETE /media/:id/derivatives
+type DerivativePurgeResponse struct {
+	Removed  int              `json:"removed"`
+	PurgeJob storage.PurgeJob `json:"purge_job"`
+}
+
+// DerivativeStatsResponse is returned by GET /storage/derivatives/stats
+type DerivativeStatsResponse struct {
+	Entries   int64  `json:"entries"`
+	TotalSize int64  `json:"total_size"`
+	MaxSize   int64  `json:"max_size"`
+	TTL       string `json:"ttl"`
+	Hits      int64  `json:"hits"`
+	Misses    int64  `json:"misses"`
+	Evictions int64  `json:"evictions"`
+}
+
+// CacheStatsResponse is returned by GET /storage/cache/stats
+type CacheStatsResponse struct {
+	Enabled bool               `json:"enabled"`
+	Stats   storage.CacheStats `json:"stats"`
+}
+
+// StorageBackendsResponse is returned by GET /admin/storage/backends
+type StorageBackendsResponse struct {
+	Backends []storage.BackendHealth `json:"backends"`
+	Override string                  `json:"override"`
+}
+
+// UploadBackendResponse is returned by PUT /admin/storage/upload-backend
+type UploadBackendResponse struct {
+	Message  string `json:"message"`
+	Override string `json:"override"`
+}
+
+// MimeTypeUsage is the storage taken by one MIME type
+type MimeTypeUsage struct {
+	MimeType string `json:"mime_type"`
+	Count    int64  `json:"count"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// StorageUsageResponse is returned by GET /account/usage
+type StorageUsageResponse struct {
+	Used       int64           `json:"used"`
+	Quota      int64           `json:"quota"`     // 0 is unlimited
+	Remaining  *int64          `json:"remaining"` // null when unlimited
+	ByMimeType []MimeTypeUsage `json:"by_mime_type"`
+}
+
+// PublicDomainRequest is the body of PUT /account/domain
+type PublicDomainRequest struct {
+	PublicDomain *string `json:"public_domain" example:"media.example.com"` // null for the backend's public URL
+}
+
+// PublicDomainResponse is the custom domain of the current user
+type PublicDomainResponse struct {
+	PublicDomain *string `json:"public_domain"`
+	Target       string  `json:"target,omitempty"` // What the domain must be a CNAME of
+}
+
+// FolderUsage is the storage taken by the media directly in one folder
+type FolderUsage struct {
+	FolderID *uint  `json:"folder_id"` // null for media outside folders
+	Name     string `json:"name,omitempty"`
+	Count    int64  `json:"count"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// MonthlyUsage is the storage taken by the media uploaded in one month
+type MonthlyUsage struct {
+	Month string `json:"month" example:"2026-10"`
+	Count int64  `json:"count"`
+	Bytes int64  `json:"bytes"`
+}
+
+// MediaStatsResponse is returned by GET /media/stats
+type MediaStatsResponse struct {
+	Count      int64           `json:"count"`
+	Bytes      int64           `json:"bytes"`
+	ByMimeType []MimeTypeUsage `json:"by_mime_type"`
+	ByFolder   []FolderUsage   `json:"by_folder"`
+	ByMonth    []MonthlyUsage  `json:"by_month"` // Oldest month first
+}
+
+// UserQuotaResponse is returned by PUT /admin/users/:id/quota
+type UserQuotaResponse struct {
+	Message  string `json:"message"`
+	UserID   uint   `json:"user_id"`
+	Override *int64 `json:"override"` // null when the default applies
+	Quota    int64  `json:"quota"`    // Quota in effect, 0 is unlimited
+}
+
+// ImportJobListResponse is returned by GET /media/imports
+type ImportJobListResponse struct {
+	Jobs []models.ImportJob `json:"jobs"`
+}
+
+// ImportJobResponse is returned by GET /media/imports/:id
+type ImportJobResponse struct {
+	Job models.ImportJob `json:"job"`
+}
+
+// BatchAcceptedResponse acknowledges a batch job started in the background
+type BatchAcceptedResponse struct {
+	Message   string `json:"message"`
+	BatchID   uint   `json:"batch_id"`
+	Kind      string `json:"kind"` // url_import, transform, manifest or cloud_drive
+	Status    string `json:"status"`
+	Total     int    `json:"total"`
+	StatusURL string `json:"status_url"` // GET for the job with every item
+	EventsURL string `json:"events_url"` // Websocket streaming BatchEvent messages
+}
+
+// BatchProgress summarizes a batch job
+type BatchProgress struct {
+	ID        uint   `json:"id"`
+	Kind      string `json:"kind"`
+	Status    string `json:"status"`
+	Total     int    `json:"total"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+}
+
+// BatchEvent is a websocket message of GET /batches/:id/events
+type BatchEvent struct {
+	Type  string                `json:"type"` // snapshot, progress or completed
+	Batch BatchProgress         `json:"batch"`
+	Item  *models.ImportJobItem `json:"item,omitempty"` // The item that just finished, progress only
+}
+
+// BatchListResponse is returned by GET /batches
+type BatchListResponse struct {
+	Batches []models.ImportJob `json:"batches"`
+}
+
+// BatchResponse is returned by GET /batches/:id
+type BatchResponse struct {
+	Batch models.ImportJob `json:"batch"`
+}
+
+// ThumbnailLink is one entry of a thumbnails response
+type ThumbnailLink struct {
+	ID    string `json:"id"`
+	URL   string `json:"url,omitempty"`
+	Data  string `json:"data,omitempty"` // Data URI when inline was requested
+	Error string `json:"error,omitempty"`
+}
+
+// ThumbnailsResponse is returned by POST /media/thumbs
+type ThumbnailsResponse struct {
+	Size       int             `json:"size"`
+	Expires    int64           `json:"expires"`
+	Thumbnails []ThumbnailLink `json:"thumbnails"`
+}
+
+// Status of the tag suggestions of a media item
+const (
+	SuggestionsPending = "pending"
+	SuggestionsDone    = "done"
+	SuggestionsFailed  = "failed"
+)
+
+// Status of a single suggestion
+const (
+	SuggestionSuggested = "suggested"
+	SuggestionAccepted  = "accepted"
+	SuggestionRejected  = "rejected"
+)
+
+// TagSuggestions are the tags and objects a classifier found in an image, kept in the
+// media metadata under "suggestions"
+type TagSuggestions struct {
+	Status       string          `json:"status"` // pending, done or failed
+	Classifier   string          `json:"classifier"`
+	ClassifiedAt *time.Time      `json:"classified_at,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Tags         []TagSuggestion `json:"tags"`
+	Objects      []TagSuggestion `json:"objects"` // Every object found, several may share a name
+}
+
+// TagSuggestion is one suggested tag or object label
+type TagSuggestion struct {
+	Name       string       `json:"name"`
+	Confidence float64      `json:"confidence"`    // 0-1
+	Box        *tagging.Box `json:"box,omitempty"` // Where an object was found, relative to the image size
+	Status     string       `json:"status"`        // suggested, accepted or rejected
+}
+
+// SuggestionsResponse is returned by GET and POST /media/:id/suggestions
+type SuggestionsResponse struct {
+	Suggestions *TagSuggestions `json:"suggestions"` // null until the media is classified
+}
+
+// ReviewSuggestionsRequest is the body of POST /media/:id/suggestions/review. Names
+// apply to the tag and the objects of that name.
+type ReviewSuggestionsRequest struct {
+	Accept []string `json:"accept"` // Added to the media tags
+	Reject []string `json:"reject"` // Removed from the tags again when accepted before
+}
+
+// ReviewSuggestionsResponse is returned by POST /media/:id/suggestions/review
+type ReviewSuggestionsResponse struct {
+	Suggestions *TagSuggestions `json:"suggestions"`
+	Media       MediaItem       `json:"media"`
+}
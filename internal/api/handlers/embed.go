@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/utils"
+)
+
+// oEmbed types media are embedded as
+const (
+	embedPhoto = "photo"
+	embedVideo = "video"
+	embedRich  = "rich" // Audio, played in the embed page
+	embedLink  = "link" // Anything else, linked to
+)
+
+const (
+	// Players of media without known dimensions, and of audio
+	defaultEmbedWidth  = 640
+	defaultEmbedHeight = 360
+	audioEmbedHeight   = 60
+)
+
+// embedPathPattern matches the path of embed pages, capturing the media ID
+var embedPathPattern = regexp.MustCompile(`^/api/v1/media/([^/]+)/embed$`)
+
+// embedPage renders the embed page of a media item. Unfurlers read its Open Graph tags
+// and discover the oEmbed answer through the alternate link; iframes show the body.
+var embedPage = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:site_name" content="{{.ProviderName}}">
+<meta property="og:url" content="{{.EmbedURL}}">
+{{- if eq .Type "video"}}
+<meta property="og:type" content="video.other">
+<meta property="og:video" content="{{.MediaURL}}">
+<meta property="og:video:type" content="{{.MimeType}}">
+{{- else}}
+<meta property="og:type" content="website">
+{{- end}}
+{{- if .ImageURL}}
+<meta property="og:image" content="{{.ImageURL}}">
+<meta name="twitter:card" content="summary_large_image">
+{{- else}}
+<meta name="twitter:card" content="summary">
+{{- end}}
+<link rel="alternate" type="application/json+oembed" href="{{.OEmbedURL}}" title="{{.Title}}">
+<style>html,body{margin:0;height:100%}img,video{display:block;width:100%;height:100%;object-fit:contain;background:#000}audio{display:block;width:100%}</style>
+</head>
+<body>
+{{- if eq .Type "photo"}}
+<img src="{{.MediaURL}}" alt="{{.Title}}">
+{{- else if eq .Type "video"}}
+<video src="{{.MediaURL}}" controls playsinline preload="metadata"></video>
+{{- else if eq .Type "rich"}}
+<audio src="{{.MediaURL}}" controls preload="metadata"></audio>
+{{- else}}
+<a href="{{.MediaURL}}" target="_blank" rel="noopener">{{.Title}}</a>
+{{- end}}
+</body>
+</html>
+`))
+
+// embedPageData fills embedPage
+type embedPageData struct {
+	Type         string
+	Title        string
+	MimeType     string
+	ProviderName string
+	EmbedURL     string
+	OEmbedURL    string
+	MediaURL     string
+	ImageURL     string // Preview image, if any
+}
+
+// publicBaseURL returns the public URL of the API for links used outside it, like embed
+// and feed links: EMBED_BASE_URL, or the scheme and host the request was sent to
+func publicBaseURL(c *gin.Context) string {
+	if base := config.GetConfig().Embed.BaseURL; base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// embedExpiry rounds the expiry of embed links up to the next day, so a media item
+// hands out the same link all day
+func embedExpiry(now time.Time) int64 {
+	return now.Add(config.GetConfig().Embed.URLExpiration).Truncate(24 * time.Hour).Add(24 * time.Hour).Unix()
+}
+
+// signEmbed signs the embed page of a media item until expires
+func signEmbed(secret, id, expires string) string {
+	return utils.SignParams(secret, "embed", id, expires)
+}
+
+// verifyEmbedSignature checks the expiry and token of an embed link
+func verifyEmbedSignature(id, expires, token string) bool {
+	at, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > at {
+		return false
+	}
+	cfg := config.GetConfig()
+	return utils.VerifyParams(cfg.JWT.Secret, token, "embed", id, expires)
+}
+
+// VerifyEmbedToken validates the signature of an embed page request
+func VerifyEmbedToken(c *gin.Context) bool {
+	return verifyEmbedSignature(c.Param("id"), c.Query("expires"), c.Query("token"))
+}
+
+// signedEmbedURL builds the absolute embed page URL of media that can be shared and
+// fetched without an Authorization header. Replacing the content keeps the link working.
+func signedEmbedURL(base, secret string, media *models.Media, expires int64) string {
+	expiresStr := strconv.FormatInt(expires, 10)
+	query := url.Values{}
+	query.Set("expires", expiresStr)
+	query.Set("token", signEmbed(secret, media.ID, expiresStr))
+	return fmt.Sprintf("%s/api/v1/media/%s/embed?%s", base, url.PathEscape(media.ID), query.Encode())
+}
+
+// oEmbedURL returns the oEmbed URL describing an embed page
+func oEmbedURL(base, embedURL string) string {
+	return base + "/api/v1/oembed?" + url.Values{"url": {embedURL}}.Encode()
+}
+
+// loadEmbedMedia reads the media an embed page or oEmbed answer describes. Without a
+// signature, only the user's own media can be embedded; with one, only published media
+// whose license hasn't expired.
+func loadEmbedMedia(c *gin.Context, id string, signed bool) (*models.Media, bool) {
+	query := database.GetDB().
+		Select("id", "user_id", "filename", "path", "storage_backend", "mime_type", "size", "metadata", "updated_at").
+		Where("id = ?", id)
+	if signed {
+		query = publiclyShared(query)
+	} else {
+		userID, _ := c.Get("user_id")
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var media models.Media
+	if err := query.First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return nil, false
+	}
+	return &media, true
+}
+
+// embedType returns the oEmbed type media are embedded as
+func embedType(media *models.Media) string {
+	switch {
+	case strings.HasPrefix(media.MimeType, "image/"):
+		return embedPhoto
+	case strings.HasPrefix(media.MimeType, "video/"):
+		return embedVideo
+	case strings.HasPrefix(media.MimeType, "audio/"):
+		return embedRich
+	default:
+		return embedLink
+	}
+}
+
+// embedSize returns the size media are embedded at, scaled down to fit maxWidth and
+// maxHeight where they are positive
+func embedSize(media *models.Media, kind string, maxWidth, maxHeight int) (int, int) {
+	width, height := defaultEmbedWidth, defaultEmbedHeight
+	if kind == embedRich {
+		height = audioEmbedHeight
+	} else {
+		var metadata struct {
+			Technical struct {
+				Dimensions *utils.Dimensions `json:"dimensions"`
+			} `json:"technical"`
+		}
+		if json.Unmarshal(media.Metadata, &metadata) == nil {
+			if d := metadata.Technical.Dimensions; d != nil && d.Width > 0 && d.Height > 0 {
+				width, height = d.Width, d.Height
+			}
+		}
+	}
+
+	// Audio players stretch, only their width is scaled
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if kind != embedRich && maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+	if kind == embedRich {
+		return max(1, int(float64(width)*scale)), height
+	}
+	return max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+}
+
+// GetMediaEmbed godoc
+// @Summary      Get the embed page of a media item
+// @Description  HTML page showing an image, video or audio player, or a link to other files, with Open Graph tags and oEmbed discovery so shared links unfurl. Signed embed links come from GET /media/{id} as embed_url.
+// @Tags         media
+// @Produce      html
+// @Param        id       path      string  true   "Media ID"
+// @Param        expires  query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token    query     string  false  "Signed URL token"
+// @Success      200      {string}  string  "HTML page"
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Router       /media/{id}/embed [get]
+// @Security     BearerAuth
+func GetMediaEmbed(c *gin.Context) {
+	media, ok := loadEmbedMedia(c, c.Param("id"), c.GetBool("signed_access"))
+	if !ok {
+		return
+	}
+
+	cfg := config.GetConfig()
+	base := publicBaseURL(c)
+	expires := embedExpiry(time.Now())
+	// Pages opened with a signed link describe that link, so unfurlers see the URL shared
+	embedURL := signedEmbedURL(base, cfg.JWT.Secret, media, expires)
+	if c.GetBool("signed_access") {
+		embedURL = base + c.Request.URL.RequestURI()
+		expires, _ = strconv.ParseInt(c.Query("expires"), 10, 64)
+	}
+
+	urls := newMediaURLBuilder()
+	data := embedPageData{
+		Type:         embedType(media),
+		Title:        media.Filename,
+		MimeType:     media.MimeType,
+		ProviderName: cfg.Embed.ProviderName,
+		EmbedURL:     embedURL,
+		OEmbedURL:    oEmbedURL(base, embedURL),
+		MediaURL:     urls.url(media),
+	}
+	if data.Type == embedPhoto {
+		data.ImageURL = data.MediaURL
+	} else if thumbnailSupported(media) {
+		data.ImageURL = base + signedThumbnailURL(cfg.JWT.Secret, media, defaultThumbnailSize, expires)
+	}
+	if data.Type == embedLink {
+		// Other files are downloaded through the API, so downloads count in the link's analytics
+		data.MediaURL = signedEmbedDownloadURL(base, cfg.JWT.Secret, media, expires)
+	}
+
+	var page bytes.Buffer
+	if err := embedPage.Execute(&page, data); err != nil {
+		c.Error(apierror.Internal("Failed to render embed page", err))
+		return
+	}
+	recordEmbedEvent(c, media, models.AccessView)
+	if cfg.Access.Tracking && c.GetBool("signed_access") {
+		// Every view has to reach the API to be counted
+		c.Header("Cache-Control", "public, no-cache")
+	} else {
+		c.Header("Cache-Control", "public, max-age=3600")
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// OEmbed godoc
+// @Summary      Describe a shared media link with oEmbed
+// @Description  oEmbed (https://oembed.com) answer for a signed embed link: a photo with its URL, a video or audio player as an iframe of the embed page, or a link for other files. Only the json format is supported.
+// @Tags         media
+// @Produce      json
+// @Param        url        query     string  true   "Signed embed link"
+// @Param        maxwidth   query     int     false  "Largest width of the embedded media"
+// @Param        maxheight  query     int     false  "Largest height of the embedded media"
+// @Param        format     query     string  false  "Response format, only json"
+// @Success      200        {object}  handlers.OEmbedResponse
+// @Failure      400        {object}  object{error=string}
+// @Failure      401        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      501        {object}  object{error=string}
+// @Router       /oembed [get]
+func OEmbed(c *gin.Context) {
+	if format := c.DefaultQuery("format", "json"); format != "json" {
+		c.Error(apierror.New(http.StatusNotImplemented, "Only the json format is supported"))
+		return
+	}
+
+	var bounds [2]int
+	for i, param := range []string{"maxwidth", "maxheight"} {
+		if value := c.Query(param); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				c.Error(apierror.InvalidField(param, "must be a positive integer"))
+				return
+			}
+			bounds[i] = n
+		}
+	}
+
+	target, err := url.Parse(c.Query("url"))
+	if err != nil {
+		c.Error(apierror.NotFound("No embeddable media at this URL"))
+		return
+	}
+	match := embedPathPattern.FindStringSubmatch(target.EscapedPath())
+	if match == nil {
+		c.Error(apierror.NotFound("No embeddable media at this URL"))
+		return
+	}
+	id, err := url.PathUnescape(match[1])
+	if err != nil {
+		c.Error(apierror.NotFound("No embeddable media at this URL"))
+		return
+	}
+	query := target.Query()
+	if !verifyEmbedSignature(id, query.Get("expires"), query.Get("token")) {
+		c.Error(apierror.New(http.StatusUnauthorized, "The link is not signed or has expired"))
+		return
+	}
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+
+	media, ok := loadEmbedMedia(c, id, true)
+	if !ok {
+		return
+	}
+
+	cfg := config.GetConfig()
+	base := publicBaseURL(c)
+	response := OEmbedResponse{
+		Type:         embedType(media),
+		Version:      "1.0",
+		Title:        media.Filename,
+		ProviderName: cfg.Embed.ProviderName,
+		ProviderURL:  base,
+	}
+	switch response.Type {
+	case embedPhoto:
+		response.URL = newMediaURLBuilder().url(media)
+		response.Width, response.Height = embedSize(media, response.Type, bounds[0], bounds[1])
+	case embedVideo, embedRich:
+		response.Width, response.Height = embedSize(media, response.Type, bounds[0], bounds[1])
+		response.HTML = fmt.Sprintf(`<iframe src="%s" width="%d" height="%d" frameborder="0" allow="autoplay; fullscreen" allowfullscreen title="%s"></iframe>`,
+			html.EscapeString(target.String()), response.Width, response.Height, html.EscapeString(media.Filename))
+	}
+	if thumbnailSupported(media) {
+		response.ThumbnailURL = base + signedThumbnailURL(cfg.JWT.Secret, media, defaultThumbnailSize, expires)
+		response.ThumbnailWidth, response.ThumbnailHeight = defaultThumbnailSize, defaultThumbnailSize
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+const (
+	// maxEmbedStatsDays caps the days embed link analytics cover
+	maxEmbedStatsDays = 365
+	// embedStatsRanking is the number of referrers and countries listed
+	embedStatsRanking = 20
+	// recentEmbedEvents is the number of latest events listed
+	recentEmbedEvents = 50
+	// maxReferrerLength bounds the stored referrer
+	maxReferrerLength = 512
+)
+
+// signedEmbedDownloadURL builds the link downloading the original of media with the
+// signature of its embed link, counted in the link's analytics
+func signedEmbedDownloadURL(base, secret string, media *models.Media, expires int64) string {
+	expiresStr := strconv.FormatInt(expires, 10)
+	query := url.Values{}
+	query.Set("expires", expiresStr)
+	query.Set("token", signEmbed(secret, media.ID, expiresStr))
+	return fmt.Sprintf("%s/api/v1/media/%s/embed/download?%s", base, url.PathEscape(media.ID), query.Encode())
+}
+
+// recordEmbedEvent records a view or download through a signed embed link. Requests of the
+// owner, authenticated with their token, aren't counted.
+func recordEmbedEvent(c *gin.Context, media *models.Media, kind string) {
+	if !config.GetConfig().Access.Tracking || !c.GetBool("signed_access") {
+		return
+	}
+
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	event := models.EmbedLinkEvent{
+		MediaID:     media.ID,
+		UserID:      media.UserID,
+		Kind:        kind,
+		LinkExpires: expires,
+		Referrer:    embedReferrer(c.GetHeader("Referer")),
+		Country:     viewerCountry(c),
+	}
+	if err := database.GetDB().Create(&event).Error; err != nil {
+		log.Printf("Failed to record embed link %s of media %s: %v", kind, media.ID, err)
+	}
+}
+
+// embedReferrer reduces a Referer header to its scheme, host and path, leaving out query
+// strings that may identify the viewer
+func embedReferrer(referer string) string {
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	referrer := u.Scheme + "://" + u.Host + u.EscapedPath()
+	if len(referrer) > maxReferrerLength {
+		referrer = referrer[:maxReferrerLength]
+	}
+	return referrer
+}
+
+// viewerCountry reads the viewer's country from the first EMBED_GEO_HEADERS header set
+// to a two-letter code. CDNs mark unknown countries with XX, and Tor with T1.
+func viewerCountry(c *gin.Context) string {
+	for _, header := range config.GetConfig().Embed.GeoHeaders {
+		country := strings.ToUpper(strings.TrimSpace(c.GetHeader(header)))
+		if len(country) == 2 && country[0] >= 'A' && country[0] <= 'Z' &&
+			country[1] >= 'A' && country[1] <= 'Z' && country != "XX" {
+			return country
+		}
+	}
+	return ""
+}
+
+// DownloadEmbedMedia godoc
+// @Summary      Download a shared media item
+// @Description  Stream the original of a media item as an attachment with the signature of its embed link, counted as a download in the link's analytics. Embed pages of files that aren't images, video or audio link here.
+// @Tags         media
+// @Produce      application/octet-stream
+// @Param        id       path      string  true   "Media ID"
+// @Param        expires  query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token    query     string  false  "Signed URL token"
+// @Param        Range    header    string  false  "Byte range, e.g. bytes=1048576-"
+// @Success      200      {file}    binary
+// @Success      206      {file}    binary
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Failure      416      {object}  object{error=string}
+// @Router       /media/{id}/embed/download [get]
+// @Security     BearerAuth
+func DownloadEmbedMedia(c *gin.Context) {
+	media, ok := loadEmbedMedia(c, c.Param("id"), c.GetBool("signed_access"))
+	if !ok {
+		return
+	}
+	sendDownload(c, media, func() {
+		if c.GetBool("signed_access") {
+			recordEmbedEvent(c, media, models.AccessDownload)
+		} else {
+			recordMediaAccess(media.UserID, media.ID, models.AccessDownload)
+		}
+	})
+}
+
+// GetEmbedAnalytics godoc
+// @Summary      Analytics of a media item's embed links
+// @Description  Views of the embed page and downloads through signed embed links of one of your media items: totals, per day, top referrers and countries, and the latest events. Your own visits with your token aren't counted.
+// @Tags         media
+// @Produce      json
+// @Param        id    path      string  true   "Media ID"
+// @Param        days  query     int     false  "Days to cover (default 30, at most 365)"
+// @Success      200   {object}  handlers.EmbedAnalyticsResponse
+// @Failure      400   {object}  object{error=string}
+// @Failure      404   {object}  object{error=string}
+// @Failure      500   {object}  object{error=string}
+// @Router       /media/{id}/embed/analytics [get]
+// @Security     BearerAuth
+func GetEmbedAnalytics(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > maxEmbedStatsDays {
+		c.Error(apierror.InvalidField("days", "days must be between 1 and 365"))
+		return
+	}
+
+	db := database.GetDB()
+	var media models.Media
+	if err := db.Select("id").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	stats := EmbedAnalyticsResponse{
+		MediaID:   media.ID,
+		Since:     since,
+		PerDay:    []EmbedDailyCount{},
+		Referrers: []EmbedSourceCount{},
+		Countries: []EmbedSourceCount{},
+		Recent:    []models.EmbedLinkEvent{},
+	}
+	counts := "COUNT(*) FILTER (WHERE kind = 'view') AS views, COUNT(*) FILTER (WHERE kind = 'download') AS downloads"
+	events := func() *gorm.DB {
+		return db.Model(&models.EmbedLinkEvent{}).Where("media_id = ? AND created_at >= ?", media.ID, since)
+	}
+
+	if err := events().Select(counts).Scan(&stats.EmbedCounts).Error; err != nil {
+		c.Error(apierror.Internal("Failed to compute embed link analytics", err))
+		return
+	}
+	if err := events().
+		Select("to_char(date_trunc('day', created_at), 'YYYY-MM-DD') AS day, " + counts).
+		Group("day").Order("day").
+		Scan(&stats.PerDay).Error; err != nil {
+		c.Error(apierror.Internal("Failed to compute embed link analytics", err))
+		return
+	}
+	for column, ranking := range map[string]*[]EmbedSourceCount{"referrer": &stats.Referrers, "country": &stats.Countries} {
+		if err := events().
+			Select(column + " AS value, " + counts).
+			Where(column + " <> ''").
+			Group(column).Order("COUNT(*) DESC, value").Limit(embedStatsRanking).
+			Scan(ranking).Error; err != nil {
+			c.Error(apierror.Internal("Failed to compute embed link analytics", err))
+			return
+		}
+	}
+	if err := events().Order("created_at DESC, id DESC").Limit(recentEmbedEvents).
+		Find(&stats.Recent).Error; err != nil {
+		c.Error(apierror.Internal("Failed to compute embed link analytics", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// removeExpiredEmbedEvents deletes embed link events older than EMBED_ANALYTICS_RETENTION
+func removeExpiredEmbedEvents() error {
+	retention := config.GetConfig().Embed.AnalyticsRetention
+	if retention <= 0 {
+		return nil
+	}
+	return database.GetDB().Where("created_at < ?", time.Now().Add(-retention)).
+		Delete(&models.EmbedLinkEvent{}).Error
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"log"
+
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/events"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/websocket"
+)
+
+// publishLibraryEvent sends a change to the owner's websocket connections and to the
+// event broker
+func publishLibraryEvent(userID uint, eventType websocket.NotificationType, mediaID string, data map[string]interface{}) {
+	websocket.GetManager().SendLibraryEvent(userID, eventType, mediaID, data)
+	events.Publish(string(eventType), userID, mediaID, data)
+}
+
+// notifyMediaCreated announces a new media item and queues it for tag suggestions
+func notifyMediaCreated(media *models.Media) {
+	publishLibraryEvent(media.UserID, websocket.MediaCreated, media.ID,
+		map[string]interface{}{"media": newMediaItem(media)})
+	if err := queueAutoTagging(media, false); err != nil {
+		log.Printf("Failed to queue media %s for tag suggestions: %v", media.ID, err)
+	}
+}
+
+// notifyMediaUpdated announces a changed media item
+func notifyMediaUpdated(media *models.Media) {
+	publishLibraryEvent(media.UserID, websocket.MediaUpdated, media.ID,
+		map[string]interface{}{"media": newMediaItem(media)})
+}
+
+// notifyMediaUpdatedByID reloads media changed in bulk and notifies each of them. The
+// reload is skipped when the user has no open client and no broker is configured.
+func notifyMediaUpdatedByID(userID uint, ids []string) {
+	if len(ids) == 0 || (!websocket.GetManager().HasClients(userID) && !events.Enabled()) {
+		return
+	}
+
+	var media []models.Media
+	if err := database.GetDB().Preload("Tags").Where("id IN ? AND user_id = ?", ids, userID).Find(&media).Error; err != nil {
+		log.Printf("Failed to load updated media for notifications: %v", err)
+		return
+	}
+	for i := range media {
+		notifyMediaUpdated(&media[i])
+	}
+}
+
+// notifyMediaDeleted announces deleted media items
+func notifyMediaDeleted(userID uint, ids ...string) {
+	for _, id := range ids {
+		publishLibraryEvent(userID, websocket.MediaDeleted, id,
+			map[string]interface{}{"media_id": id})
+	}
+}
+
+// notifyFolderCreated announces a new folder
+func notifyFolderCreated(folder *models.Folder) {
+	publishLibraryEvent(folder.UserID, websocket.FolderCreated, "",
+		map[string]interface{}{"folder": newFolderItem(folder)})
+}
+
+// notifyFolderUpdated announces a changed folder
+func notifyFolderUpdated(folder *models.Folder) {
+	publishLibraryEvent(folder.UserID, websocket.FolderUpdated, "",
+		map[string]interface{}{"folder": newFolderItem(folder)})
+}
+
+// notifyFolderDeleted announces a deleted folder
+func notifyFolderDeleted(userID uint, folderID string) {
+	publishLibraryEvent(userID, websocket.FolderDeleted, "",
+		map[string]interface{}{"folder_id": folderID})
+}
@@ -1,73 +1,395 @@
 package handlers
 
 import (
+	"bufio"
 	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
 	"fmt"
-	"net/http"
+	"log"
+	"strings"
+	"time"
 
+	"go-media-center-example/internal/api/apierror"
 	"go-media-center-example/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 
 	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/utils"
 )
 
-func ExportCSV(c *gin.Context) {
-	var media []models.Media
+const (
+	// exportBatchSize is how many media are read and written at a time
+	exportBatchSize = 500
+	// defaultCSVFields are the CSV and XLSX columns without fields=
+	defaultCSVFields = "id,filename,mime_type,size,created_at,updated_at"
+	// defaultXMLFields are the elements of XML items without fields=, every media field
+	defaultXMLFields = "id,user_id,folder_id,filename,mime_type,size,metadata,tags,broken,created_at,updated_at,url,thumbnail_url,blurhash"
+	// exportBufferSize buffers export output, so nothing is sent before the first batch was read
+	exportBufferSize = 64 << 10
+)
+
+// exportQuery reads the filters and fields= of an export request. Without fields the
+// selection is nil, meaning full media items.
+func exportQuery(c *gin.Context, defaultFields string) (*gorm.DB, *fieldSelection, bool) {
 	userID, _ := c.Get("user_id")
 
-	if err := database.GetDB().Where("user_id = ?", userID).Find(&media).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+	fields, err := parseMediaFields(c.DefaultQuery("fields", defaultFields))
+	if err != nil {
+		c.Error(apierror.InvalidField("fields", err.Error()))
+		return nil, nil, false
+	}
+
+	query, ok := filterMedia(c, database.GetDB().Model(&models.Media{}).Where("media.user_id = ?", userID))
+	if !ok {
+		return nil, nil, false
+	}
+	if fields != nil {
+		query = query.Select(fields.columns)
+	}
+	if fields == nil || fields.tags {
+		query = query.Preload("Tags")
+	}
+	return query, fields, true
+}
+
+// streamExport reads the media of query in batches and hands each to write, so exports
+// never hold the whole library. Failures before anything was written are reported as
+// errors; later ones can only cut the response short. It returns false on failure.
+func streamExport(c *gin.Context, query *gorm.DB, write func(batch []models.Media) error) bool {
+	var batch []models.Media
+	err := query.FindInBatches(&batch, exportBatchSize, func(_ *gorm.DB, _ int) error {
+		return write(batch)
+	}).Error
+	if err == nil {
+		return true
+	}
+	if !c.Writer.Written() {
+		// The error is answered as JSON, not as the export
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		c.Error(apierror.Internal("Failed to export media", err))
+		return false
+	}
+	log.Printf("Media export failed after the response started: %v", err)
+	return false
+}
+
+// csvValue formats a media field for a CSV cell
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *string:
+		if v == nil {
+			return ""
+		}
+		return *v
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case json.RawMessage:
+		return string(v)
+	case []TagItem:
+		names := make([]string, len(v))
+		for i, tag := range v {
+			names[i] = tag.Name
+		}
+		return strings.Join(names, ";")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// xlsxValue keeps numbers and booleans for typed spreadsheet cells and formats anything
+// else like a CSV cell
+func xlsxValue(value interface{}) interface{} {
+	switch value.(type) {
+	case int64, uint, bool:
+		return value
+	default:
+		return csvValue(value)
+	}
+}
+
+// ExportCSV godoc
+// @Summary      Export media as CSV
+// @Description  Export the current user's media as CSV, filtered like GET /media/list. fields picks the columns; tags are joined with semicolons.
+// @Tags         export
+// @Produce      text/csv
+// @Param        type       query     string     false  "File type filter"
+// @Param        search     query     string     false  "Search term"
+// @Param        folder_id  query     string     false  "Folder ID"
+// @Param        tags       query     []string   false  "Tags filter"
+// @Param        class      query     []string   false  "Content class filter (photo, screenshot, scan, graphic)"
+// @Param        color      query     []string   false  "Dominant color filter (red, orange, yellow, green, cyan, blue, purple, pink, brown, black, white, gray)"
+// @Param        from       query     string     false  "Created at or after (RFC 3339 time or YYYY-MM-DD)"
+// @Param        to         query     string     false  "Created before (RFC 3339 time, or YYYY-MM-DD including that day)"
+// @Param        workflow_status  query  []string  false  "Workflow status filter (draft, in_review, approved, rejected)"
+// @Param        meta             query  string    false  "Custom metadata filter, as meta[key]=value (a from..to range for number and date fields)"
+// @Param        license_type     query  []string  false  "License type filter"
+// @Param        rights_holder    query  string    false  "Rights holder search"
+// @Param        license_status   query  string    false  "License status filter (none, active, expired)"
+// @Param        fields     query     string     false  "Comma-separated columns (default id,filename,mime_type,size,created_at,updated_at)"
+// @Success      200        {file}    binary
+// @Failure      400        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Router       /export/csv [get]
+// @Security     BearerAuth
+func ExportCSV(c *gin.Context) {
+	query, fields, ok := exportQuery(c, defaultCSVFields)
+	if !ok {
 		return
 	}
 
 	c.Header("Content-Type", "text/csv")
 	c.Header("Content-Disposition", "attachment;filename=media_export.csv")
 
+	// The header row stays buffered until the first batch was read
 	writer := csv.NewWriter(c.Writer)
-	// Write header
-	if err := writer.Write([]string{"ID", "Filename", "MimeType", "Size", "Path", "Created At", "Updated At"}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write CSV header"})
+	writer.Write(fields.names)
+
+	renderer := newMediaFieldRenderer(fields)
+	row := make([]string, len(fields.names))
+	ok = streamExport(c, query, func(batch []models.Media) error {
+		for i := range batch {
+			for j, name := range fields.names {
+				row[j] = csvValue(mediaFields[name].value(renderer, &batch[i]))
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if ok {
+		writer.Flush()
+	}
+}
+
+// ExportJSON godoc
+// @Summary      Export media as JSON
+// @Description  Export the current user's media as a JSON array, filtered like GET /media/list. With fields, items carry only those fields.
+// @Tags         export
+// @Produce      json
+// @Param        type       query     string     false  "File type filter"
+// @Param        search     query     string     false  "Search term"
+// @Param        folder_id  query     string     false  "Folder ID"
+// @Param        tags       query     []string   false  "Tags filter"
+// @Param        class      query     []string   false  "Content class filter (photo, screenshot, scan, graphic)"
+// @Param        color      query     []string   false  "Dominant color filter (red, orange, yellow, green, cyan, blue, purple, pink, brown, black, white, gray)"
+// @Param        from       query     string     false  "Created at or after (RFC 3339 time or YYYY-MM-DD)"
+// @Param        to         query     string     false  "Created before (RFC 3339 time, or YYYY-MM-DD including that day)"
+// @Param        workflow_status  query  []string  false  "Workflow status filter (draft, in_review, approved, rejected)"
+// @Param        meta             query  string    false  "Custom metadata filter, as meta[key]=value (a from..to range for number and date fields)"
+// @Param        license_type     query  []string  false  "License type filter"
+// @Param        rights_holder    query  string    false  "Rights holder search"
+// @Param        license_status   query  string    false  "License status filter (none, active, expired)"
+// @Param        fields     query     string     false  "Comma-separated fields to return instead of full items"
+// @Success      200        {array}   handlers.MediaItem
+// @Failure      400        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Router       /export/json [get]
+// @Security     BearerAuth
+func ExportJSON(c *gin.Context) {
+	query, fields, ok := exportQuery(c, "")
+	if !ok {
 		return
 	}
 
-	// Write data
-	for _, m := range media {
-		if err := writer.Write([]string{
-			m.ID,
-			m.Filename,
-			m.MimeType,
-			fmt.Sprint(m.Size),
-			m.Path,
-			m.CreatedAt.String(),
-			m.UpdatedAt.String(),
-		}); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write CSV data"})
-			return
+	c.Header("Content-Type", "application/json")
+	c.Header("Content-Disposition", "attachment;filename=media_export.json")
+
+	urls := newMediaURLBuilder()
+	var renderer *mediaFieldRenderer
+	if fields != nil {
+		renderer = newMediaFieldRenderer(fields)
+	}
+
+	// The opening bracket waits for the first batch, so a failing query is still reported
+	separator := "["
+	ok = streamExport(c, query, func(batch []models.Media) error {
+		for i := range batch {
+			var item interface{} = urls.item(&batch[i])
+			if renderer != nil {
+				item = renderer.render(&batch[i])
+			}
+			data, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+			if _, err := c.Writer.WriteString(separator); err != nil {
+				return err
+			}
+			if _, err := c.Writer.Write(data); err != nil {
+				return err
+			}
+			separator = ","
 		}
+		return nil
+	})
+	if !ok {
+		return
 	}
+	if separator == "[" {
+		c.Writer.WriteString("[")
+	}
+	c.Writer.WriteString("]")
+}
 
-	writer.Flush()
+// ExportXML godoc
+// @Summary      Export media as XML
+// @Description  Export the current user's media as an XML document of item elements, filtered like GET /media/list. fields picks the elements, every media field by default; tags are nested tag elements.
+// @Tags         export
+// @Produce      xml
+// @Param        type       query     string     false  "File type filter"
+// @Param        search     query     string     false  "Search term"
+// @Param        folder_id  query     string     false  "Folder ID"
+// @Param        tags       query     []string   false  "Tags filter"
+// @Param        class      query     []string   false  "Content class filter (photo, screenshot, scan, graphic)"
+// @Param        color      query     []string   false  "Dominant color filter (red, orange, yellow, green, cyan, blue, purple, pink, brown, black, white, gray)"
+// @Param        from       query     string     false  "Created at or after (RFC 3339 time or YYYY-MM-DD)"
+// @Param        to         query     string     false  "Created before (RFC 3339 time, or YYYY-MM-DD including that day)"
+// @Param        workflow_status  query  []string  false  "Workflow status filter (draft, in_review, approved, rejected)"
+// @Param        meta             query  string    false  "Custom metadata filter, as meta[key]=value (a from..to range for number and date fields)"
+// @Param        license_type     query  []string  false  "License type filter"
+// @Param        rights_holder    query  string    false  "Rights holder search"
+// @Param        license_status   query  string    false  "License status filter (none, active, expired)"
+// @Param        fields     query     string     false  "Comma-separated elements of each item"
+// @Success      200        {file}    binary
+// @Failure      400        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Router       /export/xml [get]
+// @Security     BearerAuth
+func ExportXML(c *gin.Context) {
+	query, fields, ok := exportQuery(c, defaultXMLFields)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/xml")
+	c.Header("Content-Disposition", "attachment;filename=media_export.xml")
+
+	buffered := bufio.NewWriterSize(c.Writer, exportBufferSize)
+	buffered.WriteString(xml.Header)
+	encoder := xml.NewEncoder(buffered)
+	encoder.Indent("", "  ")
+	root := xml.StartElement{Name: xml.Name{Local: "media"}}
+	encoder.EncodeToken(root)
+
+	renderer := newMediaFieldRenderer(fields)
+	ok = streamExport(c, query, func(batch []models.Media) error {
+		for i := range batch {
+			if err := encodeXMLItem(encoder, renderer, &batch[i]); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+		return buffered.Flush()
+	})
+	if !ok {
+		return
+	}
+	encoder.EncodeToken(root.End())
+	encoder.Flush()
+	buffered.Flush()
 }
 
-func ExportJSON(c *gin.Context) {
-	var media []models.Media
-	userID, _ := c.Get("user_id")
+// encodeXMLItem writes the selected fields of media as an item element
+func encodeXMLItem(encoder *xml.Encoder, renderer *mediaFieldRenderer, media *models.Media) error {
+	item := xml.StartElement{Name: xml.Name{Local: "item"}}
+	if err := encoder.EncodeToken(item); err != nil {
+		return err
+	}
+	for _, name := range renderer.selection.names {
+		element := xml.StartElement{Name: xml.Name{Local: name}}
+		value := mediaFields[name].value(renderer, media)
+		if tags, ok := value.([]TagItem); ok {
+			names := make([]string, len(tags))
+			for i, tag := range tags {
+				names[i] = tag.Name
+			}
+			if err := encoder.EncodeElement(struct {
+				Tags []string `xml:"tag"`
+			}{names}, element); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := encoder.EncodeElement(csvValue(value), element); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(item.End())
+}
 
-	if err := database.GetDB().Where("user_id = ?", userID).Find(&media).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch media"})
+// ExportXLSX godoc
+// @Summary      Export media as an Excel workbook
+// @Description  Export the current user's media as an XLSX sheet, filtered like GET /media/list. fields picks the columns; sizes are numeric cells and tags are joined with semicolons.
+// @Tags         export
+// @Produce      application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param        type       query     string     false  "File type filter"
+// @Param        search     query     string     false  "Search term"
+// @Param        folder_id  query     string     false  "Folder ID"
+// @Param        tags       query     []string   false  "Tags filter"
+// @Param        class      query     []string   false  "Content class filter (photo, screenshot, scan, graphic)"
+// @Param        color      query     []string   false  "Dominant color filter (red, orange, yellow, green, cyan, blue, purple, pink, brown, black, white, gray)"
+// @Param        from       query     string     false  "Created at or after (RFC 3339 time or YYYY-MM-DD)"
+// @Param        to         query     string     false  "Created before (RFC 3339 time, or YYYY-MM-DD including that day)"
+// @Param        workflow_status  query  []string  false  "Workflow status filter (draft, in_review, approved, rejected)"
+// @Param        meta             query  string    false  "Custom metadata filter, as meta[key]=value (a from..to range for number and date fields)"
+// @Param        license_type     query  []string  false  "License type filter"
+// @Param        rights_holder    query  string    false  "Rights holder search"
+// @Param        license_status   query  string    false  "License status filter (none, active, expired)"
+// @Param        fields     query     string     false  "Comma-separated columns (default id,filename,mime_type,size,created_at,updated_at)"
+// @Success      200        {file}    binary
+// @Failure      400        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Router       /export/xlsx [get]
+// @Security     BearerAuth
+func ExportXLSX(c *gin.Context) {
+	query, fields, ok := exportQuery(c, defaultCSVFields)
+	if !ok {
 		return
 	}
 
-	c.Header("Content-Type", "application/json")
-	c.Header("Content-Disposition", "attachment;filename=media_export.json")
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", "attachment;filename=media_export.xlsx")
 
-	jsonData, err := json.MarshalIndent(media, "", "  ")
+	buffered := bufio.NewWriterSize(c.Writer, exportBufferSize)
+	sheet, err := utils.NewXLSXWriter(buffered, "Media")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to marshal JSON"})
+		c.Error(apierror.Internal("Failed to start workbook", err))
 		return
 	}
+	header := make([]interface{}, len(fields.names))
+	for i, name := range fields.names {
+		header[i] = name
+	}
+	sheet.WriteRow(header)
 
-	c.Data(http.StatusOK, "application/json", jsonData)
+	renderer := newMediaFieldRenderer(fields)
+	row := make([]interface{}, len(fields.names))
+	ok = streamExport(c, query, func(batch []models.Media) error {
+		for i := range batch {
+			for j, name := range fields.names {
+				row[j] = xlsxValue(mediaFields[name].value(renderer, &batch[i]))
+			}
+			if err := sheet.WriteRow(row); err != nil {
+				return err
+			}
+		}
+		return buffered.Flush()
+	})
+	if !ok {
+		return
+	}
+	sheet.Close()
+	buffered.Flush()
 }
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/utils"
+)
+
+const (
+	defaultFeedItems = 50
+	maxFeedItems     = 200
+)
+
+// rssFeed is an RSS 2.0 document. Enclosures carry the media, so audio feeds work as
+// podcasts.
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	ITunes  string     `xml:"xmlns:itunes,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          feedLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title      string       `xml:"title"`
+	Link       string       `xml:"link"`
+	GUID       rssGUID      `xml:"guid"`
+	PubDate    string       `xml:"pubDate"`
+	Categories []string     `xml:"category"`
+	Enclosure  rssEnclosure `xml:"enclosure"`
+	Duration   string       `xml:"itunes:duration,omitempty"` // Seconds, for audio and video
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// atomFeed is an Atom document
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []feedLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Links      []feedLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// feedLink is an Atom link, also used for the self link of RSS feeds
+type feedLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+// feedExpiry rounds the expiry of feed links up to the next day, so the same feed
+// hands out the same link all day
+func feedExpiry(now time.Time) int64 {
+	return now.Add(config.GetConfig().Feed.URLExpiration).Truncate(24 * time.Hour).Add(24 * time.Hour).Unix()
+}
+
+// signFeed signs the feed of a user's media, or of one of their folders
+func signFeed(secret, userID, folderID, expires string) string {
+	return utils.SignParams(secret, "feed", userID, folderID, expires)
+}
+
+// VerifyFeedToken validates the signature of a feed request
+func VerifyFeedToken(c *gin.Context) bool {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return utils.VerifyParams(config.GetConfig().JWT.Secret, c.Query("token"), "feed", c.Query("user"), c.Query("folder_id"), c.Query("expires"))
+}
+
+// signedFeedURL builds an absolute feed URL that feed readers can poll without an
+// Authorization header
+func signedFeedURL(base, secret string, userID uint, folderID, format string, expires int64) string {
+	userStr := strconv.FormatUint(uint64(userID), 10)
+	expiresStr := strconv.FormatInt(expires, 10)
+	query := url.Values{}
+	query.Set("format", format)
+	query.Set("user", userStr)
+	if folderID != "" {
+		query.Set("folder_id", folderID)
+	}
+	query.Set("expires", expiresStr)
+	query.Set("token", signFeed(secret, userStr, folderID, expiresStr))
+	return fmt.Sprintf("%s/api/v1/feeds/media?%s", base, query.Encode())
+}
+
+// feedDuration returns the duration of audio and video in whole seconds, or ""
+func feedDuration(media *models.Media) string {
+	var metadata struct {
+		Technical struct {
+			Duration string `json:"duration"`
+		} `json:"technical"`
+	}
+	if json.Unmarshal(media.Metadata, &metadata) != nil {
+		return ""
+	}
+	seconds, err := strconv.ParseFloat(metadata.Technical.Duration, 64)
+	if err != nil || seconds <= 0 {
+		return ""
+	}
+	return strconv.Itoa(int(seconds + 0.5))
+}
+
+// CreateFeedLinks godoc
+// @Summary      Create feed links
+// @Description  Signed RSS and Atom links to the feed of the current user's recent uploads, or of one folder's, for feed readers and automation tools that can't send a Bearer token
+// @Tags         feeds
+// @Accept       json
+// @Produce      json
+// @Param        input  body      handlers.FeedLinksRequest  false  "Folder to limit the feed to"
+// @Success      200    {object}  handlers.FeedLinksResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Router       /feeds [post]
+// @Security     BearerAuth
+func CreateFeedLinks(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var input FeedLinksRequest
+	if c.Request.ContentLength != 0 && !bindJSON(c, &input) {
+		return
+	}
+	if input.FolderID != "" {
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", input.FolderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.NotFound("Folder not found"))
+			return
+		}
+	}
+
+	secret := config.GetConfig().JWT.Secret
+	base := publicBaseURL(c)
+	expires := feedExpiry(time.Now())
+	c.JSON(http.StatusOK, FeedLinksResponse{
+		RSSURL:    signedFeedURL(base, secret, userID.(uint), input.FolderID, "rss", expires),
+		AtomURL:   signedFeedURL(base, secret, userID.(uint), input.FolderID, "atom", expires),
+		ExpiresAt: time.Unix(expires, 0).UTC(),
+	})
+}
+
+// GetMediaFeed godoc
+// @Summary      Feed of recent uploads
+// @Description  RSS 2.0 or Atom feed of the most recent uploads of a user, or of one folder, newest first. Every item links to the embed page of the media and encloses the media itself, so a feed of audio works as a podcast. Accepts either a Bearer token or the signed query of a link from POST /feeds.
+// @Tags         feeds
+// @Produce      application/rss+xml,application/atom+xml
+// @Param        format     query     string  false  "rss (default) or atom"
+// @Param        folder_id  query     string  false  "Folder ID, signed into feed links"
+// @Param        type       query     string  false  "MIME type prefix filter, e.g. audio"
+// @Param        limit      query     int     false  "Items, up to 200 (default 50)"
+// @Param        user       query     int     false  "User ID from a signed URL"
+// @Param        expires    query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token      query     string  false  "Signed URL token"
+// @Success      200        {string}  string  "Feed document"
+// @Success      304        "Not modified"
+// @Failure      400        {object}  object{error=string}
+// @Failure      403        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Router       /feeds/media [get]
+// @Security     BearerAuth
+func GetMediaFeed(c *gin.Context) {
+	format := c.DefaultQuery("format", "rss")
+	if format != "rss" && format != "atom" {
+		c.Error(apierror.InvalidField("format", "format must be rss or atom"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultFeedItems)))
+	if err != nil || limit < 1 || limit > maxFeedItems {
+		c.Error(apierror.InvalidField("limit", fmt.Sprintf("limit must be between 1 and %d", maxFeedItems)))
+		return
+	}
+
+	// Signed links stand in for their user
+	var userID uint
+	if c.GetBool("signed_access") {
+		id, _ := strconv.ParseUint(c.Query("user"), 10, 64)
+		userID = uint(id)
+	} else {
+		id, _ := c.Get("user_id")
+		userID = id.(uint)
+	}
+
+	cfg := config.GetConfig()
+	db := database.GetDB()
+	title := cfg.Embed.ProviderName + ": recent uploads"
+	feedID := fmt.Sprintf("urn:media-center:feed:user:%d", userID)
+	query := publiclyShared(db.Select("id", "user_id", "filename", "path", "storage_backend", "mime_type", "size", "metadata", "created_at", "updated_at").
+		Where("user_id = ?", userID))
+	if folderID := c.Query("folder_id"); folderID != "" {
+		var folder models.Folder
+		if err := db.Where("id = ? AND user_id = ?", folderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.NotFound("Folder not found"))
+			return
+		}
+		title = cfg.Embed.ProviderName + ": " + folder.Name
+		feedID += fmt.Sprintf(":folder:%d", folder.ID)
+		query = query.Where("folder_id = ?", folder.ID)
+	}
+	if fileType := c.Query("type"); fileType != "" {
+		query = query.Where("mime_type LIKE ?", fileType+"%")
+	}
+
+	var media []models.Media
+	if err := query.Preload("Tags").Order("created_at DESC, id DESC").Limit(limit).Find(&media).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch media", err))
+		return
+	}
+
+	// Pollers get 304 until an item is added, changed or removed
+	hash := sha256.New()
+	updated := time.Unix(0, 0).UTC()
+	for i := range media {
+		fmt.Fprintf(hash, "%s:%d\n", media[i].ID, media[i].UpdatedAt.UnixNano())
+		if media[i].UpdatedAt.After(updated) {
+			updated = media[i].UpdatedAt.UTC()
+		}
+	}
+	fmt.Fprintf(hash, "%s:%s", format, title)
+	etag := `"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, max-age=300")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	base := publicBaseURL(c)
+	self := base + c.Request.URL.RequestURI()
+	urls := newMediaURLBuilder()
+	embedExpires := embedExpiry(time.Now())
+
+	var document interface{}
+	contentType := "application/rss+xml; charset=utf-8"
+	if format == "atom" {
+		contentType = "application/atom+xml; charset=utf-8"
+		feed := atomFeed{
+			ID:      feedID,
+			Title:   title,
+			Updated: updated.Format(time.RFC3339),
+			Links:   []feedLink{{Href: self, Rel: "self", Type: "application/atom+xml"}},
+			Entries: make([]atomEntry, len(media)),
+		}
+		for i := range media {
+			m := &media[i]
+			entry := atomEntry{
+				ID:        "urn:media-center:media:" + m.ID,
+				Title:     m.Filename,
+				Updated:   m.UpdatedAt.UTC().Format(time.RFC3339),
+				Published: m.CreatedAt.UTC().Format(time.RFC3339),
+				Links: []feedLink{
+					{Href: signedEmbedURL(base, cfg.JWT.Secret, m, embedExpires), Rel: "alternate", Type: "text/html"},
+					{Href: urls.url(m), Rel: "enclosure", Type: m.MimeType, Length: m.Size},
+				},
+			}
+			for _, tag := range m.Tags {
+				entry.Categories = append(entry.Categories, atomCategory{Term: tag.Name})
+			}
+			feed.Entries[i] = entry
+		}
+		document = feed
+	} else {
+		feed := rssFeed{
+			Version: "2.0",
+			Atom:    "http://www.w3.org/2005/Atom",
+			ITunes:  "http://www.itunes.com/dtds/podcast-1.0.dtd",
+			Channel: rssChannel{
+				Title:         title,
+				Link:          base,
+				Description:   title,
+				Self:          feedLink{Href: self, Rel: "self", Type: "application/rss+xml"},
+				LastBuildDate: updated.Format(time.RFC1123Z),
+				Items:         make([]rssItem, len(media)),
+			},
+		}
+		for i := range media {
+			m := &media[i]
+			item := rssItem{
+				Title:     m.Filename,
+				Link:      signedEmbedURL(base, cfg.JWT.Secret, m, embedExpires),
+				GUID:      rssGUID{Value: m.ID},
+				PubDate:   m.CreatedAt.UTC().Format(time.RFC1123Z),
+				Enclosure: rssEnclosure{URL: urls.url(m), Length: m.Size, Type: m.MimeType},
+				Duration:  feedDuration(m),
+			}
+			for _, tag := range m.Tags {
+				item.Categories = append(item.Categories, tag.Name)
+			}
+			feed.Channel.Items[i] = item
+		}
+		document = feed
+	}
+
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		c.Error(apierror.Internal("Failed to write feed", err))
+		return
+	}
+	c.Data(http.StatusOK, contentType, append([]byte(xml.Header), data...))
+}
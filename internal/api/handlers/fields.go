@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/models"
+)
+
+// mediaField is a media attribute clients can ask for with fields=
+type mediaField struct {
+	columns []string // Columns of the media table the value is built from
+	value   func(r *mediaFieldRenderer, media *models.Media) interface{}
+}
+
+// mediaFields are the selectable fields, named like the fields of MediaItem
+var mediaFields = map[string]mediaField{
+	"id":        {[]string{"id"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.ID }},
+	"user_id":   {[]string{"user_id"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.UserID }},
+	"folder_id": {[]string{"folder_id"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.FolderID }},
+	"filename":  {[]string{"filename"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.Filename }},
+	"mime_type": {[]string{"mime_type"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.MimeType }},
+	"size":      {[]string{"size"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.Size }},
+	"metadata":  {[]string{"metadata"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.Metadata }},
+	"tags":      {nil, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return newTagItems(m.Tags) }},
+	"broken":    {[]string{"broken"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.Broken }},
+	"workflow_status": {[]string{"workflow_status"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} {
+		return m.WorkflowStatus
+	}},
+	"license": {[]string{"license_type", "rights_holder", "license_expires_at"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} {
+		return newMediaLicense(m)
+	}},
+	"created_at": {[]string{"created_at"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.CreatedAt }},
+	"updated_at": {[]string{"updated_at"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} { return m.UpdatedAt }},
+	"url": {[]string{"path", "storage_backend", "user_id"}, func(r *mediaFieldRenderer, m *models.Media) interface{} {
+		return r.urls.url(m)
+	}},
+	// Null for media without thumbnails or with an expired license
+	"thumbnail_url": {[]string{"mime_type", "filename", "updated_at", "license_expires_at"}, func(r *mediaFieldRenderer, m *models.Media) interface{} {
+		if url := r.urls.thumbnailURL(m); url != "" {
+			return url
+		}
+		return nil
+	}},
+	// Null for media without a placeholder
+	"blurhash": {[]string{"metadata"}, func(_ *mediaFieldRenderer, m *models.Media) interface{} {
+		if hash := mediaBlurHash(m); hash != "" {
+			return hash
+		}
+		return nil
+	}},
+}
+
+// fieldSelection is a parsed fields= parameter
+type fieldSelection struct {
+	names   []string
+	columns []string
+	tags    bool // Tags must be preloaded
+}
+
+// parseMediaFields reads a comma-separated fields= value. It returns nil when the parameter
+// is absent, meaning full media items.
+func parseMediaFields(value string) (*fieldSelection, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	selection := &fieldSelection{}
+	columns := map[string]bool{"id": true} // Preloading and keyset lookups need the key
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		field, ok := mediaFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field: %s", name)
+		}
+		seen[name] = true
+		selection.names = append(selection.names, name)
+		for _, column := range field.columns {
+			columns[column] = true
+		}
+		if name == "tags" {
+			selection.tags = true
+		}
+	}
+
+	for column := range columns {
+		selection.columns = append(selection.columns, column)
+	}
+	sort.Strings(selection.columns)
+	return selection, nil
+}
+
+// mediaFieldRenderer builds sparse media items
+type mediaFieldRenderer struct {
+	selection *fieldSelection
+	urls      *mediaURLBuilder
+}
+
+// newMediaFieldRenderer prepares rendering the fields of selection
+func newMediaFieldRenderer(selection *fieldSelection) *mediaFieldRenderer {
+	return &mediaFieldRenderer{selection: selection, urls: newMediaURLBuilder()}
+}
+
+// render returns the selected fields of media
+func (r *mediaFieldRenderer) render(media *models.Media) gin.H {
+	item := make(gin.H, len(r.selection.names))
+	for _, name := range r.selection.names {
+		item[name] = mediaFields[name].value(r, media)
+	}
+	return item
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/utils"
+)
+
+// sniffLength is how much of a file content sniffing looks at
+const sniffLength = 512
+
+// checkFormFileType applies the upload file type policy, and any narrower policies, to a
+// multipart file
+func checkFormFileType(file *multipart.FileHeader, narrower ...config.FileTypeConfig) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+
+	for _, policy := range append([]config.FileTypeConfig{config.GetConfig().Storage.FileTypes}, narrower...) {
+		if _, err := utils.CheckFileType(policy, file.Filename, head[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkStreamFileType applies the upload file type policy to a body about to be streamed
+// to storage and returns the sniffed type. The returned reader still yields the whole body.
+func checkStreamFileType(body io.Reader, filename string) (io.Reader, string, error) {
+	buffered := bufio.NewReaderSize(body, sniffLength)
+	head, err := buffered.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+
+	mimeType, err := utils.CheckFileType(config.GetConfig().Storage.FileTypes, filename, head)
+	if err != nil {
+		return nil, "", err
+	}
+	return buffered, mimeType, nil
+}
+
+// fileTypeError maps a file type check error to the error it is reported with
+func fileTypeError(err error) *apierror.Error {
+	if errors.Is(err, utils.ErrFileTypeNotAllowed) {
+		return apierror.New(http.StatusUnsupportedMediaType, err.Error()).WithCode(apierror.CodeFileTypeNotAllowed)
+	}
+	return apierror.Internal("Failed to check the file type", err)
+}
@@ -1,57 +1,157 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"go-media-center-example/internal/api/apierror"
 	"go-media-center-example/internal/database"
 	"go-media-center-example/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // CreateFolder handles folder creation
 func CreateFolder(c *gin.Context) {
-	var input struct {
-		Name        string `json:"name" binding:"required,min=1,max=255"`
-		Description string `json:"description"`
-		ParentID    *uint  `json:"parent_id,omitempty"`
-	}
+	var input CreateFolderRequest
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: folder name is required"})
+	if !bindJSON(c, &input) {
 		return
 	}
+	userID := c.GetUint("user_id")
 
 	// Validate parent folder if provided
 	if input.ParentID != nil {
 		// Ensure parent_id is positive
 		if *input.ParentID == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent folder ID must be a positive number"})
+			c.Error(apierror.BadRequest("Parent folder ID must be a positive number"))
 			return
 		}
 
-		var parentFolder models.Folder
-		if err := database.GetDB().Where("id = ?", *input.ParentID).First(&parentFolder).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Parent folder not found"})
+		if err := checkFolderParent(databaseFolders{}, userID, 0, *input.ParentID); err != nil {
+			c.Error(err)
 			return
 		}
 	}
 
-	userID, _ := c.Get("user_id")
+	taken, err := folderNameTaken(userID, input.ParentID, input.Name, 0)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to check folder name", err))
+		return
+	}
+	if taken {
+		c.Error(errFolderNameTaken())
+		return
+	}
+
 	folder := models.Folder{
 		Name:        input.Name,
 		Description: input.Description,
 		ParentID:    input.ParentID,
-		UserID:      userID.(uint),
+		UserID:      userID,
 	}
 
 	if err := database.GetDB().Create(&folder).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create folder"})
+		if database.IsUniqueViolation(err) {
+			c.Error(errFolderNameTaken())
+			return
+		}
+		c.Error(apierror.Internal("Failed to create folder", err))
 		return
 	}
+	notifyFolderCreated(&folder)
+
+	c.JSON(http.StatusCreated, newFolderItem(&folder))
+}
+
+// errFolderNameTaken reports a folder named like one of its new siblings
+func errFolderNameTaken() *apierror.Error {
+	return apierror.Conflict("A folder with this name already exists in the parent folder")
+}
+
+// folderNameTaken reports whether a folder of userID below parentID, other than the folder
+// exclude, is named name
+func folderNameTaken(userID uint, parentID *uint, name string, exclude uint) (bool, error) {
+	query := database.GetDB().Model(&models.Folder{}).Where("user_id = ? AND name = ? AND id <> ?", userID, name, exclude)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count > 0, err
+}
+
+// folderTree looks up folders for the ownership and parent checks: the database, or a
+// fixed tree in tests
+type folderTree interface {
+	// userFolder returns the folder id if userID owns it
+	userFolder(id string, userID uint) (*models.Folder, error)
+	// isWithin reports whether candidate is the folder id or one of its subfolders
+	isWithin(candidate, id uint) (bool, error)
+}
+
+// databaseFolders is the folderTree of the database
+type databaseFolders struct{}
+
+func (databaseFolders) userFolder(id string, userID uint) (*models.Folder, error) {
+	var folder models.Folder
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&folder).Error; err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
 
-	c.JSON(http.StatusCreated, folder)
+func (databaseFolders) isWithin(candidate, id uint) (bool, error) {
+	return isFolderWithin(candidate, id)
+}
+
+// checkTargetFolder checks that media of userID may be moved or copied into the folder id
+func checkTargetFolder(tree folderTree, userID uint, id string) *apierror.Error {
+	if _, err := tree.userFolder(id, userID); err != nil {
+		return apierror.InvalidField("folder_id", "is not one of your folders")
+	}
+	return nil
+}
+
+// checkFolderParent checks that a folder of userID may be created below, with folderID 0,
+// or moved below the folder parentID: the parent must be the user's own and, for a move,
+// not the folder itself or one of its subfolders
+func checkFolderParent(tree folderTree, userID, folderID, parentID uint) *apierror.Error {
+	parent, err := tree.userFolder(strconv.FormatUint(uint64(parentID), 10), userID)
+	if err != nil {
+		return apierror.BadRequest("Parent folder not found")
+	}
+	if folderID == 0 {
+		return nil
+	}
+	within, err := tree.isWithin(parent.ID, folderID)
+	if err != nil {
+		return apierror.Internal("Failed to check parent folder", err)
+	}
+	if within {
+		return apierror.BadRequest("A folder can't be moved into itself or one of its subfolders")
+	}
+	return nil
+}
+
+// isFolderWithin reports whether the folder candidate is the folder id or one of its
+// subfolders, at any depth
+func isFolderWithin(candidate, id uint) (bool, error) {
+	var count int64
+	err := database.GetDB().Raw(`WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM folders WHERE id = ?
+			UNION
+			SELECT folders.id, folders.parent_id FROM folders
+			JOIN ancestors ON folders.id = ancestors.parent_id
+		)
+		SELECT COUNT(*) FROM ancestors WHERE id = ?`, candidate, id).Scan(&count).Error
+	return count > 0, err
 }
 
 // ListFolders handles listing all folders for a user
@@ -86,68 +186,178 @@ func ListFolders(c *gin.Context) {
 	// Count total before pagination
 	var total int64
 	if err := query.Count(&total).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count folders"})
+		c.Error(apierror.Internal("Failed to count folders", err))
 		return
 	}
 
 	// Apply pagination and fetch results
 	offset := (page - 1) * limit
 	if err := query.Offset(offset).Limit(limit).
-		Order("created_at DESC").
+		Order("created_at DESC, id DESC").
 		Find(&folders).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch folders"})
+		c.Error(apierror.Internal("Failed to fetch folders", err))
 		return
 	}
 
-	// Get media count for each folder
-	for i := range folders {
-		var count int64
-		if err := db.Model(&models.Media{}).Where("folder_id = ?", folders[i].ID).Count(&count).Error; err != nil {
-			continue
-		}
-		folders[i].MediaCount = count
+	items := newFolderItems(folders)
+	if err := setFolderMediaCounts(items, c.Query("include_subfolders") == "true"); err != nil {
+		c.Error(apierror.Internal("Failed to count folder media", err))
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"folders": folders,
-		"pagination": gin.H{
-			"current_page": page,
-			"total_pages":  (total + int64(limit) - 1) / int64(limit),
-			"total_items":  total,
-			"per_page":     limit,
+	c.JSON(http.StatusOK, FolderListResponse{
+		Folders: items,
+		Pagination: Pagination{
+			CurrentPage: page,
+			TotalPages:  (total + int64(limit) - 1) / int64(limit),
+			TotalItems:  total,
+			PerPage:     limit,
 		},
 	})
 }
 
+// setFolderMediaCounts fills in the media counts of folders with one aggregated query,
+// and with includeSubfolders another one adding up the media of their whole subtrees
+func setFolderMediaCounts(folders []FolderItem, includeSubfolders bool) error {
+	if len(folders) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(folders))
+	for i := range folders {
+		ids[i] = folders[i].ID
+	}
+
+	type folderCount struct {
+		FolderID uint
+		Count    int64
+	}
+	db := database.GetDB()
+
+	var direct []folderCount
+	if err := db.Model(&models.Media{}).
+		Select("folder_id, COUNT(*) AS count").
+		Where("folder_id IN ?", ids).
+		Group("folder_id").
+		Scan(&direct).Error; err != nil {
+		return err
+	}
+	counts := make(map[uint]int64, len(direct))
+	for _, row := range direct {
+		counts[row.FolderID] = row.Count
+	}
+	for i := range folders {
+		folders[i].MediaCount = counts[folders[i].ID]
+	}
+
+	if !includeSubfolders {
+		return nil
+	}
+
+	var totals []folderCount
+	if err := db.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id AS root_id, id FROM folders WHERE id IN ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT subtree.root_id, folders.id FROM folders
+			JOIN subtree ON folders.parent_id = subtree.id
+			WHERE folders.deleted_at IS NULL
+		)
+		SELECT subtree.root_id AS folder_id, COUNT(media.id) AS count FROM subtree
+		JOIN media ON media.folder_id = subtree.id AND media.deleted_at IS NULL
+		GROUP BY subtree.root_id`, ids).Scan(&totals).Error; err != nil {
+		return err
+	}
+	counts = make(map[uint]int64, len(totals))
+	for _, row := range totals {
+		counts[row.FolderID] = row.Count
+	}
+	for i := range folders {
+		total := counts[folders[i].ID]
+		folders[i].TotalMediaCount = &total
+	}
+	return nil
+}
+
 // GetFolder handles retrieving a single folder
 func GetFolder(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	var folder models.Folder
 
 	if err := database.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&folder).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		c.Error(apierror.NotFound("Folder not found"))
 		return
 	}
 
-	// Get media count
-	var mediaCount int64
-	if err := database.GetDB().Model(&models.Media{}).Where("folder_id = ?", folder.ID).Count(&mediaCount).Error; err == nil {
-		folder.MediaCount = mediaCount
+	items := []FolderItem{newFolderItem(&folder)}
+	if err := setFolderMediaCounts(items, c.Query("include_subfolders") == "true"); err != nil {
+		c.Error(apierror.Internal("Failed to count folder media", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, items[0])
+}
+
+// GetFolderByPath handles looking up a folder by its path from the root, such as
+// /photos/2024. Each segment names a folder by slug or else by exact name.
+func GetFolderByPath(c *gin.Context) {
+	var segments []string
+	for _, segment := range strings.Split(c.Query("path"), "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		c.Error(apierror.BadRequest("The path must name a folder, e.g. /photos/2024"))
+		return
+	}
+
+	folder, err := folderByPath(c.GetUint("user_id"), segments)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Error(apierror.NotFound("Folder not found"))
+		return
+	} else if err != nil {
+		c.Error(apierror.Internal("Failed to look up folder", err))
+		return
 	}
 
-	c.JSON(http.StatusOK, folder)
+	items := []FolderItem{newFolderItem(folder)}
+	if err := setFolderMediaCounts(items, c.Query("include_subfolders") == "true"); err != nil {
+		c.Error(apierror.Internal("Failed to count folder media", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, items[0])
+}
+
+// folderByPath walks down from the root through the folders named by segments
+func folderByPath(userID uint, segments []string) (*models.Folder, error) {
+	var folder *models.Folder
+	for _, segment := range segments {
+		children := func() *gorm.DB {
+			query := database.GetDB().Where("user_id = ?", userID)
+			if folder == nil {
+				return query.Where("parent_id IS NULL")
+			}
+			return query.Where("parent_id = ?", folder.ID)
+		}
+
+		var child models.Folder
+		err := children().Where("slug = ?", segment).First(&child).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = children().Where("name = ?", segment).First(&child).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+		folder = &child
+	}
+	return folder, nil
 }
 
 // UpdateFolder handles updating a folder
 func UpdateFolder(c *gin.Context) {
-	var input struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
-		ParentID    *uint  `json:"parent_id"`
-	}
+	var input UpdateFolderRequest
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
@@ -155,35 +365,62 @@ func UpdateFolder(c *gin.Context) {
 	var folder models.Folder
 
 	if err := database.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&folder).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		c.Error(apierror.NotFound("Folder not found"))
 		return
 	}
 
 	updates := map[string]interface{}{}
+	name, parentID := folder.Name, folder.ParentID
 	if input.Name != "" {
 		updates["name"] = input.Name
+		name = input.Name
 	}
 	if input.Description != "" {
 		updates["description"] = input.Description
 	}
 	if input.ParentID != nil {
-		// Validate parent folder if provided
+		parentID = nil
+		// Validate parent folder if provided; 0 moves the folder to the root
 		if *input.ParentID > 0 {
-			var parentFolder models.Folder
-			if err := database.GetDB().Where("id = ?", *input.ParentID).First(&parentFolder).Error; err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "Parent folder not found"})
+			if err := checkFolderParent(databaseFolders{}, folder.UserID, folder.ID, *input.ParentID); err != nil {
+				c.Error(err)
 				return
 			}
+			parentID = input.ParentID
 		}
-		updates["parent_id"] = input.ParentID
+		updates["parent_id"] = parentID
+	}
+
+	// A renamed or moved folder must not clash with its new siblings
+	if _, renamed := updates["name"]; renamed || input.ParentID != nil {
+		taken, err := folderNameTaken(folder.UserID, parentID, name, folder.ID)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to check folder name", err))
+			return
+		}
+		if taken {
+			c.Error(errFolderNameTaken())
+			return
+		}
+		slug, err := models.UniqueFolderSlug(database.GetDB(), folder.UserID, parentID, name, folder.ID)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to update folder", err))
+			return
+		}
+		updates["slug"] = slug
 	}
 
 	if err := database.GetDB().Model(&folder).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update folder"})
+		if database.IsUniqueViolation(err) {
+			c.Error(errFolderNameTaken())
+			return
+		}
+		c.Error(apierror.Internal("Failed to update folder", err))
 		return
 	}
+	notifyFolderUpdated(&folder)
 
-	c.JSON(http.StatusOK, folder)
+	c.JSON(http.StatusOK, newFolderItem(&folder))
 }
 
 // DeleteFolder handles folder deletion
@@ -194,25 +431,30 @@ func DeleteFolder(c *gin.Context) {
 	// Check if folder has media
 	var mediaCount int64
 	if err := database.GetDB().Model(&models.Media{}).Where("folder_id = ?", id).Count(&mediaCount).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check folder contents"})
+		c.Error(apierror.Internal("Failed to check folder contents", err))
 		return
 	}
 
 	if mediaCount > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete folder containing media"})
+		c.Error(apierror.BadRequest("Cannot delete folder containing media"))
 		return
 	}
 
 	result := database.GetDB().Where("id = ? AND user_id = ?", id, userID).Delete(&models.Folder{})
 	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete folder"})
+		c.Error(apierror.Internal("Failed to delete folder", result.Error))
 		return
 	}
 
 	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Folder not found"})
+		c.Error(apierror.NotFound("Folder not found"))
 		return
 	}
+	// The audit log of the folder's rules is kept
+	if err := database.GetDB().Where("folder_id = ?", id).Delete(&models.LifecycleRule{}).Error; err != nil {
+		log.Printf("Failed to delete lifecycle rules of folder %s: %v", id, err)
+	}
+	notifyFolderDeleted(userID.(uint), id)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Folder deleted successfully"})
 }
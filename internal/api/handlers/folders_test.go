@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/models"
+)
+
+// memoryFolders is a folderTree of fixed folders
+type memoryFolders struct {
+	folders map[uint]models.Folder
+	err     error // Returned by isWithin when set
+}
+
+func (t memoryFolders) userFolder(id string, userID uint) (*models.Folder, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	folder, ok := t.folders[uint(n)]
+	if !ok || folder.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &folder, nil
+}
+
+func (t memoryFolders) isWithin(candidate, id uint) (bool, error) {
+	if t.err != nil {
+		return false, t.err
+	}
+	for seen := 0; seen <= len(t.folders); seen++ {
+		if candidate == id {
+			return true, nil
+		}
+		folder, ok := t.folders[candidate]
+		if !ok || folder.ParentID == nil {
+			return false, nil
+		}
+		candidate = *folder.ParentID
+	}
+	return false, nil
+}
+
+// testFolders is the tree the checks run against. User 1 owns:
+//
+//	1 Projects
+//	├── 2 Clients
+//	│   └── 3 Acme
+//	4 Archive
+//
+// and user 2 owns 5 Private.
+func testFolders() memoryFolders {
+	parent := func(id uint) *uint { return &id }
+	return memoryFolders{folders: map[uint]models.Folder{
+		1: {ID: 1, UserID: 1, Name: "Projects"},
+		2: {ID: 2, UserID: 1, Name: "Clients", ParentID: parent(1)},
+		3: {ID: 3, UserID: 1, Name: "Acme", ParentID: parent(2)},
+		4: {ID: 4, UserID: 1, Name: "Archive"},
+		5: {ID: 5, UserID: 2, Name: "Private"},
+	}}
+}
+
+// checkTargetFolder guards the target of batch moves and copies
+func TestCheckTargetFolder(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   uint
+		folderID string
+		valid    bool
+	}{
+		{"own folder", 1, "3", true},
+		{"own root folder", 1, "4", true},
+		{"another user's folder", 1, "5", false},
+		{"second user's own folder", 2, "5", true},
+		{"first user's folder for the second", 2, "1", false},
+		{"missing folder", 1, "99", false},
+		{"malformed ID", 1, "projects", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTargetFolder(testFolders(), tt.userID, tt.folderID)
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("checkTargetFolder() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("checkTargetFolder() = nil, want an error")
+			}
+			if len(err.Fields) != 1 || err.Fields[0].Field != "folder_id" {
+				t.Errorf("checkTargetFolder() fields = %v, want a folder_id error", err.Fields)
+			}
+		})
+	}
+}
+
+func TestCheckFolderParent(t *testing.T) {
+	tests := []struct {
+		name     string
+		userID   uint
+		folderID uint // 0 for a new folder
+		parentID uint
+		status   int // 0 when the parent is accepted
+		message  string
+	}{
+		{name: "create below own folder", userID: 1, parentID: 3},
+		{name: "create below another user's folder", userID: 1, parentID: 5, status: http.StatusBadRequest, message: "Parent folder not found"},
+		{name: "create below missing folder", userID: 1, parentID: 99, status: http.StatusBadRequest, message: "Parent folder not found"},
+		{name: "move to another branch", userID: 1, folderID: 2, parentID: 4},
+		{name: "move below a sibling's subfolder", userID: 1, folderID: 4, parentID: 3},
+		{name: "move into itself", userID: 1, folderID: 2, parentID: 2, status: http.StatusBadRequest, message: "A folder can't be moved into itself or one of its subfolders"},
+		{name: "move into its child", userID: 1, folderID: 2, parentID: 3, status: http.StatusBadRequest, message: "A folder can't be moved into itself or one of its subfolders"},
+		{name: "move into its grandchild", userID: 1, folderID: 1, parentID: 3, status: http.StatusBadRequest, message: "A folder can't be moved into itself or one of its subfolders"},
+		{name: "move below another user's folder", userID: 1, folderID: 2, parentID: 5, status: http.StatusBadRequest, message: "Parent folder not found"},
+		{name: "other user moves below a folder of user 1", userID: 2, folderID: 5, parentID: 1, status: http.StatusBadRequest, message: "Parent folder not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFolderParent(testFolders(), tt.userID, tt.folderID, tt.parentID)
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("checkFolderParent() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("checkFolderParent() = nil, want an error")
+			}
+			if err.Status != tt.status || err.Message != tt.message {
+				t.Errorf("checkFolderParent() = %d %q, want %d %q", err.Status, err.Message, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestCheckFolderParentLookupFailure(t *testing.T) {
+	tree := testFolders()
+	tree.err = errors.New("connection reset")
+
+	err := checkFolderParent(tree, 1, 2, 4)
+	if err == nil || err.Status != http.StatusInternalServerError || err.Code != apierror.CodeInternal {
+		t.Fatalf("checkFolderParent() = %v, want an internal error", err)
+	}
+	// New folders have no subfolders, so the tree isn't walked
+	if err := checkFolderParent(tree, 1, 0, 4); err != nil {
+		t.Fatalf("checkFolderParent() for a new folder = %v, want nil", err)
+	}
+}
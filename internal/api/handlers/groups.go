@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+// maxGroupMembersPerRequest bounds the users added to a group at once
+const maxGroupMembersPerRequest = 500
+
+// groupAccess is what the current user may do with a group
+type groupAccess struct {
+	group *models.Group
+	role  string // Role of the user in the group, empty if they aren't a member
+	owner bool   // The user owns the group or is an admin
+}
+
+// canManage reports whether the user may add and remove members
+func (a *groupAccess) canManage() bool {
+	return a.owner || a.role == models.GroupRoleManager
+}
+
+// loadGroup loads the group named in the path if the user owns it, belongs to it or is
+// an admin, reporting an error otherwise
+func loadGroup(c *gin.Context) (*groupAccess, bool) {
+	userID := c.GetUint("user_id")
+	db := database.GetDB()
+
+	var group models.Group
+	if err := db.First(&group, c.Param("id")).Error; err != nil {
+		c.Error(apierror.NotFound("Group not found"))
+		return nil, false
+	}
+	access := &groupAccess{group: &group, owner: group.OwnerID == userID}
+
+	var membership models.GroupMembership
+	if err := db.Where("group_id = ? AND user_id = ?", group.ID, userID).First(&membership).Error; err == nil {
+		access.role = membership.Role
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.Error(apierror.Internal("Failed to fetch group membership", err))
+		return nil, false
+	}
+
+	// Admins act on any group as its owner would
+	if !access.owner {
+		var user models.User
+		if err := db.Select("id", "role").First(&user, userID).Error; err == nil && user.Role == models.RoleAdmin {
+			access.owner = true
+		}
+	}
+	if !access.owner && access.role == "" {
+		c.Error(apierror.NotFound("Group not found"))
+		return nil, false
+	}
+	return access, true
+}
+
+// groupItems returns groups with the role of the user in each and their member counts
+func groupItems(groups []models.Group, userID uint) ([]GroupItem, error) {
+	items := make([]GroupItem, len(groups))
+	if len(groups) == 0 {
+		return items, nil
+	}
+	ids := make([]uint, len(groups))
+	for i := range groups {
+		ids[i] = groups[i].ID
+	}
+
+	var counts []struct {
+		GroupID uint
+		Count   int64
+	}
+	if err := database.GetDB().Model(&models.GroupMembership{}).
+		Select("group_id, COUNT(*) AS count").
+		Where("group_id IN ?", ids).Group("group_id").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	var memberships []models.GroupMembership
+	if err := database.GetDB().Where("group_id IN ? AND user_id = ?", ids, userID).
+		Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+
+	countOf := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		countOf[count.GroupID] = count.Count
+	}
+	roleIn := make(map[uint]string, len(memberships))
+	for _, membership := range memberships {
+		roleIn[membership.GroupID] = membership.Role
+	}
+	for i := range groups {
+		items[i] = GroupItem{Group: groups[i], Role: roleIn[groups[i].ID], MemberCount: countOf[groups[i].ID]}
+	}
+	return items, nil
+}
+
+// groupMembers returns the members of a group, managers first
+func groupMembers(groupID uint) ([]GroupMemberItem, error) {
+	members := []GroupMemberItem{}
+	err := database.GetDB().Table("group_memberships").
+		Select("group_memberships.user_id, users.username, group_memberships.role, group_memberships.added_by, group_memberships.created_at").
+		Joins("JOIN users ON users.id = group_memberships.user_id AND users.deleted_at IS NULL").
+		Where("group_memberships.group_id = ?", groupID).
+		Order("group_memberships.role = 'manager' DESC, users.username").
+		Scan(&members).Error
+	return members, err
+}
+
+// respondGroup answers with a group, the user's role in it and its members
+func respondGroup(c *gin.Context, status int, group *models.Group) {
+	items, err := groupItems([]models.Group{*group}, c.GetUint("user_id"))
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch group", err))
+		return
+	}
+	members, err := groupMembers(group.ID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch group members", err))
+		return
+	}
+	c.JSON(status, GroupResponse{Group: items[0], Members: members})
+}
+
+// ListGroups godoc
+// @Summary      List groups
+// @Description  Groups you own or belong to, by name, with your role in each and their member counts. Admins list every group with all=true.
+// @Tags         groups
+// @Produce      json
+// @Param        all  query     bool  false  "Every group (admins only)"
+// @Success      200  {object}  handlers.GroupsResponse
+// @Failure      403  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /groups [get]
+// @Security     BearerAuth
+func ListGroups(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	db := database.GetDB()
+
+	query := db.Model(&models.Group{})
+	if c.Query("all") == "true" {
+		var user models.User
+		if err := db.Select("id", "role").First(&user, userID).Error; err != nil || user.Role != models.RoleAdmin {
+			c.Error(apierror.Forbidden("Only admins can list every group"))
+			return
+		}
+	} else {
+		query = query.Where("owner_id = ? OR id IN (?)", userID,
+			db.Model(&models.GroupMembership{}).Select("group_id").Where("user_id = ?", userID))
+	}
+
+	var groups []models.Group
+	if err := query.Order("name, id").Find(&groups).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch groups", err))
+		return
+	}
+	items, err := groupItems(groups, userID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch groups", err))
+		return
+	}
+	c.JSON(http.StatusOK, GroupsResponse{Groups: items})
+}
+
+// CreateGroup godoc
+// @Summary      Create a group
+// @Description  Create a group of users you own, with yourself as its first manager. Group names are unique among your groups.
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Param        group  body      handlers.CreateGroupRequest  true  "Group"
+// @Success      201    {object}  handlers.GroupResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /groups [post]
+// @Security     BearerAuth
+func CreateGroup(c *gin.Context) {
+	var input CreateGroupRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	group := models.Group{
+		Name:        strings.TrimSpace(input.Name),
+		Description: input.Description,
+		OwnerID:     userID,
+	}
+	if group.Name == "" {
+		c.Error(apierror.InvalidField("name", "must not be empty"))
+		return
+	}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.GroupMembership{
+			GroupID: group.ID,
+			UserID:  userID,
+			Role:    models.GroupRoleManager,
+			AddedBy: userID,
+		}).Error
+	})
+	if database.IsUniqueViolation(err) {
+		c.Error(apierror.Conflict("You already have a group with this name"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to create group", err))
+		return
+	}
+	respondGroup(c, http.StatusCreated, &group)
+}
+
+// GetGroup godoc
+// @Summary      Get a group
+// @Description  A group you own or belong to with its members, managers first
+// @Tags         groups
+// @Produce      json
+// @Param        id   path      int  true  "Group ID"
+// @Success      200  {object}  handlers.GroupResponse
+// @Failure      404  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /groups/{id} [get]
+// @Security     BearerAuth
+func GetGroup(c *gin.Context) {
+	access, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	respondGroup(c, http.StatusOK, access.group)
+}
+
+// UpdateGroup godoc
+// @Summary      Update a group
+// @Description  Rename a group or change its description. Only its owner and admins can.
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                          true  "Group ID"
+// @Param        group  body      handlers.UpdateGroupRequest  true  "Changed fields"
+// @Success      200    {object}  handlers.GroupResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      403    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /groups/{id} [put]
+// @Security     BearerAuth
+func UpdateGroup(c *gin.Context) {
+	var input UpdateGroupRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	access, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if !access.owner {
+		c.Error(apierror.Forbidden("Only the owner of a group can change it"))
+		return
+	}
+
+	group := access.group
+	if input.Name != nil {
+		if group.Name = strings.TrimSpace(*input.Name); group.Name == "" {
+			c.Error(apierror.InvalidField("name", "must not be empty"))
+			return
+		}
+	}
+	if input.Description != nil {
+		group.Description = *input.Description
+	}
+	err := database.GetDB().Save(group).Error
+	if database.IsUniqueViolation(err) {
+		c.Error(apierror.Conflict("The owner already has a group with this name"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to update group", err))
+		return
+	}
+	respondGroup(c, http.StatusOK, group)
+}
+
+// DeleteGroup godoc
+// @Summary      Delete a group
+// @Description  Delete a group and its memberships. Only its owner and admins can.
+// @Tags         groups
+// @Produce      json
+// @Param        id   path      int  true  "Group ID"
+// @Success      200  {object}  handlers.MessageResponse
+// @Failure      403  {object}  object{error=string}
+// @Failure      404  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /groups/{id} [delete]
+// @Security     BearerAuth
+func DeleteGroup(c *gin.Context) {
+	access, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if !access.owner {
+		c.Error(apierror.Forbidden("Only the owner of a group can delete it"))
+		return
+	}
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", access.group.ID).Delete(&models.GroupMembership{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(access.group).Error
+	})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to delete group", err))
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Group deleted successfully"})
+}
+
+// AddGroupMembers godoc
+// @Summary      Add members to a group
+// @Description  Add users, by ID or username, to a group as members or managers. Managers can add members; only the owner and admins can add managers. Users already in the group keep their role, and users that don't exist are listed in not_found.
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                              true  "Group ID"
+// @Param        members  body      handlers.AddGroupMembersRequest  true  "Users to add"
+// @Success      200      {object}  handlers.AddGroupMembersResponse
+// @Failure      400      {object}  object{error=string}
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Failure      500      {object}  object{error=string}
+// @Router       /groups/{id}/members [post]
+// @Security     BearerAuth
+func AddGroupMembers(c *gin.Context) {
+	var input AddGroupMembersRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if len(input.UserIDs) == 0 && len(input.Usernames) == 0 {
+		c.Error(apierror.BadRequest("Name the users to add with user_ids or usernames"))
+		return
+	}
+	if len(input.UserIDs)+len(input.Usernames) > maxGroupMembersPerRequest {
+		c.Error(apierror.BadRequest("At most 500 users can be added at once"))
+		return
+	}
+	role := input.Role
+	if role == "" {
+		role = models.GroupRoleMember
+	}
+
+	access, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	switch {
+	case !access.canManage():
+		c.Error(apierror.Forbidden("Only managers of a group can add members"))
+		return
+	case role == models.GroupRoleManager && !access.owner:
+		c.Error(apierror.Forbidden("Only the owner of a group can add managers"))
+		return
+	}
+
+	db := database.GetDB()
+	var users []models.User
+	if err := db.Select("id", "username").
+		Where("id IN ? OR username IN ?", input.UserIDs, input.Usernames).
+		Find(&users).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch users", err))
+		return
+	}
+
+	// Users already in the group keep their role
+	var existing []uint
+	if err := db.Model(&models.GroupMembership{}).Where("group_id = ?", access.group.ID).
+		Pluck("user_id", &existing).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch group members", err))
+		return
+	}
+	member := make(map[uint]bool, len(existing))
+	for _, id := range existing {
+		member[id] = true
+	}
+
+	response := AddGroupMembersResponse{Added: []uint{}, NotFound: []string{}}
+	foundID := make(map[uint]bool, len(users))
+	foundName := make(map[string]bool, len(users))
+	memberships := make([]models.GroupMembership, 0, len(users))
+	for _, user := range users {
+		foundID[user.ID] = true
+		foundName[user.Username] = true
+		if member[user.ID] {
+			continue
+		}
+		memberships = append(memberships, models.GroupMembership{
+			GroupID: access.group.ID,
+			UserID:  user.ID,
+			Role:    role,
+			AddedBy: c.GetUint("user_id"),
+		})
+	}
+	for _, id := range input.UserIDs {
+		if !foundID[id] {
+			response.NotFound = append(response.NotFound, strconv.FormatUint(uint64(id), 10))
+		}
+	}
+	for _, name := range input.Usernames {
+		if !foundName[name] {
+			response.NotFound = append(response.NotFound, name)
+		}
+	}
+
+	if len(memberships) > 0 {
+		// Users added by someone else in the meantime keep that membership
+		if err := db.Clauses(clause.OnConflict{DoNothing: true, Columns: []clause.Column{{Name: "group_id"}, {Name: "user_id"}}}).
+			Create(&memberships).Error; err != nil {
+			c.Error(apierror.Internal("Failed to add group members", err))
+			return
+		}
+		for _, membership := range memberships {
+			response.Added = append(response.Added, membership.UserID)
+		}
+	}
+
+	members, err := groupMembers(access.group.ID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch group members", err))
+		return
+	}
+	response.Members = members
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateGroupMember godoc
+// @Summary      Change the role of a group member
+// @Description  Make a member a manager or a manager a member. Only the owner of the group and admins can; the owner stays a manager.
+// @Tags         groups
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                                true  "Group ID"
+// @Param        user_id  path      int                                true  "User ID"
+// @Param        member   body      handlers.UpdateGroupMemberRequest  true  "New role"
+// @Success      200      {object}  handlers.GroupResponse
+// @Failure      400      {object}  object{error=string}
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Failure      500      {object}  object{error=string}
+// @Router       /groups/{id}/members/{user_id} [put]
+// @Security     BearerAuth
+func UpdateGroupMember(c *gin.Context) {
+	var input UpdateGroupMemberRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	access, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	if !access.owner {
+		c.Error(apierror.Forbidden("Only the owner of a group can change roles"))
+		return
+	}
+	if c.Param("user_id") == strconv.FormatUint(uint64(access.group.OwnerID), 10) && input.Role != models.GroupRoleManager {
+		c.Error(apierror.BadRequest("The owner of a group stays a manager"))
+		return
+	}
+
+	result := database.GetDB().Model(&models.GroupMembership{}).
+		Where("group_id = ? AND user_id = ?", access.group.ID, c.Param("user_id")).
+		Update("role", input.Role)
+	if result.Error != nil {
+		c.Error(apierror.Internal("Failed to update group member", result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.Error(apierror.NotFound("Group member not found"))
+		return
+	}
+	respondGroup(c, http.StatusOK, access.group)
+}
+
+// RemoveGroupMember godoc
+// @Summary      Remove a member from a group
+// @Description  Managers can remove members, and the owner and admins managers too. Any member can leave a group by removing themselves. The owner can't be removed.
+// @Tags         groups
+// @Produce      json
+// @Param        id       path      int  true  "Group ID"
+// @Param        user_id  path      int  true  "User ID"
+// @Success      200      {object}  handlers.MessageResponse
+// @Failure      400      {object}  object{error=string}
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Failure      500      {object}  object{error=string}
+// @Router       /groups/{id}/members/{user_id} [delete]
+// @Security     BearerAuth
+func RemoveGroupMember(c *gin.Context) {
+	access, ok := loadGroup(c)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil {
+		c.Error(apierror.NotFound("Group member not found"))
+		return
+	}
+	if uint(memberID) == access.group.OwnerID {
+		c.Error(apierror.BadRequest("The owner of a group can't be removed from it"))
+		return
+	}
+
+	db := database.GetDB()
+	var membership models.GroupMembership
+	if err := db.Where("group_id = ? AND user_id = ?", access.group.ID, memberID).First(&membership).Error; err != nil {
+		c.Error(apierror.NotFound("Group member not found"))
+		return
+	}
+	self := uint(memberID) == c.GetUint("user_id")
+	switch {
+	case self:
+	case !access.canManage():
+		c.Error(apierror.Forbidden("Only managers of a group can remove members"))
+		return
+	case membership.Role == models.GroupRoleManager && !access.owner:
+		c.Error(apierror.Forbidden("Only the owner of a group can remove managers"))
+		return
+	}
+
+	if err := db.Where("group_id = ? AND user_id = ?", access.group.ID, memberID).
+		Delete(&models.GroupMembership{}).Error; err != nil {
+		c.Error(apierror.Internal("Failed to remove group member", err))
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Group member removed successfully"})
+}
@@ -4,12 +4,24 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/storage"
 )
 
-// HealthCheck handles the health check endpoint
+// HealthCheck handles the health check endpoint. The API stays up while storage is
+// failing, so it always answers 200 and reports storage trouble as degraded.
 func HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":  "healthy",
-		"version": "1.0.0",
+	status := "healthy"
+	breakers := storage.BreakerStates()
+	for _, state := range breakers {
+		if state != storage.BreakerClosed {
+			status = "degraded"
+		}
+	}
+
+	c.JSON(http.StatusOK, HealthResponse{
+		Status:  status,
+		Version: "1.0.0",
+		Storage: breakers,
 	})
 }
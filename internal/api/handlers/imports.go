@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/clouddrive"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// importLeaseDuration is how long a batch job stays with the instance running it without
+// the lease being renewed. Jobs whose lease ran out are taken over by another instance.
+const importLeaseDuration = 2 * time.Minute
+
+// importLease returns the expiry of a lease on a batch job taken now
+func importLease() *time.Time {
+	expires := time.Now().Add(importLeaseDuration)
+	return &expires
+}
+
+// newLeaseOwner returns a token naming one hold of a batch job's lease. Only the holder
+// renews or releases the lease, so an instance that lost it can't take it back.
+func newLeaseOwner() string {
+	return uuid.NewString()
+}
+
+// claimImportJob takes the lease of a running job that no instance holds. Only one
+// instance succeeds, as the check and the update are one statement.
+func claimImportJob(job *models.ImportJob) bool {
+	owner := newLeaseOwner()
+	result := database.GetDB().Model(&models.ImportJob{}).
+		Where("id = ? AND status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", job.ID, models.ImportJobRunning, time.Now()).
+		Updates(map[string]interface{}{"lease_owner": owner, "lease_expires_at": importLease()})
+	if result.Error != nil {
+		log.Printf("Failed to claim import job %d: %v", job.ID, result.Error)
+		return false
+	}
+	if result.RowsAffected != 1 {
+		return false
+	}
+	job.LeaseOwner = owner
+	return true
+}
+
+// holdImportLease renews the lease of a job until the returned function is called, which
+// releases it. The returned context is cancelled if the lease was lost to another
+// instance, which then runs the job.
+func holdImportLease(job *models.ImportJob) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	leased := func() *gorm.DB {
+		return database.GetDB().Model(&models.ImportJob{}).Where("id = ? AND lease_owner = ?", job.ID, job.LeaseOwner)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(importLeaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				result := leased().Update("lease_expires_at", importLease())
+				if result.Error != nil {
+					log.Printf("Failed to renew the lease of import job %d: %v", job.ID, result.Error)
+				} else if result.RowsAffected == 0 {
+					log.Printf("Lost the lease of import job %d to another instance, stopping", job.ID)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, func() {
+		close(done)
+		<-stopped
+		cancel()
+		if err := leased().Update("lease_expires_at", nil).Error; err != nil {
+			log.Printf("Failed to release the lease of import job %d: %v", job.ID, err)
+		}
+	}
+}
+
+// runImportJob processes every unfinished item of a batch job, URL import, transform,
+// manifest import or cloud drive import. Completed and failed items are not reprocessed, so running a job again
+// after an interruption is safe. Progress is persisted and published to subscribers after
+// every item.
+func runImportJob(job *models.ImportJob, maxUploadSize int64) {
+	// Jobs outlive the request that started them, but stop once another instance took over
+	ctx, release := holdImportLease(job)
+	defer release()
+
+	items := job.Items
+	if items == nil {
+		if err := database.GetDB().Where("job_id = ?", job.ID).Order("position").Find(&items).Error; err != nil {
+			log.Printf("Failed to load items of import job %d: %v", job.ID, err)
+			return
+		}
+	}
+
+	client := &http.Client{
+		Timeout: 60 * time.Second, // Longer timeout for potentially large files
+	}
+	// Cloud drive files are downloaded with the token of the drive
+	var drive *driveAccess
+	if job.Kind == models.BatchKindCloudDrive {
+		if drive = openJobDrive(job); drive != nil {
+			client = clouddrive.NewDownloadClient(drive.provider, client.Timeout, drive.token)
+		}
+	}
+
+	// Process items concurrently with a limit
+	maxConcurrent := 5
+	sem := make(chan struct{}, maxConcurrent)
+	var wg sync.WaitGroup
+	progress := &batchProgress{job: job}
+
+	for i := range items {
+		item := &items[i]
+		if item.Status == models.ImportItemCompleted || item.Status == models.ImportItemFailed {
+			continue
+		}
+
+		sem <- struct{}{} // Acquire semaphore
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+
+		go func(item *models.ImportJobItem) {
+			defer wg.Done()
+			defer func() { <-sem }() // Release semaphore
+
+			if done := reconcileImportItem(ctx, item); done != nil {
+				progress.record(item, true)
+				return
+			}
+
+			var result gin.H
+			switch job.Kind {
+			case models.BatchKindTransform:
+				result = processTransformItem(ctx, item, job.UserID)
+			case models.BatchKindManifest:
+				result = processManifestItem(ctx, client, item, job.UserID, maxUploadSize)
+			case models.BatchKindCloudDrive:
+				result = processDriveItem(ctx, drive, client, item, job, maxUploadSize)
+			default:
+				backendName, storageProvider := storage.SelectUploadBackend()
+				result = processURLUpload(ctx, client, backendName, storageProvider, item, job.FolderID, job.UserID, maxUploadSize)
+			}
+
+			success, _ := result["success"].(bool)
+			if ctx.Err() != nil {
+				// The item is left to the instance that took the job over
+				return
+			}
+			if !success {
+				updateImportItem(item, map[string]interface{}{
+					"status": models.ImportItemFailed,
+					"error":  result["error"],
+				})
+			}
+			progress.record(item, success)
+		}(item)
+	}
+
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	completeImportJob(job)
+}
+
+// completeImportJob recounts the items of a finished job and marks it completed
+func completeImportJob(job *models.ImportJob) {
+	db := database.GetDB()
+
+	var succeeded, failed int64
+	db.Model(&models.ImportJobItem{}).Where("job_id = ? AND status = ?", job.ID, models.ImportItemCompleted).Count(&succeeded)
+	db.Model(&models.ImportJobItem{}).Where("job_id = ? AND status = ?", job.ID, models.ImportItemFailed).Count(&failed)
+
+	now := time.Now()
+	job.Succeeded = int(succeeded)
+	job.Failed = int(failed)
+	job.Status = models.ImportJobCompleted
+	job.CompletedAt = &now
+	if err := db.Model(job).Updates(map[string]interface{}{
+		"succeeded":    job.Succeeded,
+		"failed":       job.Failed,
+		"status":       job.Status,
+		"completed_at": job.CompletedAt,
+	}).Error; err != nil {
+		log.Printf("Failed to complete import job %d: %v", job.ID, err)
+	}
+
+	publishBatchEvent(job, nil)
+}
+
+// batchProgress counts the items of a running job as workers finish them
+type batchProgress struct {
+	mu  sync.Mutex
+	job *models.ImportJob
+}
+
+// record persists the outcome of one item and publishes it
+func (p *batchProgress) record(item *models.ImportJobItem, success bool) {
+	column := "failed"
+	if success {
+		column = "succeeded"
+	}
+	if err := database.GetDB().Model(&models.ImportJob{}).Where("id = ?", p.job.ID).
+		UpdateColumn(column, gorm.Expr(column+" + 1")).Error; err != nil {
+		log.Printf("Failed to update progress of import job %d: %v", p.job.ID, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if success {
+		p.job.Succeeded++
+	} else {
+		p.job.Failed++
+	}
+	publishBatchEvent(p.job, item)
+}
+
+// reconcileImportItem settles an item interrupted after its object was stored. It returns
+// the item's result if it turns out to be complete, or nil once it is ready to be processed.
+func reconcileImportItem(ctx context.Context, item *models.ImportJobItem) gin.H {
+	if item.Status != models.ImportItemStored {
+		return nil
+	}
+
+	var media models.Media
+	if err := database.GetDB().Select("id", "filename").
+		Where("path = ? AND storage_backend = ?", item.FileID, item.StorageBackend).First(&media).Error; err == nil {
+		updateImportItem(item, map[string]interface{}{
+			"status":   models.ImportItemCompleted,
+			"media_id": media.ID,
+			"filename": media.Filename,
+		})
+		return gin.H{"url": item.URL, "success": true, "media_id": media.ID, "filename": media.Filename}
+	}
+
+	// The media record was never created: drop the orphaned object and start over
+	if err := storage.GetBackend(item.StorageBackend).Delete(ctx, item.FileID); err != nil {
+		log.Printf("Failed to delete orphaned import object %s: %v", item.FileID, err)
+	}
+	updateImportItem(item, map[string]interface{}{
+		"status":          models.ImportItemPending,
+		"file_id":         "",
+		"storage_backend": "",
+	})
+	return nil
+}
+
+// updateImportItem persists item state changes, logging failures since processing continues regardless
+func updateImportItem(item *models.ImportJobItem, updates map[string]interface{}) {
+	if err := database.GetDB().Model(item).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update import item %d: %v", item.ID, err)
+	}
+}
+
+// ResumeImportJobs finishes batch jobs, URL imports, transforms, manifest imports and
+// cloud drive imports, whose instance stopped renewing their lease: at startup the jobs
+// interrupted by a restart, and from then on the jobs of instances that went down. It
+// runs until the process exits.
+func ResumeImportJobs() {
+	for {
+		resumeImportJobs()
+		time.Sleep(importLeaseDuration)
+	}
+}
+
+// resumeImportJobs claims and restarts the running jobs no instance holds
+func resumeImportJobs() {
+	cfg := config.GetConfig()
+
+	var jobs []models.ImportJob
+	if err := database.GetDB().Where("status = ? AND (lease_expires_at IS NULL OR lease_expires_at < ?)", models.ImportJobRunning, time.Now()).
+		Order("id").Find(&jobs).Error; err != nil {
+		log.Printf("Failed to load interrupted import jobs: %v", err)
+		return
+	}
+
+	for i := range jobs {
+		job := &jobs[i]
+		if !claimImportJob(job) {
+			continue
+		}
+		// Items the previous instance was working on when it stopped start over
+		if err := database.GetDB().Model(&models.ImportJobItem{}).
+			Where("job_id = ? AND status = ?", job.ID, models.ImportItemProcessing).
+			Update("status", models.ImportItemPending).Error; err != nil {
+			log.Printf("Failed to reset interrupted items of import job %d: %v", job.ID, err)
+		}
+
+		go func() {
+			log.Printf("Resuming %s job %d (%d items)", job.Kind, job.ID, job.Total)
+			runImportJob(job, cfg.Storage.MaxUploadSize)
+			log.Printf("Import job %d finished: %d succeeded, %d failed", job.ID, job.Succeeded, job.Failed)
+		}()
+	}
+}
+
+// ListImportJobs godoc
+// @Summary      List bulk URL import jobs
+// @Description  Get the current user's bulk URL import jobs, newest first
+// @Tags         media
+// @Produce      json
+// @Param        page   query     int  false  "Page number (default 1)"
+// @Param        limit  query     int  false  "Items per page (default 10)"
+// @Success      200    {object}  object{jobs=[]models.ImportJob}
+// @Failure      500    {object}  object{error=string}
+// @Router       /media/imports [get]
+// @Security     BearerAuth
+func ListImportJobs(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+
+	var jobs []models.ImportJob
+	if err := database.GetDB().Where("user_id = ? AND kind = ?", userID, models.BatchKindURLImport).
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&jobs).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch import jobs", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+// GetImportJob godoc
+// @Summary      Get a bulk URL import job
+// @Description  Get an import job with the state of each URL
+// @Tags         media
+// @Produce      json
+// @Param        id   path      int  true  "Import job ID"
+// @Success      200  {object}  object{job=models.ImportJob}
+// @Failure      404  {object}  object{error=string}
+// @Router       /media/imports/{id} [get]
+// @Security     BearerAuth
+func GetImportJob(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var job models.ImportJob
+	if err := database.GetDB().
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("position") }).
+		Where("id = ? AND user_id = ? AND kind = ?", c.Param("id"), userID, models.BatchKindURLImport).
+		First(&job).Error; err != nil {
+		c.Error(apierror.NotFound("Import job not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
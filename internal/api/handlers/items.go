@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+)
+
+// Handlers return media and folders as the DTOs in dto.go rather than the GORM models,
+// so storage details stay internal and field names follow one convention.
+
+// mediaURLBuilder builds the URLs clients fetch media from, sharing storage backends and
+// the thumbnail expiry across the items of a response
+type mediaURLBuilder struct {
+	secret           string
+	thumbnailExpires int64
+	providers        map[string]storage.Storage
+	domains          map[uint]string // Custom public domains by user
+}
+
+// newMediaURLBuilder prepares building the URLs of one response
+func newMediaURLBuilder() *mediaURLBuilder {
+	return &mediaURLBuilder{
+		secret:           config.GetConfig().JWT.Secret,
+		thumbnailExpires: thumbnailExpiry(time.Now()),
+		providers:        make(map[string]storage.Storage),
+		domains:          make(map[uint]string),
+	}
+}
+
+// provider resolves a storage backend once per response
+func (b *mediaURLBuilder) provider(name string) storage.Storage {
+	provider, ok := b.providers[name]
+	if !ok {
+		provider = storage.GetBackend(name)
+		b.providers[name] = provider
+	}
+	return provider
+}
+
+// domain looks up the public domain of a user once per response: their custom domain,
+// or else CDN_HOST
+func (b *mediaURLBuilder) domain(userID uint) string {
+	domain, ok := b.domains[userID]
+	if !ok {
+		domain = config.GetConfig().CDN.Host
+		var user models.User
+		if err := database.GetDB().Select("public_domain").First(&user, userID).Error; err == nil && user.PublicDomain != nil {
+			domain = *user.PublicDomain
+		}
+		b.domains[userID] = domain
+	}
+	return domain
+}
+
+// url returns the public URL of the stored object, on its owner's domain or the CDN if
+// there is one
+func (b *mediaURLBuilder) url(media *models.Media) string {
+	return storage.PublicURLOn(b.provider(media.StorageBackend), b.domain(media.UserID), media.Path)
+}
+
+// thumbnailURL returns a signed thumbnail URL, or "" for media without thumbnails or
+// with an expired license
+func (b *mediaURLBuilder) thumbnailURL(media *models.Media) string {
+	if !thumbnailSupported(media) || licenseExpired(media) {
+		return ""
+	}
+	return signedThumbnailURL(b.secret, media, defaultThumbnailSize, b.thumbnailExpires)
+}
+
+// item maps a media record to its API representation
+func (b *mediaURLBuilder) item(media *models.Media) MediaItem {
+	return MediaItem{
+		ID:             media.ID,
+		UserID:         media.UserID,
+		FolderID:       media.FolderID,
+		Filename:       media.Filename,
+		MimeType:       media.MimeType,
+		Size:           media.Size,
+		Metadata:       media.Metadata,
+		Tags:           newTagItems(media.Tags),
+		Broken:         media.Broken,
+		WorkflowStatus: media.WorkflowStatus,
+		License:        newMediaLicense(media),
+		LegalHold:      media.LegalHold,
+		RetainUntil:    media.RetainUntil,
+		URL:            b.url(media),
+		ThumbnailURL:   b.thumbnailURL(media),
+		BlurHash:       mediaBlurHash(media),
+		CreatedAt:      media.CreatedAt,
+		UpdatedAt:      media.UpdatedAt,
+	}
+}
+
+// mediaBlurHash returns the BlurHash stored in the technical metadata of media, or ""
+func mediaBlurHash(media *models.Media) string {
+	var metadata struct {
+		Technical struct {
+			Colors *utils.ImageColors `json:"colors"`
+		} `json:"technical"`
+	}
+	if json.Unmarshal(media.Metadata, &metadata) != nil || metadata.Technical.Colors == nil {
+		return ""
+	}
+	return metadata.Technical.Colors.BlurHash
+}
+
+// newMediaItem maps a single media record to its API representation
+func newMediaItem(media *models.Media) MediaItem {
+	return newMediaURLBuilder().item(media)
+}
+
+// newMediaItems maps media records to their API representation
+func newMediaItems(media []models.Media) []MediaItem {
+	urls := newMediaURLBuilder()
+	items := make([]MediaItem, len(media))
+	for i := range media {
+		items[i] = urls.item(&media[i])
+	}
+	return items
+}
+
+// newTagItems maps tags to their API representation
+func newTagItems(tags []models.Tag) []TagItem {
+	items := make([]TagItem, len(tags))
+	for i, tag := range tags {
+		items[i] = TagItem{ID: tag.ID, Name: tag.Name}
+	}
+	return items
+}
+
+// newFolderItem maps a folder to its API representation, without media counts
+func newFolderItem(folder *models.Folder) FolderItem {
+	return FolderItem{
+		ID:          folder.ID,
+		Name:        folder.Name,
+		Slug:        folder.Slug,
+		Description: folder.Description,
+		ParentID:    folder.ParentID,
+		UserID:      folder.UserID,
+		CreatedAt:   folder.CreatedAt,
+		UpdatedAt:   folder.UpdatedAt,
+	}
+}
+
+// newFolderItems maps folders to their API representation, without media counts
+func newFolderItems(folders []models.Folder) []FolderItem {
+	items := make([]FolderItem, len(folders))
+	for i := range folders {
+		items[i] = newFolderItem(&folders[i])
+	}
+	return items
+}
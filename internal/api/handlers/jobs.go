@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/api/middleware"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/scheduler"
+)
+
+// RegisterJobs registers the periodic background jobs with the scheduler
+func RegisterJobs() {
+	cfg := config.GetConfig()
+
+	scheduler.Register(scheduler.Job{
+		Name:      "orphan_cleanup",
+		Interval:  cfg.Scheduler.OrphanCleanupInterval,
+		Immediate: true,
+		Run: func() error {
+			if err := abortExpiredUploadSessions(); err != nil {
+				return err
+			}
+			if err := removeExpiredArchives(); err != nil {
+				return err
+			}
+			if err := middleware.RemoveExpiredIdempotencyKeys(); err != nil {
+				return err
+			}
+			if err := removeExpiredEmbedEvents(); err != nil {
+				return err
+			}
+			return purgeOrphanedDerivatives()
+		},
+	})
+	scheduler.Register(scheduler.Job{
+		Name:      "cache_eviction",
+		Interval:  cfg.Scheduler.CacheEvictionInterval,
+		Immediate: true,
+		Run: func() error {
+			sweepDerivatives()
+			return nil
+		},
+	})
+	scheduler.Register(scheduler.Job{
+		Name:     "lifecycle",
+		Interval: cfg.Storage.Lifecycle.Interval,
+		Run:      runLifecycleRules,
+	})
+	scheduler.Register(scheduler.Job{
+		Name:     "consistency_check",
+		Interval: cfg.Storage.Consistency.Interval,
+		Run: func() error {
+			_, err := runConsistencyCheck(context.Background(), cfg.Storage.Consistency.Repair)
+			if errors.Is(err, errConsistencyRunning) {
+				return nil
+			}
+			return err
+		},
+	})
+	if cfg.Storage.Replication.Replica != "" {
+		scheduler.Register(scheduler.Job{
+			Name:     "replica_reconcile",
+			Interval: cfg.Storage.Replication.ReconcileInterval,
+			Run: func() error {
+				_, err := reconcileMediaReplicas(true)
+				return err
+			},
+		})
+	}
+}
+
+// ListJobs godoc
+// @Summary      Background jobs
+// @Description  Schedule, last run and failures of every periodic background job
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  handlers.JobsResponse
+// @Failure      403  {object}  object{error=string}
+// @Router       /admin/jobs [get]
+// @Security     BearerAuth
+func ListJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, JobsResponse{
+		Enabled: config.GetConfig().Scheduler.Enabled,
+		Jobs:    scheduler.Status(),
+	})
+}
+
+// RunJob godoc
+// @Summary      Run a background job
+// @Description  Start a periodic background job now, whatever its schedule. Its outcome shows in GET /admin/jobs.
+// @Tags         admin
+// @Produce      json
+// @Param        name  path      string  true  "Job name"
+// @Success      202   {object}  handlers.MessageResponse
+// @Failure      403   {object}  object{error=string}
+// @Failure      404   {object}  object{error=string}
+// @Failure      409   {object}  object{error=string}
+// @Router       /admin/jobs/{name}/run [post]
+// @Security     BearerAuth
+func RunJob(c *gin.Context) {
+	err := scheduler.Trigger(c.Param("name"))
+	switch {
+	case errors.Is(err, scheduler.ErrUnknownJob):
+		c.Error(apierror.NotFound("Job not found"))
+		return
+	case errors.Is(err, scheduler.ErrJobRunning):
+		c.Error(apierror.Conflict("The job is already running"))
+		return
+	}
+	c.JSON(http.StatusAccepted, MessageResponse{Message: "Job started"})
+}
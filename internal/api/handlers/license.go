@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+const (
+	// licenseDateLayout is the form license expiry dates are read and written in
+	licenseDateLayout = "2006-01-02"
+	// maxLicenseReportDays caps how far ahead the expiring rights report looks
+	maxLicenseReportDays = 3650
+)
+
+// licenseToday is the date licenses are checked against: today in UTC, in Go and SQL
+// alike, so the check doesn't depend on the database's time zone
+func licenseToday() string {
+	return time.Now().UTC().Format(licenseDateLayout)
+}
+
+// licenseExpired reports whether the license of media ended before today
+func licenseExpired(media *models.Media) bool {
+	if media.LicenseExpiresAt == nil {
+		return false
+	}
+	return media.LicenseExpiresAt.UTC().Format(licenseDateLayout) < licenseToday()
+}
+
+// licenseCurrent narrows a media query to media without an expired license
+func licenseCurrent(query *gorm.DB) *gorm.DB {
+	return query.Where("license_expires_at IS NULL OR license_expires_at >= ?", licenseToday())
+}
+
+// newMediaLicense returns the license of media as returned with them, nil when none was set
+func newMediaLicense(media *models.Media) *MediaLicense {
+	if media.LicenseType == "" && media.RightsHolder == "" && media.LicenseExpiresAt == nil {
+		return nil
+	}
+	license := &MediaLicense{
+		Type:         media.LicenseType,
+		RightsHolder: media.RightsHolder,
+		Expired:      licenseExpired(media),
+	}
+	if media.LicenseExpiresAt != nil {
+		expires := media.LicenseExpiresAt.UTC().Format(licenseDateLayout)
+		license.ExpiresAt = &expires
+	}
+	return license
+}
+
+// publiclyShared narrows a query of media shown on public channels to those that may be
+// published: approved when WORKFLOW_PUBLISH_APPROVED_ONLY is set, and never with an
+// expired license
+func publiclyShared(query *gorm.DB) *gorm.DB {
+	return licenseCurrent(publishedOnly(query))
+}
+
+// filterLicense narrows a media query to the license_type, rights_holder and
+// license_status parameters of the request
+func filterLicense(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	types := c.QueryArray("license_type")
+	for _, licenseType := range types {
+		if !slices.Contains(models.LicenseTypes, licenseType) {
+			c.Error(apierror.InvalidField("license_type", fmt.Sprintf("Invalid license type: %s", licenseType)))
+			return nil, false
+		}
+	}
+	if len(types) > 0 {
+		query = query.Where("media.license_type IN ?", types)
+	}
+
+	if holder := c.Query("rights_holder"); holder != "" {
+		query = query.Where("media.rights_holder ILIKE ?", "%"+holder+"%")
+	}
+
+	switch status := c.Query("license_status"); status {
+	case "":
+	case "none":
+		query = query.Where("media.license_type = '' AND media.rights_holder = '' AND media.license_expires_at IS NULL")
+	case "active":
+		query = query.Where("media.license_type <> '' AND (media.license_expires_at IS NULL OR media.license_expires_at >= ?)", licenseToday())
+	case "expired":
+		query = query.Where("media.license_expires_at < ?", licenseToday())
+	default:
+		c.Error(apierror.InvalidField("license_status", "Must be none, active or expired"))
+		return nil, false
+	}
+	return query, true
+}
+
+// SetMediaLicense godoc
+// @Summary      Set the license of a media item
+// @Description  Record the license a media item is used under, who holds the rights and the last day it may be used (YYYY-MM-DD), replacing what was recorded. Media whose license expired can't be shared publicly: their embed links, oEmbed answers, embed downloads and feed entries are withdrawn. Send empty values to clear the license.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        id       path      string                            true  "Media ID"
+// @Param        license  body      handlers.SetMediaLicenseRequest  true  "License"
+// @Success      200      {object}  handlers.MediaItem
+// @Failure      400      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Failure      500      {object}  object{error=string}
+// @Router       /media/{id}/license [put]
+// @Security     BearerAuth
+func SetMediaLicense(c *gin.Context) {
+	var input SetMediaLicenseRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.Type != "" && !slices.Contains(models.LicenseTypes, input.Type) {
+		c.Error(apierror.InvalidField("type", "Must be one of "+strings.Join(models.LicenseTypes, ", ")))
+		return
+	}
+	var expiresAt *time.Time
+	if input.ExpiresAt != nil && *input.ExpiresAt != "" {
+		date, err := time.Parse(licenseDateLayout, *input.ExpiresAt)
+		if err != nil {
+			c.Error(apierror.InvalidField("expires_at", "must be a date (YYYY-MM-DD)"))
+			return
+		}
+		expiresAt = &date
+	}
+
+	userID, _ := c.Get("user_id")
+	db := database.GetDB()
+	var media models.Media
+	if err := db.Preload("Tags").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+
+	if err := db.Model(&media).Updates(map[string]interface{}{
+		"license_type":       input.Type,
+		"rights_holder":      strings.TrimSpace(input.RightsHolder),
+		"license_expires_at": expiresAt,
+	}).Error; err != nil {
+		c.Error(apierror.Internal("Failed to update license", err))
+		return
+	}
+	media.LicenseType = input.Type
+	media.RightsHolder = strings.TrimSpace(input.RightsHolder)
+	media.LicenseExpiresAt = expiresAt
+
+	notifyMediaUpdated(&media)
+	c.JSON(http.StatusOK, newMediaItem(&media))
+}
+
+// expiringLicenses lists media whose license ends within days, soonest first, for one
+// user or, with userID 0, all of them
+func expiringLicenses(c *gin.Context, userID uint) {
+	page, limit := pageParams(c)
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 0 || days > maxLicenseReportDays {
+		c.Error(apierror.InvalidField("days", "Must be between 0 and 3650"))
+		return
+	}
+
+	until := time.Now().UTC().AddDate(0, 0, days).Format(licenseDateLayout)
+	query := database.GetDB().Model(&models.Media{}).Where("license_expires_at <= ?", until)
+	if c.Query("include_expired") != "true" {
+		query = query.Where("license_expires_at >= ?", licenseToday())
+	}
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.Error(apierror.Internal("Failed to count expiring licenses", err))
+		return
+	}
+	var media []models.Media
+	if err := query.Preload("Tags").Order("license_expires_at, id").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&media).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch expiring licenses", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, ExpiringLicensesResponse{
+		Until: until,
+		Media: newMediaItems(media),
+		Pagination: Pagination{
+			CurrentPage: page,
+			TotalPages:  (total + int64(limit) - 1) / int64(limit),
+			TotalItems:  total,
+			PerPage:     limit,
+		},
+	})
+}
+
+// ListExpiringLicenses godoc
+// @Summary      Media whose rights expire soon
+// @Description  Your media whose license ends within the next days, soonest first, so rights can be renewed or the media withdrawn in time. include_expired adds media whose license already ended.
+// @Tags         media
+// @Produce      json
+// @Param        days             query     int   false  "Days ahead to cover (default 30, at most 3650)"
+// @Param        include_expired  query     bool  false  "Also list media whose license already ended"
+// @Param        page             query     int   false  "Page number (default 1)"
+// @Param        limit            query     int   false  "Items per page (default 10, at most 100)"
+// @Success      200              {object}  handlers.ExpiringLicensesResponse
+// @Failure      400              {object}  object{error=string}
+// @Failure      500              {object}  object{error=string}
+// @Router       /media/licenses/expiring [get]
+// @Security     BearerAuth
+func ListExpiringLicenses(c *gin.Context) {
+	expiringLicenses(c, c.GetUint("user_id"))
+}
+
+// ListAllExpiringLicenses godoc
+// @Summary      Media of all users whose rights expire soon
+// @Description  Media of every user whose license ends within the next days, soonest first. user_id keeps one user's media.
+// @Tags         admin
+// @Produce      json
+// @Param        days             query     int   false  "Days ahead to cover (default 30, at most 3650)"
+// @Param        include_expired  query     bool  false  "Also list media whose license already ended"
+// @Param        user_id          query     int   false  "Only media of this user"
+// @Param        page             query     int   false  "Page number (default 1)"
+// @Param        limit            query     int   false  "Items per page (default 10, at most 100)"
+// @Success      200              {object}  handlers.ExpiringLicensesResponse
+// @Failure      400              {object}  object{error=string}
+// @Failure      403              {object}  object{error=string}
+// @Failure      500              {object}  object{error=string}
+// @Router       /admin/licenses/expiring [get]
+// @Security     BearerAuth
+func ListAllExpiringLicenses(c *gin.Context) {
+	var userID uint
+	if param := c.Query("user_id"); param != "" {
+		id, err := strconv.ParseUint(param, 10, 32)
+		if err != nil || id == 0 {
+			c.Error(apierror.InvalidField("user_id", "must be a user ID"))
+			return
+		}
+		userID = uint(id)
+	}
+	expiringLicenses(c, userID)
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+)
+
+// lifecycleBatchSize is how many media items a rule is applied to at a time
+const lifecycleBatchSize = 500
+
+// runLifecycleRules applies every enabled rule once. A failing rule is logged and
+// doesn't keep the others from running.
+func runLifecycleRules() error {
+	ctx := context.Background()
+	var rules []models.LifecycleRule
+	if err := database.GetDB().Where("enabled = ?", true).Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		if err := applyLifecycleRule(ctx, rule); err != nil {
+			log.Printf("Lifecycle rule %d of folder %d failed: %v", rule.ID, rule.FolderID, err)
+		}
+		database.GetDB().Model(rule).Update("last_run_at", time.Now())
+	}
+	return nil
+}
+
+// applyLifecycleRule applies a rule to the media of its folder that are old enough
+func applyLifecycleRule(ctx context.Context, rule *models.LifecycleRule) error {
+	cutoff := time.Now().AddDate(0, 0, -rule.AfterDays)
+	folderID := strconv.FormatUint(uint64(rule.FolderID), 10)
+
+	switch rule.Action {
+	case models.LifecycleArchive:
+		return archiveMedia(ctx, rule, folderID, cutoff)
+	case models.LifecycleDelete:
+		return expireMedia(rule, folderID, cutoff)
+	case models.LifecyclePurgeTrash:
+		return purgeTrashedMedia(rule, folderID, cutoff)
+	}
+	return nil
+}
+
+// archiveMedia moves media created before cutoff to the rule's storage class. Media
+// already moved there are skipped, as are those on backends without storage classes.
+func archiveMedia(ctx context.Context, rule *models.LifecycleRule, folderID string, cutoff time.Time) error {
+	backends := storage.StorageClassBackends()
+	if len(backends) == 0 {
+		return nil
+	}
+
+	lastID := ""
+	for {
+		var batch []models.Media
+		if err := database.GetDB().Select("id", "path", "storage_backend").
+			Where("folder_id = ? AND user_id = ? AND created_at < ? AND storage_backend IN ? AND id > ?",
+				folderID, rule.UserID, cutoff, backends, lastID).
+			Where("NOT EXISTS (SELECT 1 FROM lifecycle_actions WHERE lifecycle_actions.media_id = media.id AND action = ? AND detail = ? AND error = '')",
+				models.LifecycleArchive, rule.StorageClass).
+			Order("id").Limit(lifecycleBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		actions := make([]models.LifecycleAction, len(batch))
+		for i, media := range batch {
+			actions[i] = newLifecycleAction(rule, media.ID)
+			actions[i].Detail = rule.StorageClass
+
+			changer, ok := storage.StorageClassBackend(media.StorageBackend)
+			if !ok {
+				actions[i].Error = "storage backend has no storage classes"
+				continue
+			}
+			if err := changer.SetStorageClass(ctx, media.Path, rule.StorageClass); err != nil {
+				actions[i].Error = err.Error()
+			}
+		}
+		recordLifecycleActions(actions)
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
+// expireMedia deletes media created before cutoff the way a bulk delete does: records
+// go at once, stored objects and derivatives through a background purge
+func expireMedia(rule *models.LifecycleRule, folderID string, cutoff time.Time) error {
+	for {
+		var batch []models.Media
+		// Media under legal hold or retention are left for a later run
+		if err := deletableOnly(database.GetDB().Select("id", "user_id", "path", "storage_backend")).
+			Where("folder_id = ? AND user_id = ? AND created_at < ?", folderID, rule.UserID, cutoff).
+			Order("id").Limit(lifecycleBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+
+		mediaIDs := make([]string, len(batch))
+		objects := make([]storage.PurgeObject, len(batch))
+		for i, media := range batch {
+			mediaIDs[i] = media.ID
+			objects[i] = storage.PurgeObject{Backend: media.StorageBackend, Path: media.Path, Ref: media.ID}
+		}
+		if err := database.GetDB().Where("id IN ?", mediaIDs).Delete(&models.Media{}).Error; err != nil {
+			return err
+		}
+
+		derivatives, err := detachDerivatives(mediaIDs)
+		if err != nil {
+			log.Printf("Failed to invalidate derivatives of expired media: %v", err)
+		}
+		storage.SubmitPurge(rule.UserID, append(objects, derivatives...))
+		purgeFromCDN(batch...)
+		notifyMediaDeleted(rule.UserID, mediaIDs...)
+
+		actions := make([]models.LifecycleAction, len(mediaIDs))
+		for i, id := range mediaIDs {
+			actions[i] = newLifecycleAction(rule, id)
+		}
+		recordLifecycleActions(actions)
+	}
+}
+
+// purgeTrashedMedia permanently removes the records of media deleted before cutoff.
+// Their stored objects went when they were deleted.
+func purgeTrashedMedia(rule *models.LifecycleRule, folderID string, cutoff time.Time) error {
+	db := database.GetDB()
+	for {
+		var mediaIDs []string
+		if err := deletableOnly(db.Unscoped().Model(&models.Media{})).
+			Where("folder_id = ? AND user_id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", folderID, rule.UserID, cutoff).
+			Order("id").Limit(lifecycleBatchSize).Pluck("id", &mediaIDs).Error; err != nil {
+			return err
+		}
+		if len(mediaIDs) == 0 {
+			return nil
+		}
+
+		if err := db.Exec("DELETE FROM media_tags WHERE media_id IN ?", mediaIDs).Error; err != nil {
+			return err
+		}
+		if err := db.Unscoped().Where("id IN ?", mediaIDs).Delete(&models.Media{}).Error; err != nil {
+			return err
+		}
+
+		actions := make([]models.LifecycleAction, len(mediaIDs))
+		for i, id := range mediaIDs {
+			actions[i] = newLifecycleAction(rule, id)
+		}
+		recordLifecycleActions(actions)
+	}
+}
+
+// newLifecycleAction returns the audit record of rule applied to a media item
+func newLifecycleAction(rule *models.LifecycleRule, mediaID string) models.LifecycleAction {
+	return models.LifecycleAction{
+		RuleID:   rule.ID,
+		FolderID: rule.FolderID,
+		UserID:   rule.UserID,
+		MediaID:  mediaID,
+		Action:   rule.Action,
+	}
+}
+
+// recordLifecycleActions stores audit records, logging rather than failing the run
+func recordLifecycleActions(actions []models.LifecycleAction) {
+	if err := database.GetDB().CreateInBatches(actions, lifecycleBatchSize).Error; err != nil {
+		log.Printf("Failed to record %d lifecycle actions: %v", len(actions), err)
+	}
+}
+
+// lifecycleFolder returns the folder named in the path if the user owns it, reporting
+// an error otherwise
+func lifecycleFolder(c *gin.Context) (*models.Folder, bool) {
+	userID, _ := c.Get("user_id")
+	var folder models.Folder
+	if err := database.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&folder).Error; err != nil {
+		c.Error(apierror.NotFound("Folder not found"))
+		return nil, false
+	}
+	return &folder, true
+}
+
+// validateLifecycleRule checks that only archive rules, and all of them, name a storage class
+func validateLifecycleRule(c *gin.Context, rule *models.LifecycleRule) bool {
+	switch {
+	case rule.Action == models.LifecycleArchive && rule.StorageClass == "":
+		c.Error(apierror.InvalidField("storage_class", "is required for archive rules"))
+		return false
+	case rule.Action != models.LifecycleArchive && rule.StorageClass != "":
+		c.Error(apierror.InvalidField("storage_class", "only applies to archive rules"))
+		return false
+	case rule.Action == models.LifecycleArchive && len(storage.StorageClassBackends()) == 0:
+		c.Error(apierror.New(http.StatusNotImplemented, "Archive rules need an S3 storage backend"))
+		return false
+	}
+	return true
+}
+
+// ListLifecycleRules godoc
+// @Summary      List lifecycle rules
+// @Description  Lifecycle rules of a folder
+// @Tags         folders
+// @Produce      json
+// @Param        id   path      int  true  "Folder ID"
+// @Success      200  {object}  handlers.LifecycleRulesResponse
+// @Failure      404  {object}  object{error=string}
+// @Router       /folders/{id}/lifecycle [get]
+// @Security     BearerAuth
+func ListLifecycleRules(c *gin.Context) {
+	folder, ok := lifecycleFolder(c)
+	if !ok {
+		return
+	}
+
+	rules := []models.LifecycleRule{}
+	if err := database.GetDB().Where("folder_id = ?", folder.ID).Order("id").Find(&rules).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch lifecycle rules", err))
+		return
+	}
+	c.JSON(http.StatusOK, LifecycleRulesResponse{Rules: rules})
+}
+
+// CreateLifecycleRule godoc
+// @Summary      Create a lifecycle rule
+// @Description  Archive media to a colder storage class, delete them, or purge the records of deleted media once they are after_days old. Rules are applied to the folder's own media by a background worker every LIFECYCLE_INTERVAL.
+// @Tags         folders
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                                 true  "Folder ID"
+// @Param        rule  body      handlers.CreateLifecycleRuleRequest  true  "Lifecycle rule"
+// @Success      201   {object}  models.LifecycleRule
+// @Failure      400   {object}  object{error=string}
+// @Failure      404   {object}  object{error=string}
+// @Failure      501   {object}  object{error=string}
+// @Router       /folders/{id}/lifecycle [post]
+// @Security     BearerAuth
+func CreateLifecycleRule(c *gin.Context) {
+	var input CreateLifecycleRuleRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	folder, ok := lifecycleFolder(c)
+	if !ok {
+		return
+	}
+
+	rule := models.LifecycleRule{
+		FolderID:     folder.ID,
+		UserID:       folder.UserID,
+		Action:       input.Action,
+		AfterDays:    input.AfterDays,
+		StorageClass: input.StorageClass,
+		Enabled:      input.Enabled == nil || *input.Enabled,
+	}
+	if !validateLifecycleRule(c, &rule) {
+		return
+	}
+
+	if err := database.GetDB().Create(&rule).Error; err != nil {
+		c.Error(apierror.Internal("Failed to create lifecycle rule", err))
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateLifecycleRule godoc
+// @Summary      Update a lifecycle rule
+// @Description  Change the age, storage class or enabled state of a lifecycle rule
+// @Tags         folders
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                                 true  "Folder ID"
+// @Param        rule_id  path      int                                 true  "Rule ID"
+// @Param        rule     body      handlers.UpdateLifecycleRuleRequest  true  "Changed fields"
+// @Success      200      {object}  models.LifecycleRule
+// @Failure      400      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Router       /folders/{id}/lifecycle/{rule_id} [put]
+// @Security     BearerAuth
+func UpdateLifecycleRule(c *gin.Context) {
+	var input UpdateLifecycleRuleRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	folder, ok := lifecycleFolder(c)
+	if !ok {
+		return
+	}
+
+	var rule models.LifecycleRule
+	if err := database.GetDB().Where("id = ? AND folder_id = ?", c.Param("rule_id"), folder.ID).First(&rule).Error; err != nil {
+		c.Error(apierror.NotFound("Lifecycle rule not found"))
+		return
+	}
+
+	if input.AfterDays != nil {
+		rule.AfterDays = *input.AfterDays
+	}
+	if input.StorageClass != nil {
+		rule.StorageClass = *input.StorageClass
+	}
+	if input.Enabled != nil {
+		rule.Enabled = *input.Enabled
+	}
+	if !validateLifecycleRule(c, &rule) {
+		return
+	}
+
+	if err := database.GetDB().Save(&rule).Error; err != nil {
+		c.Error(apierror.Internal("Failed to update lifecycle rule", err))
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteLifecycleRule godoc
+// @Summary      Delete a lifecycle rule
+// @Description  Delete a lifecycle rule. The actions it took stay in the audit log.
+// @Tags         folders
+// @Produce      json
+// @Param        id       path      int  true  "Folder ID"
+// @Param        rule_id  path      int  true  "Rule ID"
+// @Success      200      {object}  handlers.MessageResponse
+// @Failure      404      {object}  object{error=string}
+// @Router       /folders/{id}/lifecycle/{rule_id} [delete]
+// @Security     BearerAuth
+func DeleteLifecycleRule(c *gin.Context) {
+	folder, ok := lifecycleFolder(c)
+	if !ok {
+		return
+	}
+
+	result := database.GetDB().Where("id = ? AND folder_id = ?", c.Param("rule_id"), folder.ID).Delete(&models.LifecycleRule{})
+	if result.Error != nil {
+		c.Error(apierror.Internal("Failed to delete lifecycle rule", result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.Error(apierror.NotFound("Lifecycle rule not found"))
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Lifecycle rule deleted successfully"})
+}
+
+// ListLifecycleActions godoc
+// @Summary      Lifecycle audit log
+// @Description  Actions lifecycle rules took on the media of a folder, newest first. Failed actions carry an error.
+// @Tags         folders
+// @Produce      json
+// @Param        id       path      int  true   "Folder ID"
+// @Param        rule_id  query     int  false  "Only actions of this rule"
+// @Param        page     query     int  false  "Page number"
+// @Param        limit    query     int  false  "Items per page (default 10, at most 100)"
+// @Success      200      {object}  handlers.LifecycleActionsResponse
+// @Failure      404      {object}  object{error=string}
+// @Router       /folders/{id}/lifecycle/actions [get]
+// @Security     BearerAuth
+func ListLifecycleActions(c *gin.Context) {
+	folder, ok := lifecycleFolder(c)
+	if !ok {
+		return
+	}
+
+	page, limit := pageParams(c)
+
+	query := database.GetDB().Model(&models.LifecycleAction{}).Where("folder_id = ?", folder.ID)
+	if ruleID := c.Query("rule_id"); ruleID != "" {
+		query = query.Where("rule_id = ?", ruleID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.Error(apierror.Internal("Failed to count lifecycle actions", err))
+		return
+	}
+
+	actions := []models.LifecycleAction{}
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&actions).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch lifecycle actions", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, LifecycleActionsResponse{
+		Actions: actions,
+		Pagination: Pagination{
+			CurrentPage: page,
+			TotalPages:  (total + int64(limit) - 1) / int64(limit),
+			TotalItems:  total,
+			PerPage:     limit,
+		},
+	})
+}
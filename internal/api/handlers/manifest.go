@@ -0,0 +1,576 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+)
+
+// Manifest formats
+const (
+	ManifestCSV  = "csv"
+	ManifestJSON = "json"
+)
+
+const (
+	// maxManifestSize caps the size of an uploaded manifest file
+	maxManifestSize = 32 << 20
+	// maxManifestRows caps the rows of a single manifest import
+	maxManifestRows = 10000
+)
+
+// ManifestTags are the tags of a manifest row. In JSON they are names or tag objects as
+// exported, so an export can be imported again.
+type ManifestTags []string
+
+// UnmarshalJSON accepts an array of tag names or of objects with a name
+func (t *ManifestTags) UnmarshalJSON(data []byte) error {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	names := make(ManifestTags, 0, len(entries))
+	for _, entry := range entries {
+		var name string
+		if err := json.Unmarshal(entry, &name); err == nil {
+			names = append(names, name)
+			continue
+		}
+		var tag struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(entry, &tag); err != nil {
+			return fmt.Errorf("tags must be names or objects with a name")
+		}
+		names = append(names, tag.Name)
+	}
+	*t = names
+	return nil
+}
+
+// ImportManifest godoc
+// @Summary      Import a library from a manifest
+// @Description  Ingest a CSV or JSON manifest as a background batch job, one item per row. A row either downloads url or, for admins, registers the existing object storage_key on backend (the primary backend by default), with an optional filename, folder_id or slash-separated folder path (created as needed), tags and a metadata object merged into the media metadata. CSV manifests name these columns in a header row, with tags separated by semicolons and metadata as JSON; other columns are ignored, so exports can be imported again. Rows that fail validation are recorded as failed items right away. Follow the job with GET /batches/{id}.
+// @Tags         batches
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        manifest  formData  file    true   "CSV or JSON manifest"
+// @Param        format    formData  string  false  "Manifest format (csv, json); by default from the file extension"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      202       {object}  handlers.BatchAcceptedResponse
+// @Failure      400       {object}  object{error=string}
+// @Failure      413       {object}  object{error=string}
+// @Failure      500       {object}  object{error=string}
+// @Router       /import [post]
+// @Security     BearerAuth
+func ImportManifest(c *gin.Context) {
+	cfg := config.GetConfig()
+	userID, _ := c.Get("user_id")
+
+	file, err := c.FormFile("manifest")
+	if err != nil {
+		c.Error(apierror.InvalidField("manifest", "is required"))
+		return
+	}
+	if file.Size > maxManifestSize {
+		c.Error(apierror.New(http.StatusRequestEntityTooLarge, "Manifest too large"))
+		return
+	}
+
+	format := strings.ToLower(c.PostForm("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Filename)), ".")
+	}
+	if format != ManifestCSV && format != ManifestJSON {
+		c.Error(apierror.InvalidField("format", "must be csv or json"))
+		return
+	}
+
+	rows, err := readManifest(file, format)
+	if err != nil {
+		c.Error(apierror.InvalidField("manifest", err.Error()))
+		return
+	}
+	if len(rows) == 0 {
+		c.Error(apierror.InvalidField("manifest", "has no rows"))
+		return
+	}
+	if len(rows) > maxManifestRows {
+		c.Error(apierror.InvalidField("manifest", fmt.Sprintf("has more than %d rows", maxManifestRows)))
+		return
+	}
+
+	job := models.ImportJob{
+		UserID:         userID.(uint),
+		Kind:           models.BatchKindManifest,
+		Status:         models.ImportJobRunning,
+		LeaseOwner:     newLeaseOwner(),
+		LeaseExpiresAt: importLease(),
+		Total:          len(rows),
+	}
+	// Any unreferenced object could be claimed, so only admins register stored objects
+	var user models.User
+	if err := database.GetDB().Select("id", "role").First(&user, userID).Error; err != nil {
+		c.Error(apierror.Internal("Failed to load user", err))
+		return
+	}
+	canRegister := user.Role == models.RoleAdmin
+
+	folders := &manifestFolders{userID: userID.(uint), resolved: make(map[string]*string)}
+	for i, row := range rows {
+		item, err := manifestItem(row, canRegister, folders)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to create folders", err))
+			return
+		}
+		item.Position = i
+		if item.Status == models.ImportItemFailed {
+			job.Failed++
+		}
+		job.Items = append(job.Items, *item)
+	}
+	if err := database.GetDB().Create(&job).Error; err != nil {
+		c.Error(apierror.Internal("Failed to create import job", err))
+		return
+	}
+
+	go runImportJob(&job, cfg.Storage.MaxUploadSize)
+
+	c.JSON(http.StatusAccepted, batchAccepted(&job, "Manifest import started"))
+}
+
+// readManifest parses the rows of an uploaded manifest
+func readManifest(file *multipart.FileHeader, format string) ([]ManifestRow, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("can't be read: %v", err)
+	}
+	defer f.Close()
+
+	if format == ManifestJSON {
+		var rows []ManifestRow
+		if err := json.NewDecoder(f).Decode(&rows); err != nil {
+			return nil, fmt.Errorf("is not a JSON array of rows: %v", err)
+		}
+		return rows, nil
+	}
+	return readCSVManifest(f)
+}
+
+// readCSVManifest parses a CSV manifest whose header row names the columns
+func readCSVManifest(r io.Reader) ([]ManifestRow, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("is not valid CSV: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	_, hasURL := columns["url"]
+	_, hasKey := columns["storage_key"]
+	if !hasURL && !hasKey {
+		return nil, errors.New("needs a url or storage_key column")
+	}
+
+	var rows []ManifestRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("is not valid CSV: %v", err)
+		}
+		if len(rows) == maxManifestRows {
+			// Counted past the cap so the caller reports it
+			return append(rows, ManifestRow{}), nil
+		}
+
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := ManifestRow{
+			URL:        value("url"),
+			StorageKey: value("storage_key"),
+			Backend:    value("backend"),
+			Filename:   value("filename"),
+			FolderID:   json.Number(value("folder_id")),
+			Folder:     value("folder"),
+		}
+		for _, name := range strings.Split(value("tags"), ";") {
+			if name = strings.TrimSpace(name); name != "" {
+				row.Tags = append(row.Tags, name)
+			}
+		}
+		if metadata := value("metadata"); metadata != "" {
+			row.Metadata = json.RawMessage(metadata)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// manifestItem turns a manifest row into a pending job item, or a failed one naming what
+// is wrong with the row. Only failing to resolve a folder path is an error.
+func manifestItem(row ManifestRow, canRegister bool, folders *manifestFolders) (*models.ImportJobItem, error) {
+	tags, _ := json.Marshal(row.Tags)
+	item := &models.ImportJobItem{
+		URL:        row.URL,
+		StorageKey: row.StorageKey,
+		Filename:   row.Filename,
+		Tags:       tags,
+		Status:     models.ImportItemPending,
+	}
+	invalid := func(message string) (*models.ImportJobItem, error) {
+		item.Status = models.ImportItemFailed
+		item.Error = message
+		return item, nil
+	}
+
+	switch {
+	case row.URL != "" && row.StorageKey != "":
+		return invalid("Only one of url and storage_key may be given")
+	case row.URL != "":
+		parsed, err := url.Parse(row.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return invalid("url must be an http or https URL")
+		}
+		if row.Backend != "" {
+			return invalid("backend only applies to storage_key")
+		}
+	case row.StorageKey != "":
+		if !canRegister {
+			return invalid("Only admins may register stored objects")
+		}
+		item.StorageBackend = row.Backend
+		if item.StorageBackend == "" {
+			item.StorageBackend = storage.PrimaryBackend()
+		}
+		if !storage.BackendExists(item.StorageBackend) {
+			return invalid(fmt.Sprintf("Unknown storage backend: %s", item.StorageBackend))
+		}
+	default:
+		return invalid("Either url or storage_key is required")
+	}
+
+	if len(row.Metadata) > 0 && string(row.Metadata) != "null" {
+		var metadata map[string]interface{}
+		if err := json.Unmarshal(row.Metadata, &metadata); err != nil {
+			return invalid("metadata must be a JSON object")
+		}
+		item.Metadata = row.Metadata
+	}
+
+	if row.FolderID != "" && row.Folder != "" {
+		return invalid("Only one of folder_id and folder may be given")
+	}
+	if row.FolderID != "" {
+		folderID, ok := folders.byID(row.FolderID.String())
+		if !ok {
+			return invalid("folder_id is not one of your folders")
+		}
+		item.FolderID = folderID
+	}
+	if row.Folder != "" {
+		folderID, err := folders.byPath(row.Folder)
+		if errors.Is(err, errInvalidFolderPath) {
+			return invalid(err.Error())
+		}
+		if err != nil {
+			return nil, err
+		}
+		item.FolderID = folderID
+	}
+
+	return item, nil
+}
+
+// errInvalidFolderPath is returned for folder paths with names too long for a folder
+var errInvalidFolderPath = errors.New("folder names may be at most 255 characters")
+
+// manifestFolders resolves the folders of a manifest's rows, looking each up only once
+type manifestFolders struct {
+	userID   uint
+	resolved map[string]*string // Folder ID by "id:" or "path:" reference, nil if not the user's
+}
+
+// byID returns the ID of one of the user's folders
+func (f *manifestFolders) byID(id string) (*string, bool) {
+	key := "id:" + id
+	if folderID, ok := f.resolved[key]; ok {
+		return folderID, folderID != nil
+	}
+
+	var folder models.Folder
+	if err := database.GetDB().Where("id = ? AND user_id = ?", id, f.userID).First(&folder).Error; err != nil {
+		f.resolved[key] = nil
+		return nil, false
+	}
+	f.resolved[key] = &id
+	return &id, true
+}
+
+// byPath returns the ID of the folder at a slash-separated path of folder names below the
+// root, creating the folders missing along the way. An empty path is the root, nil.
+func (f *manifestFolders) byPath(folderPath string) (*string, error) {
+	var names []string
+	for _, name := range strings.Split(folderPath, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			if len([]rune(name)) > 255 {
+				return nil, errInvalidFolderPath
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	key := "path:" + strings.Join(names, "/")
+	if folderID, ok := f.resolved[key]; ok {
+		return folderID, nil
+	}
+
+	var parentID *uint
+	for _, name := range names {
+		query := database.GetDB().Where("user_id = ? AND name = ?", f.userID, name)
+		if parentID == nil {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *parentID)
+		}
+
+		var folder models.Folder
+		err := query.First(&folder).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			folder = models.Folder{Name: name, ParentID: parentID, UserID: f.userID}
+			if err := database.GetDB().Create(&folder).Error; err != nil {
+				return nil, err
+			}
+			notifyFolderCreated(&folder)
+		} else if err != nil {
+			return nil, err
+		}
+		id := folder.ID
+		parentID = &id
+	}
+
+	folderID := fmt.Sprint(*parentID)
+	f.resolved[key] = &folderID
+	return &folderID, nil
+}
+
+// processManifestItem imports one manifest row, downloading its URL or registering its
+// stored object
+func processManifestItem(ctx context.Context, client *http.Client, item *models.ImportJobItem, userID uint, maxUploadSize int64) gin.H {
+	if item.StorageKey != "" {
+		return registerStoredObject(ctx, item, userID, maxUploadSize)
+	}
+	backendName, storageProvider := storage.SelectUploadBackend()
+	return processURLUpload(ctx, client, backendName, storageProvider, item, item.FolderID, userID, maxUploadSize)
+}
+
+// registerStoredObject creates a media record for an object already in storage. The
+// object is read once to size, hash and sniff it; it is never deleted, even when the
+// row fails.
+func registerStoredObject(ctx context.Context, item *models.ImportJobItem, userID uint, maxUploadSize int64) gin.H {
+	key, backendName := item.StorageKey, item.StorageBackend
+	failed := func(message string) gin.H {
+		return gin.H{"storage_key": key, "success": false, "error": message}
+	}
+	// Storage and database errors are logged, as they would expose backend details
+	failedWith := func(message string, err error) gin.H {
+		log.Printf("Manifest import of %s: %s: %v", key, message, err)
+		return failed(message)
+	}
+	updateImportItem(item, map[string]interface{}{"status": models.ImportItemProcessing})
+
+	// An object backing media, deleted or not, or a derivative belongs to someone already
+	db := database.GetDB()
+	var references int64
+	if err := db.Unscoped().Model(&models.Media{}).Where("path = ?", key).Count(&references).Error; err != nil {
+		return failedWith("Failed to check the object", err)
+	}
+	if references == 0 {
+		if err := db.Model(&models.Derivative{}).Where("path = ?", key).Count(&references).Error; err != nil {
+			return failedWith("Failed to check the object", err)
+		}
+	}
+	if references > 0 {
+		return failed("Object is already in use")
+	}
+
+	filename := item.Filename
+	if filename == "" {
+		filename = path.Base(key)
+	}
+
+	storageProvider := storage.GetBackend(backendName)
+	object, err := storageProvider.Download(ctx, key)
+	if err != nil {
+		return failedWith("Failed to read object", err)
+	}
+	defer object.Close()
+
+	body, contentType, err := checkStreamFileType(object, filename)
+	if err != nil {
+		return failed(err.Error())
+	}
+
+	// Hash and size the object, keeping a copy of images for classification
+	hash := sha256.New()
+	sinks := []io.Writer{hash}
+	var spool *os.File
+	if strings.HasPrefix(contentType, "image/") {
+		spool, err = os.CreateTemp("", "manifest-import-*")
+		if err != nil {
+			return failedWith("Failed to create temp file", err)
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+		sinks = append(sinks, spool)
+	}
+	size, err := io.Copy(io.MultiWriter(sinks...), io.LimitReader(body, maxUploadSize+1))
+	if err != nil {
+		return failedWith("Failed to read object", err)
+	}
+	if size > maxUploadSize {
+		return failed("File too large")
+	}
+	if err := checkQuota(userID, size); err != nil {
+		return failed(err.Error())
+	}
+
+	mediaMetadata := &utils.MediaMetadata{
+		FileType:   utils.GetFileType(filename),
+		MimeType:   contentType,
+		Size:       size,
+		UploadedAt: time.Now().Format(time.RFC3339),
+		Format:     strings.TrimPrefix(filepath.Ext(filename), "."),
+		SHA256:     hex.EncodeToString(hash.Sum(nil)),
+	}
+	if spool != nil {
+		if analysis, err := utils.AnalyzeImage(spool); err == nil {
+			analysis.Apply(mediaMetadata)
+		} else {
+			log.Printf("Failed to analyze %s: %v", filename, err)
+		}
+	}
+
+	var tagNames []string
+	json.Unmarshal(item.Tags, &tagNames)
+	tags, err := findOrCreateTags(tagNames)
+	if err != nil {
+		return failedWith("Failed to process tags", err)
+	}
+
+	metadata := map[string]interface{}{
+		"original_name": filename,
+		"file_id":       key,
+		"import_job":    item.JobID,
+		"technical":     mediaMetadata,
+	}
+	mergeManifestMetadata(metadata, item.Metadata)
+	metadataJSON, err := json.Marshal(metadata)
+	if err != nil {
+		return failedWith("Failed to marshal metadata", err)
+	}
+
+	media := models.Media{
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		FolderID:       item.FolderID,
+		Filename:       filename,
+		Path:           key,
+		MimeType:       contentType,
+		StorageBackend: backendName,
+		Size:           size,
+		Metadata:       metadataJSON,
+	}
+
+	tx := db.Begin()
+	if err := tx.Create(&media).Error; err != nil {
+		tx.Rollback()
+		return failedWith("Failed to save media metadata", err)
+	}
+	if len(tags) > 0 {
+		if err := tx.Model(&media).Association("Tags").Append(&tags); err != nil {
+			tx.Rollback()
+			return failedWith("Failed to associate tags", err)
+		}
+	}
+	// Completing the item in the same transaction keeps a media record from being created twice
+	if err := tx.Model(item).Updates(map[string]interface{}{
+		"status":   models.ImportItemCompleted,
+		"media_id": media.ID,
+		"file_id":  key,
+		"filename": filename,
+	}).Error; err != nil {
+		tx.Rollback()
+		return failedWith("Failed to update import job", err)
+	}
+	if err := tx.Commit().Error; err != nil {
+		return failedWith("Failed to save media metadata", err)
+	}
+
+	storage.ReplicateObject(backendName, key)
+	notifyMediaCreated(&media)
+
+	return gin.H{
+		"storage_key": key,
+		"success":     true,
+		"media_id":    media.ID,
+		"filename":    filename,
+	}
+}
+
+// mergeManifestMetadata adds the custom metadata of a manifest row to a media item's
+// metadata. Keys the import recorded itself, like technical, are kept.
+func mergeManifestMetadata(metadata map[string]interface{}, custom json.RawMessage) {
+	if len(custom) == 0 {
+		return
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(custom, &fields); err != nil {
+		return
+	}
+	for name, value := range fields {
+		if _, taken := metadata[name]; !taken {
+			metadata[name] = value
+		}
+	}
+}
@@ -1,17 +1,22 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"go-media-center-example/internal/api/apierror"
 	"go-media-center-example/internal/config"
 	"go-media-center-example/internal/database"
 	"go-media-center-example/internal/models"
@@ -19,62 +24,22 @@ import (
 	"go-media-center-example/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
-// initializeStorage creates a new storage provider based on configuration
 const (
 	defaultURLExpiration = 24 * time.Hour // Default URL expiration time
 )
 
-func initializeStorage() (storage.Storage, error) {
-	cfg, err := config.Load()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load config: %v", err)
-	}
-
-	var provider storage.StorageProvider
-	switch strings.ToLower(cfg.Storage.Provider) {
-	case "seaweedfs":
-		provider = storage.SeaweedFS
-	case "s3":
-		provider = storage.S3
-	default:
-		return nil, fmt.Errorf("unsupported storage provider: %s", cfg.Storage.Provider)
-	}
-
-	storageConfig := make(map[string]string)
-
-	switch provider {
-	case storage.SeaweedFS:
-		storageConfig = map[string]string{
-			"master_url":   cfg.Storage.SeaweedFS.MasterURL,
-			"internal_url": fmt.Sprintf("http://localhost:%d", cfg.Storage.SeaweedFS.VolumePort),
-			"public_url":   fmt.Sprintf("http://localhost:%s", cfg.Server.Port),
-		}
-	case storage.S3:
-		storageConfig = map[string]string{
-			"region":            cfg.Storage.S3.Region,
-			"access_key_id":     cfg.Storage.S3.AccessKeyID,
-			"secret_access_key": cfg.Storage.S3.SecretAccessKey,
-			"bucket":            cfg.Storage.S3.BucketName,
-			"endpoint":          cfg.Storage.S3.Endpoint,
-			"force_path_style":  "true",
-			"public_url":        cfg.Storage.S3.PublicURL,
-		}
-	}
-
-	return storage.NewStorage(provider, storageConfig)
-}
-
 // ServeMediaFile handles serving media files through the application server
 // ServeMediaFile godoc
 // @Summary      Serve media file
-// @Description  Serve media file with optional transformations
+// @Description  Serve media file with optional transformations. Accepts either a Bearer token or the signed query of the file_url of GET /media/{id}.
 // @Tags         media
 // @Accept       json
 // @Produce      */*
-// @Param        filename  path      string  true   "Filename"
+// @Param        filename  path      string  true   "Media ID or storage key"
 // @Param        width     query     int     false  "Width in pixels"
 // @Param        height    query     int     false  "Height in pixels"
 // @Param        fit       query     string  false  "Fit method (contain, cover, fill)"
@@ -82,13 +47,37 @@ func initializeStorage() (storage.Storage, error) {
 // @Param        quality   query     int     false  "JPEG/WebP quality (1-100)"
 // @Param        format    query     string  false  "Output format (jpeg, png, webp)"
 // @Param        preset    query     string  false  "Transformation preset"
+// @Param        rotate    query     number  false  "Clockwise rotation in degrees (90, 180, 270 or any angle)"
+// @Param        flip      query     string  false  "Flip (h, v, hv)"
+// @Param        dpr       query     number  false  "Device pixel ratio (1-3) multiplying width and height"
+// @Param        strip     query     bool    false  "Remove EXIF, ICC and XMP (default TRANSFORM_STRIP_METADATA)"
+// @Param        colorspace  query   string  false  "Convert to a color space (srgb)"
+// @Param        blur        query   number  false  "Gaussian blur sigma (0-100)"
+// @Param        sharpen     query   number  false  "Sharpen sigma (0-100)"
+// @Param        grayscale   query   bool    false  "Convert to grayscale"
+// @Param        brightness  query   number  false  "Brightness change in percent (-100 to 100)"
+// @Param        contrast    query   number  false  "Contrast change in percent (-100 to 100)"
+// @Param        saturation  query   number  false  "Saturation change in percent (-100 to 100)"
 // @Param        fresh     query     bool    false  "Bypass cache"
+// @Param        watermark           query  string  false  "Watermark media ID, or \"default\" for the configured watermark"
+// @Param        watermark_position  query  string  false  "Watermark position (center, top-left, top-right, bottom-left, bottom-right)"
+// @Param        watermark_opacity   query  number  false  "Watermark opacity (0-1)"
+// @Param        watermark_scale     query  number  false  "Watermark width relative to the image (0-1)"
+// @Param        expires   query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token     query     string  false  "Signed URL token"
 // @Success      200       {file}    binary
+// @Success      302       "Redirect to a presigned storage URL (offload mode, originals only)"
+// @Failure      401       {object}  object{error=string}
+// @Failure      403       {object}  object{error=string}
 // @Failure      404       {object}  object{error=string}
+// @Failure      409       {object}  object{error=string}
+// @Failure      413       {object}  object{error=string}
 // @Failure      500       {object}  object{error=string}
+// @Failure      503       {object}  object{error=string}
 // @Router       /media/files/{filename} [get]
 // @Security     BearerAuth
 func ServeMediaFile(c *gin.Context) {
+	ctx := c.Request.Context()
 	filename := c.Param("filename")
 	userID, _ := c.Get("user_id")
 
@@ -106,48 +95,82 @@ func ServeMediaFile(c *gin.Context) {
 		Quality: utils.ParseIntOption(queryParams["quality"]),
 		Format:  queryParams["format"],
 		Preset:  queryParams["preset"],
-		Fresh:   queryParams["fresh"] == "true",
-	}
-
-	// Find media by filename
-	var media models.Media
-	if err := database.GetDB().Where("path LIKE ?", "%"+filename+"%").
-		Where("user_id = ?", userID).
-		First(&media).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
-		return
+		Rotate:  utils.ParseFloatOption(queryParams["rotate"]),
+		Flip:    queryParams["flip"],
+		DPR:     utils.ParseFloatOption(queryParams["dpr"]),
+		Strip:   queryParams["strip"],
+
+		Colorspace: queryParams["colorspace"],
+		Fresh:      queryParams["fresh"] == "true",
+
+		Blur:       utils.ParseFloatOption(queryParams["blur"]),
+		Sharpen:    utils.ParseFloatOption(queryParams["sharpen"]),
+		Grayscale:  queryParams["grayscale"] == "true",
+		Brightness: utils.ParseFloatOption(queryParams["brightness"]),
+		Contrast:   utils.ParseFloatOption(queryParams["contrast"]),
+		Saturation: utils.ParseFloatOption(queryParams["saturation"]),
+
+		Watermark:         queryParams["watermark"],
+		WatermarkPosition: queryParams["watermark_position"],
+		WatermarkOpacity:  utils.ParseFloatOption(queryParams["watermark_opacity"]),
+		WatermarkScale:    utils.ParseFloatOption(queryParams["watermark_scale"]),
+	}
+
+	var media *models.Media
+	var err error
+	if c.GetBool("signed_access") {
+		media, err = findSignedFile(filename)
+	} else {
+		media, err = findServedMedia(filename, userID)
 	}
-
-	// Initialize storage
-	storageProvider, err := initializeStorage()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to initialize storage: %v", err)})
+		c.Error(err)
 		return
 	}
-
-	// Get internal URL for the file using the stored file ID
-	internalURL := storageProvider.GetInternalURL(media.Path)
-
-	// Create HTTP client with appropriate timeout
-	client := &http.Client{Timeout: 10 * time.Second}
-
-	// Fetch file from storage using internal URL
-	resp, err := client.Get(internalURL)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch file: %v", err)})
-		return
+	// Players fetching the rest of a file in ranges count as a single serve. Signed URLs
+	// are fetched by whoever they were shared with, not the owner.
+	if rangeHeader := c.GetHeader("Range"); !c.GetBool("signed_access") && (rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-")) {
+		recordMediaAccess(media.UserID, media.ID, models.AccessServe)
 	}
-	defer resp.Body.Close()
 
 	// Get content type
 	contentType := media.MimeType
 
 	// Check if it's an image that needs transformation
 	if strings.HasPrefix(contentType, "image/") && !transformOptions.IsEmpty() {
-		// Apply transformations
-		transformedImage, err := utils.TransformImage(resp.Body, transformOptions)
+		if err := transformOptions.Validate(); err != nil {
+			c.Error(optionsError("", err))
+			return
+		}
+		// Videos are rendered from GIFs by the transform endpoint only
+		if transformOptions.IsVideoFormat() {
+			c.Error(apierror.InvalidField("format", fmt.Sprintf("%s output is only supported for GIF images, through POST /media/{id}/transform", transformOptions.Format)))
+			return
+		}
+		// The pixel ratio is folded into the size, so equivalent requests share an ETag
+		transformOptions.ApplyDPR()
+		etag := fmt.Sprintf("%s-%v", media.ID, transformOptions)
+		if _, err := resolveWatermark(ctx, &transformOptions, userID); err != nil {
+			c.Error(watermarkError("", err))
+			return
+		}
+
+		// Apply transformations, sharing the work with identical concurrent requests
+		transformedImage, _, err := pooledTransform(ctx, "serve_"+media.ID+"_"+etag, func(ctx context.Context) ([]byte, error) {
+			reader, err := storage.GetBackend(media.StorageBackend).Download(ctx, media.Path)
+			if err != nil {
+				return nil, &transformFailure{message: "Failed to fetch file", err: err}
+			}
+			defer reader.Close()
+
+			transformed, err := utils.TransformImage(reader, transformOptions)
+			if err != nil {
+				return nil, &transformFailure{message: "Failed to transform image", err: err}
+			}
+			return transformed, nil
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to transform image: %v", err)})
+			reportTransformError(c, err)
 			return
 		}
 
@@ -163,8 +186,8 @@ func ServeMediaFile(c *gin.Context) {
 
 		// Set cache control headers
 		if !transformOptions.Fresh {
-			c.Header("Cache-Control", "public, max-age=31536000") // Cache for 1 year
-			c.Header("ETag", fmt.Sprintf("%s-%v", filename, transformOptions))
+			setCacheControl(c, contentType)
+			c.Header("ETag", etag)
 		} else {
 			c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 		}
@@ -178,12 +201,120 @@ func ServeMediaFile(c *gin.Context) {
 		return
 	}
 
+	// In offload mode clients fetch originals straight from storage
+	cfg := config.GetConfig()
+	if offload := cfg.Storage.Offload; offload.Enabled && media.Size >= offload.MinSize {
+		presignedURL, err := storage.GetBackend(media.StorageBackend).GetPresignedURL(ctx, media.Path, offload.URLExpiration)
+		if err == nil {
+			// The presigned URL expires, so the redirect itself must not be cached
+			c.Header("Cache-Control", "no-store")
+			c.Redirect(http.StatusFound, presignedURL)
+			return
+		}
+		log.Printf("Failed to presign %s, proxying instead: %v", media.Path, err)
+	}
+
+	// Fetch file through the shared provider so hot originals are served from the local cache
+	reader, err := storage.GetBackend(media.StorageBackend).Download(ctx, media.Path)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch file", err))
+		return
+	}
+	defer reader.Close()
+
 	// For non-image files or no transformation needed
+	setCacheControl(c, contentType)
 	c.Header("Content-Type", contentType)
 	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", media.Filename))
 
-	// Stream the original file
-	c.DataFromReader(http.StatusOK, resp.ContentLength, contentType, resp.Body, nil)
+	// Originals in the disk cache are local files, which are served with range
+	// requests and handed to the kernel without copying through user space
+	if file, ok := reader.(*os.File); ok {
+		http.ServeContent(passthroughWriter{c.Writer}, c.Request, media.Filename, media.UpdatedAt, file)
+		return
+	}
+
+	// Stream the original file as it arrives from storage
+	c.DataFromReader(http.StatusOK, -1, contentType, reader, nil)
+}
+
+// passthroughWriter lets io.Copy reach the connection's ReadFrom, which sends files with
+// sendfile. Responses wrapped by middleware, such as compressed ones, are copied as usual.
+type passthroughWriter struct {
+	gin.ResponseWriter
+}
+
+// ReadFrom implements io.ReaderFrom
+func (w passthroughWriter) ReadFrom(r io.Reader) (int64, error) {
+	if unwrapper, ok := w.ResponseWriter.(interface{ Unwrap() http.ResponseWriter }); ok {
+		if readerFrom, ok := unwrapper.Unwrap().(io.ReaderFrom); ok {
+			w.WriteHeaderNow()
+			return readerFrom.ReadFrom(r)
+		}
+	}
+	return io.Copy(struct{ io.Writer }{w.ResponseWriter}, r)
+}
+
+// findServedMedia finds the user's media item a file URL names: by ID, by exact storage
+// key or, for URLs built before keys were unique, by filename if only one item has it
+func findServedMedia(name string, userID interface{}) (*models.Media, error) {
+	db := database.GetDB()
+
+	var media models.Media
+	if err := db.Where("id = ? AND user_id = ?", name, userID).First(&media).Error; err == nil {
+		return &media, nil
+	}
+	if err := db.Where("path = ? AND user_id = ?", name, userID).First(&media).Error; err == nil {
+		return &media, nil
+	}
+
+	var matches []models.Media
+	if err := db.Where("filename = ? AND user_id = ?", name, userID).Limit(2).Find(&matches).Error; err != nil {
+		return nil, apierror.Internal("Failed to find media", err)
+	}
+	switch len(matches) {
+	case 0:
+		return nil, apierror.NotFound("Media not found")
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, apierror.Conflict("Several media items have this filename, request the file by media ID")
+	}
+}
+
+// signFile signs the media ID and the whole query of a file URL, expiry included, so
+// transform parameters can't be added to a signed URL
+func signFile(secret, mediaID string, query url.Values) string {
+	return utils.SignParams(secret, "file", mediaID, proxyCanonicalQuery(query))
+}
+
+// VerifyFileToken checks the signature and expiry of a signed file request
+func VerifyFileToken(c *gin.Context) bool {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	cfg := config.GetConfig()
+	return utils.VerifyParams(cfg.JWT.Secret, c.Query("token"), "file", c.Param("filename"), proxyCanonicalQuery(c.Request.URL.Query()))
+}
+
+// signedFileURL builds a file URL that can be fetched without an Authorization header
+func signedFileURL(secret string, media *models.Media, expires int64) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("token", signFile(secret, media.ID, query))
+	return fmt.Sprintf("/api/v1/media/files/%s?%s", url.PathEscape(media.ID), query.Encode())
+}
+
+// findSignedFile finds the media item a signed file URL names. Signed URLs carry no
+// user, so only published media with a current license is served.
+func findSignedFile(mediaID string) (*models.Media, error) {
+	var media models.Media
+	if err := publiclyShared(database.GetDB().Where("id = ?", mediaID)).First(&media).Error; err != nil {
+		return nil, apierror.NotFound("Media not found")
+	}
+	return &media, nil
 }
 
 // UploadMedia godoc
@@ -192,75 +323,151 @@ func ServeMediaFile(c *gin.Context) {
 // @Tags         media
 // @Accept       multipart/form-data
 // @Produce      json
-// @Param        file       formData  file      true   "Media file"
-// @Param        folder_id  formData  string    false  "Folder ID"
-// @Param        tags       formData  []string  false  "Tags"
-// @Success      200        {object}  object{message=string,media=models.Media}
+// @Param        file           formData  file      true   "Media file"
+// @Param        folder_id      formData  string    false  "Folder ID"
+// @Param        tags           formData  []string  false  "Tags"
+// @Param        storage_class  formData  string    false  "S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING, GLACIER_IR)"
+// @Param        encryption     formData  string    false  "S3 server-side encryption (AES256, aws:kms)"
+// @Param        conflict   query     string    false  "Duplicate filename policy (rename, replace, skip, fail; default rename)"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      200        {object}  handlers.MediaResponse
 // @Failure      400        {object}  object{error=string}
+// @Failure      409        {object}  object{error=string}
+// @Failure      413        {object}  object{error=string}
+// @Failure      415        {object}  object{error=string}
 // @Failure      500        {object}  object{error=string}
+// @Failure      501        {object}  object{error=string}
 // @Router       /media/upload [post]
 // @Security     BearerAuth
 func UploadMedia(c *gin.Context) {
-	cfg, _ := config.Load()
+	uploadMedia(c, nil)
+}
+
+// uploadMedia stores a file posted as a multipart form. Uploads through a widget token are
+// held to its folder, size and file types, can't replace files or pick storage options,
+// and count against its uploads.
+func uploadMedia(c *gin.Context, widget *models.WidgetToken) {
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
 	userID, _ := c.Get("user_id")
 
 	file, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		c.Error(apierror.InvalidField("file", "is required"))
+		return
+	}
+
+	maxSize := cfg.Storage.MaxUploadSize
+	var narrower []config.FileTypeConfig
+	if widget != nil {
+		maxSize = min(maxSize, widget.MaxSize)
+		narrower = append(narrower, config.FileTypeConfig{AllowedTypes: widget.AllowedTypes})
+	}
+	if file.Size > maxSize || file.Size == 0 {
+		c.Error(apierror.BadRequest("File too large"))
 		return
 	}
 
-	if file.Size > cfg.Storage.MaxUploadSize || file.Size == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large"})
+	if err := checkFormFileType(file, narrower...); err != nil {
+		c.Error(fileTypeError(err))
 		return
 	}
 
-	// Extract detailed metadata
-	mediaMetadata, err := utils.ExtractMetadata(file)
+	// Widgets always rename, so they can neither overwrite files nor probe for them
+	policy := ConflictRename
+	var objectOptions storage.ObjectOptions
+	if widget == nil {
+		if policy, err = conflictPolicy(c); err != nil {
+			c.Error(apierror.InvalidField("conflict", err.Error()))
+			return
+		}
+		var optionsErr *apierror.Error
+		if objectOptions, optionsErr = formStorageOptions(c); optionsErr != nil {
+			c.Error(optionsErr)
+			return
+		}
+	}
+
+	// Get folder ID if provided
+	folderID := c.PostForm("folder_id")
+	if widget != nil {
+		if folderID != "" && (widget.FolderID == nil || folderID != *widget.FolderID) {
+			c.Error(apierror.InvalidField("folder_id", "is not the folder of this widget token"))
+			return
+		}
+		folderID = ""
+		if widget.FolderID != nil {
+			folderID = *widget.FolderID
+		}
+	}
+	var fID *string
+	if folderID != "" {
+		fID = &folderID
+		// Verify folder exists and belongs to user
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", folderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.InvalidField("folder_id", "is not one of your folders"))
+			return
+		}
+	}
+
+	// Apply the duplicate filename policy before anything is stored
+	resolution, err := resolveFilenameConflict(userID.(uint), fID, file.Filename, policy)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to extract metadata: %v", err)})
+		if errors.Is(err, errFilenameConflict) {
+			c.Error(apierror.Conflict(err.Error()))
+			return
+		}
+		c.Error(apierror.Internal("Failed to check for duplicate filenames", nil))
+		return
+	}
+	if resolution.Skip {
+		c.JSON(http.StatusOK, MediaResponse{
+			Message: "File skipped: a file with this name already exists",
+			Skipped: true,
+			Media:   newMediaItem(resolution.Existing),
+		})
+		return
+	}
+	filename := resolution.Filename
+
+	if err := checkQuota(userID.(uint), file.Size-resolution.replacedSize()); err != nil {
+		c.Error(quotaError(err))
 		return
 	}
 
-	// Initialize storage
-	storageProvider, err := initializeStorage()
+	if widget != nil && !claimWidgetUpload(c, widget) {
+		return
+	}
+
+	// Extract detailed metadata
+	mediaMetadata, err := utils.ExtractMetadata(ctx, file)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to initialize storage: %v", err)})
+		c.Error(apierror.Internal("Failed to extract metadata", err))
+		return
+	}
+
+	// Pick the healthiest backend for the new object
+	backendName, storageProvider, ok := selectUploadBackend(c, objectOptions)
+	if !ok {
 		return
 	}
 
 	// Open the file for reading
 	f, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to open file: %v", err)})
+		c.Error(apierror.Internal("Failed to open file", err))
 		return
 	}
 	defer f.Close()
 
 	// Upload file to storage
-	fileID, err := storageProvider.Upload(f, file.Filename)
+	fileID, err := storageProvider.Upload(ctx, trackUpload(userID.(uint), filename, f, file.Size), mediaObjectName(filename))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload file: %v", err)})
+		c.Error(apierror.Internal("Failed to upload file", err))
 		return
 	}
 
-	// Get both internal and public URLs for the file
-	fileInternalURL := storageProvider.GetInternalURL(fileID)
-	filePublicURL := storageProvider.GetPublicURL(fileID)
-
-	// Get folder ID if provided
-	folderID := c.PostForm("folder_id")
-	var fID *string
-	if folderID != "" {
-		fID = &folderID
-		// Verify folder exists and belongs to user
-		var folder models.Folder
-		if err := database.GetDB().Where("id = ? AND user_id = ?", folderID, userID).First(&folder).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
-			return
-		}
-	}
-
 	// Handle tags if provided
 	var tags []models.Tag
 	if tagNames := c.PostFormArray("tags"); len(tagNames) > 0 {
@@ -269,7 +476,7 @@ func UploadMedia(c *gin.Context) {
 			// Find or create tag
 			result := database.GetDB().Where("name = ?", name).FirstOrCreate(&tag, models.Tag{Name: name})
 			if result.Error != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process tags"})
+				c.Error(apierror.Internal("Failed to process tags", result.Error))
 				return
 			}
 			tags = append(tags, tag)
@@ -280,28 +487,48 @@ func UploadMedia(c *gin.Context) {
 	metadata := map[string]interface{}{
 		"original_name": file.Filename,
 		"file_id":       fileID,
-		"internal_url":  fileInternalURL,
-		"public_url":    filePublicURL,
 		"technical":     mediaMetadata,
 	}
+	if widget != nil {
+		metadata["widget_token"] = widget.ID
+	}
 
 	// Convert metadata to JSON
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to marshal metadata: %v", err)})
+		c.Error(apierror.Internal("Failed to marshal metadata", err))
+		return
+	}
+
+	// Replace policy: the existing record becomes a new version of the file
+	if resolution.Existing != nil {
+		previousPath, previousBackend := resolution.Existing.Path, resolution.Existing.StorageBackend
+		if err := replaceMediaContent(ctx, backendName, storageProvider, resolution.Existing, fileID, mediaMetadata.MimeType, file.Size, metadataJSON); err != nil {
+			if fileID != previousPath || backendName != previousBackend {
+				discardObject(ctx, storageProvider, fileID)
+			}
+			c.Error(apierror.Internal("Failed to replace media", err))
+			return
+		}
+		c.JSON(http.StatusOK, MediaResponse{
+			Message:  "File replaced successfully",
+			Replaced: true,
+			Media:    newMediaItem(resolution.Existing),
+		})
 		return
 	}
 
 	// Save to database
 	media := models.Media{
-		ID:       fileID,
-		UserID:   userID.(uint),
-		FolderID: fID,
-		Filename: file.Filename,
-		Path:     fileID,
-		MimeType: mediaMetadata.MimeType,
-		Size:     file.Size,
-		Metadata: metadataJSON,
+		ID:             uuid.NewString(),
+		UserID:         userID.(uint),
+		FolderID:       fID,
+		Filename:       filename,
+		Path:           fileID,
+		MimeType:       mediaMetadata.MimeType,
+		StorageBackend: backendName,
+		Size:           file.Size,
+		Metadata:       metadataJSON,
 	}
 
 	// Create with transaction
@@ -309,16 +536,14 @@ func UploadMedia(c *gin.Context) {
 	if err := tx.Model(&models.Media{}).Create(&media).Error; err != nil {
 		tx.Rollback()
 		// Clean up uploaded file
-		storageProvider.Delete(fileID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save media metadata: %v", err)})
+		discardObject(ctx, storageProvider, fileID)
+		c.Error(apierror.Internal("Failed to save media metadata", err))
 		return
 	}
 	tx.Commit()
+	notifyMediaCreated(&media)
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "File uploaded successfully",
-		"media":   media,
-	})
+	c.JSON(http.StatusOK, MediaResponse{Message: "File uploaded successfully", Media: newMediaItem(&media)})
 }
 
 // UploadMediaFromURL handles uploading media from a URL
@@ -328,51 +553,72 @@ func UploadMedia(c *gin.Context) {
 // @Tags         media
 // @Accept       json
 // @Produce      json
-// @Param        input  body      object{url=string,filename=string,folder_id=string,tags=[]string}  true  "URL upload data"
-// @Success      200    {object}  object{message=string,media=models.Media}
+// @Param        input  body      object{url=string,filename=string,folder_id=string,tags=[]string,conflict=string,storage_class=string,encryption=string}  true  "URL upload data (conflict: rename, replace, skip, fail)"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      200    {object}  handlers.MediaResponse
 // @Failure      400    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      413    {object}  object{error=string}
+// @Failure      415    {object}  object{error=string}
 // @Failure      500    {object}  object{error=string}
+// @Failure      501    {object}  object{error=string}
 // @Router       /media/upload-url [post]
 // @Security     BearerAuth
 func UploadMediaFromURL(c *gin.Context) {
-	cfg, _ := config.Load()
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
 	userID, _ := c.Get("user_id")
 
-	var input struct {
-		URL      string   `json:"url" binding:"required"`
-		Filename string   `json:"filename"`
-		FolderID string   `json:"folder_id"`
-		Tags     []string `json:"tags"`
+	var input URLImportRequest
+
+	if !bindJSON(c, &input) {
+		return
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+	if input.Conflict == "" {
+		input.Conflict = c.Query("conflict")
+	}
+	policy, err := parseConflictPolicy(input.Conflict)
+	if err != nil {
+		c.Error(apierror.InvalidField("conflict", err.Error()))
 		return
 	}
 
+	// Handle folder ID if provided
+	var fID *string
+	if input.FolderID != "" {
+		fID = &input.FolderID
+		// Verify folder exists and belongs to user
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", input.FolderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.InvalidField("folder_id", "is not one of your folders"))
+			return
+		}
+	}
+
 	// Download file from URL
 	client := &http.Client{
 		Timeout: 60 * time.Second, // Longer timeout for potentially large files
 	}
 	resp, err := client.Get(input.URL)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to download from URL: %v", err)})
+		c.Error(apierror.BadRequest(fmt.Sprintf("Failed to download from URL: %v", err)))
 		return
 	}
 
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to download from URL: status code %d", resp.StatusCode)})
+		c.Error(apierror.BadRequest(fmt.Sprintf("Failed to download from URL: status code %d", resp.StatusCode)))
 		return
 	}
 
 	// Check content length if available and ensure it's not zero
 	if resp.ContentLength > cfg.Storage.MaxUploadSize || resp.ContentLength == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large"})
+		c.Error(apierror.BadRequest("File too large"))
 		return
 	}
-	contentType := resp.Header.Get("Content-Type")
+
 	// Determine filename if not provided
 	filename := input.Filename
 	if filename == "" {
@@ -408,73 +654,74 @@ func UploadMediaFromURL(c *gin.Context) {
 		}
 	}
 
-	// Initialize storage
-	storageProvider, err := initializeStorage()
+	// Sniff the start of the body without consuming it; the sniffed type is recorded
+	// rather than the one the remote server claims
+	body, contentType, err := checkStreamFileType(resp.Body, filename)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to initialize storage: %v", err)})
+		c.Error(fileTypeError(err))
 		return
 	}
 
-	// Upload file to storage
-	fileID, err := storageProvider.Upload(resp.Body, filename)
+	// Apply the duplicate filename policy before anything is stored
+	resolution, err := resolveFilenameConflict(userID.(uint), fID, filename, policy)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload file: %v", err)})
+		if errors.Is(err, errFilenameConflict) {
+			c.Error(apierror.Conflict(err.Error()))
+			return
+		}
+		c.Error(apierror.Internal("Failed to check for duplicate filenames", nil))
 		return
 	}
-
-	// Get file size and metadata
-	// We need to download the file again to get metadata
-	fileResp, err := client.Get(storageProvider.GetInternalURL(fileID))
-	if err != nil {
-		// Clean up the uploaded file if we can't get metadata
-		storageProvider.Delete(fileID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process file: %v", err)})
+	if resolution.Skip {
+		c.JSON(http.StatusOK, MediaResponse{
+			Message: "File skipped: a file with this name already exists",
+			Skipped: true,
+			Media:   newMediaItem(resolution.Existing),
+		})
 		return
 	}
-	defer fileResp.Body.Close()
+	filename = resolution.Filename
 
-	// Create a temporary file to extract metadata
-	tempFile, err := os.CreateTemp("", "url-download-*")
-	if err != nil {
-		storageProvider.Delete(fileID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process file: %v", err)})
-		return
+	// The size is only known up front when the server sends a content length
+	if resp.ContentLength > 0 {
+		if err := checkQuota(userID.(uint), resp.ContentLength-resolution.replacedSize()); err != nil {
+			c.Error(quotaError(err))
+			return
+		}
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
 
-	// Copy the file content to the temp file
-	fileSize, err := io.Copy(tempFile, fileResp.Body)
-	if err != nil {
-		storageProvider.Delete(fileID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process file: %v", err)})
+	// Pick the healthiest backend for the new object
+	backendName, storageProvider, ok := selectUploadBackend(c, input.objectOptions())
+	if !ok {
 		return
 	}
 
-	// Check file size again and ensure it's not zero
-	if fileSize > cfg.Storage.MaxUploadSize || fileSize == 0 {
-		storageProvider.Delete(fileID)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large"})
+	// Upload, hash, size and sniff the body in a single pass
+	tracked := trackUpload(userID.(uint), filename, body, resp.ContentLength)
+	upload, err := streamUpload(ctx, storageProvider, tracked, filename, contentType, cfg.Storage.MaxUploadSize)
+	if err != nil {
+		if errors.Is(err, errUploadTooLarge) {
+			c.Error(apierror.BadRequest("File too large"))
+			return
+		}
+		c.Error(apierror.Internal("Failed to upload file", err))
 		return
 	}
+	defer upload.Close()
+	fileID, fileSize := upload.FileID, upload.Size
 
-	// Rewind the temp file
-	tempFile.Seek(0, 0)
-
-	// Read the first 512 bytes to detect content type
-	buffer := make([]byte, 512)
-	_, err = tempFile.Read(buffer)
-	if err != nil && err != io.EOF {
-		storageProvider.Delete(fileID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to process file: %v", err)})
+	if fileSize == 0 {
+		discardObject(ctx, storageProvider, fileID)
+		c.Error(apierror.BadRequest("File too large"))
 		return
 	}
-
-	// Reset file pointer
-	tempFile.Seek(0, 0)
-
-	// // Detect content type
-	// contentType := http.DetectContentType(buffer)
+	if resp.ContentLength < 0 {
+		if err := checkQuota(userID.(uint), fileSize-resolution.replacedSize()); err != nil {
+			discardObject(ctx, storageProvider, fileID)
+			c.Error(quotaError(err))
+			return
+		}
+	}
 
 	// Create basic metadata
 	mediaMetadata := &utils.MediaMetadata{
@@ -483,23 +730,12 @@ func UploadMediaFromURL(c *gin.Context) {
 		Size:       fileSize,
 		UploadedAt: time.Now().Format(time.RFC3339),
 		Format:     strings.TrimPrefix(filepath.Ext(filename), "."),
+		SHA256:     upload.SHA256,
 	}
-
-	// Get both internal and public URLs for the file
-	fileInternalURL := storageProvider.GetInternalURL(fileID)
-	filePublicURL := storageProvider.GetPublicURL(fileID)
-
-	// Handle folder ID if provided
-	var fID *string
-	if input.FolderID != "" {
-		fID = &input.FolderID
-		// Verify folder exists and belongs to user
-		var folder models.Folder
-		if err := database.GetDB().Where("id = ? AND user_id = ?", input.FolderID, userID).First(&folder).Error; err != nil {
-			storageProvider.Delete(fileID)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
-			return
-		}
+	if analysis, err := upload.Analyze(); err == nil {
+		analysis.Apply(mediaMetadata)
+	} else {
+		log.Printf("Failed to analyze %s: %v", filename, err)
 	}
 
 	// Handle tags if provided
@@ -510,8 +746,8 @@ func UploadMediaFromURL(c *gin.Context) {
 			// Find or create tag
 			result := database.GetDB().Where("name = ?", name).FirstOrCreate(&tag, models.Tag{Name: name})
 			if result.Error != nil {
-				storageProvider.Delete(fileID)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process tags"})
+				discardObject(ctx, storageProvider, fileID)
+				c.Error(apierror.Internal("Failed to process tags", nil))
 				return
 			}
 			tags = append(tags, tag)
@@ -523,29 +759,46 @@ func UploadMediaFromURL(c *gin.Context) {
 		"original_name": filename,
 		"source_url":    input.URL,
 		"file_id":       fileID,
-		"internal_url":  fileInternalURL,
-		"public_url":    filePublicURL,
 		"technical":     mediaMetadata,
 	}
 
 	// Convert metadata to JSON
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
-		storageProvider.Delete(fileID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to marshal metadata: %v", err)})
+		discardObject(ctx, storageProvider, fileID)
+		c.Error(apierror.Internal("Failed to marshal metadata", err))
+		return
+	}
+
+	// Replace policy: the existing record becomes a new version of the file
+	if resolution.Existing != nil {
+		previousPath, previousBackend := resolution.Existing.Path, resolution.Existing.StorageBackend
+		if err := replaceMediaContent(ctx, backendName, storageProvider, resolution.Existing, fileID, mediaMetadata.MimeType, fileSize, metadataJSON); err != nil {
+			if fileID != previousPath || backendName != previousBackend {
+				discardObject(ctx, storageProvider, fileID)
+			}
+			c.Error(apierror.Internal("Failed to replace media", err))
+			return
+		}
+		c.JSON(http.StatusOK, MediaResponse{
+			Message:  "File replaced successfully from URL",
+			Replaced: true,
+			Media:    newMediaItem(resolution.Existing),
+		})
 		return
 	}
 
 	// Save to database
 	media := models.Media{
-		ID:       fileID,
-		UserID:   userID.(uint),
-		FolderID: fID,
-		Filename: filename,
-		Path:     fileID,
-		MimeType: mediaMetadata.MimeType,
-		Size:     fileSize,
-		Metadata: metadataJSON,
+		ID:             uuid.NewString(),
+		UserID:         userID.(uint),
+		FolderID:       fID,
+		Filename:       filename,
+		Path:           fileID,
+		MimeType:       mediaMetadata.MimeType,
+		StorageBackend: backendName,
+		Size:           fileSize,
+		Metadata:       metadataJSON,
 	}
 
 	// Create with transaction
@@ -553,8 +806,8 @@ func UploadMediaFromURL(c *gin.Context) {
 	if err := tx.Model(&models.Media{}).Create(&media).Error; err != nil {
 		tx.Rollback()
 		// Clean up uploaded file
-		storageProvider.Delete(fileID)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save media metadata: %v", err)})
+		discardObject(ctx, storageProvider, fileID)
+		c.Error(apierror.Internal("Failed to save media metadata", err))
 		return
 	}
 
@@ -562,37 +815,51 @@ func UploadMediaFromURL(c *gin.Context) {
 	if len(tags) > 0 {
 		if err := tx.Model(&media).Association("Tags").Append(&tags); err != nil {
 			tx.Rollback()
-			storageProvider.Delete(fileID)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate tags"})
+			discardObject(ctx, storageProvider, fileID)
+			c.Error(apierror.Internal("Failed to associate tags", nil))
 			return
 		}
 	}
 
 	tx.Commit()
+	notifyMediaCreated(&media)
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "File uploaded successfully from URL",
-		"media":   media,
-	})
+	c.JSON(http.StatusOK, MediaResponse{Message: "File uploaded successfully from URL", Media: newMediaItem(&media)})
+}
+
+// BulkFileOptions holds per-file overrides supplied in the bulk upload file_metadata field
+type BulkFileOptions struct {
+	Tags     []string               `json:"tags"`
+	FolderID string                 `json:"folder_id"`
+	Metadata map[string]interface{} `json:"metadata"`
 }
 
 // BulkUploadMedia handles uploading multiple files at once
 // BulkUploadMedia godoc
 // @Summary      Upload multiple media files
-// @Description  Upload multiple files at once with shared folder and tags
+// @Description  Upload multiple files at once with shared folder and tags. An optional file_metadata
+// @Description  JSON field maps filename to {tags, folder_id, metadata}; its folder overrides the shared
+// @Description  folder, its tags are added to the shared tags and its metadata is stored as custom metadata.
 // @Tags         media
 // @Accept       multipart/form-data
 // @Produce      json
-// @Param        files      formData  file      true   "Media files"
-// @Param        folder_id  formData  string    false  "Folder ID"
-// @Param        tags       formData  []string  false  "Tags"
+// @Param        files          formData  file      true   "Media files"
+// @Param        folder_id      formData  string    false  "Folder ID"
+// @Param        tags           formData  []string  false  "Tags"
+// @Param        file_metadata  formData  string    false  "JSON object mapping filename to per-file tags, folder_id and metadata"
+// @Param        storage_class  formData  string    false  "S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING, GLACIER_IR)"
+// @Param        encryption     formData  string    false  "S3 server-side encryption (AES256, aws:kms)"
+// @Param        conflict       query     string    false  "Duplicate filename policy (rename, replace, skip, fail; default rename)"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
 // @Success      200        {object}  object{message=string,total=int,success_count=int,results=[]object}
 // @Failure      400        {object}  object{error=string}
 // @Failure      500        {object}  object{error=string}
+// @Failure      501        {object}  object{error=string}
 // @Router       /media/bulk-upload [post]
 // @Security     BearerAuth
 func BulkUploadMedia(c *gin.Context) {
-	cfg, _ := config.Load()
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
 	userID, _ := c.Get("user_id")
 
 	// Get folder ID if provided
@@ -603,7 +870,7 @@ func BulkUploadMedia(c *gin.Context) {
 		// Verify folder exists and belongs to user
 		var folder models.Folder
 		if err := database.GetDB().Where("id = ? AND user_id = ?", folderID, userID).First(&folder).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid folder ID"})
+			c.Error(apierror.InvalidField("folder_id", "is not one of your folders"))
 			return
 		}
 	}
@@ -616,30 +883,60 @@ func BulkUploadMedia(c *gin.Context) {
 			// Find or create tag
 			result := database.GetDB().Where("name = ?", name).FirstOrCreate(&tag, models.Tag{Name: name})
 			if result.Error != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process tags"})
+				c.Error(apierror.Internal("Failed to process tags", result.Error))
 				return
 			}
 			tags = append(tags, tag)
 		}
 	}
 
-	// Initialize storage
-	storageProvider, err := initializeStorage()
+	policy, err := conflictPolicy(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to initialize storage: %v", err)})
+		c.Error(apierror.InvalidField("conflict", err.Error()))
+		return
+	}
+
+	objectOptions, optionsErr := formStorageOptions(c)
+	if optionsErr != nil {
+		c.Error(optionsErr)
+		return
+	}
+
+	// Parse per-file options and verify every referenced folder up front
+	fileOptions := map[string]BulkFileOptions{}
+	if sidecar := c.PostForm("file_metadata"); sidecar != "" {
+		if err := json.Unmarshal([]byte(sidecar), &fileOptions); err != nil {
+			c.Error(apierror.InvalidField("file_metadata", "must be a JSON object keyed by filename"))
+			return
+		}
+	}
+	for filename, opts := range fileOptions {
+		if opts.FolderID == "" {
+			continue
+		}
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", opts.FolderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.InvalidField(fmt.Sprintf("file_metadata[%s].folder_id", filename), "is not one of your folders"))
+			return
+		}
+	}
+
+	// Pick the healthiest backend for the new object
+	backendName, storageProvider, ok := selectUploadBackend(c, objectOptions)
+	if !ok {
 		return
 	}
 
 	// Get form files
 	form, err := c.MultipartForm()
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+		c.Error(apierror.BadRequest("Failed to parse form"))
 		return
 	}
 
 	files := form.File["files"]
 	if len(files) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No files uploaded"})
+		c.Error(apierror.InvalidField("files", "is required"))
 		return
 	}
 
@@ -647,6 +944,27 @@ func BulkUploadMedia(c *gin.Context) {
 	successCount := 0
 
 	for _, file := range files {
+		// Resolve per-file folder and tags on top of the shared ones
+		opts := fileOptions[file.Filename]
+		fileFolderID := fID
+		if opts.FolderID != "" {
+			folderID := opts.FolderID
+			fileFolderID = &folderID
+		}
+		fileTags := tags
+		if len(opts.Tags) > 0 {
+			extraTags, err := findOrCreateTags(opts.Tags)
+			if err != nil {
+				results = append(results, gin.H{
+					"filename": file.Filename,
+					"success":  false,
+					"error":    "Failed to process tags",
+				})
+				continue
+			}
+			fileTags = append(append([]models.Tag{}, tags...), extraTags...)
+		}
+
 		// Check file size
 		if file.Size > cfg.Storage.MaxUploadSize {
 			results = append(results, gin.H{
@@ -657,8 +975,17 @@ func BulkUploadMedia(c *gin.Context) {
 			continue
 		}
 
+		if err := checkFormFileType(file); err != nil {
+			results = append(results, gin.H{
+				"filename": file.Filename,
+				"success":  false,
+				"error":    err.Error(),
+			})
+			continue
+		}
+
 		// Extract detailed metadata
-		mediaMetadata, err := utils.ExtractMetadata(file)
+		mediaMetadata, err := utils.ExtractMetadata(ctx, file)
 		if err != nil {
 			results = append(results, gin.H{
 				"filename": file.Filename,
@@ -668,6 +995,39 @@ func BulkUploadMedia(c *gin.Context) {
 			continue
 		}
 
+		// Apply the duplicate filename policy before anything is stored
+		resolution, err := resolveFilenameConflict(userID.(uint), fileFolderID, file.Filename, policy)
+		if err != nil {
+			errMsg := "Failed to check for duplicate filenames"
+			if errors.Is(err, errFilenameConflict) {
+				errMsg = err.Error()
+			}
+			results = append(results, gin.H{
+				"filename": file.Filename,
+				"success":  false,
+				"error":    errMsg,
+			})
+			continue
+		}
+		if resolution.Skip {
+			results = append(results, gin.H{
+				"filename": file.Filename,
+				"success":  true,
+				"skipped":  true,
+				"media_id": resolution.Existing.ID,
+			})
+			continue
+		}
+
+		if err := checkQuota(userID.(uint), file.Size-resolution.replacedSize()); err != nil {
+			results = append(results, gin.H{
+				"filename": file.Filename,
+				"success":  false,
+				"error":    err.Error(),
+			})
+			continue
+		}
+
 		// Open the file for reading
 		f, err := file.Open()
 		if err != nil {
@@ -680,7 +1040,7 @@ func BulkUploadMedia(c *gin.Context) {
 		}
 
 		// Upload file to storage
-		fileID, err := storageProvider.Upload(f, file.Filename)
+		fileID, err := storageProvider.Upload(ctx, trackUpload(userID.(uint), file.Filename, f, file.Size), mediaObjectName(resolution.Filename))
 		f.Close() // Close file after upload
 
 		if err != nil {
@@ -692,23 +1052,20 @@ func BulkUploadMedia(c *gin.Context) {
 			continue
 		}
 
-		// Get both internal and public URLs for the file
-		fileInternalURL := storageProvider.GetInternalURL(fileID)
-		filePublicURL := storageProvider.GetPublicURL(fileID)
-
 		// Create metadata combining file info and technical metadata
 		metadata := map[string]interface{}{
 			"original_name": file.Filename,
 			"file_id":       fileID,
-			"internal_url":  fileInternalURL,
-			"public_url":    filePublicURL,
 			"technical":     mediaMetadata,
 		}
+		if len(opts.Metadata) > 0 {
+			metadata["custom"] = opts.Metadata
+		}
 
 		// Convert metadata to JSON
 		metadataJSON, err := json.Marshal(metadata)
 		if err != nil {
-			storageProvider.Delete(fileID)
+			discardObject(ctx, storageProvider, fileID)
 			results = append(results, gin.H{
 				"filename": file.Filename,
 				"success":  false,
@@ -717,16 +1074,41 @@ func BulkUploadMedia(c *gin.Context) {
 			continue
 		}
 
+		// Replace policy: the existing record becomes a new version of the file
+		if resolution.Existing != nil {
+			previousPath, previousBackend := resolution.Existing.Path, resolution.Existing.StorageBackend
+			if err := replaceMediaContent(ctx, backendName, storageProvider, resolution.Existing, fileID, mediaMetadata.MimeType, file.Size, metadataJSON); err != nil {
+				if fileID != previousPath || backendName != previousBackend {
+					discardObject(ctx, storageProvider, fileID)
+				}
+				results = append(results, gin.H{
+					"filename": file.Filename,
+					"success":  false,
+					"error":    fmt.Sprintf("Failed to replace media: %v", err),
+				})
+				continue
+			}
+			successCount++
+			results = append(results, gin.H{
+				"filename": file.Filename,
+				"success":  true,
+				"replaced": true,
+				"media_id": resolution.Existing.ID,
+			})
+			continue
+		}
+
 		// Save to database
 		media := models.Media{
-			ID:       fileID,
-			UserID:   userID.(uint),
-			FolderID: fID,
-			Filename: file.Filename,
-			Path:     fileID,
-			MimeType: mediaMetadata.MimeType,
-			Size:     file.Size,
-			Metadata: metadataJSON,
+			ID:             uuid.NewString(),
+			UserID:         userID.(uint),
+			FolderID:       fileFolderID,
+			Filename:       resolution.Filename,
+			Path:           fileID,
+			MimeType:       mediaMetadata.MimeType,
+			StorageBackend: backendName,
+			Size:           file.Size,
+			Metadata:       metadataJSON,
 		}
 
 		// Create with transaction
@@ -734,7 +1116,7 @@ func BulkUploadMedia(c *gin.Context) {
 		if err := tx.Model(&models.Media{}).Create(&media).Error; err != nil {
 			tx.Rollback()
 			// Clean up uploaded file
-			storageProvider.Delete(fileID)
+			discardObject(ctx, storageProvider, fileID)
 			results = append(results, gin.H{
 				"filename": file.Filename,
 				"success":  false,
@@ -744,10 +1126,10 @@ func BulkUploadMedia(c *gin.Context) {
 		}
 
 		// Associate tags if any
-		if len(tags) > 0 {
-			if err := tx.Model(&media).Association("Tags").Append(&tags); err != nil {
+		if len(fileTags) > 0 {
+			if err := tx.Model(&media).Association("Tags").Append(&fileTags); err != nil {
 				tx.Rollback()
-				storageProvider.Delete(fileID)
+				discardObject(ctx, storageProvider, fileID)
 				results = append(results, gin.H{
 					"filename": file.Filename,
 					"success":  false,
@@ -758,12 +1140,14 @@ func BulkUploadMedia(c *gin.Context) {
 		}
 
 		tx.Commit()
+		notifyMediaCreated(&media)
 		successCount++
 
 		results = append(results, gin.H{
-			"filename": file.Filename,
-			"success":  true,
-			"media_id": media.ID,
+			"filename":        file.Filename,
+			"stored_filename": media.Filename,
+			"success":         true,
+			"media_id":        media.ID,
 		})
 	}
 
@@ -775,21 +1159,117 @@ func BulkUploadMedia(c *gin.Context) {
 	})
 }
 
-// Add helper methods to get file URLs
-func getFileURL(mediaItem *models.Media) (string, error) {
-	storageProvider, err := initializeStorage()
-	if err != nil {
-		return "", err
+// findOrCreateTags resolves tag names to tag records, creating any that don't exist yet
+func findOrCreateTags(names []string) ([]models.Tag, error) {
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		var tag models.Tag
+		if err := database.GetDB().Where("name = ?", name).FirstOrCreate(&tag, models.Tag{Name: name}).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// filterMedia applies the filters media listings and exports share: type, search,
+// folder_id, tags, class, color, workflow_status, license, custom metadata and the from/to
+// creation range. It reports invalid parameters and returns false for them.
+func filterMedia(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	classes := c.QueryArray("class")
+	for _, class := range classes {
+		if !utils.IsContentClass(class) {
+			c.Error(apierror.BadRequest(fmt.Sprintf("Invalid content class: %s", class)))
+			return nil, false
+		}
+	}
+	colors := c.QueryArray("color")
+	for _, color := range colors {
+		if !utils.IsColorName(color) {
+			c.Error(apierror.BadRequest(fmt.Sprintf("Invalid color: %s", color)))
+			return nil, false
+		}
+	}
+
+	statuses := c.QueryArray("workflow_status")
+	for _, status := range statuses {
+		if !isWorkflowStatus(status) {
+			c.Error(apierror.InvalidField("workflow_status", fmt.Sprintf("Invalid workflow status: %s", status)))
+			return nil, false
+		}
+	}
+
+	if fileType := c.Query("type"); fileType != "" {
+		query = query.Where("media.mime_type LIKE ?", fileType+"%")
+	}
+
+	if len(statuses) > 0 {
+		query = query.Where("media.workflow_status IN ?", statuses)
+	}
+
+	if folderID := c.Query("folder_id"); folderID != "" {
+		query = query.Where("media.folder_id = ?", folderID)
+	}
+
+	if len(classes) > 0 {
+		query = query.Where("media.metadata->'technical'->>'content_class' IN ?", classes)
+	}
+
+	// Media with any of the colors among its dominant ones
+	if len(colors) > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM jsonb_array_elements_text(media.metadata->'technical'->'colors'->'names') AS color WHERE color IN ?)", colors)
+	}
+
+	// A date in to includes that whole day
+	for _, bound := range []struct{ param, condition string }{
+		{"from", "media.created_at >= ?"},
+		{"to", "media.created_at < ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		at, err := parseDateParam(value, bound.param == "to")
+		if err != nil {
+			c.Error(apierror.InvalidField(bound.param, err.Error()))
+			return nil, false
+		}
+		query = query.Where(bound.condition, at)
+	}
+
+	// Filter by tags if provided: only media carrying every requested tag
+	if tags := c.QueryArray("tags"); len(tags) > 0 {
+		tagged := database.GetDB().Table("media_tags").Select("media_tags.media_id").
+			Joins("JOIN tags ON tags.id = media_tags.tag_id").
+			Where("tags.name IN ?", tags).
+			Group("media_tags.media_id").
+			Having("COUNT(DISTINCT tags.name) = ?", len(tags))
+		query = query.Where("media.id IN (?)", tagged)
 	}
-	return storageProvider.GetPublicURL(mediaItem.Path), nil
+
+	query, ok := filterLicense(c, query)
+	if !ok {
+		return nil, false
+	}
+
+	// Searches also cover custom metadata values, so both go through the defined fields
+	return filterCustomMetadata(c, query)
 }
 
-func getFileInternalURL(mediaItem *models.Media) (string, error) {
-	storageProvider, err := initializeStorage()
+// parseDateParam reads an RFC 3339 time or a YYYY-MM-DD date. With nextDay a date is
+// moved to the start of the following day, for exclusive upper bounds covering it.
+func parseDateParam(value string, nextDay bool) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	at, err := time.Parse("2006-01-02", value)
 	if err != nil {
-		return "", err
+		return time.Time{}, errors.New("must be an RFC 3339 time or a YYYY-MM-DD date")
 	}
-	return storageProvider.GetInternalURL(mediaItem.Path), nil
+	if nextDay {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, nil
 }
 
 // ListMedia godoc
@@ -801,10 +1281,21 @@ func getFileInternalURL(mediaItem *models.Media) (string, error) {
 // @Param        page       query     int        false  "Page number (default 1)"
 // @Param        limit      query     int        false  "Items per page (default 10)"
 // @Param        type       query     string     false  "File type filter"
-// @Param        search     query     string     false  "Search term"
+// @Param        search     query     string     false  "Search term, matched against filenames and text and select metadata fields"
 // @Param        folder_id  query     string     false  "Folder ID"
 // @Param        tags       query     []string   false  "Tags filter"
-// @Success      200        {object}  object{media=[]models.Media,pagination=object{current_page=int,total_pages=int,total_items=int,per_page=int}}
+// @Param        class      query     []string   false  "Content class filter (photo, screenshot, scan, graphic)"
+// @Param        color      query     []string   false  "Dominant color filter (red, orange, yellow, green, cyan, blue, purple, pink, brown, black, white, gray)"
+// @Param        from       query     string     false  "Created at or after (RFC 3339 time or YYYY-MM-DD)"
+// @Param        to         query     string     false  "Created before (RFC 3339 time, or YYYY-MM-DD including that day)"
+// @Param        workflow_status  query  []string  false  "Workflow status filter (draft, in_review, approved, rejected)"
+// @Param        meta             query  string    false  "Custom metadata filter, as meta[key]=value (a from..to range for number and date fields)"
+// @Param        license_type     query  []string  false  "License type filter"
+// @Param        rights_holder    query  string    false  "Rights holder search"
+// @Param        license_status   query  string    false  "License status filter (none, active, expired)"
+// @Param        fields     query     string     false  "Comma-separated fields to return instead of full items, e.g. id,filename,thumbnail_url"
+// @Success      200        {object}  handlers.MediaListResponse
+// @Failure      400        {object}  object{error=string}
 // @Failure      500        {object}  object{error=string}
 // @Router       /media [get]
 // @Security     BearerAuth
@@ -816,110 +1307,78 @@ func ListMedia(c *gin.Context) {
 	// Parse query parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	fileType := c.Query("type")
-	search := c.Query("search")
-	folderID := c.Query("folder_id")
-	tags := c.QueryArray("tags")
-
-	// Base query with user filter
-	query := db.Table("media").Select("DISTINCT media.*").Where("media.user_id = ?", userID)
-
-	// Apply filters
-	if fileType != "" {
-		query = query.Where("media.mime_type LIKE ?", fileType+"%")
-	}
-
-	if search != "" {
-		query = query.Where("media.filename ILIKE ?", "%"+search+"%")
-	}
-
-	if folderID != "" {
-		query = query.Where("media.folder_id = ?", folderID)
+	fields, err := parseMediaFields(c.Query("fields"))
+	if err != nil {
+		c.Error(apierror.InvalidField("fields", err.Error()))
+		return
 	}
 
-	// Filter by tags if provided
-	if len(tags) > 0 {
-		query = query.Joins("LEFT JOIN media_tags ON media_tags.media_id = media.id").
-			Joins("LEFT JOIN tags ON tags.id = media_tags.tag_id").
-			Where("tags.name IN ?", tags).
-			Group("media.id").
-			Having("COUNT(DISTINCT tags.name) = ?", len(tags))
+	// Base query with user filter
+	query, ok := filterMedia(c, db.Model(&models.Media{}).Where("media.user_id = ?", userID))
+	if !ok {
+		return
 	}
 
 	// Count total before pagination
 	var total int64
-	countQuery := db.Table("(?) as counted_media", query).Count(&total)
-	if countQuery.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count media: %v", countQuery.Error)})
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.Error(apierror.Internal("Failed to count media", err))
 		return
 	}
 
-	// Apply pagination and fetch results
+	// Apply pagination and fetch the page with its tags, or only what the fields need
 	offset := (page - 1) * limit
-	if err := query.Offset(offset).Limit(limit).
-		Order("media.created_at DESC").
-		Scan(&media).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch media: %v", err)})
+	pageQuery := query
+	if fields != nil {
+		pageQuery = pageQuery.Select(fields.columns)
+	}
+	if fields == nil || fields.tags {
+		pageQuery = pageQuery.Preload("Tags")
+	}
+	if err := pageQuery.
+		Order("media.created_at DESC, media.id DESC").
+		Offset(offset).Limit(limit).
+		Find(&media).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch media", err))
 		return
 	}
 
-	// Load tags separately to avoid JSON scanning issues
-	if err := db.Preload("Tags").Find(&media).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load tags: %v", err)})
-		return
+	pagination := Pagination{
+		CurrentPage: page,
+		TotalPages:  (total + int64(limit) - 1) / int64(limit),
+		TotalItems:  total,
+		PerPage:     limit,
 	}
 
-	// Add file URLs to the response
-	for i := range media {
-		// Parse existing metadata
-		var metadata map[string]interface{}
-		if len(media[i].Metadata) > 0 {
-			if err := json.Unmarshal(media[i].Metadata, &metadata); err != nil {
-				metadata = make(map[string]interface{})
-			}
-		} else {
-			metadata = make(map[string]interface{})
-		}
-
-		// Add URLs to metadata
-		if fileURL, err := getFileURL(&media[i]); err == nil {
-			metadata["public_url"] = fileURL
-		}
-		if internalURL, err := getFileInternalURL(&media[i]); err == nil {
-			metadata["internal_url"] = internalURL
-		}
-
-		// Convert back to JSON
-		if metadataJSON, err := json.Marshal(metadata); err == nil {
-			media[i].Metadata = metadataJSON
+	if fields != nil {
+		renderer := newMediaFieldRenderer(fields)
+		items := make([]gin.H, len(media))
+		for i := range media {
+			items[i] = renderer.render(&media[i])
 		}
+		c.JSON(http.StatusOK, gin.H{"media": items, "pagination": pagination})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"media": media,
-		"pagination": gin.H{
-			"current_page": page,
-			"total_pages":  (total + int64(limit) - 1) / int64(limit),
-			"total_items":  total,
-			"per_page":     limit,
-		},
-	})
+	c.JSON(http.StatusOK, MediaListResponse{Media: newMediaItems(media), Pagination: pagination})
 }
 
 // GetMedia godoc
 // @Summary      Get media details with presigned URL
-// @Description  Get media by ID with optional URL expiration time
+// @Description  Get media by ID. download_url is a presigned storage URL valid for expires seconds.
 // @Tags         media
 // @Accept       json
 // @Produce      json
 // @Param        id       path      string  true  "Media ID"
 // @Param        expires  query     int     false "URL expiration time in seconds (default 86400)"
-// @Success      200      {object}  object{media=models.SwaggerMedia,folder=object{id=string,name=string}}
+// @Param        fields   query     string  false "Comma-separated fields to return instead of the full item, e.g. id,filename,thumbnail_url"
+// @Success      200      {object}  handlers.MediaResponse
 // @Failure      404      {object}  object{error=string}
 // @Failure      500      {object}  object{error=string}
 // @Router       /media/{id} [get]
 // @Security     BearerAuth
 func GetMedia(c *gin.Context) {
+	ctx := c.Request.Context()
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
 
@@ -930,75 +1389,74 @@ func GetMedia(c *gin.Context) {
 		expiration = int(defaultURLExpiration.Seconds())
 	}
 
+	fields, err := parseMediaFields(c.Query("fields"))
+	if err != nil {
+		c.Error(apierror.InvalidField("fields", err.Error()))
+		return
+	}
+
+	query := database.GetDB().Where("id = ? AND user_id = ?", id, userID)
+	if fields != nil {
+		query = query.Select(fields.columns)
+	}
+	if fields == nil || fields.tags {
+		query = query.Preload("Tags")
+	}
+
 	var media models.Media
-	if err := database.GetDB().
-		Preload("Tags").
-		Where("id = ? AND user_id = ?", id, userID).
-		First(&media).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Media not found: %v", err)})
+	if err := query.First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
 		return
 	}
 
-	// Initialize storage for presigned URL
-	storageProvider, err := initializeStorage()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to initialize storage: %v", err)})
+	// Sparse items carry only the selected fields, without the presigned URL or folder
+	recordMediaAccess(userID.(uint), media.ID, models.AccessView)
+	if fields != nil {
+		c.JSON(http.StatusOK, gin.H{"media": newMediaFieldRenderer(fields).render(&media)})
 		return
 	}
 
 	// Generate presigned URL
-	presignedURL, err := storageProvider.GetPresignedURL(media.Path, time.Duration(expiration)*time.Second)
+	lifetime := time.Duration(expiration) * time.Second
+	presignedURL, err := storage.GetBackend(media.StorageBackend).GetPresignedURL(ctx, media.Path, lifetime)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate presigned URL: %v", err)})
+		c.Error(apierror.Internal("Failed to generate presigned URL", err))
 		return
 	}
-
-	// Add URLs to metadata
-	var metadata map[string]interface{}
-	if len(media.Metadata) > 0 {
-		if err := json.Unmarshal(media.Metadata, &metadata); err != nil {
-			metadata = make(map[string]interface{})
+	expiresAt := time.Now().Add(lifetime)
+	response := MediaResponse{Media: newMediaItem(&media), Access: mediaAccessOf(userID.(uint), media.ID)}
+	response.Media.DownloadURL = presignedURL
+	response.Media.DownloadURLExpiresAt = &expiresAt
+	cfg := config.GetConfig()
+	// Media whose license expired can't be shared publicly, so get no signed links
+	if !licenseExpired(&media) {
+		response.Media.FileURL = signedFileURL(cfg.JWT.Secret, &media, thumbnailExpiry(time.Now()))
+		if deepZoomSupported(&media) {
+			response.Media.DeepZoomURL = signedDeepZoomURL(cfg.JWT.Secret, &media, thumbnailExpiry(time.Now()))
 		}
-	} else {
-		metadata = make(map[string]interface{})
-	}
-
-	// Add presigned URL to metadata
-	metadata["presigned_url"] = presignedURL
-	metadata["url_expiration"] = expiration
-
-	// Convert back to JSON
-	if metadataJSON, err := json.Marshal(metadata); err == nil {
-		media.Metadata = metadataJSON
+		response.Media.EmbedURL = signedEmbedURL(publicBaseURL(c), cfg.JWT.Secret, &media, embedExpiry(time.Now()))
 	}
 
 	// Get folder info if media is in a folder
 	if media.FolderID != nil {
 		var folder models.Folder
 		if err := database.GetDB().Select("id, name").First(&folder, media.FolderID).Error; err == nil {
-			c.JSON(http.StatusOK, gin.H{
-				"media": media,
-				"folder": gin.H{
-					"id":   folder.ID,
-					"name": folder.Name,
-				},
-			})
-			return
+			response.Folder = &FolderRef{ID: folder.ID, Name: folder.Name}
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"media": media})
+	c.JSON(http.StatusOK, response)
 }
 
 // UpdateMedia godoc
 // @Summary      Update media details
-// @Description  Update filename, folder, metadata or tags for a media item
+// @Description  Update filename, folder, metadata or tags for a media item. Once admins defined custom metadata fields, metadata.custom may only hold those fields, with values of their type, and must set the required ones.
 // @Tags         media
 // @Accept       json
 // @Produce      json
 // @Param        id      path      string                  true  "Media ID"
 // @Param        input   body      object{filename=string,folder_id=string,metadata=object,tags=[]string}  true  "Media update data"
-// @Success      200     {object}  models.Media
+// @Success      200     {object}  handlers.MediaItem
 // @Failure      400     {object}  object{error=string}
 // @Failure      404     {object}  object{error=string}
 // @Failure      500     {object}  object{error=string}
@@ -1008,114 +1466,162 @@ func UpdateMedia(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
 
-	var input struct {
-		Filename string   `json:"filename"`
-		FolderID *string  `json:"folder_id"`
-		Metadata []byte   `json:"metadata"`
-		Tags     []string `json:"tags"`
-	}
+	var input UpdateMediaRequest
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &input) {
 		return
 	}
 
 	var media models.Media
 	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&media).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+
+	// A missing or empty folder_id moves the media out of its folder
+	folderID := input.FolderID
+	if folderID != nil && *folderID == "" {
+		folderID = nil
+	}
+	if folderID != nil {
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", *folderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.InvalidField("folder_id", "is not one of your folders"))
+			return
+		}
+	}
+
+	invalid, err := validateCustomMetadata(input.Metadata)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch metadata fields", err))
+		return
+	}
+	if invalid != nil {
+		c.Error(invalid)
 		return
 	}
 
 	updates := map[string]interface{}{
 		"filename":  input.Filename,
-		"folder_id": input.FolderID,
+		"folder_id": folderID,
 		"metadata":  input.Metadata,
 	}
 
+	previousFilename := media.Filename
 	if err := database.GetDB().Model(&media).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update media"})
+		c.Error(apierror.Internal("Failed to update media", err))
 		return
 	}
 
-	c.JSON(http.StatusOK, media)
+	// Document previews are converted according to the file extension
+	if media.Filename != previousFilename {
+		invalidateDerivatives(media.UserID, media.ID)
+		purgeFromCDN(media)
+	}
+	notifyMediaUpdated(&media)
+
+	c.JSON(http.StatusOK, newMediaItem(&media))
 }
 
 // DeleteMedia godoc
 // @Summary      Delete media
-// @Description  Delete media file and its metadata
+// @Description  Delete media file and its metadata. Media under legal hold or within their retention period can't be deleted.
 // @Tags         media
 // @Accept       json
 // @Produce      json
 // @Param        id   path      string  true  "Media ID"
 // @Success      200  {object}  object{message=string}
 // @Failure      404  {object}  object{error=string}
+// @Failure      409  {object}  object{error=string}
 // @Failure      500  {object}  object{error=string}
 // @Router       /media/{id} [delete]
 // @Security     BearerAuth
 func DeleteMedia(c *gin.Context) {
+	ctx := c.Request.Context()
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
 
 	var media models.Media
 	if err := database.GetDB().Where("id = ? AND user_id = ?", id, userID).First(&media).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+		c.Error(apierror.NotFound("Media not found"))
 		return
 	}
-
-	// Initialize storage
-	storageProvider, err := initializeStorage()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to initialize storage: %v", err)})
+	if mediaRetained(&media) {
+		c.Error(retainedError(&media))
 		return
 	}
 
+	storageProvider := storage.GetBackend(media.StorageBackend)
+
 	// Delete file from storage
-	if err := storageProvider.Delete(media.Path); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete file: %v", err)})
+	if err := storageProvider.Delete(ctx, media.Path); err != nil {
+		c.Error(apierror.Internal("Failed to delete file", err))
 		return
 	}
 
 	// Delete from database
 	if err := database.GetDB().Delete(&media).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete media record"})
+		c.Error(apierror.Internal("Failed to delete media record", err))
 		return
 	}
 
+	invalidateDerivatives(media.UserID, media.ID)
+	purgeFromCDN(media)
+	notifyMediaDeleted(media.UserID, media.ID)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Media deleted successfully"})
 }
 
 // TransformMedia handles image transformation requests
 // TransformMedia godoc
 // @Summary      Transform image
-// @Description  Apply transformations to an image (resize, crop, format conversion)
+// @Description  Apply transformations to an image (resize, crop, format conversion). PDF and office documents are transformed from a PNG render of their first page.
 // @Tags         media
 // @Accept       json
-// @Produce      image/jpeg,image/png,image/webp
+// @Produce      image/jpeg,image/png,image/webp,video/mp4,video/webm
 // @Param        id       path      string  true   "Media ID"
 // @Param        width    query     int     false  "Width in pixels"
 // @Param        height   query     int     false  "Height in pixels"
 // @Param        fit      query     string  false  "Fit method (contain, cover, fill)"
-// @Param        crop     query     string  false  "Crop position (center, top, bottom, left, right)"
+// @Param        crop     query     string  false  "Crop position (center, top, bottom, left, right, smart)"
 // @Param        quality  query     int     false  "JPEG/WebP quality (1-100)"
-// @Param        format   query     string  false  "Output format (jpeg, png, webp)"
+// @Param        format   query     string  false  "Output format (jpeg, png, webp; mp4, webm for GIF sources)"
 // @Param        preset   query     string  false  "Transformation preset"
+// @Param        rotate   query     number  false  "Clockwise rotation in degrees (90, 180, 270 or any angle)"
+// @Param        flip     query     string  false  "Flip (h, v, hv)"
+// @Param        dpr      query     number  false  "Device pixel ratio (1-3) multiplying width and height"
+// @Param        strip    query     bool    false  "Remove EXIF, ICC and XMP (default TRANSFORM_STRIP_METADATA)"
+// @Param        colorspace  query  string  false  "Convert to a color space (srgb)"
+// @Param        blur        query  number  false  "Gaussian blur sigma (0-100)"
+// @Param        sharpen     query  number  false  "Sharpen sigma (0-100)"
+// @Param        grayscale   query  bool    false  "Convert to grayscale"
+// @Param        brightness  query  number  false  "Brightness change in percent (-100 to 100)"
+// @Param        contrast    query  number  false  "Contrast change in percent (-100 to 100)"
+// @Param        saturation  query  number  false  "Saturation change in percent (-100 to 100)"
 // @Param        fresh    query     bool    false  "Bypass cache"
+// @Param        watermark           query  string  false  "Watermark media ID, or \"default\" for the configured watermark"
+// @Param        watermark_position  query  string  false  "Watermark position (center, top-left, top-right, bottom-left, bottom-right)"
+// @Param        watermark_opacity   query  number  false  "Watermark opacity (0-1)"
+// @Param        watermark_scale     query  number  false  "Watermark width relative to the image (0-1)"
 // @Success      200      {file}    binary
 // @Failure      400      {object}  object{error=string,details=string}
 // @Failure      404      {object}  object{error=string}
+// @Failure      413      {object}  object{error=string,details=string}
 // @Failure      500      {object}  object{error=string,details=string}
+// @Failure      503      {object}  object{error=string}
 // @Router       /media/{id}/transform [get]
 // @Security     BearerAuth
 func TransformMedia(c *gin.Context) {
+	ctx := c.Request.Context()
 	mediaID := c.Param("id")
 	if mediaID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Media ID is required"})
+		c.Error(apierror.BadRequest("Media ID is required"))
 		return
 	}
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		c.Error(apierror.Unauthorized("User not authenticated"))
 		return
 	}
 
@@ -1123,16 +1629,16 @@ func TransformMedia(c *gin.Context) {
 	media, err := models.GetMediaByID(mediaID)
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+			c.Error(apierror.NotFound("Media not found"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve media"})
+		c.Error(apierror.Internal("Failed to retrieve media", nil))
 		return
 	}
 
 	// Check if media belongs to user
 	if media.UserID != userID.(uint) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		c.Error(apierror.Forbidden("Access denied"))
 		return
 	}
 	// var media models.Media
@@ -1144,9 +1650,10 @@ func TransformMedia(c *gin.Context) {
 	// 	return
 	// }
 
-	// Check if media is an image
-	if !strings.HasPrefix(media.MimeType, "image/") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Media is not an image"})
+	// Images are transformed directly, documents through a rendered first page
+	isDocument := utils.IsDocument(media.MimeType, media.Filename)
+	if !strings.HasPrefix(media.MimeType, "image/") && !isDocument {
+		c.Error(apierror.BadRequest("Media is not an image or document"))
 		return
 	}
 
@@ -1159,7 +1666,25 @@ func TransformMedia(c *gin.Context) {
 		Quality: utils.ParseIntOption(c.Query("quality")),
 		Format:  c.Query("format"),
 		Preset:  c.Query("preset"),
-		Fresh:   c.Query("fresh") == "true",
+		Rotate:  utils.ParseFloatOption(c.Query("rotate")),
+		Flip:    c.Query("flip"),
+		DPR:     utils.ParseFloatOption(c.Query("dpr")),
+		Strip:   c.Query("strip"),
+
+		Colorspace: c.Query("colorspace"),
+		Fresh:      c.Query("fresh") == "true",
+
+		Blur:       utils.ParseFloatOption(c.Query("blur")),
+		Sharpen:    utils.ParseFloatOption(c.Query("sharpen")),
+		Grayscale:  c.Query("grayscale") == "true",
+		Brightness: utils.ParseFloatOption(c.Query("brightness")),
+		Contrast:   utils.ParseFloatOption(c.Query("contrast")),
+		Saturation: utils.ParseFloatOption(c.Query("saturation")),
+
+		Watermark:         c.Query("watermark"),
+		WatermarkPosition: c.Query("watermark_position"),
+		WatermarkOpacity:  utils.ParseFloatOption(c.Query("watermark_opacity")),
+		WatermarkScale:    utils.ParseFloatOption(c.Query("watermark_scale")),
 	}
 
 	// Log transformation options for debugging
@@ -1167,41 +1692,54 @@ func TransformMedia(c *gin.Context) {
 
 	// Validate transformation options
 	if err := options.Validate(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Invalid transformation parameters",
-			"details": err.Error(),
-		})
+		c.Error(optionsError("", err))
 		return
 	}
 
 	// Apply preset if specified
 	if options.Preset != "" {
 		if err := utils.ApplyPreset(&options, options.Preset); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error":   "Invalid preset",
-				"details": err.Error(),
-			})
+			c.Error(apierror.InvalidField("preset", err.Error()))
 			return
 		}
 	}
+	options.ApplyDPR()
 
-	// Get storage provider
-	storageProvider := storage.GetProvider()
-	if storageProvider == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storage provider not initialized"})
+	// Video output is only meaningful for animated GIF sources
+	if options.IsVideoFormat() && media.MimeType != "image/gif" {
+		c.Error(apierror.InvalidField("format", fmt.Sprintf("%s output is only supported for GIF images", options.Format)))
 		return
 	}
 
-	// Read original file
-	reader, err := storageProvider.Download(media.Path)
+	// Load the watermark, if any, before touching the original
+	watermarkKey, err := resolveWatermark(ctx, &options, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to read original file",
-			"details": err.Error(),
-		})
+		c.Error(watermarkError("", err))
 		return
 	}
-	defer reader.Close()
+
+	// Set appropriate content type based on format
+	contentType := media.MimeType
+	if isDocument {
+		contentType = "image/png"
+	}
+	if options.Format != "" {
+		switch options.Format {
+		case "png":
+			contentType = "image/png"
+		case "webp":
+			contentType = "image/webp"
+		case "mp4":
+			contentType = "video/mp4"
+		case "webm":
+			contentType = "video/webm"
+		default:
+			contentType = "image/jpeg"
+		}
+	}
+
+	// Get the backend holding the original
+	storageProvider := storage.GetBackend(media.StorageBackend)
 
 	// Generate cache key for transformed image
 	cacheKey := fmt.Sprintf(
@@ -1214,56 +1752,82 @@ func TransformMedia(c *gin.Context) {
 		options.Quality,
 		options.Format,
 	)
+	if options.HasOrientation() {
+		cacheKey += fmt.Sprintf("_r%g_%s", options.Rotate, options.Flip)
+	}
+	if options.HasFilters() {
+		cacheKey += fmt.Sprintf("_b%g_s%g_g%t_br%g_ct%g_sat%g",
+			options.Blur, options.Sharpen, options.Grayscale, options.Brightness, options.Contrast, options.Saturation)
+	}
+	if watermarkKey != "" {
+		cacheKey += "_" + watermarkKey
+	}
+	if !options.StripsMetadata() {
+		cacheKey += "_meta"
+	}
+	if options.Colorspace != "" {
+		cacheKey += "_" + options.Colorspace
+	}
 
 	// Check if transformed version exists
 	if !options.Fresh {
-		if cachedReader, err := storageProvider.Download(cacheKey); err == nil {
-			defer cachedReader.Close()
-			// Read the entire file into memory since we can't seek on the reader
-			data, err := io.ReadAll(cachedReader)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read cached file"})
-				return
-			}
+		if data, ok := loadDerivative(ctx, cacheKey); ok {
 			c.Header("X-Cache", "HIT")
-			c.Data(http.StatusOK, media.MimeType, data)
+			c.Data(http.StatusOK, contentType, data)
 			return
 		}
 	}
 
-	// Transform image
-	transformed, err := utils.TransformImage(reader, options)
+	// Render once for all identical concurrent requests; the first one also fills the cache
+	transformed, shared, err := pooledTransform(ctx, cacheKey, func(ctx context.Context) ([]byte, error) {
+		return renderTransform(ctx, storageProvider, media, options, isDocument, cacheKey)
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to transform image",
-			"details": err.Error(),
-		})
+		reportTransformError(c, err)
 		return
 	}
 
-	// Upload transformed version
-	if _, err := storageProvider.UploadBytes(transformed, cacheKey); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save transformed image"})
-		return
+	// Set cache control headers
+	setCacheControl(c, contentType)
+	if shared {
+		c.Header("X-Cache", "SHARED")
+	} else {
+		c.Header("X-Cache", "MISS")
 	}
 
-	// Set cache control headers
-	c.Header("Cache-Control", "public, max-age=31536000")
-	c.Header("X-Cache", "MISS")
+	// Serve transformed image
+	c.Data(http.StatusOK, contentType, transformed)
+}
 
-	// Set appropriate content type based on format
-	contentType := media.MimeType
-	if options.Format != "" {
-		switch options.Format {
-		case "png":
-			contentType = "image/png"
-		case "webp":
-			contentType = "image/webp"
-		default:
-			contentType = "image/jpeg"
+// renderTransform reads the original, transforms it and stores the result under cacheKey
+func renderTransform(ctx context.Context, storageProvider storage.Storage, media *models.Media, options utils.TransformationOptions, isDocument bool, cacheKey string) ([]byte, error) {
+	started := time.Now()
+	reader, err := storageProvider.Download(ctx, media.Path)
+	if err != nil {
+		return nil, &transformFailure{message: "Failed to read original file", err: err}
+	}
+	defer reader.Close()
+
+	// Transform image, or convert animated GIFs to video
+	var transformed []byte
+	switch {
+	case options.IsVideoFormat():
+		transformed, err = utils.ConvertGIFToVideo(ctx, reader, options)
+	case isDocument:
+		var preview []byte
+		if preview, err = utils.RenderDocumentPreview(reader, media.Filename); err == nil {
+			transformed, err = utils.TransformImage(bytes.NewReader(preview), options)
 		}
+	default:
+		transformed, err = utils.TransformImage(reader, options)
+	}
+	if err != nil {
+		return nil, &transformFailure{message: "Failed to transform image", err: err}
 	}
 
-	// Serve transformed image
-	c.Data(http.StatusOK, contentType, transformed)
+	// Upload transformed version
+	if err := storeDerivative(ctx, media, cacheKey, transformed, time.Since(started)); err != nil {
+		return nil, &transformFailure{message: "Failed to save transformed image", err: err}
+	}
+	return transformed, nil
 }
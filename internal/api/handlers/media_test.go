@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/utils"
+)
+
+func TestSignedFileURLCoversTransformParameters(t *testing.T) {
+	const secret = "test-secret"
+	media := &models.Media{ID: "6f1c2a7e-media"}
+	u, err := url.Parse(signedFileURL(secret, media, 4102444800))
+	if err != nil {
+		t.Fatalf("signedFileURL returned an invalid URL: %v", err)
+	}
+	query := u.Query()
+	verify := func(query url.Values) bool {
+		return utils.VerifyParams(secret, query.Get("token"), "file", media.ID, proxyCanonicalQuery(query))
+	}
+	if !verify(query) {
+		t.Fatal("signed file URL does not verify as issued")
+	}
+
+	for _, param := range []string{"width", "blur", "fresh"} {
+		altered := url.Values{}
+		for key, values := range query {
+			altered[key] = values
+		}
+		altered.Set(param, "4000")
+		if verify(altered) {
+			t.Errorf("signed file URL still verifies with %s added", param)
+		}
+	}
+	if utils.VerifyParams(secret, query.Get("token"), "file", "other-media", proxyCanonicalQuery(query)) {
+		t.Error("signed file URL verifies for another media ID")
+	}
+}
@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+// metadataFieldKey is the form of custom metadata field keys, safe in JSON paths and
+// query parameters
+var metadataFieldKey = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// metadataFields returns the custom metadata fields admins defined, by key
+func metadataFields() (map[string]models.MetadataField, error) {
+	var fields []models.MetadataField
+	if err := database.GetDB().Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]models.MetadataField, len(fields))
+	for _, field := range fields {
+		byKey[field.Key] = field
+	}
+	return byKey, nil
+}
+
+// validateMetadataField checks that select fields, and only they, list distinct options
+func validateMetadataField(c *gin.Context, field *models.MetadataField) bool {
+	if field.Type != models.MetadataSelect {
+		if len(field.Options) > 0 {
+			c.Error(apierror.InvalidField("options", "only apply to select fields"))
+			return false
+		}
+		field.Options = nil
+		return true
+	}
+	if len(field.Options) == 0 {
+		c.Error(apierror.InvalidField("options", "is required for select fields"))
+		return false
+	}
+	seen := make(map[string]bool, len(field.Options))
+	for i, option := range field.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || seen[option] {
+			c.Error(apierror.InvalidField(fmt.Sprintf("options[%d]", i), "must be a distinct, non-empty value"))
+			return false
+		}
+		seen[option] = true
+		field.Options[i] = option
+	}
+	return true
+}
+
+// validateCustomMetadata checks the custom values of media metadata against the defined
+// fields: each must be a defined field holding a value of its type, and required fields
+// must be set. Metadata stay free-form while no field is defined.
+func validateCustomMetadata(metadata []byte) (*apierror.Error, error) {
+	fields, err := metadataFields()
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+
+	var object map[string]json.RawMessage
+	if len(metadata) > 0 && string(metadata) != "null" {
+		if err := json.Unmarshal(metadata, &object); err != nil {
+			return apierror.InvalidField("metadata", "must be a JSON object"), nil
+		}
+	}
+	var custom map[string]json.RawMessage
+	if raw, ok := object["custom"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &custom); err != nil {
+			return apierror.InvalidField("metadata.custom", "must be a JSON object"), nil
+		}
+	}
+
+	var invalid []apierror.FieldError
+	keys := make([]string, 0, len(custom))
+	for key := range custom {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			invalid = append(invalid, apierror.FieldError{Field: "metadata.custom." + key, Message: "is not a defined metadata field"})
+			continue
+		}
+		if message := checkMetadataValue(&field, custom[key]); message != "" {
+			invalid = append(invalid, apierror.FieldError{Field: "metadata.custom." + key, Message: message})
+		}
+	}
+
+	required := make([]string, 0)
+	for key, field := range fields {
+		value, ok := custom[key]
+		if field.Required && (!ok || string(value) == "null" || string(value) == `""`) {
+			required = append(required, key)
+		}
+	}
+	sort.Strings(required)
+	for _, key := range required {
+		invalid = append(invalid, apierror.FieldError{Field: "metadata.custom." + key, Message: "is required"})
+	}
+
+	if len(invalid) > 0 {
+		return apierror.Invalid(invalid...), nil
+	}
+	return nil, nil
+}
+
+// checkMetadataValue says what is wrong with the value of a custom field, if anything.
+// null leaves a field unset.
+func checkMetadataValue(field *models.MetadataField, value json.RawMessage) string {
+	if string(value) == "null" {
+		return ""
+	}
+	if field.Type == models.MetadataNumber {
+		var number float64
+		if err := json.Unmarshal(value, &number); err != nil {
+			return "must be a number"
+		}
+		return ""
+	}
+
+	var text string
+	if err := json.Unmarshal(value, &text); err != nil {
+		return "must be a string"
+	}
+	switch field.Type {
+	case models.MetadataDate:
+		if _, err := time.Parse("2006-01-02", text); err != nil {
+			return "must be a date (YYYY-MM-DD)"
+		}
+	case models.MetadataSelect:
+		if !slices.Contains(field.Options, text) {
+			return "must be one of " + strings.Join(field.Options, ", ")
+		}
+	}
+	return ""
+}
+
+// filterCustomMetadata narrows a media query to the meta[key]=value filters of the
+// request: text fields containing value, select fields set to it, and number and date
+// fields equal to it or within a from..to range, either end of which may be left out.
+// Filename searches also match text and select values.
+func filterCustomMetadata(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	filters := c.QueryMap("meta")
+	search := c.Query("search")
+	if len(filters) == 0 && search == "" {
+		return query, true
+	}
+	fields, err := metadataFields()
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch metadata fields", err))
+		return nil, false
+	}
+
+	if search != "" {
+		conditions := []string{"media.filename ILIKE ?"}
+		args := []interface{}{"%" + search + "%"}
+		for key, field := range fields {
+			if field.Type == models.MetadataText || field.Type == models.MetadataSelect {
+				conditions = append(conditions, "media.metadata->'custom'->>? ILIKE ?")
+				args = append(args, key, "%"+search+"%")
+			}
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		param := "meta[" + key + "]"
+		field, ok := fields[key]
+		if !ok {
+			c.Error(apierror.InvalidField(param, "is not a defined metadata field"))
+			return nil, false
+		}
+		value := filters[key]
+		switch field.Type {
+		case models.MetadataText:
+			query = query.Where("media.metadata->'custom'->>? ILIKE ?", key, "%"+value+"%")
+		case models.MetadataSelect:
+			query = query.Where("media.metadata->'custom'->>? = ?", key, value)
+		case models.MetadataNumber:
+			from, to, err := metadataRange(value, func(s string) (interface{}, error) {
+				return strconv.ParseFloat(s, 64)
+			})
+			if err != nil {
+				c.Error(apierror.InvalidField(param, "must be a number or a from..to range"))
+				return nil, false
+			}
+			// Values stored before the field was defined may not be numbers
+			number := "CASE WHEN jsonb_typeof(media.metadata->'custom'->?) = 'number' THEN (media.metadata->'custom'->>?)::numeric END"
+			if from != nil {
+				query = query.Where(number+" >= ?", key, key, from)
+			}
+			if to != nil {
+				query = query.Where(number+" <= ?", key, key, to)
+			}
+		case models.MetadataDate:
+			from, to, err := metadataRange(value, func(s string) (interface{}, error) {
+				_, err := time.Parse("2006-01-02", s)
+				return s, err
+			})
+			if err != nil {
+				c.Error(apierror.InvalidField(param, "must be a date (YYYY-MM-DD) or a from..to range"))
+				return nil, false
+			}
+			// Dates are stored as YYYY-MM-DD, which sorts like the dates themselves
+			date := "media.metadata->'custom'->>?"
+			query = query.Where(date+" ~ '^\\d{4}-\\d{2}-\\d{2}$'", key)
+			if from != nil {
+				query = query.Where(date+" >= ?", key, from)
+			}
+			if to != nil {
+				query = query.Where(date+" <= ?", key, to)
+			}
+		}
+	}
+	return query, true
+}
+
+// metadataRange parses a value or a from..to range of a meta filter. A single value is
+// both ends; nil ends are open.
+func metadataRange(value string, parse func(string) (interface{}, error)) (interface{}, interface{}, error) {
+	low, high, isRange := strings.Cut(value, "..")
+	if !isRange {
+		high = low
+	}
+	if low == "" && high == "" {
+		return nil, nil, fmt.Errorf("empty range")
+	}
+	var from, to interface{}
+	var err error
+	if low != "" {
+		if from, err = parse(low); err != nil {
+			return nil, nil, err
+		}
+	}
+	if high != "" {
+		if to, err = parse(high); err != nil {
+			return nil, nil, err
+		}
+	}
+	return from, to, nil
+}
+
+// ListMetadataFields godoc
+// @Summary      List custom metadata fields
+// @Description  The typed fields admins defined for media metadata, by key. Their values go under metadata.custom of PUT /media/{id} and can be filtered with meta[key]=value.
+// @Tags         media
+// @Produce      json
+// @Success      200  {object}  handlers.MetadataFieldsResponse
+// @Failure      500  {object}  object{error=string}
+// @Router       /metadata-fields [get]
+// @Security     BearerAuth
+func ListMetadataFields(c *gin.Context) {
+	fields := []models.MetadataField{}
+	if err := database.GetDB().Order("key").Find(&fields).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch metadata fields", err))
+		return
+	}
+	c.JSON(http.StatusOK, MetadataFieldsResponse{Fields: fields})
+}
+
+// CreateMetadataField godoc
+// @Summary      Define a custom metadata field
+// @Description  Add a typed field (text, number, date or select) to the metadata of every media item. Once a field is defined, media updates may only set defined fields under metadata.custom, with values of their type, and must set required ones.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        field  body      handlers.CreateMetadataFieldRequest  true  "Metadata field"
+// @Success      201    {object}  models.MetadataField
+// @Failure      400    {object}  object{error=string}
+// @Failure      403    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /admin/metadata-fields [post]
+// @Security     BearerAuth
+func CreateMetadataField(c *gin.Context) {
+	var input CreateMetadataFieldRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if !metadataFieldKey.MatchString(input.Key) {
+		c.Error(apierror.InvalidField("key", "must start with a lowercase letter and hold up to 64 lowercase letters, digits and underscores"))
+		return
+	}
+
+	field := models.MetadataField{
+		Key:      input.Key,
+		Label:    strings.TrimSpace(input.Label),
+		Type:     input.Type,
+		Options:  input.Options,
+		Required: input.Required,
+	}
+	if !validateMetadataField(c, &field) {
+		return
+	}
+
+	db := database.GetDB()
+	var taken int64
+	if err := db.Model(&models.MetadataField{}).Where("key = ?", field.Key).Count(&taken).Error; err != nil {
+		c.Error(apierror.Internal("Failed to create metadata field", err))
+		return
+	}
+	if taken > 0 {
+		c.Error(apierror.Conflict(fmt.Sprintf("A metadata field with key %s already exists", field.Key)))
+		return
+	}
+	if err := db.Create(&field).Error; err != nil {
+		c.Error(apierror.Internal("Failed to create metadata field", err))
+		return
+	}
+	c.JSON(http.StatusCreated, field)
+}
+
+// UpdateMetadataField godoc
+// @Summary      Update a custom metadata field
+// @Description  Change the label, options or required state of a metadata field. Its key and type can't change, as stored values depend on them. Values no longer among the options stay until their media are edited.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                                  true  "Field ID"
+// @Param        field  body      handlers.UpdateMetadataFieldRequest  true  "Changed fields"
+// @Success      200    {object}  models.MetadataField
+// @Failure      400    {object}  object{error=string}
+// @Failure      403    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /admin/metadata-fields/{id} [put]
+// @Security     BearerAuth
+func UpdateMetadataField(c *gin.Context) {
+	var input UpdateMetadataFieldRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	db := database.GetDB()
+	var field models.MetadataField
+	if err := db.First(&field, c.Param("id")).Error; err != nil {
+		c.Error(apierror.NotFound("Metadata field not found"))
+		return
+	}
+
+	if input.Label != nil {
+		if *input.Label = strings.TrimSpace(*input.Label); *input.Label == "" {
+			c.Error(apierror.InvalidField("label", "must not be empty"))
+			return
+		}
+		field.Label = *input.Label
+	}
+	if input.Options != nil {
+		field.Options = input.Options
+	}
+	if input.Required != nil {
+		field.Required = *input.Required
+	}
+	if !validateMetadataField(c, &field) {
+		return
+	}
+
+	if err := db.Save(&field).Error; err != nil {
+		c.Error(apierror.Internal("Failed to update metadata field", err))
+		return
+	}
+	c.JSON(http.StatusOK, field)
+}
+
+// DeleteMetadataField godoc
+// @Summary      Delete a custom metadata field
+// @Description  Delete a metadata field and remove its values from the metadata of all media
+// @Tags         admin
+// @Produce      json
+// @Param        id   path      int  true  "Field ID"
+// @Success      200  {object}  handlers.MessageResponse
+// @Failure      403  {object}  object{error=string}
+// @Failure      404  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /admin/metadata-fields/{id} [delete]
+// @Security     BearerAuth
+func DeleteMetadataField(c *gin.Context) {
+	db := database.GetDB()
+	var field models.MetadataField
+	if err := db.First(&field, c.Param("id")).Error; err != nil {
+		c.Error(apierror.NotFound("Metadata field not found"))
+		return
+	}
+
+	// Values of a field that's gone would fail the validation of the next update
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Media{}).Unscoped().
+			Where("metadata->'custom'->? IS NOT NULL", field.Key).
+			Update("metadata", gorm.Expr("jsonb_set(metadata, '{custom}', (metadata->'custom') - ?)", field.Key)).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&field).Error
+	})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to delete metadata field", err))
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Metadata field deleted successfully"})
+}
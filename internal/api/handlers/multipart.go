@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+)
+
+// S3 limits every multipart upload is held to
+const (
+	minPartSize  = 5 << 20 // Smallest part but the last
+	maxPartCount = 10000
+)
+
+// multipartPartSize returns the part size closest to preferred that splits size bytes
+// into parts the backend accepts
+func multipartPartSize(size, preferred int64) int64 {
+	partSize := max(preferred, minPartSize)
+	if minimum := (size + maxPartCount - 1) / maxPartCount; partSize < minimum {
+		partSize = minimum
+	}
+	return partSize
+}
+
+// partLength is the size of part partNumber of a session; only the last one is shorter
+func partLength(session *models.UploadSession, partNumber int32) int64 {
+	offset := int64(partNumber-1) * session.PartSize
+	return min(session.PartSize, session.Size-offset)
+}
+
+// sessionClaims describes the upload of a session the way an upload token does
+func sessionClaims(session *models.UploadSession) (*directUploadClaims, error) {
+	claims := &directUploadClaims{
+		UserID:   session.UserID,
+		Backend:  session.StorageBackend,
+		Key:      session.Key,
+		Filename: session.Filename,
+		Size:     session.Size,
+		Conflict: session.Conflict,
+		Expires:  session.ExpiresAt.Unix(),
+	}
+	if session.FolderID != nil {
+		claims.FolderID = *session.FolderID
+	}
+	if len(session.Tags) > 0 {
+		if err := json.Unmarshal(session.Tags, &claims.Tags); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+// startMultipartUpload begins a multipart upload of a checked PresignUpload request and
+// answers with its session
+func startMultipartUpload(c *gin.Context, backendName string, uploader storage.MultipartUploader, key string, input *PresignUploadRequest, folderID *string, policy string) {
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
+
+	tags, err := json.Marshal(input.Tags)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to process tags", err))
+		return
+	}
+
+	uploadID, err := uploader.CreateMultipartUpload(ctx, key, input.ContentType, input.objectOptions())
+	if err != nil {
+		c.Error(apierror.Internal("Failed to start multipart upload", err))
+		return
+	}
+
+	partSize := multipartPartSize(input.Size, cfg.Storage.DirectUpload.PartSize)
+	session := models.UploadSession{
+		ID:             uuid.NewString(),
+		UserID:         c.GetUint("user_id"),
+		StorageBackend: backendName,
+		Key:            key,
+		UploadID:       uploadID,
+		Filename:       input.Filename,
+		ContentType:    input.ContentType,
+		Size:           input.Size,
+		PartSize:       partSize,
+		PartCount:      int((input.Size + partSize - 1) / partSize),
+		FolderID:       folderID,
+		Tags:           tags,
+		Conflict:       policy,
+		Status:         models.UploadSessionActive,
+		ExpiresAt:      time.Now().Add(cfg.Storage.DirectUpload.SessionTTL),
+	}
+	if err := database.GetDB().Create(&session).Error; err != nil {
+		uploader.AbortMultipartUpload(ctx, key, uploadID)
+		c.Error(apierror.Internal("Failed to save upload session", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, PresignUploadResponse{
+		Session:   &session,
+		ExpiresAt: session.ExpiresAt,
+	})
+}
+
+// findUploadSession loads the current user's upload session named in the path
+func findUploadSession(c *gin.Context) (*models.UploadSession, bool) {
+	var session models.UploadSession
+	if err := database.GetDB().Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).First(&session).Error; err != nil {
+		c.Error(apierror.NotFound("Upload session not found"))
+		return nil, false
+	}
+	return &session, true
+}
+
+// multipartBackend returns the multipart support of the backend a session uploads to
+func multipartBackend(session *models.UploadSession) (storage.MultipartUploader, bool) {
+	uploader, ok := storage.DirectUploadBackend(session.StorageBackend)
+	if !ok {
+		return nil, false
+	}
+	multipart, ok := uploader.(storage.MultipartUploader)
+	return multipart, ok
+}
+
+// GetUploadSession godoc
+// @Summary      Get a multipart upload session
+// @Description  Get the state of a multipart direct upload started with POST /media/uploads/presign
+// @Tags         media
+// @Produce      json
+// @Param        id   path      string  true  "Upload session ID"
+// @Success      200  {object}  handlers.UploadSessionResponse
+// @Failure      404  {object}  object{error=string}
+// @Router       /media/uploads/{id} [get]
+// @Security     BearerAuth
+func GetUploadSession(c *gin.Context) {
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, UploadSessionResponse{Session: *session})
+}
+
+// PresignUploadParts godoc
+// @Summary      Presign parts of a multipart upload
+// @Description  Return presigned requests storing the given parts of a multipart upload, up to 100 at a time. Every part but the last has the session's part_size. Keep the ETag header storage answers each part with for completing the upload.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        id     path      string                        true  "Upload session ID"
+// @Param        input  body      handlers.UploadPartsRequest  true  "Part numbers, starting at 1"
+// @Success      200    {object}  handlers.UploadPartsResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Router       /media/uploads/{id}/parts [post]
+// @Security     BearerAuth
+func PresignUploadParts(c *gin.Context) {
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
+
+	var input UploadPartsRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status != models.UploadSessionActive {
+		c.Error(apierror.Conflict(fmt.Sprintf("Upload session is %s", session.Status)))
+		return
+	}
+	remaining := time.Until(session.ExpiresAt)
+	if remaining <= 0 {
+		c.Error(apierror.Conflict("Upload session expired"))
+		return
+	}
+
+	var invalid []apierror.FieldError
+	for i, number := range input.PartNumbers {
+		if int(number) > session.PartCount {
+			invalid = append(invalid, apierror.FieldError{
+				Field:   fmt.Sprintf("part_numbers[%d]", i),
+				Message: fmt.Sprintf("must be at most %d", session.PartCount),
+			})
+		}
+	}
+	if len(invalid) > 0 {
+		c.Error(apierror.Invalid(invalid...))
+		return
+	}
+
+	uploader, ok := multipartBackend(session)
+	if !ok {
+		c.Error(apierror.Internal("Storage backend of the upload is no longer available", nil))
+		return
+	}
+
+	expiration := min(cfg.Storage.DirectUpload.URLExpiration, remaining)
+	parts := make([]UploadPartURL, 0, len(input.PartNumbers))
+	for _, number := range input.PartNumbers {
+		upload, err := uploader.PresignUploadPart(ctx, session.Key, session.UploadID, number, partLength(session, number), expiration)
+		if err != nil {
+			c.Error(apierror.Internal("Failed to presign part", err))
+			return
+		}
+		parts = append(parts, UploadPartURL{PartNumber: number, PresignedUpload: *upload})
+	}
+
+	c.JSON(http.StatusOK, UploadPartsResponse{Parts: parts})
+}
+
+// CompleteMultipartUpload godoc
+// @Summary      Complete a multipart upload
+// @Description  Join the stored parts of a multipart upload and create its media item. Every part from 1 to part_count has to be listed once, with the ETag storage answered it with. The object then goes through the same checks as POST /media/uploads/complete. Completing a session again returns the media item created the first time.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        id     path      string                                   true  "Upload session ID"
+// @Param        input  body      handlers.CompleteMultipartUploadRequest  true  "Stored parts"
+// @Param        Idempotency-Key  header  string  false  "Key making retries of this request safe"
+// @Success      200    {object}  handlers.MediaResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      413    {object}  object{error=string}
+// @Failure      415    {object}  object{error=string}
+// @Router       /media/uploads/{id}/complete [post]
+// @Security     BearerAuth
+func CompleteMultipartUpload(c *gin.Context) {
+	ctx := c.Request.Context()
+	var input CompleteMultipartUploadRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+
+	switch session.Status {
+	case models.UploadSessionCompleted:
+		var media models.Media
+		if err := database.GetDB().Preload("Tags").Where("id = ? AND user_id = ?", session.MediaID, session.UserID).First(&media).Error; err != nil {
+			c.Error(apierror.NotFound("Media of the upload no longer exists"))
+			return
+		}
+		c.JSON(http.StatusOK, MediaResponse{Message: "File uploaded successfully", Media: newMediaItem(&media)})
+		return
+	case models.UploadSessionAborted:
+		c.Error(apierror.Conflict("Upload session is aborted"))
+		return
+	}
+	if time.Now().After(session.ExpiresAt) {
+		c.Error(apierror.Conflict("Upload session expired"))
+		return
+	}
+
+	// The parts are only joined once; a retry after a failed check goes straight to it
+	if session.Status == models.UploadSessionActive {
+		sort.Slice(input.Parts, func(i, j int) bool { return input.Parts[i].PartNumber < input.Parts[j].PartNumber })
+		if len(input.Parts) != session.PartCount {
+			c.Error(apierror.InvalidField("parts", fmt.Sprintf("must list parts 1 to %d once each", session.PartCount)))
+			return
+		}
+		parts := make([]storage.UploadedPart, len(input.Parts))
+		for i, part := range input.Parts {
+			if int(part.PartNumber) != i+1 {
+				c.Error(apierror.InvalidField("parts", fmt.Sprintf("must list parts 1 to %d once each", session.PartCount)))
+				return
+			}
+			parts[i] = storage.UploadedPart{PartNumber: part.PartNumber, ETag: part.ETag}
+		}
+
+		uploader, ok := multipartBackend(session)
+		if !ok {
+			c.Error(apierror.Internal("Storage backend of the upload is no longer available", nil))
+			return
+		}
+		if err := uploader.CompleteMultipartUpload(ctx, session.Key, session.UploadID, parts); err != nil {
+			c.Error(apierror.BadRequest("Storage could not join the parts").WithDetails(err.Error()))
+			return
+		}
+		if err := database.GetDB().Model(session).Update("status", models.UploadSessionAssembled).Error; err != nil {
+			c.Error(apierror.Internal("Failed to update upload session", err))
+			return
+		}
+	}
+
+	claims, err := sessionClaims(session)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to read upload session", err))
+		return
+	}
+	response := finishDirectUpload(c, claims)
+	if response == nil {
+		return
+	}
+
+	if err := database.GetDB().Model(session).Updates(map[string]interface{}{
+		"status":   models.UploadSessionCompleted,
+		"media_id": response.Media.ID,
+	}).Error; err != nil {
+		log.Printf("Failed to mark upload session %s completed: %v", session.ID, err)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AbortUploadSession godoc
+// @Summary      Abort a multipart upload
+// @Description  Discard a multipart upload and the parts stored so far. Aborting an aborted session succeeds again.
+// @Tags         media
+// @Produce      json
+// @Param        id   path      string  true  "Upload session ID"
+// @Success      200  {object}  handlers.MessageResponse
+// @Failure      404  {object}  object{error=string}
+// @Failure      409  {object}  object{error=string}
+// @Router       /media/uploads/{id} [delete]
+// @Security     BearerAuth
+func AbortUploadSession(c *gin.Context) {
+	ctx := c.Request.Context()
+	session, ok := findUploadSession(c)
+	if !ok {
+		return
+	}
+	if session.Status == models.UploadSessionCompleted {
+		c.Error(apierror.Conflict("Upload session is completed"))
+		return
+	}
+
+	if err := abortUploadSession(ctx, session); err != nil {
+		c.Error(apierror.Internal("Failed to abort upload", err))
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Upload aborted"})
+}
+
+// abortUploadSession discards what a session stored and marks it aborted
+func abortUploadSession(ctx context.Context, session *models.UploadSession) error {
+	switch session.Status {
+	case models.UploadSessionActive:
+		uploader, ok := multipartBackend(session)
+		if !ok {
+			return fmt.Errorf("storage backend %q does not take multipart uploads", session.StorageBackend)
+		}
+		if err := uploader.AbortMultipartUpload(ctx, session.Key, session.UploadID); err != nil {
+			return err
+		}
+	case models.UploadSessionAssembled:
+		// A media item may have been created even though the session wasn't marked completed
+		var count int64
+		database.GetDB().Model(&models.Media{}).Where("path = ? AND storage_backend = ?", session.Key, session.StorageBackend).Count(&count)
+		if count == 0 {
+			discardObject(ctx, storage.GetBackend(session.StorageBackend), session.Key)
+		}
+	case models.UploadSessionAborted:
+		return nil
+	}
+	return database.GetDB().Model(session).Update("status", models.UploadSessionAborted).Error
+}
+
+// abortExpiredUploadSessions aborts multipart uploads left unfinished past their expiry,
+// so their parts don't linger in storage
+func abortExpiredUploadSessions() error {
+	ctx := context.Background()
+	var expired []models.UploadSession
+	if err := database.GetDB().
+		Where("status IN ? AND expires_at < ?", []string{models.UploadSessionActive, models.UploadSessionAssembled}, time.Now()).
+		Find(&expired).Error; err != nil {
+		return err
+	}
+	for i := range expired {
+		if err := abortUploadSession(ctx, &expired[i]); err != nil {
+			log.Printf("Failed to abort upload session %s: %v", expired[i].ID, err)
+		}
+	}
+	return nil
+}
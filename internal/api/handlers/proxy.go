@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+)
+
+// proxyRedirects is how many redirects a remote image may go through
+const proxyRedirects = 5
+
+// proxyOptions are the transformation options the proxy accepts. Watermarks are left
+// out, as they are media of an account.
+var proxyOptions = []string{
+	"width", "height", "fit", "crop", "quality", "format", "preset", "rotate", "flip",
+	"dpr", "strip", "colorspace", "blur", "sharpen", "grayscale", "brightness", "contrast", "saturation",
+}
+
+// proxyTypes are the remote image types the proxy serves; anything else, SVG with its
+// scripts in particular, is refused
+var proxyTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// proxyEnabled reports whether any remote host is allowed
+func proxyEnabled() bool {
+	return len(config.GetConfig().Proxy.AllowedHosts) > 0
+}
+
+// proxyHostAllowed reports whether images may be fetched from host
+func proxyHostAllowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range config.GetConfig().Proxy.AllowedHosts {
+		if parent, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+parent) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// parseProxySource checks the URL of a remote image against the allowlist
+func parseProxySource(raw string) (*url.URL, error) {
+	source, err := url.Parse(raw)
+	if err != nil || (source.Scheme != "http" && source.Scheme != "https") || source.Host == "" {
+		return nil, errors.New("must be an http or https URL")
+	}
+	if !proxyHostAllowed(source.Hostname()) {
+		return nil, fmt.Errorf("%s is not an allowed host", source.Hostname())
+	}
+	return source, nil
+}
+
+// parseProxyOptions reads and validates the transformation options of a proxy query,
+// with the preset applied. Errors are *utils.OptionError.
+func parseProxyOptions(query url.Values) (utils.TransformationOptions, error) {
+	options := utils.TransformationOptions{
+		Width:   utils.ParseIntOption(query.Get("width")),
+		Height:  utils.ParseIntOption(query.Get("height")),
+		Fit:     query.Get("fit"),
+		Crop:    query.Get("crop"),
+		Quality: utils.ParseIntOption(query.Get("quality")),
+		Format:  query.Get("format"),
+		Preset:  query.Get("preset"),
+		Rotate:  utils.ParseFloatOption(query.Get("rotate")),
+		Flip:    query.Get("flip"),
+		DPR:     utils.ParseFloatOption(query.Get("dpr")),
+		Strip:   query.Get("strip"),
+
+		Colorspace: query.Get("colorspace"),
+
+		Blur:       utils.ParseFloatOption(query.Get("blur")),
+		Sharpen:    utils.ParseFloatOption(query.Get("sharpen")),
+		Grayscale:  query.Get("grayscale") == "true",
+		Brightness: utils.ParseFloatOption(query.Get("brightness")),
+		Contrast:   utils.ParseFloatOption(query.Get("contrast")),
+		Saturation: utils.ParseFloatOption(query.Get("saturation")),
+	}
+	if err := options.Validate(); err != nil {
+		return options, err
+	}
+	if options.IsVideoFormat() {
+		return options, &utils.OptionError{Option: "format", Message: fmt.Sprintf("%s output is only supported for stored GIF images", options.Format)}
+	}
+	if options.Preset != "" {
+		if err := utils.ApplyPreset(&options, options.Preset); err != nil {
+			return options, &utils.OptionError{Option: "preset", Message: err.Error()}
+		}
+	}
+	options.ApplyDPR()
+	return options, nil
+}
+
+// proxyCacheKey identifies the render of a remote image in the derivative cache
+func proxyCacheKey(source string, options utils.TransformationOptions) string {
+	options.Fresh = false
+	options.Strip = strconv.FormatBool(options.StripsMetadata())
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%+v", source, options)))
+	return "proxy_" + hex.EncodeToString(sum[:16])
+}
+
+// proxyCanonicalQuery encodes every parameter of a proxy query but the token, in key order
+func proxyCanonicalQuery(query url.Values) string {
+	signed := make(url.Values, len(query))
+	for key, values := range query {
+		if key != "token" {
+			signed[key] = values
+		}
+	}
+	return signed.Encode()
+}
+
+// signProxy signs a proxy query
+func signProxy(secret string, query url.Values) string {
+	return utils.SignParams(secret, "proxy", proxyCanonicalQuery(query))
+}
+
+// VerifyProxyToken checks the signature and expiry of a signed proxy request
+func VerifyProxyToken(c *gin.Context) bool {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return utils.VerifyParams(config.GetConfig().JWT.Secret, c.Query("token"), "proxy", proxyCanonicalQuery(c.Request.URL.Query()))
+}
+
+// fetchProxyImage downloads a remote image, following redirects only to allowed hosts,
+// until ctx is cancelled. Failures are *apierror.Error.
+func fetchProxyImage(ctx context.Context, source *url.URL) ([]byte, error) {
+	cfg := config.GetConfig().Proxy
+	client := &http.Client{
+		Timeout: cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= proxyRedirects {
+				return errors.New("too many redirects")
+			}
+			if !proxyHostAllowed(req.URL.Hostname()) {
+				return fmt.Errorf("redirected to %s, which is not an allowed host", req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source.String(), nil)
+	if err != nil {
+		return nil, apierror.Wrap(http.StatusBadGateway, "Failed to fetch remote image", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, apierror.Wrap(http.StatusBadGateway, "Failed to fetch remote image", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, apierror.New(http.StatusBadGateway, fmt.Sprintf("Remote image returned %s", resp.Status))
+	}
+	if resp.ContentLength > cfg.MaxSize {
+		return nil, apierror.New(http.StatusRequestEntityTooLarge, "Remote image is too large")
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, cfg.MaxSize+1))
+	if err != nil {
+		return nil, apierror.Wrap(http.StatusBadGateway, "Failed to fetch remote image", err)
+	}
+	if int64(len(data)) > cfg.MaxSize {
+		return nil, apierror.New(http.StatusRequestEntityTooLarge, "Remote image is too large")
+	}
+	// The content is sniffed, as remote servers may label anything as an image
+	if !slices.Contains(proxyTypes, http.DetectContentType(data)) {
+		return nil, apierror.New(http.StatusUnsupportedMediaType, "Remote file is not a JPEG, PNG or GIF image")
+	}
+	return data, nil
+}
+
+// renderProxyImage fetches and transforms a remote image and caches the result
+func renderProxyImage(ctx context.Context, source *url.URL, options utils.TransformationOptions, cacheKey string) ([]byte, error) {
+	started := time.Now()
+	original, err := fetchProxyImage(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	transformed, err := utils.TransformImage(bytes.NewReader(original), options)
+	if err != nil {
+		return nil, &transformFailure{message: "Failed to transform image", err: err}
+	}
+
+	// Remote renders belong to no media item; the cache evicts them like any other
+	backendName, _ := storage.SelectUploadBackend()
+	if err := storeDerivative(ctx, &models.Media{StorageBackend: backendName}, cacheKey, transformed, time.Since(started)); err != nil {
+		log.Printf("Failed to cache proxied image %s: %v", source, err)
+	}
+	return transformed, nil
+}
+
+// ProxyImage godoc
+// @Summary      Transform a remote image
+// @Description  Fetch an image from an allowlisted host, transform it like stored media and cache the result. Accepts either a Bearer token or the signed query of a link from POST /proxy/links.
+// @Tags         proxy
+// @Produce      image/jpeg,image/png,image/gif
+// @Param        url         query     string  true   "Remote JPEG, PNG or GIF image"
+// @Param        width       query     int     false  "Target width"
+// @Param        height      query     int     false  "Target height"
+// @Param        fit         query     string  false  "Fit method (contain, cover, fill)"
+// @Param        crop        query     string  false  "Crop position"
+// @Param        quality     query     int     false  "JPEG quality (1-100)"
+// @Param        format      query     string  false  "Output format (jpeg, png)"
+// @Param        preset      query     string  false  "Transformation preset"
+// @Param        rotate      query     number  false  "Clockwise rotation in degrees"
+// @Param        flip        query     string  false  "Flip (h, v, hv)"
+// @Param        dpr         query     number  false  "Device pixel ratio (1-3) multiplying width and height"
+// @Param        strip       query     bool      false  "Remove EXIF, ICC and XMP (default TRANSFORM_STRIP_METADATA)"
+// @Param        colorspace  query     string    false  "Convert to a color space (srgb)"
+// @Param        blur        query     number  false  "Gaussian blur sigma (0-100)"
+// @Param        sharpen     query     number  false  "Sharpen sigma (0-100)"
+// @Param        grayscale   query     bool    false  "Convert to grayscale"
+// @Param        brightness  query     number  false  "Brightness change in percent (-100 to 100)"
+// @Param        contrast    query     number  false  "Contrast change in percent (-100 to 100)"
+// @Param        saturation  query     number  false  "Saturation change in percent (-100 to 100)"
+// @Param        fresh       query     bool    false  "Bypass the cache, with a Bearer token only"
+// @Param        expires     query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token       query     string  false  "Signed URL token"
+// @Success      200         {file}    binary
+// @Failure      400         {object}  object{error=string}
+// @Failure      403         {object}  object{error=string}
+// @Failure      413         {object}  object{error=string}
+// @Failure      415         {object}  object{error=string}
+// @Failure      501         {object}  object{error=string}
+// @Failure      502         {object}  object{error=string}
+// @Failure      503         {object}  object{error=string}
+// @Router       /proxy [get]
+// @Security     BearerAuth
+func ProxyImage(c *gin.Context) {
+	ctx := c.Request.Context()
+	if !proxyEnabled() {
+		c.Error(apierror.New(http.StatusNotImplemented, "The image proxy is not configured"))
+		return
+	}
+
+	source, err := parseProxySource(c.Query("url"))
+	if err != nil {
+		c.Error(apierror.InvalidField("url", err.Error()))
+		return
+	}
+	options, err := parseProxyOptions(c.Request.URL.Query())
+	if err != nil {
+		c.Error(optionsError("", err))
+		return
+	}
+	// Signed links are public, so only account holders may force renders
+	options.Fresh = c.Query("fresh") == "true" && !c.GetBool("signed_access")
+	cacheKey := proxyCacheKey(source.String(), options)
+
+	if !options.Fresh {
+		if data, ok := loadDerivative(ctx, cacheKey); ok {
+			c.Header("X-Cache", "HIT")
+			serveProxyImage(c, data)
+			return
+		}
+	}
+
+	transformed, shared, err := pooledTransform(ctx, cacheKey, func(ctx context.Context) ([]byte, error) {
+		return renderProxyImage(ctx, source, options, cacheKey)
+	})
+	if err != nil {
+		var apiErr *apierror.Error
+		if errors.As(err, &apiErr) {
+			c.Error(apiErr)
+		} else {
+			reportTransformError(c, err)
+		}
+		return
+	}
+
+	if shared {
+		c.Header("X-Cache", "SHARED")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	serveProxyImage(c, transformed)
+}
+
+// serveProxyImage writes a proxied image with the cache policy of its type
+func serveProxyImage(c *gin.Context, data []byte) {
+	contentType := http.DetectContentType(data)
+	setCacheControl(c, contentType)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// CreateProxyLink godoc
+// @Summary      Create a proxy link
+// @Description  Signed link to a transformed remote image, for pages that load it without an Authorization header
+// @Tags         proxy
+// @Accept       json
+// @Produce      json
+// @Param        input  body      handlers.ProxyLinkRequest  true  "Remote image and transformation options"
+// @Success      200    {object}  handlers.ProxyLinkResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      501    {object}  object{error=string}
+// @Router       /proxy/links [post]
+// @Security     BearerAuth
+func CreateProxyLink(c *gin.Context) {
+	if !proxyEnabled() {
+		c.Error(apierror.New(http.StatusNotImplemented, "The image proxy is not configured"))
+		return
+	}
+
+	var input ProxyLinkRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	source, err := parseProxySource(input.URL)
+	if err != nil {
+		c.Error(apierror.InvalidField("url", err.Error()))
+		return
+	}
+
+	query := url.Values{}
+	for name, value := range input.Options {
+		if !slices.Contains(proxyOptions, name) {
+			c.Error(apierror.InvalidField("options."+name, "is not a transformation option of the proxy"))
+			return
+		}
+		query.Set(name, value)
+	}
+	if _, err := parseProxyOptions(query); err != nil {
+		c.Error(optionsError("options.", err))
+		return
+	}
+
+	// Rounded to the day, so a page hands out the same link all day
+	cfg := config.GetConfig()
+	expiresAt := time.Now().Add(cfg.Proxy.URLExpiration).Truncate(24 * time.Hour).Add(24 * time.Hour)
+	query.Set("url", source.String())
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("token", signProxy(cfg.JWT.Secret, query))
+
+	c.JSON(http.StatusOK, ProxyLinkResponse{
+		URL:       publicBaseURL(c) + "/api/v1/proxy?" + query.Encode(),
+		ExpiresAt: expiresAt.UTC(),
+	})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errQuotaExceeded is returned when an upload would take a user past their storage quota
+var errQuotaExceeded = errors.New("storage quota exceeded")
+
+// userQuota returns the bytes a user may store, their override or else the configured
+// default; 0 is unlimited
+func userQuota(userID uint) (int64, error) {
+	var user models.User
+	if err := database.GetDB().Select("id", "storage_quota").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	if user.StorageQuota != nil {
+		return *user.StorageQuota, nil
+	}
+	return config.GetConfig().Storage.Quota, nil
+}
+
+// usedStorage sums the size of a user's media
+func usedStorage(userID uint) (int64, error) {
+	var used int64
+	err := database.GetDB().Model(&models.Media{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&used).Error
+	return used, err
+}
+
+// checkQuota fails with errQuotaExceeded when storing size more bytes would take a user
+// past their quota. size may be negative when a replace shrinks a file.
+func checkQuota(userID uint, size int64) error {
+	quota, err := userQuota(userID)
+	if err != nil {
+		return fmt.Errorf("failed to load quota: %v", err)
+	}
+	if quota <= 0 || size <= 0 {
+		return nil
+	}
+
+	used, err := usedStorage(userID)
+	if err != nil {
+		return fmt.Errorf("failed to compute storage usage: %v", err)
+	}
+	if used+size > quota {
+		return fmt.Errorf("%w: %d of %d bytes used, %d more requested", errQuotaExceeded, used, quota, size)
+	}
+	return nil
+}
+
+// quotaError maps a checkQuota error to the error it is reported with
+func quotaError(err error) *apierror.Error {
+	if errors.Is(err, errQuotaExceeded) {
+		return apierror.New(http.StatusRequestEntityTooLarge, err.Error()).WithCode(apierror.CodeQuotaExceeded)
+	}
+	return apierror.Internal("Failed to check storage quota", err)
+}
+
+// replacedSize is the size of the media an upload overwrites, which is freed by it
+func (r conflictResolution) replacedSize() int64 {
+	if r.Existing == nil {
+		return 0
+	}
+	return r.Existing.Size
+}
+
+// GetAccountUsage godoc
+// @Summary      Storage usage
+// @Description  Bytes stored by the current user against their quota, with counts by MIME type
+// @Tags         account
+// @Produce      json
+// @Success      200  {object}  handlers.StorageUsageResponse
+// @Failure      500  {object}  object{error=string}
+// @Router       /account/usage [get]
+// @Security     BearerAuth
+func GetAccountUsage(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	quota, err := userQuota(userID.(uint))
+	if err != nil {
+		c.Error(apierror.Internal("Failed to load quota", err))
+		return
+	}
+
+	byMimeType := []MimeTypeUsage{}
+	if err := database.GetDB().Model(&models.Media{}).
+		Select("mime_type, COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Group("mime_type").
+		Order("bytes DESC").
+		Scan(&byMimeType).Error; err != nil {
+		c.Error(apierror.Internal("Failed to compute storage usage", err))
+		return
+	}
+
+	usage := StorageUsageResponse{Quota: quota, ByMimeType: byMimeType}
+	for _, entry := range byMimeType {
+		usage.Used += entry.Bytes
+	}
+	if quota > 0 {
+		remaining := quota - usage.Used
+		if remaining < 0 {
+			remaining = 0 // Quotas lowered below current usage
+		}
+		usage.Remaining = &remaining
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// SetUserQuota godoc
+// @Summary      Override a user's storage quota
+// @Description  Set the bytes a user may store, 0 for unlimited; a null quota restores the configured default. Files already stored are kept when a quota is lowered.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                       true  "User ID"
+// @Param        input  body      handlers.UserQuotaRequest  true  "Quota in bytes"
+// @Success      200    {object}  handlers.UserQuotaResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      403    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Router       /admin/users/{id}/quota [put]
+// @Security     BearerAuth
+func SetUserQuota(c *gin.Context) {
+	var input UserQuotaRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.Quota != nil && *input.Quota < 0 {
+		c.Error(apierror.BadRequest("Quota can't be negative"))
+		return
+	}
+
+	db := database.GetDB()
+	var user models.User
+	if err := db.Select("id").First(&user, c.Param("id")).Error; err != nil {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+	if err := db.Model(&user).Update("storage_quota", input.Quota).Error; err != nil {
+		c.Error(apierror.Internal("Failed to update quota", err))
+		return
+	}
+
+	response := UserQuotaResponse{
+		Message:  "Quota override cleared",
+		UserID:   user.ID,
+		Override: input.Quota,
+		Quota:    config.GetConfig().Storage.Quota,
+	}
+	if input.Quota != nil {
+		response.Message = "Quota updated"
+		response.Quota = *input.Quota
+	}
+	c.JSON(http.StatusOK, response)
+}
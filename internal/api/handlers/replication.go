@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+)
+
+// reconcileBatchSize is how many media items are checked against the replica at a time
+const reconcileBatchSize = 500
+
+// reconcileMediaReplicas checks the replica for the object of every media item
+func reconcileMediaReplicas(repair bool) (storage.ReconcileReport, error) {
+	return storage.ReconcileReplicas(repair, func(visit func([]storage.ReplicaObject)) error {
+		var batch []models.Media
+		return database.GetDB().Select("id", "path", "storage_backend").
+			FindInBatches(&batch, reconcileBatchSize, func(tx *gorm.DB, _ int) error {
+				objects := make([]storage.ReplicaObject, len(batch))
+				for i, media := range batch {
+					objects[i] = storage.ReplicaObject{Backend: media.StorageBackend, Path: media.Path, Ref: media.ID}
+				}
+				visit(objects)
+				return nil
+			}).Error
+	})
+}
+
+// GetReplicationStatus godoc
+// @Summary      Storage replication status
+// @Description  Copies, deletions and failures of the replicator mirroring uploads onto the replica, with the last reconciliation report
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  handlers.ReplicationStatusResponse
+// @Failure      403  {object}  object{error=string}
+// @Router       /admin/storage/replication [get]
+// @Security     BearerAuth
+func GetReplicationStatus(c *gin.Context) {
+	status, enabled := storage.GetReplicationStatus()
+	if !enabled {
+		c.JSON(http.StatusOK, ReplicationStatusResponse{Enabled: false})
+		return
+	}
+	c.JSON(http.StatusOK, ReplicationStatusResponse{Enabled: true, Status: &status})
+}
+
+// ReconcileReplicas godoc
+// @Summary      Reconcile the storage replica
+// @Description  Start checking in the background that the object of every media item exists on the replica. Missing objects are listed in the report of GET /admin/storage/replication, and copied again with repair=true.
+// @Tags         admin
+// @Produce      json
+// @Param        repair  query     bool  false  "Copy missing objects to the replica"
+// @Success      202     {object}  handlers.MessageResponse
+// @Failure      403     {object}  object{error=string}
+// @Failure      409     {object}  object{error=string}
+// @Failure      501     {object}  object{error=string}
+// @Router       /admin/storage/replication/reconcile [post]
+// @Security     BearerAuth
+func ReconcileReplicas(c *gin.Context) {
+	status, enabled := storage.GetReplicationStatus()
+	if !enabled {
+		c.Error(apierror.New(http.StatusNotImplemented, "Storage replication is not enabled"))
+		return
+	}
+	if status.LastReconcile != nil && status.LastReconcile.Status == storage.ReconcileRunning {
+		c.Error(apierror.Conflict("A reconciliation is already running"))
+		return
+	}
+
+	repair := c.Query("repair") == "true"
+	go func() {
+		if _, err := reconcileMediaReplicas(repair); err != nil && !errors.Is(err, storage.ErrReconcileRunning) {
+			log.Printf("Replica reconciliation failed: %v", err)
+		}
+	}()
+	c.JSON(http.StatusAccepted, MessageResponse{Message: "Reconciliation started"})
+}
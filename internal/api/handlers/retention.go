@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+// errMediaRetained is returned for replacing media under legal hold or retention
+var errMediaRetained = fmt.Errorf("%w and is under legal hold or retention, so it can't be replaced", errFilenameConflict)
+
+// mediaRetained reports whether media are under legal hold or within their retention
+// period, and so can't be deleted or replaced
+func mediaRetained(media *models.Media) bool {
+	return media.LegalHold || (media.RetainUntil != nil && media.RetainUntil.After(time.Now()))
+}
+
+// retainedError reports why media can't be deleted
+func retainedError(media *models.Media) *apierror.Error {
+	if media.LegalHold {
+		return apierror.Conflict("Media are under legal hold and can't be deleted")
+	}
+	return apierror.Conflict(fmt.Sprintf("Media are retained until %s and can't be deleted", media.RetainUntil.UTC().Format(time.RFC3339)))
+}
+
+// deletableOnly narrows a query of media about to be deleted to those neither under legal
+// hold nor within their retention period
+func deletableOnly(query *gorm.DB) *gorm.DB {
+	return query.Where("legal_hold = FALSE AND (retain_until IS NULL OR retain_until <= ?)", time.Now())
+}
+
+// mediaRetention returns the retention of media with its changes, newest first
+func mediaRetention(media *models.Media) (MediaRetentionResponse, error) {
+	response := MediaRetentionResponse{
+		MediaID:     media.ID,
+		LegalHold:   media.LegalHold,
+		RetainUntil: media.RetainUntil,
+		Retained:    mediaRetained(media),
+		Events:      []models.RetentionEvent{},
+	}
+	err := database.GetDB().Where("media_id = ?", media.ID).
+		Order("created_at DESC, id DESC").
+		Find(&response.Events).Error
+	return response, err
+}
+
+// GetMediaRetention godoc
+// @Summary      Legal hold and retention of a media item
+// @Description  Whether a media item is under legal hold, until when it is retained, and the changes made to both, newest first. Admins can read the retention of any media.
+// @Tags         media
+// @Produce      json
+// @Param        id   path      string  true  "Media ID"
+// @Success      200  {object}  handlers.MediaRetentionResponse
+// @Failure      404  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /media/{id}/retention [get]
+// @Security     BearerAuth
+func GetMediaRetention(c *gin.Context) {
+	media, _, ok := loadManagedMedia(c)
+	if !ok {
+		return
+	}
+	response, err := mediaRetention(media)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch retention events", err))
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SetMediaRetention godoc
+// @Summary      Place a legal hold or retention period on a media item
+// @Description  Media under legal hold or within their retention period can't be deleted, by themselves, in batches or by lifecycle rules, nor replaced. Anyone managing the media can place a hold or set or extend the retention period; releasing a hold and shortening or clearing a retention period still in force is up to admins, who must give a reason. Every change is recorded in the audit log.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        id         path      string                              true  "Media ID"
+// @Param        retention  body      handlers.SetMediaRetentionRequest  true  "Changes"
+// @Success      200        {object}  handlers.MediaRetentionResponse
+// @Failure      400        {object}  object{error=string}
+// @Failure      403        {object}  object{error=string}
+// @Failure      404        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Router       /media/{id}/retention [put]
+// @Security     BearerAuth
+func SetMediaRetention(c *gin.Context) {
+	var input SetMediaRetentionRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.LegalHold == nil && input.RetainUntil == nil {
+		c.Error(apierror.BadRequest("Set legal_hold or retain_until"))
+		return
+	}
+	var until *time.Time
+	if input.RetainUntil != nil && *input.RetainUntil != "" {
+		// A date retains media through that whole day
+		at, err := parseDateParam(*input.RetainUntil, true)
+		if err != nil {
+			c.Error(apierror.InvalidField("retain_until", err.Error()))
+			return
+		}
+		until = &at
+	}
+
+	media, admin, ok := loadManagedMedia(c)
+	if !ok {
+		return
+	}
+
+	var actions []models.RetentionEvent
+	updates := map[string]interface{}{}
+	if input.LegalHold != nil && *input.LegalHold != media.LegalHold {
+		if *input.LegalHold {
+			actions = append(actions, models.RetentionEvent{Action: models.RetentionHoldPlaced})
+		} else {
+			if !admin {
+				c.Error(apierror.Forbidden("Only admins can release a legal hold"))
+				return
+			}
+			actions = append(actions, models.RetentionEvent{Action: models.RetentionHoldReleased, Override: true})
+		}
+		updates["legal_hold"] = *input.LegalHold
+	}
+	if current := media.RetainUntil; input.RetainUntil != nil && !sameRetention(current, until) {
+		shortened := current != nil && (until == nil || until.Before(*current))
+		inForce := current != nil && current.After(time.Now())
+		if shortened && inForce && !admin {
+			c.Error(apierror.Forbidden("Only admins can shorten a retention period in force"))
+			return
+		}
+		action := models.RetentionSet
+		if shortened {
+			action = models.RetentionCleared
+		}
+		actions = append(actions, models.RetentionEvent{Action: action, Override: shortened && inForce})
+		updates["retain_until"] = until
+	}
+
+	reason := strings.TrimSpace(input.Reason)
+	for _, action := range actions {
+		if action.Override && reason == "" {
+			c.Error(apierror.InvalidField("reason", "is required to release a legal hold or shorten a retention period"))
+			return
+		}
+	}
+
+	if len(updates) > 0 {
+		if legalHold, ok := updates["legal_hold"]; ok {
+			media.LegalHold = legalHold.(bool)
+		}
+		if _, ok := updates["retain_until"]; ok {
+			media.RetainUntil = until
+		}
+		for i := range actions {
+			actions[i].MediaID = media.ID
+			actions[i].OwnerID = media.UserID
+			actions[i].UserID = c.GetUint("user_id")
+			actions[i].RetainUntil = media.RetainUntil
+			actions[i].Reason = reason
+		}
+		err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Media{}).Where("id = ?", media.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+			return tx.Create(&actions).Error
+		})
+		if err != nil {
+			c.Error(apierror.Internal("Failed to update retention", err))
+			return
+		}
+		notifyMediaUpdated(media)
+	}
+
+	response, err := mediaRetention(media)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch retention events", err))
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// sameRetention reports whether two retention periods end at the same time
+func sameRetention(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// ListRetentionEvents godoc
+// @Summary      Retention audit log
+// @Description  Legal holds and retention periods placed, released and changed on the media of every user, newest first. Admin overrides are flagged with override and carry their reason.
+// @Tags         admin
+// @Produce      json
+// @Param        media_id  query     string  false  "Only events of this media item"
+// @Param        user_id   query     int     false  "Only events of this user's media"
+// @Param        override  query     bool    false  "Only admin overrides"
+// @Param        page      query     int     false  "Page number (default 1)"
+// @Param        limit     query     int     false  "Items per page (default 10, at most 100)"
+// @Success      200       {object}  handlers.RetentionEventsResponse
+// @Failure      400       {object}  object{error=string}
+// @Failure      403       {object}  object{error=string}
+// @Failure      500       {object}  object{error=string}
+// @Router       /admin/retention/events [get]
+// @Security     BearerAuth
+func ListRetentionEvents(c *gin.Context) {
+	page, limit := pageParams(c)
+
+	query := database.GetDB().Model(&models.RetentionEvent{})
+	if mediaID := c.Query("media_id"); mediaID != "" {
+		query = query.Where("media_id = ?", mediaID)
+	}
+	if param := c.Query("user_id"); param != "" {
+		userID, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			c.Error(apierror.InvalidField("user_id", "must be a user ID"))
+			return
+		}
+		query = query.Where("owner_id = ?", userID)
+	}
+	if c.Query("override") == "true" {
+		query = query.Where("override = TRUE")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.Error(apierror.Internal("Failed to count retention events", err))
+		return
+	}
+	events := []models.RetentionEvent{}
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&events).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch retention events", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, RetentionEventsResponse{
+		Events: events,
+		Pagination: Pagination{
+			CurrentPage: page,
+			TotalPages:  (total + int64(limit) - 1) / int64(limit),
+			TotalItems:  total,
+			PerPage:     limit,
+		},
+	})
+}
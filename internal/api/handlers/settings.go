@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+)
+
+// ReloadConfig godoc
+// @Summary      Reload configuration
+// @Description  Re-read the environment and .env and apply the settings that can change without a restart, as SIGHUP does: rate limits, transform presets, MAX_UPLOAD_SIZE and the upload type, image proxy host and CORS origin allowlists. Other settings still need a restart. Lists the variables whose values changed. When the new configuration is invalid, nothing is applied and the problems are returned.
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  handlers.ConfigReloadResponse
+// @Failure      403  {object}  object{error=string}
+// @Failure      422  {object}  object{error=string}
+// @Router       /admin/config/reload [post]
+// @Security     BearerAuth
+func ReloadConfig(c *gin.Context) {
+	changed, err := config.Reload()
+	if err != nil {
+		c.Error(apierror.New(http.StatusUnprocessableEntity, "Invalid configuration, nothing was reloaded").WithDetails(err.Error()))
+		return
+	}
+	if len(changed) > 0 {
+		log.Printf("Configuration reloaded by user %d: %s", c.GetUint("user_id"), strings.Join(changed, ", "))
+	}
+	c.JSON(http.StatusOK, ConfigReloadResponse{Changed: changed})
+}
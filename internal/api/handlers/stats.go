@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/scheduler"
+)
+
+const (
+	// maxStatsDays caps the days of uploads and failed batches the admin stats cover
+	maxStatsDays = 365
+	// maxStatsLimit caps the entries of each admin stats ranking
+	maxStatsLimit = 100
+)
+
+// GetAdminStats godoc
+// @Summary      System statistics
+// @Description  Users, storage per user, uploads per day, top MIME types, failed background jobs and batches, the slowest cached transforms and the load of the transform workers
+// @Tags         admin
+// @Produce      json
+// @Param        days   query     int  false  "Days of uploads and failed batches to cover (default 30, at most 365)"
+// @Param        limit  query     int  false  "Entries per ranking (default 10, at most 100)"
+// @Success      200    {object}  handlers.AdminStatsResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      403    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /admin/stats [get]
+// @Security     BearerAuth
+func GetAdminStats(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days < 1 || days > maxStatsDays {
+		c.Error(apierror.InvalidField("days", "days must be between 1 and 365"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > maxStatsLimit {
+		c.Error(apierror.InvalidField("limit", "limit must be between 1 and 100"))
+		return
+	}
+
+	stats, err := adminStats(time.Now().AddDate(0, 0, -days), limit)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to compute statistics", err))
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// adminStats aggregates the system statistics, with uploads and failed batches since
+// since and limit entries per ranking. Each figure is a single grouped query.
+func adminStats(since time.Time, limit int) (AdminStatsResponse, error) {
+	db := database.GetDB()
+	stats := AdminStatsResponse{
+		StorageByUser:     []UserStorage{},
+		UploadsPerDay:     []DailyUploads{},
+		TopMimeTypes:      []MimeTypeUsage{},
+		FailedJobs:        []scheduler.JobStatus{},
+		FailedBatches:     []models.ImportJob{},
+		SlowestTransforms: []SlowTransform{},
+		TransformPool:     transformPoolStats(),
+	}
+
+	if err := db.Model(&models.User{}).Count(&stats.Users).Error; err != nil {
+		return stats, err
+	}
+
+	var totals struct {
+		Count int64
+		Bytes int64
+	}
+	if err := db.Model(&models.Media{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Scan(&totals).Error; err != nil {
+		return stats, err
+	}
+	stats.Media, stats.Bytes = totals.Count, totals.Bytes
+
+	if err := db.Model(&models.Media{}).
+		Select("media.user_id, users.username, COUNT(*) AS count, COALESCE(SUM(media.size), 0) AS bytes").
+		Joins("JOIN users ON users.id = media.user_id").
+		Group("media.user_id, users.username").
+		Order("bytes DESC").Limit(limit).
+		Scan(&stats.StorageByUser).Error; err != nil {
+		return stats, err
+	}
+
+	// Uploads count whether or not the media were deleted since
+	if err := db.Unscoped().Model(&models.Media{}).
+		Select("to_char(date_trunc('day', created_at), 'YYYY-MM-DD') AS day, COUNT(*) AS uploads, COALESCE(SUM(size), 0) AS bytes").
+		Where("created_at >= ?", since).
+		Group("day").Order("day").
+		Scan(&stats.UploadsPerDay).Error; err != nil {
+		return stats, err
+	}
+
+	if err := db.Model(&models.Media{}).
+		Select("mime_type, COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Group("mime_type").
+		Order("count DESC").Limit(limit).
+		Scan(&stats.TopMimeTypes).Error; err != nil {
+		return stats, err
+	}
+
+	for _, job := range scheduler.Status() {
+		if job.Failures > 0 {
+			stats.FailedJobs = append(stats.FailedJobs, job)
+		}
+	}
+
+	if err := db.Where("failed > 0 AND created_at >= ?", since).
+		Order("created_at DESC, id DESC").Limit(limit).
+		Find(&stats.FailedBatches).Error; err != nil {
+		return stats, err
+	}
+
+	if err := db.Model(&models.Derivative{}).
+		Select("derivatives.media_id, derivatives.cache_key, media.mime_type, derivatives.size, derivatives.render_ms, derivatives.created_at").
+		Joins("JOIN media ON media.id = derivatives.media_id").
+		Where("derivatives.render_ms > 0").
+		Order("derivatives.render_ms DESC").Limit(limit).
+		Scan(&stats.SlowestTransforms).Error; err != nil {
+		return stats, err
+	}
+
+	return stats, nil
+}
+
+// GetMediaStats godoc
+// @Summary      Media statistics
+// @Description  Counts and bytes of the current user's media by MIME type, by folder and by upload month
+// @Tags         media
+// @Produce      json
+// @Success      200  {object}  handlers.MediaStatsResponse
+// @Failure      500  {object}  object{error=string}
+// @Router       /media/stats [get]
+// @Security     BearerAuth
+func GetMediaStats(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	db := database.GetDB()
+	stats := MediaStatsResponse{
+		ByMimeType: []MimeTypeUsage{},
+		ByFolder:   []FolderUsage{},
+		ByMonth:    []MonthlyUsage{},
+	}
+
+	if err := db.Model(&models.Media{}).
+		Select("mime_type, COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Group("mime_type").
+		Order("bytes DESC").
+		Scan(&stats.ByMimeType).Error; err != nil {
+		c.Error(apierror.Internal("Failed to compute media statistics", err))
+		return
+	}
+	for _, entry := range stats.ByMimeType {
+		stats.Count += entry.Count
+		stats.Bytes += entry.Bytes
+	}
+
+	if err := db.Model(&models.Media{}).
+		Select("media.folder_id, folders.name, COUNT(*) AS count, COALESCE(SUM(media.size), 0) AS bytes").
+		Joins("LEFT JOIN folders ON folders.id = media.folder_id").
+		Where("media.user_id = ?", userID).
+		Group("media.folder_id, folders.name").
+		Order("bytes DESC").
+		Scan(&stats.ByFolder).Error; err != nil {
+		c.Error(apierror.Internal("Failed to compute media statistics", err))
+		return
+	}
+
+	if err := db.Model(&models.Media{}).
+		Select("to_char(date_trunc('month', created_at), 'YYYY-MM') AS month, COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Group("month").Order("month").
+		Scan(&stats.ByMonth).Error; err != nil {
+		c.Error(apierror.Internal("Failed to compute media statistics", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
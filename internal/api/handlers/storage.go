@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// objectOptions converts the options to what storage backends take
+func (o StorageOptions) objectOptions() storage.ObjectOptions {
+	return storage.ObjectOptions{StorageClass: o.StorageClass, Encryption: o.Encryption}
+}
+
+// formStorageOptions reads the storage_class and encryption fields of a multipart upload
+func formStorageOptions(c *gin.Context) (storage.ObjectOptions, *apierror.Error) {
+	opts := storage.ObjectOptions{
+		StorageClass: c.PostForm("storage_class"),
+		Encryption:   c.PostForm("encryption"),
+	}
+	if opts.StorageClass != "" && !slices.Contains(storage.StorageClasses, opts.StorageClass) {
+		return opts, apierror.InvalidField("storage_class", "must be one of "+strings.Join(storage.StorageClasses, ", "))
+	}
+	if opts.Encryption != "" && !slices.Contains(storage.Encryptions, opts.Encryption) {
+		return opts, apierror.InvalidField("encryption", "must be one of "+strings.Join(storage.Encryptions, ", "))
+	}
+	return opts, nil
+}
+
+// selectUploadBackend picks the backend for an upload stored with opts, reporting on c
+// when no backend can apply them
+func selectUploadBackend(c *gin.Context, opts storage.ObjectOptions) (string, storage.Storage, bool) {
+	backendName, provider, err := storage.SelectUploadBackendWith(opts)
+	if err != nil {
+		c.Error(apierror.New(http.StatusNotImplemented, "Storage class and encryption options need an S3 storage backend"))
+		return "", nil, false
+	}
+	return backendName, provider, true
+}
+
+// GetStorageCacheStats godoc
+// @Summary      Storage cache statistics
+// @Description  Hit, miss and eviction counters of the local cache in front of remote storage
+// @Tags         storage
+// @Produce      json
+// @Success      200  {object}  object{enabled=bool,stats=storage.CacheStats}
+// @Router       /storage/cache/stats [get]
+// @Security     BearerAuth
+func GetStorageCacheStats(c *gin.Context) {
+	stats, enabled := storage.GetCacheStats()
+	if !enabled {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": true,
+		"stats":   stats,
+	})
+}
+
+// ListStorageBackends godoc
+// @Summary      Storage backend health
+// @Description  Latency, error rate, retries, circuit breaker state and health score of every configured backend, healthiest first
+// @Tags         admin
+// @Produce      json
+// @Success      200  {object}  object{backends=[]storage.BackendHealth,override=string}
+// @Failure      403  {object}  object{error=string}
+// @Router       /admin/storage/backends [get]
+// @Security     BearerAuth
+func ListStorageBackends(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"backends": storage.BackendsHealth(),
+		"override": storage.UploadOverride(),
+	})
+}
+
+// SetStorageUploadBackend godoc
+// @Summary      Override upload backend
+// @Description  Pin new uploads to a backend; an empty backend restores automatic health-based selection
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        input  body      object{backend=string}  true  "Backend name"
+// @Success      200    {object}  object{message=string,override=string}
+// @Failure      400    {object}  object{error=string}
+// @Failure      403    {object}  object{error=string}
+// @Router       /admin/storage/upload-backend [put]
+// @Security     BearerAuth
+func SetStorageUploadBackend(c *gin.Context) {
+	var input UploadBackendRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if err := storage.SetUploadOverride(input.Backend); err != nil {
+		c.Error(apierror.BadRequest(err.Error()))
+		return
+	}
+
+	message := "Upload backend override cleared"
+	if input.Backend != "" {
+		message = "Uploads pinned to " + input.Backend
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message":  message,
+		"override": input.Backend,
+	})
+}
+
+// GetPurgeJob godoc
+// @Summary      Get purge job progress
+// @Description  Report how many stored objects a background purge has deleted so far
+// @Tags         media
+// @Produce      json
+// @Param        id   path      string  true  "Purge job ID"
+// @Success      200  {object}  object{job=storage.PurgeJob}
+// @Failure      404  {object}  object{error=string}
+// @Router       /media/purges/{id} [get]
+// @Security     BearerAuth
+func GetPurgeJob(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	job, ok := storage.GetPurgeJob(userID.(uint), c.Param("id"))
+	if !ok {
+		c.Error(apierror.NotFound("Purge job not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+	"go-media-center-example/internal/websocket"
+)
+
+// errUploadTooLarge aborts a streamed upload that grew past the size limit
+var errUploadTooLarge = errors.New("File too large")
+
+// uniqueObjectName returns a storage key for filename that no other object has. Keys
+// derive from the name on some backends, so a bare filename would collide across users
+// and repeated uploads. The name stays last, keeping its extension.
+func uniqueObjectName(prefix, filename string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + "-" + hex.EncodeToString(b) + "-" + filepath.Base(filename)
+}
+
+// mediaObjectName is the storage key of an uploaded file
+func mediaObjectName(filename string) string {
+	return uniqueObjectName("media", filename)
+}
+
+// discardObject deletes an object stored for an upload that failed afterwards. It isn't
+// cancelled with ctx, as a client going away is a common reason for the failure.
+func discardObject(ctx context.Context, provider storage.Storage, path string) {
+	provider.Delete(context.WithoutCancel(ctx), path)
+}
+
+// trackUpload reports progress of reading an upload's content to the user's websocket
+// connections. A total of zero or less means the size is unknown.
+func trackUpload(userID uint, filename string, body io.Reader, total int64) io.Reader {
+	return websocket.GetManager().TrackUpload(userID, filename, body, total)
+}
+
+// streamedUpload is what a single pass over an uploaded body learned about it
+type streamedUpload struct {
+	FileID string
+	Size   int64
+	SHA256 string
+	spool  *os.File // Copy of an image kept for classification
+}
+
+// streamUpload stores body in one pass under a unique key for filename. While the provider reads it, the content is
+// counted against maxSize, hashed and, for images, spooled to a temporary file so it can
+// be classified without downloading it back from storage. The caller must Close the
+// returned upload.
+func streamUpload(ctx context.Context, provider storage.Storage, body io.Reader, filename, mimeType string, maxSize int64) (*streamedUpload, error) {
+	upload := &streamedUpload{}
+	hash := sha256.New()
+	sinks := []io.Writer{hash}
+	if strings.HasPrefix(mimeType, "image/") {
+		spool, err := os.CreateTemp("", "url-upload-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create temp file: %v", err)
+		}
+		upload.spool = spool
+		sinks = append(sinks, spool)
+	}
+
+	limited := &sizeLimitReader{reader: body, limit: maxSize}
+	fileID, err := provider.Upload(ctx, io.TeeReader(limited, io.MultiWriter(sinks...)), mediaObjectName(filename))
+	if limited.exceeded {
+		// Providers that buffer the body may have stored it before seeing the error
+		if err == nil {
+			discardObject(ctx, provider, fileID)
+		}
+		upload.Close()
+		return nil, errUploadTooLarge
+	}
+	if err != nil {
+		upload.Close()
+		return nil, err
+	}
+
+	upload.FileID = fileID
+	upload.Size = limited.read
+	upload.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return upload, nil
+}
+
+// Analyze classifies a spooled image and extracts its colors; the analysis is empty
+// for other files
+func (u *streamedUpload) Analyze() (*utils.ImageAnalysis, error) {
+	if u.spool == nil {
+		return &utils.ImageAnalysis{}, nil
+	}
+	return utils.AnalyzeImage(u.spool)
+}
+
+// Close removes the spooled copy
+func (u *streamedUpload) Close() {
+	if u.spool != nil {
+		u.spool.Close()
+		os.Remove(u.spool.Name())
+	}
+}
+
+// sizeLimitReader counts the bytes read and fails once more than limit went through
+type sizeLimitReader struct {
+	reader   io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		r.exceeded = true
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
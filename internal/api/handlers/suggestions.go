@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/tagging"
+	"go-media-center-example/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// classifyEdge is the longest edge of the rendition sent to the classifier; larger
+	// images cost more to send without improving the labels
+	classifyEdge = 1024
+	// classifyTimeout bounds reading, scaling and classifying one image
+	classifyTimeout = 2 * time.Minute
+)
+
+// The classifier suggesting tags and the queue of media IDs waiting for it; nil while
+// auto-tagging is disabled
+var (
+	autoTagger   tagging.Classifier
+	autoTagQueue chan string
+)
+
+// StartAutoTagging starts suggesting tags for new images with the configured classifier
+// and requeues the images a restart interrupted. It does nothing when no classifier is
+// configured, and must be called once before requests are served.
+func StartAutoTagging(cfg config.TaggingConfig) error {
+	if cfg.Provider == "" {
+		return nil
+	}
+
+	classifier, err := tagging.NewClassifier(cfg)
+	if err != nil {
+		return err
+	}
+	autoTagger = classifier
+	autoTagQueue = make(chan string, cfg.Buffer)
+	for i := 0; i < max(cfg.Workers, 1); i++ {
+		go runAutoTagging()
+	}
+	go requeuePendingSuggestions()
+	log.Printf("Suggesting tags with %s", classifier.Name())
+	return nil
+}
+
+// autoTagSupported reports whether media can be classified
+func autoTagSupported(media *models.Media) bool {
+	switch media.MimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// queueAutoTagging marks media as waiting for suggestions and queues it. Media that
+// already has suggestions, like a copy, is left alone unless force is set.
+func queueAutoTagging(media *models.Media, force bool) error {
+	if autoTagQueue == nil || !autoTagSupported(media) {
+		return nil
+	}
+	if !force && loadSuggestions(media) != nil {
+		return nil
+	}
+
+	if err := saveSuggestions(database.GetDB(), media.ID, &TagSuggestions{Status: SuggestionsPending, Classifier: autoTagger.Name()}); err != nil {
+		return err
+	}
+	select {
+	case autoTagQueue <- media.ID:
+		return nil
+	default:
+		failed := &TagSuggestions{Status: SuggestionsFailed, Classifier: autoTagger.Name(), Error: "Too many images waiting to be classified"}
+		saveSuggestions(database.GetDB(), media.ID, failed)
+		return errors.New(failed.Error)
+	}
+}
+
+// requeuePendingSuggestions queues the media left pending by the previous shutdown
+func requeuePendingSuggestions() {
+	var ids []string
+	if err := database.GetDB().Model(&models.Media{}).
+		Where("metadata->'suggestions'->>'status' = ?", SuggestionsPending).
+		Pluck("id", &ids).Error; err != nil {
+		log.Printf("Failed to load media waiting for tag suggestions: %v", err)
+		return
+	}
+	for _, id := range ids {
+		autoTagQueue <- id
+	}
+}
+
+// runAutoTagging classifies queued media until the queue closes
+func runAutoTagging() {
+	for id := range autoTagQueue {
+		classifyMedia(id)
+	}
+}
+
+// classifyMedia stores the suggestions for one media item, or why there are none
+func classifyMedia(id string) {
+	ctx := context.Background()
+	db := database.GetDB()
+	var media models.Media
+	if err := db.Preload("Tags").Where("id = ?", id).First(&media).Error; err != nil {
+		// Deleted while waiting
+		return
+	}
+
+	cfg := config.GetConfig().Tagging
+	now := time.Now()
+	suggestions := &TagSuggestions{Status: SuggestionsDone, Classifier: autoTagger.Name(), ClassifiedAt: &now}
+	result, err := classifyImage(ctx, &media)
+	if err != nil {
+		log.Printf("Failed to classify media %s: %v", media.ID, err)
+		suggestions.Status = SuggestionsFailed
+		suggestions.Error = err.Error()
+	} else {
+		existing := make(map[string]bool, len(media.Tags))
+		for _, tag := range media.Tags {
+			existing[strings.ToLower(tag.Name)] = true
+		}
+		suggestions.Tags = newTagSuggestions(result.Tags, cfg, existing, true)
+		suggestions.Objects = newTagSuggestions(result.Objects, cfg, existing, false)
+	}
+
+	if err := saveSuggestions(database.GetDB(), media.ID, suggestions); err != nil {
+		log.Printf("Failed to store tag suggestions of media %s: %v", media.ID, err)
+		return
+	}
+	notifyMediaUpdatedByID(media.UserID, []string{media.ID})
+}
+
+// classifyImage sends a scaled-down JPEG of media to the classifier
+func classifyImage(ctx context.Context, media *models.Media) (*tagging.Result, error) {
+	reader, err := storage.GetBackend(media.StorageBackend).Download(ctx, media.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original file: %v", err)
+	}
+	defer reader.Close()
+
+	data, err := utils.TransformImage(reader, utils.TransformationOptions{
+		Width:   classifyEdge,
+		Height:  classifyEdge,
+		Fit:     "contain",
+		Quality: 85,
+		Format:  "jpeg",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, classifyTimeout)
+	defer cancel()
+	return autoTagger.Classify(ctx, data, "image/jpeg")
+}
+
+// newTagSuggestions keeps the confident labels, at most MaxLabels of them. Labels naming
+// a tag the media already has are not suggested. Tags are suggested once per name,
+// objects once per place they were found.
+func newTagSuggestions(labels []tagging.Label, cfg config.TaggingConfig, existing map[string]bool, unique bool) []TagSuggestion {
+	suggestions := []TagSuggestion{}
+	seen := map[string]bool{}
+	for _, label := range labels {
+		name := strings.ToLower(strings.TrimSpace(label.Name))
+		if name == "" || label.Confidence < cfg.MinConfidence || existing[name] || (unique && seen[name]) {
+			continue
+		}
+		if len(suggestions) == cfg.MaxLabels {
+			break
+		}
+		seen[name] = true
+		suggestions = append(suggestions, TagSuggestion{Name: name, Confidence: label.Confidence, Box: label.Box, Status: SuggestionSuggested})
+	}
+	return suggestions
+}
+
+// loadSuggestions reads the suggestions of media from its metadata, nil if it has none
+func loadSuggestions(media *models.Media) *TagSuggestions {
+	var metadata struct {
+		Suggestions *TagSuggestions `json:"suggestions"`
+	}
+	if len(media.Metadata) == 0 || json.Unmarshal(media.Metadata, &metadata) != nil {
+		return nil
+	}
+	return metadata.Suggestions
+}
+
+// saveSuggestions writes the suggestions into the metadata of a media item, leaving the
+// other keys alone. updated_at is kept, as it versions the content in thumbnail URLs.
+func saveSuggestions(db *gorm.DB, mediaID string, suggestions *TagSuggestions) error {
+	payload, err := json.Marshal(suggestions)
+	if err != nil {
+		return err
+	}
+	return db.Model(&models.Media{}).Where("id = ?", mediaID).UpdateColumn("metadata", gorm.Expr(
+		"jsonb_set(CASE WHEN jsonb_typeof(metadata) = 'object' THEN metadata ELSE '{}'::jsonb END, '{suggestions}', ?::jsonb)",
+		string(payload))).Error
+}
+
+// GetMediaSuggestions godoc
+// @Summary      Get tag suggestions
+// @Description  Tags and object labels the classifier suggested for an image, with whether each was accepted or rejected. suggestions is null for media never classified.
+// @Tags         media
+// @Produce      json
+// @Param        id   path      string  true  "Media ID"
+// @Success      200  {object}  handlers.SuggestionsResponse
+// @Failure      404  {object}  object{error=string}
+// @Router       /media/{id}/suggestions [get]
+// @Security     BearerAuth
+func GetMediaSuggestions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var media models.Media
+	if err := database.GetDB().Select("id", "metadata").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+
+	c.JSON(http.StatusOK, SuggestionsResponse{Suggestions: loadSuggestions(&media)})
+}
+
+// ClassifyMedia godoc
+// @Summary      Suggest tags for an image
+// @Description  Queue an image for the classifier, replacing its previous suggestions. New images are queued on upload; this retries failed ones or classifies older ones.
+// @Tags         media
+// @Produce      json
+// @Param        id   path      string  true  "Media ID"
+// @Success      202  {object}  handlers.SuggestionsResponse
+// @Failure      404  {object}  object{error=string}
+// @Failure      415  {object}  object{error=string}
+// @Failure      501  {object}  object{error=string}
+// @Failure      503  {object}  object{error=string}
+// @Router       /media/{id}/suggestions [post]
+// @Security     BearerAuth
+func ClassifyMedia(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	if autoTagQueue == nil {
+		c.Error(apierror.New(http.StatusNotImplemented, "Auto-tagging is not configured"))
+		return
+	}
+
+	var media models.Media
+	if err := database.GetDB().Select("id", "mime_type").Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+	if !autoTagSupported(&media) {
+		c.Error(apierror.New(http.StatusUnsupportedMediaType, "Tags can only be suggested for JPEG, PNG and GIF images"))
+		return
+	}
+
+	if err := queueAutoTagging(&media, true); err != nil {
+		c.Error(apierror.New(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	c.JSON(http.StatusAccepted, SuggestionsResponse{Suggestions: &TagSuggestions{Status: SuggestionsPending, Classifier: autoTagger.Name()}})
+}
+
+// ReviewMediaSuggestions godoc
+// @Summary      Accept or reject tag suggestions
+// @Description  Accepted suggestions are added to the media tags; rejecting one accepted before removes its tag again. A name applies to the tag and every object of that name.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        id     path      string                             true  "Media ID"
+// @Param        input  body      handlers.ReviewSuggestionsRequest  true  "Names to accept and reject"
+// @Success      200    {object}  handlers.ReviewSuggestionsResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /media/{id}/suggestions/review [post]
+// @Security     BearerAuth
+func ReviewMediaSuggestions(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var input ReviewSuggestionsRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	decisions := map[string]string{}
+	for _, name := range normalizeTagNames(input.Accept) {
+		decisions[strings.ToLower(name)] = SuggestionAccepted
+	}
+	for _, name := range normalizeTagNames(input.Reject) {
+		if decisions[strings.ToLower(name)] == SuggestionAccepted {
+			c.Error(apierror.InvalidField("reject", fmt.Sprintf("%q is also accepted", name)))
+			return
+		}
+		decisions[strings.ToLower(name)] = SuggestionRejected
+	}
+	if len(decisions) == 0 {
+		c.Error(apierror.InvalidField("accept", "accept or reject at least one suggestion"))
+		return
+	}
+
+	tx := database.GetDB().Begin()
+
+	// Lock the row so concurrent reviews don't overwrite each other's decisions
+	var media models.Media
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&media).Error; err != nil {
+		tx.Rollback()
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+	suggestions := loadSuggestions(&media)
+	if suggestions == nil || suggestions.Status != SuggestionsDone {
+		tx.Rollback()
+		c.Error(apierror.Conflict("The media has no suggestions to review"))
+		return
+	}
+
+	// Tags to add, and tags to remove because their suggestion was accepted before
+	var accept, revoke []string
+	for name, decision := range decisions {
+		found := false
+		previous := ""
+		for _, list := range [][]TagSuggestion{suggestions.Tags, suggestions.Objects} {
+			for i := range list {
+				if list[i].Name != name {
+					continue
+				}
+				found = true
+				if list[i].Status == SuggestionAccepted {
+					previous = SuggestionAccepted
+				}
+				list[i].Status = decision
+			}
+		}
+		if !found {
+			field := "accept"
+			if decision == SuggestionRejected {
+				field = "reject"
+			}
+			tx.Rollback()
+			c.Error(apierror.InvalidField(field, fmt.Sprintf("no suggestion named %q", name)))
+			return
+		}
+		if decision == SuggestionAccepted {
+			accept = append(accept, name)
+		} else if previous == SuggestionAccepted {
+			revoke = append(revoke, name)
+		}
+	}
+
+	if len(accept) > 0 {
+		tags, err := findOrCreateTags(accept)
+		if err != nil {
+			tx.Rollback()
+			c.Error(apierror.Internal("Failed to create tags", err))
+			return
+		}
+		if err := tx.Model(&media).Association("Tags").Append(&tags); err != nil {
+			tx.Rollback()
+			c.Error(apierror.Internal("Failed to tag media", err))
+			return
+		}
+	}
+	if len(revoke) > 0 {
+		if err := tx.Exec("DELETE FROM media_tags WHERE media_id = ? AND tag_id IN (SELECT id FROM tags WHERE name IN ?)", media.ID, revoke).Error; err != nil {
+			tx.Rollback()
+			c.Error(apierror.Internal("Failed to untag media", err))
+			return
+		}
+	}
+	if err := saveSuggestions(tx, media.ID, suggestions); err != nil {
+		tx.Rollback()
+		c.Error(apierror.Internal("Failed to store suggestions", err))
+		return
+	}
+	if err := tx.Commit().Error; err != nil {
+		c.Error(apierror.Internal("Failed to store suggestions", err))
+		return
+	}
+
+	if err := database.GetDB().Preload("Tags").Where("id = ?", media.ID).First(&media).Error; err != nil {
+		c.Error(apierror.Internal("Failed to reload media", err))
+		return
+	}
+	notifyMediaUpdated(&media)
+	c.JSON(http.StatusOK, ReviewSuggestionsResponse{Suggestions: suggestions, Media: newMediaItem(&media)})
+}
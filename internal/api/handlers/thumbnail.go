@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Thumbnail edge lengths clients may request; a fixed set keeps the number of cached variants small
+var thumbnailSizes = map[int]bool{64: true, 128: true, 256: true, 512: true}
+
+const (
+	defaultThumbnailSize = 256
+	maxThumbnailBatch    = 200
+	thumbnailURLLifetime = 24 * time.Hour
+)
+
+var errThumbnailUnsupported = errors.New("thumbnails are not available for this media type")
+
+// parseThumbnailSize validates a requested thumbnail size, defaulting to defaultThumbnailSize
+func parseThumbnailSize(value string) (int, error) {
+	if value == "" {
+		return defaultThumbnailSize, nil
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || !thumbnailSizes[size] {
+		return 0, fmt.Errorf("invalid thumbnail size: %s (expected 64, 128, 256 or 512)", value)
+	}
+	return size, nil
+}
+
+// thumbnailVersion changes whenever the media content is replaced
+func thumbnailVersion(media *models.Media) string {
+	return strconv.FormatInt(media.UpdatedAt.Unix(), 10)
+}
+
+// thumbnailFormat keeps transparency for PNG and GIF sources and uses JPEG for everything else
+func thumbnailFormat(media *models.Media) string {
+	if media.MimeType == "image/png" || media.MimeType == "image/gif" {
+		return "png"
+	}
+	return "jpeg"
+}
+
+// signThumbnail signs the query values of a thumbnail URL
+func signThumbnail(secret, mediaID, size, version, expires string) string {
+	return utils.SignParams(secret, "thumb", mediaID, size, version, expires)
+}
+
+// VerifyThumbnailToken checks the signature and expiry of a signed thumbnail request
+func VerifyThumbnailToken(c *gin.Context) bool {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+
+	cfg := config.GetConfig()
+	return utils.VerifyParams(cfg.JWT.Secret, c.Query("token"), "thumb", c.Param("id"), c.Query("size"), c.Query("v"), c.Query("expires"))
+}
+
+// signedThumbnailURL builds a thumbnail URL that can be fetched without an Authorization header
+func signedThumbnailURL(secret string, media *models.Media, size int, expires int64) string {
+	sizeStr := strconv.Itoa(size)
+	version := thumbnailVersion(media)
+	expiresStr := strconv.FormatInt(expires, 10)
+
+	query := url.Values{}
+	query.Set("size", sizeStr)
+	query.Set("v", version)
+	query.Set("expires", expiresStr)
+	query.Set("token", signThumbnail(secret, media.ID, sizeStr, version, expiresStr))
+	return fmt.Sprintf("/api/v1/media/%s/thumb?%s", url.PathEscape(media.ID), query.Encode())
+}
+
+// thumbnailExpiry rounds the expiry up to the next hour so repeated listings hand out
+// identical URLs and browsers can reuse their cached copies
+func thumbnailExpiry(now time.Time) int64 {
+	return now.Add(thumbnailURLLifetime).Truncate(time.Hour).Add(time.Hour).Unix()
+}
+
+// thumbnailSupported reports whether thumbnails can be rendered for media: images and
+// documents with previews
+func thumbnailSupported(media *models.Media) bool {
+	return strings.HasPrefix(media.MimeType, "image/") || utils.IsDocument(media.MimeType, media.Filename)
+}
+
+// loadThumbnail returns the cached thumbnail of media, rendering and storing it on a miss
+func loadThumbnail(ctx context.Context, media *models.Media, size int) (data []byte, hit bool, err error) {
+	if !thumbnailSupported(media) {
+		return nil, false, errThumbnailUnsupported
+	}
+	isDocument := utils.IsDocument(media.MimeType, media.Filename)
+
+	storageProvider := storage.GetBackend(media.StorageBackend)
+	cacheKey := fmt.Sprintf("thumb_%s_%d_%s", media.ID, size, thumbnailVersion(media))
+
+	if data, ok := loadDerivative(ctx, cacheKey); ok {
+		return data, true, nil
+	}
+
+	// Grids of new uploads request the same thumbnails at once; render each only once
+	data, _, err = pooledTransform(ctx, cacheKey, func(ctx context.Context) ([]byte, error) {
+		return renderThumbnail(ctx, storageProvider, media, size, isDocument, cacheKey)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return data, false, nil
+}
+
+// renderThumbnail renders a thumbnail from the original and caches it under cacheKey
+func renderThumbnail(ctx context.Context, storageProvider storage.Storage, media *models.Media, size int, isDocument bool, cacheKey string) ([]byte, error) {
+	started := time.Now()
+	reader, err := storageProvider.Download(ctx, media.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original file: %v", err)
+	}
+	defer reader.Close()
+
+	var source io.Reader = reader
+	if isDocument {
+		preview, err := utils.RenderDocumentPreview(reader, media.Filename)
+		if err != nil {
+			return nil, err
+		}
+		source = bytes.NewReader(preview)
+	}
+
+	data, err := utils.TransformImage(source, utils.TransformationOptions{
+		Width:   size,
+		Height:  size,
+		Fit:     "cover",
+		Crop:    "smart",
+		Quality: 75,
+		Format:  thumbnailFormat(media),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed cache write only costs a re-render next time
+	if err := storeDerivative(ctx, media, cacheKey, data, time.Since(started)); err != nil {
+		log.Printf("Failed to cache thumbnail %s: %v", cacheKey, err)
+	}
+	return data, nil
+}
+
+// GetMediaThumbnail godoc
+// @Summary      Get media thumbnail
+// @Description  Serve a small square thumbnail of an image or document. Accepts either a Bearer token or the signed query returned by POST /media/thumbs.
+// @Tags         media
+// @Produce      image/jpeg,image/png
+// @Param        id       path      string  true   "Media ID"
+// @Param        size     query     int     false  "Edge length: 64, 128, 256 (default) or 512"
+// @Param        v        query     string  false  "Content version from a signed URL"
+// @Param        expires  query     int     false  "Signed URL expiry (unix seconds)"
+// @Param        token    query     string  false  "Signed URL token"
+// @Success      200      {file}    binary
+// @Success      304      "Not modified"
+// @Failure      400      {object}  object{error=string}
+// @Failure      403      {object}  object{error=string}
+// @Failure      404      {object}  object{error=string}
+// @Failure      413      {object}  object{error=string}
+// @Failure      415      {object}  object{error=string}
+// @Failure      503      {object}  object{error=string}
+// @Router       /media/{id}/thumb [get]
+// @Security     BearerAuth
+func GetMediaThumbnail(c *gin.Context) {
+	ctx := c.Request.Context()
+	size, err := parseThumbnailSize(c.Query("size"))
+	if err != nil {
+		c.Error(apierror.BadRequest(err.Error()))
+		return
+	}
+
+	query := database.GetDB().
+		Select("id", "user_id", "filename", "path", "storage_backend", "mime_type", "updated_at").
+		Where("id = ?", c.Param("id"))
+	if c.GetBool("signed_access") {
+		// Signed links only reach published media with a current license
+		query = publiclyShared(query)
+	} else {
+		userID, _ := c.Get("user_id")
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var media models.Media
+	if err := query.First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return
+	}
+
+	// Versioned URLs never change content, so they can be cached indefinitely
+	etag := fmt.Sprintf(`"%s-%d-%s"`, media.ID, size, thumbnailVersion(&media))
+	if c.Query("v") == thumbnailVersion(&media) {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "private, max-age=300")
+	}
+	c.Header("ETag", etag)
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, hit, err := loadThumbnail(ctx, &media, size)
+	if err != nil {
+		if errors.Is(err, errThumbnailUnsupported) {
+			c.Error(apierror.New(http.StatusUnsupportedMediaType, err.Error()))
+			return
+		}
+		if transformOverloaded(err) || errors.Is(err, utils.ErrImageTooLarge) {
+			reportTransformError(c, err)
+			return
+		}
+		c.Error(apierror.Internal("Failed to generate thumbnail", err))
+		return
+	}
+
+	if hit {
+		c.Header("X-Cache", "HIT")
+	} else {
+		c.Header("X-Cache", "MISS")
+	}
+	c.Data(http.StatusOK, "image/"+thumbnailFormat(&media), data)
+}
+
+// GetMediaThumbnails godoc
+// @Summary      Get thumbnails for many media items
+// @Description  Return signed thumbnail URLs for up to 200 media items in one call, optionally inlining the images as data URIs. Media whose license expired get no URL.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        input  body      object{ids=[]string,size=int,inline=bool}  true  "Media IDs, thumbnail size and whether to inline images"
+// @Success      200    {object}  object{size=int,expires=int,thumbnails=[]object{id=string,url=string,data=string,error=string}}
+// @Failure      400    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /media/thumbs [post]
+// @Security     BearerAuth
+func GetMediaThumbnails(c *gin.Context) {
+	ctx := c.Request.Context()
+	cfg := config.GetConfig()
+	userID, _ := c.Get("user_id")
+
+	var input ThumbnailsRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	if len(input.IDs) > maxThumbnailBatch {
+		c.Error(apierror.InvalidField("ids", fmt.Sprintf("must have at most %d items", maxThumbnailBatch)))
+		return
+	}
+
+	size := defaultThumbnailSize
+	if input.Size != 0 {
+		var err error
+		if size, err = parseThumbnailSize(strconv.Itoa(input.Size)); err != nil {
+			c.Error(apierror.InvalidField("size", err.Error()))
+			return
+		}
+	}
+
+	var media []models.Media
+	if err := database.GetDB().
+		Select("id", "user_id", "filename", "path", "storage_backend", "mime_type", "updated_at", "license_expires_at").
+		Where("id IN ? AND user_id = ?", input.IDs, userID).
+		Find(&media).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch media", err))
+		return
+	}
+
+	byID := make(map[string]*models.Media, len(media))
+	for i := range media {
+		byID[media[i].ID] = &media[i]
+	}
+
+	expires := thumbnailExpiry(time.Now())
+	results := make([]gin.H, len(input.IDs))
+
+	// Render inline thumbnails concurrently with a limit
+	sem := make(chan struct{}, 5)
+	var wg sync.WaitGroup
+
+	for i, id := range input.IDs {
+		item, ok := byID[id]
+		if !ok {
+			results[i] = gin.H{"id": id, "error": "Media not found"}
+			continue
+		}
+
+		results[i] = gin.H{"id": id}
+		if !licenseExpired(item) {
+			results[i]["url"] = signedThumbnailURL(cfg.JWT.Secret, item, size, expires)
+		}
+		if !input.Inline {
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(result gin.H, item *models.Media) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			data, _, err := loadThumbnail(ctx, item, size)
+			if err != nil {
+				result["error"] = err.Error()
+				return
+			}
+			result["data"] = "data:image/" + thumbnailFormat(item) + ";base64," + base64.StdEncoding.EncodeToString(data)
+		}(results[i], item)
+	}
+
+	wg.Wait()
+
+	c.JSON(http.StatusOK, gin.H{
+		"size":       size,
+		"expires":    expires,
+		"thumbnails": results,
+	})
+}
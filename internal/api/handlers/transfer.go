@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+// transferPlan is what an ownership transfer moves: live folders with their subfolders,
+// and live media picked by ID or in those folders
+type transferPlan struct {
+	FolderIDs []uint
+	Folders   []models.Folder // Transferred folders whose parent stays with the source user
+	Media     []models.Media
+	Bytes     int64
+}
+
+// TransferOwnership godoc
+// @Summary      Transfer media and folders to another user
+// @Description  Hands media and folders of a user to another one, for example when an employee leaves. Folders move with their subfolders, the media in them and their lifecycle rules; the topmost ones land in the recipient's root, numbered when a name is taken there. Media moved without their folder land in the recipient's root too. The recipient's quota must fit the transferred bytes unless ignore_quota is set. Everything happens in one transaction, recorded in the transfer log.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int                               true  "ID of the user giving up the media"
+// @Param        input  body      handlers.OwnershipTransferRequest  true  "Recipient and what to transfer"
+// @Success      200    {object}  models.OwnershipTransfer
+// @Failure      400    {object}  object{error=string}
+// @Failure      403    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      413    {object}  object{error=string}
+// @Router       /admin/users/{id}/transfer [post]
+// @Security     BearerAuth
+func TransferOwnership(c *gin.Context) {
+	var input OwnershipTransferRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if !input.All && len(input.MediaIDs) == 0 && len(input.FolderIDs) == 0 {
+		c.Error(apierror.BadRequest("Nothing to transfer").
+			WithDetails("Give media_ids, folder_ids or all"))
+		return
+	}
+
+	db := database.GetDB()
+	var from, to models.User
+	if err := db.Select("id").First(&from, c.Param("id")).Error; err != nil {
+		c.Error(apierror.NotFound("User not found"))
+		return
+	}
+	if err := db.Select("id").First(&to, input.ToUserID).Error; err != nil {
+		c.Error(apierror.InvalidField("to_user_id", "User not found"))
+		return
+	}
+	if from.ID == to.ID {
+		c.Error(apierror.InvalidField("to_user_id", "Media can't be transferred to their owner"))
+		return
+	}
+
+	var plan *transferPlan
+	record := models.OwnershipTransfer{
+		AdminID:    c.GetUint("user_id"),
+		FromUserID: from.ID,
+		ToUserID:   to.ID,
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if plan, err = planTransfer(tx, from.ID, input); err != nil {
+			return err
+		}
+		if !input.IgnoreQuota {
+			if err := checkQuota(to.ID, plan.Bytes); err != nil {
+				return quotaError(err)
+			}
+		}
+		if err := applyTransfer(tx, plan, to.ID); err != nil {
+			return err
+		}
+
+		mediaIDs := make([]string, len(plan.Media))
+		for i := range plan.Media {
+			mediaIDs[i] = plan.Media[i].ID
+		}
+		record.MediaCount = len(plan.Media)
+		record.FolderCount = len(plan.FolderIDs)
+		record.Bytes = plan.Bytes
+		record.MediaIDs, _ = json.Marshal(mediaIDs)
+		record.FolderIDs, _ = json.Marshal(plan.FolderIDs)
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		var apiErr *apierror.Error
+		if errors.As(err, &apiErr) {
+			c.Error(apiErr)
+		} else if database.IsUniqueViolation(err) {
+			c.Error(apierror.Conflict("The recipient's folders changed during the transfer, try again"))
+		} else {
+			c.Error(apierror.Internal("Failed to transfer ownership", err))
+		}
+		return
+	}
+
+	// URLs on the previous owner's domain no longer serve the media
+	purgeFromCDN(plan.Media...)
+	var mediaIDs []string
+	json.Unmarshal(record.MediaIDs, &mediaIDs)
+	notifyMediaDeleted(from.ID, mediaIDs...)
+	notifyMediaUpdatedByID(to.ID, mediaIDs)
+	for i := range plan.Folders {
+		notifyFolderDeleted(from.ID, strconv.FormatUint(uint64(plan.Folders[i].ID), 10))
+		notifyFolderUpdated(&plan.Folders[i])
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+// planTransfer resolves what a transfer from userID moves. Folders and media picked by ID
+// must be live and belong to the user.
+func planTransfer(tx *gorm.DB, userID uint, input OwnershipTransferRequest) (*transferPlan, error) {
+	plan := &transferPlan{}
+	if input.All {
+		if err := tx.Model(&models.Folder{}).Where("user_id = ?", userID).Order("id").
+			Pluck("id", &plan.FolderIDs).Error; err != nil {
+			return nil, err
+		}
+	} else if len(input.FolderIDs) > 0 {
+		var owned int64
+		if err := tx.Model(&models.Folder{}).Where("id IN ? AND user_id = ?", input.FolderIDs, userID).
+			Count(&owned).Error; err != nil {
+			return nil, err
+		}
+		if int(owned) != len(uniqueFolderIDs(input.FolderIDs)) {
+			return nil, apierror.InvalidField("folder_ids", "Folder not found")
+		}
+		if err := tx.Raw(`WITH RECURSIVE subtree AS (
+				SELECT id FROM folders WHERE id IN ? AND user_id = ? AND deleted_at IS NULL
+				UNION
+				SELECT folders.id FROM folders
+				JOIN subtree ON folders.parent_id = subtree.id
+				WHERE folders.user_id = ? AND folders.deleted_at IS NULL
+			)
+			SELECT id FROM subtree ORDER BY id`, input.FolderIDs, userID, userID).Scan(&plan.FolderIDs).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	transferred := make(map[uint]bool, len(plan.FolderIDs))
+	for _, id := range plan.FolderIDs {
+		transferred[id] = true
+	}
+	if len(plan.FolderIDs) > 0 {
+		var folders []models.Folder
+		if err := tx.Where("id IN ?", plan.FolderIDs).Order("id").Find(&folders).Error; err != nil {
+			return nil, err
+		}
+		for _, folder := range folders {
+			if folder.ParentID == nil || !transferred[*folder.ParentID] {
+				plan.Folders = append(plan.Folders, folder)
+			}
+		}
+	}
+
+	query := tx.Where("user_id = ?", userID)
+	if !input.All {
+		folderIDs := folderIDStrings(plan.FolderIDs)
+		switch {
+		case len(input.MediaIDs) > 0 && len(folderIDs) > 0:
+			query = query.Where("(id IN ? OR folder_id IN ?)", input.MediaIDs, folderIDs)
+		case len(input.MediaIDs) > 0:
+			query = query.Where("id IN ?", input.MediaIDs)
+		default:
+			query = query.Where("folder_id IN ?", folderIDs)
+		}
+	}
+	if err := query.Order("created_at, id").Find(&plan.Media).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(plan.Media))
+	for i := range plan.Media {
+		found[plan.Media[i].ID] = true
+		plan.Bytes += plan.Media[i].Size
+	}
+	for _, id := range input.MediaIDs {
+		if !found[id] {
+			return nil, apierror.InvalidField("media_ids", fmt.Sprintf("Media %s not found", id))
+		}
+	}
+	return plan, nil
+}
+
+// applyTransfer hands the folders and media of plan to userID. The topmost folders move to
+// the recipient's root, numbered when a root folder already has their name.
+func applyTransfer(tx *gorm.DB, plan *transferPlan, userID uint) error {
+	for i := range plan.Folders {
+		folder := &plan.Folders[i]
+		name, err := freeRootFolderName(tx, userID, folder.Name)
+		if err != nil {
+			return err
+		}
+		slug, err := models.UniqueFolderSlug(tx, userID, nil, name, folder.ID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(folder).Updates(map[string]interface{}{
+			"user_id":   userID,
+			"parent_id": nil,
+			"name":      name,
+			"slug":      slug,
+		}).Error; err != nil {
+			return err
+		}
+		folder.UserID, folder.ParentID, folder.Name, folder.Slug = userID, nil, name, slug
+	}
+
+	if len(plan.FolderIDs) > 0 {
+		// Subfolders keep their parents, which moved along with them
+		if err := tx.Model(&models.Folder{}).Where("id IN ?", plan.FolderIDs).
+			Update("user_id", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.LifecycleRule{}).Where("folder_id IN ?", plan.FolderIDs).
+			Update("user_id", userID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.LifecycleAction{}).Where("folder_id IN ?", plan.FolderIDs).
+			Update("user_id", userID).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(plan.Media) == 0 {
+		return nil
+	}
+	ids := make([]string, len(plan.Media))
+	for i := range plan.Media {
+		ids[i] = plan.Media[i].ID
+	}
+	if err := tx.Model(&models.Media{}).Where("id IN ?", ids).Update("user_id", userID).Error; err != nil {
+		return err
+	}
+	// Media whose folder stays with the previous owner land in the recipient's root
+	orphaned := tx.Model(&models.Media{}).Where("id IN ? AND folder_id IS NOT NULL", ids)
+	if len(plan.FolderIDs) > 0 {
+		orphaned = orphaned.Where("folder_id NOT IN ?", folderIDStrings(plan.FolderIDs))
+	}
+	return orphaned.Update("folder_id", nil).Error
+}
+
+// freeRootFolderName returns name, or name numbered " (2)", " (3)"… when a root folder of
+// userID already has it
+func freeRootFolderName(tx *gorm.DB, userID uint, name string) (string, error) {
+	candidate := name
+	for n := 2; ; n++ {
+		var count int64
+		if err := tx.Model(&models.Folder{}).
+			Where("user_id = ? AND parent_id IS NULL AND name = ?", userID, candidate).
+			Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s (%d)", name, n)
+	}
+}
+
+// folderIDStrings formats folder IDs the way media refer to them
+func folderIDStrings(ids []uint) []string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strs
+}
+
+// uniqueFolderIDs drops repeated IDs
+func uniqueFolderIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	var unique []uint
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// ListOwnershipTransfers godoc
+// @Summary      Ownership transfer log
+// @Description  Transfers of media and folders between users, newest first, optionally those from or to one user
+// @Tags         admin
+// @Produce      json
+// @Param        user_id  query     int  false  "Only transfers from or to this user"
+// @Param        page     query     int  false  "Page number"  default(1)
+// @Param        limit    query     int  false  "Items per page, at most 100"  default(10)
+// @Success      200      {object}  handlers.OwnershipTransfersResponse
+// @Failure      403      {object}  object{error=string}
+// @Router       /admin/transfers [get]
+// @Security     BearerAuth
+func ListOwnershipTransfers(c *gin.Context) {
+	page, limit := pageParams(c)
+
+	query := database.GetDB().Model(&models.OwnershipTransfer{})
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("(from_user_id = ? OR to_user_id = ?)", userID, userID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.Error(apierror.Internal("Failed to count transfers", err))
+		return
+	}
+
+	transfers := []models.OwnershipTransfer{}
+	if err := query.Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&transfers).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch transfers", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, OwnershipTransfersResponse{
+		Transfers: transfers,
+		Pagination: Pagination{
+			CurrentPage: page,
+			TotalPages:  (total + int64(limit) - 1) / int64(limit),
+			TotalItems:  total,
+			PerPage:     limit,
+		},
+	})
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/config"
+)
+
+// transformRetryAfter is the Retry-After, in seconds, of requests refused by a busy pool
+const transformRetryAfter = 5
+
+var (
+	errTransformsBusy   = errors.New("too many transforms are queued")
+	errTransformTimeout = errors.New("transform did not finish in time")
+)
+
+// transformJob is a render waiting for a worker. done is buffered, so workers never
+// block on requests that stopped waiting.
+type transformJob struct {
+	ctx    context.Context
+	render func(ctx context.Context) ([]byte, error)
+	done   chan transformResult
+}
+
+type transformResult struct {
+	data []byte
+	err  error
+}
+
+// transformPool renders transforms with a fixed number of workers, so a burst of large
+// images queues up instead of exhausting CPU and memory
+type transformPool struct {
+	queue   chan *transformJob
+	timeout time.Duration
+	active  atomic.Int64
+	refused atomic.Int64 // Requests turned away by a full queue
+	expired atomic.Int64 // Requests that stopped waiting after the timeout
+}
+
+var (
+	transforms     *transformPool
+	transformsOnce sync.Once
+)
+
+// getTransformPool starts the workers on first use
+func getTransformPool() *transformPool {
+	transformsOnce.Do(func() {
+		cfg := config.GetConfig().Transform
+		transforms = &transformPool{
+			queue:   make(chan *transformJob, max(cfg.Queue, 0)),
+			timeout: cfg.Timeout,
+		}
+		for i := 0; i < max(cfg.Workers, 1); i++ {
+			go transforms.work()
+		}
+	})
+	return transforms
+}
+
+func (p *transformPool) work() {
+	for job := range p.queue {
+		p.active.Add(1)
+		data, err := job.render(job.ctx)
+		p.active.Add(-1)
+		job.done <- transformResult{data: data, err: err}
+	}
+}
+
+// run queues render and waits for its result. It fails with errTransformsBusy when the
+// queue is full and with errTransformTimeout when the render takes too long; a render
+// that timed out still finishes, so renders that store a derivative are cached for a retry.
+func (p *transformPool) run(ctx context.Context, render func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	job := &transformJob{ctx: ctx, render: render, done: make(chan transformResult, 1)}
+	select {
+	case p.queue <- job:
+	default:
+		p.refused.Add(1)
+		return nil, errTransformsBusy
+	}
+
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		timer := time.NewTimer(p.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case result := <-job.done:
+		return result.data, result.err
+	case <-timeout:
+		p.expired.Add(1)
+		return nil, errTransformTimeout
+	}
+}
+
+// pooledTransform renders through the worker pool, once for all concurrent callers with
+// the same key
+func pooledTransform(ctx context.Context, key string, render func(ctx context.Context) ([]byte, error)) (data []byte, shared bool, err error) {
+	return coalesceTransform(ctx, key, func(ctx context.Context) ([]byte, error) {
+		return getTransformPool().run(ctx, render)
+	})
+}
+
+// transformOverloaded reports whether a transform was refused or given up on because the
+// pool is saturated
+func transformOverloaded(err error) bool {
+	return errors.Is(err, errTransformsBusy) || errors.Is(err, errTransformTimeout)
+}
+
+// reportTransformError reports a failed transform, telling clients when to retry those
+// refused by a saturated pool
+func reportTransformError(c *gin.Context, err error) {
+	if transformOverloaded(err) {
+		c.Header("Retry-After", strconv.Itoa(transformRetryAfter))
+	}
+	c.Error(transformError(err))
+}
+
+// transformPoolStats returns the load of the pool and its refusals since startup
+func transformPoolStats() TransformPoolStats {
+	pool := getTransformPool()
+	return TransformPoolStats{
+		Workers: max(config.GetConfig().Transform.Workers, 1),
+		Active:  pool.active.Load(),
+		Queued:  len(pool.queue),
+		Queue:   cap(pool.queue),
+		Refused: pool.refused.Load(),
+		Expired: pool.expired.Load(),
+	}
+}
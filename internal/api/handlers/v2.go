@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// V2Response is the envelope of every successful /api/v2 response; failures are answered
+// with apierror.EnvelopeResponse. Meta carries
+// information about the data, such as pagination, and is omitted when there is none.
+type V2Response struct {
+	Data interface{} `json:"data"`
+	Meta interface{} `json:"meta,omitempty"`
+}
+
+// respondV2 writes data in the /api/v2 envelope
+func respondV2(c *gin.Context, status int, data, meta interface{}) {
+	c.JSON(status, V2Response{Data: data, Meta: meta})
+}
+
+// GetMediaV2 returns a media item with its tags
+func GetMediaV2(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var media models.Media
+	if err := database.GetDB().Preload("Tags").
+		Where("id = ? AND user_id = ?", c.Param("id"), userID).
+		First(&media).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Error(apierror.NotFound("Media not found"))
+			return
+		}
+		c.Error(apierror.Internal("Failed to load media", err))
+		return
+	}
+
+	recordMediaAccess(media.UserID, media.ID, models.AccessView)
+	respondV2(c, http.StatusOK, newMediaItem(&media), nil)
+}
+
+// GetFolderV2 returns a folder with its media count
+func GetFolderV2(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	db := database.GetDB()
+
+	var folder models.Folder
+	if err := db.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&folder).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Error(apierror.NotFound("Folder not found"))
+			return
+		}
+		c.Error(apierror.Internal("Failed to load folder", err))
+		return
+	}
+
+	items := []FolderItem{newFolderItem(&folder)}
+	if err := setFolderMediaCounts(items, c.Query("include_subfolders") == "true"); err != nil {
+		c.Error(apierror.Internal("Failed to count folder media", err))
+		return
+	}
+
+	respondV2(c, http.StatusOK, items[0], nil)
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/utils"
+)
+
+// maxPageSize is the most items a page of a list holds
+const maxPageSize = 100
+
+// pageParams reads the page and limit query parameters of a list, defaulting to the first
+// page of 10 items. Pages start at 1 and hold between 1 and maxPageSize items.
+func pageParams(c *gin.Context) (page, limit int) {
+	page, err := strconv.Atoi(c.Query("page"))
+	if err != nil {
+		page = 1
+	}
+	limit, err = strconv.Atoi(c.Query("limit"))
+	if err != nil {
+		limit = 10
+	}
+	return max(page, 1), min(max(limit, 1), maxPageSize)
+}
+
+// bindJSON binds the JSON body into obj and checks its binding rules. On failure it
+// reports the error as a binding error, which ErrorHandler answers with the invalid
+// fields, and returns false.
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		c.Error(err).SetType(gin.ErrorTypeBind)
+		return false
+	}
+	return true
+}
+
+// optionsError reports invalid transformation options, naming the offending option below
+// prefix: the query parameter itself, or its path in a JSON body
+func optionsError(prefix string, err error) *apierror.Error {
+	var optErr *utils.OptionError
+	if errors.As(err, &optErr) {
+		return apierror.InvalidField(prefix+optErr.Option, optErr.Message)
+	}
+	return apierror.BadRequest("Invalid transformation parameters").WithDetails(err.Error())
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		query       string
+		page, limit int
+	}{
+		{"", 1, 10},
+		{"page=3&limit=25", 3, 25},
+		{"page=0&limit=0", 1, 1},
+		{"page=-2&limit=-5", 1, 1},
+		{"limit=1000", 1, maxPageSize},
+		{"page=abc&limit=abc", 1, 10},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/?"+tt.query, nil)
+		page, limit := pageParams(c)
+		if page != tt.page || limit != tt.limit {
+			t.Errorf("pageParams(%q) = %d, %d, want %d, %d", tt.query, page, limit, tt.page, tt.limit)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+)
+
+// maxCachedWatermarks bounds the decoded watermark cache; it is reset when full
+const maxCachedWatermarks = 32
+
+var (
+	errInvalidWatermark = errors.New("invalid watermark")
+
+	watermarkCacheMu sync.Mutex
+	watermarkCache   = make(map[string]image.Image)
+)
+
+// resolveWatermark loads the watermark requested in options into options.WatermarkImage,
+// filling in the configured defaults. Users may watermark with their own images or the
+// configured default. The returned key identifies the watermark for derivative cache keys.
+func resolveWatermark(ctx context.Context, options *utils.TransformationOptions, userID interface{}) (string, error) {
+	if !options.HasWatermark() {
+		return "", nil
+	}
+	if err := options.ValidateWatermark(); err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidWatermark, err)
+	}
+
+	cfg := config.GetConfig()
+	if options.WatermarkPosition == "" {
+		options.WatermarkPosition = cfg.Watermark.Position
+	}
+	if options.WatermarkOpacity == 0 {
+		options.WatermarkOpacity = cfg.Watermark.Opacity
+	}
+	if options.WatermarkScale == 0 {
+		options.WatermarkScale = cfg.Watermark.Scale
+	}
+
+	query := database.GetDB()
+	if options.Watermark == utils.DefaultWatermark {
+		if cfg.Watermark.MediaID == "" {
+			return "", fmt.Errorf("%w: no default watermark is configured", errInvalidWatermark)
+		}
+		query = query.Where("id = ?", cfg.Watermark.MediaID)
+	} else {
+		query = query.Where("id = ? AND user_id = ?", options.Watermark, userID)
+	}
+
+	var mark models.Media
+	if err := query.First(&mark).Error; err != nil {
+		return "", fmt.Errorf("%w: watermark media not found", errInvalidWatermark)
+	}
+	if !strings.HasPrefix(mark.MimeType, "image/") {
+		return "", fmt.Errorf("%w: watermark media must be an image", errInvalidWatermark)
+	}
+
+	version := fmt.Sprintf("%s@%d", mark.ID, mark.UpdatedAt.Unix())
+	img, err := loadWatermarkImage(ctx, &mark, version)
+	if err != nil {
+		return "", err
+	}
+	options.WatermarkImage = img
+
+	key := fmt.Sprintf("wm%s_%s_o%g_s%g", version, options.WatermarkPosition, options.WatermarkOpacity, options.WatermarkScale)
+	return key, nil
+}
+
+// loadWatermarkImage decodes a watermark, reusing the decoded image across requests
+func loadWatermarkImage(ctx context.Context, mark *models.Media, version string) (image.Image, error) {
+	watermarkCacheMu.Lock()
+	img, ok := watermarkCache[version]
+	watermarkCacheMu.Unlock()
+	if ok {
+		return img, nil
+	}
+
+	reader, err := storage.GetBackend(mark.StorageBackend).Download(ctx, mark.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watermark: %v", err)
+	}
+	defer reader.Close()
+
+	img, _, err = image.Decode(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to decode watermark: %v", errInvalidWatermark, err)
+	}
+
+	watermarkCacheMu.Lock()
+	if len(watermarkCache) >= maxCachedWatermarks {
+		watermarkCache = make(map[string]image.Image)
+	}
+	watermarkCache[version] = img
+	watermarkCacheMu.Unlock()
+
+	return img, nil
+}
+
+// watermarkError maps a resolveWatermark error to the error it is reported with, naming
+// the invalid option below prefix like optionsError
+func watermarkError(prefix string, err error) *apierror.Error {
+	var optErr *utils.OptionError
+	switch {
+	case errors.As(err, &optErr):
+		return optionsError(prefix, optErr)
+	case errors.Is(err, errInvalidWatermark):
+		return apierror.InvalidField(prefix+"watermark", err.Error())
+	}
+	return apierror.Internal("Failed to load watermark", err)
+}
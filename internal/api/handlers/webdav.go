@@ -0,0 +1,748 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/net/webdav"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/storage"
+	"go-media-center-example/internal/utils"
+)
+
+// WebDAVPrefix is where the WebDAV tree is served
+const WebDAVPrefix = "/webdav"
+
+// WebDAVMethods are the methods the WebDAV tree answers
+var WebDAVMethods = []string{
+	http.MethodOptions, http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete,
+	"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+var (
+	// errFolderNotEmpty is returned for deleting a folder that still holds media or folders
+	errFolderNotEmpty = errors.New("folder is not empty")
+	// errMoveIntoItself is returned for moving a folder below itself
+	errMoveIntoItself = errors.New("a folder can't be moved into itself")
+)
+
+// webdavLocks holds a lock system per user, as every user sees a tree of their own
+var webdavLocks = struct {
+	sync.Mutex
+	systems map[uint]webdav.LockSystem
+}{systems: make(map[uint]webdav.LockSystem)}
+
+// WebDAV godoc
+// @Summary      WebDAV access to the library
+// @Description  Serve the user's folders as collections and media as resources, so file managers and tools such as rclone can browse, download, upload, move and delete files. Accepts HTTP Basic credentials as well as a Bearer token.
+// @Tags         webdav
+// @Router       /webdav/{path} [get]
+// @Security     BearerAuth
+func WebDAV(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	fsys := &webdavFS{userID: userID.(uint)}
+
+	// Let downloads carry the stored type rather than one guessed from their first bytes
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		name := strings.TrimPrefix(c.Request.URL.Path, WebDAVPrefix)
+		if info, err := fsys.Stat(c.Request.Context(), name); err == nil && !info.IsDir() {
+			c.Header("Content-Type", info.(*webdavInfo).mimeType)
+		}
+	}
+
+	handler := &webdav.Handler{
+		Prefix:     WebDAVPrefix,
+		FileSystem: fsys,
+		LockSystem: webdavLockSystem(fsys.userID),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrExist) {
+				log.Printf("WebDAV %s %s for user %d: %v", r.Method, r.URL.Path, fsys.userID, err)
+			}
+		},
+	}
+	handler.ServeHTTP(&webdavResponse{ResponseWriter: c.Writer, fsys: fsys}, c.Request)
+}
+
+// webdavLockSystem returns the lock system of a user's tree
+func webdavLockSystem(userID uint) webdav.LockSystem {
+	webdavLocks.Lock()
+	defer webdavLocks.Unlock()
+	if webdavLocks.systems[userID] == nil {
+		webdavLocks.systems[userID] = webdav.NewMemLS()
+	}
+	return webdavLocks.systems[userID]
+}
+
+// webdavResponse answers failed uploads with the status and message of their error. The
+// webdav package reports every failed write as 405 Method Not Allowed.
+type webdavResponse struct {
+	http.ResponseWriter
+	fsys     *webdavFS
+	replaced bool
+}
+
+func (w *webdavResponse) WriteHeader(status int) {
+	if status == http.StatusMethodNotAllowed && w.fsys.failure != nil {
+		status = w.fsys.failure.Status
+		w.replaced = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *webdavResponse) Write(p []byte) (int, error) {
+	if w.replaced {
+		// The status text of 405 is swapped for the error message once
+		w.replaced = false
+		io.WriteString(w.ResponseWriter, w.fsys.failure.Message)
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// webdavFS presents a user's library as a file system: folders are directories below the
+// root and media are files named by their filename. Where names repeat within a folder,
+// the oldest folder or media item is the one reached by path.
+type webdavFS struct {
+	userID  uint
+	failure *apierror.Error // Why the last upload failed
+}
+
+// webdavEntry is a resolved path: the root when folder and media are both nil
+type webdavEntry struct {
+	folder *models.Folder
+	media  *models.Media
+}
+
+// folderID is the folder_id of media placed in the entry, which must be a directory
+func (e *webdavEntry) folderID() *string {
+	if e.folder == nil {
+		return nil
+	}
+	id := strconv.FormatUint(uint64(e.folder.ID), 10)
+	return &id
+}
+
+// splitWebDAVPath splits a path into its directory names and final name
+func splitWebDAVPath(name string) ([]string, string) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return nil, ""
+	}
+	parts := strings.Split(name, "/")
+	return parts[:len(parts)-1], parts[len(parts)-1]
+}
+
+// childFolder looks up a folder by name below parent, nil for the root
+func (fsys *webdavFS) childFolder(parent *models.Folder, name string) (*models.Folder, error) {
+	query := database.GetDB().Where("user_id = ? AND name = ?", fsys.userID, name)
+	if parent == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", parent.ID)
+	}
+
+	var folder models.Folder
+	if err := query.Order("id").First(&folder).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// childMedia looks up a media item by filename in a directory
+func (fsys *webdavFS) childMedia(dir *webdavEntry, name string) (*models.Media, error) {
+	query := database.GetDB().Where("user_id = ? AND filename = ?", fsys.userID, name)
+	if folderID := dir.folderID(); folderID != nil {
+		query = query.Where("folder_id = ?", *folderID)
+	} else {
+		query = query.Where("folder_id IS NULL")
+	}
+
+	var media models.Media
+	if err := query.Order("created_at, id").First(&media).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fs.ErrNotExist
+		}
+		return nil, err
+	}
+	return &media, nil
+}
+
+// resolveDir resolves a path of folder names from the root
+func (fsys *webdavFS) resolveDir(names []string) (*webdavEntry, error) {
+	dir := &webdavEntry{}
+	for _, name := range names {
+		folder, err := fsys.childFolder(dir.folder, name)
+		if err != nil {
+			return nil, err
+		}
+		dir = &webdavEntry{folder: folder}
+	}
+	return dir, nil
+}
+
+// resolve finds the folder or media item at a path. A folder shadows media of the same name.
+func (fsys *webdavFS) resolve(name string) (*webdavEntry, error) {
+	dirs, base := splitWebDAVPath(name)
+	parent, err := fsys.resolveDir(dirs)
+	if err != nil || base == "" {
+		return parent, err
+	}
+
+	folder, err := fsys.childFolder(parent.folder, base)
+	if err == nil {
+		return &webdavEntry{folder: folder}, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	media, err := fsys.childMedia(parent, base)
+	if err != nil {
+		return nil, err
+	}
+	return &webdavEntry{media: media}, nil
+}
+
+// resolveParent resolves the directory a path is in, and returns the path's final name
+func (fsys *webdavFS) resolveParent(name string) (*webdavEntry, string, error) {
+	dirs, base := splitWebDAVPath(name)
+	if base == "" {
+		return nil, "", fs.ErrPermission
+	}
+	parent, err := fsys.resolveDir(dirs)
+	return parent, base, err
+}
+
+// Mkdir creates a folder
+func (fsys *webdavFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	parent, base, err := fsys.resolveParent(name)
+	if err != nil {
+		return err
+	}
+	if _, err := fsys.resolve(name); err == nil {
+		return fs.ErrExist
+	}
+
+	folder := models.Folder{Name: base, UserID: fsys.userID}
+	if parent.folder != nil {
+		folder.ParentID = &parent.folder.ID
+	}
+	if err := database.GetDB().Create(&folder).Error; err != nil {
+		return err
+	}
+	notifyFolderCreated(&folder)
+	return nil
+}
+
+// OpenFile opens a folder for listing, a media item for reading or a file for writing
+func (fsys *webdavFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		entry, err := fsys.resolve(name)
+		if err != nil {
+			return nil, err
+		}
+		if entry.media == nil {
+			return &webdavDir{fsys: fsys, entry: entry}, nil
+		}
+		return &webdavFile{ctx: ctx, media: entry.media}, nil
+	}
+
+	parent, base, err := fsys.resolveParent(name)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := fsys.resolve(name)
+	switch {
+	case err == nil && entry.media == nil:
+		return nil, fmt.Errorf("%s is a folder", base)
+	case err == nil && flag&os.O_EXCL != 0:
+		return nil, fs.ErrExist
+	case err == nil && mediaRetained(entry.media):
+		return nil, fs.ErrPermission
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE == 0:
+		return nil, err
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	writer := &webdavWriter{ctx: ctx, fsys: fsys, dir: parent, filename: base}
+	if err == nil {
+		writer.existing = entry.media
+	}
+	return writer, nil
+}
+
+// RemoveAll deletes a media item, or a folder once it holds no media or folders, like the
+// folders API
+func (fsys *webdavFS) RemoveAll(ctx context.Context, name string) error {
+	entry, err := fsys.resolve(name)
+	if err != nil {
+		return err
+	}
+	db := database.GetDB()
+
+	if media := entry.media; media != nil {
+		if mediaRetained(media) {
+			return fs.ErrPermission
+		}
+		if err := storage.GetBackend(media.StorageBackend).Delete(ctx, media.Path); err != nil {
+			return err
+		}
+		if err := db.Delete(media).Error; err != nil {
+			return err
+		}
+		invalidateDerivatives(media.UserID, media.ID)
+		purgeFromCDN(*media)
+		notifyMediaDeleted(media.UserID, media.ID)
+		return nil
+	}
+
+	folder := entry.folder
+	if folder == nil {
+		return fs.ErrPermission
+	}
+	var contents int64
+	if err := db.Model(&models.Media{}).Where("folder_id = ?", *entry.folderID()).Count(&contents).Error; err != nil {
+		return err
+	}
+	if contents == 0 {
+		if err := db.Model(&models.Folder{}).Where("parent_id = ?", folder.ID).Count(&contents).Error; err != nil {
+			return err
+		}
+	}
+	if contents > 0 {
+		return errFolderNotEmpty
+	}
+
+	if err := db.Delete(folder).Error; err != nil {
+		return err
+	}
+	if err := db.Where("folder_id = ?", folder.ID).Delete(&models.LifecycleRule{}).Error; err != nil {
+		log.Printf("Failed to delete lifecycle rules of folder %d: %v", folder.ID, err)
+	}
+	notifyFolderDeleted(fsys.userID, *entry.folderID())
+	return nil
+}
+
+// Rename moves or renames a media item or folder
+func (fsys *webdavFS) Rename(ctx context.Context, oldName, newName string) error {
+	entry, err := fsys.resolve(oldName)
+	if err != nil {
+		return err
+	}
+	parent, base, err := fsys.resolveParent(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := fsys.resolve(newName); err == nil {
+		return fs.ErrExist
+	}
+	db := database.GetDB()
+
+	if media := entry.media; media != nil {
+		previousFilename := media.Filename
+		if err := db.Model(media).Updates(map[string]interface{}{
+			"filename":  base,
+			"folder_id": parent.folderID(),
+		}).Error; err != nil {
+			return err
+		}
+		// Document previews are converted according to the file extension
+		if media.Filename != previousFilename {
+			invalidateDerivatives(media.UserID, media.ID)
+			purgeFromCDN(*media)
+		}
+		notifyMediaUpdated(media)
+		return nil
+	}
+
+	folder := entry.folder
+	if folder == nil {
+		return fs.ErrPermission
+	}
+	var parentID *uint
+	if parent.folder != nil {
+		within, err := isFolderWithin(parent.folder.ID, folder.ID)
+		if err != nil {
+			return err
+		}
+		if within {
+			return errMoveIntoItself
+		}
+		parentID = &parent.folder.ID
+	}
+	slug, err := models.UniqueFolderSlug(db, fsys.userID, parentID, base, folder.ID)
+	if err != nil {
+		return err
+	}
+	if err := db.Model(folder).Updates(map[string]interface{}{
+		"name":      base,
+		"slug":      slug,
+		"parent_id": parentID,
+	}).Error; err != nil {
+		return err
+	}
+	notifyFolderUpdated(folder)
+	return nil
+}
+
+// Stat describes the folder or media item at a path
+func (fsys *webdavFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	entry, err := fsys.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return entry.info(), nil
+}
+
+// info describes a resolved entry
+func (e *webdavEntry) info() *webdavInfo {
+	switch {
+	case e.media != nil:
+		return mediaInfo(e.media)
+	case e.folder != nil:
+		return &webdavInfo{name: e.folder.Name, modTime: e.folder.UpdatedAt, dir: true}
+	default:
+		return &webdavInfo{name: "/", dir: true}
+	}
+}
+
+// mediaInfo describes a media item as a file
+func mediaInfo(media *models.Media) *webdavInfo {
+	return &webdavInfo{
+		name:     media.Filename,
+		size:     media.Size,
+		modTime:  media.UpdatedAt,
+		mimeType: media.MimeType,
+	}
+}
+
+// webdavInfo implements os.FileInfo, and webdav.ContentTyper so listings never read files
+// to guess their type
+type webdavInfo struct {
+	name     string
+	size     int64
+	modTime  time.Time
+	dir      bool
+	mimeType string
+}
+
+func (i *webdavInfo) Name() string       { return i.name }
+func (i *webdavInfo) Size() int64        { return i.size }
+func (i *webdavInfo) ModTime() time.Time { return i.modTime }
+func (i *webdavInfo) IsDir() bool        { return i.dir }
+func (i *webdavInfo) Sys() interface{}   { return nil }
+
+func (i *webdavInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ContentType implements webdav.ContentTyper
+func (i *webdavInfo) ContentType(ctx context.Context) (string, error) {
+	if i.mimeType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.mimeType, nil
+}
+
+// webdavDir is an open folder, or the root
+type webdavDir struct {
+	fsys    *webdavFS
+	entry   *webdavEntry
+	listing []os.FileInfo
+	listed  bool
+}
+
+// Readdir lists the folders and media of the directory, count at a time when count > 0
+func (d *webdavDir) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.listed {
+		listing, err := d.list()
+		if err != nil {
+			return nil, err
+		}
+		d.listing, d.listed = listing, true
+	}
+
+	if count <= 0 {
+		listing := d.listing
+		d.listing = nil
+		return listing, nil
+	}
+	if len(d.listing) == 0 {
+		return nil, io.EOF
+	}
+	n := min(count, len(d.listing))
+	listing := d.listing[:n]
+	d.listing = d.listing[n:]
+	return listing, nil
+}
+
+// list reads the folders and media of the directory
+func (d *webdavDir) list() ([]os.FileInfo, error) {
+	db := database.GetDB()
+
+	folders := db.Where("user_id = ?", d.fsys.userID)
+	media := db.Where("user_id = ?", d.fsys.userID)
+	if folderID := d.entry.folderID(); folderID != nil {
+		folders = folders.Where("parent_id = ?", d.entry.folder.ID)
+		media = media.Where("folder_id = ?", *folderID)
+	} else {
+		folders = folders.Where("parent_id IS NULL")
+		media = media.Where("folder_id IS NULL")
+	}
+
+	var subfolders []models.Folder
+	if err := folders.Order("name, id").Find(&subfolders).Error; err != nil {
+		return nil, err
+	}
+	var items []models.Media
+	if err := media.Select("id", "filename", "size", "mime_type", "updated_at").
+		Order("filename, created_at, id").Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	listing := make([]os.FileInfo, 0, len(subfolders)+len(items))
+	for i := range subfolders {
+		listing = append(listing, (&webdavEntry{folder: &subfolders[i]}).info())
+	}
+	for i := range items {
+		listing = append(listing, mediaInfo(&items[i]))
+	}
+	return listing, nil
+}
+
+func (d *webdavDir) Stat() (os.FileInfo, error)                   { return d.entry.info(), nil }
+func (d *webdavDir) Read(p []byte) (int, error)                   { return 0, fmt.Errorf("is a folder") }
+func (d *webdavDir) Write(p []byte) (int, error)                  { return 0, fs.ErrPermission }
+func (d *webdavDir) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (d *webdavDir) Close() error                                 { return nil }
+
+// webdavFile is a media item open for reading. Its object is downloaded as it is read;
+// seeking anywhere but the current position starts the download over.
+type webdavFile struct {
+	ctx     context.Context // Of the request that opened the file
+	media   *models.Media
+	body    io.ReadCloser
+	bodyPos int64 // Offset of the next byte body returns
+	offset  int64
+}
+
+func (f *webdavFile) Read(p []byte) (int, error) {
+	if f.offset >= f.media.Size {
+		return 0, io.EOF
+	}
+	if f.body == nil || f.bodyPos != f.offset {
+		if f.body != nil {
+			f.body.Close()
+		}
+		body, err := storage.GetBackend(f.media.StorageBackend).Download(f.ctx, f.media.Path)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(io.Discard, body, f.offset); err != nil {
+			body.Close()
+			return 0, err
+		}
+		f.body, f.bodyPos = body, f.offset
+	}
+
+	n, err := f.body.Read(p)
+	f.bodyPos += int64(n)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *webdavFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.media.Size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *webdavFile) Close() error {
+	if f.body != nil {
+		return f.body.Close()
+	}
+	return nil
+}
+
+func (f *webdavFile) Stat() (os.FileInfo, error) { return mediaInfo(f.media), nil }
+func (f *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, fmt.Errorf("is not a folder")
+}
+func (f *webdavFile) Write(p []byte) (int, error) { return 0, fs.ErrPermission }
+
+// webdavWriter stores what is written to a file, as a new media item or a new version of
+// existing. The content streams to storage as it is written. Nothing is stored for files
+// that stay empty, which file managers create before writing the content.
+type webdavWriter struct {
+	ctx      context.Context // Of the request that opened the file
+	fsys     *webdavFS
+	dir      *webdavEntry
+	filename string
+	existing *models.Media
+	pipe     *io.PipeWriter
+	done     chan error
+	written  int64
+}
+
+func (w *webdavWriter) Write(p []byte) (int, error) {
+	if w.pipe == nil {
+		reader, writer := io.Pipe()
+		w.pipe, w.done = writer, make(chan error, 1)
+		go func() {
+			err := w.store(reader)
+			// Unblocks the writer when storing stopped before the end of the content
+			reader.CloseWithError(err)
+			w.done <- err
+		}()
+	}
+	n, err := w.pipe.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *webdavWriter) Close() error {
+	if w.pipe == nil {
+		return nil
+	}
+	w.pipe.Close()
+	if err := <-w.done; err != nil {
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) {
+			apiErr = apierror.Internal("Failed to upload file", err)
+		}
+		w.fsys.failure = apiErr
+		return err
+	}
+	return nil
+}
+
+func (w *webdavWriter) Stat() (os.FileInfo, error) {
+	return &webdavInfo{name: w.filename, size: w.written, modTime: time.Now()}, nil
+}
+
+func (w *webdavWriter) Read(p []byte) (int, error)                   { return 0, fs.ErrPermission }
+func (w *webdavWriter) Seek(offset int64, whence int) (int64, error) { return 0, fs.ErrPermission }
+func (w *webdavWriter) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, fmt.Errorf("is not a folder")
+}
+
+// store uploads the written content under the same checks as other uploads: file type,
+// size limit and quota
+func (w *webdavWriter) store(content io.Reader) error {
+	ctx := w.ctx
+	cfg := config.GetConfig()
+	userID := w.fsys.userID
+
+	body, mimeType, err := checkStreamFileType(content, w.filename)
+	if err != nil {
+		return fileTypeError(err)
+	}
+
+	backendName, storageProvider := storage.SelectUploadBackend()
+	tracked := trackUpload(userID, w.filename, body, -1)
+	upload, err := streamUpload(ctx, storageProvider, tracked, w.filename, mimeType, cfg.Storage.MaxUploadSize)
+	if err != nil {
+		if errors.Is(err, errUploadTooLarge) {
+			return apierror.New(http.StatusRequestEntityTooLarge, "File too large")
+		}
+		return err
+	}
+	defer upload.Close()
+	fileID, size := upload.FileID, upload.Size
+
+	var replacedSize int64
+	if w.existing != nil {
+		replacedSize = w.existing.Size
+	}
+	if err := checkQuota(userID, size-replacedSize); err != nil {
+		discardObject(ctx, storageProvider, fileID)
+		return quotaError(err)
+	}
+
+	mediaMetadata := &utils.MediaMetadata{
+		FileType:   utils.GetFileType(w.filename),
+		MimeType:   mimeType,
+		Size:       size,
+		UploadedAt: time.Now().Format(time.RFC3339),
+		Format:     strings.TrimPrefix(filepath.Ext(w.filename), "."),
+		SHA256:     upload.SHA256,
+	}
+	if analysis, err := upload.Analyze(); err == nil {
+		analysis.Apply(mediaMetadata)
+	} else {
+		log.Printf("Failed to analyze %s: %v", w.filename, err)
+	}
+	metadataJSON, err := json.Marshal(map[string]interface{}{
+		"original_name": w.filename,
+		"file_id":       fileID,
+		"technical":     mediaMetadata,
+	})
+	if err != nil {
+		discardObject(ctx, storageProvider, fileID)
+		return err
+	}
+
+	// Writing over a file makes a new version of its media item
+	if existing := w.existing; existing != nil {
+		previousPath, previousBackend := existing.Path, existing.StorageBackend
+		if err := replaceMediaContent(ctx, backendName, storageProvider, existing, fileID, mimeType, size, metadataJSON); err != nil {
+			if fileID != previousPath || backendName != previousBackend {
+				discardObject(ctx, storageProvider, fileID)
+			}
+			return err
+		}
+		return nil
+	}
+
+	media := models.Media{
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		FolderID:       w.dir.folderID(),
+		Filename:       w.filename,
+		Path:           fileID,
+		MimeType:       mimeType,
+		StorageBackend: backendName,
+		Size:           size,
+		Metadata:       metadataJSON,
+	}
+	if err := database.GetDB().Create(&media).Error; err != nil {
+		discardObject(ctx, storageProvider, fileID)
+		return err
+	}
+	notifyMediaCreated(&media)
+	return nil
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/utils"
+)
+
+// widgetTokenPrefix starts every widget token, so leaked tokens are easy to recognize
+const widgetTokenPrefix = "mcw_"
+
+// newWidgetSecret returns a random widget token
+func newWidgetSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return widgetTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+}
+
+// claimWidgetUpload counts an upload against a widget token, refusing it once the token
+// was used up, revoked or expired since the request was authenticated
+func claimWidgetUpload(c *gin.Context, widget *models.WidgetToken) bool {
+	result := database.GetDB().Model(&models.WidgetToken{}).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uploads = 0 OR uploads < max_uploads)", widget.ID, time.Now()).
+		UpdateColumn("uploads", gorm.Expr("uploads + 1"))
+	if result.Error != nil {
+		c.Error(apierror.Internal("Failed to count the upload", result.Error))
+		return false
+	}
+	if result.RowsAffected == 0 {
+		c.Error(apierror.Unauthorized("Invalid or expired widget token"))
+		return false
+	}
+	widget.Uploads++
+	return true
+}
+
+// validMIMEPattern reports whether pattern is a MIME type such as image/png, or a family
+// such as image/*
+func validMIMEPattern(pattern string) bool {
+	family, subtype, ok := strings.Cut(pattern, "/")
+	return ok && family != "" && family != "*" && subtype != "" && !strings.ContainsAny(pattern, " ;,")
+}
+
+// validOrigin reports whether origin is a scheme and host such as https://shop.example.com,
+// or https://*.example.com for its subdomains
+func validOrigin(origin string) bool {
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		(u.Path == "" || u.Path == "/") && u.RawQuery == "" && u.User == nil
+}
+
+// CreateWidgetToken godoc
+// @Summary      Create a widget token
+// @Description  Creates a short-lived token an upload widget on another site can upload into your library with, instead of your JWT. Uploads land in folder_id, or the root, and are limited to max_size bytes (MAX_UPLOAD_SIZE at most), the MIME types of allowed_types (image/* matches a family), pages on allowed_origins and max_uploads files. The token is only returned once.
+// @Tags         widgets
+// @Accept       json
+// @Produce      json
+// @Param        input  body      handlers.CreateWidgetTokenRequest  true  "Limits"
+// @Success      201    {object}  handlers.WidgetTokenResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /widget-tokens [post]
+// @Security     BearerAuth
+func CreateWidgetToken(c *gin.Context) {
+	var input CreateWidgetTokenRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	cfg := config.GetConfig()
+	userID := c.GetUint("user_id")
+
+	ttl := cfg.Storage.Widget.TokenTTL
+	if input.ExpiresIn > 0 {
+		ttl = time.Duration(input.ExpiresIn) * time.Second
+	}
+	if ttl > cfg.Storage.Widget.MaxTokenTTL {
+		c.Error(apierror.InvalidField("expires_in", fmt.Sprintf("must be at most %d seconds", int64(cfg.Storage.Widget.MaxTokenTTL.Seconds()))))
+		return
+	}
+	maxSize := cfg.Storage.MaxUploadSize
+	if input.MaxSize > maxSize {
+		c.Error(apierror.InvalidField("max_size", fmt.Sprintf("must be at most MAX_UPLOAD_SIZE (%d bytes)", maxSize)))
+		return
+	}
+	if input.MaxSize > 0 {
+		maxSize = input.MaxSize
+	}
+	types := []string{}
+	for _, pattern := range input.AllowedTypes {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if !validMIMEPattern(pattern) {
+			c.Error(apierror.InvalidField("allowed_types", fmt.Sprintf("%q is not a MIME type such as image/png or image/*", pattern)))
+			return
+		}
+		types = append(types, pattern)
+	}
+	origins := []string{}
+	for _, origin := range input.AllowedOrigins {
+		origin = strings.TrimSuffix(strings.TrimSpace(origin), "/")
+		if !validOrigin(origin) {
+			c.Error(apierror.InvalidField("allowed_origins", fmt.Sprintf("%q is not an origin such as https://shop.example.com", origin)))
+			return
+		}
+		origins = append(origins, origin)
+	}
+
+	var fID *string
+	if input.FolderID != "" {
+		fID = &input.FolderID
+		var folder models.Folder
+		if err := database.GetDB().Where("id = ? AND user_id = ?", input.FolderID, userID).First(&folder).Error; err != nil {
+			c.Error(apierror.InvalidField("folder_id", "is not one of your folders"))
+			return
+		}
+	}
+
+	secret := newWidgetSecret()
+	widget := models.WidgetToken{
+		ID:             uuid.NewString(),
+		UserID:         userID,
+		Name:           strings.TrimSpace(input.Name),
+		TokenHash:      utils.HashToken(secret),
+		FolderID:       fID,
+		MaxSize:        maxSize,
+		AllowedTypes:   types,
+		AllowedOrigins: origins,
+		MaxUploads:     input.MaxUploads,
+		ExpiresAt:      time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	if err := database.GetDB().Create(&widget).Error; err != nil {
+		c.Error(apierror.Internal("Failed to create widget token", err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, WidgetTokenResponse{
+		WidgetToken: widget,
+		Token:       secret,
+		UploadURL:   publicBaseURL(c) + "/api/v1/widget/upload",
+	})
+}
+
+// ListWidgetTokens godoc
+// @Summary      List widget tokens
+// @Description  Your widget tokens, newest first, without the tokens themselves. Expired and revoked tokens are left out unless all=true.
+// @Tags         widgets
+// @Produce      json
+// @Param        all  query     bool  false  "Include expired, used up and revoked tokens"
+// @Success      200  {object}  handlers.WidgetTokensResponse
+// @Failure      500  {object}  object{error=string}
+// @Router       /widget-tokens [get]
+// @Security     BearerAuth
+func ListWidgetTokens(c *gin.Context) {
+	query := database.GetDB().Where("user_id = ?", c.GetUint("user_id"))
+	if c.Query("all") != "true" {
+		query = query.Where("revoked_at IS NULL AND expires_at > ? AND (max_uploads = 0 OR uploads < max_uploads)", time.Now())
+	}
+	widgets := []models.WidgetToken{}
+	if err := query.Order("created_at DESC, id DESC").Find(&widgets).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch widget tokens", err))
+		return
+	}
+	c.JSON(http.StatusOK, WidgetTokensResponse{WidgetTokens: widgets})
+}
+
+// RevokeWidgetToken godoc
+// @Summary      Revoke a widget token
+// @Description  The token stops accepting uploads right away. Files already uploaded with it stay.
+// @Tags         widgets
+// @Produce      json
+// @Param        id   path      string  true  "Widget token ID"
+// @Success      200  {object}  handlers.MessageResponse
+// @Failure      404  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /widget-tokens/{id} [delete]
+// @Security     BearerAuth
+func RevokeWidgetToken(c *gin.Context) {
+	db := database.GetDB()
+	var widget models.WidgetToken
+	if err := db.Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).First(&widget).Error; err != nil {
+		c.Error(apierror.NotFound("Widget token not found"))
+		return
+	}
+	if widget.RevokedAt == nil {
+		if err := db.Model(&widget).Update("revoked_at", time.Now()).Error; err != nil {
+			c.Error(apierror.Internal("Failed to revoke widget token", err))
+			return
+		}
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "Widget token revoked successfully"})
+}
+
+// WidgetUpload godoc
+// @Summary      Upload a file through a widget token
+// @Description  Upload endpoint for widgets embedded in other sites, open to cross-origin requests. Authenticate with a widget token as a bearer token, or as the token query parameter for plain form posts. The file lands in the token's folder, within its size and file type limits; duplicate filenames are always renamed. Every upload that passes the checks counts against max_uploads.
+// @Tags         widgets
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file       formData  file      true   "Media file"
+// @Param        tags       formData  []string  false  "Tags"
+// @Param        token      query     string    false  "Widget token, when no Authorization header is sent"
+// @Success      200        {object}  handlers.MediaResponse
+// @Failure      400        {object}  object{error=string}
+// @Failure      401        {object}  object{error=string}
+// @Failure      403        {object}  object{error=string}
+// @Failure      413        {object}  object{error=string}
+// @Failure      415        {object}  object{error=string}
+// @Failure      500        {object}  object{error=string}
+// @Router       /widget/upload [post]
+func WidgetUpload(c *gin.Context) {
+	uploadMedia(c, c.MustGet("widget_token").(*models.WidgetToken))
+}
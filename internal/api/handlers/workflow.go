@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+// errWorkflowChanged is returned when the status of media changed during a transition
+var errWorkflowChanged = errors.New("workflow status changed")
+
+// isWorkflowStatus reports whether status is a workflow status
+func isWorkflowStatus(status string) bool {
+	_, ok := models.WorkflowTransitions[status]
+	return ok
+}
+
+// publishedOnly narrows a query of media shown on public channels to approved media when
+// WORKFLOW_PUBLISH_APPROVED_ONLY is set
+func publishedOnly(query *gorm.DB) *gorm.DB {
+	if config.GetConfig().Workflow.PublishApprovedOnly {
+		return query.Where("workflow_status = ?", models.WorkflowApproved)
+	}
+	return query
+}
+
+// loadManagedMedia loads the media item a workflow or retention request is about: any
+// media for admins, the user's own otherwise. It reports whether the user is an admin.
+func loadManagedMedia(c *gin.Context) (*models.Media, bool, bool) {
+	userID, _ := c.Get("user_id")
+	db := database.GetDB()
+
+	var user models.User
+	if err := db.Select("id", "role").First(&user, userID).Error; err != nil {
+		c.Error(apierror.Unauthorized("User not found"))
+		return nil, false, false
+	}
+	admin := user.Role == models.RoleAdmin
+
+	query := db.Preload("Tags").Where("id = ?", c.Param("id"))
+	if !admin {
+		query = query.Where("user_id = ?", user.ID)
+	}
+	var media models.Media
+	if err := query.First(&media).Error; err != nil {
+		c.Error(apierror.NotFound("Media not found"))
+		return nil, false, false
+	}
+	return &media, admin, true
+}
+
+// mediaWorkflow returns the status of media with its transitions, newest first
+func mediaWorkflow(media *models.Media) (MediaWorkflowResponse, error) {
+	response := MediaWorkflowResponse{
+		MediaID:     media.ID,
+		Status:      media.WorkflowStatus,
+		Allowed:     models.WorkflowTransitions[media.WorkflowStatus],
+		Transitions: []models.WorkflowTransition{},
+	}
+	err := database.GetDB().Where("media_id = ?", media.ID).
+		Order("created_at DESC, id DESC").
+		Find(&response.Transitions).Error
+	return response, err
+}
+
+// GetMediaWorkflow godoc
+// @Summary      Workflow status of a media item
+// @Description  The review status of a media item, the statuses it may move to and its past transitions, newest first. Admins can read the workflow of any media.
+// @Tags         media
+// @Produce      json
+// @Param        id   path      string  true  "Media ID"
+// @Success      200  {object}  handlers.MediaWorkflowResponse
+// @Failure      404  {object}  object{error=string}
+// @Failure      500  {object}  object{error=string}
+// @Router       /media/{id}/workflow [get]
+// @Security     BearerAuth
+func GetMediaWorkflow(c *gin.Context) {
+	media, _, ok := loadManagedMedia(c)
+	if !ok {
+		return
+	}
+	response, err := mediaWorkflow(media)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch workflow transitions", err))
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// TransitionMediaWorkflow godoc
+// @Summary      Move a media item through the review workflow
+// @Description  Submit a draft for review (in_review), withdraw it (draft), or reopen approved and rejected media (draft, or in_review after a rejection). Approving and rejecting media in review is up to admins, who can move any media. The note is kept with the transition, e.g. why media were rejected.
+// @Tags         media
+// @Accept       json
+// @Produce      json
+// @Param        id     path      string                           true  "Media ID"
+// @Param        input  body      handlers.MediaWorkflowRequest  true  "New status"
+// @Success      200    {object}  handlers.MediaWorkflowResponse
+// @Failure      400    {object}  object{error=string}
+// @Failure      403    {object}  object{error=string}
+// @Failure      404    {object}  object{error=string}
+// @Failure      409    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /media/{id}/workflow [post]
+// @Security     BearerAuth
+func TransitionMediaWorkflow(c *gin.Context) {
+	var input MediaWorkflowRequest
+	if !bindJSON(c, &input) {
+		return
+	}
+	if !isWorkflowStatus(input.Status) {
+		c.Error(apierror.InvalidField("status", "Must be draft, in_review, approved or rejected"))
+		return
+	}
+
+	media, admin, ok := loadManagedMedia(c)
+	if !ok {
+		return
+	}
+	from := media.WorkflowStatus
+	allowed := models.WorkflowTransitions[from]
+	switch {
+	case input.Status == from:
+		c.Error(apierror.Conflict(fmt.Sprintf("Media are already %s", from)))
+		return
+	case !slices.Contains(allowed, input.Status):
+		c.Error(apierror.Conflict(fmt.Sprintf("Media can't move from %s to %s", from, input.Status)).
+			WithDetails("Allowed: " + strings.Join(allowed, ", ")))
+		return
+	case (input.Status == models.WorkflowApproved || input.Status == models.WorkflowRejected) && !admin:
+		c.Error(apierror.Forbidden("Only admins can approve or reject media"))
+		return
+	}
+
+	transition := models.WorkflowTransition{
+		MediaID:    media.ID,
+		UserID:     c.GetUint("user_id"),
+		FromStatus: from,
+		ToStatus:   input.Status,
+		Note:       strings.TrimSpace(input.Note),
+	}
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		// Two reviewers acting at once must not both move the media from the same status
+		result := tx.Model(&models.Media{}).
+			Where("id = ? AND workflow_status = ?", media.ID, from).
+			Update("workflow_status", input.Status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errWorkflowChanged
+		}
+		return tx.Create(&transition).Error
+	})
+	if errors.Is(err, errWorkflowChanged) {
+		c.Error(apierror.Conflict("The workflow status changed in the meantime, reload it and try again"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Failed to update workflow status", err))
+		return
+	}
+
+	media.WorkflowStatus = input.Status
+	notifyMediaUpdated(media)
+
+	response, err := mediaWorkflow(media)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to fetch workflow transitions", err))
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListReviewQueue godoc
+// @Summary      Media awaiting review
+// @Description  Media of every user in review, submitted longest ago first, for admins to approve or reject with POST /media/{id}/workflow
+// @Tags         admin
+// @Produce      json
+// @Param        page   query     int  false  "Page number (default 1)"
+// @Param        limit  query     int  false  "Items per page (default 10, at most 100)"
+// @Success      200    {object}  handlers.MediaListResponse
+// @Failure      403    {object}  object{error=string}
+// @Failure      500    {object}  object{error=string}
+// @Router       /admin/reviews [get]
+// @Security     BearerAuth
+func ListReviewQueue(c *gin.Context) {
+	page, limit := pageParams(c)
+
+	query := database.GetDB().Model(&models.Media{}).Where("workflow_status = ?", models.WorkflowInReview)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.Error(apierror.Internal("Failed to count media in review", err))
+		return
+	}
+
+	// Media are ordered by when they were last submitted
+	var media []models.Media
+	if err := query.Preload("Tags").
+		Order("(SELECT MAX(created_at) FROM workflow_transitions WHERE workflow_transitions.media_id = media.id AND to_status = 'in_review') ASC NULLS FIRST, media.id").
+		Offset((page - 1) * limit).Limit(limit).
+		Find(&media).Error; err != nil {
+		c.Error(apierror.Internal("Failed to fetch media in review", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, MediaListResponse{
+		Media: newMediaItems(media),
+		Pagination: Pagination{
+			CurrentPage: page,
+			TotalPages:  (total + int64(limit) - 1) / int64(limit),
+			TotalItems:  total,
+			PerPage:     limit,
+		},
+	})
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/api/middleware"
+	notify "go-media-center-example/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// wsAuthTimeout is how long a connection opened without a token has to send its auth message
+const wsAuthTimeout = 10 * time.Second
+
+// errWSAuthRequired closes connections whose first message isn't an auth message
+var errWSAuthRequired = errors.New("authentication required")
+
+// WSAuthMessage is the first message of a connection opened without a token
+type WSAuthMessage struct {
+	Type  string `json:"type" example:"auth"`
+	Token string `json:"token"`
+}
+
+// ConnectWebSocket godoc
+// @Summary      Open the notification websocket
+// @Description  Upgrade to a websocket that receives the user's notifications, such as upload progress. Authenticate with
+// @Description  an Authorization header or access_token query parameter, or send {"type":"auth","token":"..."} as the first
+// @Description  message within 10 seconds. The server answers with a connected notification and pings every 30 seconds;
+// @Description  connections that don't answer pings within a minute are closed.
+// @Tags         notifications
+// @Param        access_token  query  string  false  "JWT, when an Authorization header can't be sent"
+// @Success      101  {object}  websocket.Notification
+// @Failure      401  {object}  object{error=string}
+// @Router       /ws [get]
+func ConnectWebSocket(c *gin.Context) {
+	token := c.Query("access_token")
+	if header := c.GetHeader("Authorization"); header != "" {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+
+	// A token sent with the request is checked before upgrading so the client gets a plain 401
+	var userID uint
+	if token != "" {
+		id, err := middleware.ParseToken(token)
+		if err != nil {
+			c.Error(apierror.Unauthorized("Invalid or expired token"))
+			return
+		}
+		userID = id
+	}
+
+	conn, err := batchUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return // The upgrader already answered with an error status
+	}
+
+	if token == "" {
+		if userID, err = readWSAuth(conn); err != nil {
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()),
+				time.Now().Add(batchWriteTimeout))
+			conn.Close()
+			return
+		}
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(batchWriteTimeout))
+	if err := conn.WriteJSON(notify.Notification{Type: notify.Connected, UserID: userID}); err != nil {
+		conn.Close()
+		return
+	}
+
+	notify.GetManager().Serve(&notify.Client{UserID: userID, Conn: conn})
+}
+
+// readWSAuth waits for the auth message of a connection opened without a token
+func readWSAuth(conn *websocket.Conn) (uint, error) {
+	conn.SetReadDeadline(time.Now().Add(wsAuthTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var msg WSAuthMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != "auth" {
+		return 0, errWSAuthRequired
+	}
+	return middleware.ParseToken(msg.Token)
+}
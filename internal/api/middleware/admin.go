@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin only lets requests from users with the admin role through. It must run after JWTAuth.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.Error(apierror.Unauthorized("User not authenticated"))
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		if err := database.GetDB().Select("id", "role").First(&user, userID).Error; err != nil || user.Role != models.RoleAdmin {
+			c.Error(apierror.Forbidden("Admin access required"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
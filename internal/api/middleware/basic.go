@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// credentialTTL is how long verified Basic credentials are remembered. Clients such as file
+// managers send them with every request, and a bcrypt check per request would be slow.
+const credentialTTL = 5 * time.Minute
+
+// errInvalidCredentials is returned for unknown usernames and wrong passwords alike
+var errInvalidCredentials = errors.New("invalid credentials")
+
+// verifiedCredentials maps a hash of recently verified credentials to their user
+var verifiedCredentials = struct {
+	sync.Mutex
+	users map[string]verifiedUser
+}{users: make(map[string]verifiedUser)}
+
+type verifiedUser struct {
+	id      uint
+	expires time.Time
+}
+
+// dummyPasswordHash is compared against for unknown usernames, so they take as long to
+// refuse as wrong passwords and response times don't tell which usernames exist
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// RateLimitBasicLogins limits Basic logins per client IP like RateLimitByIP, ahead of
+// BasicOrJWTAuth. Only credentials that still have to be checked count, so file managers
+// sending remembered credentials with every request aren't held to the login limit.
+func RateLimitBasicLogins(bucket string, rule LimitRule) gin.HandlerFunc {
+	limit := RateLimitByIP(bucket, rule)
+	return func(c *gin.Context) {
+		if username, password, ok := c.Request.BasicAuth(); ok {
+			if _, remembered := rememberedUser(username, password); !remembered {
+				limit(c)
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// BasicOrJWTAuth is JWTAuth that also accepts HTTP Basic credentials, for clients such as
+// WebDAV file managers that only log in with a username and password. Failed requests are
+// challenged for Basic credentials, so those clients prompt for them.
+func BasicOrJWTAuth(realm string) gin.HandlerFunc {
+	challenge := `Basic realm="` + realm + `", charset="UTF-8"`
+	return func(c *gin.Context) {
+		var userID uint
+		var err error
+		if username, password, ok := c.Request.BasicAuth(); ok {
+			userID, err = checkCredentials(username, password)
+		} else if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			userID, err = ParseToken(token)
+		} else {
+			err = errors.New("authorization header is required")
+		}
+		if err != nil {
+			c.Header("WWW-Authenticate", challenge)
+			c.Error(apierror.Unauthorized("Invalid credentials"))
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", userID)
+		c.Next()
+	}
+}
+
+// checkCredentials returns the user a username and password belong to. A changed
+// password is picked up once the remembered credentials expire.
+func checkCredentials(username, password string) (uint, error) {
+	if id, ok := rememberedUser(username, password); ok {
+		return id, nil
+	}
+
+	var user models.User
+	if err := database.GetDB().Select("id", "password").Where("username = ?", username).First(&user).Error; err != nil {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return 0, errInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return 0, errInvalidCredentials
+	}
+
+	key := credentialKey(username, password)
+	now := time.Now()
+	verifiedCredentials.Lock()
+	for k, entry := range verifiedCredentials.users {
+		if now.After(entry.expires) {
+			delete(verifiedCredentials.users, k)
+		}
+	}
+	verifiedCredentials.users[key] = verifiedUser{id: user.ID, expires: now.Add(credentialTTL)}
+	verifiedCredentials.Unlock()
+	return user.ID, nil
+}
+
+// credentialKey identifies a username and password among the remembered credentials
+func credentialKey(username, password string) string {
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// rememberedUser returns the user of credentials verified within credentialTTL
+func rememberedUser(username, password string) (uint, bool) {
+	verifiedCredentials.Lock()
+	cached, ok := verifiedCredentials.users[credentialKey(username, password)]
+	verifiedCredentials.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.id, true
+	}
+	return 0, false
+}
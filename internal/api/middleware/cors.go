@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS lets the browser origins of CORS_ALLOWED_ORIGINS call the API. Preflight requests
+// are answered here, before routing, and preflights from other origins are refused with
+// 403. Other requests from unlisted origins are served without CORS headers, so the
+// browser hides the response. The origins are read on every request, as they can be
+// reloaded; the other settings are read once. Paths starting with one of openPrefixes, for
+// widgets embedded in any site that authenticate with their own tokens, are open to every
+// origin, without credentials.
+func CORS(openPrefixes ...string) gin.HandlerFunc {
+	cfg := config.GetConfig().CORS
+	anyHeader := slices.Contains(cfg.AllowedHeaders, "*")
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origins := config.GetConfig().CORS.AllowedOrigins
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if origin != "" && openPath(c.Request.URL.Path, openPrefixes) {
+			c.Header("Access-Control-Allow-Origin", "*")
+			if !preflight {
+				c.Next()
+				return
+			}
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", c.GetHeader("Access-Control-Request-Headers"))
+			if cfg.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if origin == "" || len(origins) == 0 {
+			c.Next()
+			return
+		}
+		anyOrigin := slices.Contains(origins, "*")
+
+		// The answer depends on the origin, so caches must keep one per origin
+		if !slices.Contains(c.Writer.Header().Values("Vary"), "Origin") {
+			c.Writer.Header().Add("Vary", "Origin")
+		}
+
+		if !anyOrigin && !originAllowed(origin, origins) {
+			if preflight {
+				c.Error(apierror.Forbidden("Origin not allowed"))
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		// Credentials can't be combined with a wildcard, so the origin is echoed instead
+		if anyOrigin && !cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if exposed != "" {
+				c.Header("Access-Control-Expose-Headers", exposed)
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Methods", methods)
+		if anyHeader {
+			c.Header("Access-Control-Allow-Headers", c.GetHeader("Access-Control-Request-Headers"))
+		} else if headers != "" {
+			c.Header("Access-Control-Allow-Headers", headers)
+		}
+		if cfg.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// originAllowed reports whether origin matches one of allowed. An entry such as
+// https://*.example.com matches any subdomain of example.com over https, but not
+// example.com itself.
+func originAllowed(origin string, allowed []string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+		if pattern == origin {
+			return true
+		}
+		if scheme, domain, ok := strings.Cut(pattern, "://*."); ok {
+			host, found := strings.CutPrefix(origin, scheme+"://")
+			if found && strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// openPath reports whether path starts with one of prefixes
+func openPath(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// HeaderRequestID carries the correlation ID of a request, from a proxy or generated here
+const HeaderRequestID = "X-Request-ID"
+
+// validRequestID limits IDs taken from clients to what is safe to log and echo
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// ErrorHandler assigns each request a correlation ID and answers the errors handlers and
+// middleware report with c.Error. The last error wins. Its code and message are sent in
+// the shape of the API version serving the request, and its internal cause is logged with
+// the correlation ID. Binding errors, reported with gin.ErrorTypeBind, are answered with
+// one entry per invalid field; any other error that isn't an *apierror.Error is answered
+// as an internal error. Internal errors caused by a storage backend whose circuit breaker
+// is open are answered with 503 and Retry-After. It must be the first middleware.
+func ErrorHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// A request rerouted by NegotiateVersion passes through twice and keeps its first ID
+		requestID := c.Writer.Header().Get(HeaderRequestID)
+		if requestID == "" {
+			requestID = c.GetHeader(HeaderRequestID)
+		}
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Set("request_id", requestID)
+		c.Header(HeaderRequestID, requestID)
+
+		c.Next()
+
+		if len(c.Errors) == 0 {
+			return
+		}
+		err := c.Errors.Last().Err
+
+		var apiErr *apierror.Error
+		switch {
+		case errors.As(err, &apiErr):
+		case c.Errors.Last().IsType(gin.ErrorTypeBind):
+			apiErr = apierror.Validation(err)
+		default:
+			apiErr = apierror.Internal("Internal server error", err)
+		}
+		if apiErr.Status == http.StatusInternalServerError && errors.Is(err, storage.ErrCircuitOpen) {
+			apiErr = apierror.Wrap(http.StatusServiceUnavailable, "Storage is temporarily unavailable", err)
+			retryAfter := int(config.GetConfig().Storage.Breaker.Cooldown.Seconds())
+			c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		}
+		if apiErr.Err != nil || apiErr.Status >= 500 {
+			log.Printf("[%s] %s %s: %v", requestID, c.Request.Method, c.Request.URL.Path, apiErr)
+		}
+
+		// The handler may have failed after it started answering
+		if c.Writer.Written() {
+			return
+		}
+
+		if c.GetString("api_version") == "v2" {
+			c.JSON(apiErr.Status, apierror.EnvelopeResponse{Error: apierror.EnvelopeError{
+				Code:      apiErr.Code,
+				Message:   apiErr.Message,
+				Details:   apiErr.Details,
+				Fields:    apiErr.Fields,
+				RequestID: requestID,
+			}})
+			return
+		}
+		c.JSON(apiErr.Status, apierror.Response{
+			Error:     apiErr.Message,
+			Code:      apiErr.Code,
+			Details:   apiErr.Details,
+			Fields:    apiErr.Fields,
+			RequestID: requestID,
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"regexp"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HeaderIdempotencyKey names the key a client sends with a request it may retry
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// HeaderIdempotencyReplayed marks a response stored for an earlier request with the same key
+const HeaderIdempotencyReplayed = "Idempotency-Replayed"
+
+// validIdempotencyKey limits keys to printable ASCII, such as UUIDs
+var validIdempotencyKey = regexp.MustCompile(`^[\x21-\x7e]{1,255}$`)
+
+// Idempotent lets clients retry a request after a network failure without carrying it out
+// twice. The first request sent with an Idempotency-Key header runs as usual, and its
+// response is stored with a fingerprint of the request. A retry with the same key and the
+// same request gets the stored response, marked with Idempotency-Replayed, while a key
+// reused for another request is refused with 422 and a retry arriving while the first
+// request still runs with 409. Requests that fail with an error or a 5xx status release
+// their key, so they can be retried for real. Keys belong to a user and are kept for
+// IDEMPOTENCY_KEY_TTL. It must run after JWTAuth.
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(HeaderIdempotencyKey)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey.MatchString(key) {
+			c.Error(apierror.BadRequest("Invalid Idempotency-Key header").
+				WithDetails("Keys are 1 to 255 printable ASCII characters, such as a UUID"))
+			c.Abort()
+			return
+		}
+
+		fingerprint, spool, err := fingerprintRequest(c.Request)
+		if spool != nil {
+			defer func() {
+				spool.Close()
+				os.Remove(spool.Name())
+			}()
+		}
+		if err != nil {
+			c.Error(apierror.BadRequest("Failed to read request body"))
+			c.Abort()
+			return
+		}
+
+		record := models.IdempotencyKey{
+			UserID:      c.GetUint("user_id"),
+			Key:         key,
+			Fingerprint: fingerprint,
+			ExpiresAt:   time.Now().Add(config.GetConfig().API.IdempotencyKeyTTL),
+		}
+		existing, err := claimIdempotencyKey(&record)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// The first request released the key between our attempt to claim it and the lookup
+			c.Header("Retry-After", "1")
+			c.Error(apierror.Conflict("A request with this Idempotency-Key is still in progress"))
+			c.Abort()
+			return
+		case err != nil:
+			c.Error(apierror.Internal("Failed to record the idempotency key", err))
+			c.Abort()
+			return
+		case existing != nil:
+			replayIdempotentResponse(c, existing, fingerprint)
+			c.Abort()
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		db := database.GetDB().Where("user_id = ? AND key = ?", record.UserID, record.Key)
+		status := w.Status()
+		if (len(c.Errors) > 0 && !w.Written()) || status >= http.StatusInternalServerError {
+			if err := db.Delete(&models.IdempotencyKey{}).Error; err != nil {
+				log.Printf("Failed to release idempotency key %q: %v", key, err)
+			}
+			return
+		}
+		if err := db.Model(&models.IdempotencyKey{}).Updates(map[string]interface{}{
+			"status":       status,
+			"content_type": w.Header().Get("Content-Type"),
+			"body":         w.body.Bytes(),
+		}).Error; err != nil {
+			log.Printf("Failed to store the response for idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+// claimIdempotencyKey records record as in progress. It returns nil when the key is new, or
+// expired, and otherwise the request that holds it.
+func claimIdempotencyKey(record *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	db := database.GetDB()
+	if err := db.Where("user_id = ? AND key = ? AND expires_at < ?", record.UserID, record.Key, time.Now()).
+		Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, err
+	}
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return nil, nil
+	}
+
+	var existing models.IdempotencyKey
+	if err := db.Where("user_id = ? AND key = ?", record.UserID, record.Key).First(&existing).Error; err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// replayIdempotentResponse answers a retry of the request that holds its key
+func replayIdempotentResponse(c *gin.Context, existing *models.IdempotencyKey, fingerprint string) {
+	switch {
+	case existing.Fingerprint != fingerprint:
+		c.Error(apierror.New(http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request").
+			WithCode(apierror.CodeIdempotencyKeyReused))
+	case existing.Status == 0:
+		c.Header("Retry-After", "1")
+		c.Error(apierror.Conflict("A request with this Idempotency-Key is still in progress"))
+	default:
+		c.Header(HeaderIdempotencyReplayed, "true")
+		c.Data(existing.Status, existing.ContentType, existing.Body)
+	}
+}
+
+// fingerprintRequest hashes the method, path, query and body of req. The body is spooled to
+// a temporary file, which replaces it for the handler and which the caller removes. The
+// parts of a multipart form are hashed rather than its bytes, as clients pick a new
+// boundary every time they send one.
+func fingerprintRequest(req *http.Request) (string, *os.File, error) {
+	spool, err := os.CreateTemp("", "idempotent-*")
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = io.Copy(spool, req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", spool, err
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	request := fmt.Sprintf("%s %s?%s\n%s\n", req.Method, req.URL.Path, req.URL.Query().Encode(), mediaType)
+	h := sha256.New()
+	io.WriteString(h, request)
+	if mediaType != "multipart/form-data" || params["boundary"] == "" || hashMultipart(h, spool, params["boundary"]) != nil {
+		// Other bodies, and malformed forms the handler is left to refuse, are hashed as they are
+		h.Reset()
+		io.WriteString(h, request)
+		if _, err := spool.Seek(0, io.SeekStart); err != nil {
+			return "", spool, err
+		}
+		if _, err := io.Copy(h, spool); err != nil {
+			return "", spool, err
+		}
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return "", spool, err
+	}
+	req.Body = spool
+	return hex.EncodeToString(h.Sum(nil)), spool, nil
+}
+
+// hashMultipart adds the field names, filenames, types and contents of a multipart body to h
+func hashMultipart(h hash.Hash, body io.ReadSeeker, boundary string) error {
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := multipart.NewReader(body, boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%q %q %q\n", part.FormName(), part.FileName(), part.Header.Get("Content-Type"))
+		n, err := io.Copy(h, part)
+		part.Close()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "\n%d\n", n)
+	}
+}
+
+// recordingWriter keeps a copy of the response body to replay it to retries
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements http.ResponseWriter
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements gin.ResponseWriter, which would otherwise bypass Write
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// RemoveExpiredIdempotencyKeys deletes the keys past their expiry, with their responses
+func RemoveExpiredIdempotencyKeys() error {
+	return database.GetDB().Where("expires_at < ?", time.Now()).Delete(&models.IdempotencyKey{}).Error
+}
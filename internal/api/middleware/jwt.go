@@ -1,47 +1,58 @@
 package middleware
 
 import (
-	"net/http"
 	"strings"
 
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/utils"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
+// ParseToken validates a JWT and returns the user it was issued to
+func ParseToken(tokenString string) (uint, error) {
+	return utils.VerifyToken(tokenString, config.GetConfig())
+}
+
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			c.Error(apierror.Unauthorized("Authorization header is required"))
 			c.Abort()
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+			c.Error(apierror.Unauthorized("Invalid authorization header format"))
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
-		claims := jwt.MapClaims{}
-
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte("your-secret-key"), nil // TODO: Move to environment variable
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		userID, err := ParseToken(parts[1])
+		if err != nil {
+			c.Error(apierror.Unauthorized("Invalid or expired token"))
 			c.Abort()
 			return
 		}
 
 		// Set user ID from claims to context
-		if userID, ok := claims["user_id"].(float64); ok {
-			c.Set("user_id", uint(userID))
-		}
+		c.Set("user_id", userID)
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// QueryTokenAuth is JWTAuth that also accepts the token as an access_token query
+// parameter, for clients such as browser websockets that can't set headers
+func QueryTokenAuth() gin.HandlerFunc {
+	jwtAuth := JWTAuth()
+	return func(c *gin.Context) {
+		if token := c.Query("access_token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+		jwtAuth(c)
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"go-media-center-example/internal/api/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SignedOrJWTAuth lets requests carrying a signed "token" query parameter through after
+// checking it with verify, without a user lookup, and falls back to JWTAuth otherwise.
+// Handlers can tell the two apart through the "signed_access" context value.
+func SignedOrJWTAuth(verify func(c *gin.Context) bool) gin.HandlerFunc {
+	jwtAuth := JWTAuth()
+	return func(c *gin.Context) {
+		if c.Query("token") == "" {
+			jwtAuth(c)
+			return
+		}
+
+		if !verify(c) {
+			c.Error(apierror.Forbidden("Invalid or expired signature"))
+			c.Abort()
+			return
+		}
+
+		c.Set("signed_access", true)
+		c.Next()
+	}
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-media-center-example/internal/api/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderAPIVersion names the version of a request and of the response serving it
+const HeaderAPIVersion = "API-Version"
+
+var (
+	// versionedPath matches paths that already name a version, such as /api/v1/media
+	versionedPath = regexp.MustCompile(`^/api/v[0-9]+(/|$)`)
+	// versionMediaType matches Accept values such as application/vnd.media-center.v2+json
+	versionMediaType = regexp.MustCompile(`application/vnd\.media-center\.(v[0-9]+)\+json`)
+)
+
+// APIVersion tags requests and responses with the version serving them
+func APIVersion(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("api_version", version)
+		c.Header(HeaderAPIVersion, version)
+		c.Next()
+	}
+}
+
+// Deprecation describes a deprecated API version or endpoint
+type Deprecation struct {
+	Since     time.Time // When it was deprecated; zero for now
+	Sunset    time.Time // When it stops being served; zero while that isn't scheduled
+	Successor string    // Path or URL of its replacement
+}
+
+// Deprecated announces a deprecation on every response, with the Deprecation (RFC 9745),
+// Sunset (RFC 8594) and Link successor-version headers
+func Deprecated(d Deprecation) gin.HandlerFunc {
+	since := d.Since
+	if since.IsZero() {
+		since = time.Now()
+	}
+	deprecation := "@" + strconv.FormatInt(since.Unix(), 10)
+
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		if !d.Sunset.IsZero() {
+			c.Header("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if d.Successor != "" {
+			c.Header("Link", "<"+d.Successor+`>; rel="successor-version"`)
+		}
+		c.Next()
+	}
+}
+
+// NegotiateVersion serves unversioned /api/... paths with the version named by the
+// API-Version header or an Accept type like application/vnd.media-center.v2+json, or the
+// default version when the client names none. It is meant as the router's NoRoute handler
+// and leaves every other unmatched path to gin's 404.
+func NegotiateVersion(router *gin.Engine, versions []string, defaultVersion string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !strings.HasPrefix(path, "/api/") || versionedPath.MatchString(path) {
+			return
+		}
+
+		version := c.GetHeader(HeaderAPIVersion)
+		if version == "" {
+			if match := versionMediaType.FindStringSubmatch(c.GetHeader("Accept")); match != nil {
+				version = match[1]
+			}
+		}
+		if version == "" {
+			version = defaultVersion
+		}
+		if !strings.HasPrefix(version, "v") {
+			version = "v" + version
+		}
+		if !slices.Contains(versions, version) {
+			c.Error(apierror.BadRequest("Unsupported API version: " + version).WithCode(apierror.CodeUnsupportedVersion))
+			return
+		}
+
+		c.Request.URL.Path = "/api/" + version + strings.TrimPrefix(path, "/api")
+		c.Request.URL.RawPath = ""
+		router.HandleContext(c)
+		// HandleContext restores this chain's position over the new route's handlers, which
+		// would otherwise run again
+		c.Abort()
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"strings"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WidgetTokenAuth authenticates upload widgets with a widget token, sent as a bearer token
+// or, for pages posting a plain form, as the token query parameter. The token must still
+// accept uploads, and a page must be on one of its origins when it names any. The token is
+// set in the context as "widget_token" and its owner as "user_id".
+func WidgetTokenAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+		if token == "" {
+			c.Error(apierror.Unauthorized("Widget token is required"))
+			c.Abort()
+			return
+		}
+
+		var widget models.WidgetToken
+		if err := database.GetDB().Where("token_hash = ?", utils.HashToken(token)).First(&widget).Error; err != nil || !widget.Usable() {
+			c.Error(apierror.Unauthorized("Invalid or expired widget token"))
+			c.Abort()
+			return
+		}
+		if origin := c.GetHeader("Origin"); origin != "" && len(widget.AllowedOrigins) > 0 && !originAllowed(origin, widget.AllowedOrigins) {
+			c.Error(apierror.Forbidden("This widget token can't be used from " + origin))
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", widget.UserID)
+		c.Set("widget_token", &widget)
+		c.Next()
+	}
+}
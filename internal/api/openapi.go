@@ -0,0 +1,956 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+
+	"go-media-center-example/internal/api/apierror"
+	"go-media-center-example/internal/api/handlers"
+	"go-media-center-example/internal/api/openapi"
+	"go-media-center-example/internal/models"
+	"go-media-center-example/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiInfo is the title block of the generated OpenAPI document
+var apiInfo = openapi.Info{
+	Title:       "Media Center API",
+	Description: "A media management system with support for images, videos, and documents. Requests are rate limited; every limited response carries X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers, and exceeding a limit returns 429 with Retry-After. Paths name their version (/api/v1, /api/v2); unversioned /api paths are served by the version in the API-Version header or an application/vnd.media-center.vN+json Accept type. Deprecated endpoints answer with Deprecation, Sunset and Link headers. Errors carry a machine-readable code and the request's correlation ID; validation_failed errors list each invalid field. The correlation ID is also returned in the X-Request-ID header and may be supplied by the client. Upload and batch requests may carry an Idempotency-Key header: a retry with the same key and request is answered with the first response and Idempotency-Replayed: true, a key reused for another request with 422 idempotency_key_reused and a retry while the first request runs with 409.",
+	Version:     "1.0",
+}
+
+// pageParams are the pagination query parameters of list endpoints
+var pageParams = []openapi.Param{
+	{Name: "page", Type: "integer", Description: "Page number (default 1)"},
+	{Name: "limit", Type: "integer", Description: "Items per page (default 10)"},
+}
+
+// subfolderParams ask folder endpoints to also count the media of subfolders
+var subfolderParams = []openapi.Param{
+	{Name: "include_subfolders", Type: "boolean", Description: "Also report total_media_count, counting the media of subfolders"},
+}
+
+// mediaFilterParams are the filters media listings and exports share
+var mediaFilterParams = []openapi.Param{
+	{Name: "type", Description: "MIME type prefix filter"},
+	{Name: "search", Description: "Search of filenames and text and select metadata fields"},
+	{Name: "folder_id", Description: "Folder ID"},
+	{Name: "tags", Type: "array", Description: "Tags filter"},
+	{Name: "class", Type: "array", Description: "Content class filter (photo, screenshot, scan, graphic)"},
+	{Name: "color", Type: "array", Description: "Dominant color filter (red, orange, yellow, green, cyan, blue, purple, pink, brown, black, white, gray)"},
+	{Name: "from", Description: "Created at or after (RFC 3339 time or YYYY-MM-DD)"},
+	{Name: "to", Description: "Created before (RFC 3339 time, or YYYY-MM-DD including that day)"},
+	{Name: "workflow_status", Type: "array", Description: "Workflow status filter (draft, in_review, approved, rejected)"},
+	{Name: "license_type", Type: "array", Description: "License type filter (e.g. royalty_free, rights_managed, cc_by)"},
+	{Name: "rights_holder", Description: "Rights holder search"},
+	{Name: "license_status", Description: "License status filter (none, active, expired)"},
+	{Name: "meta[key]", Description: "Custom metadata filter: text fields containing the value, select fields set to it, number and date fields equal to it or within a from..to range"},
+}
+
+// fieldsParam selects the media fields a response carries
+var fieldsParam = openapi.Param{
+	Name: "fields", Description: "Comma-separated fields to return instead of full items, e.g. id,filename,thumbnail_url. " +
+		"Any of id, user_id, folder_id, filename, mime_type, size, metadata, tags, broken, workflow_status, license, created_at, updated_at, url, thumbnail_url and blurhash.",
+}
+
+// transformParams are the query parameters accepted by transforms and file serving
+var transformParams = []openapi.Param{
+	{Name: "width", Type: "integer", Description: "Target width"},
+	{Name: "height", Type: "integer", Description: "Target height"},
+	{Name: "fit", Description: "Fit mode (contain, cover, fill)"},
+	{Name: "crop", Description: "Crop region x,y,width,height or \"smart\""},
+	{Name: "quality", Type: "integer", Description: "Output quality (1-100)"},
+	{Name: "format", Description: "Output format (jpeg, png, webp; mp4, webm for animated GIFs)"},
+	{Name: "preset", Description: "Preset name (thumbnail, social, avatar, banner)"},
+	{Name: "rotate", Type: "number", Description: "Clockwise rotation in degrees"},
+	{Name: "flip", Description: "Flip direction (h, v, hv)"},
+	{Name: "dpr", Type: "number", Description: "Device pixel ratio (1-3) multiplying width and height"},
+	{Name: "strip", Type: "boolean", Description: "Remove EXIF, ICC and XMP from the output (default TRANSFORM_STRIP_METADATA)"},
+	{Name: "colorspace", Description: "Convert images with an embedded ICC profile to a color space (srgb)"},
+	{Name: "fresh", Type: "boolean", Description: "Skip the derivative cache"},
+	{Name: "blur", Type: "number", Description: "Gaussian blur sigma (0-100)"},
+	{Name: "sharpen", Type: "number", Description: "Sharpen sigma (0-100)"},
+	{Name: "grayscale", Type: "boolean", Description: "Convert to grayscale"},
+	{Name: "brightness", Type: "number", Description: "Brightness adjustment (-100 to 100)"},
+	{Name: "contrast", Type: "number", Description: "Contrast adjustment (-100 to 100)"},
+	{Name: "saturation", Type: "number", Description: "Saturation adjustment (-100 to 100)"},
+	{Name: "watermark", Description: "Watermark media ID, or \"default\" for the configured watermark"},
+	{Name: "watermark_position", Description: "Watermark position (center, top-left, top-right, bottom-left, bottom-right)"},
+	{Name: "watermark_opacity", Type: "number", Description: "Watermark opacity (0-1)"},
+	{Name: "watermark_scale", Type: "number", Description: "Watermark width relative to the image (0-1)"},
+}
+
+// deepZoomParams sign deep zoom descriptors and tiles
+var deepZoomParams = []openapi.Param{
+	{Name: "v", Description: "Content version from a signed URL"},
+	{Name: "expires", Type: "integer", Description: "Signed URL expiry (unix seconds)"},
+	{Name: "token", Description: "Signed URL token"},
+}
+
+// imageTypes are the content types of transformed images and thumbnails
+var imageTypes = []string{"image/jpeg", "image/png", "image/webp", "image/gif"}
+
+// operations documents every route by "METHOD path". Request and response schemas come
+// from the handler DTOs; routes missing here still appear in the document, flagged as
+// undocumented.
+var operations = map[string]openapi.Operation{
+	"POST /api/v1/auth/register": {
+		Summary: "Register a user", Tag: "auth", Public: true,
+		Body: handlers.RegisterRequest{}, Response: handlers.AuthResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	"POST /api/v1/auth/login": {
+		Summary: "Log in", Tag: "auth", Public: true,
+		Body: handlers.LoginRequest{}, Response: handlers.AuthResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests},
+	},
+	"GET /api/v1/media/files/:filename": {
+		Summary: "Serve a media file", Tag: "media", Public: true,
+		Description: "Serve the original, or a transformed rendition when transform parameters are given. " +
+			"The file is named by media ID or exact storage key; a filename is accepted while it is unique to the user. " +
+			"With storage offloading enabled originals may be answered with a redirect to a presigned URL. " +
+			"Accepts either a Bearer token or the signed query of the file_url returned by GET /media/:id, which names the file by media ID. " +
+			"Signed URLs are signed over their whole query, so transform parameters can't be added to them.",
+		Query: append(append([]openapi.Param{}, transformParams...),
+			openapi.Param{Name: "expires", Type: "integer", Description: "Signed URL expiry (unix seconds)"},
+			openapi.Param{Name: "token", Description: "Signed URL token"},
+		),
+		Produces: []string{"application/octet-stream"},
+		Errors:   []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusInternalServerError, http.StatusServiceUnavailable},
+	},
+	"GET /api/v1/media/:id/thumb": {
+		Summary: "Get a media thumbnail", Tag: "media", Public: true,
+		Description: "Accepts either a Bearer token or the signed query returned by POST /media/thumbs.",
+		Query: []openapi.Param{
+			{Name: "size", Type: "integer", Description: "Edge length: 64, 128, 256 (default) or 512"},
+			{Name: "v", Description: "Content version from a signed URL"},
+			{Name: "expires", Type: "integer", Description: "Signed URL expiry (unix seconds)"},
+			{Name: "token", Description: "Signed URL token"},
+		},
+		Produces: imageTypes,
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusServiceUnavailable},
+	},
+	"GET /api/v1/media/:id/tiles.dzi": {
+		Summary: "Get the deep zoom descriptor of an image", Tag: "media", Public: true,
+		Description: "Deep Zoom (DZI) descriptor of a JPEG, PNG or GIF image for viewers like OpenSeadragon, with tiles below tiles_files/. " +
+			"Accepts either a Bearer token or the signed query of deep_zoom_url, which viewers carry over to the tiles.",
+		Query: deepZoomParams, Produces: []string{"application/xml"},
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	"GET /api/v1/media/:id/embed": {
+		Summary: "Get the embed page of a media item", Tag: "media", Public: true,
+		Description: "HTML page showing an image, video or audio player, or a link to other files, with Open Graph tags and oEmbed discovery so shared links unfurl. " +
+			"Accepts either a Bearer token or the signed query of embed_url.",
+		Query: []openapi.Param{
+			{Name: "expires", Type: "integer", Description: "Signed URL expiry (unix seconds)"},
+			{Name: "token", Description: "Signed URL token"},
+		},
+		Produces: []string{"text/html"},
+		Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	"GET /api/v1/oembed": {
+		Summary: "Describe a shared media link with oEmbed", Tag: "media", Public: true,
+		Description: "oEmbed answer for a signed embed link: a photo with its URL, a video or audio player as an iframe of the embed page, or a link for other files.",
+		Query: []openapi.Param{
+			{Name: "url", Required: true, Description: "Signed embed link"},
+			{Name: "maxwidth", Type: "integer", Description: "Largest width of the embedded media"},
+			{Name: "maxheight", Type: "integer", Description: "Largest height of the embedded media"},
+			{Name: "format", Description: "Response format, only json"},
+		},
+		Response: handlers.OEmbedResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound, http.StatusNotImplemented},
+	},
+	"GET /api/v1/media/:id/tiles_files/:level/:tile": {
+		Summary: "Get a deep zoom tile", Tag: "media", Public: true,
+		Description: "tile is the column and row with the descriptor's format, e.g. 3_2.jpg. " +
+			"The first request for a level renders and caches all of its tiles, and those of the levels below it.",
+		Query: deepZoomParams, Produces: []string{"image/jpeg", "image/png"},
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError},
+	},
+	"POST /api/v1/media/upload": {
+		Summary: "Upload a file", Tag: "media",
+		Query: []openapi.Param{{Name: "conflict", Description: "Name conflict policy (rename, skip, replace)"}},
+		Form: []openapi.Param{
+			{Name: "file", Type: "file", Required: true},
+			{Name: "folder_id", Description: "Target folder"},
+			{Name: "tags", Type: "array", Description: "Tag names"},
+			{Name: "conflict", Description: "Name conflict policy (rename, skip, replace)"},
+			{Name: "storage_class", Description: "S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING, GLACIER_IR)"},
+			{Name: "encryption", Description: "S3 server-side encryption (AES256, aws:kms)"},
+		},
+		Response: handlers.MediaResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError, http.StatusNotImplemented},
+	},
+	"POST /api/v1/media/uploads/presign": {
+		Summary: "Start a direct upload", Tag: "media",
+		Description: "Returns a presigned request that stores the file straight in storage. " +
+			"A skip conflict answers with the existing media item instead.",
+		Body: handlers.PresignUploadRequest{}, Response: handlers.PresignUploadResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusNotImplemented},
+	},
+	"POST /api/v1/media/uploads/complete": {
+		Summary: "Complete a direct upload", Tag: "media",
+		Description: "Verifies the stored object and creates its media item. Rejected objects are deleted.",
+		Body:        handlers.CompleteUploadRequest{}, Response: handlers.MediaResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	"GET /api/v1/media/uploads/:id": {
+		Summary: "Get a multipart upload session", Tag: "media",
+		Response: handlers.UploadSessionResponse{}, Errors: []int{http.StatusNotFound},
+	},
+	"DELETE /api/v1/media/uploads/:id": {
+		Summary: "Abort a multipart upload", Tag: "media",
+		Response: handlers.MessageResponse{},
+		Errors:   []int{http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /api/v1/media/uploads/:id/parts": {
+		Summary: "Presign parts of a multipart upload", Tag: "media",
+		Description: "Returns up to 100 presigned part requests. Keep the ETag storage answers each part with.",
+		Body:        handlers.UploadPartsRequest{}, Response: handlers.UploadPartsResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+	},
+	"POST /api/v1/media/uploads/:id/complete": {
+		Summary: "Complete a multipart upload", Tag: "media",
+		Description: "Joins the listed parts and creates the media item like POST /media/uploads/complete.",
+		Body:        handlers.CompleteMultipartUploadRequest{}, Response: handlers.MediaResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType},
+	},
+	"POST /api/v1/media/url": {
+		Summary: "Import a file from a URL", Tag: "media",
+		Body: handlers.URLImportRequest{}, Response: handlers.MediaResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusInternalServerError, http.StatusNotImplemented},
+	},
+	"POST /api/v1/media/url/batch": {
+		Summary: "Import files from several URLs", Tag: "batches",
+		Description: "Starts a background batch job that survives restarts.",
+		Body:        handlers.BulkURLUploadRequest{}, Response: handlers.BatchAcceptedResponse{}, Status: http.StatusAccepted,
+		Errors: []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"POST /api/v1/media/batch/transform": {
+		Summary: "Transform several media items", Tag: "batches",
+		Description: "Starts a background batch job storing a transformed copy of every image as a new media item.",
+		Body:        []handlers.BatchOperation{}, Response: handlers.BatchAcceptedResponse{}, Status: http.StatusAccepted,
+		Errors: []int{http.StatusBadRequest, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	"POST /api/v1/import": {
+		Summary: "Import a library from a manifest", Tag: "batches",
+		Description: "Starts a background batch job with an item per row of a CSV or JSON manifest. A row downloads url or, for admins, registers the unreferenced object storage_key on backend, with an optional filename, folder_id or folder path (created as needed), tags and a metadata object. CSV manifests have a header row, tags separated by semicolons and metadata as JSON; unknown columns are ignored, so exports can be imported again. Invalid rows become failed items; GET /batches/{id} reports every row.",
+		Form: []openapi.Param{
+			{Name: "manifest", Type: "file", Required: true, Description: "CSV or JSON manifest, at most 10000 rows"},
+			{Name: "format", Description: "Manifest format (csv, json); by default from the file extension"},
+		},
+		Response: handlers.BatchAcceptedResponse{}, Status: http.StatusAccepted,
+		Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusInternalServerError},
+	},
+	"GET /api/v1/drives": {
+		Summary: "List connected cloud drives", Tag: "drives",
+		Description: "Your connected Google Drive, Dropbox and OneDrive accounts, and the providers that can be connected.",
+		Response:    handlers.DrivesResponse{},
+		Errors:      []int{http.StatusInternalServerError},
+	},
+	"POST /api/v1/drives/connect/:provider": {
+		Summary: "Start connecting a cloud drive", Tag: "drives",
+		Description: "Returns the URL to send the user to, where they grant read access. The provider sends them back to redirect_uri, CLOUD_DRIVE_REDIRECT_URL by default, with a code and the state, valid for CLOUD_DRIVE_CONNECT_EXPIRATION.",
+		Body:        handlers.ConnectDriveRequest{}, Response: handlers.ConnectDriveResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotImplemented},
+	},
+	"POST /api/v1/drives/connect/:provider/complete": {
+		Summary: "Finish connecting a cloud drive", Tag: "drives",
+		Description: "Exchanges the code for a token and saves the connection; 200 when an account connected before got new tokens. The state must have been issued to the same user.",
+		Body:        handlers.CompleteDriveConnectionRequest{}, Response: handlers.DriveResponse{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusNotImplemented, http.StatusBadGateway, http.StatusInternalServerError},
+	},
+	"DELETE /api/v1/drives/:id": {
+		Summary: "Disconnect a cloud drive", Tag: "drives",
+		Description: "Forgets the tokens of the account; files of running imports not yet downloaded fail. Revoke access at the provider to withdraw the grant itself.",
+		Response:    handlers.MessageResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/drives/:id/files": {
+		Summary: "Browse a connected cloud drive", Tag: "drives",
+		Description: "A page of the files and folders in a folder, the root by default. Google Docs, Sheets and Slides are left out.",
+		Query: []openapi.Param{
+			{Name: "folder", Description: "Folder ID (a path also works for Dropbox)"},
+			{Name: "cursor", Description: "Cursor of the next page"},
+		},
+		Response: handlers.DriveFilesResponse{},
+		Errors:   []int{http.StatusNotFound, http.StatusNotImplemented, http.StatusBadGateway},
+	},
+	"POST /api/v1/drives/:id/import": {
+		Summary: "Import files from a connected cloud drive", Tag: "drives",
+		Description: "Starts a background batch job downloading the files straight from the drive. Files keep their name in the drive unless filename is given, and their metadata records the drive and file under cloud_drive.",
+		Body:        handlers.ImportDriveFilesRequest{}, Response: handlers.BatchAcceptedResponse{}, Status: http.StatusAccepted,
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotImplemented, http.StatusInternalServerError},
+	},
+	"GET /api/v1/batches": {
+		Summary: "List batch jobs", Tag: "batches",
+		Query: append([]openapi.Param{
+			{Name: "kind", Description: "Job kind (url_import, transform, manifest, cloud_drive)"},
+		}, pageParams...),
+		Response: handlers.BatchListResponse{},
+		Errors:   []int{http.StatusInternalServerError},
+	},
+	"GET /api/v1/batches/:id": {
+		Summary: "Get a batch job", Tag: "batches",
+		Response: handlers.BatchResponse{}, Errors: []int{http.StatusNotFound},
+	},
+	"GET /api/v1/batches/:id/events": {
+		Summary: "Follow a batch job over a websocket", Tag: "batches",
+		Description: "Upgrades to a websocket sending BatchEvent messages: a snapshot, a progress event per finished item and a final completed event.",
+		Query:       []openapi.Param{{Name: "access_token", Description: "JWT, when an Authorization header can't be sent"}},
+		Response:    handlers.BatchEvent{}, Status: http.StatusSwitchingProtocols,
+		Errors: []int{http.StatusUnauthorized, http.StatusNotFound},
+	},
+	"GET /api/v1/ws": {
+		Summary: "Open the notification websocket", Tag: "notifications",
+		Description: "Upgrades to a websocket receiving the user's Notification messages, starting with connected. Authenticate with the Authorization header, the access_token query parameter or a first {\"type\":\"auth\",\"token\":\"...\"} message sent within 10 seconds. The server pings every 30 seconds and drops connections silent for a minute.",
+		Query:       []openapi.Param{{Name: "access_token", Description: "JWT, when an Authorization header can't be sent"}},
+		Response:    websocket.Notification{}, Status: http.StatusSwitchingProtocols,
+		Errors: []int{http.StatusUnauthorized},
+	},
+	"GET /api/v1/media/imports": {
+		Summary: "List URL import jobs", Tag: "media", Deprecated: true,
+		Description: "Superseded by GET /api/v1/batches?kind=url_import.",
+		Query:       pageParams, Response: handlers.ImportJobListResponse{},
+		Errors: []int{http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/imports/:id": {
+		Summary: "Get a URL import job", Tag: "media", Deprecated: true,
+		Description: "Superseded by GET /api/v1/batches/:id.",
+		Response:    handlers.ImportJobResponse{}, Errors: []int{http.StatusNotFound},
+	},
+	"POST /api/v1/media/batch": {
+		Summary: "Upload several files", Tag: "media",
+		Form: []openapi.Param{
+			{Name: "files", Type: "files", Required: true, Description: "Files to upload"},
+			{Name: "folder_id", Description: "Target folder"},
+			{Name: "tags", Type: "array", Description: "Tag names applied to every file"},
+			{Name: "file_metadata", Description: "JSON object of per-file overrides keyed by filename"},
+			{Name: "storage_class", Description: "S3 storage class (STANDARD, STANDARD_IA, ONEZONE_IA, INTELLIGENT_TIERING, GLACIER_IR)"},
+			{Name: "encryption", Description: "S3 server-side encryption (AES256, aws:kms)"},
+		},
+		Response: handlers.BulkResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError, http.StatusNotImplemented},
+	},
+	"POST /api/v1/media/batch/operation": {
+		Summary: "Delete, move, copy or tag several media items", Tag: "media",
+		Body: handlers.BatchOperationRequest{}, Response: handlers.BatchOperationResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/purges/:id": {
+		Summary: "Get the progress of a storage purge", Tag: "media",
+		Response: handlers.PurgeJobResponse{}, Errors: []int{http.StatusNotFound},
+	},
+	"GET /api/v1/media/list": {
+		Summary: "List media", Tag: "media",
+		Query:    append(append(append([]openapi.Param{}, mediaFilterParams...), fieldsParam), pageParams...),
+		Response: handlers.MediaListResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"POST /api/v1/media/thumbs": {
+		Summary: "Get signed thumbnail URLs for several media items", Tag: "media",
+		Body: handlers.ThumbnailsRequest{}, Response: handlers.ThumbnailsResponse{},
+		Errors: []int{http.StatusBadRequest},
+	},
+	"PUT /api/v1/media/:id": {
+		Summary: "Update a media item", Tag: "media",
+		Description: "Once admins defined custom metadata fields, metadata.custom may only hold those fields, with values of their type, and must set the required ones.",
+		Body:        handlers.UpdateMediaRequest{}, Response: handlers.MediaItem{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /api/v1/media/:id/license": {
+		Summary: "Set the license of a media item", Tag: "media",
+		Description: "Records the license type, rights holder and last day of use (YYYY-MM-DD), replacing what was recorded. Media whose license expired can't be shared publicly. Empty values clear the license.",
+		Body:        handlers.SetMediaLicenseRequest{}, Response: handlers.MediaItem{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/:id/retention": {
+		Summary: "Legal hold and retention of a media item", Tag: "media",
+		Description: "Whether the media are under legal hold, until when they are retained, and the changes made to both, newest first. Admins can read the retention of any media.",
+		Response:    handlers.MediaRetentionResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /api/v1/media/:id/retention": {
+		Summary: "Place a legal hold or retention period on a media item", Tag: "media",
+		Description: "Media under legal hold or within their retention period can't be deleted, in batches or by lifecycle rules either, nor replaced. Releasing a hold and shortening a retention period in force is up to admins, who must give a reason. Every change is recorded in the audit log.",
+		Body:        handlers.SetMediaRetentionRequest{}, Response: handlers.MediaRetentionResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/licenses/expiring": {
+		Summary: "Media whose rights expire soon", Tag: "media",
+		Description: "Your media whose license ends within the next days, soonest first.",
+		Query: append([]openapi.Param{
+			{Name: "days", Type: "integer", Description: "Days ahead to cover (default 30, at most 3650)"},
+			{Name: "include_expired", Type: "boolean", Description: "Also list media whose license already ended"},
+		}, pageParams...),
+		Response: handlers.ExpiringLicensesResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/:id": {
+		Summary: "Get a media item", Tag: "media",
+		Query: []openapi.Param{
+			{Name: "expires", Type: "integer", Description: "download_url lifetime in seconds (default 86400)"},
+			fieldsParam,
+		},
+		Response: handlers.MediaResponse{},
+		Errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/:id/embed/download": {
+		Summary: "Download a shared media item", Tag: "media", Public: true,
+		Description: "Stream the original as an attachment, like GET /media/{id}/download, with either a Bearer token or the signed query of embed_url. " +
+			"Downloads through a signed link count in the link's analytics; embed pages of files that aren't images, video or audio link here.",
+		Query: []openapi.Param{
+			{Name: "expires", Type: "integer", Description: "Signed URL expiry (unix seconds)"},
+			{Name: "token", Description: "Signed URL token"},
+		},
+		Produces: []string{"application/octet-stream"},
+		Errors:   []int{http.StatusForbidden, http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/:id/embed/analytics": {
+		Summary: "Analytics of a media item's embed links", Tag: "media",
+		Description: "Views of the embed page and downloads through signed embed links: totals, per day, top referrers and countries, and the latest 50 events. Visits with your own token aren't counted.",
+		Query:       []openapi.Param{{Name: "days", Type: "integer", Description: "Days to cover (default 30, at most 365)"}},
+		Response:    handlers.EmbedAnalyticsResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/:id/workflow": {
+		Summary: "Workflow status of a media item", Tag: "media",
+		Description: "The review status, the statuses the media may move to and past transitions, newest first. Admins can read the workflow of any media.",
+		Response:    handlers.MediaWorkflowResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /api/v1/media/:id/workflow": {
+		Summary: "Move a media item through the review workflow", Tag: "media",
+		Description: "draft → in_review → approved or rejected; media in review can be withdrawn to draft, approved media reopened as drafts and rejected media resubmitted. " +
+			"Only admins approve or reject, and they can move any user's media. Moves the workflow doesn't allow answer 409.",
+		Body:     handlers.MediaWorkflowRequest{},
+		Response: handlers.MediaWorkflowResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/:id/download": {
+		Summary: "Download the original file", Tag: "media",
+		Description: "Stream the original bytes as an attachment, never transformed, with the stored file's Content-Length. " +
+			"A single Range (bytes=start-end) is answered with 206 so interrupted downloads can resume; If-Range drops the range when the file changed.",
+		Produces: []string{"application/octet-stream"},
+		Errors:   []int{http.StatusNotFound, http.StatusRequestedRangeNotSatisfiable, http.StatusInternalServerError},
+	},
+	"DELETE /api/v1/media/:id": {
+		Summary: "Delete a media item", Tag: "media",
+		Description: "Media under legal hold or within their retention period can't be deleted (409).",
+		Response:    handlers.MessageResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /api/v1/media/:id/transform": {
+		Summary: "Transform a media item", Tag: "media",
+		Description: "Resize, crop, convert, filter and watermark images; render document previews and GIF videos.",
+		Query:       transformParams, Produces: append(append([]string{}, imageTypes...), "video/mp4", "video/webm"),
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable},
+	},
+	"DELETE /api/v1/media/:id/derivatives": {
+		Summary: "Purge cached derivatives of a media item", Tag: "media",
+		Response: handlers.DerivativePurgeResponse{},
+		Errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/:id/suggestions": {
+		Summary: "Get tag suggestions", Tag: "media",
+		Description: "Tags and object labels the classifier suggested for an image, with whether each was accepted or rejected. " +
+			"suggestions is null for media never classified.",
+		Response: handlers.SuggestionsResponse{},
+		Errors:   []int{http.StatusNotFound},
+	},
+	"POST /api/v1/media/:id/suggestions": {
+		Summary: "Suggest tags for an image", Tag: "media",
+		Description: "Queues the image for the classifier, replacing its previous suggestions. New images are queued on upload.",
+		Response:    handlers.SuggestionsResponse{}, Status: http.StatusAccepted,
+		Errors: []int{http.StatusNotFound, http.StatusUnsupportedMediaType, http.StatusNotImplemented, http.StatusServiceUnavailable},
+	},
+	"POST /api/v1/media/:id/suggestions/review": {
+		Summary: "Accept or reject tag suggestions", Tag: "media",
+		Description: "Accepted suggestions are added to the media tags; rejecting one accepted before removes its tag again. " +
+			"A name applies to the tag and every object of that name.",
+		Body: handlers.ReviewSuggestionsRequest{}, Response: handlers.ReviewSuggestionsResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"POST /api/v1/folders": {
+		Summary: "Create a folder", Tag: "folders",
+		Description: "Names are unique among the folders of a parent; the folder gets a URL-safe slug derived from its name.",
+		Body:        handlers.CreateFolderRequest{}, Response: handlers.FolderItem{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /api/v1/folders": {
+		Summary: "List folders", Tag: "folders",
+		Query: append([]openapi.Param{
+			{Name: "search", Description: "Folder name search"},
+			{Name: "parent_id", Description: "Parent folder ID"},
+		}, append(subfolderParams, pageParams...)...),
+		Response: handlers.FolderListResponse{},
+		Errors:   []int{http.StatusInternalServerError},
+	},
+	"GET /api/v1/folders/by-path": {
+		Summary: "Look up a folder by path", Tag: "folders",
+		Description: "Walks down from the root; each segment of the path names a folder by slug or else by exact name.",
+		Query: append([]openapi.Param{
+			{Name: "path", Required: true, Description: "Slash-separated folder path, e.g. /photos/2024"},
+		}, subfolderParams...),
+		Response: handlers.FolderItem{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/folders/:id": {
+		Summary: "Get a folder with its media count", Tag: "folders",
+		Query:    subfolderParams,
+		Response: handlers.FolderItem{}, Errors: []int{http.StatusNotFound},
+	},
+	"PUT /api/v1/folders/:id": {
+		Summary: "Update a folder", Tag: "folders",
+		Description: "Renaming or moving a folder updates its slug. A folder can't be moved into itself or one of its subfolders, nor next to a folder of the same name.",
+		Body:        handlers.UpdateFolderRequest{}, Response: handlers.FolderItem{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /api/v1/folders/:id": {
+		Summary: "Delete a folder", Tag: "folders",
+		Response: handlers.MessageResponse{},
+		Errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/folders/:id/lifecycle": {
+		Summary: "List lifecycle rules", Tag: "folders",
+		Response: handlers.LifecycleRulesResponse{},
+		Errors:   []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /api/v1/folders/:id/lifecycle": {
+		Summary: "Create a lifecycle rule", Tag: "folders",
+		Description: "Archives media to a colder storage class, deletes them, or purges the records of deleted media once they are after_days old. A background worker applies rules to the folder's own media every LIFECYCLE_INTERVAL.",
+		Body:        handlers.CreateLifecycleRuleRequest{}, Response: models.LifecycleRule{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError, http.StatusNotImplemented},
+	},
+	"PUT /api/v1/folders/:id/lifecycle/:rule_id": {
+		Summary: "Update a lifecycle rule", Tag: "folders",
+		Body: handlers.UpdateLifecycleRuleRequest{}, Response: models.LifecycleRule{},
+		Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError, http.StatusNotImplemented},
+	},
+	"DELETE /api/v1/folders/:id/lifecycle/:rule_id": {
+		Summary: "Delete a lifecycle rule", Tag: "folders",
+		Description: "The actions the rule took stay in the audit log.",
+		Response:    handlers.MessageResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/folders/:id/lifecycle/actions": {
+		Summary: "Lifecycle audit log", Tag: "folders",
+		Description: "Actions lifecycle rules took on the folder's media, newest first. Failed actions carry an error and are attempted again on the next run.",
+		Query:       append([]openapi.Param{{Name: "rule_id", Type: "integer", Description: "Only actions of this rule"}}, pageParams...),
+		Response:    handlers.LifecycleActionsResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/export/csv": {
+		Summary: "Export media as CSV", Tag: "export",
+		Description: "Takes the filters of GET /media/list. fields picks the columns, id,filename,mime_type,size,created_at,updated_at by default. Rows are written as they are read.",
+		Query:       append(append([]openapi.Param{}, mediaFilterParams...), fieldsParam),
+		Produces:    []string{"text/csv"},
+		Errors:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"GET /api/v1/export/json": {
+		Summary: "Export media as JSON", Tag: "export",
+		Description: "Takes the filters of GET /media/list. With fields, items carry only those fields. Items are written as they are read.",
+		Query:       append(append([]openapi.Param{}, mediaFilterParams...), fieldsParam),
+		Response:    []handlers.MediaItem{},
+		Errors:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"GET /api/v1/export/xml": {
+		Summary: "Export media as XML", Tag: "export",
+		Description: "Takes the filters of GET /media/list. A media root holds an item element per media item; fields picks the elements, every media field by default. Items are written as they are read.",
+		Query:       append(append([]openapi.Param{}, mediaFilterParams...), fieldsParam),
+		Produces:    []string{"application/xml"},
+		Errors:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"GET /api/v1/export/xlsx": {
+		Summary: "Export media as an Excel workbook", Tag: "export",
+		Description: "Takes the filters of GET /media/list. fields picks the columns, id,filename,mime_type,size,created_at,updated_at by default. Rows are written as they are read.",
+		Query:       append(append([]openapi.Param{}, mediaFilterParams...), fieldsParam),
+		Produces:    []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		Errors:      []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"POST /api/v1/export/zip": {
+		Summary: "Export original files as an archive", Tag: "export",
+		Description: "Streams a ZIP or tar of the original files of the given media or of a folder's media, one object at a time. Objects that can't be read are listed in export_errors.txt. With async the archive is built in the background and 202 returns the job instead.",
+		Body:        handlers.ExportArchiveRequest{}, Response: handlers.ArchiveJobResponse{},
+		Produces: []string{"application/zip", "application/x-tar"},
+		Errors:   []int{http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/export/archives/:id": {
+		Summary: "Get an archive job", Tag: "export",
+		Description: "Progress of an archive built in the background, with its signed download_url once completed.",
+		Response:    handlers.ArchiveJobResponse{},
+		Errors:      []int{http.StatusNotFound},
+	},
+	"GET /api/v1/export/archives/:id/download": {
+		Summary: "Download an archive", Tag: "export", Public: true,
+		Description: "Accepts a Bearer token or the signed query of the job's download_url.",
+		Query: []openapi.Param{
+			{Name: "expires", Type: "integer", Description: "Signed URL expiry (unix seconds)"},
+			{Name: "token", Description: "Signed URL token"},
+		},
+		Produces: []string{"application/zip", "application/x-tar"},
+		Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	"GET /api/v1/storage/cache/stats": {
+		Summary: "Storage cache statistics", Tag: "storage",
+		Response: handlers.CacheStatsResponse{},
+	},
+	"GET /api/v1/storage/derivatives/stats": {
+		Summary: "Derivative cache statistics", Tag: "storage",
+		Response: handlers.DerivativeStatsResponse{},
+		Errors:   []int{http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/stats": {
+		Summary: "Media statistics", Tag: "media",
+		Description: "Counts and bytes of the current user's media by MIME type, by folder and by upload month.",
+		Response:    handlers.MediaStatsResponse{},
+		Errors:      []int{http.StatusInternalServerError},
+	},
+	"GET /api/v1/media/recent": {
+		Summary: "Recently accessed media", Tag: "media",
+		Description: "Media the current user viewed, served or downloaded, most recent first, with their view, serve and download counts. Empty while ACCESS_TRACKING_ENABLED is off.",
+		Query: []openapi.Param{
+			{Name: "kind", Type: "string", Description: "Only media accessed this way at least once (view, serve, download)"},
+			{Name: "limit", Type: "integer", Description: "Media to return (default 20, at most 100)"},
+		},
+		Response: handlers.RecentMediaResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"GET /api/v1/storage/:backend/*key": {
+		Summary: "Serve a stored object through a signed URL", Tag: "media", Public: true,
+		Description: "Serves objects of backends without presigned URLs of their own, such as SeaweedFS, at the download_url and offload redirects handed out for them. " +
+			"URLs are signed over the backend, key and expiry, so they can't be forged or extended. " +
+			"Objects are served with the MIME type of their media and a sandboxing Content-Security-Policy.",
+		Query: []openapi.Param{
+			{Name: "expires", Type: "integer", Required: true, Description: "Expiry (unix seconds)"},
+			{Name: "token", Required: true, Description: "Signature"},
+		},
+		Produces: []string{"application/octet-stream"},
+		Errors:   []int{http.StatusForbidden, http.StatusNotFound},
+	},
+	"GET /api/v1/proxy": {
+		Summary: "Transform a remote image", Tag: "proxy", Public: true,
+		Description: "Fetch a JPEG, PNG or GIF image from a host allowed by IMAGE_PROXY_ALLOWED_HOSTS, transform it like stored media and cache the render. " +
+			"Accepts either a Bearer token or the signed query of a link from POST /proxy/links. Signed requests are limited per client IP and can't skip the cache.",
+		Query: append(append([]openapi.Param{
+			{Name: "url", Required: true, Description: "Remote image URL"},
+		}, transformParams[:len(transformParams)-4]...),
+			openapi.Param{Name: "expires", Type: "integer", Description: "Signed URL expiry (unix seconds)"},
+			openapi.Param{Name: "token", Description: "Signed URL token"},
+		),
+		Produces: []string{"image/jpeg", "image/png", "image/gif"},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType,
+			http.StatusNotImplemented, http.StatusBadGateway, http.StatusServiceUnavailable},
+	},
+	"POST /api/v1/proxy/links": {
+		Summary: "Create a proxy link", Tag: "proxy",
+		Description: "Signed link to a transformed remote image, valid for IMAGE_PROXY_URL_EXPIRATION, for pages that load it without an Authorization header.",
+		Body:        handlers.ProxyLinkRequest{},
+		Response:    handlers.ProxyLinkResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotImplemented},
+	},
+	"GET /api/v1/widget-tokens": {
+		Summary: "List widget tokens", Tag: "widgets",
+		Description: "Your widget tokens, newest first, without the tokens themselves. Expired, used up and revoked tokens are left out unless all=true.",
+		Query:       []openapi.Param{{Name: "all", Type: "boolean", Description: "Include expired, used up and revoked tokens"}},
+		Response:    handlers.WidgetTokensResponse{},
+		Errors:      []int{http.StatusInternalServerError},
+	},
+	"POST /api/v1/widget-tokens": {
+		Summary: "Create a widget token", Tag: "widgets",
+		Description: "Short-lived token an upload widget on another site uploads into your library with, instead of your JWT. " +
+			"Uploads are limited to one folder, max_size bytes, the MIME types of allowed_types, pages on allowed_origins and max_uploads files. The token is only returned once.",
+		Body: handlers.CreateWidgetTokenRequest{}, Response: handlers.WidgetTokenResponse{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusInternalServerError},
+	},
+	"DELETE /api/v1/widget-tokens/:id": {
+		Summary: "Revoke a widget token", Tag: "widgets",
+		Description: "The token stops accepting uploads right away. Files already uploaded with it stay.",
+		Response:    handlers.MessageResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /api/v1/widget/upload": {
+		Summary: "Upload a file through a widget token", Tag: "widgets", Public: true,
+		Description: "Upload endpoint for widgets embedded in other sites, open to cross-origin requests. Authenticate with a widget token as a Bearer token, or as the token parameter for plain form posts. " +
+			"Files land in the token's folder within its limits, and duplicate names are renamed. Limited per client IP.",
+		Query: []openapi.Param{{Name: "token", Description: "Widget token, when no Authorization header is sent"}},
+		Form: []openapi.Param{
+			{Name: "file", Type: "file", Required: true},
+			{Name: "tags", Type: "array", Description: "Tag names"},
+		},
+		Response: handlers.MediaResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestEntityTooLarge,
+			http.StatusUnsupportedMediaType, http.StatusTooManyRequests, http.StatusInternalServerError},
+	},
+	"GET /api/v1/groups": {
+		Summary: "List groups", Tag: "groups",
+		Description: "Groups you own or belong to, with your role in each and their member counts. Admins list every group with all=true.",
+		Query:       []openapi.Param{{Name: "all", Type: "boolean", Description: "Every group (admins only)"}},
+		Response:    handlers.GroupsResponse{},
+		Errors:      []int{http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /api/v1/groups": {
+		Summary: "Create a group", Tag: "groups",
+		Description: "You own the group and are its first manager. Names are unique among your groups.",
+		Body:        handlers.CreateGroupRequest{}, Response: handlers.GroupResponse{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /api/v1/groups/:id": {
+		Summary: "Get a group", Tag: "groups",
+		Description: "A group you own or belong to with its members, managers first.",
+		Response:    handlers.GroupResponse{},
+		Errors:      []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /api/v1/groups/:id": {
+		Summary: "Update a group", Tag: "groups",
+		Description: "Only the owner and admins can rename a group or change its description.",
+		Body:        handlers.UpdateGroupRequest{}, Response: handlers.GroupResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"DELETE /api/v1/groups/:id": {
+		Summary: "Delete a group", Tag: "groups",
+		Description: "Only the owner and admins can delete a group.",
+		Response:    handlers.MessageResponse{},
+		Errors:      []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"POST /api/v1/groups/:id/members": {
+		Summary: "Add members to a group", Tag: "groups",
+		Description: "Adds users by ID or username. Managers add members; only the owner and admins add managers. Users already in the group keep their role.",
+		Body:        handlers.AddGroupMembersRequest{}, Response: handlers.AddGroupMembersResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"PUT /api/v1/groups/:id/members/:user_id": {
+		Summary: "Change the role of a group member", Tag: "groups",
+		Description: "Only the owner and admins change roles; the owner stays a manager.",
+		Body:        handlers.UpdateGroupMemberRequest{}, Response: handlers.GroupResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"DELETE /api/v1/groups/:id/members/:user_id": {
+		Summary: "Remove a member from a group", Tag: "groups",
+		Description: "Managers remove members, the owner and admins managers too, and members can leave by removing themselves. The owner can't be removed.",
+		Response:    handlers.MessageResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/metadata-fields": {
+		Summary: "List custom metadata fields", Tag: "media",
+		Description: "The typed fields admins defined for media metadata. Their values go under metadata.custom and can be filtered with meta[key]=value.",
+		Response:    handlers.MetadataFieldsResponse{},
+		Errors:      []int{http.StatusInternalServerError},
+	},
+	"GET /api/v1/account/usage": {
+		Summary: "Storage usage", Tag: "account",
+		Description: "Bytes stored against the quota, with counts by MIME type. Uploads past the quota fail with 413.",
+		Response:    handlers.StorageUsageResponse{},
+		Errors:      []int{http.StatusInternalServerError},
+	},
+	"POST /api/v1/feeds": {
+		Summary: "Create feed links", Tag: "feeds",
+		Description: "Signed RSS and Atom links to the feed of recent uploads, or of one folder's, for feed readers and automation tools that can't send a Bearer token.",
+		Body:        handlers.FeedLinksRequest{},
+		Response:    handlers.FeedLinksResponse{},
+		Errors:      []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /api/v1/feeds/media": {
+		Summary: "Feed of recent uploads", Tag: "feeds", Public: true,
+		Description: "RSS 2.0 or Atom feed of the most recent uploads, newest first. Items link to the embed page and enclose the media, so a feed of audio works as a podcast. " +
+			"Accepts either a Bearer token or the signed query of a link from POST /feeds.",
+		Query: []openapi.Param{
+			{Name: "format", Description: "rss (default) or atom"},
+			{Name: "folder_id", Description: "Folder ID, signed into feed links"},
+			{Name: "type", Description: "MIME type prefix filter, e.g. audio"},
+			{Name: "limit", Type: "integer", Description: "Items, up to 200 (default 50)"},
+			{Name: "user", Type: "integer", Description: "User ID from a signed URL"},
+			{Name: "expires", Type: "integer", Description: "Signed URL expiry (unix seconds)"},
+			{Name: "token", Description: "Signed URL token"},
+		},
+		Produces: []string{"application/rss+xml", "application/atom+xml"},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/account/domain": {
+		Summary: "Custom media domain", Tag: "account",
+		Description: "The hostname media URLs are served from, null for the storage backend's public URL.",
+		Response:    handlers.PublicDomainResponse{},
+		Errors:      []int{http.StatusInternalServerError},
+	},
+	"PUT /api/v1/account/domain": {
+		Summary: "Set the custom media domain", Tag: "account",
+		Description: "Serve media URLs from a custom hostname, such as a CDN in front of the storage bucket; null goes back to the backend's public URL. " +
+			"With STORAGE_DOMAIN_TARGET set, the hostname must be a CNAME of it.",
+		Body:     handlers.PublicDomainRequest{},
+		Response: handlers.PublicDomainResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"GET /api/v1/admin/storage/backends": {
+		Summary: "Storage backend health", Tag: "admin",
+		Response: handlers.StorageBackendsResponse{},
+		Errors:   []int{http.StatusForbidden},
+	},
+	"PUT /api/v1/admin/storage/upload-backend": {
+		Summary: "Override upload backend", Tag: "admin",
+		Body: handlers.UploadBackendRequest{}, Response: handlers.UploadBackendResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden},
+	},
+	"GET /api/v1/admin/storage/replication": {
+		Summary: "Storage replication status", Tag: "admin",
+		Response: handlers.ReplicationStatusResponse{},
+		Errors:   []int{http.StatusForbidden},
+	},
+	"POST /api/v1/admin/storage/replication/reconcile": {
+		Summary: "Reconcile the storage replica", Tag: "admin",
+		Description: "Checks in the background that every media object exists on the replica. The report appears in GET /admin/storage/replication.",
+		Query:       []openapi.Param{{Name: "repair", Type: "boolean", Description: "Copy missing objects to the replica"}},
+		Response:    handlers.MessageResponse{}, Status: http.StatusAccepted,
+		Errors: []int{http.StatusForbidden, http.StatusConflict, http.StatusNotImplemented},
+	},
+	"PUT /api/v1/admin/users/:id/quota": {
+		Summary: "Override a user's storage quota", Tag: "admin",
+		Description: "A null quota restores the configured default; 0 is unlimited.",
+		Body:        handlers.UserQuotaRequest{}, Response: handlers.UserQuotaResponse{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound},
+	},
+	"POST /api/v1/admin/users/:id/transfer": {
+		Summary: "Transfer media and folders to another user", Tag: "admin",
+		Description: "Hands media, folders with their subfolders and media, or everything a user owns to another user in one transaction, recorded in the transfer log. The topmost folders land in the recipient's root, numbered when a name is taken. Fails with 413 past the recipient's quota unless ignore_quota is set.",
+		Body:        handlers.OwnershipTransferRequest{}, Response: models.OwnershipTransfer{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge},
+	},
+	"GET /api/v1/admin/transfers": {
+		Summary: "Ownership transfer log", Tag: "admin",
+		Description: "Transfers between users, newest first, with the IDs of what they moved.",
+		Query:       append([]openapi.Param{{Name: "user_id", Type: "integer", Description: "Only transfers from or to this user"}}, pageParams...),
+		Response:    handlers.OwnershipTransfersResponse{},
+		Errors:      []int{http.StatusForbidden},
+	},
+	"GET /api/v1/admin/reviews": {
+		Summary: "Media awaiting review", Tag: "admin",
+		Description: "Media of every user in review, submitted longest ago first.",
+		Query:       pageParams,
+		Response:    handlers.MediaListResponse{},
+		Errors:      []int{http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /api/v1/admin/licenses/expiring": {
+		Summary: "Media of all users whose rights expire soon", Tag: "admin",
+		Description: "Media of every user whose license ends within the next days, soonest first.",
+		Query: append([]openapi.Param{
+			{Name: "days", Type: "integer", Description: "Days ahead to cover (default 30, at most 3650)"},
+			{Name: "include_expired", Type: "boolean", Description: "Also list media whose license already ended"},
+			{Name: "user_id", Type: "integer", Description: "Only media of this user"},
+		}, pageParams...),
+		Response: handlers.ExpiringLicensesResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /api/v1/admin/retention/events": {
+		Summary: "Retention audit log", Tag: "admin",
+		Description: "Legal holds and retention periods placed, released and changed on the media of every user, newest first. Admin overrides are flagged and carry their reason.",
+		Query: append([]openapi.Param{
+			{Name: "media_id", Description: "Only events of this media item"},
+			{Name: "user_id", Type: "integer", Description: "Only events of this user's media"},
+			{Name: "override", Type: "boolean", Description: "Only admin overrides"},
+		}, pageParams...),
+		Response: handlers.RetentionEventsResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"POST /api/v1/admin/metadata-fields": {
+		Summary: "Define a custom metadata field", Tag: "admin",
+		Description: "Adds a typed field (text, number, date or select) to the metadata of every media item. Once a field is defined, media updates may only set defined fields under metadata.custom, with values of their type, and must set required ones.",
+		Body:        handlers.CreateMetadataFieldRequest{}, Response: models.MetadataField{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict, http.StatusInternalServerError},
+	},
+	"PUT /api/v1/admin/metadata-fields/:id": {
+		Summary: "Update a custom metadata field", Tag: "admin",
+		Description: "Changes the label, options or required state of a field. Its key and type can't change.",
+		Body:        handlers.UpdateMetadataFieldRequest{}, Response: models.MetadataField{},
+		Errors: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"DELETE /api/v1/admin/metadata-fields/:id": {
+		Summary: "Delete a custom metadata field", Tag: "admin",
+		Description: "Removes the field and its values from the metadata of all media.",
+		Response:    handlers.MessageResponse{},
+		Errors:      []int{http.StatusForbidden, http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v1/admin/consistency": {
+		Summary: "Storage consistency report", Tag: "admin",
+		Description: "The last check's orphan objects no record refers to and records whose objects are missing, up to 1000 of each. The report is null until a check ran.",
+		Response:    handlers.ConsistencyResponse{},
+		Errors:      []int{http.StatusForbidden},
+	},
+	"POST /api/v1/admin/consistency/check": {
+		Summary: "Check storage consistency", Tag: "admin",
+		Description: "Compares stored objects with database records in the background. With repair, orphans are deleted, media without objects are marked broken and derivatives without objects are dropped.",
+		Query:       []openapi.Param{{Name: "repair", Type: "boolean", Description: "Delete orphans and mark broken records"}},
+		Response:    handlers.MessageResponse{}, Status: http.StatusAccepted,
+		Errors: []int{http.StatusForbidden, http.StatusConflict},
+	},
+	"POST /api/v1/admin/config/reload": {
+		Summary: "Reload configuration", Tag: "admin",
+		Description: "Re-reads the environment and .env and applies rate limits, transform presets, MAX_UPLOAD_SIZE and the upload, image proxy and CORS allowlists without a restart, like SIGHUP. Lists the variables whose values changed.",
+		Response:    handlers.ConfigReloadResponse{},
+		Errors:      []int{http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /api/v1/admin/jobs": {
+		Summary: "Background jobs", Tag: "admin",
+		Description: "Schedule, last run and failures of every periodic background job.",
+		Response:    handlers.JobsResponse{},
+		Errors:      []int{http.StatusForbidden},
+	},
+	"POST /api/v1/admin/jobs/:name/run": {
+		Summary: "Run a background job now", Tag: "admin",
+		Description: "Starts the job whatever its schedule. Its outcome shows in GET /admin/jobs.",
+		Response:    handlers.MessageResponse{}, Status: http.StatusAccepted,
+		Errors: []int{http.StatusForbidden, http.StatusNotFound, http.StatusConflict},
+	},
+	"GET /api/v1/admin/stats": {
+		Summary: "System statistics", Tag: "admin",
+		Description: "Users, storage per user, uploads per day, top MIME types, background jobs with failed runs, recent batches with failed items and the slowest cached transforms.",
+		Query: []openapi.Param{
+			{Name: "days", Type: "integer", Description: "Days of uploads and failed batches to cover (default 30, at most 365)"},
+			{Name: "limit", Type: "integer", Description: "Entries per ranking (default 10, at most 100)"},
+		},
+		Response: handlers.AdminStatsResponse{},
+		Errors:   []int{http.StatusBadRequest, http.StatusForbidden, http.StatusInternalServerError},
+	},
+	"GET /api/v2/media/:id": {
+		Summary: "Get a media item", Tag: "v2",
+		Response: handlers.V2Response{}, ErrorBody: apierror.EnvelopeResponse{},
+		Errors: []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /api/v2/folders/:id": {
+		Summary: "Get a folder with its media count", Tag: "v2",
+		Query:    subfolderParams,
+		Response: handlers.V2Response{}, ErrorBody: apierror.EnvelopeResponse{},
+		Errors: []int{http.StatusNotFound, http.StatusInternalServerError},
+	},
+	"GET /health": {
+		Summary: "Health check", Tag: "health", Public: true,
+		Response: handlers.HealthResponse{},
+	},
+	"GET /openapi.json": {Hidden: true},
+	"GET /swagger/*any": {Hidden: true},
+}
+
+// WebDAV methods aren't OpenAPI operations; the tree is described in the README instead
+func init() {
+	for _, method := range handlers.WebDAVMethods {
+		operations[method+" "+handlers.WebDAVPrefix+"/*path"] = openapi.Operation{Hidden: true}
+	}
+}
+
+// OpenAPIDocument builds the OpenAPI document of every route registered on router
+func OpenAPIDocument(router *gin.Engine) map[string]interface{} {
+	return openapi.Build(apiInfo, router.Routes(), operations, apierror.Response{})
+}
+
+// serveOpenAPI returns a handler serving the OpenAPI document of router. The document is
+// built on first request so routes registered after SetupRoutes are covered too.
+func serveOpenAPI(router *gin.Engine) gin.HandlerFunc {
+	var (
+		once     sync.Once
+		document map[string]interface{}
+	)
+	return func(c *gin.Context) {
+		once.Do(func() {
+			document = OpenAPIDocument(router)
+		})
+		c.JSON(http.StatusOK, document)
+	}
+}
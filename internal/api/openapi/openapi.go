@@ -0,0 +1,244 @@
+// Package openapi generates an OpenAPI 3 document from the registered gin routes and
+// the request and response types documented for them.
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Param documents a query, path or multipart form parameter
+type Param struct {
+	Name        string
+	Type        string // string (default), integer, number, boolean, array, file or files
+	Description string
+	Required    bool
+}
+
+// Operation documents one route
+type Operation struct {
+	Summary     string
+	Description string
+	Tag         string
+	Public      bool        // Served without a bearer token
+	Query       []Param     // Query string parameters
+	Form        []Param     // multipart/form-data fields; mutually exclusive with Body
+	Body        interface{} // JSON request body, as a value of the bound type
+	Response    interface{} // JSON success body, as a value of the written type
+	Status      int         // Success status; defaults to 200
+	Produces    []string    // Non-JSON success content types, e.g. image/jpeg
+	Errors      []int       // Error statuses, all answered with errorBody
+	ErrorBody   interface{} // Error body when it differs from the document's errorBody
+	Deprecated  bool        // Still served, but clients should move to its successor
+	Hidden      bool        // Leave the route out of the document
+}
+
+// Info is the document's title block
+type Info struct {
+	Title       string
+	Description string
+	Version     string
+}
+
+var pathParam = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+
+// Build creates an OpenAPI 3 document covering every route. Operations are looked up by
+// "METHOD /path" using gin's path syntax; routes without one are still listed, flagged
+// as undocumented, so new endpoints never silently go missing.
+func Build(info Info, routes gin.RoutesInfo, operations map[string]Operation, errorBody interface{}) map[string]interface{} {
+	registry := &schemaRegistry{components: map[string]Schema{}}
+	errorSchema := registry.ref(errorBody)
+
+	sorted := append(gin.RoutesInfo(nil), routes...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+
+	paths := map[string]map[string]interface{}{}
+	for _, route := range sorted {
+		op, documented := operations[route.Method+" "+route.Path]
+		if op.Hidden {
+			continue
+		}
+		if !documented {
+			op = Operation{Summary: "Undocumented endpoint", Description: "Handled by " + route.Handler}
+		}
+
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(route.Method)] = buildOperation(registry, route, op, errorSchema, documented)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       info.Title,
+			"description": info.Description,
+			"version":     info.Version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": registry.components,
+			"securitySchemes": map[string]interface{}{
+				"BearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+}
+
+// buildOperation renders one operation object
+func buildOperation(registry *schemaRegistry, route gin.RouteInfo, op Operation, errorSchema Schema, documented bool) map[string]interface{} {
+	result := map[string]interface{}{
+		"summary":     op.Summary,
+		"operationId": operationID(route.Handler),
+	}
+	if op.Description != "" {
+		result["description"] = op.Description
+	}
+	if op.Tag != "" {
+		result["tags"] = []string{op.Tag}
+	}
+	if !documented {
+		result["x-undocumented"] = true
+	}
+	if op.Deprecated {
+		result["deprecated"] = true
+	}
+	if op.ErrorBody != nil {
+		errorSchema = registry.ref(op.ErrorBody)
+	}
+	if !op.Public {
+		result["security"] = []map[string][]string{{"BearerAuth": {}}}
+	}
+
+	var parameters []map[string]interface{}
+	for _, match := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   Schema{"type": "string"},
+		})
+	}
+	for _, param := range op.Query {
+		entry := map[string]interface{}{
+			"name":   param.Name,
+			"in":     "query",
+			"schema": paramSchema(param),
+		}
+		if param.Description != "" {
+			entry["description"] = param.Description
+		}
+		if param.Required {
+			entry["required"] = true
+		}
+		parameters = append(parameters, entry)
+	}
+	if len(parameters) > 0 {
+		result["parameters"] = parameters
+	}
+
+	switch {
+	case op.Body != nil:
+		result["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": registry.ref(op.Body)},
+			},
+		}
+	case len(op.Form) > 0:
+		properties := Schema{}
+		var required []string
+		for _, param := range op.Form {
+			schema := paramSchema(param)
+			if param.Description != "" {
+				schema["description"] = param.Description
+			}
+			properties[param.Name] = schema
+			if param.Required {
+				required = append(required, param.Name)
+			}
+		}
+		schema := Schema{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		result["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"multipart/form-data": map[string]interface{}{"schema": schema},
+			},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	content := map[string]interface{}{}
+	if op.Response != nil {
+		content["application/json"] = map[string]interface{}{"schema": registry.ref(op.Response)}
+	}
+	for _, contentType := range op.Produces {
+		content[contentType] = map[string]interface{}{"schema": Schema{"type": "string", "format": "binary"}}
+	}
+	if len(content) > 0 {
+		success["content"] = content
+	}
+
+	responses := map[string]interface{}{statusKey(status): success}
+	for _, code := range op.Errors {
+		responses[statusKey(code)] = map[string]interface{}{
+			"description": http.StatusText(code),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": errorSchema},
+			},
+		}
+	}
+	result["responses"] = responses
+	return result
+}
+
+// paramSchema maps a parameter type to its schema
+func paramSchema(param Param) Schema {
+	switch param.Type {
+	case "", "string":
+		return Schema{"type": "string"}
+	case "file":
+		return Schema{"type": "string", "format": "binary"}
+	case "array":
+		return Schema{"type": "array", "items": Schema{"type": "string"}}
+	case "files":
+		return Schema{"type": "array", "items": Schema{"type": "string", "format": "binary"}}
+	default:
+		return Schema{"type": param.Type}
+	}
+}
+
+// operationID derives a stable operation ID from the handler name, e.g. ListMedia
+func operationID(handler string) string {
+	if i := strings.LastIndex(handler, "."); i >= 0 {
+		handler = handler[i+1:]
+	}
+	return strings.TrimSuffix(handler, "-fm")
+}
+
+// statusKey renders a status code as a responses map key
+func statusKey(code int) string {
+	return strconv.Itoa(code)
+}
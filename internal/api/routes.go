@@ -1,53 +1,165 @@
 package api
 
 import (
+	"time"
+
 	"go-media-center-example/internal/api/handlers"
 	"go-media-center-example/internal/api/middleware"
+	"go-media-center-example/internal/config"
 
 	"github.com/gin-gonic/gin"
 )
 
+// apiVersions lists the served API versions, oldest first
+var apiVersions = []string{"v1", "v2"}
+
 // SetupRoutes configures all application routes
 func SetupRoutes(router *gin.Engine) {
+	cfg := config.GetConfig()
+
+	// Answers errors reported with c.Error, so it runs before everything else
+	router.Use(middleware.ErrorHandler())
+
+	// Preflight requests are answered before routing, as no route handles OPTIONS
+	router.Use(middleware.CORS("/api/v1/widget/"))
+
 	// API v1 group
 	v1 := router.Group("/api/v1")
+	v1.Use(middleware.APIVersion("v1"))
+	if !cfg.API.V1Sunset.IsZero() {
+		v1.Use(middleware.Deprecated(middleware.Deprecation{Sunset: cfg.API.V1Sunset, Successor: "/api/v2"}))
+	}
 	{
 		// Public routes
 		setupPublicRoutes(v1)
 
 		// Protected routes
 		protected := v1.Group("/")
-		protected.Use(middleware.JWTAuth())
+		protected.Use(middleware.JWTAuth(), middleware.RateLimitByUser("api", middleware.APILimit), middleware.Compress(cfg.Compress))
 		setupProtectedRoutes(protected)
 	}
+
+	// API v2 answers in a consistent envelope: {"data", "meta"} or {"error": {"code", "message"}}
+	v2 := router.Group("/api/v2")
+	v2.Use(middleware.APIVersion("v2"), middleware.JWTAuth(), middleware.RateLimitByUser("api", middleware.APILimit), middleware.Compress(cfg.Compress))
+	setupV2Routes(v2)
+
+	// Unversioned /api paths are served by the version the client asks for
+	router.NoRoute(middleware.NegotiateVersion(router, apiVersions, cfg.API.DefaultVersion))
+
+	// WebDAV for file managers and sync tools, which mostly log in with Basic credentials.
+	// Logins are limited per IP before they are checked, like the auth endpoints.
+	webdav := router.Group(handlers.WebDAVPrefix, middleware.RateLimitBasicLogins("auth", middleware.AuthLimit),
+		middleware.BasicOrJWTAuth("Media Center"), middleware.RateLimitByUser("api", middleware.APILimit))
+	for _, method := range handlers.WebDAVMethods {
+		webdav.Handle(method, "/*path", handlers.WebDAV)
+	}
+
+	// Liveness probe, outside the versioned API so it never moves
+	router.GET("/health", handlers.HealthCheck)
+
+	// OpenAPI 3 document generated from the routes and handler DTOs
+	router.GET("/openapi.json", serveOpenAPI(router))
 }
 
 // setupPublicRoutes configures public routes that don't require authentication
 func setupPublicRoutes(rg *gin.RouterGroup) {
 	auth := rg.Group("/auth")
+	auth.Use(middleware.RateLimitByIP("auth", middleware.AuthLimit))
 	{
 		auth.POST("/register", handlers.Register)
 		auth.POST("/login", handlers.Login)
 	}
 
-	// Serve media files (if public access is needed)
+	// Media files accept signed URLs so pages can load them without an Authorization header;
+	// they may transform, so they are limited per client IP like the proxy
 	media := rg.Group("/media/files")
 	{
-		media.GET("/:filename", handlers.ServeMediaFile)
+		media.GET("/:filename", middleware.RateLimitByIP("files", middleware.TransformLimit),
+			middleware.SignedOrJWTAuth(handlers.VerifyFileToken), handlers.ServeMediaFile)
 	}
+
+	// Thumbnails accept signed URLs so grids can load them without an Authorization header
+	rg.GET("/media/:id/thumb", middleware.SignedOrJWTAuth(handlers.VerifyThumbnailToken), handlers.GetMediaThumbnail)
+
+	// Deep zoom viewers repeat the signed query of the descriptor on every tile URL
+	rg.GET("/media/:id/tiles.dzi", middleware.SignedOrJWTAuth(handlers.VerifyDeepZoomToken), handlers.GetDeepZoomDescriptor)
+	rg.GET("/media/:id/tiles_files/:level/:tile", middleware.SignedOrJWTAuth(handlers.VerifyDeepZoomToken), handlers.GetDeepZoomTile)
+
+	// Shared embed links unfurl in chat tools and CMSs, which fetch them without credentials
+	rg.GET("/media/:id/embed", middleware.SignedOrJWTAuth(handlers.VerifyEmbedToken), handlers.GetMediaEmbed)
+	rg.GET("/media/:id/embed/download", middleware.SignedOrJWTAuth(handlers.VerifyEmbedToken), handlers.DownloadEmbedMedia)
+	rg.GET("/oembed", handlers.OEmbed)
+
+	// Feed readers poll signed feed links
+	rg.GET("/feeds/media", middleware.SignedOrJWTAuth(handlers.VerifyFeedToken), handlers.GetMediaFeed)
+
+	// Pages embed proxied images through signed links; renders are limited per client IP
+	rg.GET("/proxy", middleware.RateLimitByIP("proxy", middleware.TransformLimit),
+		middleware.SignedOrJWTAuth(handlers.VerifyProxyToken), handlers.ProxyImage)
+
+	// Upload widgets on other sites authenticate with their own scoped tokens
+	rg.POST("/widget/upload", middleware.RateLimitByIP("widget", middleware.APILimit), middleware.WidgetTokenAuth(), handlers.WidgetUpload)
+
+	// Presigned URLs of backends that can't sign URLs themselves are served by the API
+	rg.GET("/storage/:backend/*key", handlers.ServeSignedObject)
+
+	// Archive download links are signed so they can be shared with download managers
+	rg.GET("/export/archives/:id/download", middleware.SignedOrJWTAuth(handlers.VerifyArchiveToken), handlers.DownloadArchive)
+
+	// Browser websockets can't send an Authorization header, so the token may be in the query
+	rg.GET("/batches/:id/events", middleware.QueryTokenAuth(), handlers.BatchEvents)
+
+	// The notification websocket authenticates itself, by token or by its first message
+	rg.GET("/ws", handlers.ConnectWebSocket)
 }
 
 // setupProtectedRoutes configures routes that require authentication
 func setupProtectedRoutes(rg *gin.RouterGroup) {
+	// Transforms are CPU heavy, so they have a tighter limit of their own
+	transformLimit := middleware.RateLimitByUser("transform", middleware.TransformLimit)
+
+	// Uploads and batches may be retried with the same Idempotency-Key without running twice
+	idempotent := middleware.Idempotent()
+
+	// URL imports became batch jobs, listed with the transform jobs under /batches
+	importsDeprecation := middleware.Deprecated(middleware.Deprecation{
+		Since:     time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC),
+		Successor: "/api/v1/batches?kind=url_import",
+	})
+
 	// Media routes
 	media := rg.Group("/media")
 	{
-		media.POST("/upload", handlers.UploadMedia)
-		media.POST("/url", handlers.UploadMediaFromURL)
-		media.POST("/batch", handlers.BulkUploadMedia)
+		media.POST("/upload", idempotent, handlers.UploadMedia)
+		media.POST("/uploads/presign", idempotent, handlers.PresignUpload)
+		media.POST("/uploads/complete", idempotent, handlers.CompleteUpload)
+		media.GET("/uploads/:id", handlers.GetUploadSession)
+		media.DELETE("/uploads/:id", handlers.AbortUploadSession)
+		media.POST("/uploads/:id/parts", handlers.PresignUploadParts)
+		media.POST("/uploads/:id/complete", idempotent, handlers.CompleteMultipartUpload)
+		media.POST("/url", idempotent, handlers.UploadMediaFromURL)
+		media.POST("/url/batch", idempotent, handlers.BulkURLUpload)
+		media.GET("/imports", importsDeprecation, handlers.ListImportJobs)
+		media.GET("/imports/:id", importsDeprecation, handlers.GetImportJob)
+		media.POST("/batch", idempotent, handlers.BulkUploadMedia)
+		media.POST("/batch/operation", idempotent, handlers.HandleBatchOperation)
+		media.POST("/batch/transform", transformLimit, idempotent, handlers.BatchTransformMedia)
+		media.GET("/purges/:id", handlers.GetPurgeJob)
 		media.GET("/list", handlers.ListMedia)
+		media.GET("/stats", handlers.GetMediaStats)
+		media.GET("/recent", handlers.ListRecentMedia)
+		media.GET("/licenses/expiring", handlers.ListExpiringLicenses)
+		media.POST("/thumbs", handlers.GetMediaThumbnails)
 		media.PUT("/:id", handlers.UpdateMedia)
+		media.PUT("/:id/license", handlers.SetMediaLicense)
+		media.GET("/:id/retention", handlers.GetMediaRetention)
+		media.PUT("/:id/retention", handlers.SetMediaRetention)
 		media.GET("/:id", handlers.GetMedia)
+		media.GET("/:id/download", handlers.DownloadMedia)
+		media.GET("/:id/embed/analytics", handlers.GetEmbedAnalytics)
+		media.GET("/:id/workflow", handlers.GetMediaWorkflow)
+		media.POST("/:id/workflow", handlers.TransitionMediaWorkflow)
 		media.DELETE("/:id", handlers.DeleteMedia)
 
 		// Transform API Examples:
@@ -74,6 +186,7 @@ func setupProtectedRoutes(rg *gin.RouterGroup) {
 		// 5. Crop operation:
 		//    POST /api/v1/media/{id}/transform?crop=100,100,500,300
 		//    Format: x,y,width,height
+		//    POST /api/v1/media/{id}/transform?width=300&height=300&crop=smart
 		//
 		// 6. Combined operations:
 		//    POST /api/v1/media/{id}/transform?width=800&height=600&format=webp&quality=80&fit=cover
@@ -81,16 +194,64 @@ func setupProtectedRoutes(rg *gin.RouterGroup) {
 		// 7. Force fresh transformation (skip cache):
 		//    Add fresh=true to any transform request
 		//    Example: /api/v1/media/{id}/transform?width=800&fresh=true
-		media.POST("/:id/transform", handlers.TransformMedia)
+		//
+		// 8. Animated GIF to video (GIF sources only):
+		//    POST /api/v1/media/{id}/transform?format=mp4
+		//    POST /api/v1/media/{id}/transform?format=webm&width=480
+		//
+		// 9. Document previews (first page of PDF/office files):
+		//    POST /api/v1/media/{id}/transform?preset=thumbnail
+		//
+		// 10. Watermark (media ID or the configured default):
+		//    POST /api/v1/media/{id}/transform?watermark=default&watermark_position=bottom-right
+		//
+		// 11. Rotate (clockwise degrees) and flip (h, v, hv):
+		//    POST /api/v1/media/{id}/transform?rotate=90&flip=h
+		//
+		// 12. Filters (blur, sharpen, grayscale, brightness, contrast, saturation):
+		//    POST /api/v1/media/{id}/transform?width=32&blur=2
+		media.POST("/:id/transform", transformLimit, handlers.TransformMedia)
+		media.DELETE("/:id/derivatives", handlers.PurgeMediaDerivatives)
+		media.GET("/:id/suggestions", handlers.GetMediaSuggestions)
+		media.POST("/:id/suggestions", handlers.ClassifyMedia)
+		media.POST("/:id/suggestions/review", handlers.ReviewMediaSuggestions)
+	}
+
+	// Background batch jobs
+	batches := rg.Group("/batches")
+	{
+		batches.GET("", handlers.ListBatches)
+		batches.GET("/:id", handlers.GetBatch)
+	}
+
+	// Library imports run as batch jobs too
+	rg.POST("/import", idempotent, handlers.ImportManifest)
+
+	// Cloud drives connected over OAuth, whose files are imported as batch jobs
+	drives := rg.Group("/drives")
+	{
+		drives.GET("", handlers.ListDrives)
+		drives.POST("/connect/:provider", handlers.ConnectDrive)
+		drives.POST("/connect/:provider/complete", handlers.CompleteDriveConnection)
+		drives.DELETE("/:id", handlers.DisconnectDrive)
+		drives.GET("/:id/files", handlers.ListDriveFiles)
+		drives.POST("/:id/import", idempotent, handlers.ImportDriveFiles)
 	}
 
 	// Folder routes
 	folders := rg.Group("/folders")
 	{
-		folders.POST("/", handlers.CreateFolder)
-		folders.GET("/", handlers.ListFolders)
+		folders.POST("", handlers.CreateFolder)
+		folders.GET("", handlers.ListFolders)
+		folders.GET("/by-path", handlers.GetFolderByPath)
+		folders.GET("/:id", handlers.GetFolder)
 		folders.PUT("/:id", handlers.UpdateFolder)
 		folders.DELETE("/:id", handlers.DeleteFolder)
+		folders.GET("/:id/lifecycle", handlers.ListLifecycleRules)
+		folders.POST("/:id/lifecycle", handlers.CreateLifecycleRule)
+		folders.GET("/:id/lifecycle/actions", handlers.ListLifecycleActions)
+		folders.PUT("/:id/lifecycle/:rule_id", handlers.UpdateLifecycleRule)
+		folders.DELETE("/:id/lifecycle/:rule_id", handlers.DeleteLifecycleRule)
 	}
 
 	// Export routes
@@ -98,5 +259,86 @@ func setupProtectedRoutes(rg *gin.RouterGroup) {
 	{
 		export.GET("/csv", handlers.ExportCSV)
 		export.GET("/json", handlers.ExportJSON)
+		export.GET("/xml", handlers.ExportXML)
+		export.GET("/xlsx", handlers.ExportXLSX)
+		export.POST("/zip", handlers.ExportArchive)
+		export.GET("/archives/:id", handlers.GetArchiveJob)
+	}
+
+	// Storage routes
+	storage := rg.Group("/storage")
+	{
+		storage.GET("/cache/stats", handlers.GetStorageCacheStats)
+		storage.GET("/derivatives/stats", handlers.GetDerivativeCacheStats)
 	}
+
+	// Feed links
+	rg.POST("/feeds", handlers.CreateFeedLinks)
+
+	// Image proxy links
+	rg.POST("/proxy/links", handlers.CreateProxyLink)
+
+	// Tokens for upload widgets embedded in other sites
+	widgetTokens := rg.Group("/widget-tokens")
+	{
+		widgetTokens.GET("", handlers.ListWidgetTokens)
+		widgetTokens.POST("", handlers.CreateWidgetToken)
+		widgetTokens.DELETE("/:id", handlers.RevokeWidgetToken)
+	}
+
+	// Group routes
+	groups := rg.Group("/groups")
+	{
+		groups.GET("", handlers.ListGroups)
+		groups.POST("", handlers.CreateGroup)
+		groups.GET("/:id", handlers.GetGroup)
+		groups.PUT("/:id", handlers.UpdateGroup)
+		groups.DELETE("/:id", handlers.DeleteGroup)
+		groups.POST("/:id/members", handlers.AddGroupMembers)
+		groups.PUT("/:id/members/:user_id", handlers.UpdateGroupMember)
+		groups.DELETE("/:id/members/:user_id", handlers.RemoveGroupMember)
+	}
+
+	// Custom metadata fields, defined by admins
+	rg.GET("/metadata-fields", handlers.ListMetadataFields)
+
+	// Account routes
+	account := rg.Group("/account")
+	{
+		account.GET("/usage", handlers.GetAccountUsage)
+		account.GET("/domain", handlers.GetPublicDomain)
+		account.PUT("/domain", handlers.SetPublicDomain)
+	}
+
+	// Admin routes
+	admin := rg.Group("/admin")
+	admin.Use(middleware.RequireAdmin())
+	{
+		admin.GET("/storage/backends", handlers.ListStorageBackends)
+		admin.PUT("/storage/upload-backend", handlers.SetStorageUploadBackend)
+		admin.GET("/storage/replication", handlers.GetReplicationStatus)
+		admin.POST("/storage/replication/reconcile", handlers.ReconcileReplicas)
+		admin.PUT("/users/:id/quota", handlers.SetUserQuota)
+		admin.POST("/users/:id/transfer", handlers.TransferOwnership)
+		admin.GET("/transfers", handlers.ListOwnershipTransfers)
+		admin.GET("/reviews", handlers.ListReviewQueue)
+		admin.GET("/licenses/expiring", handlers.ListAllExpiringLicenses)
+		admin.GET("/retention/events", handlers.ListRetentionEvents)
+		admin.POST("/metadata-fields", handlers.CreateMetadataField)
+		admin.PUT("/metadata-fields/:id", handlers.UpdateMetadataField)
+		admin.DELETE("/metadata-fields/:id", handlers.DeleteMetadataField)
+		admin.GET("/consistency", handlers.GetConsistencyReport)
+		admin.POST("/consistency/check", handlers.CheckConsistency)
+		admin.POST("/config/reload", handlers.ReloadConfig)
+		admin.GET("/jobs", handlers.ListJobs)
+		admin.POST("/jobs/:name/run", handlers.RunJob)
+		admin.GET("/stats", handlers.GetAdminStats)
+	}
+}
+
+// setupV2Routes configures the /api/v2 routes. Endpoints move here as their responses
+// adopt the envelope; everything else is still served by /api/v1.
+func setupV2Routes(rg *gin.RouterGroup) {
+	rg.GET("/media/:id", handlers.GetMediaV2)
+	rg.GET("/folders/:id", handlers.GetFolderV2)
 }
@@ -0,0 +1,135 @@
+// Package cdn purges changed and deleted media from the CDN in front of storage, so its
+// edges stop serving stale copies long before their s-maxage runs out.
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go-media-center-example/internal/config"
+)
+
+const (
+	// purgeAttempts is how often a batch of URLs is tried before it is dropped
+	purgeAttempts = 3
+	// retryDelay is the wait after the first failed attempt; it doubles after each one
+	retryDelay = time.Second
+	// requestTimeout bounds a single call to a purge API
+	requestTimeout = 30 * time.Second
+	// maxBatch is the most queued URLs purged together
+	maxBatch = 100
+)
+
+// Purger removes URLs from the edge caches of a CDN. Purge is only called from one
+// goroutine at a time.
+type Purger interface {
+	Name() string
+	Purge(ctx context.Context, urls []string) error
+}
+
+// queue feeds the purging goroutine; nil while purging is disabled
+var queue chan string
+
+// NewPurger creates the purger named by the configuration
+func NewPurger(cfg config.CDNConfig) (Purger, error) {
+	switch cfg.Provider {
+	case "cloudfront":
+		return NewCloudFrontPurger(cfg.DistributionID, cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey)
+	case "fastly":
+		return NewFastlyPurger(cfg.APIToken)
+	case "cloudflare":
+		return NewCloudflarePurger(cfg.ZoneID, cfg.APIToken)
+	default:
+		return nil, fmt.Errorf("unknown CDN purge provider: %s", cfg.Provider)
+	}
+}
+
+// Start begins purging through the configured provider. It does nothing when no provider
+// is configured, and must be called once before requests are served.
+func Start(cfg config.CDNConfig) error {
+	if cfg.Provider == "" {
+		return nil
+	}
+
+	purger, err := NewPurger(cfg)
+	if err != nil {
+		return err
+	}
+
+	queue = make(chan string, cfg.Buffer)
+	go run(purger, queue)
+	log.Printf("Purging changed media from %s", purger.Name())
+	return nil
+}
+
+// Enabled reports whether changed media are purged
+func Enabled() bool {
+	return queue != nil
+}
+
+// Purge queues URLs for purging without waiting for the CDN. URLs are dropped, and the
+// drop logged, when the purge API falls too far behind.
+func Purge(urls ...string) {
+	if queue == nil {
+		return
+	}
+	for _, url := range urls {
+		select {
+		case queue <- url:
+		default:
+			log.Printf("CDN purge queue full, dropping %s", url)
+		}
+	}
+}
+
+// run purges queued URLs, batching those queued meanwhile, and retries each batch a few
+// times
+func run(purger Purger, queue <-chan string) {
+	for url := range queue {
+		batch := []string{url}
+		seen := map[string]bool{url: true}
+	gather:
+		for len(batch) < maxBatch {
+			select {
+			case next := <-queue:
+				if !seen[next] {
+					seen[next] = true
+					batch = append(batch, next)
+				}
+			default:
+				break gather
+			}
+		}
+
+		delay := retryDelay
+		for attempt := 1; ; attempt++ {
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			err := purger.Purge(ctx, batch)
+			cancel()
+			if err == nil {
+				break
+			}
+			if attempt == purgeAttempts {
+				log.Printf("Dropping purge of %d URLs from %s after %d attempts: %v", len(batch), purger.Name(), attempt, err)
+				break
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+// newHTTPClient returns the client purge APIs are called with
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// responseError describes a failed response from a purge API
+func responseError(service string, resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s returned %s: %s", service, resp.Status, message)
+}
@@ -0,0 +1,93 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// cloudflareFilesPerRequest is the most URLs Cloudflare purges in one request on every plan
+const cloudflareFilesPerRequest = 30
+
+// CloudflarePurger purges URLs from a Cloudflare zone. Purges are exact: query string
+// variants of a URL are not purged with it.
+type CloudflarePurger struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// NewCloudflarePurger creates a purger for a zone, authenticating with an API token
+// allowed to purge its cache
+func NewCloudflarePurger(zoneID, token string) (*CloudflarePurger, error) {
+	if zoneID == "" || token == "" {
+		return nil, errors.New("the cloudflare purge provider needs a zone ID and an API token")
+	}
+	return &CloudflarePurger{
+		endpoint: fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/purge_cache", url.PathEscape(zoneID)),
+		token:    token,
+		client:   newHTTPClient(),
+	}, nil
+}
+
+// Name implements Purger
+func (p *CloudflarePurger) Name() string {
+	return "cloudflare"
+}
+
+// Purge implements Purger
+func (p *CloudflarePurger) Purge(ctx context.Context, urls []string) error {
+	for start := 0; start < len(urls); start += cloudflareFilesPerRequest {
+		end := min(start+cloudflareFilesPerRequest, len(urls))
+		if err := p.purgeFiles(ctx, urls[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeFiles purges up to cloudflareFilesPerRequest URLs in one request
+func (p *CloudflarePurger) purgeFiles(ctx context.Context, files []string) error {
+	body, err := json.Marshal(map[string]interface{}{"files": files})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Cloudflare: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("Cloudflare", resp)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to read Cloudflare response: %v", err)
+	}
+	if !result.Success {
+		messages := make([]string, len(result.Errors))
+		for i, e := range result.Errors {
+			messages[i] = e.Message
+		}
+		return fmt.Errorf("Cloudflare refused the purge: %s", strings.Join(messages, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package cdn
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/google/uuid"
+)
+
+// cloudFrontNamespace is the XML namespace of the CloudFront API version used
+const cloudFrontNamespace = "http://cloudfront.amazonaws.com/doc/2020-05-31/"
+
+// CloudFrontPurger creates CloudFront invalidations. CloudFront invalidates paths, so
+// the URLs' hosts are ignored, and every query string variant of a path goes with it.
+type CloudFrontPurger struct {
+	endpoint    string
+	credentials aws.Credentials
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+// invalidationBatch is the body of a CreateInvalidation request
+type invalidationBatch struct {
+	XMLName         xml.Name `xml:"InvalidationBatch"`
+	Namespace       string   `xml:"xmlns,attr"`
+	Quantity        int      `xml:"Paths>Quantity"`
+	Paths           []string `xml:"Paths>Items>Path"`
+	CallerReference string   `xml:"CallerReference"`
+}
+
+// NewCloudFrontPurger creates a purger for a distribution, signing its requests with
+// static credentials
+func NewCloudFrontPurger(distributionID, accessKeyID, secretAccessKey string) (*CloudFrontPurger, error) {
+	if distributionID == "" || accessKeyID == "" || secretAccessKey == "" {
+		return nil, errors.New("the cloudfront purge provider needs a distribution ID and AWS credentials")
+	}
+	return &CloudFrontPurger{
+		endpoint:    fmt.Sprintf("https://cloudfront.amazonaws.com/2020-05-31/distribution/%s/invalidation", url.PathEscape(distributionID)),
+		credentials: aws.Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey},
+		signer:      v4.NewSigner(),
+		client:      newHTTPClient(),
+	}, nil
+}
+
+// Name implements Purger
+func (p *CloudFrontPurger) Name() string {
+	return "cloudfront"
+}
+
+// Purge implements Purger with one invalidation for all URLs
+func (p *CloudFrontPurger) Purge(ctx context.Context, urls []string) error {
+	batch := invalidationBatch{Namespace: cloudFrontNamespace, CallerReference: uuid.NewString()}
+	seen := make(map[string]bool)
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("invalid URL to purge: %s", raw)
+		}
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		if !seen[path] {
+			seen[path] = true
+			batch.Paths = append(batch.Paths, path)
+		}
+	}
+	batch.Quantity = len(batch.Paths)
+
+	body, err := xml.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	sum := sha256.Sum256(body)
+	// CloudFront is a global service signed for us-east-1
+	if err := p.signer.SignHTTP(ctx, p.credentials, req, hex.EncodeToString(sum[:]), "cloudfront", "us-east-1", time.Now()); err != nil {
+		return fmt.Errorf("failed to sign CloudFront request: %v", err)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach CloudFront: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return responseError("CloudFront", resp)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cdn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// fastlyEndpoint is the Fastly API
+const fastlyEndpoint = "https://api.fastly.com"
+
+// FastlyPurger purges single URLs through the Fastly API. Purges are exact: query
+// string variants of a URL are not purged with it.
+type FastlyPurger struct {
+	token  string
+	client *http.Client
+}
+
+// NewFastlyPurger creates a purger authenticating with an API token
+func NewFastlyPurger(token string) (*FastlyPurger, error) {
+	if token == "" {
+		return nil, errors.New("the fastly purge provider needs an API token")
+	}
+	return &FastlyPurger{token: token, client: newHTTPClient()}, nil
+}
+
+// Name implements Purger
+func (p *FastlyPurger) Name() string {
+	return "fastly"
+}
+
+// Purge implements Purger, one request per URL as the API takes them
+func (p *FastlyPurger) Purge(ctx context.Context, urls []string) error {
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid URL to purge: %s", raw)
+		}
+		if err := p.purgeURL(ctx, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeURL purges a single URL
+func (p *FastlyPurger) purgeURL(ctx context.Context, u *url.URL) error {
+	// The purged URL is given without its scheme
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fastlyEndpoint+"/purge/"+u.Host+u.RequestURI(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Fastly-Key", p.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Fastly: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("Fastly", resp)
+	}
+	return nil
+}
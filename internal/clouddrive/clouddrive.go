@@ -0,0 +1,297 @@
+// Package clouddrive reads files from the cloud drives users connect over OAuth, Google
+// Drive, Dropbox and OneDrive, so they can be imported without a local download.
+package clouddrive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-media-center-example/internal/config"
+)
+
+// requestTimeout bounds one call to a drive or OAuth API. Downloads are not bound by it.
+const requestTimeout = 30 * time.Second
+
+// Provider names
+const (
+	GoogleDrive = "google_drive"
+	Dropbox     = "dropbox"
+	OneDrive    = "onedrive"
+)
+
+// ErrNotImportable is returned for drive entries that have no content to download, such as
+// folders and Google Docs
+var ErrNotImportable = errors.New("can't be imported")
+
+// Token is the OAuth token of a connected account
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    *time.Time // nil when the token doesn't expire
+}
+
+// Account identifies a connected account at its provider
+type Account struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// File is an entry of a drive folder
+type File struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Folder     bool       `json:"folder"`
+	Size       int64      `json:"size"`
+	MimeType   string     `json:"mime_type,omitempty"`
+	Path       string     `json:"path,omitempty"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+}
+
+// Provider is a cloud drive reached over OAuth. Its methods may be called from several
+// goroutines at once.
+type Provider interface {
+	// Name identifies the provider in routes and stored connections
+	Name() string
+	// AuthURL is where a user grants access, returning to redirectURI with a code and state
+	AuthURL(state, redirectURI string) string
+	// Exchange trades the code of a completed authorization for a token
+	Exchange(ctx context.Context, code, redirectURI string) (*Token, error)
+	// Refresh obtains a new access token. The refresh token is kept when the provider
+	// doesn't issue a new one.
+	Refresh(ctx context.Context, refreshToken string) (*Token, error)
+	// Account describes the account a token belongs to
+	Account(ctx context.Context, accessToken string) (*Account, error)
+	// List returns a page of a folder, the root when folder is empty, and the cursor of the
+	// next page, empty after the last one
+	List(ctx context.Context, accessToken, folder, cursor string) ([]File, string, error)
+	// File describes a single file, failing with ErrNotImportable for entries without content
+	File(ctx context.Context, accessToken, id string) (*File, error)
+	// DownloadURL is where the content of a file is read with a GET authorized by a bearer token
+	DownloadURL(id string) string
+}
+
+// NewProvider creates the named provider from its OAuth client
+func NewProvider(name string, cfg config.CloudDriveConfig) (Provider, error) {
+	var client config.OAuthClientConfig
+	switch name {
+	case GoogleDrive:
+		client = cfg.Google
+	case Dropbox:
+		client = cfg.Dropbox
+	case OneDrive:
+		client = cfg.OneDrive
+	default:
+		return nil, fmt.Errorf("unknown cloud drive: %s", name)
+	}
+	if client.ClientID == "" || client.ClientSecret == "" {
+		return nil, fmt.Errorf("the %s cloud drive is not configured", name)
+	}
+
+	switch name {
+	case GoogleDrive:
+		return newGoogleDrive(client), nil
+	case Dropbox:
+		return newDropbox(client), nil
+	default:
+		return newOneDrive(client, cfg.OneDriveTenant), nil
+	}
+}
+
+// Configured lists the providers whose OAuth client is set
+func Configured(cfg config.CloudDriveConfig) []string {
+	var names []string
+	for _, name := range []string{GoogleDrive, Dropbox, OneDrive} {
+		if _, err := NewProvider(name, cfg); err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// NewDownloadClient returns a client reading files of a provider. Requests to the host
+// of its download URLs carry a bearer token from token; others, like the pre-authenticated
+// URLs OneDrive redirects to, go out without it.
+func NewDownloadClient(provider Provider, timeout time.Duration, token func(ctx context.Context) (string, error)) *http.Client {
+	host := ""
+	if u, err := url.Parse(provider.DownloadURL("file")); err == nil {
+		host = u.Host
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &bearerTransport{host: host, token: token, base: http.DefaultTransport},
+	}
+}
+
+// bearerTransport authorizes the requests to one host
+type bearerTransport struct {
+	host  string
+	token func(ctx context.Context) (string, error)
+	base  http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host != t.host {
+		return t.base.RoundTrip(req)
+	}
+	token, err := t.token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+// oauthClient holds what the authorization code flow of a provider needs
+type oauthClient struct {
+	clientID     string
+	clientSecret string
+	authURL      string
+	tokenURL     string
+	scope        string
+	authParams   url.Values // Added to the authorization URL, like a request for offline access
+	tokenScope   bool       // The token endpoint wants the scope again
+	client       *http.Client
+}
+
+// AuthURL implements Provider
+func (o *oauthClient) AuthURL(state, redirectURI string) string {
+	query := url.Values{
+		"client_id":     {o.clientID},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"state":         {state},
+	}
+	if o.scope != "" {
+		query.Set("scope", o.scope)
+	}
+	for name, values := range o.authParams {
+		query[name] = values
+	}
+	return o.authURL + "?" + query.Encode()
+}
+
+// Exchange implements Provider
+func (o *oauthClient) Exchange(ctx context.Context, code, redirectURI string) (*Token, error) {
+	return o.requestToken(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {redirectURI},
+	})
+}
+
+// Refresh implements Provider
+func (o *oauthClient) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	if refreshToken == "" {
+		return nil, errors.New("the access token expired and there is no refresh token; connect the account again")
+	}
+	token, err := o.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+// requestToken posts a grant to the token endpoint
+func (o *oauthClient) requestToken(ctx context.Context, form url.Values) (*Token, error) {
+	form.Set("client_id", o.clientID)
+	form.Set("client_secret", o.clientSecret)
+	if o.tokenScope {
+		form.Set("scope", o.scope)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the token endpoint: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("Token endpoint", resp)
+	}
+
+	var granted struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&granted); err != nil {
+		return nil, fmt.Errorf("failed to read token response: %v", err)
+	}
+	if granted.AccessToken == "" {
+		return nil, errors.New("the token endpoint returned no access token")
+	}
+	token := &Token{AccessToken: granted.AccessToken, RefreshToken: granted.RefreshToken}
+	if granted.ExpiresIn > 0 {
+		expires := time.Now().Add(time.Duration(granted.ExpiresIn) * time.Second)
+		token.ExpiresAt = &expires
+	}
+	return token, nil
+}
+
+// callAPI sends an authorized request to a drive API and decodes its JSON answer into out.
+// A nil body sends no content.
+func callAPI(ctx context.Context, client *http.Client, method, endpoint, accessToken string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach the drive: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("Drive", resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to read drive response: %v", err)
+	}
+	return nil
+}
+
+// newHTTPClient returns the client API calls are sent with
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// responseError describes a failed response from a drive or OAuth API
+func responseError(service string, resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s returned %s: %s", service, resp.Status, message)
+}
+
+// parseTime reads an RFC 3339 time of an API answer, nil when missing or malformed
+func parseTime(value string) *time.Time {
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &at
+}
@@ -0,0 +1,140 @@
+package clouddrive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go-media-center-example/internal/config"
+)
+
+const (
+	// dropboxAPI is the base of the Dropbox RPC endpoints
+	dropboxAPI = "https://api.dropboxapi.com/2"
+	// dropboxContentAPI is the base of the Dropbox content endpoints
+	dropboxContentAPI = "https://content.dropboxapi.com/2"
+)
+
+// DropboxProvider reads files from a Dropbox account, addressing them by their stable ID
+// ("id:...") so renames and moves don't break an import
+type DropboxProvider struct {
+	oauthClient
+}
+
+// newDropbox creates a Dropbox provider from the key and secret of its app
+func newDropbox(client config.OAuthClientConfig) *DropboxProvider {
+	return &DropboxProvider{oauthClient{
+		clientID:     client.ClientID,
+		clientSecret: client.ClientSecret,
+		authURL:      "https://www.dropbox.com/oauth2/authorize",
+		tokenURL:     "https://api.dropboxapi.com/oauth2/token",
+		scope:        "account_info.read files.metadata.read files.content.read",
+		// Short-lived access tokens come with a refresh token only for offline access
+		authParams: url.Values{"token_access_type": {"offline"}},
+		client:     newHTTPClient(),
+	}}
+}
+
+// dropboxEntry is a file or folder as the API returns it
+type dropboxEntry struct {
+	Tag            string `json:".tag"`
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	PathDisplay    string `json:"path_display"`
+	Size           int64  `json:"size"`
+	ServerModified string `json:"server_modified"`
+}
+
+// file converts an API entry
+func (e *dropboxEntry) file() File {
+	return File{
+		ID:         e.ID,
+		Name:       e.Name,
+		Folder:     e.Tag == "folder",
+		Size:       e.Size,
+		Path:       e.PathDisplay,
+		ModifiedAt: parseTime(e.ServerModified),
+	}
+}
+
+// Name implements Provider
+func (p *DropboxProvider) Name() string {
+	return Dropbox
+}
+
+// Account implements Provider
+func (p *DropboxProvider) Account(ctx context.Context, accessToken string) (*Account, error) {
+	var account struct {
+		AccountID string `json:"account_id"`
+		Name      struct {
+			DisplayName string `json:"display_name"`
+		} `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := callAPI(ctx, p.client, http.MethodPost, dropboxAPI+"/users/get_current_account", accessToken, nil, &account); err != nil {
+		return nil, err
+	}
+	return &Account{ID: account.AccountID, Name: account.Name.DisplayName, Email: account.Email}, nil
+}
+
+// List implements Provider. Folders are named by ID or path; a cursor continues the
+// listing it came from, whatever the folder.
+func (p *DropboxProvider) List(ctx context.Context, accessToken, folder, cursor string) ([]File, string, error) {
+	endpoint := dropboxAPI + "/files/list_folder"
+	args := map[string]interface{}{"path": folder, "limit": 100}
+	if cursor != "" {
+		endpoint += "/continue"
+		args = map[string]interface{}{"cursor": cursor}
+	}
+	body, err := json.Marshal(args)
+	if err != nil {
+		return nil, "", err
+	}
+	var page struct {
+		Entries []dropboxEntry `json:"entries"`
+		Cursor  string         `json:"cursor"`
+		HasMore bool           `json:"has_more"`
+	}
+	if err := callAPI(ctx, p.client, http.MethodPost, endpoint, accessToken, bytes.NewReader(body), &page); err != nil {
+		return nil, "", err
+	}
+
+	files := make([]File, 0, len(page.Entries))
+	for i := range page.Entries {
+		if page.Entries[i].Tag == "deleted" {
+			continue
+		}
+		files = append(files, page.Entries[i].file())
+	}
+	if !page.HasMore {
+		return files, "", nil
+	}
+	return files, page.Cursor, nil
+}
+
+// File implements Provider
+func (p *DropboxProvider) File(ctx context.Context, accessToken, id string) (*File, error) {
+	body, err := json.Marshal(map[string]string{"path": id})
+	if err != nil {
+		return nil, err
+	}
+	var entry dropboxEntry
+	if err := callAPI(ctx, p.client, http.MethodPost, dropboxAPI+"/files/get_metadata", accessToken, bytes.NewReader(body), &entry); err != nil {
+		return nil, err
+	}
+	file := entry.file()
+	if entry.Tag != "file" {
+		return nil, fmt.Errorf("%s is a folder and %w", file.Name, ErrNotImportable)
+	}
+	return &file, nil
+}
+
+// DownloadURL implements Provider. Content endpoints take their argument as the arg
+// parameter of a GET instead of a header.
+func (p *DropboxProvider) DownloadURL(id string) string {
+	arg, _ := json.Marshal(map[string]string{"path": id})
+	return dropboxContentAPI + "/files/download?arg=" + url.QueryEscape(string(arg))
+}
@@ -0,0 +1,147 @@
+package clouddrive
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go-media-center-example/internal/config"
+)
+
+const (
+	// googleDriveAPI is the base of the Google Drive v3 API
+	googleDriveAPI = "https://www.googleapis.com/drive/v3"
+	// googleFolderType is the MIME type of Google Drive folders
+	googleFolderType = "application/vnd.google-apps.folder"
+	// googleAppsPrefix starts the MIME types of Google Docs, Sheets, Slides and the like,
+	// which have no content to download
+	googleAppsPrefix = "application/vnd.google-apps."
+	// googleFileFields are the fields of a file read from the API
+	googleFileFields = "id,name,mimeType,size,modifiedTime"
+)
+
+// GoogleDriveProvider reads files from Google Drive, including shared drives, with
+// read-only access
+type GoogleDriveProvider struct {
+	oauthClient
+}
+
+// newGoogleDrive creates a Google Drive provider from its OAuth client
+func newGoogleDrive(client config.OAuthClientConfig) *GoogleDriveProvider {
+	return &GoogleDriveProvider{oauthClient{
+		clientID:     client.ClientID,
+		clientSecret: client.ClientSecret,
+		authURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL:     "https://oauth2.googleapis.com/token",
+		scope:        "https://www.googleapis.com/auth/drive.readonly",
+		// A refresh token is only issued for offline access, and again only when consent is asked
+		authParams: url.Values{"access_type": {"offline"}, "prompt": {"consent"}},
+		client:     newHTTPClient(),
+	}}
+}
+
+// googleFile is a file as the API returns it
+type googleFile struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	MimeType     string `json:"mimeType"`
+	Size         int64  `json:"size,string"`
+	ModifiedTime string `json:"modifiedTime"`
+}
+
+// file converts an API file
+func (f *googleFile) file() File {
+	return File{
+		ID:         f.ID,
+		Name:       f.Name,
+		Folder:     f.MimeType == googleFolderType,
+		Size:       f.Size,
+		MimeType:   f.MimeType,
+		ModifiedAt: parseTime(f.ModifiedTime),
+	}
+}
+
+// Name implements Provider
+func (p *GoogleDriveProvider) Name() string {
+	return GoogleDrive
+}
+
+// Account implements Provider
+func (p *GoogleDriveProvider) Account(ctx context.Context, accessToken string) (*Account, error) {
+	var about struct {
+		User struct {
+			PermissionID string `json:"permissionId"`
+			DisplayName  string `json:"displayName"`
+			EmailAddress string `json:"emailAddress"`
+		} `json:"user"`
+	}
+	endpoint := googleDriveAPI + "/about?fields=" + url.QueryEscape("user(permissionId,displayName,emailAddress)")
+	if err := callAPI(ctx, p.client, http.MethodGet, endpoint, accessToken, nil, &about); err != nil {
+		return nil, err
+	}
+	return &Account{ID: about.User.PermissionID, Name: about.User.DisplayName, Email: about.User.EmailAddress}, nil
+}
+
+// List implements Provider. Google Docs, Sheets and Slides are left out.
+func (p *GoogleDriveProvider) List(ctx context.Context, accessToken, folder, cursor string) ([]File, string, error) {
+	if folder == "" {
+		folder = "root"
+	}
+	query := url.Values{
+		"q":                         {fmt.Sprintf("'%s' in parents and trashed = false", escapeQuery(folder))},
+		"fields":                    {"nextPageToken,files(" + googleFileFields + ")"},
+		"orderBy":                   {"folder,name"},
+		"pageSize":                  {"100"},
+		"supportsAllDrives":         {"true"},
+		"includeItemsFromAllDrives": {"true"},
+	}
+	if cursor != "" {
+		query.Set("pageToken", cursor)
+	}
+	var page struct {
+		NextPageToken string       `json:"nextPageToken"`
+		Files         []googleFile `json:"files"`
+	}
+	if err := callAPI(ctx, p.client, http.MethodGet, googleDriveAPI+"/files?"+query.Encode(), accessToken, nil, &page); err != nil {
+		return nil, "", err
+	}
+
+	files := make([]File, 0, len(page.Files))
+	for i := range page.Files {
+		file := page.Files[i].file()
+		if !file.Folder && strings.HasPrefix(file.MimeType, googleAppsPrefix) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return files, page.NextPageToken, nil
+}
+
+// File implements Provider
+func (p *GoogleDriveProvider) File(ctx context.Context, accessToken, id string) (*File, error) {
+	query := url.Values{"fields": {googleFileFields}, "supportsAllDrives": {"true"}}
+	var found googleFile
+	if err := callAPI(ctx, p.client, http.MethodGet, googleDriveAPI+"/files/"+url.PathEscape(id)+"?"+query.Encode(), accessToken, nil, &found); err != nil {
+		return nil, err
+	}
+	file := found.file()
+	if file.Folder {
+		return nil, fmt.Errorf("%s is a folder and %w", file.Name, ErrNotImportable)
+	}
+	if strings.HasPrefix(file.MimeType, googleAppsPrefix) {
+		return nil, fmt.Errorf("%s is a Google Docs file and %w", file.Name, ErrNotImportable)
+	}
+	return &file, nil
+}
+
+// DownloadURL implements Provider
+func (p *GoogleDriveProvider) DownloadURL(id string) string {
+	return googleDriveAPI + "/files/" + url.PathEscape(id) + "?alt=media&supportsAllDrives=true"
+}
+
+// escapeQuery escapes a value quoted in a Drive search query
+func escapeQuery(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
@@ -0,0 +1,149 @@
+package clouddrive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go-media-center-example/internal/config"
+)
+
+const (
+	// graphAPI is the base of the Microsoft Graph API
+	graphAPI = "https://graph.microsoft.com/v1.0"
+	// oneDriveItemFields are the fields of a drive item read from the API
+	oneDriveItemFields = "id,name,size,file,folder,lastModifiedDateTime,parentReference"
+)
+
+// OneDriveProvider reads files from OneDrive, personal or for work and school, through
+// Microsoft Graph
+type OneDriveProvider struct {
+	oauthClient
+}
+
+// newOneDrive creates a OneDrive provider from its OAuth client, registered in a tenant,
+// or "common" for any account
+func newOneDrive(client config.OAuthClientConfig, tenant string) *OneDriveProvider {
+	if tenant == "" {
+		tenant = "common"
+	}
+	base := "https://login.microsoftonline.com/" + url.PathEscape(tenant) + "/oauth2/v2.0"
+	return &OneDriveProvider{oauthClient{
+		clientID:     client.ClientID,
+		clientSecret: client.ClientSecret,
+		authURL:      base + "/authorize",
+		tokenURL:     base + "/token",
+		// offline_access is what grants a refresh token
+		scope:      "offline_access User.Read Files.Read",
+		tokenScope: true,
+		client:     newHTTPClient(),
+	}}
+}
+
+// oneDriveItem is a drive item as the API returns it
+type oneDriveItem struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	File *struct {
+		MimeType string `json:"mimeType"`
+	} `json:"file"`
+	Folder               *struct{} `json:"folder"`
+	LastModifiedDateTime string    `json:"lastModifiedDateTime"`
+	ParentReference      struct {
+		Path string `json:"path"`
+	} `json:"parentReference"`
+}
+
+// file converts an API item
+func (i *oneDriveItem) file() File {
+	file := File{
+		ID:         i.ID,
+		Name:       i.Name,
+		Folder:     i.Folder != nil,
+		Size:       i.Size,
+		ModifiedAt: parseTime(i.LastModifiedDateTime),
+	}
+	if i.File != nil {
+		file.MimeType = i.File.MimeType
+	}
+	// Parent paths look like /drive/root:/Photos
+	if _, parent, found := strings.Cut(i.ParentReference.Path, ":"); found {
+		file.Path = strings.TrimSuffix(parent, "/") + "/" + i.Name
+	}
+	return file
+}
+
+// Name implements Provider
+func (p *OneDriveProvider) Name() string {
+	return OneDrive
+}
+
+// Account implements Provider
+func (p *OneDriveProvider) Account(ctx context.Context, accessToken string) (*Account, error) {
+	var me struct {
+		ID                string `json:"id"`
+		DisplayName       string `json:"displayName"`
+		Mail              string `json:"mail"`
+		UserPrincipalName string `json:"userPrincipalName"`
+	}
+	if err := callAPI(ctx, p.client, http.MethodGet, graphAPI+"/me?$select=id,displayName,mail,userPrincipalName", accessToken, nil, &me); err != nil {
+		return nil, err
+	}
+	email := me.Mail
+	if email == "" {
+		email = me.UserPrincipalName
+	}
+	return &Account{ID: me.ID, Name: me.DisplayName, Email: email}, nil
+}
+
+// List implements Provider. The cursor is the link to the next page Graph returns.
+func (p *OneDriveProvider) List(ctx context.Context, accessToken, folder, cursor string) ([]File, string, error) {
+	endpoint := cursor
+	if endpoint == "" {
+		item := "root"
+		if folder != "" {
+			item = "items/" + url.PathEscape(folder)
+		}
+		endpoint = graphAPI + "/me/drive/" + item + "/children?$top=100&$select=" + oneDriveItemFields
+	} else if !strings.HasPrefix(endpoint, graphAPI+"/") {
+		// The token must never be sent anywhere but Graph
+		return nil, "", errors.New("invalid cursor")
+	}
+
+	var page struct {
+		Value    []oneDriveItem `json:"value"`
+		NextLink string         `json:"@odata.nextLink"`
+	}
+	if err := callAPI(ctx, p.client, http.MethodGet, endpoint, accessToken, nil, &page); err != nil {
+		return nil, "", err
+	}
+	files := make([]File, 0, len(page.Value))
+	for i := range page.Value {
+		files = append(files, page.Value[i].file())
+	}
+	return files, page.NextLink, nil
+}
+
+// File implements Provider
+func (p *OneDriveProvider) File(ctx context.Context, accessToken, id string) (*File, error) {
+	var item oneDriveItem
+	endpoint := graphAPI + "/me/drive/items/" + url.PathEscape(id) + "?$select=" + oneDriveItemFields
+	if err := callAPI(ctx, p.client, http.MethodGet, endpoint, accessToken, nil, &item); err != nil {
+		return nil, err
+	}
+	file := item.file()
+	if item.File == nil {
+		return nil, fmt.Errorf("%s is a folder and %w", file.Name, ErrNotImportable)
+	}
+	return &file, nil
+}
+
+// DownloadURL implements Provider. Graph answers with a redirect to a pre-authenticated
+// URL on another host.
+func (p *OneDriveProvider) DownloadURL(id string) string {
+	return graphAPI + "/me/drive/items/" + url.PathEscape(id) + "/content"
+}
@@ -1,25 +1,83 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"reflect"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
+
+	"go-media-center-example/internal/secrets"
+)
+
+// Executables, scripts and HTML, which a browser would run from the media domain, are
+// refused unless UPLOAD_DENIED_TYPES and UPLOAD_DENIED_EXTENSIONS say otherwise
+const (
+	defaultDeniedTypes      = "application/x-msdownload,application/x-executable,application/x-mach-binary,text/x-shellscript,text/html"
+	defaultDeniedExtensions = ".exe,.dll,.com,.bat,.cmd,.msi,.scr,.ps1,.vbs,.js,.jar,.sh,.apk,.html,.htm"
 )
 
+// defaultCachePolicies let browsers keep media for a day and the CDN for a year, as
+// changed media are purged from it
+const defaultCachePolicies = "image/*=public, max-age=86400, s-maxage=31536000;video/*=public, max-age=86400, s-maxage=31536000;audio/*=public, max-age=86400, s-maxage=31536000;*=public, max-age=3600, s-maxage=86400"
+
+// defaultExposedHeaders are the response headers browser clients need to read: the
+// correlation ID, version and deprecation notices, rate limits and download metadata
+const defaultExposedHeaders = "X-Request-ID,API-Version,Deprecation,Sunset,Link,X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,Retry-After,Content-Disposition,Content-Range,ETag"
+
+// defaultTransformPresets are the presets of ?preset= unless TRANSFORM_PRESETS says otherwise
+const defaultTransformPresets = "thumbnail=150x150,cover,80;social=1200x630,contain,85;avatar=300x300,cover,85;banner=1920x400,cover,90"
+
 var (
-	config *Config
+	config atomic.Pointer[Config]
 	once   sync.Once
+
+	// processEnv holds the variables set before .env was first read, which .env doesn't override
+	processEnv map[string]bool
+	reloadMu   sync.Mutex
+
+	// envErrors collects the variables Load couldn't parse, reported by Validate
+	envErrors []error
+	loadMu    sync.Mutex
+
+	// secretResolver reads the variables of Load referencing a secrets manager, and
+	// loadedSecrets keeps what it read, as several settings share the AWS keys
+	secretResolver *secrets.Resolver
+	loadedSecrets  map[string]string
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Storage  StorageConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	JWT       JWTConfig
+	Storage   StorageConfig
+	Watermark WatermarkConfig
+	DeepZoom  DeepZoomConfig
+	Transform TransformConfig
+	Embed     EmbedConfig
+	Feed      FeedConfig
+	CDN       CDNConfig
+	Proxy     ProxyConfig
+	Tagging   TaggingConfig
+	RateLimit RateLimitConfig
+	Events    EventsConfig
+	API       APIConfig
+	CORS      CORSConfig
+	Compress  CompressionConfig
+	Scheduler SchedulerConfig
+	Export    ExportConfig
+	Access    AccessConfig
+	Workflow  WorkflowConfig
+	Drives    CloudDriveConfig
+
+	invalid []error // Variables that couldn't be parsed, replaced by their defaults
 }
 
 type ServerConfig struct {
@@ -35,19 +93,375 @@ type DatabaseConfig struct {
 	Password string
 	DBName   string
 	SSLMode  string
+
+	// How often DB_USER and DB_PASSWORD are reread from the secrets manager they reference,
+	// for connections opened after the credentials were rotated; 0 reads them once
+	CredentialsRefresh time.Duration
+	userRef            *secrets.Reference
+	passwordRef        *secrets.Reference
+	resolver           *secrets.Resolver
 }
 
 type JWTConfig struct {
-	Secret     string
-	Expiration string
+	Secret     string        // Signs new tokens and signed links
+	KeyID      string        // kid header of new tokens, naming Secret among the verification keys
+	Expiration time.Duration // Lifetime of issued tokens
+	ClockSkew  time.Duration // Leeway of the exp, nbf and iat checks, for hosts whose clocks drift apart
+	Issuer     string        // iss claim of issued tokens, then required of verified ones; empty for none
+	Audience   string        // aud claim of issued tokens, then required of verified ones; empty for none
+	// Earlier secrets still accepted for the tokens they signed, after JWT_SECRET was rotated
+	PreviousKeys []JWTKey
+}
+
+// JWTKey is a token verification key, with the key ID of the tokens it signed
+type JWTKey struct {
+	ID     string // Empty for a key that signed tokens without a kid header
+	Secret string
+}
+
+// VerificationKeys returns the secrets a token with the kid header kid may be signed with:
+// the one of that key ID, or every key, the current one first, for tokens without one
+func (j *JWTConfig) VerificationKeys(kid string) []string {
+	keys := append([]JWTKey{{ID: j.KeyID, Secret: j.Secret}}, j.PreviousKeys...)
+	var candidates []string
+	for _, key := range keys {
+		if kid == "" || key.ID == kid {
+			candidates = append(candidates, key.Secret)
+		}
+	}
+	return candidates
 }
 
 type StorageConfig struct {
 	Path          string
 	MaxUploadSize int64
+	Quota         int64         // Default bytes each user may store; 0 is unlimited
+	ProbeTimeout  time.Duration // Longest ffprobe and ffmpeg may take reading an uploaded video
+	DomainTarget  string        // Hostname custom public domains must be a CNAME of; empty skips the check
 	Provider      string
+	Backends      []string // Additional providers new uploads may be routed to
 	SeaweedFS     SeaweedFSConfig
 	S3            S3Config
+	Cache         StorageCacheConfig
+	HTTP          StorageHTTPConfig
+	Retry         StorageRetryConfig
+	Breaker       StorageBreakerConfig
+	Purge         PurgeConfig
+	Derivatives   DerivativeCacheConfig
+	Offload       OffloadConfig
+	DirectUpload  DirectUploadConfig
+	Widget        WidgetConfig
+	Replication   ReplicationConfig
+	Lifecycle     LifecycleConfig
+	Consistency   ConsistencyConfig
+	FileTypes     FileTypeConfig
+}
+
+// StorageCacheConfig controls the local disk cache of objects served from remote backends
+type StorageCacheConfig struct {
+	Enabled bool
+	Dir     string
+	MaxSize int64
+}
+
+// StorageHTTPConfig tunes the connection pool shared by requests to remote backends. There
+// is no overall request timeout, so large objects can stream for as long as they need.
+type StorageHTTPConfig struct {
+	MaxIdleConns    int           // Idle connections kept open per backend host
+	ConnectTimeout  time.Duration // Time to establish a connection, including TLS
+	ResponseTimeout time.Duration // Time from sending a request to the response headers
+	IdleTimeout     time.Duration // Idle connections are closed after this long
+}
+
+// StorageRetryConfig retries storage operations that failed for a reason that may pass,
+// such as a dropped connection or a 503, waiting exponentially longer between attempts
+type StorageRetryConfig struct {
+	Attempts   int           // Tries per operation, including the first; 1 disables retries
+	Backoff    time.Duration // Wait before the first retry, doubled for each one after it
+	MaxBackoff time.Duration // Upper bound of the wait between attempts
+	Timeout    time.Duration // Limit of each attempt of a delete or byte upload; 0 for none
+}
+
+// StorageBreakerConfig stops sending operations to a backend that keeps failing, so
+// requests fail fast or fall back to the replica until it recovers
+type StorageBreakerConfig struct {
+	Threshold int           // Consecutive failed operations that open the circuit; 0 disables it
+	Cooldown  time.Duration // Time the circuit stays open before a trial operation
+}
+
+// PurgeConfig bounds the background worker that deletes objects in bulk
+type PurgeConfig struct {
+	Workers    int // Concurrent deletions
+	Rate       int // Deletions per second across all workers
+	MaxRetries int // Retries per object before it is reported as failed
+}
+
+// DerivativeCacheConfig limits the transforms and thumbnails kept in storage
+type DerivativeCacheConfig struct {
+	MaxSize int64         // Total bytes before least recently used derivatives are evicted
+	TTL     time.Duration // Derivatives not accessed for this long are evicted
+}
+
+// OffloadConfig makes ServeMediaFile redirect to presigned storage URLs instead of proxying originals
+type OffloadConfig struct {
+	Enabled       bool
+	URLExpiration time.Duration // Lifetime of the presigned URLs redirected to
+	MinSize       int64         // Smaller files are still proxied, saving clients the extra round trip
+}
+
+// DirectUploadConfig controls uploads clients send straight to storage with presigned URLs
+type DirectUploadConfig struct {
+	URLExpiration      time.Duration // Lifetime of the presigned upload URLs
+	MaxSize            int64         // Largest file accepted; 0 applies MaxUploadSize
+	MultipartThreshold int64         // Larger files are uploaded in parts; 0 never splits
+	PartSize           int64         // Preferred size of each part
+	SessionTTL         time.Duration // Unfinished multipart uploads are aborted after this long
+}
+
+// WidgetConfig bounds the tokens upload widgets on other sites upload with
+type WidgetConfig struct {
+	TokenTTL    time.Duration // Lifetime of a token when none is asked for
+	MaxTokenTTL time.Duration // Longest lifetime a token may be given
+}
+
+// ReplicationConfig mirrors objects written to the upload backends onto a replica provider
+type ReplicationConfig struct {
+	Replica           string        // Provider objects are mirrored to; empty disables replication
+	Workers           int           // Concurrent copies
+	MaxRetries        int           // Retries per object before it is left to reconciliation
+	ReconcileInterval time.Duration // How often replicas are checked for missing objects; 0 only on demand
+}
+
+// SchedulerConfig controls the periodic background jobs. Intervals of 0 leave a job to
+// be run on demand only.
+type SchedulerConfig struct {
+	Enabled               bool          // Run jobs on their schedule; off on all but one of several instances
+	OrphanCleanupInterval time.Duration // Aborting expired upload sessions and purging orphaned derivatives
+	CacheEvictionInterval time.Duration // Evicting expired and over-limit derivatives
+}
+
+// ExportConfig controls archives of original files exported by POST /export/zip
+type ExportConfig struct {
+	ArchiveDir string        // Where archives built in the background wait to be downloaded
+	ArchiveTTL time.Duration // How long a background archive stays downloadable
+	MaxItems   int           // Media one archive may hold
+}
+
+// AccessConfig controls the tracking of media views, serves and downloads behind recently
+// viewed media and access counts
+type AccessConfig struct {
+	Tracking bool
+}
+
+// WorkflowConfig controls how the review workflow of media gates public channels
+type WorkflowConfig struct {
+	PublishApprovedOnly bool // Embed links, oEmbed and feeds only show approved media
+}
+
+// CloudDriveConfig holds the OAuth clients of the cloud drives users may connect to import
+// files from. A drive is offered once its client ID and secret are set.
+type CloudDriveConfig struct {
+	Google          OAuthClientConfig
+	Dropbox         OAuthClientConfig
+	OneDrive        OAuthClientConfig
+	OneDriveTenant  string        // Microsoft Entra tenant the OneDrive app is registered in, or "common"
+	RedirectURL     string        // Page of the client application providers send users back to
+	StateExpiration time.Duration // How long a user has to grant access once connecting started
+}
+
+// OAuthClientConfig identifies this application to an OAuth provider
+type OAuthClientConfig struct {
+	ClientID     string
+	ClientSecret string
+}
+
+// LifecycleConfig schedules the worker applying folder lifecycle rules
+type LifecycleConfig struct {
+	Interval time.Duration // How often rules are evaluated; 0 only on demand
+}
+
+// ConsistencyConfig controls the check comparing stored objects with database records
+type ConsistencyConfig struct {
+	Interval    time.Duration // How often the check runs; 0 only on demand
+	GracePeriod time.Duration // Objects younger than this aren't orphans yet, e.g. direct uploads in flight
+	Repair      bool          // Scheduled checks delete orphans and mark records broken
+}
+
+// FileTypeConfig restricts uploads by extension and sniffed content type. Empty allow
+// lists allow everything not denied; type patterns may end in /* to cover a family.
+type FileTypeConfig struct {
+	AllowedTypes      []string
+	DeniedTypes       []string
+	AllowedExtensions []string
+	DeniedExtensions  []string
+}
+
+// WatermarkConfig holds the default watermark applied by watermark=default in transforms
+type WatermarkConfig struct {
+	MediaID  string  // Media used as the default watermark; empty disables watermark=default
+	Position string  // Default position when the request doesn't set one
+	Opacity  float64 // Default opacity (0-1)
+	Scale    float64 // Default watermark width relative to the image (0-1)
+}
+
+// DeepZoomConfig bounds the rendering of tiles for zoomable views of large images
+type DeepZoomConfig struct {
+	MaxPixels  int64 // Larger images are refused, as they are decoded into memory whole
+	Quality    int   // JPEG quality of the tiles
+	MaxRenders int   // Images tiled at the same time
+}
+
+// TransformConfig bounds the image transforms rendered on request
+type TransformConfig struct {
+	Workers   int           // Transforms rendered at the same time
+	Queue     int           // Transforms waiting for a worker; further requests are refused with 503
+	Timeout   time.Duration // Longest a request waits for its transform
+	MaxPixels int64         // Larger source images are refused, as they are decoded into memory whole
+	// Longest ffmpeg may take converting an animated GIF to video
+	VideoTimeout time.Duration
+	// Longest side ?dpr= may scale a requested size up to
+	MaxDPRDimension int
+	// Remove EXIF, ICC and XMP from derivatives unless ?strip=false
+	StripMetadata bool
+	// Named option sets applied by ?preset=
+	Presets map[string]TransformPreset
+}
+
+// TransformPreset is a named set of transform options
+type TransformPreset struct {
+	Width   int
+	Height  int
+	Fit     string
+	Quality int
+}
+
+// EmbedConfig describes the embed pages and oEmbed answers that let shared links unfurl
+type EmbedConfig struct {
+	BaseURL       string        // Public URL of the API, also for feed links; empty to use the host requests are sent to
+	URLExpiration time.Duration // Lifetime of signed embed links
+	ProviderName  string        // Site name shown by unfurled links
+	// How long views and downloads through embed links are kept for their analytics; 0 keeps them
+	AnalyticsRetention time.Duration
+	GeoHeaders         []string // Request headers a CDN or proxy sets to the viewer's country, tried in order
+}
+
+// FeedConfig describes the RSS and Atom feeds of recent uploads
+type FeedConfig struct {
+	URLExpiration time.Duration // Lifetime of signed feed links
+}
+
+// CDNConfig describes the CDN in front of stored media: the hostname media URLs are
+// served from, cache policies by type, and the API purging changed media from its edges
+type CDNConfig struct {
+	Host               string // Hostname of media URLs for accounts without their own domain; empty for the backend's public URL
+	Provider           string // Purge API: empty to disable purges, "cloudfront", "fastly" or "cloudflare"
+	DistributionID     string // CloudFront distribution
+	ZoneID             string // Cloudflare zone
+	APIToken           string // Fastly or Cloudflare API token
+	AWSAccessKeyID     string // CloudFront credentials, shared with S3
+	AWSSecretAccessKey string
+	CacheControl       CachePolicies // Cache-Control of stored objects and served media by MIME type
+	Buffer             int           // URLs queued for purging; further URLs are dropped
+}
+
+// ProxyConfig describes the proxy transforming remote images from allowlisted hosts
+type ProxyConfig struct {
+	AllowedHosts  []string      // Hosts images may be fetched from, "*.example.com" for subdomains; empty disables the proxy
+	MaxSize       int64         // Largest remote image fetched, in bytes
+	Timeout       time.Duration // Time allowed to fetch a remote image
+	URLExpiration time.Duration // Lifetime of signed proxy links
+}
+
+// CachePolicy is the Cache-Control value of MIME types matching Pattern: an exact type,
+// a family like image/*, or * for every type
+type CachePolicy struct {
+	Pattern string
+	Value   string
+}
+
+// CachePolicies are cache policies in order of precedence
+type CachePolicies []CachePolicy
+
+// For returns the Cache-Control value of the first policy matching mimeType, or "" when
+// none does
+func (p CachePolicies) For(mimeType string) string {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.SplitN(mimeType, ";", 2)[0]))
+	for _, policy := range p {
+		family, isFamily := strings.CutSuffix(policy.Pattern, "/*")
+		if policy.Pattern == "*" || policy.Pattern == mimeType || (isFamily && strings.HasPrefix(mimeType, family+"/")) {
+			return policy.Value
+		}
+	}
+	return ""
+}
+
+// TaggingConfig selects the classifier suggesting tags and object labels for new images
+type TaggingConfig struct {
+	Provider           string // Empty to disable, "http" (a model served over HTTP), "vision" or "rekognition"
+	URL                string // Endpoint of the http provider
+	APIKey             string // Cloud Vision API key, or bearer token for the http provider
+	AWSRegion          string // Rekognition region and credentials, shared with S3
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	MinConfidence      float64 // Less certain suggestions are dropped (0-1)
+	MaxLabels          int     // Suggested tags and objects kept per image, each
+	Workers            int     // Images classified at the same time
+	Buffer             int     // Images queued for classification; further uploads are not classified
+}
+
+// RateLimitConfig throttles clients per IP on auth endpoints and per user elsewhere
+type RateLimitConfig struct {
+	Enabled   bool
+	Store     string // "memory" for a single instance, "redis" to share limits between instances
+	Redis     RedisConfig
+	Auth      RateLimitRule // Per client IP on login and registration
+	API       RateLimitRule // Per user on every authenticated endpoint
+	Transform RateLimitRule // Per user on transform endpoints, on top of the API limit
+}
+
+// RateLimitRule allows Requests per Window
+type RateLimitRule struct {
+	Requests int
+	Window   time.Duration
+}
+
+// RedisConfig locates the Redis server backing shared rate limits
+type RedisConfig struct {
+	Addr     string
+	Password string
+	DB       int
+}
+
+// APIConfig controls version negotiation and the deprecation of API versions
+type APIConfig struct {
+	DefaultVersion    string        // Version serving unversioned /api paths
+	V1Sunset          time.Time     // When /api/v1 stops being served; zero while it isn't deprecated
+	IdempotencyKeyTTL time.Duration // How long responses to requests with an Idempotency-Key are replayed
+}
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	AllowedOrigins   []string // "*" allows any origin; entries may wildcard a subdomain, such as https://*.example.com
+	AllowedMethods   []string
+	AllowedHeaders   []string // Request headers a browser may send
+	ExposedHeaders   []string // Response headers scripts may read
+	AllowCredentials bool     // Let browsers send cookies and HTTP auth; needs explicit origins
+	MaxAge           time.Duration
+}
+
+// CompressionConfig controls gzip and deflate encoding of text and JSON responses
+type CompressionConfig struct {
+	Enabled bool
+	Level   int // 1 (fastest) to 9 (smallest); -1 is the library default
+	MinSize int // Smaller bodies are sent as they are
+}
+
+// EventsConfig publishes media lifecycle events to a message broker
+type EventsConfig struct {
+	Broker string // Empty to disable, "nats", "kafka" (through a REST proxy) or "rabbitmq" (through the management API)
+	URL    string
+	Topic  string // NATS subject prefix, Kafka topic or RabbitMQ exchange
+	Buffer int    // Events queued while the broker is slow; further events are dropped
 }
 
 type SeaweedFSConfig struct {
@@ -69,35 +483,74 @@ type S3Config struct {
 	PublicURL       string
 	Endpoint        string
 	ForcePathStyle  bool
+	Encryption      string // Default server-side encryption: AES256 (SSE-S3) or aws:kms (SSE-KMS)
+	KMSKeyID        string // KMS key of SSE-KMS; empty uses the account's default key
+	StorageClass    string // Default storage class, e.g. STANDARD_IA or GLACIER_IR
 }
 
 func Load() (*Config, error) {
+	loadMu.Lock()
+	defer loadMu.Unlock()
+	envErrors = nil
+
+	if processEnv == nil {
+		processEnv = map[string]bool{}
+		for _, variable := range os.Environ() {
+			key, _, _ := strings.Cut(variable, "=")
+			processEnv[key] = true
+		}
+	}
 	if err := godotenv.Load(); err != nil {
 		log.Printf("Warning: .env file not found: %v", err)
 	}
+	credentialsRefresh := getEnvAsDuration("DB_CREDENTIALS_REFRESH", 5*time.Minute)
+	secretResolver = newSecretResolver(credentialsRefresh)
+	loadedSecrets = map[string]string{}
+
+	env := getEnv("ENV", "development")
+
+	// Browsers may call the API from any origin during development; production lists them
+	defaultOrigins := ""
+	if env == "development" {
+		defaultOrigins = "*"
+	}
 
 	config := &Config{
 		Server: ServerConfig{
 			Port:           getEnv("PORT", "8000"),
-			Env:            getEnv("ENV", "development"),
+			Env:            env,
 			TrustedProxies: parseTrustedProxies(getEnv("TRUSTED_PROXIES", "")),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "postgres"),
+			User:     getSecret("DB_USER", "postgres"),
+			Password: getSecret("DB_PASSWORD", "postgres"),
 			DBName:   getEnv("DB_NAME", "media_center"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+			CredentialsRefresh: credentialsRefresh,
+			userRef:            getReference("DB_USER"),
+			passwordRef:        getReference("DB_PASSWORD"),
+			resolver:           secretResolver,
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "your-secret-key"),
-			Expiration: getEnv("JWT_EXPIRATION", "24h"),
+			Secret:       getSecret("JWT_SECRET", defaultJWTSecret),
+			KeyID:        getEnv("JWT_KEY_ID", ""),
+			Expiration:   getEnvAsDuration("JWT_EXPIRATION", 24*time.Hour),
+			ClockSkew:    getEnvAsDuration("JWT_CLOCK_SKEW", time.Minute),
+			Issuer:       getEnv("JWT_ISSUER", ""),
+			Audience:     getEnv("JWT_AUDIENCE", ""),
+			PreviousKeys: parseJWTKeys(getSecret("JWT_PREVIOUS_KEYS", "")),
 		},
 		Storage: StorageConfig{
 			Path:          getEnv("STORAGE_PATH", "./storage/media"),
 			MaxUploadSize: int64(getEnvAsInt("MAX_UPLOAD_SIZE", 10485760)),
+			Quota:         int64(getEnvAsInt("STORAGE_QUOTA", 0)),
+			ProbeTimeout:  getEnvAsDuration("UPLOAD_PROBE_TIMEOUT", 30*time.Second),
+			DomainTarget:  getEnv("STORAGE_DOMAIN_TARGET", ""),
 			Provider:      getEnv("STORAGE_PROVIDER", "seaweedfs"),
+			Backends:      parseList(getEnv("STORAGE_BACKENDS", "")),
 			SeaweedFS: SeaweedFSConfig{
 				MasterURL:  getEnv("SEAWEEDFS_MASTER_URL", "http://localhost:9333"),
 				Container:  getEnv("SEAWEED_CONTAINER", "media-center-seaweedfs"),
@@ -110,22 +563,260 @@ func Load() (*Config, error) {
 			},
 			S3: S3Config{
 				Region:          getEnv("AWS_REGION", "us-east-1"),
-				AccessKeyID:     getEnv("AWS_ACCESS_KEY_ID", ""),
-				SecretAccessKey: getEnv("AWS_SECRET_ACCESS_KEY", ""),
+				AccessKeyID:     getSecret("AWS_ACCESS_KEY_ID", ""),
+				SecretAccessKey: getSecret("AWS_SECRET_ACCESS_KEY", ""),
 				BucketName:      getEnv("AWS_BUCKET_NAME", ""),
 				PublicURL:       getEnv("AWS_PUBLIC_URL", ""),
 				Endpoint:        getEnv("AWS_ENDPOINT", ""),
 				ForcePathStyle:  getEnvAsBool("AWS_FORCE_PATH_STYLE", false),
+				Encryption:      getEnv("AWS_SERVER_SIDE_ENCRYPTION", ""),
+				KMSKeyID:        getEnv("AWS_SSE_KMS_KEY_ID", ""),
+				StorageClass:    getEnv("AWS_STORAGE_CLASS", ""),
+			},
+			Cache: StorageCacheConfig{
+				Enabled: getEnvAsBool("STORAGE_CACHE_ENABLED", false),
+				Dir:     getEnv("STORAGE_CACHE_DIR", "./storage/cache"),
+				MaxSize: int64(getEnvAsInt("STORAGE_CACHE_MAX_SIZE", 1073741824)),
+			},
+			HTTP: StorageHTTPConfig{
+				MaxIdleConns:    getEnvAsInt("STORAGE_HTTP_MAX_IDLE_CONNS", 64),
+				ConnectTimeout:  getEnvAsDuration("STORAGE_HTTP_CONNECT_TIMEOUT", 5*time.Second),
+				ResponseTimeout: getEnvAsDuration("STORAGE_HTTP_RESPONSE_TIMEOUT", 30*time.Second),
+				IdleTimeout:     getEnvAsDuration("STORAGE_HTTP_IDLE_TIMEOUT", 90*time.Second),
+			},
+			Retry: StorageRetryConfig{
+				Attempts:   getEnvAsInt("STORAGE_RETRY_ATTEMPTS", 3),
+				Backoff:    getEnvAsDuration("STORAGE_RETRY_BACKOFF", 100*time.Millisecond),
+				MaxBackoff: getEnvAsDuration("STORAGE_RETRY_MAX_BACKOFF", 2*time.Second),
+				Timeout:    getEnvAsDuration("STORAGE_OPERATION_TIMEOUT", time.Minute),
+			},
+			Breaker: StorageBreakerConfig{
+				Threshold: getEnvAsInt("STORAGE_BREAKER_THRESHOLD", 5),
+				Cooldown:  getEnvAsDuration("STORAGE_BREAKER_COOLDOWN", 30*time.Second),
+			},
+			Purge: PurgeConfig{
+				Workers:    getEnvAsInt("PURGE_WORKERS", 8),
+				Rate:       getEnvAsInt("PURGE_RATE", 50),
+				MaxRetries: getEnvAsInt("PURGE_MAX_RETRIES", 3),
+			},
+			Derivatives: DerivativeCacheConfig{
+				MaxSize: int64(getEnvAsInt("DERIVATIVE_CACHE_MAX_SIZE", 5368709120)),
+				TTL:     getEnvAsDuration("DERIVATIVE_CACHE_TTL", 30*24*time.Hour),
+			},
+			Offload: OffloadConfig{
+				Enabled:       getEnvAsBool("STORAGE_OFFLOAD_ENABLED", false),
+				URLExpiration: getEnvAsDuration("STORAGE_OFFLOAD_URL_EXPIRATION", 5*time.Minute),
+				MinSize:       int64(getEnvAsInt("STORAGE_OFFLOAD_MIN_SIZE", 0)),
 			},
+			DirectUpload: DirectUploadConfig{
+				URLExpiration:      getEnvAsDuration("STORAGE_DIRECT_UPLOAD_URL_EXPIRATION", time.Hour),
+				MaxSize:            int64(getEnvAsInt("STORAGE_DIRECT_UPLOAD_MAX_SIZE", 0)),
+				MultipartThreshold: int64(getEnvAsInt("STORAGE_DIRECT_UPLOAD_MULTIPART_THRESHOLD", 104857600)),
+				PartSize:           int64(getEnvAsInt("STORAGE_DIRECT_UPLOAD_PART_SIZE", 16777216)),
+				SessionTTL:         getEnvAsDuration("STORAGE_DIRECT_UPLOAD_SESSION_TTL", 24*time.Hour),
+			},
+			Widget: WidgetConfig{
+				TokenTTL:    getEnvAsDuration("WIDGET_TOKEN_TTL", time.Hour),
+				MaxTokenTTL: getEnvAsDuration("WIDGET_TOKEN_MAX_TTL", 24*time.Hour),
+			},
+			Replication: ReplicationConfig{
+				Replica:           getEnv("STORAGE_REPLICA", ""),
+				Workers:           getEnvAsInt("STORAGE_REPLICATION_WORKERS", 2),
+				MaxRetries:        getEnvAsInt("STORAGE_REPLICATION_MAX_RETRIES", 3),
+				ReconcileInterval: getEnvAsDuration("STORAGE_RECONCILE_INTERVAL", 24*time.Hour),
+			},
+			Lifecycle: LifecycleConfig{
+				Interval: getEnvAsDuration("LIFECYCLE_INTERVAL", time.Hour),
+			},
+			Consistency: ConsistencyConfig{
+				Interval:    getEnvAsDuration("CONSISTENCY_CHECK_INTERVAL", 24*time.Hour),
+				GracePeriod: getEnvAsDuration("CONSISTENCY_GRACE_PERIOD", 24*time.Hour),
+				Repair:      getEnvAsBool("CONSISTENCY_REPAIR", false),
+			},
+			FileTypes: FileTypeConfig{
+				AllowedTypes:      parseList(getEnv("UPLOAD_ALLOWED_TYPES", "")),
+				DeniedTypes:       parseList(getEnv("UPLOAD_DENIED_TYPES", defaultDeniedTypes)),
+				AllowedExtensions: parseList(getEnv("UPLOAD_ALLOWED_EXTENSIONS", "")),
+				DeniedExtensions:  parseList(getEnv("UPLOAD_DENIED_EXTENSIONS", defaultDeniedExtensions)),
+			},
+		},
+		Watermark: WatermarkConfig{
+			MediaID:  getEnv("WATERMARK_MEDIA_ID", ""),
+			Position: getEnv("WATERMARK_POSITION", "bottom-right"),
+			Opacity:  getEnvAsFloat("WATERMARK_OPACITY", 0.5),
+			Scale:    getEnvAsFloat("WATERMARK_SCALE", 0.2),
+		},
+		Tagging: TaggingConfig{
+			Provider:           getEnv("AUTOTAG_PROVIDER", ""),
+			URL:                getEnv("AUTOTAG_URL", ""),
+			APIKey:             getEnv("AUTOTAG_API_KEY", ""),
+			AWSRegion:          getEnv("AWS_REGION", "us-east-1"),
+			AWSAccessKeyID:     getSecret("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretAccessKey: getSecret("AWS_SECRET_ACCESS_KEY", ""),
+			MinConfidence:      getEnvAsFloat("AUTOTAG_MIN_CONFIDENCE", 0.7),
+			MaxLabels:          getEnvAsInt("AUTOTAG_MAX_LABELS", 10),
+			Workers:            getEnvAsInt("AUTOTAG_WORKERS", 2),
+			Buffer:             getEnvAsInt("AUTOTAG_BUFFER", 1000),
+		},
+		DeepZoom: DeepZoomConfig{
+			MaxPixels:  int64(getEnvAsInt("DEEP_ZOOM_MAX_PIXELS", 250000000)),
+			Quality:    getEnvAsInt("DEEP_ZOOM_QUALITY", 85),
+			MaxRenders: getEnvAsInt("DEEP_ZOOM_MAX_RENDERS", 2),
+		},
+		Transform: TransformConfig{
+			Workers:         getEnvAsInt("TRANSFORM_WORKERS", runtime.NumCPU()),
+			Queue:           getEnvAsInt("TRANSFORM_QUEUE", 64),
+			Timeout:         getEnvAsDuration("TRANSFORM_TIMEOUT", 30*time.Second),
+			MaxPixels:       int64(getEnvAsInt("TRANSFORM_MAX_PIXELS", 100000000)),
+			VideoTimeout:    getEnvAsDuration("TRANSFORM_VIDEO_TIMEOUT", 2*time.Minute),
+			MaxDPRDimension: getEnvAsInt("TRANSFORM_DPR_MAX_DIMENSION", 4096),
+			StripMetadata:   getEnvAsBool("TRANSFORM_STRIP_METADATA", true),
+			Presets:         parseTransformPresets(getEnv("TRANSFORM_PRESETS", defaultTransformPresets)),
+		},
+		Embed: EmbedConfig{
+			BaseURL:            getEnv("EMBED_BASE_URL", ""),
+			URLExpiration:      getEnvAsDuration("EMBED_URL_EXPIRATION", 365*24*time.Hour),
+			ProviderName:       getEnv("EMBED_PROVIDER_NAME", "Media Center"),
+			AnalyticsRetention: getEnvAsDuration("EMBED_ANALYTICS_RETENTION", 90*24*time.Hour),
+			GeoHeaders:         parseList(getEnv("EMBED_GEO_HEADERS", "CF-IPCountry,CloudFront-Viewer-Country,X-Country-Code")),
+		},
+		Feed: FeedConfig{
+			URLExpiration: getEnvAsDuration("FEED_URL_EXPIRATION", 365*24*time.Hour),
+		},
+		CDN: CDNConfig{
+			Host:               getEnv("CDN_HOST", ""),
+			Provider:           getEnv("CDN_PURGE_PROVIDER", ""),
+			DistributionID:     getEnv("CDN_DISTRIBUTION_ID", ""),
+			ZoneID:             getEnv("CDN_ZONE_ID", ""),
+			APIToken:           getEnv("CDN_API_TOKEN", ""),
+			AWSAccessKeyID:     getSecret("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretAccessKey: getSecret("AWS_SECRET_ACCESS_KEY", ""),
+			CacheControl:       parseCachePolicies(getEnv("CDN_CACHE_CONTROL", defaultCachePolicies)),
+			Buffer:             getEnvAsInt("CDN_PURGE_BUFFER", 10000),
+		},
+		Proxy: ProxyConfig{
+			AllowedHosts:  parseList(strings.ToLower(getEnv("IMAGE_PROXY_ALLOWED_HOSTS", ""))),
+			MaxSize:       int64(getEnvAsInt("IMAGE_PROXY_MAX_SIZE", 20*1024*1024)),
+			Timeout:       getEnvAsDuration("IMAGE_PROXY_TIMEOUT", 15*time.Second),
+			URLExpiration: getEnvAsDuration("IMAGE_PROXY_URL_EXPIRATION", 365*24*time.Hour),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: getEnvAsBool("RATE_LIMIT_ENABLED", true),
+			Store:   getEnv("RATE_LIMIT_STORE", "memory"),
+			Redis: RedisConfig{
+				Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
+				Password: getEnv("REDIS_PASSWORD", ""),
+				DB:       getEnvAsInt("REDIS_DB", 0),
+			},
+			Auth: RateLimitRule{
+				Requests: getEnvAsInt("RATE_LIMIT_AUTH", 10),
+				Window:   getEnvAsDuration("RATE_LIMIT_AUTH_WINDOW", time.Minute),
+			},
+			API: RateLimitRule{
+				Requests: getEnvAsInt("RATE_LIMIT_API", 600),
+				Window:   getEnvAsDuration("RATE_LIMIT_API_WINDOW", time.Minute),
+			},
+			Transform: RateLimitRule{
+				Requests: getEnvAsInt("RATE_LIMIT_TRANSFORM", 60),
+				Window:   getEnvAsDuration("RATE_LIMIT_TRANSFORM_WINDOW", time.Minute),
+			},
+		},
+		API: APIConfig{
+			DefaultVersion:    getEnv("API_DEFAULT_VERSION", "v1"),
+			V1Sunset:          getEnvAsDate("API_V1_SUNSET"),
+			IdempotencyKeyTTL: getEnvAsDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   parseList(getEnv("CORS_ALLOWED_ORIGINS", defaultOrigins)),
+			AllowedMethods:   parseList(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,PATCH,DELETE,OPTIONS")),
+			AllowedHeaders:   parseList(getEnv("CORS_ALLOWED_HEADERS", "Authorization,Content-Type,Accept,API-Version,X-Request-ID,Range")),
+			ExposedHeaders:   parseList(getEnv("CORS_EXPOSED_HEADERS", defaultExposedHeaders)),
+			AllowCredentials: getEnvAsBool("CORS_ALLOW_CREDENTIALS", false),
+			MaxAge:           getEnvAsDuration("CORS_MAX_AGE", 12*time.Hour),
+		},
+		Compress: CompressionConfig{
+			Enabled: getEnvAsBool("COMPRESSION_ENABLED", true),
+			Level:   getEnvAsInt("COMPRESSION_LEVEL", -1),
+			MinSize: getEnvAsInt("COMPRESSION_MIN_SIZE", 1024),
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:               getEnvAsBool("SCHEDULER_ENABLED", true),
+			OrphanCleanupInterval: getEnvAsDuration("ORPHAN_CLEANUP_INTERVAL", 15*time.Minute),
+			CacheEvictionInterval: getEnvAsDuration("CACHE_EVICTION_INTERVAL", 15*time.Minute),
+		},
+		Export: ExportConfig{
+			ArchiveDir: getEnv("EXPORT_ARCHIVE_DIR", "./storage/exports"),
+			ArchiveTTL: getEnvAsDuration("EXPORT_ARCHIVE_TTL", 24*time.Hour),
+			MaxItems:   getEnvAsInt("EXPORT_MAX_ITEMS", 10000),
+		},
+		Access: AccessConfig{
+			Tracking: getEnvAsBool("ACCESS_TRACKING_ENABLED", true),
+		},
+		Workflow: WorkflowConfig{
+			PublishApprovedOnly: getEnvAsBool("WORKFLOW_PUBLISH_APPROVED_ONLY", false),
+		},
+		Drives: CloudDriveConfig{
+			Google: OAuthClientConfig{
+				ClientID:     getEnv("GOOGLE_DRIVE_CLIENT_ID", ""),
+				ClientSecret: getSecret("GOOGLE_DRIVE_CLIENT_SECRET", ""),
+			},
+			Dropbox: OAuthClientConfig{
+				ClientID:     getEnv("DROPBOX_APP_KEY", ""),
+				ClientSecret: getSecret("DROPBOX_APP_SECRET", ""),
+			},
+			OneDrive: OAuthClientConfig{
+				ClientID:     getEnv("ONEDRIVE_CLIENT_ID", ""),
+				ClientSecret: getSecret("ONEDRIVE_CLIENT_SECRET", ""),
+			},
+			OneDriveTenant:  getEnv("ONEDRIVE_TENANT", "common"),
+			RedirectURL:     getEnv("CLOUD_DRIVE_REDIRECT_URL", ""),
+			StateExpiration: getEnvAsDuration("CLOUD_DRIVE_CONNECT_EXPIRATION", 10*time.Minute),
+		},
+		Events: EventsConfig{
+			Broker: getEnv("EVENTS_BROKER", ""),
+			URL:    getEnv("EVENTS_BROKER_URL", ""),
+			Topic:  getEnv("EVENTS_TOPIC", "media-center"),
+			Buffer: getEnvAsInt("EVENTS_BUFFER", 1000),
 		},
 	}
+	config.invalid = envErrors
 
 	return config, nil
 }
 
 func (d *DatabaseConfig) DSN() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		d.Host, d.Port, d.User, d.Password, d.DBName, d.SSLMode)
+		dsnValue(d.Host), dsnValue(d.Port), dsnValue(d.User), dsnValue(d.Password), dsnValue(d.DBName), dsnValue(d.SSLMode))
+}
+
+// dsnValue quotes a value of a key=value connection string, as generated passwords may
+// hold spaces, quotes and backslashes
+func dsnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// RotatesCredentials reports whether DB_USER or DB_PASSWORD reference a secrets manager
+// and are reread for new connections
+func (d *DatabaseConfig) RotatesCredentials() bool {
+	return d.CredentialsRefresh > 0 && (d.userRef != nil || d.passwordRef != nil)
+}
+
+// Credentials returns the user and password new connections log in with, rereading those
+// referencing a secrets manager once CredentialsRefresh passed, so credentials rotated
+// there are picked up without a restart
+func (d *DatabaseConfig) Credentials(ctx context.Context) (user, password string, err error) {
+	user, password = d.User, d.Password
+	if d.userRef != nil {
+		if user, err = d.resolver.Resolve(ctx, *d.userRef); err != nil {
+			return "", "", fmt.Errorf("failed to read DB_USER from %s: %w", d.userRef, err)
+		}
+	}
+	if d.passwordRef != nil {
+		if password, err = d.resolver.Resolve(ctx, *d.passwordRef); err != nil {
+			return "", "", fmt.Errorf("failed to read DB_PASSWORD from %s: %w", d.passwordRef, err)
+		}
+	}
+	return user, password, nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -135,32 +826,204 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getSecret is getEnv for credentials, which may also reference a secrets manager, such
+// as vault:secret/data/media-center#db_password
+func getSecret(key, defaultValue string) string {
+	value := getEnv(key, defaultValue)
+	ref, ok := secrets.ParseReference(value)
+	if !ok {
+		return value
+	}
+	if secret, read := loadedSecrets[key]; read {
+		return secret
+	}
+	secret, err := secretResolver.Resolve(context.Background(), ref)
+	if err != nil {
+		envErrors = append(envErrors, fmt.Errorf("%s=%s couldn't be read: %v", key, ref, err))
+	}
+	loadedSecrets[key] = secret
+	return secret
+}
+
+// getReference returns the secret reference key holds, or nil for a plain value
+func getReference(key string) *secrets.Reference {
+	if ref, ok := secrets.ParseReference(os.Getenv(key)); ok {
+		return &ref
+	}
+	return nil
+}
+
+// newSecretResolver sets up the secrets managers references may point at. Vault needs
+// VAULT_ADDR and VAULT_TOKEN. Secrets Manager and Parameter Store are reached with
+// SECRETS_AWS_ACCESS_KEY_ID and SECRETS_AWS_SECRET_ACCESS_KEY, the AWS keys when they
+// aren't references themselves, or the role of the ECS task or EC2 instance.
+func newSecretResolver(maxAge time.Duration) *secrets.Resolver {
+	providers := map[string]secrets.Provider{}
+	if vault, err := secrets.NewVault(getEnv("VAULT_ADDR", ""), getEnv("VAULT_TOKEN", ""), getEnv("VAULT_NAMESPACE", "")); err == nil {
+		providers["vault"] = vault
+	}
+
+	accessKeyID, secretAccessKey := getEnv("SECRETS_AWS_ACCESS_KEY_ID", ""), getEnv("SECRETS_AWS_SECRET_ACCESS_KEY", "")
+	if accessKeyID == "" && secretAccessKey == "" {
+		accessKeyID, secretAccessKey = getEnv("AWS_ACCESS_KEY_ID", ""), getEnv("AWS_SECRET_ACCESS_KEY", "")
+		if getReference("AWS_ACCESS_KEY_ID") != nil || getReference("AWS_SECRET_ACCESS_KEY") != nil {
+			accessKeyID, secretAccessKey = "", ""
+		}
+	}
+	creds := secrets.AWSCredentials(accessKeyID, secretAccessKey)
+	region := getEnv("SECRETS_AWS_REGION", getEnv("AWS_REGION", "us-east-1"))
+	if manager, err := secrets.NewSecretsManager(region, creds); err == nil {
+		providers["awssm"] = manager
+	}
+	if store, err := secrets.NewParameterStore(region, creds); err == nil {
+		providers["ssm"] = store
+	}
+	return secrets.NewResolver(providers, maxAge)
+}
+
 func getEnvAsInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
+	if value, exists := os.LookupEnv(key); exists && value != "" {
 		var intVal int
 		if _, err := fmt.Sscanf(value, "%d", &intVal); err == nil {
 			return intVal
 		}
+		envErrors = append(envErrors, fmt.Errorf("%s=%q is not a whole number", key, value))
+	}
+	return defaultValue
+}
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value, exists := os.LookupEnv(key); exists && value != "" {
+		var floatVal float64
+		if _, err := fmt.Sscanf(value, "%g", &floatVal); err == nil {
+			return floatVal
+		}
+		envErrors = append(envErrors, fmt.Errorf("%s=%q is not a number", key, value))
+	}
+	return defaultValue
+}
+
+// getEnvAsDuration parses a Go duration such as 90s or 12h, or a whole number of days such as 7d
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value, exists := os.LookupEnv(key); exists && value != "" {
+		if days, ok := strings.CutSuffix(value, "d"); ok {
+			var n int
+			if _, err := fmt.Sscanf(days, "%d", &n); err == nil && fmt.Sprint(n) == days {
+				return time.Duration(n) * 24 * time.Hour
+			}
+		}
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+		envErrors = append(envErrors, fmt.Errorf("%s=%q is not a duration: use a number with a unit, such as 30s, 15m, 24h or 7d", key, value))
 	}
 	return defaultValue
 }
 
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value, exists := os.LookupEnv(key); exists {
-		return value == "true" || value == "1" || value == "yes"
+		switch value {
+		case "true", "1", "yes":
+			return true
+		case "false", "0", "no", "":
+			return false
+		}
+		envErrors = append(envErrors, fmt.Errorf("%s=%q is not a boolean: use true or false", key, value))
+		return false
 	}
 	return defaultValue
 }
 
+// getEnvAsDate parses a YYYY-MM-DD or RFC 3339 date, returning the zero time when unset or invalid
+func getEnvAsDate(key string) time.Time {
+	value, exists := os.LookupEnv(key)
+	if !exists || value == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date
+		}
+	}
+	envErrors = append(envErrors, fmt.Errorf("%s=%q is not a date: use YYYY-MM-DD", key, value))
+	return time.Time{}
+}
+
 func GetConfig() *Config {
 	once.Do(func() {
-		var err error
-		config, err = Load()
+		loaded, err := Load()
 		if err != nil {
 			panic(fmt.Sprintf("Failed to load configuration: %v", err))
 		}
+		config.Store(loaded)
 	})
-	return config
+	return config.Load()
+}
+
+// reloadable are the settings Reload applies while the server runs, by the variables
+// setting them. Everything else is read once at startup.
+var reloadable = []struct {
+	name  string
+	field func(c *Config) interface{}
+}{
+	{"RATE_LIMIT_ENABLED", func(c *Config) interface{} { return &c.RateLimit.Enabled }},
+	{"RATE_LIMIT_AUTH", func(c *Config) interface{} { return &c.RateLimit.Auth }},
+	{"RATE_LIMIT_API", func(c *Config) interface{} { return &c.RateLimit.API }},
+	{"RATE_LIMIT_TRANSFORM", func(c *Config) interface{} { return &c.RateLimit.Transform }},
+	{"TRANSFORM_PRESETS", func(c *Config) interface{} { return &c.Transform.Presets }},
+	{"MAX_UPLOAD_SIZE", func(c *Config) interface{} { return &c.Storage.MaxUploadSize }},
+	{"UPLOAD_ALLOWED_TYPES", func(c *Config) interface{} { return &c.Storage.FileTypes.AllowedTypes }},
+	{"UPLOAD_DENIED_TYPES", func(c *Config) interface{} { return &c.Storage.FileTypes.DeniedTypes }},
+	{"UPLOAD_ALLOWED_EXTENSIONS", func(c *Config) interface{} { return &c.Storage.FileTypes.AllowedExtensions }},
+	{"UPLOAD_DENIED_EXTENSIONS", func(c *Config) interface{} { return &c.Storage.FileTypes.DeniedExtensions }},
+	{"IMAGE_PROXY_ALLOWED_HOSTS", func(c *Config) interface{} { return &c.Proxy.AllowedHosts }},
+	{"CORS_ALLOWED_ORIGINS", func(c *Config) interface{} { return &c.CORS.AllowedOrigins }},
+}
+
+// Reload re-reads the environment and .env and applies the reloadable settings to the
+// configuration returned by GetConfig, returning the variables whose values changed.
+// Variables set in the process environment still take precedence over .env.
+func Reload() ([]string, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	current := GetConfig()
+	if values, err := godotenv.Read(); err == nil {
+		// Variables removed from .env fall back to their defaults
+		for _, variable := range os.Environ() {
+			key, _, _ := strings.Cut(variable, "=")
+			if _, ok := values[key]; !ok && !processEnv[key] {
+				os.Unsetenv(key)
+			}
+		}
+		for key, value := range values {
+			if !processEnv[key] {
+				os.Setenv(key, value)
+			}
+		}
+	}
+	fresh, err := Load()
+	if err != nil {
+		return nil, err
+	}
+	if err := fresh.Validate(); err != nil {
+		return nil, err
+	}
+
+	next := *current
+	changed := []string{}
+	for _, setting := range reloadable {
+		to := reflect.ValueOf(setting.field(&next)).Elem()
+		from := reflect.ValueOf(setting.field(fresh)).Elem()
+		if !reflect.DeepEqual(to.Interface(), from.Interface()) {
+			to.Set(from)
+			changed = append(changed, setting.name)
+		}
+	}
+	if len(changed) > 0 {
+		config.Store(&next)
+	}
+	return changed, nil
 }
 
 // IsProduction returns true if the environment is production
@@ -180,3 +1043,77 @@ func parseTrustedProxies(proxies string) []string {
 	}
 	return strings.Split(proxies, ",")
 }
+
+// parseList splits a comma-separated list, trimming whitespace and dropping empty items
+func parseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseCachePolicies parses semicolon-separated pattern=Cache-Control pairs, such as
+// "image/*=public, max-age=86400;*=no-cache"
+func parseCachePolicies(value string) CachePolicies {
+	var policies CachePolicies
+	for _, item := range strings.Split(value, ";") {
+		pattern, cacheControl, ok := strings.Cut(item, "=")
+		pattern, cacheControl = strings.ToLower(strings.TrimSpace(pattern)), strings.TrimSpace(cacheControl)
+		if !ok || pattern == "" || cacheControl == "" {
+			if strings.TrimSpace(item) != "" {
+				log.Printf("Warning: ignoring cache policy %q, not pattern=value", item)
+			}
+			continue
+		}
+		policies = append(policies, CachePolicy{Pattern: pattern, Value: cacheControl})
+	}
+	return policies
+}
+
+// parseJWTKeys parses comma-separated kid=secret pairs, such as "2025=abc,2024=def". A
+// pair with an empty key ID, "=secret", verifies tokens without a kid header.
+func parseJWTKeys(value string) []JWTKey {
+	var keys []JWTKey
+	for _, item := range parseList(value) {
+		id, secret, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(secret) == "" {
+			log.Printf("Warning: ignoring a JWT_PREVIOUS_KEYS entry, not kid=secret")
+			continue
+		}
+		keys = append(keys, JWTKey{ID: strings.TrimSpace(id), Secret: strings.TrimSpace(secret)})
+	}
+	return keys
+}
+
+// parseTransformPresets parses semicolon-separated name=WIDTHxHEIGHT,fit,quality presets,
+// such as "thumbnail=150x150,cover,80;hero=1600x0,contain,85"
+func parseTransformPresets(value string) map[string]TransformPreset {
+	presets := map[string]TransformPreset{}
+	for _, item := range strings.Split(value, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		name, spec, _ := strings.Cut(item, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		var preset TransformPreset
+		parts := strings.Split(spec, ",")
+		if len(parts) != 3 || name == "" {
+			log.Printf("Warning: ignoring transform preset %q, not name=WIDTHxHEIGHT,fit,quality", item)
+			continue
+		}
+		if _, err := fmt.Sscanf(strings.TrimSpace(parts[0]), "%dx%d", &preset.Width, &preset.Height); err != nil {
+			log.Printf("Warning: ignoring transform preset %q, size is not WIDTHxHEIGHT", item)
+			continue
+		}
+		if _, err := fmt.Sscanf(strings.TrimSpace(parts[2]), "%d", &preset.Quality); err != nil {
+			log.Printf("Warning: ignoring transform preset %q, quality is not a number", item)
+			continue
+		}
+		preset.Fit = strings.TrimSpace(parts[1])
+		presets[name] = preset
+	}
+	return presets
+}
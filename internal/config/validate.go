@@ -0,0 +1,161 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// storageProviders are the values STORAGE_PROVIDER, STORAGE_BACKENDS and STORAGE_REPLICA
+// may name
+var storageProviders = []string{"seaweedfs", "s3"}
+
+// minJWTSecretLength is the shortest JWT_SECRET accepted in production: 32 bytes, as HS256
+// signs with a 256-bit key
+const minJWTSecretLength = 32
+
+// defaultJWTSecret is the JWT_SECRET used when none is set, and the one in .env.example
+const defaultJWTSecret = "your-secret-key"
+
+// Validate checks the configuration for values the server can't run with, so they stop
+// startup instead of failing requests later. Every problem is reported at once, each
+// naming the variable to fix. A weak JWT_SECRET is only an error in production; in
+// other environments it is logged as a warning.
+func (c *Config) Validate() error {
+	problems := slices.Clone(c.invalid)
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if !validPort(c.Server.Port) {
+		problem("PORT=%q is not a port: use a number from 1 to 65535, such as 8000", c.Server.Port)
+	}
+	if c.Database.Host == "" {
+		problem("DB_HOST is empty: set it to the PostgreSQL server's hostname")
+	}
+	if !validPort(c.Database.Port) {
+		problem("DB_PORT=%q is not a port: use a number from 1 to 65535, such as 5432", c.Database.Port)
+	}
+	if c.Database.DBName == "" {
+		problem("DB_NAME is empty: set it to the PostgreSQL database to use")
+	}
+
+	switch secret := c.JWT.Secret; {
+	case secret == "":
+		problem("JWT_SECRET is empty: set it to a random value of at least %d characters, such as the output of openssl rand -hex 32", minJWTSecretLength)
+	case secret == defaultJWTSecret || len(secret) < minJWTSecretLength:
+		weak := fmt.Sprintf("JWT_SECRET is the example value or shorter than %d characters, so tokens and signed links can be forged: set it to a random value, such as the output of openssl rand -hex 32", minJWTSecretLength)
+		if c.Server.IsProduction() {
+			problems = append(problems, errors.New(weak))
+		} else {
+			log.Printf("Warning: %s", weak)
+		}
+	}
+
+	if c.JWT.Expiration <= 0 {
+		problem("JWT_EXPIRATION=%s must be positive: use the lifetime of issued tokens, such as 24h or 7d", c.JWT.Expiration)
+	}
+	if c.JWT.ClockSkew < 0 {
+		problem("JWT_CLOCK_SKEW=%s can't be negative: use 0 for none, or a leeway such as 1m", c.JWT.ClockSkew)
+	}
+	for _, key := range c.JWT.PreviousKeys {
+		if c.JWT.KeyID != "" && key.ID == c.JWT.KeyID {
+			problem("JWT_PREVIOUS_KEYS lists the current JWT_KEY_ID %q: give each rotated secret its own key ID", key.ID)
+		}
+	}
+
+	if c.Storage.MaxUploadSize <= 0 {
+		problem("MAX_UPLOAD_SIZE=%d must be a positive number of bytes, such as 104857600 for 100MB", c.Storage.MaxUploadSize)
+	}
+	if c.Transform.MaxDPRDimension <= 0 || c.Transform.MaxDPRDimension > 16384 {
+		problem("TRANSFORM_DPR_MAX_DIMENSION=%d must be between 1 and 16384 pixels", c.Transform.MaxDPRDimension)
+	}
+	if c.Storage.Widget.TokenTTL <= 0 {
+		problem("WIDGET_TOKEN_TTL=%s must be positive, such as 1h", c.Storage.Widget.TokenTTL)
+	} else if c.Storage.Widget.MaxTokenTTL < c.Storage.Widget.TokenTTL {
+		problem("WIDGET_TOKEN_MAX_TTL=%s must be at least WIDGET_TOKEN_TTL=%s", c.Storage.Widget.MaxTokenTTL, c.Storage.Widget.TokenTTL)
+	}
+	used := []string{c.Storage.Provider}
+	if !slices.Contains(storageProviders, c.Storage.Provider) {
+		problem("STORAGE_PROVIDER=%q is not a storage provider: use one of %s", c.Storage.Provider, strings.Join(storageProviders, ", "))
+	}
+	for _, name := range c.Storage.Backends {
+		if !slices.Contains(storageProviders, name) {
+			problem("STORAGE_BACKENDS lists %q, which is not a storage provider: use %s", name, strings.Join(storageProviders, ", "))
+		}
+		used = append(used, name)
+	}
+	if replica := c.Storage.Replication.Replica; replica != "" {
+		if !slices.Contains(storageProviders, replica) {
+			problem("STORAGE_REPLICA=%q is not a storage provider: use one of %s, or leave it empty to disable replication", replica, strings.Join(storageProviders, ", "))
+		}
+		used = append(used, replica)
+	}
+	if slices.Contains(used, "s3") {
+		s3 := c.Storage.S3
+		if s3.BucketName == "" {
+			problem("AWS_BUCKET_NAME is empty but S3 storage is used: set it to the bucket media are stored in")
+		}
+		if s3.Region == "" {
+			problem("AWS_REGION is empty but S3 storage is used: set it to the bucket's region, such as us-east-1")
+		}
+		if s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			problem("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must both be set when S3 storage is used")
+		}
+		if s3.Endpoint != "" && !validURL(s3.Endpoint) {
+			problem("AWS_ENDPOINT=%q is not a URL: use an absolute URL such as http://localhost:4566, or leave it empty for AWS", s3.Endpoint)
+		}
+		if s3.PublicURL != "" && !validURL(s3.PublicURL) {
+			problem("AWS_PUBLIC_URL=%q is not a URL: use an absolute URL such as https://media.example.com", s3.PublicURL)
+		}
+	}
+	if slices.Contains(used, "seaweedfs") {
+		// The scheme may be left out, as with localhost:9333
+		masterURL := c.Storage.SeaweedFS.MasterURL
+		if !strings.Contains(masterURL, "://") {
+			masterURL = "http://" + masterURL
+		}
+		if c.Storage.SeaweedFS.MasterURL == "" || !validURL(masterURL) {
+			problem("SEAWEEDFS_MASTER_URL=%q is not a URL: use the filer's address, such as http://localhost:9333", c.Storage.SeaweedFS.MasterURL)
+		}
+		if port := c.Storage.SeaweedFS.VolumePort; port < 1 || port > 65535 {
+			problem("SEAWEED_VOLUME_PORT=%d is not a port: use a number from 1 to 65535, such as 8080", port)
+		}
+	}
+
+	if redirect := c.Drives.RedirectURL; redirect != "" && !validURL(redirect) {
+		problem("CLOUD_DRIVE_REDIRECT_URL=%q is not a URL: use the absolute URL of the page providers send users back to, such as https://app.example.com/drives/callback", redirect)
+	}
+	if c.Drives.StateExpiration <= 0 {
+		problem("CLOUD_DRIVE_CONNECT_EXPIRATION must be positive, such as 10m")
+	}
+
+	switch c.RateLimit.Store {
+	case "", "memory":
+	case "redis":
+		if _, _, err := net.SplitHostPort(c.RateLimit.Redis.Addr); err != nil {
+			problem("REDIS_ADDR=%q is not a host:port address, such as localhost:6379", c.RateLimit.Redis.Addr)
+		}
+	default:
+		problem("RATE_LIMIT_STORE=%q is not a rate limit store: use memory or redis", c.RateLimit.Store)
+	}
+
+	return errors.Join(problems...)
+}
+
+// validPort reports whether port is a TCP port number
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+// validURL reports whether value is an absolute http or https URL
+func validURL(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -1,16 +1,41 @@
 package database
 
 import (
-	"go-media-center-example/internal/config"
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+
+	"go-media-center-example/internal/config"
 )
 
 var DB *gorm.DB
 
+// Initialize connects to the database. When DB_USER or DB_PASSWORD reference a secrets
+// manager, every new connection logs in with their current values, so connections opened
+// after a rotation keep working.
 func Initialize(cfg *config.Config) error {
+	dialector := postgres.Open(cfg.Database.DSN())
+	if cfg.Database.RotatesCredentials() {
+		connConfig, err := pgx.ParseConfig(cfg.Database.DSN())
+		if err != nil {
+			return err
+		}
+		sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, conn *pgx.ConnConfig) error {
+			user, password, err := cfg.Database.Credentials(ctx)
+			if err != nil {
+				return err
+			}
+			conn.User, conn.Password = user, password
+			return nil
+		}))
+		dialector = postgres.New(postgres.Config{Conn: sqlDB})
+	}
+
 	var err error
-	DB, err = gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{})
+	DB, err = gorm.Open(dialector, &gorm.Config{})
 	if err != nil {
 		return err
 	}
@@ -19,4 +44,4 @@ func Initialize(cfg *config.Config) error {
 
 func GetDB() *gorm.DB {
 	return DB
-}
\ No newline at end of file
+}
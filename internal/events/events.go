@@ -0,0 +1,131 @@
+// Package events publishes media lifecycle events to a message broker so downstream
+// systems, such as a search indexer, can react to library changes without polling.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"go-media-center-example/internal/config"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// publishAttempts is how often an event is tried before it is dropped
+	publishAttempts = 3
+	// retryDelay is the wait after the first failed attempt; it doubles after each one
+	retryDelay = time.Second
+)
+
+// Event is the message published for a library change
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"` // For example media.created or folder.deleted
+	UserID    uint                   `json:"user_id"`
+	MediaID   string                 `json:"media_id,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+}
+
+// Publisher delivers encoded events to a broker. Publish is only called from one
+// goroutine at a time.
+type Publisher interface {
+	Publish(event *Event, payload []byte) error
+}
+
+// message is an event encoded when it was raised, so later changes to the records in its
+// data don't leak into it
+type message struct {
+	event   *Event
+	payload []byte
+}
+
+// queue feeds the publishing goroutine; nil while publishing is disabled
+var queue chan message
+
+// NewPublisher creates the publisher named by the configuration
+func NewPublisher(cfg config.EventsConfig) (Publisher, error) {
+	switch cfg.Broker {
+	case "nats":
+		return NewNATSPublisher(cfg.URL, cfg.Topic)
+	case "kafka":
+		return NewKafkaPublisher(cfg.URL, cfg.Topic), nil
+	case "rabbitmq":
+		return NewRabbitMQPublisher(cfg.URL, cfg.Topic)
+	default:
+		return nil, fmt.Errorf("unknown event broker: %s", cfg.Broker)
+	}
+}
+
+// Start begins publishing to the configured broker. It does nothing when no broker is
+// configured, and must be called once before requests are served.
+func Start(cfg config.EventsConfig) error {
+	if cfg.Broker == "" {
+		return nil
+	}
+
+	publisher, err := NewPublisher(cfg)
+	if err != nil {
+		return err
+	}
+
+	queue = make(chan message, cfg.Buffer)
+	go run(publisher, queue)
+	log.Printf("Publishing media events to %s", cfg.Broker)
+	return nil
+}
+
+// Enabled reports whether events are published
+func Enabled() bool {
+	return queue != nil
+}
+
+// Publish queues an event without waiting for the broker. Events are dropped, and the
+// drop logged, when the broker falls too far behind.
+func Publish(eventType string, userID uint, mediaID string, data map[string]interface{}) {
+	if queue == nil {
+		return
+	}
+
+	event := &Event{
+		ID:        uuid.NewString(),
+		Type:      eventType,
+		UserID:    userID,
+		MediaID:   mediaID,
+		Data:      data,
+		Timestamp: time.Now().UTC(),
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	select {
+	case queue <- message{event: event, payload: payload}:
+	default:
+		log.Printf("Event queue full, dropping %s event %s", eventType, event.ID)
+	}
+}
+
+// run publishes queued events in order, retrying each a few times
+func run(publisher Publisher, queue <-chan message) {
+	for msg := range queue {
+		delay := retryDelay
+		for attempt := 1; ; attempt++ {
+			err := publisher.Publish(msg.event, msg.payload)
+			if err == nil {
+				break
+			}
+			if attempt == publishAttempts {
+				log.Printf("Dropping %s event %s after %d attempts: %v", msg.event.Type, msg.event.ID, attempt, err)
+				break
+			}
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// natsTimeout bounds dialing and each publish, including its acknowledgement
+const natsTimeout = 5 * time.Second
+
+// NATSPublisher publishes each event on <prefix>.<event type>, for example
+// media-center.media.created. It speaks the NATS client protocol directly.
+type NATSPublisher struct {
+	addr   string
+	user   *url.Userinfo
+	prefix string
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewNATSPublisher creates a publisher for a nats://[user:password@]host:port URL.
+// The connection is opened on first use.
+func NewNATSPublisher(rawURL, prefix string) (*NATSPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL: %s", rawURL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	return &NATSPublisher{addr: addr, user: u.User, prefix: prefix}, nil
+}
+
+// Publish implements Publisher. A PING follows every message so its PONG confirms the
+// server accepted the message.
+func (p *NATSPublisher) Publish(event *Event, payload []byte) error {
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+
+	subject := p.prefix + "." + event.Type
+	p.conn.SetDeadline(time.Now().Add(natsTimeout))
+	frame := "PUB " + subject + " " + strconv.Itoa(len(payload)) + "\r\n" + string(payload) + "\r\nPING\r\n"
+	if _, err := p.conn.Write([]byte(frame)); err != nil {
+		p.reset()
+		return err
+	}
+	if err := p.awaitPong(); err != nil {
+		p.reset()
+		return err
+	}
+	return nil
+}
+
+// connect dials the server, reads its INFO and introduces the client
+func (p *NATSPublisher) connect() error {
+	conn, err := net.DialTimeout("tcp", p.addr, natsTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+	p.conn, p.reader = conn, bufio.NewReader(conn)
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+
+	line, err := p.reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		p.reset()
+		return fmt.Errorf("unexpected NATS greeting: %q %v", line, err)
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "name": "media-center"}
+	if p.user != nil {
+		options["user"] = p.user.Username()
+		if password, ok := p.user.Password(); ok {
+			options["pass"] = password
+		}
+	}
+	connect, _ := json.Marshal(options)
+	if _, err := conn.Write([]byte("CONNECT " + string(connect) + "\r\nPING\r\n")); err != nil {
+		p.reset()
+		return err
+	}
+	if err := p.awaitPong(); err != nil {
+		p.reset()
+		return fmt.Errorf("NATS handshake failed: %v", err)
+	}
+	return nil
+}
+
+// awaitPong reads until the server answers our PING, answering its own pings on the way
+func (p *NATSPublisher) awaitPong() error {
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch line = strings.TrimRight(line, "\r\n"); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+// reset drops the connection so the next publish reconnects
+func (p *NATSPublisher) reset() {
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.conn, p.reader = nil, nil
+}
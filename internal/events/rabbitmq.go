@@ -0,0 +1,83 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RabbitMQPublisher publishes events to an exchange through the RabbitMQ management HTTP
+// API, with the event type as routing key. Messages are persistent.
+type RabbitMQPublisher struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewRabbitMQPublisher creates a publisher for a http(s)://user:password@host:15672/vhost
+// URL. The vhost defaults to /.
+func NewRabbitMQPublisher(rawURL, exchange string) (*RabbitMQPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid RabbitMQ URL: %s", rawURL)
+	}
+
+	vhost := strings.TrimPrefix(u.Path, "/")
+	if vhost == "" {
+		vhost = "/"
+	}
+	p := &RabbitMQPublisher{
+		endpoint: u.Scheme + "://" + u.Host + "/api/exchanges/" + url.PathEscape(vhost) + "/" + url.PathEscape(exchange) + "/publish",
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if u.User != nil {
+		p.username = u.User.Username()
+		p.password, _ = u.User.Password()
+	}
+	return p, nil
+}
+
+// Publish implements Publisher
+func (p *RabbitMQPublisher) Publish(event *Event, payload []byte) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"properties": map[string]interface{}{
+			"content_type":  "application/json",
+			"delivery_mode": 2,
+			"message_id":    event.ID,
+		},
+		"routing_key":      event.Type,
+		"payload":          string(payload),
+		"payload_encoding": "string",
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(p.username, p.password)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach RabbitMQ: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("RabbitMQ returned %s: %s", resp.Status, message)
+	}
+
+	// The response also says whether a queue received the event; an event no queue is
+	// bound for yet is not an error
+	return nil
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// CloudDriveConnection is a cloud drive account a user connected over OAuth, such as a
+// Google Drive, to import files from. Connecting the same account again replaces its tokens.
+type CloudDriveConnection struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"index"`
+	Provider       string     `json:"provider"`   // google_drive, dropbox or onedrive
+	AccountID      string     `json:"account_id"` // The account's ID at the provider
+	AccountName    string     `json:"account_name"`
+	AccountEmail   string     `json:"account_email"`
+	AccessToken    string     `json:"-"`
+	RefreshToken   string     `json:"-"`
+	TokenExpiresAt *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
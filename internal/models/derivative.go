@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Derivative is a cached transform or thumbnail of a media item, tracked so the cache
+// can be size-limited, expired and purged per media
+type Derivative struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	MediaID        string    `json:"media_id" gorm:"index"`
+	CacheKey       string    `json:"cache_key" gorm:"uniqueIndex"`
+	StorageBackend string    `json:"storage_backend"`
+	Path           string    `json:"path"`
+	Size           int64     `json:"size"`
+	Hits           int64     `json:"hits"`
+	RenderMs       int64     `json:"render_ms"` // Time the last render took
+	LastAccessedAt time.Time `json:"last_accessed_at" gorm:"index"`
+	CreatedAt      time.Time `json:"created_at"`
+}
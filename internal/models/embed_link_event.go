@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// EmbedLinkEvent records a view of a media item's embed page, or a download of its file,
+// through a signed embed link, so the owner can see where shared media are used
+type EmbedLinkEvent struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	MediaID     string    `json:"media_id" gorm:"index"`
+	UserID      uint      `json:"-" gorm:"index"` // Owner of the media
+	Kind        string    `json:"kind"`           // AccessView or AccessDownload
+	LinkExpires int64     `json:"link_expires"`   // Expiry of the link used, telling links of one media item apart
+	Referrer    string    `json:"referrer,omitempty"`
+	Country     string    `json:"country,omitempty"` // ISO 3166 code from the CDN's headers; empty when unknown
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
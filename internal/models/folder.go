@@ -1,20 +1,97 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
+	"unicode"
 
+	"golang.org/x/text/unicode/norm"
 	"gorm.io/gorm"
 )
 
-// Folder represents a folder in the media center
+// maxFolderSlug leaves room in the slug column for a number telling siblings apart
+const maxFolderSlug = 240
+
+// Folder represents a folder in the media center. Names, and the slugs derived from them,
+// are unique among the folders of a parent.
 type Folder struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
 	Name        string         `json:"name"`
+	Slug        string         `json:"slug"` // URL-safe form of the name, used in folder paths
 	Description string         `json:"description"`
 	ParentID    *uint          `json:"parent_id"`
 	UserID      uint           `json:"user_id"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
-	MediaCount  int64          `json:"media_count" gorm:"-"` // Virtual field for media count
+}
+
+// BeforeCreate hook giving new folders a slug
+func (f *Folder) BeforeCreate(tx *gorm.DB) error {
+	if f.Slug != "" {
+		return nil
+	}
+	slug, err := UniqueFolderSlug(tx.Session(&gorm.Session{NewDB: true}), f.UserID, f.ParentID, f.Name, 0)
+	if err != nil {
+		return err
+	}
+	f.Slug = slug
+	return nil
+}
+
+// FolderSlug derives the slug of a folder name: lowercase ASCII letters and digits, with
+// accents dropped, and single hyphens for everything else. "Été 2024!" becomes "ete-2024".
+func FolderSlug(name string) string {
+	var b strings.Builder
+	separate := false
+	for _, r := range norm.NFKD.String(name) {
+		r = unicode.ToLower(r)
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if separate && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			separate = false
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// An accent split off its letter
+		default:
+			separate = true
+		}
+		if b.Len() >= maxFolderSlug {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "folder"
+	}
+	return b.String()
+}
+
+// UniqueFolderSlug returns the slug of name for a folder of userID below parentID, numbered
+// when a sibling other than the folder exclude already has it
+func UniqueFolderSlug(db *gorm.DB, userID uint, parentID *uint, name string, exclude uint) (string, error) {
+	slug := FolderSlug(name)
+	query := db.Model(&Folder{}).
+		Where("user_id = ? AND id <> ? AND (slug = ? OR slug LIKE ?)", userID, exclude, slug, slug+"-%")
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+	var siblings []string
+	if err := query.Pluck("slug", &siblings).Error; err != nil {
+		return "", err
+	}
+
+	taken := make(map[string]bool, len(siblings))
+	for _, sibling := range siblings {
+		taken[sibling] = true
+	}
+	candidate := slug
+	for n := 2; taken[candidate]; n++ {
+		candidate = fmt.Sprintf("%s-%d", slug, n)
+	}
+	return candidate, nil
 }
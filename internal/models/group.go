@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Roles of group members
+const (
+	GroupRoleMember  = "member"
+	GroupRoleManager = "manager" // May add and remove members
+)
+
+// Group is a team of users, so access can be granted to all of them at once. Names are
+// unique among the groups of an owner.
+type Group struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	OwnerID     uint      `json:"owner_id" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// GroupMembership makes a user a member of a group
+type GroupMembership struct {
+	GroupID   uint      `json:"group_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	Role      string    `json:"role"`
+	AddedBy   uint      `json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
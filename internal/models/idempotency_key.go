@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a request a client sent with an Idempotency-Key header, so a
+// retry of it is answered with the first response instead of being carried out again
+type IdempotencyKey struct {
+	UserID      uint      `gorm:"primaryKey"`
+	Key         string    `gorm:"primaryKey"`
+	Fingerprint string    // Hash of the request's method, path, query and body
+	Status      int       // Status of the stored response; 0 while the request is in progress
+	ContentType string    // Content type of the stored response
+	Body        []byte    // Body of the stored response
+	ExpiresAt   time.Time `gorm:"index"`
+	CreatedAt   time.Time
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Import job statuses
+const (
+	ImportJobRunning   = "running"
+	ImportJobCompleted = "completed"
+)
+
+// Batch job kinds. Every bulk operation that runs in the background is an import job of one
+// of these kinds; the name predates transforms.
+const (
+	BatchKindURLImport  = "url_import"
+	BatchKindTransform  = "transform"
+	BatchKindManifest   = "manifest"
+	BatchKindCloudDrive = "cloud_drive"
+)
+
+// Import item statuses. An item moves pending -> processing -> stored -> completed, or to failed.
+const (
+	ImportItemPending    = "pending"
+	ImportItemProcessing = "processing" // Download or upload in progress
+	ImportItemStored     = "stored"     // Object uploaded, media record not yet created
+	ImportItemCompleted  = "completed"
+	ImportItemFailed     = "failed"
+)
+
+// ImportJob is a persisted background batch job, a bulk URL import, transform, manifest
+// import or cloud drive import, so it can resume after a restart
+type ImportJob struct {
+	ID             uint            `json:"id" gorm:"primaryKey"`
+	UserID         uint            `json:"user_id" gorm:"index"`
+	Kind           string          `json:"kind" gorm:"index;default:url_import"`
+	FolderID       *string         `json:"folder_id"`
+	DriveID        *uint           `json:"drive_id,omitempty"` // Connection a cloud drive import reads from
+	Status         string          `json:"status" gorm:"index"`
+	Total          int             `json:"total"`
+	Succeeded      int             `json:"succeeded"`
+	Failed         int             `json:"failed"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	CompletedAt    *time.Time      `json:"completed_at"`
+	LeaseOwner     string          `json:"-"` // Token of the instance holding the lease
+	LeaseExpiresAt *time.Time      `json:"-"` // Until when the instance running the job holds it
+	Items          []ImportJobItem `json:"items,omitempty" gorm:"foreignKey:JobID"`
+}
+
+// ImportJobItem tracks a single URL of an import job, a single media item of a transform job,
+// a single row of a manifest import or a single file of a cloud drive import
+type ImportJobItem struct {
+	ID             uint            `json:"id" gorm:"primaryKey"`
+	JobID          uint            `json:"job_id" gorm:"index"`
+	Position       int             `json:"position"`
+	URL            string          `json:"url"`
+	Filename       string          `json:"filename"`
+	Tags           json.RawMessage `json:"tags" gorm:"type:jsonb"`
+	SourceID       string          `json:"source_id,omitempty"`                  // Media transformed by a transform item, or file of a cloud drive item
+	Options        json.RawMessage `json:"options,omitempty" gorm:"type:jsonb"`  // Transformation options of a transform item
+	StorageKey     string          `json:"storage_key,omitempty"`                // Existing object on StorageBackend a manifest row registers
+	FolderID       *string         `json:"folder_id,omitempty"`                  // Folder of a manifest row, overriding the job's
+	Metadata       json.RawMessage `json:"metadata,omitempty" gorm:"type:jsonb"` // Custom metadata of a manifest row, or the drive file of a cloud drive item
+	Status         string          `json:"status"`
+	FileID         string          `json:"file_id,omitempty"`
+	StorageBackend string          `json:"storage_backend,omitempty"`
+	MediaID        string          `json:"media_id,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
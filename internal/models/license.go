@@ -0,0 +1,17 @@
+package models
+
+// LicenseTypes are the licenses media can be marked with
+var LicenseTypes = []string{
+	"all_rights_reserved",
+	"rights_managed",
+	"royalty_free",
+	"editorial",
+	"cc0",
+	"cc_by",
+	"cc_by_sa",
+	"cc_by_nd",
+	"cc_by_nc",
+	"cc_by_nc_sa",
+	"cc_by_nc_nd",
+	"public_domain",
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Lifecycle rule actions
+const (
+	LifecycleArchive    = "archive"     // Move media to a colder storage class
+	LifecycleDelete     = "delete"      // Delete media and their stored objects
+	LifecyclePurgeTrash = "purge_trash" // Permanently remove the records of deleted media
+)
+
+// LifecycleRule applies an action to the media of a folder once they are AfterDays old.
+// Purge rules count the days since the media were deleted instead.
+type LifecycleRule struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	FolderID     uint       `json:"folder_id" gorm:"index"`
+	UserID       uint       `json:"user_id" gorm:"index"`
+	Action       string     `json:"action"`
+	AfterDays    int        `json:"after_days"`
+	StorageClass string     `json:"storage_class,omitempty"` // Class archive rules move media to
+	Enabled      bool       `json:"enabled"`
+	LastRunAt    *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// LifecycleAction records a lifecycle rule applied to one media item. Failed actions
+// carry the error and are attempted again on the next run.
+type LifecycleAction struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RuleID    uint      `json:"rule_id" gorm:"index"`
+	FolderID  uint      `json:"folder_id" gorm:"index"`
+	UserID    uint      `json:"user_id"`
+	MediaID   string    `json:"media_id" gorm:"index"`
+	Action    string    `json:"action"`
+	Detail    string    `json:"detail,omitempty"` // e.g. the storage class media were moved to
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
@@ -14,18 +14,33 @@ import (
 
 // Media represents a media file in the system
 type Media struct {
-	ID        string `gorm:"primarykey"`
-	UserID    uint
-	FolderID  *string
-	Filename  string
-	Path      string
-	MimeType  string
-	Size      int64
-	Metadata  json.RawMessage `gorm:"type:jsonb"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	DeletedAt gorm.DeletedAt `gorm:"index"`
-	Tags      []Tag          `gorm:"many2many:media_tags;"`
+	ID       string `gorm:"primarykey"`
+	UserID   uint
+	FolderID *string
+	Filename string
+	Path     string
+	// StorageBackend names the provider holding the object; empty means the primary provider
+	StorageBackend string
+	MimeType       string
+	Size           int64
+	Metadata       json.RawMessage `gorm:"type:jsonb"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+	Tags           []Tag          `gorm:"many2many:media_tags;"`
+	// Broken is set by the consistency check when the stored object is missing
+	Broken bool `gorm:"not null;default:false"`
+	// WorkflowStatus is where the media are in review before being published
+	WorkflowStatus string `gorm:"not null;default:draft"`
+	// License under which the media may be used, with who holds the rights and the last
+	// day they may be used, if it ends
+	LicenseType      string     `gorm:"not null;default:''"`
+	RightsHolder     string     `gorm:"not null;default:''"`
+	LicenseExpiresAt *time.Time `gorm:"type:date"`
+	// LegalHold and RetainUntil keep media from being deleted or replaced until the hold
+	// is released or the retention period ends
+	LegalHold   bool `gorm:"not null;default:false"`
+	RetainUntil *time.Time
 }
 
 // JSON is a custom type for handling JSON data in the database
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Ways media are accessed
+const (
+	AccessView     = "view"     // Details fetched with GET /media/:id
+	AccessServe    = "serve"    // File served inline, possibly transformed
+	AccessDownload = "download" // Original downloaded as an attachment
+)
+
+// MediaAccess counts how often a user accessed a media item, and when they last did
+type MediaAccess struct {
+	UserID         uint      `json:"-" gorm:"primaryKey"`
+	MediaID        string    `json:"-" gorm:"primaryKey"`
+	Views          int64     `json:"views"`
+	Serves         int64     `json:"serves"`
+	Downloads      int64     `json:"downloads"`
+	LastAccess     string    `json:"last_access"` // Kind of the last access
+	LastAccessedAt time.Time `json:"last_accessed_at" gorm:"index"`
+}
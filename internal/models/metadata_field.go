@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Types of custom metadata fields
+const (
+	MetadataText   = "text"
+	MetadataNumber = "number"
+	MetadataDate   = "date"   // YYYY-MM-DD
+	MetadataSelect = "select" // One of the field's options
+)
+
+// MetadataField is a typed custom field admins define for the whole library. Values are
+// kept under metadata.custom of media, keyed by Key.
+type MetadataField struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Key       string    `json:"key" gorm:"uniqueIndex"`
+	Label     string    `json:"label"`
+	Type      string    `json:"type"`
+	Options   []string  `json:"options,omitempty" gorm:"serializer:json"` // Values select fields accept
+	Required  bool      `json:"required"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OwnershipTransfer records media and folders an admin handed from one user to another,
+// such as when an employee leaves
+type OwnershipTransfer struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	AdminID     uint            `json:"admin_id"`
+	FromUserID  uint            `json:"from_user_id" gorm:"index"`
+	ToUserID    uint            `json:"to_user_id" gorm:"index"`
+	MediaCount  int             `json:"media_count"`
+	FolderCount int             `json:"folder_count"`
+	Bytes       int64           `json:"bytes"`                        // Storage moved to the recipient's quota
+	MediaIDs    json.RawMessage `json:"media_ids" gorm:"type:jsonb"`  // IDs of the transferred media
+	FolderIDs   json.RawMessage `json:"folder_ids" gorm:"type:jsonb"` // IDs of the transferred folders
+	CreatedAt   time.Time       `json:"created_at" gorm:"index"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Purge item statuses
+const (
+	PurgeItemPending = "pending"
+	PurgeItemDeleted = "deleted"
+	PurgeItemFailed  = "failed"
+)
+
+// PurgeJob is a persisted background deletion of stored objects, so objects queued for
+// deletion are still deleted after a restart
+type PurgeJob struct {
+	ID          string `gorm:"primaryKey"`
+	OwnerID     uint   `gorm:"index"` // User who started it; 0 for internal cleanups
+	Status      string `gorm:"index"`
+	Total       int
+	StartedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// PurgeItem is one object of a purge job
+type PurgeItem struct {
+	ID      uint   `gorm:"primaryKey"`
+	JobID   string `gorm:"index"`
+	Backend string // Empty for the primary backend
+	Path    string
+	Ref     string // What the object belonged to, e.g. a media ID
+	Status  string
+	Error   string
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Changes of media retention recorded in the audit log
+const (
+	RetentionHoldPlaced   = "hold_placed"
+	RetentionHoldReleased = "hold_released"
+	RetentionSet          = "retention_set"     // Retention period set or extended
+	RetentionCleared      = "retention_cleared" // Retention period removed or shortened
+)
+
+// RetentionEvent records a change of the legal hold or retention period of a media item.
+// Override is set when an admin released a hold or shortened a retention period still
+// in force.
+type RetentionEvent struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	MediaID     string     `json:"media_id" gorm:"index"`
+	OwnerID     uint       `json:"owner_id" gorm:"index"` // Owner of the media
+	UserID      uint       `json:"user_id"`               // User who made the change
+	Action      string     `json:"action"`
+	RetainUntil *time.Time `json:"retain_until,omitempty"` // Retention period after the change
+	Override    bool       `json:"override"`
+	Reason      string     `json:"reason,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"index"`
+}
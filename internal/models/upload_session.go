@@ -0,0 +1,37 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Upload session statuses. A session moves active -> assembled -> completed, or to aborted.
+const (
+	UploadSessionActive    = "active"
+	UploadSessionAssembled = "assembled" // Parts joined into the object, media record not yet created
+	UploadSessionCompleted = "completed"
+	UploadSessionAborted   = "aborted"
+)
+
+// UploadSession tracks a multipart direct upload, whose parts clients send straight to
+// storage, from its start until the media item is created or the upload is aborted
+type UploadSession struct {
+	ID             string          `json:"id" gorm:"primaryKey"`
+	UserID         uint            `json:"user_id" gorm:"index"`
+	StorageBackend string          `json:"storage_backend"`
+	Key            string          `json:"-"` // Storage key the object is assembled under
+	UploadID       string          `json:"-"` // The backend's ID of the multipart upload
+	Filename       string          `json:"filename"`
+	ContentType    string          `json:"content_type,omitempty"`
+	Size           int64           `json:"size"`
+	PartSize       int64           `json:"part_size"` // Every part but the last has exactly this size
+	PartCount      int             `json:"part_count"`
+	FolderID       *string         `json:"folder_id"`
+	Tags           json.RawMessage `json:"tags" gorm:"type:jsonb"`
+	Conflict       string          `json:"conflict"`
+	Status         string          `json:"status" gorm:"index"`
+	MediaID        string          `json:"media_id,omitempty"`
+	ExpiresAt      time.Time       `json:"expires_at" gorm:"index"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
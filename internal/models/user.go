@@ -4,9 +4,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
 	gorm.Model
 	Username string `json:"username" gorm:"unique"`
 	Password string `json:"password"`
 	Email    string `json:"email" gorm:"unique"`
-}
\ No newline at end of file
+	Role     string `json:"role" gorm:"default:user"`
+	// StorageQuota overrides the configured default quota in bytes; 0 is unlimited
+	StorageQuota *int64 `json:"storage_quota"`
+	// PublicDomain is a custom hostname serving the user's media URLs; nil uses the
+	// backend's public URL
+	PublicDomain *string `json:"public_domain" gorm:"uniqueIndex:idx_users_public_domain"`
+}
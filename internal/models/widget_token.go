@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// WidgetToken lets an upload widget embedded in another site upload files into a user's
+// library without the user's JWT. Uploads land in one folder, within a size, file types and
+// origins, until the token expires, is used up or is revoked. Only a hash of the token is kept.
+type WidgetToken struct {
+	ID             string     `json:"id" gorm:"primaryKey"`
+	UserID         uint       `json:"user_id" gorm:"index"`
+	Name           string     `json:"name"`
+	TokenHash      string     `json:"-" gorm:"uniqueIndex"`
+	FolderID       *string    `json:"folder_id"`                              // Folder uploads land in; nil for the root
+	MaxSize        int64      `json:"max_size"`                               // Largest file accepted, in bytes
+	AllowedTypes   []string   `json:"allowed_types" gorm:"serializer:json"`   // MIME types such as image/*; empty allows any
+	AllowedOrigins []string   `json:"allowed_origins" gorm:"serializer:json"` // Sites the widget may run on; empty allows any
+	MaxUploads     int        `json:"max_uploads"`                            // 0 for no limit
+	Uploads        int        `json:"uploads"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Usable reports whether the token still accepts uploads
+func (t *WidgetToken) Usable() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt) && (t.MaxUploads == 0 || t.Uploads < t.MaxUploads)
+}
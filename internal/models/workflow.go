@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Workflow statuses of media
+const (
+	WorkflowDraft    = "draft"     // Being worked on; new uploads start here
+	WorkflowInReview = "in_review" // Submitted for approval
+	WorkflowApproved = "approved"  // Cleared for public channels
+	WorkflowRejected = "rejected"  // Sent back by a reviewer
+)
+
+// WorkflowTransitions lists the statuses media may move to from each status. Approving
+// and rejecting is up to admins.
+var WorkflowTransitions = map[string][]string{
+	WorkflowDraft:    {WorkflowInReview},
+	WorkflowInReview: {WorkflowApproved, WorkflowRejected, WorkflowDraft},
+	WorkflowApproved: {WorkflowDraft},
+	WorkflowRejected: {WorkflowDraft, WorkflowInReview},
+}
+
+// WorkflowTransition records a change of the workflow status of a media item
+type WorkflowTransition struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	MediaID    string    `json:"media_id" gorm:"index"`
+	UserID     uint      `json:"user_id"` // User who made the change
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Note       string    `json:"note,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often expired windows are dropped from a MemoryStore
+const sweepInterval = time.Minute
+
+// MemoryStore keeps counters in process memory. Limits are per instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	windows   map[string]*window
+	lastSweep time.Time
+}
+
+type window struct {
+	count int
+	reset time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		windows:   make(map[string]*window),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow implements Store
+func (s *MemoryStore) Allow(key string, limit int, period time.Duration) (Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > sweepInterval {
+		for k, w := range s.windows {
+			if !now.Before(w.reset) {
+				delete(s.windows, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.reset) {
+		w = &window{reset: now.Add(period)}
+		s.windows[key] = w
+	}
+	w.count++
+
+	return result(w.count, limit, w.reset), nil
+}
@@ -0,0 +1,50 @@
+// Package ratelimit counts requests in fixed windows, in memory or in Redis so that
+// several API instances share the same limits.
+package ratelimit
+
+import (
+	"fmt"
+	"time"
+
+	"go-media-center-example/internal/config"
+)
+
+// Result is the state of a key's window after counting a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	Reset     time.Time // When the window ends and the count starts over
+}
+
+// Store counts requests per key
+type Store interface {
+	// Allow counts a request against key and reports whether it fits in limit per window
+	Allow(key string, limit int, window time.Duration) (Result, error)
+}
+
+// NewStore creates the store named by the configuration
+func NewStore(cfg config.RateLimitConfig) (Store, error) {
+	switch cfg.Store {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "redis":
+		return NewRedisStore(cfg.Redis), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store: %s", cfg.Store)
+	}
+}
+
+// result builds the Result of the count-th request of a window ending at reset
+func result(count, limit int, reset time.Time) Result {
+	remaining := limit - count
+	if remaining < 0 {
+		remaining = 0
+	}
+	return Result{
+		Allowed:   count <= limit,
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     reset,
+	}
+}
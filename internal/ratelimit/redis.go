@@ -0,0 +1,200 @@
+package ratelimit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"go-media-center-example/internal/config"
+)
+
+const (
+	// redisPoolSize is how many idle connections a RedisStore keeps
+	redisPoolSize = 16
+	// redisTimeout bounds dialing and each command
+	redisTimeout = 2 * time.Second
+)
+
+// incrScript counts a request and starts the window on the first one. It returns the
+// count and the milliseconds left in the window.
+const incrScript = `
+local count = redis.call('INCR', KEYS[1])
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}`
+
+// RedisStore keeps counters in Redis so every instance enforces the same limits. It
+// speaks the Redis protocol directly over a small connection pool.
+type RedisStore struct {
+	cfg  config.RedisConfig
+	pool chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisStore creates a store for the Redis server in cfg. Connections are opened on
+// first use.
+func NewRedisStore(cfg config.RedisConfig) *RedisStore {
+	return &RedisStore{cfg: cfg, pool: make(chan *redisConn, redisPoolSize)}
+}
+
+// Allow implements Store
+func (s *RedisStore) Allow(key string, limit int, window time.Duration) (Result, error) {
+	reply, err := s.do("EVAL", incrScript, "1", "ratelimit:"+key, strconv.FormatInt(window.Milliseconds(), 10))
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("unexpected redis reply: %v", reply)
+	}
+	count, ok1 := values[0].(int64)
+	ttl, ok2 := values[1].(int64)
+	if !ok1 || !ok2 {
+		return Result{}, fmt.Errorf("unexpected redis reply: %v", reply)
+	}
+
+	return result(int(count), limit, time.Now().Add(time.Duration(ttl)*time.Millisecond)), nil
+}
+
+// do runs one command on a pooled connection
+func (s *RedisStore) do(args ...string) (interface{}, error) {
+	conn, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+	reply, err := conn.command(args...)
+	if err != nil {
+		var replyErr redisError
+		if !errors.As(err, &replyErr) {
+			// The connection state is unknown after a network error
+			conn.Close()
+			return nil, err
+		}
+	}
+	s.put(conn)
+	return reply, err
+}
+
+// get takes an idle connection or dials a new one
+func (s *RedisStore) get() (*redisConn, error) {
+	select {
+	case conn := <-s.pool:
+		return conn, nil
+	default:
+	}
+
+	netConn, err := net.DialTimeout("tcp", s.cfg.Addr, redisTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %v", err)
+	}
+	conn := &redisConn{Conn: netConn, reader: bufio.NewReader(netConn)}
+	conn.SetDeadline(time.Now().Add(redisTimeout))
+
+	if s.cfg.Password != "" {
+		if _, err := conn.command("AUTH", s.cfg.Password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to authenticate to redis: %v", err)
+		}
+	}
+	if s.cfg.DB != 0 {
+		if _, err := conn.command("SELECT", strconv.Itoa(s.cfg.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to select redis database: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// put returns a connection to the pool, closing it when the pool is full
+func (s *RedisStore) put(conn *redisConn) {
+	select {
+	case s.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+// redisError is an error reply from the server; the connection stays usable
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// command writes args as a RESP array and reads the reply
+func (c *redisConn) command(args ...string) (interface{}, error) {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := c.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply parses one RESP reply. Integers are int64, bulk strings are strings and
+// arrays are []interface{}.
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply: %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err // A null bulk string
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n < 0 {
+			return nil, err // A null array
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = c.readReply(); err != nil {
+				// The rest of the array is unread, so this is never a recoverable redisError
+				return nil, fmt.Errorf("failed to read redis array: %v", err)
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unknown redis reply type: %q", kind)
+	}
+}
@@ -0,0 +1,185 @@
+// Package scheduler runs periodic background jobs, such as cache eviction and lifecycle
+// enforcement, and keeps the outcome of their runs for the admin API.
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownJob is returned when triggering a job that was never registered
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobRunning is returned when triggering a job that is already running
+	ErrJobRunning = errors.New("job already running")
+)
+
+// Job is a task run every Interval. A zero Interval only runs it when triggered.
+type Job struct {
+	Name      string
+	Interval  time.Duration
+	Immediate bool // Also run once as soon as the scheduler starts
+	Run       func() error
+}
+
+// JobStatus reports the schedule and last run of a job
+type JobStatus struct {
+	Name         string     `json:"name"`
+	Interval     string     `json:"interval"` // Empty for jobs only run on demand
+	Running      bool       `json:"running"`
+	Runs         int64      `json:"runs"`
+	Failures     int64      `json:"failures"`
+	LastRun      *time.Time `json:"last_run,omitempty"`
+	LastDuration float64    `json:"last_duration_ms"`
+	LastError    string     `json:"last_error,omitempty"`
+	NextRun      *time.Time `json:"next_run,omitempty"`
+}
+
+// entry is a registered job with the state of its runs
+type entry struct {
+	job    Job
+	status JobStatus
+}
+
+var (
+	mu      sync.Mutex
+	entries = map[string]*entry{}
+	started bool
+)
+
+// Register adds a job. Jobs registered after Start are scheduled at once.
+func Register(job Job) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	e := &entry{job: job, status: JobStatus{Name: job.Name}}
+	if job.Interval > 0 {
+		e.status.Interval = job.Interval.String()
+	}
+	entries[job.Name] = e
+	if started {
+		schedule(e)
+	}
+}
+
+// Start runs every registered job on its interval
+func Start() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if started {
+		return
+	}
+	started = true
+	for _, e := range entries {
+		schedule(e)
+	}
+}
+
+// schedule starts the goroutine running e on its interval. Callers hold mu.
+func schedule(e *entry) {
+	if e.job.Interval <= 0 {
+		if e.job.Immediate {
+			go run(e)
+		}
+		return
+	}
+
+	next := time.Now().Add(e.job.Interval)
+	e.status.NextRun = &next
+	go func() {
+		if e.job.Immediate {
+			run(e)
+		}
+		ticker := time.NewTicker(e.job.Interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			mu.Lock()
+			next := now.Add(e.job.Interval)
+			e.status.NextRun = &next
+			mu.Unlock()
+			run(e)
+		}
+	}()
+}
+
+// Trigger runs the named job now, in the background
+func Trigger(name string) error {
+	mu.Lock()
+	e, ok := entries[name]
+	if !ok {
+		mu.Unlock()
+		return ErrUnknownJob
+	}
+	if e.status.Running {
+		mu.Unlock()
+		return ErrJobRunning
+	}
+	e.status.Running = true
+	mu.Unlock()
+
+	go execute(e)
+	return nil
+}
+
+// run runs a job once unless it is still running from an earlier tick
+func run(e *entry) {
+	mu.Lock()
+	if e.status.Running {
+		mu.Unlock()
+		return
+	}
+	e.status.Running = true
+	mu.Unlock()
+
+	execute(e)
+}
+
+// execute runs a job marked as running and records the outcome. A panicking job fails
+// the run instead of the process.
+func execute(e *entry) {
+	start := time.Now()
+	err := runRecovered(e.job.Run)
+
+	mu.Lock()
+	defer mu.Unlock()
+	e.status.Running = false
+	e.status.Runs++
+	e.status.LastRun = &start
+	e.status.LastDuration = float64(time.Since(start)) / float64(time.Millisecond)
+	e.status.LastError = ""
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+		log.Printf("Scheduled job %s failed: %v", e.job.Name, err)
+	}
+}
+
+// runRecovered calls fn, turning a panic into an error
+func runRecovered(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// Status returns the status of every registered job, by name
+func Status() []JobStatus {
+	mu.Lock()
+	defer mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(entries))
+	for _, e := range entries {
+		statuses = append(statuses, e.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
@@ -0,0 +1,161 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+)
+
+// ecsCredentialsHost serves the credentials of ECS tasks at AWS_CONTAINER_CREDENTIALS_RELATIVE_URI
+const ecsCredentialsHost = "http://169.254.170.2"
+
+// AWSCredentials returns the credentials of requests to Secrets Manager and Parameter
+// Store: the given keys when set, or else the role of the ECS task or EC2 instance
+func AWSCredentials(accessKeyID, secretAccessKey string) aws.CredentialsProvider {
+	if accessKeyID != "" && secretAccessKey != "" {
+		return credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, "")
+	}
+	endpoint := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		endpoint = ecsCredentialsHost + relative
+	}
+	if endpoint != "" {
+		return aws.NewCredentialsCache(endpointcreds.New(endpoint, func(o *endpointcreds.Options) {
+			o.AuthorizationToken = os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+		}))
+	}
+	return aws.NewCredentialsCache(ec2rolecreds.New())
+}
+
+// awsClient calls the JSON APIs of an AWS service, signing requests with Signature V4
+type awsClient struct {
+	service     string
+	region      string
+	endpoint    string
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+func newAWSClient(service, region string, creds aws.CredentialsProvider) (*awsClient, error) {
+	if region == "" {
+		return nil, fmt.Errorf("%s secrets need an AWS region", service)
+	}
+	return &awsClient{
+		service:     service,
+		region:      region,
+		endpoint:    fmt.Sprintf("https://%s.%s.amazonaws.com/", service, region),
+		credentials: creds,
+		signer:      v4.NewSigner(),
+		client:      &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// call sends input to the target action and decodes the answer into output
+func (c *awsClient) call(ctx context.Context, target string, input, output interface{}) error {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	creds, err := c.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get AWS credentials for %s: %v", c.service, err)
+	}
+	sum := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(sum[:]), c.service, c.region, time.Now()); err != nil {
+		return fmt.Errorf("failed to sign %s request: %v", c.service, err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %v", c.service, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s returned %s: %s", c.service, resp.Status, message)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+		return fmt.Errorf("failed to read %s response: %v", c.service, err)
+	}
+	return nil
+}
+
+// SecretsManager reads the current version of secrets from AWS Secrets Manager. Names
+// are secret names or ARNs.
+type SecretsManager struct {
+	client *awsClient
+}
+
+// NewSecretsManager creates a provider for Secrets Manager in region
+func NewSecretsManager(region string, creds aws.CredentialsProvider) (*SecretsManager, error) {
+	client, err := newAWSClient("secretsmanager", region, creds)
+	if err != nil {
+		return nil, err
+	}
+	return &SecretsManager{client: client}, nil
+}
+
+// Get implements Provider
+func (s *SecretsManager) Get(ctx context.Context, name string) (string, error) {
+	var output struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := s.client.call(ctx, "secretsmanager.GetSecretValue", map[string]string{"SecretId": name}, &output); err != nil {
+		return "", err
+	}
+	if output.SecretString == nil {
+		return "", errors.New("binary secrets are not supported: store " + name + " as a string")
+	}
+	return *output.SecretString, nil
+}
+
+// ParameterStore reads parameters from AWS Systems Manager Parameter Store, decrypting
+// SecureString parameters
+type ParameterStore struct {
+	client *awsClient
+}
+
+// NewParameterStore creates a provider for Parameter Store in region
+func NewParameterStore(region string, creds aws.CredentialsProvider) (*ParameterStore, error) {
+	client, err := newAWSClient("ssm", region, creds)
+	if err != nil {
+		return nil, err
+	}
+	return &ParameterStore{client: client}, nil
+}
+
+// Get implements Provider
+func (p *ParameterStore) Get(ctx context.Context, name string) (string, error) {
+	var output struct {
+		Parameter struct {
+			Value string `json:"Value"`
+		} `json:"Parameter"`
+	}
+	input := map[string]interface{}{"Name": name, "WithDecryption": true}
+	if err := p.client.call(ctx, "AmazonSSM.GetParameter", input, &output); err != nil {
+		return "", err
+	}
+	return output.Parameter.Value, nil
+}
@@ -0,0 +1,132 @@
+// Package secrets reads configuration values from a secrets manager. A variable holding a
+// reference such as vault:secret/data/media-center#db_password, awssm:prod/media-center#jwt
+// or ssm:/media-center/s3-secret-key is replaced by the secret it names, so credentials
+// don't have to be written into .env.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTimeout bounds one request to a secrets manager
+const requestTimeout = 10 * time.Second
+
+// Provider reads secrets from one secrets manager
+type Provider interface {
+	// Get returns the secret stored under name, a JSON object for secrets holding several values
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Reference is a parsed secret reference: provider:name, or provider:name#key to pick one
+// value of a secret holding a JSON object
+type Reference struct {
+	Provider string
+	Name     string
+	Key      string
+}
+
+// String returns the reference as it was written
+func (r Reference) String() string {
+	if r.Key == "" {
+		return r.Provider + ":" + r.Name
+	}
+	return r.Provider + ":" + r.Name + "#" + r.Key
+}
+
+// Schemes are the reference prefixes of the supported secrets managers
+var Schemes = []string{"vault", "awssm", "ssm"}
+
+// ParseReference parses value as a secret reference, reporting false when it is a plain value
+func ParseReference(value string) (Reference, bool) {
+	scheme, rest, ok := strings.Cut(value, ":")
+	if !ok || rest == "" {
+		return Reference{}, false
+	}
+	for _, known := range Schemes {
+		if scheme == known {
+			name, key, _ := strings.Cut(rest, "#")
+			return Reference{Provider: scheme, Name: name, Key: key}, name != ""
+		}
+	}
+	return Reference{}, false
+}
+
+// cached is a secret read from a provider
+type cached struct {
+	value   string
+	fetched time.Time
+}
+
+// Resolver replaces secret references by their values. Secrets are read once and reused
+// for maxAge, so the values of one JSON secret cost a single request; a maxAge of 0
+// keeps them until the resolver is discarded. It is safe for concurrent use.
+type Resolver struct {
+	providers map[string]Provider
+	maxAge    time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// NewResolver creates a resolver reading references from providers, by scheme
+func NewResolver(providers map[string]Provider, maxAge time.Duration) *Resolver {
+	return &Resolver{providers: providers, maxAge: maxAge, cache: map[string]cached{}}
+}
+
+// Resolve returns the value ref names
+func (r *Resolver) Resolve(ctx context.Context, ref Reference) (string, error) {
+	secret, err := r.get(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if ref.Key == "" {
+		return secret, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("%s:%s is not a JSON object, so it has no key %s", ref.Provider, ref.Name, ref.Key)
+	}
+	value, ok := values[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("%s:%s has no key %s", ref.Provider, ref.Name, ref.Key)
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	// Numbers, such as a port, are given as written
+	encoded, _ := json.Marshal(value)
+	return string(encoded), nil
+}
+
+// get returns the whole secret of ref, from the cache while it is fresh
+func (r *Resolver) get(ctx context.Context, ref Reference) (string, error) {
+	provider, ok := r.providers[ref.Provider]
+	if !ok {
+		return "", fmt.Errorf("the %s secrets provider is not configured", ref.Provider)
+	}
+
+	id := ref.Provider + ":" + ref.Name
+	r.mu.Lock()
+	entry, ok := r.cache[id]
+	r.mu.Unlock()
+	if ok && (r.maxAge == 0 || time.Since(entry.fetched) < r.maxAge) {
+		return entry.value, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	secret, err := provider.Get(ctx, ref.Name)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.cache[id] = cached{value: secret, fetched: time.Now()}
+	r.mu.Unlock()
+	return secret, nil
+}
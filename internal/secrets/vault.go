@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Vault reads secrets from the HashiCorp Vault KV engine, version 1 or 2. Names are API
+// paths below /v1, such as secret/data/media-center for KV version 2.
+type Vault struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+// NewVault creates a provider for the Vault server at addr, authenticating with token
+func NewVault(addr, token, namespace string) (*Vault, error) {
+	if addr == "" || token == "" {
+		return nil, errors.New("vault secrets need VAULT_ADDR and VAULT_TOKEN")
+	}
+	return &Vault{
+		addr:      strings.TrimRight(addr, "/"),
+		token:     token,
+		namespace: namespace,
+		client:    &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+// Get implements Provider, returning the secret's values as a JSON object
+func (v *Vault) Get(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.addr+"/v1/"+strings.TrimLeft(name, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach Vault: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("vault returned %s for %s: %s", resp.Status, name, message)
+	}
+
+	var secret struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to read Vault response: %v", err)
+	}
+	// KV version 2 nests the values in data.data, next to their metadata
+	if inner, ok := secret.Data["data"]; ok {
+		if _, versioned := secret.Data["metadata"]; versioned {
+			return string(inner), nil
+		}
+	}
+	values, err := json.Marshal(secret.Data)
+	return string(values), err
+}
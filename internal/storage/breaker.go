@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting a backend whose circuit breaker has
+// tripped, until its cooldown has passed
+var ErrCircuitOpen = errors.New("storage backend unavailable, circuit open")
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"    // Operations go through
+	BreakerOpen     = "open"      // Operations fail fast
+	BreakerHalfOpen = "half_open" // A single trial operation checks whether the backend is back
+)
+
+// circuitBreaker stops sending operations to a backend after threshold consecutive
+// transient failures. After cooldown one trial operation goes through, closing the
+// circuit again if the backend answers and reopening it otherwise.
+type circuitBreaker struct {
+	name      string
+	threshold int // Zero disables the breaker
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	trial    bool // The trial operation of a half-open circuit is under way
+	openedAt time.Time
+	trips    int64
+	rejected int64
+}
+
+func newCircuitBreaker(name string, threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{name: name, threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+// allow reports whether an operation may be sent to the backend. Every allowed operation
+// must be followed by done.
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			b.rejected++
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trial = true
+		return true
+	case BreakerHalfOpen:
+		if b.trial {
+			b.rejected++
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// done records the outcome of an allowed operation. Only transient failures count
+// against the backend; a missing object is a perfectly good answer. An operation the
+// caller cancelled tells nothing, so a half-open circuit waits for the next one.
+func (b *circuitBreaker) done(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errors.Is(err, context.Canceled) {
+		if b.state == BreakerHalfOpen {
+			b.trial = false
+		}
+		return
+	}
+
+	failed := err != nil && retryable(err)
+	switch {
+	case b.state == BreakerHalfOpen && b.trial:
+		b.trial = false
+		if failed {
+			b.trip(err)
+			return
+		}
+		b.state = BreakerClosed
+		b.failures = 0
+		log.Printf("Storage backend %s recovered, circuit closed", b.name)
+	case failed:
+		b.failures++
+		if b.state == BreakerClosed && b.failures >= b.threshold {
+			b.trip(err)
+		}
+	default:
+		b.failures = 0
+	}
+}
+
+// trip opens the circuit; b.mu must be held
+func (b *circuitBreaker) trip(err error) {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.trips++
+	log.Printf("Storage backend %s failing, circuit open for %s: %v", b.name, b.cooldown, err)
+}
+
+// available reports whether the breaker would let an operation through now
+func (b *circuitBreaker) available() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != BreakerOpen || time.Since(b.openedAt) >= b.cooldown
+}
+
+// fill adds the breaker's state to a health snapshot
+func (b *circuitBreaker) fill(health *BackendHealth) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	health.Breaker = b.state
+	health.BreakerTrips = b.trips
+	health.BreakerRejected = b.rejected
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		health.BreakerOpenedAt = &openedAt
+	}
+}
+
+// breakerStorage fails operations fast while the backend's circuit is open, instead of
+// making every request wait for a backend that is down
+type breakerStorage struct {
+	Storage
+	breaker *circuitBreaker
+}
+
+// guard runs op if the circuit lets it through and records its outcome
+func (s *breakerStorage) guard(op func() error) error {
+	if !s.breaker.allow() {
+		return fmt.Errorf("%s: %w", s.breaker.name, ErrCircuitOpen)
+	}
+	err := op()
+	s.breaker.done(err)
+	return err
+}
+
+// Upload implements Storage
+func (s *breakerStorage) Upload(ctx context.Context, reader io.Reader, filename string) (string, error) {
+	var path string
+	err := s.guard(func() error {
+		var err error
+		path, err = s.Storage.Upload(ctx, reader, filename)
+		return err
+	})
+	return path, err
+}
+
+// UploadWithOptions implements OptionsUploader
+func (s *breakerStorage) UploadWithOptions(ctx context.Context, reader io.Reader, filename string, opts ObjectOptions) (string, error) {
+	var path string
+	err := s.guard(func() error {
+		var err error
+		path, err = uploadWithOptions(ctx, s.Storage, reader, filename, opts)
+		return err
+	})
+	return path, err
+}
+
+// Download implements Storage
+func (s *breakerStorage) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := s.guard(func() error {
+		var err error
+		reader, err = s.Storage.Download(ctx, path)
+		return err
+	})
+	return reader, err
+}
+
+// Delete implements Storage
+func (s *breakerStorage) Delete(ctx context.Context, path string) error {
+	return s.guard(func() error {
+		return s.Storage.Delete(ctx, path)
+	})
+}
+
+// UploadBytes implements Storage
+func (s *breakerStorage) UploadBytes(ctx context.Context, data []byte, filename string) (string, error) {
+	var path string
+	err := s.guard(func() error {
+		var err error
+		path, err = s.Storage.UploadBytes(ctx, data, filename)
+		return err
+	})
+	return path, err
+}
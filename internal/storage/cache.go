@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheStats holds counters describing disk cache activity
+type CacheStats struct {
+	Hits         int64 `json:"hits"`
+	Misses       int64 `json:"misses"`
+	Evictions    int64 `json:"evictions"`
+	EvictedBytes int64 `json:"evicted_bytes"`
+	Entries      int   `json:"entries"`
+	SizeBytes    int64 `json:"size_bytes"`
+	MaxSizeBytes int64 `json:"max_size_bytes"`
+}
+
+// DiskCache is a size-bounded LRU cache of storage objects kept on local disk
+type DiskCache struct {
+	dir     string
+	maxSize int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+
+	hits         atomic.Int64
+	misses       atomic.Int64
+	evictions    atomic.Int64
+	evictedBytes atomic.Int64
+}
+
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+// NewDiskCache creates a disk cache rooted at dir, indexing any files left from a previous run
+func NewDiskCache(dir string, maxSize int64) (*DiskCache, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("cache size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %v", err)
+	}
+
+	c := &DiskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %v", err)
+	}
+
+	// Oldest files go in first so the most recently written end up at the front
+	infos := make([]os.FileInfo, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		if filepath.Ext(info.Name()) == ".tmp" {
+			os.Remove(filepath.Join(dir, info.Name()))
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().Before(infos[j].ModTime())
+	})
+	for _, info := range infos {
+		c.entries[info.Name()] = c.lru.PushFront(&cacheEntry{name: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	return c, nil
+}
+
+// Get returns a reader over the cached object, marking it as recently used
+func (c *DiskCache) Get(key string) (io.ReadCloser, bool) {
+	name := cacheFileName(key)
+
+	c.mu.Lock()
+	elem, ok := c.entries[name]
+	if !ok {
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	f, err := os.Open(filepath.Join(c.dir, name))
+	if err != nil {
+		c.removeElement(elem)
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.mu.Unlock()
+
+	c.hits.Add(1)
+	return f, true
+}
+
+// Fill stores the contents of r under key and returns a reader over the stored copy.
+// Objects larger than the cache itself are spooled to a temporary file and not retained.
+func (c *DiskCache) Fill(key string, r io.Reader) (io.ReadCloser, error) {
+	tmp, err := os.CreateTemp(c.dir, "fill-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache file: %v", err)
+	}
+
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to write cache file: %v", err)
+	}
+
+	if size > c.maxSize {
+		f, err := os.Open(tmp.Name())
+		os.Remove(tmp.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to open cache file: %v", err)
+		}
+		return f, nil
+	}
+
+	name := cacheFileName(key)
+	path := filepath.Join(c.dir, name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to store cache file: %v", err)
+	}
+
+	if elem, ok := c.entries[name]; ok {
+		entry := elem.Value.(*cacheEntry)
+		c.size -= entry.size
+		entry.size = size
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[name] = c.lru.PushFront(&cacheEntry{name: name, size: size})
+	}
+	c.size += size
+
+	// Open before evicting so the new entry can't be removed from under us
+	f, err := os.Open(path)
+	c.evict()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache file: %v", err)
+	}
+	return f, nil
+}
+
+// Remove drops key from the cache if present
+func (c *DiskCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[cacheFileName(key)]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *DiskCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries, size := len(c.entries), c.size
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+		Evictions:    c.evictions.Load(),
+		EvictedBytes: c.evictedBytes.Load(),
+		Entries:      entries,
+		SizeBytes:    size,
+		MaxSizeBytes: c.maxSize,
+	}
+}
+
+// evict removes least recently used entries until the cache fits. Callers must hold c.mu.
+func (c *DiskCache) evict() {
+	for c.size > c.maxSize {
+		elem := c.lru.Back()
+		if elem == nil {
+			return
+		}
+		entry := elem.Value.(*cacheEntry)
+		c.removeElement(elem)
+		c.evictions.Add(1)
+		c.evictedBytes.Add(entry.size)
+	}
+}
+
+// removeElement deletes an entry and its file. Callers must hold c.mu.
+func (c *DiskCache) removeElement(elem *list.Element) {
+	entry := elem.Value.(*cacheEntry)
+	c.lru.Remove(elem)
+	delete(c.entries, entry.name)
+	c.size -= entry.size
+	os.Remove(filepath.Join(c.dir, entry.name))
+}
+
+// cacheFileName maps a storage key to a flat, filesystem-safe name
+func cacheFileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CachedStorage wraps a Storage and serves downloads through a local DiskCache
+type CachedStorage struct {
+	Storage
+	cache     *DiskCache
+	namespace string
+}
+
+// NewCachedStorage wraps inner so downloads are read through cache. The namespace
+// keeps keys of different backends sharing one cache apart.
+func NewCachedStorage(inner Storage, cache *DiskCache, namespace string) *CachedStorage {
+	return &CachedStorage{Storage: inner, cache: cache, namespace: namespace}
+}
+
+// cacheKey scopes a storage path to this backend
+func (s *CachedStorage) cacheKey(path string) string {
+	return s.namespace + "/" + path
+}
+
+// Download serves path from the disk cache, fetching it from the backend on a miss
+func (s *CachedStorage) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	if reader, ok := s.cache.Get(s.cacheKey(path)); ok {
+		return reader, nil
+	}
+
+	reader, err := s.Storage.Download(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return s.cache.Fill(s.cacheKey(path), reader)
+}
+
+// Upload uploads through the backend and drops any stale cached copy of the key
+func (s *CachedStorage) Upload(ctx context.Context, reader io.Reader, filename string) (string, error) {
+	path, err := s.Storage.Upload(ctx, reader, filename)
+	if err == nil {
+		s.cache.Remove(s.cacheKey(path))
+	}
+	return path, err
+}
+
+// UploadBytes uploads through the backend and drops any stale cached copy of the key
+func (s *CachedStorage) UploadBytes(ctx context.Context, data []byte, filename string) (string, error) {
+	path, err := s.Storage.UploadBytes(ctx, data, filename)
+	if err == nil {
+		s.cache.Remove(s.cacheKey(path))
+	}
+	return path, err
+}
+
+// Delete removes the object from the backend and the cache
+func (s *CachedStorage) Delete(ctx context.Context, path string) error {
+	s.cache.Remove(s.cacheKey(path))
+	return s.Storage.Delete(ctx, path)
+}
+
+// CacheStats returns the statistics of the underlying disk cache
+func (s *CachedStorage) CacheStats() CacheStats {
+	return s.cache.Stats()
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrObjectNotFound is returned by StatObject for a key nothing was stored under
+var ErrObjectNotFound = errors.New("object not found")
+
+// DirectUploader is implemented by backends that accept uploads straight from clients
+// through presigned URLs, so large files never pass through the API server
+type DirectUploader interface {
+	// PresignUpload returns a request that stores size bytes of contentType under key
+	PresignUpload(ctx context.Context, key, contentType string, size int64, opts ObjectOptions, expiration time.Duration) (*PresignedUpload, error)
+	// StatObject describes a stored object, or returns ErrObjectNotFound
+	StatObject(ctx context.Context, key string) (*ObjectInfo, error)
+	// ReadHead returns up to n bytes from the start of an object
+	ReadHead(ctx context.Context, key string, n int) ([]byte, error)
+}
+
+// PresignedUpload is a request a client sends to store an object itself
+type PresignedUpload struct {
+	Method    string            `json:"method" example:"PUT"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"` // Signed headers the request has to carry as given
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// PresignUpload implements DirectUploader with a presigned PutObject request
+func (s *S3Storage) PresignUpload(ctx context.Context, key, contentType string, size int64, opts ObjectOptions, expiration time.Duration) (*PresignedUpload, error) {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		ContentLength: aws.Int64(size),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	// Encryption and storage class become signed headers the client has to send
+	s.applyPutSettings(input, opts)
+
+	request, err := s3.NewPresignClient(s.client).PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
+		opts.Expires = expiration
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %v", err)
+	}
+	return &PresignedUpload{
+		Method:    request.Method,
+		URL:       request.URL,
+		Headers:   signedHeaders(request.SignedHeader),
+		ExpiresAt: time.Now().Add(expiration),
+	}, nil
+}
+
+// StatObject implements DirectUploader
+func (s *S3Storage) StatObject(ctx context.Context, key string) (*ObjectInfo, error) {
+	result, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to stat object in S3: %v", err)
+	}
+	return &ObjectInfo{
+		Size:        aws.ToInt64(result.ContentLength),
+		ContentType: aws.ToString(result.ContentType),
+	}, nil
+}
+
+// ReadHead implements DirectUploader with a ranged GetObject
+func (s *S3Storage) ReadHead(ctx context.Context, key string, n int) ([]byte, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", n-1)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object from S3: %v", err)
+	}
+	defer result.Body.Close()
+	return io.ReadAll(io.LimitReader(result.Body, int64(n)))
+}
+
+// signedHeaders flattens the headers a presigned request was signed with. Host is left
+// out, as clients send it from the URL anyway.
+func signedHeaders(header map[string][]string) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if strings.EqualFold(name, "Host") {
+			continue
+		}
+		headers[name] = strings.Join(values, ",")
+	}
+	return headers
+}
+
+// MultipartUploader is implemented by direct upload backends that can take an object in
+// parts, each sent with its own presigned request, for files too large for a single one
+type MultipartUploader interface {
+	// CreateMultipartUpload starts an upload of key and returns the backend's ID for it
+	CreateMultipartUpload(ctx context.Context, key, contentType string, opts ObjectOptions) (string, error)
+	// PresignUploadPart returns a request that stores part partNumber, of size bytes
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, size int64, expiration time.Duration) (*PresignedUpload, error)
+	// CompleteMultipartUpload joins the uploaded parts into the object stored under key
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []UploadedPart) error
+	// AbortMultipartUpload discards an upload and the parts stored for it
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+}
+
+// UploadedPart identifies a stored part by the ETag the backend answered its upload with
+type UploadedPart struct {
+	PartNumber int32
+	ETag       string
+}
+
+// CreateMultipartUpload implements MultipartUploader
+func (s *S3Storage) CreateMultipartUpload(ctx context.Context, key, contentType string, opts ObjectOptions) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.StorageClass = s.objectSettings(opts)
+	input.CacheControl = objectCacheControl(key, contentType)
+
+	result, err := s.client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %v", err)
+	}
+	return aws.ToString(result.UploadId), nil
+}
+
+// PresignUploadPart implements MultipartUploader with a presigned UploadPart request
+func (s *S3Storage) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, size int64, expiration time.Duration) (*PresignedUpload, error) {
+	request, err := s3.NewPresignClient(s.client).PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(partNumber),
+		ContentLength: aws.Int64(size),
+	}, func(opts *s3.PresignOptions) {
+		opts.Expires = expiration
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign part %d: %v", partNumber, err)
+	}
+	return &PresignedUpload{
+		Method:    request.Method,
+		URL:       request.URL,
+		Headers:   signedHeaders(request.SignedHeader),
+		ExpiresAt: time.Now().Add(expiration),
+	}, nil
+}
+
+// CompleteMultipartUpload implements MultipartUploader
+func (s *S3Storage) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []UploadedPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			PartNumber: aws.Int32(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		}
+	}
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	return nil
+}
+
+// AbortMultipartUpload implements MultipartUploader
+func (s *S3Storage) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		var noSuchUpload *types.NoSuchUpload
+		if errors.As(err, &noSuchUpload) {
+			return nil
+		}
+		return fmt.Errorf("failed to abort multipart upload: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// healthSmoothing is the EWMA weight given to each new sample
+	healthSmoothing = 0.2
+	// errorRateHalfLife lets a failing backend recover its score once it stops being used
+	errorRateHalfLife = 5 * time.Minute
+	// errorPenalty scales latency by error rate so unreliable backends rank below slow ones
+	errorPenalty = 20.0
+	// failureCostMs is what every failure adds to the score, as if it were an operation
+	// that took this long, so a backend failing fast doesn't outrank a healthy slow one
+	failureCostMs = 10000.0
+	// unhealthyErrorRate leaves a backend out of upload selection while a healthier one is left
+	unhealthyErrorRate = 0.5
+	// initialLatencyMs is the neutral latency a backend without samples is scored with, so it
+	// neither wins every upload nor is starved of the samples that would rank it
+	initialLatencyMs = 100.0
+)
+
+// BackendHealth is a snapshot of a storage backend's health metrics
+type BackendHealth struct {
+	Name      string    `json:"name"`
+	Primary   bool      `json:"primary"`
+	Replica   bool      `json:"replica,omitempty"`
+	Requests  int64     `json:"requests"`
+	Errors    int64     `json:"errors"`
+	Uploads   int64     `json:"uploads"`
+	Retries   int64     `json:"retries"`           // Operations attempted again after a transient failure
+	GaveUp    int64     `json:"retries_exhausted"` // Operations that still failed transiently after every attempt
+	LatencyMs float64   `json:"latency_ms"`
+	ErrorRate float64   `json:"error_rate"`
+	Score     float64   `json:"score"`
+	LastError string    `json:"last_error,omitempty"`
+	LastCheck time.Time `json:"last_check"`
+
+	Breaker         string     `json:"breaker"`                     // closed, open or half_open
+	BreakerTrips    int64      `json:"breaker_trips"`               // Times the circuit opened
+	BreakerRejected int64      `json:"breaker_rejected"`            // Operations failed fast while open
+	BreakerOpenedAt *time.Time `json:"breaker_opened_at,omitempty"` // When the circuit last opened, unless closed
+}
+
+// healthTracker keeps exponentially weighted latency and error rate for a backend
+type healthTracker struct {
+	mu         sync.Mutex
+	requests   int64
+	errors     int64
+	uploads    int64
+	retries    int64
+	gaveUp     int64
+	latencyMs  float64
+	errorRate  float64
+	lastSample time.Time
+	lastError  string
+}
+
+// record adds the outcome of a single storage operation
+func (h *healthTracker) record(duration time.Duration, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	failed := 0.0
+	if err != nil {
+		failed = 1
+		h.errors++
+		h.lastError = err.Error()
+	}
+
+	ms := float64(duration) / float64(time.Millisecond)
+	if h.requests == 0 {
+		h.latencyMs = ms
+		h.errorRate = failed
+	} else {
+		h.errorRate = decayErrorRate(h.errorRate, now.Sub(h.lastSample))
+		h.latencyMs += healthSmoothing * (ms - h.latencyMs)
+		h.errorRate += healthSmoothing * (failed - h.errorRate)
+	}
+	h.requests++
+	h.lastSample = now
+}
+
+// recordUpload counts an upload routed to this backend by the selector
+func (h *healthTracker) recordUpload() {
+	h.mu.Lock()
+	h.uploads++
+	h.mu.Unlock()
+}
+
+// recordRetry counts an operation attempted again
+func (h *healthTracker) recordRetry() {
+	h.mu.Lock()
+	h.retries++
+	h.mu.Unlock()
+}
+
+// recordRetriesExhausted counts an operation that failed on its last attempt
+func (h *healthTracker) recordRetriesExhausted() {
+	h.mu.Lock()
+	h.gaveUp++
+	h.mu.Unlock()
+}
+
+// snapshot returns the current metrics; lower scores are healthier
+func (h *healthTracker) snapshot(now time.Time) BackendHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	errorRate := h.errorRate
+	if h.requests > 0 {
+		errorRate = decayErrorRate(errorRate, now.Sub(h.lastSample))
+	}
+
+	latency := h.latencyMs
+	if h.requests == 0 {
+		latency = initialLatencyMs
+	}
+
+	return BackendHealth{
+		Requests:  h.requests,
+		Errors:    h.errors,
+		Uploads:   h.uploads,
+		Retries:   h.retries,
+		GaveUp:    h.gaveUp,
+		LatencyMs: h.latencyMs,
+		ErrorRate: errorRate,
+		Score:     latency*(1+errorPenalty*errorRate) + failureCostMs*errorRate,
+		LastError: h.lastError,
+		LastCheck: h.lastSample,
+	}
+}
+
+// decayErrorRate halves the error rate for every errorRateHalfLife without samples
+func decayErrorRate(rate float64, idle time.Duration) float64 {
+	if idle <= 0 {
+		return rate
+	}
+	return rate * math.Pow(0.5, float64(idle)/float64(errorRateHalfLife))
+}
+
+// monitoredStorage records latency and errors of backend operations into a healthTracker
+type monitoredStorage struct {
+	Storage
+	health *healthTracker
+}
+
+// observe times a storage call and records its outcome. A key that is taken is the
+// caller's mistake, so the backend answered fine, and a call the caller cancelled says
+// nothing about the backend at all.
+func (s *monitoredStorage) observe(start time.Time, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if errors.Is(err, ErrObjectExists) {
+		err = nil
+	}
+	s.health.record(time.Since(start), err)
+}
+
+// Upload implements Storage
+func (s *monitoredStorage) Upload(ctx context.Context, reader io.Reader, filename string) (string, error) {
+	start := time.Now()
+	path, err := s.Storage.Upload(ctx, reader, filename)
+	s.observe(start, err)
+	return path, err
+}
+
+// Download implements Storage. Callers probe for objects that may not exist (e.g. cached
+// derivatives), so a missing object counts as a good answer; other failures are scored.
+func (s *monitoredStorage) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := s.Storage.Download(ctx, path)
+	if missingObject(err) {
+		s.observe(start, nil)
+	} else {
+		s.observe(start, err)
+	}
+	return reader, err
+}
+
+// Delete implements Storage
+func (s *monitoredStorage) Delete(ctx context.Context, path string) error {
+	start := time.Now()
+	err := s.Storage.Delete(ctx, path)
+	s.observe(start, err)
+	return err
+}
+
+// UploadBytes implements Storage
+func (s *monitoredStorage) UploadBytes(ctx context.Context, data []byte, filename string) (string, error) {
+	start := time.Now()
+	path, err := s.Storage.UploadBytes(ctx, data, filename)
+	s.observe(start, err)
+	return path, err
+}
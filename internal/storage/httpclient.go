@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-media-center-example/internal/config"
+)
+
+var (
+	httpClient     *http.Client
+	httpClientOnce sync.Once
+)
+
+// sharedHTTPClient returns the client every remote backend sends its requests with, so
+// connections to a backend are pooled and reused across requests. It bounds connecting
+// and waiting for response headers, never reading the body, so large objects can stream.
+func sharedHTTPClient() *http.Client {
+	httpClientOnce.Do(func() {
+		cfg := config.GetConfig().Storage.HTTP
+		dialer := &net.Dialer{Timeout: cfg.ConnectTimeout, KeepAlive: 30 * time.Second}
+		httpClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 http.ProxyFromEnvironment,
+				DialContext:           dialer.DialContext,
+				ForceAttemptHTTP2:     true,
+				MaxIdleConnsPerHost:   max(cfg.MaxIdleConns, 1),
+				IdleConnTimeout:       cfg.IdleTimeout,
+				TLSHandshakeTimeout:   cfg.ConnectTimeout,
+				ResponseHeaderTimeout: cfg.ResponseTimeout,
+				ExpectContinueTimeout: time.Second,
+			},
+		}
+	})
+	return httpClient
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// ListedObject is an object found by listing a backend
+type ListedObject struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+// ObjectLister is implemented by backends that can enumerate the objects they store
+type ObjectLister interface {
+	// ListObjects calls visit with successive pages of objects until all were listed or
+	// visit fails
+	ListObjects(ctx context.Context, visit func([]ListedObject) error) error
+}
+
+// ListObjects implements ObjectLister
+func (s *S3Storage) ListObjects(ctx context.Context, visit func([]ListedObject) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list S3 objects: %v", err)
+		}
+
+		objects := make([]ListedObject, 0, len(page.Contents))
+		for _, object := range page.Contents {
+			objects = append(objects, ListedObject{
+				Key:          aws.ToString(object.Key),
+				Size:         aws.ToInt64(object.Size),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+		}
+		if err := visit(objects); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListBackendObjects lists the objects of the named backend. It returns false when the
+// backend can't enumerate its objects.
+func ListBackendObjects(ctx context.Context, name string, visit func([]ListedObject) error) (bool, error) {
+	initBackends()
+	b, ok := backendIndex[name]
+	if !ok {
+		return false, fmt.Errorf("unknown storage backend: %s", name)
+	}
+	lister, ok := b.raw.(ObjectLister)
+	if !ok {
+		return false, nil
+	}
+	return true, lister.ListObjects(ctx, visit)
+}
+
+// ObjectExists reports whether path is stored on the named backend, resolving names the
+// way GetBackend does
+func ObjectExists(ctx context.Context, name, path string) (bool, error) {
+	initBackends()
+	b, ok := backendIndex[name]
+	if !ok {
+		b = backends[0]
+	}
+	return objectExists(ctx, b.raw, path)
+}
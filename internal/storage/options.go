@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"go-media-center-example/internal/config"
+)
+
+// Server-side encryption modes of S3 objects
+const (
+	EncryptionS3  = "AES256"  // SSE-S3, keys managed by S3
+	EncryptionKMS = "aws:kms" // SSE-KMS, with the configured KMS key or the account default
+)
+
+// Encryptions are the accepted server-side encryption modes
+var Encryptions = []string{EncryptionS3, EncryptionKMS}
+
+// StorageClasses are the accepted S3 storage classes. Archive classes whose objects
+// have to be restored before reading are left out, as media must stay servable.
+var StorageClasses = []string{"STANDARD", "STANDARD_IA", "ONEZONE_IA", "INTELLIGENT_TIERING", "GLACIER_IR"}
+
+// ErrObjectOptionsUnsupported is returned when options are requested from backends that can't apply them
+var ErrObjectOptionsUnsupported = errors.New("no storage backend supports storage class or encryption options")
+
+// ObjectOptions override how a backend stores an object by default
+type ObjectOptions struct {
+	StorageClass string `json:"storage_class,omitempty"`
+	Encryption   string `json:"encryption,omitempty"`
+}
+
+// IsZero reports whether no option is set
+func (o ObjectOptions) IsZero() bool {
+	return o == ObjectOptions{}
+}
+
+// Validate checks the options against the accepted values
+func (o ObjectOptions) Validate() error {
+	if o.StorageClass != "" && !slices.Contains(StorageClasses, o.StorageClass) {
+		return fmt.Errorf("storage class %q is not one of %s", o.StorageClass, strings.Join(StorageClasses, ", "))
+	}
+	if o.Encryption != "" && !slices.Contains(Encryptions, o.Encryption) {
+		return fmt.Errorf("encryption %q is not one of %s", o.Encryption, strings.Join(Encryptions, ", "))
+	}
+	return nil
+}
+
+// OptionsUploader is implemented by backends that can store an object with ObjectOptions
+type OptionsUploader interface {
+	UploadWithOptions(ctx context.Context, reader io.Reader, filename string, opts ObjectOptions) (string, error)
+}
+
+// uploadWithOptions stores an object through provider with opts, failing when provider
+// can't apply them
+func uploadWithOptions(ctx context.Context, provider Storage, reader io.Reader, filename string, opts ObjectOptions) (string, error) {
+	uploader, ok := provider.(OptionsUploader)
+	if !ok {
+		return "", ErrObjectOptionsUnsupported
+	}
+	return uploader.UploadWithOptions(ctx, reader, filename, opts)
+}
+
+// optionsStorage applies ObjectOptions to every object stored through it
+type optionsStorage struct {
+	Storage
+	opts ObjectOptions
+}
+
+// Upload implements Storage
+func (s *optionsStorage) Upload(ctx context.Context, reader io.Reader, filename string) (string, error) {
+	return uploadWithOptions(ctx, s.Storage, reader, filename, s.opts)
+}
+
+// UploadBytes implements Storage
+func (s *optionsStorage) UploadBytes(ctx context.Context, data []byte, filename string) (string, error) {
+	return uploadWithOptions(ctx, s.Storage, bytes.NewReader(data), filename, s.opts)
+}
+
+// SelectUploadBackendWith picks the backend for an upload stored with opts, the way
+// SelectUploadBackend does but among the backends that can apply them. The returned
+// storage applies opts to what is uploaded through it.
+func SelectUploadBackendWith(opts ObjectOptions) (string, Storage, error) {
+	if opts.IsZero() {
+		name, provider := SelectUploadBackend()
+		return name, provider, nil
+	}
+
+	initBackends()
+	var candidates []*backend
+	for _, b := range uploadBackends() {
+		if _, ok := b.raw.(OptionsUploader); ok {
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil, ErrObjectOptionsUnsupported
+	}
+
+	selected := selectBackend(candidates)
+	selected.health.recordUpload()
+	return selected.name, &optionsStorage{Storage: selected.storage, opts: opts}, nil
+}
+
+// UploadWithOptions implements OptionsUploader
+func (s *monitoredStorage) UploadWithOptions(ctx context.Context, reader io.Reader, filename string, opts ObjectOptions) (string, error) {
+	start := time.Now()
+	path, err := uploadWithOptions(ctx, s.Storage, reader, filename, opts)
+	s.observe(start, err)
+	return path, err
+}
+
+// UploadWithOptions implements OptionsUploader
+func (s *replicatedStorage) UploadWithOptions(ctx context.Context, reader io.Reader, filename string, opts ObjectOptions) (string, error) {
+	path, err := uploadWithOptions(ctx, s.Storage, reader, filename, opts)
+	if err == nil {
+		s.replicator.enqueue(replicationTask{source: s.Storage, path: path})
+	}
+	return path, err
+}
+
+// UploadWithOptions implements OptionsUploader
+func (s *CachedStorage) UploadWithOptions(ctx context.Context, reader io.Reader, filename string, opts ObjectOptions) (string, error) {
+	path, err := uploadWithOptions(ctx, s.Storage, reader, filename, opts)
+	if err == nil {
+		s.cache.Remove(s.cacheKey(path))
+	}
+	return path, err
+}
+
+// UploadWithOptions implements OptionsUploader
+func (s *S3Storage) UploadWithOptions(ctx context.Context, reader io.Reader, filename string, opts ObjectOptions) (string, error) {
+	return s.put(ctx, reader, filename, opts)
+}
+
+// objectSettings returns the encryption, KMS key and storage class an object is stored
+// with: those set in opts, otherwise the configured defaults
+func (s *S3Storage) objectSettings(opts ObjectOptions) (types.ServerSideEncryption, *string, types.StorageClass) {
+	encryption := s.encryption
+	if opts.Encryption != "" {
+		encryption = opts.Encryption
+	}
+	var kmsKeyID *string
+	if encryption == EncryptionKMS && s.kmsKeyID != "" {
+		kmsKeyID = aws.String(s.kmsKeyID)
+	}
+	storageClass := s.storageClass
+	if opts.StorageClass != "" {
+		storageClass = opts.StorageClass
+	}
+	return types.ServerSideEncryption(encryption), kmsKeyID, types.StorageClass(storageClass)
+}
+
+// applyPutSettings sets encryption, storage class and cache policy on an upload
+func (s *S3Storage) applyPutSettings(input *s3.PutObjectInput, opts ObjectOptions) {
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.StorageClass = s.objectSettings(opts)
+	input.CacheControl = objectCacheControl(aws.ToString(input.Key), "")
+}
+
+// objectCacheControl returns the Cache-Control a CDN in front of the bucket serves an
+// object with, by contentType or else the type of the key's extension; nil without a
+// matching policy
+func objectCacheControl(key, contentType string) *string {
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if cacheControl := config.GetConfig().CDN.CacheControl.For(contentType); cacheControl != "" {
+		return aws.String(cacheControl)
+	}
+	return nil
+}
+
+// StorageClassChanger is implemented by backends that can move a stored object to
+// another storage class
+type StorageClassChanger interface {
+	SetStorageClass(ctx context.Context, path, storageClass string) error
+}
+
+// SetStorageClass implements StorageClassChanger by copying the object onto itself.
+// The copy is encrypted with the configured default.
+func (s *S3Storage) SetStorageClass(ctx context.Context, path, storageClass string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(path),
+		CopySource:        aws.String(s.bucket + "/" + url.PathEscape(path)),
+		MetadataDirective: types.MetadataDirectiveCopy,
+	}
+	input.ServerSideEncryption, input.SSEKMSKeyId, input.StorageClass = s.objectSettings(ObjectOptions{StorageClass: storageClass})
+	if _, err := s.client.CopyObject(ctx, input); err != nil {
+		return fmt.Errorf("failed to change storage class: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/database"
+	"go-media-center-example/internal/models"
+)
+
+// Purge job statuses
+const (
+	PurgeRunning   = "running"
+	PurgeCompleted = "completed"
+)
+
+const (
+	// purgeJobRetention is how long finished jobs stay queryable
+	purgeJobRetention = time.Hour
+	// maxPurgeFailures caps the failures reported per job
+	maxPurgeFailures = 1000
+	// purgeRetryDelay is the backoff before the first retry; it doubles on every attempt
+	purgeRetryDelay = 500 * time.Millisecond
+	// purgeInsertBatch is how many items of a job are recorded per statement
+	purgeInsertBatch = 500
+)
+
+// PurgeObject identifies a stored object to delete
+type PurgeObject struct {
+	Backend string
+	Path    string
+	Ref     string // What the object belonged to, e.g. a media ID; reported on failure
+}
+
+// PurgeFailure describes an object that could not be deleted
+type PurgeFailure struct {
+	Ref   string `json:"ref,omitempty"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// PurgeJob reports the progress of an asynchronous deletion
+type PurgeJob struct {
+	ID          string         `json:"id"`
+	OwnerID     uint           `json:"-"`
+	Status      string         `json:"status"`
+	Total       int            `json:"total"`
+	Deleted     int            `json:"deleted"`
+	Failed      int            `json:"failed"`
+	Failures    []PurgeFailure `json:"failures,omitempty"`
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at,omitempty"`
+}
+
+// purgeTask is one object of a job waiting for a worker
+type purgeTask struct {
+	jobID  string
+	itemID uint
+	object PurgeObject
+}
+
+// purger deletes objects with a fixed number of workers sharing one rate limit. Jobs and
+// their objects are recorded in the database, which workers update as they go.
+type purger struct {
+	tasks   chan purgeTask
+	limiter *time.Ticker
+	retries int
+}
+
+var (
+	purgeWorker *purger
+	purgeOnce   sync.Once
+)
+
+// getPurger starts the deletion workers on first use
+func getPurger() *purger {
+	purgeOnce.Do(func() {
+		cfg := config.GetConfig().Storage.Purge
+		workers := max(1, cfg.Workers)
+		rate := max(1, cfg.Rate)
+
+		purgeWorker = &purger{
+			tasks:   make(chan purgeTask, workers),
+			limiter: time.NewTicker(time.Second / time.Duration(rate)),
+			retries: max(0, cfg.MaxRetries),
+		}
+		for i := 0; i < workers; i++ {
+			go purgeWorker.work()
+		}
+	})
+	return purgeWorker
+}
+
+// SubmitPurge records objects for deletion and returns without waiting for them to be
+// deleted. The returned job can be looked up with GetPurgeJob to follow progress, and
+// survives restarts. Objects that can't be recorded are still deleted, untracked.
+func SubmitPurge(ownerID uint, objects []PurgeObject) PurgeJob {
+	p := getPurger()
+	db := database.GetDB()
+	now := time.Now()
+
+	job := models.PurgeJob{
+		ID:        newPurgeID(),
+		OwnerID:   ownerID,
+		Status:    PurgeRunning,
+		Total:     len(objects),
+		StartedAt: now,
+	}
+	if len(objects) == 0 {
+		job.Status = PurgeCompleted
+		job.CompletedAt = &now
+	}
+	items := make([]models.PurgeItem, len(objects))
+	for i, object := range objects {
+		items[i] = models.PurgeItem{JobID: job.ID, Backend: object.Backend, Path: object.Path, Ref: object.Ref, Status: models.PurgeItemPending}
+	}
+
+	db.Where("completed_at < ?", now.Add(-purgeJobRetention)).Delete(&models.PurgeJob{})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&job).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&items, purgeInsertBatch).Error
+	})
+	if err != nil {
+		log.Printf("Failed to record purge job %s, deleting its objects untracked: %v", job.ID, err)
+		for i := range items {
+			items[i].ID = 0
+		}
+	}
+
+	// Feed the queue in the background so large purges don't block the request
+	go func() {
+		for i, object := range objects {
+			p.tasks <- purgeTask{jobID: job.ID, itemID: items[i].ID, object: object}
+		}
+	}()
+
+	return newPurgeJob(&job, 0, 0, nil)
+}
+
+// ResumePurges queues the objects of purge jobs a restart interrupted. It is meant to run
+// once at startup. With several instances starting together an object may be deleted
+// twice, which is harmless.
+func ResumePurges() {
+	p := getPurger()
+	db := database.GetDB()
+
+	var jobs []models.PurgeJob
+	if err := db.Where("status = ?", PurgeRunning).Order("started_at").Find(&jobs).Error; err != nil {
+		log.Printf("Failed to load interrupted purge jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		var items []models.PurgeItem
+		if err := db.Where("job_id = ? AND status = ?", job.ID, models.PurgeItemPending).Order("id").Find(&items).Error; err != nil {
+			log.Printf("Failed to load items of purge job %s: %v", job.ID, err)
+			continue
+		}
+		if len(items) == 0 {
+			completePurgeJob(job.ID)
+			continue
+		}
+		log.Printf("Resuming purge job %s (%d objects left)", job.ID, len(items))
+		for _, item := range items {
+			p.tasks <- purgeTask{jobID: job.ID, itemID: item.ID, object: PurgeObject{Backend: item.Backend, Path: item.Path, Ref: item.Ref}}
+		}
+	}
+}
+
+// GetPurgeJob returns the current progress of a purge job owned by ownerID
+func GetPurgeJob(ownerID uint, id string) (PurgeJob, bool) {
+	db := database.GetDB()
+
+	var job models.PurgeJob
+	if err := db.Where("id = ? AND owner_id = ?", id, ownerID).First(&job).Error; err != nil {
+		return PurgeJob{}, false
+	}
+	var deleted, failed int64
+	db.Model(&models.PurgeItem{}).Where("job_id = ? AND status = ?", id, models.PurgeItemDeleted).Count(&deleted)
+	db.Model(&models.PurgeItem{}).Where("job_id = ? AND status = ?", id, models.PurgeItemFailed).Count(&failed)
+
+	var failures []models.PurgeItem
+	if failed > 0 {
+		db.Where("job_id = ? AND status = ?", id, models.PurgeItemFailed).Order("id").Limit(maxPurgeFailures).Find(&failures)
+	}
+	return newPurgeJob(&job, int(deleted), int(failed), failures), true
+}
+
+// newPurgeJob reports the progress of a recorded job
+func newPurgeJob(job *models.PurgeJob, deleted, failed int, failures []models.PurgeItem) PurgeJob {
+	report := PurgeJob{
+		ID:          job.ID,
+		OwnerID:     job.OwnerID,
+		Status:      job.Status,
+		Total:       job.Total,
+		Deleted:     deleted,
+		Failed:      failed,
+		StartedAt:   job.StartedAt,
+		CompletedAt: job.CompletedAt,
+	}
+	for _, item := range failures {
+		report.Failures = append(report.Failures, PurgeFailure{Ref: item.Ref, Path: item.Path, Error: item.Error})
+	}
+	return report
+}
+
+// work deletes queued objects until the process exits
+func (p *purger) work() {
+	for task := range p.tasks {
+		err := p.delete(task.object)
+		if task.itemID == 0 {
+			if err != nil {
+				log.Printf("Failed to purge %s: %v", task.object.Path, err)
+			}
+			continue
+		}
+
+		updates := map[string]interface{}{"status": models.PurgeItemDeleted}
+		if err != nil {
+			updates = map[string]interface{}{"status": models.PurgeItemFailed, "error": err.Error()}
+		}
+		if err := database.GetDB().Model(&models.PurgeItem{}).Where("id = ?", task.itemID).Updates(updates).Error; err != nil {
+			log.Printf("Failed to update purge item %d: %v", task.itemID, err)
+			continue
+		}
+		completePurgeJob(task.jobID)
+	}
+}
+
+// completePurgeJob marks a job completed once none of its objects is left to delete
+func completePurgeJob(id string) {
+	db := database.GetDB()
+	result := db.Model(&models.PurgeJob{}).
+		Where("id = ? AND status = ?", id, PurgeRunning).
+		Where("NOT EXISTS (SELECT 1 FROM purge_items WHERE job_id = ? AND status = ?)", id, models.PurgeItemPending).
+		Updates(map[string]interface{}{"status": PurgeCompleted, "completed_at": time.Now()})
+	if result.Error != nil {
+		log.Printf("Failed to complete purge job %s: %v", id, result.Error)
+		return
+	}
+	if result.RowsAffected == 1 {
+		log.Printf("Purge job %s finished", id)
+	}
+}
+
+// delete removes one object, retrying with exponential backoff. Storage errors carry no
+// type information, so every failure is treated as transient until retries run out.
+// Objects on a backend that isn't configured fail right away rather than being looked
+// for on the primary backend, where another object may have the same path.
+func (p *purger) delete(object PurgeObject) error {
+	if object.Backend != "" && !BackendExists(object.Backend) {
+		return fmt.Errorf("storage backend %q is not configured", object.Backend)
+	}
+	provider := GetBackend(object.Backend)
+	delay := purgeRetryDelay
+
+	var err error
+	for attempt := 0; attempt <= p.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		<-p.limiter.C
+		if err = provider.Delete(context.Background(), object.Path); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// newPurgeID returns a random job identifier
+func newPurgeID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// RangeReader is implemented by backends that read part of an object, so resumed
+// downloads don't fetch what the client already has
+type RangeReader interface {
+	// DownloadRange returns length bytes of an object starting at offset
+	DownloadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+}
+
+// DownloadRange implements RangeReader with a ranged GetObject
+func (s *S3Storage) DownloadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file from S3: %w", err)
+	}
+	return result.Body, nil
+}
+
+// DownloadRange implements RangeReader with a Range request to the filer
+func (s *SeaweedFSStorage) DownloadRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.filerURL+"/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file from SeaweedFS: %w", err)
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// The whole file came back, so skip to the range
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to download file from SeaweedFS: %w", err)
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.LimitReader(resp.Body, length), resp.Body}, nil
+	default:
+		resp.Body.Close()
+		return nil, statusError("failed to download file from SeaweedFS", resp)
+	}
+}
@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"go-media-center-example/internal/config"
+)
+
+// backend is a configured storage provider together with its health metrics
+type backend struct {
+	name      string
+	storage   Storage
+	raw       Storage // The provider without health monitoring and caching
+	monitored Storage // The provider with health monitoring only
+	health    *healthTracker
+	breaker   *circuitBreaker
+	replica   bool // Receives copies of the other backends' objects, never uploads
+}
+
+var (
+	backends     []*backend
+	backendIndex map[string]*backend
+	diskCache    *DiskCache
+	backendsOnce sync.Once
+
+	overrideMu     sync.RWMutex
+	uploadOverride string
+)
+
+// initBackends builds every configured backend once. The primary provider is always first.
+func initBackends() {
+	backendsOnce.Do(func() {
+		cfg := config.GetConfig()
+
+		if cfg.Storage.Cache.Enabled {
+			var err error
+			diskCache, err = NewDiskCache(cfg.Storage.Cache.Dir, cfg.Storage.Cache.MaxSize)
+			if err != nil {
+				panic(fmt.Sprintf("Failed to initialize storage cache: %v", err))
+			}
+		}
+
+		replicaName := cfg.Storage.Replication.Replica
+		if replicaName == cfg.Storage.Provider {
+			log.Printf("Storage replica %s is the primary provider, replication disabled", replicaName)
+			replicaName = ""
+		}
+
+		names := []string{cfg.Storage.Provider}
+		for _, name := range cfg.Storage.Backends {
+			if name != cfg.Storage.Provider {
+				names = append(names, name)
+			}
+		}
+		if replicaName != "" {
+			names = append(names, replicaName)
+		}
+
+		backendIndex = make(map[string]*backend, len(names))
+		for _, name := range names {
+			if _, exists := backendIndex[name]; exists {
+				continue
+			}
+
+			provider, err := newConfiguredStorage(name, cfg)
+			if err != nil {
+				panic(fmt.Sprintf("Failed to initialize storage provider %s: %v", name, err))
+			}
+
+			health := &healthTracker{}
+			b := &backend{
+				name:      name,
+				raw:       provider,
+				monitored: &monitoredStorage{Storage: provider, health: health},
+				health:    health,
+				breaker:   newCircuitBreaker(name, cfg.Storage.Breaker.Threshold, cfg.Storage.Breaker.Cooldown),
+				replica:   name == replicaName,
+			}
+			backends = append(backends, b)
+			backendIndex[name] = b
+		}
+
+		// The replica has to exist before the other backends can mirror onto it
+		if replicaName != "" {
+			replication = startReplication(backendIndex[replicaName], cfg.Storage.Replication)
+		}
+		for _, b := range backends {
+			// Retries wrap the health monitoring, so every failed attempt is scored
+			b.storage = &retryingStorage{Storage: b.monitored, health: b.health, policy: cfg.Storage.Retry}
+			// The breaker counts operations that failed after their retries, and reads
+			// it fails fast fall back to the replica
+			b.storage = &breakerStorage{Storage: b.storage, breaker: b.breaker}
+			if replication != nil && !b.replica {
+				b.storage = &replicatedStorage{Storage: b.storage, replicator: replication}
+			}
+			if diskCache != nil {
+				b.storage = NewCachedStorage(b.storage, diskCache, b.name)
+			}
+		}
+	})
+}
+
+// Init builds the configured backends, which otherwise happens on first use, so a provider
+// that can't be set up stops startup instead of failing requests
+func Init() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	initBackends()
+	return nil
+}
+
+// uploadBackends returns the backends new objects may be stored on, leaving out the replica
+func uploadBackends() []*backend {
+	candidates := make([]*backend, 0, len(backends))
+	for _, b := range backends {
+		if !b.replica {
+			candidates = append(candidates, b)
+		}
+	}
+	return candidates
+}
+
+// GetBackend returns the named storage backend. An empty or unknown name resolves to
+// the primary provider, which keeps media stored before multi-backend support readable.
+func GetBackend(name string) Storage {
+	initBackends()
+	if b, ok := backendIndex[name]; ok {
+		return b.storage
+	}
+	if name != "" {
+		log.Printf("Storage backend %q is not configured, falling back to %s", name, backends[0].name)
+	}
+	return backends[0].storage
+}
+
+// BackendExists reports whether a storage backend of that name is configured
+func BackendExists(name string) bool {
+	initBackends()
+	_, ok := backendIndex[name]
+	return ok
+}
+
+// PrimaryBackend returns the name of the primary storage provider
+func PrimaryBackend() string {
+	initBackends()
+	return backends[0].name
+}
+
+// SelectUploadBackend picks the backend new uploads should go to: the manual override
+// if one is set, otherwise the backend with the best health score
+func SelectUploadBackend() (string, Storage) {
+	initBackends()
+	selected := selectBackend(uploadBackends())
+	selected.health.recordUpload()
+	return selected.name, selected.storage
+}
+
+// SelectDirectUploadBackend picks the backend for an upload clients send straight to
+// storage, the way SelectUploadBackend does but among the backends that accept them.
+// It returns false when none does.
+func SelectDirectUploadBackend() (string, DirectUploader, bool) {
+	initBackends()
+
+	var candidates []*backend
+	for _, b := range uploadBackends() {
+		if _, ok := b.raw.(DirectUploader); ok {
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil, false
+	}
+
+	selected := selectBackend(candidates)
+	selected.health.recordUpload()
+	return selected.name, selected.raw.(DirectUploader), true
+}
+
+// DirectUploadBackend returns the direct upload support of the named backend
+func DirectUploadBackend(name string) (DirectUploader, bool) {
+	initBackends()
+	b, ok := backendIndex[name]
+	if !ok {
+		return nil, false
+	}
+	uploader, ok := b.raw.(DirectUploader)
+	return uploader, ok
+}
+
+// RangeBackend returns the ranged reads of the named backend, resolving names the way
+// GetBackend does
+func RangeBackend(name string) (RangeReader, bool) {
+	initBackends()
+	b, ok := backendIndex[name]
+	if !ok {
+		b = backends[0]
+	}
+	reader, ok := b.raw.(RangeReader)
+	return reader, ok
+}
+
+// StorageClassBackends returns the names of the backends objects can change storage
+// class on. The primary provider is also listed as "", the name of media stored before
+// multi-backend support.
+func StorageClassBackends() []string {
+	initBackends()
+	var names []string
+	for i, b := range backends {
+		if _, ok := b.raw.(StorageClassChanger); !ok || b.replica {
+			continue
+		}
+		if i == 0 {
+			names = append(names, "")
+		}
+		names = append(names, b.name)
+	}
+	return names
+}
+
+// StorageClassBackend returns the storage class support of the named backend, resolving
+// names the way GetBackend does
+func StorageClassBackend(name string) (StorageClassChanger, bool) {
+	initBackends()
+	b, ok := backendIndex[name]
+	if !ok {
+		b = backends[0]
+	}
+	changer, ok := b.raw.(StorageClassChanger)
+	return changer, ok
+}
+
+// selectBackend returns the candidate uploads are pinned to, if any, otherwise the one
+// with the best health score among those whose circuit isn't open
+func selectBackend(candidates []*backend) *backend {
+	overrideMu.RLock()
+	override := uploadOverride
+	overrideMu.RUnlock()
+
+	for _, b := range candidates {
+		if b.name == override {
+			return b
+		}
+	}
+
+	available := make([]*backend, 0, len(candidates))
+	for _, b := range candidates {
+		if b.breaker.available() {
+			available = append(available, b)
+		}
+	}
+	if len(available) > 0 {
+		candidates = available
+	}
+
+	// Backends failing most operations only get uploads when every backend does
+	now := time.Now()
+	healthy := make([]*backend, 0, len(candidates))
+	for _, b := range candidates {
+		if b.health.snapshot(now).ErrorRate <= unhealthyErrorRate {
+			healthy = append(healthy, b)
+		}
+	}
+	if len(healthy) > 0 {
+		candidates = healthy
+	}
+
+	selected := candidates[0]
+	best := selected.health.snapshot(now).Score
+	for _, b := range candidates[1:] {
+		if score := b.health.snapshot(now).Score; score < best {
+			selected, best = b, score
+		}
+	}
+	return selected
+}
+
+// SetUploadOverride pins new uploads to the named backend; an empty name restores automatic selection
+func SetUploadOverride(name string) error {
+	initBackends()
+	if name != "" {
+		b, ok := backendIndex[name]
+		if !ok {
+			return fmt.Errorf("unknown storage backend: %s", name)
+		}
+		if b.replica {
+			return fmt.Errorf("storage backend %s is the replica and takes no uploads", name)
+		}
+	}
+
+	overrideMu.Lock()
+	uploadOverride = name
+	overrideMu.Unlock()
+	return nil
+}
+
+// UploadOverride returns the backend uploads are pinned to, if any
+func UploadOverride() string {
+	overrideMu.RLock()
+	defer overrideMu.RUnlock()
+	return uploadOverride
+}
+
+// BackendsHealth returns health metrics for every configured backend, healthiest first
+func BackendsHealth() []BackendHealth {
+	initBackends()
+
+	now := time.Now()
+	result := make([]BackendHealth, 0, len(backends))
+	for i, b := range backends {
+		health := b.health.snapshot(now)
+		health.Name = b.name
+		health.Primary = i == 0
+		health.Replica = b.replica
+		b.breaker.fill(&health)
+		result = append(result, health)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Score < result[j].Score
+	})
+	return result
+}
+
+// BreakerStates returns the circuit breaker state of every configured backend by name
+func BreakerStates() map[string]string {
+	initBackends()
+
+	states := make(map[string]string, len(backends))
+	for _, b := range backends {
+		b.breaker.mu.Lock()
+		states[b.name] = b.breaker.state
+		b.breaker.mu.Unlock()
+	}
+	return states
+}
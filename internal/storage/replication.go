@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-media-center-example/internal/config"
+)
+
+const (
+	// replicationQueueSize bounds the mirror operations waiting for a worker. Operations
+	// beyond it are dropped and left to reconciliation, so writes never wait on the replica.
+	replicationQueueSize = 10000
+	// replicationRetryDelay is the backoff before the first retry; it doubles on every attempt
+	replicationRetryDelay = time.Second
+	// maxMissingReplicas caps the missing objects listed in a reconcile report
+	maxMissingReplicas = 1000
+)
+
+// Reconcile statuses
+const (
+	ReconcileRunning   = "running"
+	ReconcileCompleted = "completed"
+	ReconcileFailed    = "failed"
+)
+
+// ErrReconcileRunning is returned when a reconciliation is started while one is running
+var ErrReconcileRunning = errors.New("reconciliation already running")
+
+// ReplicaObject is a stored object whose replica reconciliation checks
+type ReplicaObject struct {
+	Backend string `json:"backend"`
+	Path    string `json:"path"`
+	Ref     string `json:"ref,omitempty"` // What the object belongs to, e.g. a media ID
+}
+
+// ReconcileReport is the outcome of checking the replica for missing objects
+type ReconcileReport struct {
+	Status      string          `json:"status"`
+	Repair      bool            `json:"repair"` // Missing objects are copied again
+	Checked     int             `json:"checked"`
+	Missing     int             `json:"missing"`
+	Errors      int             `json:"errors"` // Objects the replica couldn't be asked about
+	Objects     []ReplicaObject `json:"missing_objects,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	StartedAt   time.Time       `json:"started_at"`
+	CompletedAt *time.Time      `json:"completed_at,omitempty"`
+}
+
+// ReplicationStatus reports the work of the replicator
+type ReplicationStatus struct {
+	Replica       string           `json:"replica"`
+	Pending       int              `json:"pending"`
+	Replicated    int64            `json:"replicated"`
+	Deleted       int64            `json:"deleted"`
+	Failed        int64            `json:"failed"`
+	Dropped       int64            `json:"dropped"` // Not queued because the queue was full
+	Fallbacks     int64            `json:"fallbacks"`
+	LastError     string           `json:"last_error,omitempty"`
+	LastReconcile *ReconcileReport `json:"last_reconcile,omitempty"`
+}
+
+// replicationTask copies an object to the replica, or deletes it there
+type replicationTask struct {
+	source Storage
+	path   string
+	delete bool
+}
+
+// replicator mirrors writes of the upload backends onto the replica in the background
+type replicator struct {
+	replica *backend
+	tasks   chan replicationTask
+	retries int
+
+	replicated atomic.Int64
+	deleted    atomic.Int64
+	failed     atomic.Int64
+	dropped    atomic.Int64
+	fallbacks  atomic.Int64
+
+	mu        sync.Mutex
+	lastError string
+	report    *ReconcileReport
+}
+
+// replication is nil unless STORAGE_REPLICA names a provider
+var replication *replicator
+
+// startReplication starts the mirror workers for the replica backend
+func startReplication(replica *backend, cfg config.ReplicationConfig) *replicator {
+	r := &replicator{
+		replica: replica,
+		tasks:   make(chan replicationTask, replicationQueueSize),
+		retries: max(0, cfg.MaxRetries),
+	}
+	for i := 0; i < max(1, cfg.Workers); i++ {
+		go r.work()
+	}
+	return r
+}
+
+// enqueue hands an operation to the workers without waiting for room in the queue
+func (r *replicator) enqueue(task replicationTask) {
+	select {
+	case r.tasks <- task:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// work mirrors queued operations until the process exits
+func (r *replicator) work() {
+	for task := range r.tasks {
+		if err := r.apply(task); err != nil {
+			r.failed.Add(1)
+			r.mu.Lock()
+			r.lastError = err.Error()
+			r.mu.Unlock()
+			log.Printf("Failed to replicate %s to %s: %v", task.path, r.replica.name, err)
+			continue
+		}
+		if task.delete {
+			r.deleted.Add(1)
+		} else {
+			r.replicated.Add(1)
+		}
+	}
+}
+
+// apply runs one operation, retrying with exponential backoff
+func (r *replicator) apply(task replicationTask) error {
+	delay := replicationRetryDelay
+
+	var err error
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		if task.delete {
+			err = r.replica.storage.Delete(context.Background(), task.path)
+		} else {
+			err = r.copy(task.source, task.path)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// copy stores the object at path of source under the same path on the replica. It
+// runs in the background, after the request that stored the object is over.
+func (r *replicator) copy(source Storage, path string) error {
+	ctx := context.Background()
+	reader, err := source.Download(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	_, err = ReplaceBytes(ctx, r.replica.storage, data, path)
+	return err
+}
+
+// replicatedStorage mirrors the writes of an upload backend onto the replica and falls
+// back to the replica when the backend fails to return an object
+type replicatedStorage struct {
+	Storage
+	replicator *replicator
+}
+
+// Upload implements Storage
+func (s *replicatedStorage) Upload(ctx context.Context, reader io.Reader, filename string) (string, error) {
+	path, err := s.Storage.Upload(ctx, reader, filename)
+	if err == nil {
+		s.replicator.enqueue(replicationTask{source: s.Storage, path: path})
+	}
+	return path, err
+}
+
+// UploadBytes implements Storage
+func (s *replicatedStorage) UploadBytes(ctx context.Context, data []byte, filename string) (string, error) {
+	path, err := s.Storage.UploadBytes(ctx, data, filename)
+	if err == nil {
+		s.replicator.enqueue(replicationTask{source: s.Storage, path: path})
+	}
+	return path, err
+}
+
+// Delete implements Storage. The replica copy goes too, whether or not the backend
+// still had the object.
+func (s *replicatedStorage) Delete(ctx context.Context, path string) error {
+	err := s.Storage.Delete(ctx, path)
+	s.replicator.enqueue(replicationTask{path: path, delete: true})
+	return err
+}
+
+// Download implements Storage, reading the replica when the backend can't serve the object
+func (s *replicatedStorage) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	reader, err := s.Storage.Download(ctx, path)
+	if err == nil {
+		return reader, nil
+	}
+
+	replicaReader, replicaErr := s.replicator.replica.storage.Download(ctx, path)
+	if replicaErr != nil {
+		return nil, err
+	}
+	s.replicator.fallbacks.Add(1)
+	log.Printf("Served %s from replica %s: %v", path, s.replicator.replica.name, err)
+	return replicaReader, nil
+}
+
+// ReplicateObject queues an object stored on the named backend without going through it,
+// such as a direct upload, for mirroring. It does nothing without a replica.
+func ReplicateObject(backendName, path string) {
+	initBackends()
+	if replication == nil {
+		return
+	}
+	b, ok := backendIndex[backendName]
+	if !ok || b.replica {
+		return
+	}
+	replication.enqueue(replicationTask{source: b.monitored, path: path})
+}
+
+// GetReplicationStatus returns the replicator's counters and last reconcile report, if
+// replication is enabled
+func GetReplicationStatus() (ReplicationStatus, bool) {
+	initBackends()
+	if replication == nil {
+		return ReplicationStatus{}, false
+	}
+	r := replication
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := ReplicationStatus{
+		Replica:    r.replica.name,
+		Pending:    len(r.tasks),
+		Replicated: r.replicated.Load(),
+		Deleted:    r.deleted.Load(),
+		Failed:     r.failed.Load(),
+		Dropped:    r.dropped.Load(),
+		Fallbacks:  r.fallbacks.Load(),
+		LastError:  r.lastError,
+	}
+	if r.report != nil {
+		report := r.report.snapshot()
+		status.LastReconcile = &report
+	}
+	return status, true
+}
+
+// ReconcileReplicas checks that every object list yields exists on the replica. list
+// calls visit with successive batches of objects. With repair, missing objects are
+// queued for copying again. Objects stored on the replica itself are skipped.
+func ReconcileReplicas(repair bool, list func(visit func([]ReplicaObject)) error) (ReconcileReport, error) {
+	initBackends()
+	if replication == nil {
+		return ReconcileReport{}, errors.New("replication is not enabled")
+	}
+	r := replication
+
+	r.mu.Lock()
+	if r.report != nil && r.report.Status == ReconcileRunning {
+		r.mu.Unlock()
+		return ReconcileReport{}, ErrReconcileRunning
+	}
+	report := &ReconcileReport{Status: ReconcileRunning, Repair: repair, StartedAt: time.Now()}
+	r.report = report
+	r.mu.Unlock()
+
+	err := list(func(objects []ReplicaObject) {
+		for _, object := range objects {
+			source, ok := backendIndex[object.Backend]
+			if !ok {
+				source = backends[0]
+			}
+			if source.replica {
+				continue
+			}
+
+			exists, checkErr := objectExists(context.Background(), r.replica.raw, object.Path)
+			r.mu.Lock()
+			report.Checked++
+			switch {
+			case checkErr != nil:
+				report.Errors++
+			case !exists:
+				report.Missing++
+				if len(report.Objects) < maxMissingReplicas {
+					report.Objects = append(report.Objects, object)
+				}
+			}
+			r.mu.Unlock()
+
+			if checkErr == nil && !exists && repair {
+				r.enqueue(replicationTask{source: source.monitored, path: object.Path})
+			}
+		}
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	report.Status = ReconcileCompleted
+	if err != nil {
+		report.Status = ReconcileFailed
+		report.Error = err.Error()
+	}
+	report.CompletedAt = &now
+	log.Printf("Replica reconciliation finished: %d checked, %d missing, %d errors", report.Checked, report.Missing, report.Errors)
+	return report.snapshot(), err
+}
+
+// objectExists reports whether path is stored on provider. Providers without a cheaper
+// way to tell are asked for the object itself, and any failure to get it counts as missing.
+func objectExists(ctx context.Context, provider Storage, path string) (bool, error) {
+	if uploader, ok := provider.(DirectUploader); ok {
+		_, err := uploader.StatObject(ctx, path)
+		if errors.Is(err, ErrObjectNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	reader, err := provider.Download(ctx, path)
+	if err != nil {
+		return false, nil
+	}
+	reader.Close()
+	return true, nil
+}
+
+// snapshot copies the report so it can be read without holding the lock
+func (r *ReconcileReport) snapshot() ReconcileReport {
+	copied := *r
+	copied.Objects = append([]ReplicaObject(nil), r.Objects...)
+	return copied
+}
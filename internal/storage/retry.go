@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+
+	"go-media-center-example/internal/config"
+)
+
+// httpStatusError is an unsuccessful answer from a backend's HTTP API
+type httpStatusError struct {
+	message string
+	status  int
+}
+
+// statusError describes the unexpected response resp to an operation
+func statusError(message string, resp *http.Response) error {
+	return &httpStatusError{message: message, status: resp.StatusCode}
+}
+
+// Error implements error
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.message, e.status, http.StatusText(e.status))
+}
+
+// retryableStatus reports whether a backend answering status may succeed when asked again
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// missingObject reports whether a backend answered that nothing is stored under a key
+func missingObject(err error) bool {
+	if errors.Is(err, ErrObjectNotFound) {
+		return true
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status == http.StatusNotFound
+	}
+	var responseErr *awshttp.ResponseError
+	return errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusNotFound
+}
+
+// retryable reports whether a failed storage operation is worth another attempt: the
+// backend was unreachable, too slow, dropped the connection or answered that it's
+// overloaded. Missing objects, refused credentials, other definite answers and operations
+// the caller gave up on aren't.
+func retryable(err error) bool {
+	if errors.Is(err, ErrObjectExists) || errors.Is(err, ErrObjectNotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return retryableStatus(statusErr.status)
+	}
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		return retryableStatus(responseErr.HTTPStatusCode())
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retryingStorage retries the idempotent operations of a backend. Uploads from a reader
+// aren't retried, as the reader is spent by the first attempt, and a conditional write
+// that did land would be refused as a collision when repeated. Each attempt of a delete or
+// byte upload has to finish within the policy's timeout.
+type retryingStorage struct {
+	Storage
+	health *healthTracker
+	policy config.StorageRetryConfig
+}
+
+// retry runs op until it succeeds, fails for good, runs out of attempts or ctx is done
+func (s *retryingStorage) retry(ctx context.Context, op func() error) error {
+	err := op()
+	for attempt := 1; attempt < s.policy.Attempts && err != nil && retryable(err); attempt++ {
+		timer := time.NewTimer(s.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		s.health.recordRetry()
+		err = op()
+	}
+	if err != nil && retryable(err) && s.policy.Attempts > 1 {
+		s.health.recordRetriesExhausted()
+	}
+	return err
+}
+
+// bounded runs op with ctx limited to the policy's timeout, if any
+func (s *retryingStorage) bounded(ctx context.Context, op func(context.Context) error) error {
+	if s.policy.Timeout <= 0 {
+		return op(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.policy.Timeout)
+	defer cancel()
+	return op(ctx)
+}
+
+// backoff returns the wait before retry number attempt: exponentially growing up to the
+// maximum, with full jitter so clients that failed together don't retry together
+func (s *retryingStorage) backoff(attempt int) time.Duration {
+	wait := s.policy.Backoff << (attempt - 1)
+	if wait <= 0 || (s.policy.MaxBackoff > 0 && wait > s.policy.MaxBackoff) {
+		wait = s.policy.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(wait)) + 1)
+}
+
+// Download implements Storage
+func (s *retryingStorage) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := s.retry(ctx, func() error {
+		var err error
+		reader, err = s.Storage.Download(ctx, path)
+		return err
+	})
+	return reader, err
+}
+
+// Delete implements Storage
+func (s *retryingStorage) Delete(ctx context.Context, path string) error {
+	return s.retry(ctx, func() error {
+		return s.bounded(ctx, func(ctx context.Context) error {
+			return s.Storage.Delete(ctx, path)
+		})
+	})
+}
+
+// UploadBytes implements Storage. The data can be sent again; a write that landed before
+// failing answers ErrObjectExists when retried.
+func (s *retryingStorage) UploadBytes(ctx context.Context, data []byte, filename string) (string, error) {
+	var path string
+	err := s.retry(ctx, func() error {
+		return s.bounded(ctx, func(ctx context.Context) error {
+			var err error
+			path, err = s.Storage.UploadBytes(ctx, data, filename)
+			return err
+		})
+	})
+	return path, err
+}
+
+// UploadWithOptions implements OptionsUploader
+func (s *retryingStorage) UploadWithOptions(ctx context.Context, reader io.Reader, filename string, opts ObjectOptions) (string, error) {
+	return uploadWithOptions(ctx, s.Storage, reader, filename, opts)
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"go-media-center-example/internal/config"
+	"go-media-center-example/internal/utils"
+)
+
+// SignedObjectPath is where the API serves objects of backends without presigned URLs of
+// their own, followed by the backend name and the object key
+const SignedObjectPath = "/api/v1/storage/"
+
+// signedObjectURL returns a URL under base serving key of backend until expires, signed
+// so it can't be forged or extended
+func signedObjectURL(base, backend, key string, expires time.Time) string {
+	expiresStr := strconv.FormatInt(expires.Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expiresStr)
+	query.Set("token", utils.SignParams(config.GetConfig().JWT.Secret, "object", backend, key, expiresStr))
+	return base + SignedObjectPath + url.PathEscape(backend) + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode()
+}
+
+// VerifyObjectSignature checks the token and expiry of a signed object URL
+func VerifyObjectSignature(backend, key, expires, token string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return utils.VerifyParams(config.GetConfig().JWT.Secret, token, "object", backend, key, expires)
+}
@@ -3,17 +3,22 @@ package storage
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/url"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
 	"path/filepath"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/linxGnu/goseaweedfs"
 
 	"go-media-center-example/internal/config"
 )
@@ -30,62 +35,106 @@ const (
 	MultipartThreshold = 10 * 1024 * 1024
 )
 
+// ErrObjectExists is returned by Upload and UploadBytes for a key another object is stored
+// under. Uploads never replace objects, so two files given the same name can't overwrite
+// each other; ReplaceBytes replaces one on purpose.
+var ErrObjectExists = errors.New("an object is already stored under this key")
+
 // Storage defines the interface for storage providers
 type Storage interface {
-	Upload(reader io.Reader, filename string) (string, error)
-	Download(path string) (io.ReadCloser, error)
-	Delete(path string) error
+	Upload(ctx context.Context, reader io.Reader, filename string) (string, error)
+	Download(ctx context.Context, path string) (io.ReadCloser, error)
+	Delete(ctx context.Context, path string) error
 	GetPublicURL(path string) string
 	GetInternalURL(path string) string
-	UploadBytes(data []byte, filename string) (string, error)
-	GetPresignedURL(fileID string, expiration time.Duration) (string, error)
+	UploadBytes(ctx context.Context, data []byte, filename string) (string, error)
+	GetPresignedURL(ctx context.Context, fileID string, expiration time.Duration) (string, error)
+}
+
+// ReplaceBytes stores data under filename, replacing the object stored there, for keys
+// that are written again on purpose such as cached derivatives and replicas
+func ReplaceBytes(ctx context.Context, provider Storage, data []byte, filename string) (string, error) {
+	path, err := provider.UploadBytes(ctx, data, filename)
+	if !errors.Is(err, ErrObjectExists) {
+		return path, err
+	}
+	if err := provider.Delete(ctx, filepath.Clean(filename)); err != nil {
+		return "", err
+	}
+	return provider.UploadBytes(ctx, data, filename)
+}
+
+// PublicURLOn returns the public URL of path on domain, a custom hostname that serves
+// the objects of provider at the same paths, like a CDN in front of a bucket. Without a
+// domain it is the provider's own public URL.
+func PublicURLOn(provider Storage, domain, path string) string {
+	if domain == "" {
+		return provider.GetPublicURL(path)
+	}
+	return fmt.Sprintf("https://%s/%s", domain, path)
 }
 
 // S3Storage implements the Storage interface for AWS S3
 type S3Storage struct {
-	client    *s3.Client
-	bucket    string
-	publicURL string
+	client       *s3.Client
+	bucket       string
+	publicURL    string
+	encryption   string // Default server-side encryption, empty for the bucket's own
+	kmsKeyID     string // KMS key of SSE-KMS, empty for the account default
+	storageClass string // Default storage class, empty for STANDARD
 }
 
 // Upload uploads a file to S3
-func (s *S3Storage) Upload(reader io.Reader, filename string) (string, error) {
+func (s *S3Storage) Upload(ctx context.Context, reader io.Reader, filename string) (string, error) {
+	return s.put(ctx, reader, filename, ObjectOptions{})
+}
+
+// put uploads a file to S3 with opts overriding the default encryption and storage class.
+// The write is conditional, so an existing object under the key is left alone.
+func (s *S3Storage) put(ctx context.Context, reader io.Reader, filename string, opts ObjectOptions) (string, error) {
 	key := filepath.Clean(filename)
 	data, err := io.ReadAll(reader)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	input := &s3.PutObjectInput{
+		Body:        bytes.NewReader(data),
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		IfNoneMatch: aws.String("*"),
+	}
+	s.applyPutSettings(input, opts)
+	_, err = s.client.PutObject(ctx, input)
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusPreconditionFailed {
+		return "", fmt.Errorf("%w: %s", ErrObjectExists, key)
 	}
-	_, err = s.client.PutObject(context.Background(), &s3.PutObjectInput{
-		Body:   bytes.NewReader(data),
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-	})
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file to S3: %v", err)
+		return "", fmt.Errorf("failed to upload file to S3: %w", err)
 	}
 	return key, nil
 }
 
 // Download downloads a file from S3
-func (s *S3Storage) Download(path string) (io.ReadCloser, error) {
-	result, err := s.client.GetObject(context.Background(), &s3.GetObjectInput{
+func (s *S3Storage) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(path),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to download file from S3: %v", err)
+		return nil, fmt.Errorf("failed to download file from S3: %w", err)
 	}
 	return result.Body, nil
 }
 
 // Delete deletes a file from S3
-func (s *S3Storage) Delete(path string) error {
-	_, err := s.client.DeleteObject(context.Background(), &s3.DeleteObjectInput{
+func (s *S3Storage) Delete(ctx context.Context, path string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(path),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to delete file from S3: %v", err)
+		return fmt.Errorf("failed to delete file from S3: %w", err)
 	}
 	return nil
 }
@@ -103,24 +152,15 @@ func (s *S3Storage) GetInternalURL(path string) string {
 	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s", s.bucket, path)
 }
 
-// UploadBytes uploads bytes to S3
-func (s *S3Storage) UploadBytes(data []byte, filename string) (string, error) {
-	key := filepath.Clean(filename)
-	_, err := s.client.PutObject(context.Background(), &s3.PutObjectInput{
-		Body:   bytes.NewReader(data),
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload bytes to S3: %v", err)
-	}
-	return key, nil
+// UploadBytes uploads bytes to S3, leaving an existing object under the key alone
+func (s *S3Storage) UploadBytes(ctx context.Context, data []byte, filename string) (string, error) {
+	return s.put(ctx, bytes.NewReader(data), filename, ObjectOptions{})
 }
 
 // GetPresignedURL generates a presigned URL for S3
-func (s *S3Storage) GetPresignedURL(fileID string, expiration time.Duration) (string, error) {
+func (s *S3Storage) GetPresignedURL(ctx context.Context, fileID string, expiration time.Duration) (string, error) {
 	presignClient := s3.NewPresignClient(s.client)
-	request, err := presignClient.PresignGetObject(context.Background(), &s3.GetObjectInput{
+	request, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket:          aws.String(s.bucket),
 		Key:             aws.String(fileID),
 		ResponseExpires: aws.Time(time.Now().Add(expiration)),
@@ -128,58 +168,156 @@ func (s *S3Storage) GetPresignedURL(fileID string, expiration time.Duration) (st
 		opts.Expires = expiration
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to generate presigned URL: %v", err)
+		return "", fmt.Errorf("failed to generate presigned URL: %w", err)
 	}
 	return request.URL, nil
 }
 
-// SeaweedFSStorage implements the Storage interface for SeaweedFS
+// SeaweedFSStorage implements the Storage interface for SeaweedFS. It talks to the filer's
+// HTTP API directly, so every request follows the context of the operation.
 type SeaweedFSStorage struct {
-	client      *goseaweedfs.Filer
+	name        string // Backend name, which signed URLs are served under
+	filerURL    string
 	internalURL string
 	publicURL   string
 }
 
+// fileURL returns the filer URL of the file at path
+func (s *SeaweedFSStorage) fileURL(path string) string {
+	return s.filerURL + "/" + strings.TrimPrefix(path, "/")
+}
+
 // Upload implements Storage interface for SeaweedFSStorage
-func (s *SeaweedFSStorage) Upload(reader io.Reader, filename string) (string, error) {
+func (s *SeaweedFSStorage) Upload(ctx context.Context, reader io.Reader, filename string) (string, error) {
 	// Read the entire file into memory since SeaweedFS client doesn't support streaming
 	data, err := io.ReadAll(reader)
 	if err != nil {
-		return "", fmt.Errorf("failed to read file: %v", err)
+		return "", fmt.Errorf("failed to read file: %w", err)
 	}
 
-	// Upload the file
-	filePart, err := s.client.Upload(
-		bytes.NewReader(data),
-		int64(len(data)), // size
-		filename,         // path
-		"default",        // collection
-		"",               // ttl
-	)
+	// The filer replaces files stored at the same path, so check for one first. Files are
+	// read back and deleted by that path, so it is what gets stored, not the file ID.
+	path := filepath.Clean(filename)
+	exists, err := s.exists(ctx, path)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload to SeaweedFS: %v", err)
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("%w: %s", ErrObjectExists, path)
 	}
 
-	return filePart.FileID, nil
+	if err := s.put(ctx, data, path); err != nil {
+		return "", fmt.Errorf("failed to upload to SeaweedFS: %w", err)
+	}
+	return path, nil
 }
 
-// Download downloads a file from SeaweedFS
-func (s *SeaweedFSStorage) Download(path string) (io.ReadCloser, error) {
-	reader, _, err := s.client.Get(path, url.Values{}, nil)
+// put stores data at path with the filer's multipart upload
+func (s *SeaweedFSStorage) put(ctx context.Context, data []byte, path string) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+		"name":     "file",
+		"filename": filepath.Base(path),
+	}))
+	if contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path))); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	part, err := form.CreatePart(header)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download file from SeaweedFS: %v", err)
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
 	}
-	return io.NopCloser(bytes.NewReader(reader)), nil
-}
 
-// Delete deletes a file from SeaweedFS
-func (s *SeaweedFSStorage) Delete(path string) error {
-	if err := s.client.Delete(path, url.Values{}); err != nil {
-		return fmt.Errorf("failed to delete file from SeaweedFS: %v", err)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.fileURL(path)+"?collection=default", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return statusError("filer refused the upload", resp)
+	}
+
+	var result struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to read filer response: %w", err)
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
 	}
 	return nil
 }
 
+// exists reports whether the filer has a file at path
+func (s *SeaweedFSStorage) exists(ctx context.Context, path string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.fileURL(path), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to reach SeaweedFS: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, statusError("failed to check file in SeaweedFS", resp)
+	}
+}
+
+// Download downloads a file from SeaweedFS, streaming it as it arrives
+func (s *SeaweedFSStorage) Download(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.fileURL(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file from SeaweedFS: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError("failed to download file from SeaweedFS", resp)
+	}
+	return resp.Body, nil
+}
+
+// Delete deletes a file from SeaweedFS. A file that is already gone counts as deleted.
+func (s *SeaweedFSStorage) Delete(ctx context.Context, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.fileURL(path), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := sharedHTTPClient().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete file from SeaweedFS: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return statusError("failed to delete file from SeaweedFS", resp)
+	}
+}
+
 // GetPublicURL returns the public URL for a file in SeaweedFS
 func (s *SeaweedFSStorage) GetPublicURL(path string) string {
 	return fmt.Sprintf("%s/%s", s.publicURL, path)
@@ -190,64 +328,68 @@ func (s *SeaweedFSStorage) GetInternalURL(path string) string {
 	return fmt.Sprintf("%s/%s", s.internalURL, path)
 }
 
-// UploadBytes uploads bytes to SeaweedFS
-func (s *SeaweedFSStorage) UploadBytes(data []byte, filename string) (string, error) {
+// UploadBytes uploads bytes to SeaweedFS, leaving an existing file at the path alone
+func (s *SeaweedFSStorage) UploadBytes(ctx context.Context, data []byte, filename string) (string, error) {
 	path := filepath.Clean(filename)
-	collection := "default"
-	ttl := ""
-
-	if _, err := s.client.Upload(bytes.NewReader(data), -1, path, collection, ttl); err != nil {
-		return "", fmt.Errorf("failed to upload bytes to SeaweedFS: %v", err)
+	exists, err := s.exists(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return "", fmt.Errorf("%w: %s", ErrObjectExists, path)
+	}
+	if err := s.put(ctx, data, path); err != nil {
+		return "", fmt.Errorf("failed to upload bytes to SeaweedFS: %w", err)
 	}
 	return path, nil
 }
 
-// GetPresignedURL generates a presigned URL for SeaweedFS
-func (s *SeaweedFSStorage) GetPresignedURL(fileID string, expiration time.Duration) (string, error) {
-	expirationTime := time.Now().Add(expiration).Unix()
-	token := fmt.Sprintf("exp=%d", expirationTime)
-	return fmt.Sprintf("%s/%s?%s", s.publicURL, fileID, token), nil
+// GetPresignedURL generates a presigned URL for SeaweedFS. SeaweedFS has no signed URLs of
+// its own, so the URL points at the API, which serves the file while the signature holds.
+func (s *SeaweedFSStorage) GetPresignedURL(ctx context.Context, fileID string, expiration time.Duration) (string, error) {
+	return signedObjectURL(s.publicURL, s.name, fileID, time.Now().Add(expiration)), nil
 }
 
-var (
-	provider Storage
-	once     sync.Once
-)
-
-// GetProvider returns the configured storage provider
+// GetProvider returns the primary configured storage provider
 func GetProvider() Storage {
-	once.Do(func() {
-		var err error
-		cfg := config.GetConfig()
-		var storageConfig map[string]string
-
-		switch cfg.Storage.Provider {
-		case "s3":
-			storageConfig = map[string]string{
-				"region":            cfg.Storage.S3.Region,
-				"access_key_id":     cfg.Storage.S3.AccessKeyID,
-				"secret_access_key": cfg.Storage.S3.SecretAccessKey,
-				"bucket":            cfg.Storage.S3.BucketName,
-				"endpoint":          cfg.Storage.S3.Endpoint,
-				"force_path_style":  "true",
-				"public_url":        cfg.Storage.S3.PublicURL,
-			}
-			provider, err = NewS3Storage(storageConfig)
-		case "seaweedfs":
-			storageConfig = map[string]string{
-				"master_url":   cfg.Storage.SeaweedFS.MasterURL,
-				"internal_url": fmt.Sprintf("http://localhost:%d", cfg.Storage.SeaweedFS.VolumePort),
-				"public_url":   fmt.Sprintf("http://localhost:%s", cfg.Server.Port),
-			}
-			provider, err = NewSeaweedFSStorage(storageConfig)
-		default:
-			panic(fmt.Sprintf("Unsupported storage provider: %s", cfg.Storage.Provider))
-		}
-		if err != nil {
-			panic(fmt.Sprintf("Failed to initialize storage provider: %v", err))
-		}
-	})
-	return provider
+	return GetBackend("")
+}
+
+// GetCacheStats returns the local disk cache statistics, if the cache is enabled
+func GetCacheStats() (CacheStats, bool) {
+	initBackends()
+	if diskCache == nil {
+		return CacheStats{}, false
+	}
+	return diskCache.Stats(), true
+}
+
+// newConfiguredStorage creates the named provider from the application configuration
+func newConfiguredStorage(name string, cfg *config.Config) (Storage, error) {
+	switch StorageProvider(name) {
+	case S3:
+		return NewS3Storage(map[string]string{
+			"region":            cfg.Storage.S3.Region,
+			"access_key_id":     cfg.Storage.S3.AccessKeyID,
+			"secret_access_key": cfg.Storage.S3.SecretAccessKey,
+			"bucket":            cfg.Storage.S3.BucketName,
+			"endpoint":          cfg.Storage.S3.Endpoint,
+			"force_path_style":  "true",
+			"public_url":        cfg.Storage.S3.PublicURL,
+			"encryption":        cfg.Storage.S3.Encryption,
+			"kms_key_id":        cfg.Storage.S3.KMSKeyID,
+			"storage_class":     cfg.Storage.S3.StorageClass,
+		})
+	case SeaweedFS:
+		return NewSeaweedFSStorage(map[string]string{
+			"name":         name,
+			"master_url":   cfg.Storage.SeaweedFS.MasterURL,
+			"internal_url": fmt.Sprintf("http://localhost:%d", cfg.Storage.SeaweedFS.VolumePort),
+			"public_url":   fmt.Sprintf("http://localhost:%s", cfg.Server.Port),
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage provider: %s", name)
+	}
 }
 
 // NewStorage creates a new storage provider instance
@@ -264,8 +406,14 @@ func NewStorage(provider StorageProvider, config map[string]string) (Storage, er
 
 // NewS3Storage creates a new S3 storage instance
 func NewS3Storage(config map[string]string) (Storage, error) {
+	defaults := ObjectOptions{Encryption: config["encryption"], StorageClass: config["storage_class"]}
+	if err := defaults.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid S3 object defaults: %w", err)
+	}
+
 	cfg := aws.Config{
-		Region: config["region"],
+		Region:     config["region"],
+		HTTPClient: sharedHTTPClient(),
 		Credentials: credentials.NewStaticCredentialsProvider(
 			config["access_key_id"],
 			config["secret_access_key"],
@@ -289,21 +437,33 @@ func NewS3Storage(config map[string]string) (Storage, error) {
 	})
 
 	return &S3Storage{
-		client:    client,
-		bucket:    config["bucket"],
-		publicURL: config["public_url"],
+		client:       client,
+		bucket:       config["bucket"],
+		publicURL:    config["public_url"],
+		encryption:   defaults.Encryption,
+		kmsKeyID:     config["kms_key_id"],
+		storageClass: defaults.StorageClass,
 	}, nil
 }
 
 // NewSeaweedFSStorage creates a new SeaweedFS storage instance
 func NewSeaweedFSStorage(config map[string]string) (Storage, error) {
-	client, err := goseaweedfs.NewFiler(config["master_url"], nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create SeaweedFS client: %v", err)
+	if config["master_url"] == "" {
+		return nil, errors.New("SeaweedFS master URL is not configured")
+	}
+	filerURL := strings.TrimSuffix(config["master_url"], "/")
+	if !strings.Contains(filerURL, "://") {
+		filerURL = "http://" + filerURL
+	}
+
+	name := config["name"]
+	if name == "" {
+		name = string(SeaweedFS)
 	}
 
 	return &SeaweedFSStorage{
-		client:      client,
+		name:        name,
+		filerURL:    filerURL,
 		internalURL: config["internal_url"],
 		publicURL:   config["public_url"],
 	}, nil
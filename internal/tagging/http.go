@@ -0,0 +1,64 @@
+package tagging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// HTTPClassifier posts images to a model served over HTTP, such as a local model behind
+// a small web service. The image is the raw request body; the response is a Result:
+//
+//	{"tags": [{"name": "beach", "confidence": 0.93}],
+//	 "objects": [{"name": "dog", "confidence": 0.88, "box": {"left": 0.1, "top": 0.4, "width": 0.3, "height": 0.5}}]}
+type HTTPClassifier struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+// NewHTTPClassifier creates a classifier posting to endpoint. A non-empty token is sent
+// as a bearer token.
+func NewHTTPClassifier(endpoint, token string) (*HTTPClassifier, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid tagging URL: %s", endpoint)
+	}
+	return &HTTPClassifier{endpoint: endpoint, token: token, client: newHTTPClient()}, nil
+}
+
+// Name implements Classifier
+func (c *HTTPClassifier) Name() string {
+	return "http"
+}
+
+// Classify implements Classifier
+func (c *HTTPClassifier) Classify(ctx context.Context, image []byte, contentType string) (*Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(image))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach classifier: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("Classifier", resp)
+	}
+
+	var result Result
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to read classifier response: %v", err)
+	}
+	return &result, nil
+}
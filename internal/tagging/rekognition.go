@@ -0,0 +1,105 @@
+package tagging
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// RekognitionClassifier labels images with Amazon Rekognition DetectLabels. Every label
+// becomes a tag, and every instance of a label that Rekognition located an object.
+type RekognitionClassifier struct {
+	endpoint    string
+	region      string
+	credentials aws.Credentials
+	maxLabels   int
+	signer      *v4.Signer
+	client      *http.Client
+}
+
+// NewRekognitionClassifier creates a classifier for the given region, signing its
+// requests with static credentials
+func NewRekognitionClassifier(region, accessKeyID, secretAccessKey string, maxLabels int) (*RekognitionClassifier, error) {
+	if region == "" || accessKeyID == "" || secretAccessKey == "" {
+		return nil, errors.New("the rekognition tagging provider needs an AWS region and credentials")
+	}
+	return &RekognitionClassifier{
+		endpoint:    fmt.Sprintf("https://rekognition.%s.amazonaws.com/", region),
+		region:      region,
+		credentials: aws.Credentials{AccessKeyID: accessKeyID, SecretAccessKey: secretAccessKey},
+		maxLabels:   maxLabels,
+		signer:      v4.NewSigner(),
+		client:      newHTTPClient(),
+	}, nil
+}
+
+// Name implements Classifier
+func (c *RekognitionClassifier) Name() string {
+	return "rekognition"
+}
+
+// Classify implements Classifier
+func (c *RekognitionClassifier) Classify(ctx context.Context, image []byte, contentType string) (*Result, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		// []byte is encoded as base64, as the API expects
+		"Image":     map[string]interface{}{"Bytes": image},
+		"MaxLabels": c.maxLabels,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "RekognitionService.DetectLabels")
+	sum := sha256.Sum256(body)
+	if err := c.signer.SignHTTP(ctx, c.credentials, req, hex.EncodeToString(sum[:]), "rekognition", c.region, time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to sign Rekognition request: %v", err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Rekognition: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("Rekognition", resp)
+	}
+
+	// Confidences are percentages
+	var detected struct {
+		Labels []struct {
+			Name       string  `json:"Name"`
+			Confidence float64 `json:"Confidence"`
+			Instances  []struct {
+				Confidence  float64 `json:"Confidence"`
+				BoundingBox Box     `json:"BoundingBox"`
+			} `json:"Instances"`
+		} `json:"Labels"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&detected); err != nil {
+		return nil, fmt.Errorf("failed to read Rekognition response: %v", err)
+	}
+
+	result := &Result{}
+	for _, label := range detected.Labels {
+		result.Tags = append(result.Tags, Label{Name: label.Name, Confidence: label.Confidence / 100})
+		for _, instance := range label.Instances {
+			box := instance.BoundingBox
+			result.Objects = append(result.Objects, Label{Name: label.Name, Confidence: instance.Confidence / 100, Box: &box})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,73 @@
+// Package tagging suggests tags and object labels for images. A Classifier wraps a model,
+// either an external API like Google Cloud Vision or Amazon Rekognition, or a local model
+// served over HTTP; suggestions are only applied once a user accepts them.
+package tagging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"go-media-center-example/internal/config"
+)
+
+// requestTimeout bounds one classification request
+const requestTimeout = 30 * time.Second
+
+// Label is a suggested tag or object
+type Label struct {
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`    // 0-1
+	Box        *Box    `json:"box,omitempty"` // Where an object was found
+}
+
+// Box locates an object, relative to the width and height of the image (0-1)
+type Box struct {
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// Result is what a classifier found in an image: tags describing it as a whole and
+// objects located in it
+type Result struct {
+	Tags    []Label `json:"tags"`
+	Objects []Label `json:"objects"`
+}
+
+// Classifier suggests labels for an image. Classify may be called from several
+// goroutines at once.
+type Classifier interface {
+	// Name identifies the classifier in stored suggestions
+	Name() string
+	// Classify labels an encoded image of the given content type
+	Classify(ctx context.Context, image []byte, contentType string) (*Result, error)
+}
+
+// NewClassifier creates the classifier named by the configuration
+func NewClassifier(cfg config.TaggingConfig) (Classifier, error) {
+	switch cfg.Provider {
+	case "http":
+		return NewHTTPClassifier(cfg.URL, cfg.APIKey)
+	case "vision":
+		return NewVisionClassifier(cfg.APIKey, cfg.MaxLabels)
+	case "rekognition":
+		return NewRekognitionClassifier(cfg.AWSRegion, cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey, cfg.MaxLabels)
+	default:
+		return nil, fmt.Errorf("unknown tagging provider: %s", cfg.Provider)
+	}
+}
+
+// newHTTPClient returns the client classifiers send their requests with
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: requestTimeout}
+}
+
+// responseError describes a failed response from a classifier API
+func responseError(service string, resp *http.Response) error {
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%s returned %s: %s", service, resp.Status, message)
+}
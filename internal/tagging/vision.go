@@ -0,0 +1,120 @@
+package tagging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+)
+
+// visionEndpoint is the Google Cloud Vision annotate method
+const visionEndpoint = "https://vision.googleapis.com/v1/images:annotate"
+
+// VisionClassifier labels images with Google Cloud Vision: label detection for tags and
+// object localization for objects
+type VisionClassifier struct {
+	apiKey    string
+	maxLabels int
+	client    *http.Client
+}
+
+// NewVisionClassifier creates a classifier authenticating with an API key
+func NewVisionClassifier(apiKey string, maxLabels int) (*VisionClassifier, error) {
+	if apiKey == "" {
+		return nil, errors.New("the vision tagging provider needs AUTOTAG_API_KEY")
+	}
+	return &VisionClassifier{apiKey: apiKey, maxLabels: maxLabels, client: newHTTPClient()}, nil
+}
+
+// Name implements Classifier
+func (c *VisionClassifier) Name() string {
+	return "vision"
+}
+
+// Classify implements Classifier
+func (c *VisionClassifier) Classify(ctx context.Context, image []byte, contentType string) (*Result, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"requests": []map[string]interface{}{{
+			// []byte is encoded as base64, as the API expects
+			"image": map[string]interface{}{"content": image},
+			"features": []map[string]interface{}{
+				{"type": "LABEL_DETECTION", "maxResults": c.maxLabels},
+				{"type": "OBJECT_LOCALIZATION", "maxResults": c.maxLabels},
+			},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, visionEndpoint+"?key="+url.QueryEscape(c.apiKey), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Cloud Vision: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("Cloud Vision", resp)
+	}
+
+	type vertex struct {
+		X float64 `json:"x"`
+		Y float64 `json:"y"`
+	}
+	var annotated struct {
+		Responses []struct {
+			LabelAnnotations []struct {
+				Description string  `json:"description"`
+				Score       float64 `json:"score"`
+			} `json:"labelAnnotations"`
+			LocalizedObjectAnnotations []struct {
+				Name         string  `json:"name"`
+				Score        float64 `json:"score"`
+				BoundingPoly struct {
+					NormalizedVertices []vertex `json:"normalizedVertices"`
+				} `json:"boundingPoly"`
+			} `json:"localizedObjectAnnotations"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"responses"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&annotated); err != nil {
+		return nil, fmt.Errorf("failed to read Cloud Vision response: %v", err)
+	}
+	if len(annotated.Responses) == 0 {
+		return nil, errors.New("Cloud Vision returned no result")
+	}
+	response := annotated.Responses[0]
+	if response.Error != nil {
+		return nil, fmt.Errorf("Cloud Vision failed: %s", response.Error.Message)
+	}
+
+	result := &Result{}
+	for _, label := range response.LabelAnnotations {
+		result.Tags = append(result.Tags, Label{Name: label.Description, Confidence: label.Score})
+	}
+	for _, object := range response.LocalizedObjectAnnotations {
+		found := Label{Name: object.Name, Confidence: object.Score}
+		// Vertices left out of the response are zero
+		if vertices := object.BoundingPoly.NormalizedVertices; len(vertices) > 0 {
+			left, top, right, bottom := 1.0, 1.0, 0.0, 0.0
+			for _, v := range vertices {
+				left, top = math.Min(left, v.X), math.Min(top, v.Y)
+				right, bottom = math.Max(right, v.X), math.Max(bottom, v.Y)
+			}
+			found.Box = &Box{Left: left, Top: top, Width: right - left, Height: bottom - top}
+		}
+		result.Objects = append(result.Objects, found)
+	}
+	return result, nil
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"go-media-center-example/internal/config"
+)
+
+// IsVideoFormat reports whether the requested output format is a video container
+func (t *TransformationOptions) IsVideoFormat() bool {
+	return t.Format == "mp4" || t.Format == "webm"
+}
+
+// ConvertGIFToVideo converts an animated GIF to MP4 (H.264) or WebM (VP9) using ffmpeg,
+// which is stopped when ctx is done or after TRANSFORM_VIDEO_TIMEOUT
+func ConvertGIFToVideo(ctx context.Context, input io.Reader, options TransformationOptions) ([]byte, error) {
+	if timeout := config.GetConfig().Transform.VideoTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	inFile, err := os.CreateTemp("", "gif-src-*.gif")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(inFile.Name())
+
+	if _, err := io.Copy(inFile, input); err != nil {
+		inFile.Close()
+		return nil, fmt.Errorf("failed to write temp file: %v", err)
+	}
+	inFile.Close()
+
+	outFile, err := os.CreateTemp("", "gif-out-*."+options.Format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	outFile.Close()
+	defer os.Remove(outFile.Name())
+
+	args := []string{"-y", "-v", "error", "-i", inFile.Name(), "-an", "-vf", gifScaleFilter(options)}
+	switch options.Format {
+	case "mp4":
+		// yuv420p and faststart keep the output playable in browsers and streamable
+		args = append(args, "-c:v", "libx264", "-pix_fmt", "yuv420p", "-movflags", "+faststart")
+		if options.Quality > 0 {
+			args = append(args, "-crf", fmt.Sprint(qualityToCRF(options.Quality, 51)))
+		}
+	case "webm":
+		args = append(args, "-c:v", "libvpx-vp9", "-pix_fmt", "yuv420p", "-b:v", "0")
+		crf := 35
+		if options.Quality > 0 {
+			crf = qualityToCRF(options.Quality, 63)
+		}
+		args = append(args, "-crf", fmt.Sprint(crf))
+	default:
+		return nil, fmt.Errorf("unsupported video format: %s", options.Format)
+	}
+	args = append(args, outFile.Name())
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("ffmpeg conversion failed: %v: %s", err, output)
+	}
+
+	data, err := os.ReadFile(outFile.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read converted video: %v", err)
+	}
+	return data, nil
+}
+
+// gifScaleFilter builds the ffmpeg scale filter; video encoders require even dimensions
+func gifScaleFilter(options TransformationOptions) string {
+	switch {
+	case options.Width > 0 && options.Height > 0:
+		return fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2", options.Width, options.Height)
+	case options.Width > 0:
+		return fmt.Sprintf("scale=%d:-2", options.Width)
+	case options.Height > 0:
+		return fmt.Sprintf("scale=-2:%d", options.Height)
+	default:
+		return "scale=trunc(iw/2)*2:trunc(ih/2)*2"
+	}
+}
+
+// qualityToCRF maps a 1-100 quality value onto an encoder CRF scale where lower is better
+func qualityToCRF(quality, maxCRF int) int {
+	return (100 - quality) * maxCRF / 100
+}
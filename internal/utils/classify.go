@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// Content classes assigned to uploaded images
+const (
+	ContentPhoto      = "photo"
+	ContentScreenshot = "screenshot"
+	ContentScan       = "scan"
+	ContentGraphic    = "graphic"
+)
+
+// ContentClasses lists every class an image can be assigned
+var ContentClasses = []string{ContentPhoto, ContentScreenshot, ContentScan, ContentGraphic}
+
+// IsContentClass reports whether class is a known content class
+func IsContentClass(class string) bool {
+	for _, known := range ContentClasses {
+		if class == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifierInput is what a content classifier gets to look at
+type ClassifierInput struct {
+	Image  image.Image
+	Format string // Decoded format: jpeg, png, gif, ...
+	Camera bool   // EXIF names a camera make or model
+}
+
+// ContentClassifier assigns a content class to an image. It is a variable so deployments
+// can plug in a smarter model without touching the upload handlers.
+var ContentClassifier func(input ClassifierInput) string = classifyContent
+
+// Common screen resolutions in physical pixels, stored landscape
+var screenSizes = map[[2]int]bool{
+	{1280, 720}: true, {1280, 800}: true, {1366, 768}: true, {1440, 900}: true,
+	{1536, 864}: true, {1600, 900}: true, {1680, 1050}: true, {1920, 1080}: true,
+	{1920, 1200}: true, {2560, 1440}: true, {2560, 1600}: true, {2880, 1800}: true,
+	{3024, 1964}: true, {3456, 2234}: true, {3840, 2160}: true,
+	// Phones and tablets
+	{1334, 750}: true, {1792, 828}: true, {2208, 1242}: true, {2436, 1125}: true,
+	{2532, 1170}: true, {2556, 1179}: true, {2688, 1242}: true, {2778, 1284}: true,
+	{2796, 1290}: true, {2340, 1080}: true, {2400, 1080}: true, {3200, 1440}: true,
+	{2048, 1536}: true, {2360, 1640}: true, {2388, 1668}: true, {2732, 2048}: true,
+}
+
+// imageStats summarises the pixels of an image for classification
+type imageStats struct {
+	flatShare   float64 // Pixels identical to their right neighbour, a sign of rendered content
+	colors      int     // Distinct colors after quantising to 4 bits per channel
+	meanSat     float64
+	brightShare float64 // Pixels with luma above 200
+}
+
+// ImageAnalysis is what AnalyzeImage finds out about an image
+type ImageAnalysis struct {
+	ContentClass string
+	Colors       *ImageColors
+}
+
+// Apply records the analysis in the technical metadata of an image
+func (a *ImageAnalysis) Apply(metadata *MediaMetadata) {
+	metadata.ContentClass = a.ContentClass
+	metadata.Colors = a.Colors
+}
+
+// AnalyzeImage decodes an image, runs ContentClassifier on it and extracts its colors
+func AnalyzeImage(r io.ReadSeeker) (*ImageAnalysis, error) {
+	camera := hasCameraEXIF(r)
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	return &ImageAnalysis{
+		ContentClass: ContentClassifier(ClassifierInput{Image: img, Format: format, Camera: camera}),
+		Colors:       ExtractColors(img),
+	}, nil
+}
+
+// classifyContent is the default heuristic classifier
+func classifyContent(input ClassifierInput) string {
+	if input.Camera {
+		return ContentPhoto
+	}
+
+	bounds := input.Image.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return ContentGraphic
+	}
+	stats := computeImageStats(input.Image)
+
+	// Cameras and scanners leave sensor noise; rendered pixels repeat exactly
+	if stats.flatShare > 0.5 {
+		if screenSizes[[2]int{max(w, h), min(w, h)}] {
+			return ContentScreenshot
+		}
+		if stats.colors <= 64 || min(w, h) < 400 {
+			return ContentGraphic
+		}
+		return ContentScreenshot
+	}
+
+	// Mostly white, nearly colorless pages in a paper aspect ratio
+	ratio := float64(max(w, h)) / float64(min(w, h))
+	if stats.meanSat < 0.1 && stats.brightShare > 0.5 && ratio >= 1.25 && ratio <= 1.5 {
+		return ContentScan
+	}
+
+	if stats.colors <= 32 {
+		return ContentGraphic
+	}
+	return ContentPhoto
+}
+
+// computeImageStats samples up to about 64k pixels of img on a regular grid
+func computeImageStats(img image.Image) imageStats {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	step := max(1, int(math.Sqrt(float64(w*h)/65536)))
+
+	src := imaging.Clone(img)
+	pixel := func(x, y int) (uint8, uint8, uint8) {
+		i := y*src.Stride + x*4
+		return src.Pix[i], src.Pix[i+1], src.Pix[i+2]
+	}
+
+	var stats imageStats
+	palette := make(map[uint16]bool)
+	samples, flat, bright := 0, 0, 0
+	satSum := 0.0
+	for y := 0; y < h; y += step {
+		for x := 0; x < w; x += step {
+			r, g, b := pixel(x, y)
+			samples++
+
+			if x+1 < w {
+				if nr, ng, nb := pixel(x+1, y); nr == r && ng == g && nb == b {
+					flat++
+				}
+			}
+			palette[uint16(r>>4)<<8|uint16(g>>4)<<4|uint16(b>>4)] = true
+
+			fr, fg, fb := float64(r), float64(g), float64(b)
+			if 0.299*fr+0.587*fg+0.114*fb > 200 {
+				bright++
+			}
+			hi, lo := math.Max(fr, math.Max(fg, fb)), math.Min(fr, math.Min(fg, fb))
+			if hi > 0 {
+				satSum += (hi - lo) / hi
+			}
+		}
+	}
+
+	stats.flatShare = float64(flat) / float64(samples)
+	stats.colors = len(palette)
+	stats.meanSat = satSum / float64(samples)
+	stats.brightShare = float64(bright) / float64(samples)
+	return stats
+}
+
+// hasCameraEXIF reports whether a JPEG carries EXIF naming the camera make or model
+func hasCameraEXIF(r io.ReadSeeker) bool {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return false
+	}
+	// EXIF lives in an APP1 segment near the start of the file
+	header := make([]byte, 64*1024)
+	n, _ := io.ReadFull(r, header)
+	header = header[:n]
+	if len(header) < 4 || header[0] != 0xFF || header[1] != 0xD8 {
+		return false
+	}
+
+	pos := 2
+	for pos+4 <= len(header) && header[pos] == 0xFF {
+		marker := header[pos+1]
+		length := int(binary.BigEndian.Uint16(header[pos+2:]))
+		if marker == 0xDA || length < 2 { // Start of scan: no more metadata
+			return false
+		}
+		end := min(len(header), pos+2+length)
+		if marker == 0xE1 && bytes.HasPrefix(header[pos+4:end], []byte("Exif\x00\x00")) {
+			return exifHasCamera(header[pos+10 : end])
+		}
+		pos += 2 + length
+	}
+	return false
+}
+
+// exifHasCamera looks for the Make (0x010F) or Model (0x0110) tag in IFD0 of a TIFF block
+func exifHasCamera(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return false
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return false
+		}
+		if tag := order.Uint16(tiff[entry:]); tag == 0x010F || tag == 0x0110 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,362 @@
+package utils
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Color names images are searchable by
+const (
+	ColorRed    = "red"
+	ColorOrange = "orange"
+	ColorYellow = "yellow"
+	ColorGreen  = "green"
+	ColorCyan   = "cyan"
+	ColorBlue   = "blue"
+	ColorPurple = "purple"
+	ColorPink   = "pink"
+	ColorBrown  = "brown"
+	ColorBlack  = "black"
+	ColorWhite  = "white"
+	ColorGray   = "gray"
+)
+
+// ColorNames lists every color name an image can be assigned
+var ColorNames = []string{
+	ColorRed, ColorOrange, ColorYellow, ColorGreen, ColorCyan, ColorBlue,
+	ColorPurple, ColorPink, ColorBrown, ColorBlack, ColorWhite, ColorGray,
+}
+
+// IsColorName reports whether name is a known color name
+func IsColorName(name string) bool {
+	for _, known := range ColorNames {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	paletteSize     = 5    // Most colors kept in a palette
+	paletteDistance = 48.0 // Least RGB distance between palette colors
+	namedShare      = 0.1  // Least share of the image a palette color needs to name it
+	blurHashSize    = 32   // Longest side of the image a BlurHash is computed from
+)
+
+// ImageColors describes the colors of an image
+type ImageColors struct {
+	Average string         `json:"average"` // #rrggbb
+	Palette []PaletteColor `json:"palette"` // Dominant colors, most common first
+	Names   []string       `json:"names"`   // Named colors of the palette, for color search
+	// BlurHash is a compact placeholder clients can render while the image loads,
+	// see https://blurha.sh
+	BlurHash string `json:"blurhash"`
+}
+
+// PaletteColor is a dominant color and the share of the image it covers
+type PaletteColor struct {
+	Hex   string  `json:"hex"`
+	Share float64 `json:"share"` // 0-1
+}
+
+// ExtractColors computes the average color, dominant palette and BlurHash of an image
+func ExtractColors(img image.Image) *ImageColors {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil
+	}
+
+	small := imaging.Fit(img, 64, 64, imaging.Box)
+	average, palette := computePalette(small)
+	colors := &ImageColors{
+		Average: hexColor(average),
+		Palette: make([]PaletteColor, 0, len(palette)),
+		Names:   []string{},
+	}
+	seen := make(map[string]bool)
+	for _, color := range palette {
+		colors.Palette = append(colors.Palette, PaletteColor{Hex: hexColor(color.rgb), Share: math.Round(color.share*1000) / 1000})
+		if color.share < namedShare {
+			continue
+		}
+		if name := colorName(color.rgb); !seen[name] {
+			seen[name] = true
+			colors.Names = append(colors.Names, name)
+		}
+	}
+
+	xComponents, yComponents := 4, 3
+	if bounds.Dy() > bounds.Dx() {
+		xComponents, yComponents = 3, 4
+	}
+	colors.BlurHash = encodeBlurHash(imaging.Fit(small, blurHashSize, blurHashSize, imaging.Box), xComponents, yComponents)
+	return colors
+}
+
+// paletteEntry is a palette color while it is computed
+type paletteEntry struct {
+	rgb   [3]float64
+	share float64
+}
+
+// computePalette returns the average color of img and its dominant colors. Pixels are
+// counted in buckets of 3 bits per channel; the most common buckets that differ enough
+// become the palette, and every other bucket is merged into the closest of them.
+// Mostly transparent pixels are left out.
+func computePalette(img *image.NRGBA) ([3]float64, []paletteEntry) {
+	type bucket struct {
+		sum   [3]float64
+		count int
+	}
+	buckets := make(map[int]*bucket)
+	var sum [3]float64
+	total := 0
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		if img.Pix[i+3] < 128 {
+			continue
+		}
+		r, g, b := img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+		key := int(r>>5)<<6 | int(g>>5)<<3 | int(b>>5)
+		bk := buckets[key]
+		if bk == nil {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		for c, v := range [3]uint8{r, g, b} {
+			bk.sum[c] += float64(v)
+			sum[c] += float64(v)
+		}
+		bk.count++
+		total++
+	}
+	if total == 0 {
+		return [3]float64{}, nil
+	}
+	average := [3]float64{sum[0] / float64(total), sum[1] / float64(total), sum[2] / float64(total)}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	mean := func(bk *bucket) [3]float64 {
+		n := float64(bk.count)
+		return [3]float64{bk.sum[0] / n, bk.sum[1] / n, bk.sum[2] / n}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		// Equal counts: order by color so the palette doesn't depend on map order
+		a, b := mean(sorted[i]), mean(sorted[j])
+		return a[0]+a[1]*256+a[2]*65536 < b[0]+b[1]*256+b[2]*65536
+	})
+
+	var centers [][3]float64
+	for _, bk := range sorted {
+		if len(centers) == paletteSize {
+			break
+		}
+		color := mean(bk)
+		distinct := true
+		for _, center := range centers {
+			if colorDistance(color, center) < paletteDistance {
+				distinct = false
+				break
+			}
+		}
+		if distinct {
+			centers = append(centers, color)
+		}
+	}
+
+	merged := make([]bucket, len(centers))
+	for _, bk := range sorted {
+		closest := 0
+		for i := range centers {
+			if colorDistance(mean(bk), centers[i]) < colorDistance(mean(bk), centers[closest]) {
+				closest = i
+			}
+		}
+		for c := range bk.sum {
+			merged[closest].sum[c] += bk.sum[c]
+		}
+		merged[closest].count += bk.count
+	}
+
+	palette := make([]paletteEntry, len(merged))
+	for i := range merged {
+		palette[i] = paletteEntry{rgb: mean(&merged[i]), share: float64(merged[i].count) / float64(total)}
+	}
+	sort.SliceStable(palette, func(i, j int) bool { return palette[i].share > palette[j].share })
+	return average, palette
+}
+
+// colorDistance is the Euclidean distance between two RGB colors
+func colorDistance(a, b [3]float64) float64 {
+	dr, dg, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return math.Sqrt(dr*dr + dg*dg + db*db)
+}
+
+// hexColor formats an RGB color as #rrggbb
+func hexColor(rgb [3]float64) string {
+	return fmt.Sprintf("#%02x%02x%02x", uint8(math.Round(rgb[0])), uint8(math.Round(rgb[1])), uint8(math.Round(rgb[2])))
+}
+
+// colorName names the hue of an RGB color
+func colorName(rgb [3]float64) string {
+	r, g, b := rgb[0]/255, rgb[1]/255, rgb[2]/255
+	hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+	value := hi
+	saturation := 0.0
+	if hi > 0 {
+		saturation = (hi - lo) / hi
+	}
+
+	switch {
+	case value < 0.2:
+		return ColorBlack
+	case saturation < 0.15 && value > 0.85:
+		return ColorWhite
+	case saturation < 0.15:
+		return ColorGray
+	}
+
+	var hue float64
+	switch hi {
+	case r:
+		hue = math.Mod((g-b)/(hi-lo), 6)
+	case g:
+		hue = (b-r)/(hi-lo) + 2
+	default:
+		hue = (r-g)/(hi-lo) + 4
+	}
+	hue *= 60
+	if hue < 0 {
+		hue += 360
+	}
+
+	switch {
+	case hue < 15 || hue >= 345:
+		return ColorRed
+	case hue < 45:
+		if value < 0.6 {
+			return ColorBrown
+		}
+		return ColorOrange
+	case hue < 70:
+		return ColorYellow
+	case hue < 165:
+		return ColorGreen
+	case hue < 195:
+		return ColorCyan
+	case hue < 255:
+		return ColorBlue
+	case hue < 290:
+		return ColorPurple
+	default:
+		return ColorPink
+	}
+}
+
+// base83 are the digits of BlurHash numbers
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// encodeBlurHash encodes img as a BlurHash with the given number of components per axis.
+// Transparent pixels are blended over white.
+func encodeBlurHash(img *image.NRGBA, xComponents, yComponents int) string {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	linear := make([][3]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x*4
+			alpha := float64(img.Pix[i+3]) / 255
+			for c := 0; c < 3; c++ {
+				linear[y*w+x][c] = srgbToLinear(float64(img.Pix[i+c])*alpha + 255*(1-alpha))
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					basis := normalisation * math.Cos(math.Pi*float64(i*x)/float64(w)) * math.Cos(math.Pi*float64(j*y)/float64(h))
+					for c := 0; c < 3; c++ {
+						factor[c] += basis * linear[y*w+x][c]
+					}
+				}
+			}
+			scale := 1 / float64(w*h)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((xComponents-1)+(yComponents-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maxValue := 1.0
+	if len(ac) > 0 {
+		actualMax := 0.0
+		for _, factor := range ac {
+			for _, v := range factor {
+				actualMax = math.Max(actualMax, math.Abs(v))
+			}
+		}
+		quantisedMax := int(math.Max(0, math.Min(82, math.Floor(actualMax*166-0.5))))
+		maxValue = float64(quantisedMax+1) / 166
+		hash.WriteString(encodeBase83(quantisedMax, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16|linearToSRGB(dc[1])<<8|linearToSRGB(dc[2]), 4))
+	for _, factor := range ac {
+		quantise := func(v float64) int {
+			signed := math.Copysign(math.Pow(math.Abs(v/maxValue), 0.5), v)
+			return int(math.Max(0, math.Min(18, math.Floor(signed*9+9.5))))
+		}
+		hash.WriteString(encodeBase83(quantise(factor[0])*19*19+quantise(factor[1])*19+quantise(factor[2]), 2))
+	}
+	return hash.String()
+}
+
+// encodeBase83 writes value as length base 83 digits
+func encodeBase83(value, length int) string {
+	digits := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		digits[i] = base83[value%83]
+		value /= 83
+	}
+	return string(digits)
+}
+
+// srgbToLinear converts an sRGB channel (0-255) to linear light (0-1)
+func srgbToLinear(v float64) float64 {
+	v /= 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts linear light (0-1) to an sRGB channel (0-255)
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
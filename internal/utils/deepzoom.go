@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/disintegration/imaging"
+)
+
+// Deep Zoom tiles are 256px including a 1px overlap on each inner edge, the layout
+// OpenSeadragon and other viewers expect by default
+const (
+	DeepZoomTileSize = 254
+	DeepZoomOverlap  = 1
+)
+
+// DeepZoomImage describes the tile pyramid of an image as a Deep Zoom (DZI) descriptor.
+// Level MaxLevel is the full image; every level below halves it, down to a single pixel
+// at level 0.
+type DeepZoomImage struct {
+	XMLName  xml.Name     `xml:"http://schemas.microsoft.com/deepzoom/2008 Image"`
+	Format   string       `xml:"Format,attr"` // Tile file extension: jpg or png
+	Overlap  int          `xml:"Overlap,attr"`
+	TileSize int          `xml:"TileSize,attr"`
+	Size     DeepZoomSize `xml:"Size"`
+}
+
+// DeepZoomSize is the size of the full image
+type DeepZoomSize struct {
+	Width  int `xml:"Width,attr"`
+	Height int `xml:"Height,attr"`
+}
+
+// NewDeepZoomImage describes the pyramid of a width x height image with tiles in format
+func NewDeepZoomImage(width, height int, format string) DeepZoomImage {
+	return DeepZoomImage{
+		Format:   format,
+		Overlap:  DeepZoomOverlap,
+		TileSize: DeepZoomTileSize,
+		Size:     DeepZoomSize{Width: width, Height: height},
+	}
+}
+
+// ParseDeepZoomImage reads a descriptor written by Marshal
+func ParseDeepZoomImage(data []byte) (DeepZoomImage, error) {
+	var dz DeepZoomImage
+	if err := xml.Unmarshal(data, &dz); err != nil {
+		return dz, err
+	}
+	if dz.Size.Width <= 0 || dz.Size.Height <= 0 || dz.TileSize <= 0 {
+		return dz, fmt.Errorf("invalid deep zoom descriptor")
+	}
+	return dz, nil
+}
+
+// Marshal returns the XML descriptor
+func (dz DeepZoomImage) Marshal() ([]byte, error) {
+	data, err := xml.Marshal(dz)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// MaxLevel is the level holding the image at full size
+func (dz DeepZoomImage) MaxLevel() int {
+	level := 0
+	for 1<<level < max(dz.Size.Width, dz.Size.Height) {
+		level++
+	}
+	return level
+}
+
+// LevelSize returns the size of the image at a level, rounding up
+func (dz DeepZoomImage) LevelSize(level int) (width, height int) {
+	scale := 1 << (dz.MaxLevel() - level)
+	return (dz.Size.Width + scale - 1) / scale, (dz.Size.Height + scale - 1) / scale
+}
+
+// LevelTiles returns the number of tile columns and rows of a level
+func (dz DeepZoomImage) LevelTiles(level int) (cols, rows int) {
+	width, height := dz.LevelSize(level)
+	return (width + dz.TileSize - 1) / dz.TileSize, (height + dz.TileSize - 1) / dz.TileSize
+}
+
+// tileBounds returns the region of a level image covered by a tile and its overlap
+func (dz DeepZoomImage) tileBounds(level, col, row int) image.Rectangle {
+	width, height := dz.LevelSize(level)
+	x0, y0 := col*dz.TileSize, row*dz.TileSize
+	if col > 0 {
+		x0 -= dz.Overlap
+	}
+	if row > 0 {
+		y0 -= dz.Overlap
+	}
+	x1 := min((col+1)*dz.TileSize+dz.Overlap, width)
+	y1 := min((row+1)*dz.TileSize+dz.Overlap, height)
+	return image.Rect(x0, y0, x1, y1)
+}
+
+// RenderDeepZoomLevels cuts the tiles of levels top down to bottom from the full-size
+// src, passing each encoded tile to emit. Every level is scaled from the one above it,
+// so the lower levels cost a fraction of the top one. quality applies to JPEG tiles.
+func RenderDeepZoomLevels(src image.Image, dz DeepZoomImage, top, bottom, quality int, emit func(level, col, row int, data []byte) error) error {
+	if top > dz.MaxLevel() || bottom < 0 || bottom > top {
+		return fmt.Errorf("invalid deep zoom levels %d-%d", bottom, top)
+	}
+
+	levelImage := src
+	for level := top; level >= bottom; level-- {
+		width, height := dz.LevelSize(level)
+		if bounds := levelImage.Bounds(); bounds.Dx() != width || bounds.Dy() != height {
+			levelImage = imaging.Resize(levelImage, width, height, imaging.Linear)
+		}
+
+		cols, rows := dz.LevelTiles(level)
+		for row := 0; row < rows; row++ {
+			for col := 0; col < cols; col++ {
+				tile := imaging.Crop(levelImage, dz.tileBounds(level, col, row))
+
+				var buf bytes.Buffer
+				var err error
+				if dz.Format == "png" {
+					err = png.Encode(&buf, tile)
+				} else {
+					err = jpeg.Encode(&buf, tile, &jpeg.Options{Quality: quality})
+				}
+				if err != nil {
+					return fmt.Errorf("failed to encode tile: %v", err)
+				}
+				if err := emit(level, col, row, buf.Bytes()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// officeExtensions lists document formats that are converted to PDF before rendering
+var officeExtensions = map[string]bool{
+	".doc": true, ".docx": true, ".odt": true, ".rtf": true,
+	".xls": true, ".xlsx": true, ".ods": true,
+	".ppt": true, ".pptx": true, ".odp": true,
+}
+
+// OfficeConverter converts the office document at inPath to a PDF inside outDir and
+// returns the path of the PDF. It defaults to headless LibreOffice; set it to nil to
+// disable office previews or replace it to use a different conversion service.
+var OfficeConverter func(inPath, outDir string) (string, error) = libreOfficeToPDF
+
+// IsDocument reports whether a file can be rendered as a document preview
+func IsDocument(mimeType, filename string) bool {
+	if mimeType == "application/pdf" {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".pdf" || officeExtensions[ext]
+}
+
+// RenderDocumentPreview renders the first page of a PDF or office document to PNG
+func RenderDocumentPreview(input io.Reader, filename string) ([]byte, error) {
+	workDir, err := os.MkdirTemp("", "doc-preview-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		ext = ".pdf"
+	}
+	srcPath := filepath.Join(workDir, "source"+ext)
+	srcFile, err := os.Create(srcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %v", err)
+	}
+	if _, err := io.Copy(srcFile, input); err != nil {
+		srcFile.Close()
+		return nil, fmt.Errorf("failed to write temp file: %v", err)
+	}
+	srcFile.Close()
+
+	pdfPath := srcPath
+	if officeExtensions[ext] {
+		if OfficeConverter == nil {
+			return nil, fmt.Errorf("previews for %s documents are not enabled", ext)
+		}
+		if pdfPath, err = OfficeConverter(srcPath, workDir); err != nil {
+			return nil, fmt.Errorf("failed to convert document to PDF: %v", err)
+		}
+	}
+
+	// -singlefile writes <prefix>.png instead of numbering the pages
+	outPrefix := filepath.Join(workDir, "preview")
+	cmd := exec.Command("pdftoppm", "-png", "-f", "1", "-l", "1", "-r", "150", "-singlefile", pdfPath, outPrefix)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("pdf rendering failed: %v: %s", err, output)
+	}
+
+	data, err := os.ReadFile(outPrefix + ".png")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rendered page: %v", err)
+	}
+	return data, nil
+}
+
+// libreOfficeToPDF converts an office document to PDF with headless LibreOffice
+func libreOfficeToPDF(inPath, outDir string) (string, error) {
+	// A private profile directory lets concurrent conversions run side by side
+	profile := "-env:UserInstallation=file://" + filepath.ToSlash(filepath.Join(outDir, "lo-profile"))
+	cmd := exec.Command("soffice", profile, "--headless", "--convert-to", "pdf", "--outdir", outDir, inPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("soffice failed: %v: %s", err, output)
+	}
+
+	pdfPath := filepath.Join(outDir, strings.TrimSuffix(filepath.Base(inPath), filepath.Ext(inPath))+".pdf")
+	if _, err := os.Stat(pdfPath); err != nil {
+		return "", fmt.Errorf("converted PDF not found: %v", err)
+	}
+	return pdfPath, nil
+}
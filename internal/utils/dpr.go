@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"math"
+
+	"go-media-center-example/internal/config"
+)
+
+// maxDPR is the highest device pixel ratio a transform may ask for
+const maxDPR = 3
+
+// validateDPR checks the dpr option. NaN fails every comparison, so it is rejected
+// explicitly.
+func (t *TransformationOptions) validateDPR() error {
+	if math.IsNaN(t.DPR) || math.IsInf(t.DPR, 0) || (t.DPR != 0 && (t.DPR < 1 || t.DPR > maxDPR)) {
+		return optionError("dpr", "dpr must be between 1 and %d", maxDPR)
+	}
+	return nil
+}
+
+// ApplyDPR multiplies the requested width and height by the device pixel ratio and
+// clears it, so width=400&dpr=2 renders and caches exactly like width=800. Scaled sizes
+// are capped at TRANSFORM_DPR_MAX_DIMENSION on their longer side, keeping the aspect
+// ratio, but never below the size asked for at dpr=1. Call it after applying a preset.
+func (t *TransformationOptions) ApplyDPR() {
+	dpr := t.DPR
+	t.DPR = 0
+	if dpr <= 1 || (t.Width == 0 && t.Height == 0) {
+		return
+	}
+
+	limit := float64(max(config.GetConfig().Transform.MaxDPRDimension, t.Width, t.Height))
+	if longest := float64(max(t.Width, t.Height)) * dpr; longest > limit {
+		dpr = limit / float64(max(t.Width, t.Height))
+	}
+	t.Width = int(math.Round(float64(t.Width) * dpr))
+	t.Height = int(math.Round(float64(t.Height) * dpr))
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestValidateDPR(t *testing.T) {
+	tests := []struct {
+		name  string
+		dpr   float64
+		valid bool
+	}{
+		{"unset", 0, true},
+		{"one", 1, true},
+		{"fractional", 1.5, true},
+		{"max", maxDPR, true},
+		{"below one", 0.5, false},
+		{"negative", -2, false},
+		{"above max", maxDPR + 0.1, false},
+		{"NaN", math.NaN(), false},
+		{"positive infinity", math.Inf(1), false},
+		{"negative infinity", math.Inf(-1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := TransformationOptions{Width: 400, DPR: tt.dpr}
+			err := options.Validate()
+			if tt.valid {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var optionErr *OptionError
+			if !errors.As(err, &optionErr) || optionErr.Option != "dpr" {
+				t.Fatalf("Validate() = %v, want a dpr option error", err)
+			}
+		})
+	}
+}
+
+func TestParsedNaNDPRIsRejected(t *testing.T) {
+	for _, value := range []string{"NaN", "nan", "Inf", "-Inf", "+Infinity"} {
+		options := TransformationOptions{Width: 400, DPR: ParseFloatOption(value)}
+		if err := options.Validate(); err == nil {
+			t.Errorf("dpr=%s: Validate() = nil, want an error", value)
+		}
+	}
+}
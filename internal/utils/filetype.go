@@ -0,0 +1,181 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go-media-center-example/internal/config"
+)
+
+// ErrFileTypeNotAllowed is returned for uploads rejected by the file type policy
+var ErrFileTypeNotAllowed = errors.New("file type not allowed")
+
+// extensionContent lists the sniffed types each known extension may contain. Files with an
+// extension missing here are only checked against the allow and deny lists.
+var extensionContent = map[string][]string{
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".png":  {"image/png"},
+	".gif":  {"image/gif"},
+	".webp": {"image/webp"},
+	".bmp":  {"image/bmp"},
+	".ico":  {"image/x-icon"},
+	".tif":  {"image/tiff"},
+	".tiff": {"image/tiff"},
+	".heic": {"image/heic"},
+	".heif": {"image/heic"},
+	".avif": {"image/avif"},
+	".svg":  {"text/xml", "text/plain"},
+	".mp4":  {"video/mp4", "video/quicktime"},
+	".m4v":  {"video/mp4", "video/quicktime"},
+	".mov":  {"video/quicktime", "video/mp4"},
+	".m4a":  {"audio/mp4", "video/mp4"},
+	".avi":  {"video/avi"},
+	".webm": {"video/webm"},
+	".mkv":  {"video/webm"},
+	".mp3":  {"audio/mpeg"},
+	".wav":  {"audio/wave"},
+	".ogg":  {"application/ogg"},
+	".flac": {"audio/flac"},
+	".pdf":  {"application/pdf"},
+	".doc":  {"application/x-ole-storage"},
+	".xls":  {"application/x-ole-storage"},
+	".ppt":  {"application/x-ole-storage"},
+	".docx": {"application/zip"},
+	".xlsx": {"application/zip"},
+	".pptx": {"application/zip"},
+	".odt":  {"application/zip"},
+	".ods":  {"application/zip"},
+	".odp":  {"application/zip"},
+	".zip":  {"application/zip"},
+	".gz":   {"application/x-gzip"},
+	".rar":  {"application/x-rar-compressed"},
+	".rtf":  {"text/rtf"},
+	".txt":  {"text/plain"},
+	".csv":  {"text/plain"},
+	".md":   {"text/plain"},
+	".json": {"text/plain"},
+	".xml":  {"text/xml", "text/plain"},
+}
+
+// SniffContentType detects the MIME type of a file from its first 512 bytes. It extends
+// http.DetectContentType with executables and the image, video and office containers the
+// standard library reports as application/octet-stream.
+func SniffContentType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("MZ")):
+		return "application/x-msdownload"
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		return "application/x-executable"
+	case bytes.HasPrefix(head, []byte{0xfe, 0xed, 0xfa, 0xce}),
+		bytes.HasPrefix(head, []byte{0xfe, 0xed, 0xfa, 0xcf}),
+		bytes.HasPrefix(head, []byte{0xce, 0xfa, 0xed, 0xfe}),
+		bytes.HasPrefix(head, []byte{0xcf, 0xfa, 0xed, 0xfe}),
+		bytes.HasPrefix(head, []byte{0xca, 0xfe, 0xba, 0xbe}):
+		return "application/x-mach-binary"
+	case bytes.HasPrefix(head, []byte("#!")):
+		return "text/x-shellscript"
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "image/tiff"
+	case bytes.HasPrefix(head, []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}):
+		return "application/x-ole-storage"
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "audio/flac"
+	}
+
+	// ISO base media files name their flavor in the major brand of the ftyp box
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch string(head[8:12]) {
+		case "heic", "heix", "hevc", "heim", "heis", "mif1", "msf1":
+			return "image/heic"
+		case "avif", "avis":
+			return "image/avif"
+		case "qt  ":
+			return "video/quicktime"
+		case "M4A ":
+			return "audio/mp4"
+		}
+	}
+
+	return http.DetectContentType(head)
+}
+
+// CheckFileType sniffs the content of an upload from its first bytes and checks it and
+// the filename's extension against the allow and deny lists. Content that doesn't match
+// a known extension is rejected, so an executable can't pass as image.jpg. It returns the
+// sniffed type.
+func CheckFileType(policy config.FileTypeConfig, filename string, head []byte) (string, error) {
+	ext := strings.ToLower(filepath.Ext(filename))
+	sniffed := SniffContentType(head)
+	base, _, _ := strings.Cut(sniffed, ";")
+
+	if err := CheckFileExtension(policy, filename); err != nil {
+		return sniffed, err
+	}
+	if matchesAny(base, policy.DeniedTypes, matchType) {
+		return sniffed, fmt.Errorf("%w: %s content is not allowed", ErrFileTypeNotAllowed, base)
+	}
+	if len(policy.AllowedTypes) > 0 && !matchesAny(base, policy.AllowedTypes, matchType) {
+		return sniffed, fmt.Errorf("%w: %s content is not allowed", ErrFileTypeNotAllowed, base)
+	}
+
+	if expected, known := extensionContent[ext]; known && !slices.Contains(expected, base) {
+		return sniffed, fmt.Errorf("%w: %s content doesn't match the %s extension", ErrFileTypeNotAllowed, base, ext)
+	}
+
+	return sniffed, nil
+}
+
+// CheckFileExtension checks the extension of filename against the allow and deny lists,
+// which is all that can be checked before the content is available
+func CheckFileExtension(policy config.FileTypeConfig, filename string) error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext != "" && matchesAny(ext, policy.DeniedExtensions, matchExtension) {
+		return fmt.Errorf("%w: %s files are not allowed", ErrFileTypeNotAllowed, ext)
+	}
+	if len(policy.AllowedExtensions) > 0 && !matchesAny(ext, policy.AllowedExtensions, matchExtension) {
+		return fmt.Errorf("%w: %s files are not allowed", ErrFileTypeNotAllowed, extensionLabel(ext))
+	}
+	return nil
+}
+
+// matchesAny reports whether value matches one of patterns
+func matchesAny(value string, patterns []string, match func(value, pattern string) bool) bool {
+	for _, pattern := range patterns {
+		if match(value, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchExtension compares extensions case-insensitively, with or without the leading dot
+func matchExtension(ext, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if !strings.HasPrefix(pattern, ".") {
+		pattern = "." + pattern
+	}
+	return ext == pattern
+}
+
+// matchType compares MIME types; a pattern such as image/* matches a whole family
+func matchType(mimeType, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if family, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mimeType, family+"/")
+	}
+	return mimeType == pattern
+}
+
+// extensionLabel names an extension in error messages
+func extensionLabel(ext string) string {
+	if ext == "" {
+		return "Extensionless"
+	}
+	return ext
+}
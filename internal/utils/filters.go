@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// maxFilterSigma bounds blur and sharpen strength to keep processing time reasonable
+const maxFilterSigma = 100
+
+// HasFilters reports whether any color or blur filter was requested
+func (t *TransformationOptions) HasFilters() bool {
+	return t.Blur != 0 || t.Sharpen != 0 || t.Grayscale ||
+		t.Brightness != 0 || t.Contrast != 0 || t.Saturation != 0
+}
+
+// validateFilters checks the filter options
+func (t *TransformationOptions) validateFilters() error {
+	if t.Blur < 0 || t.Blur > maxFilterSigma {
+		return optionError("blur", "blur must be between 0 and %d", maxFilterSigma)
+	}
+	if t.Sharpen < 0 || t.Sharpen > maxFilterSigma {
+		return optionError("sharpen", "sharpen must be between 0 and %d", maxFilterSigma)
+	}
+	for name, value := range map[string]float64{
+		"brightness": t.Brightness,
+		"contrast":   t.Contrast,
+		"saturation": t.Saturation,
+	} {
+		if value < -100 || value > 100 {
+			return optionError(name, "%s must be between -100 and 100", name)
+		}
+	}
+	return nil
+}
+
+// ApplyFilters applies color adjustments, then grayscale, then blur and sharpen
+func ApplyFilters(img *image.NRGBA, options TransformationOptions) *image.NRGBA {
+	if options.Brightness != 0 {
+		img = imaging.AdjustBrightness(img, options.Brightness)
+	}
+	if options.Contrast != 0 {
+		img = imaging.AdjustContrast(img, options.Contrast)
+	}
+	if options.Saturation != 0 {
+		img = imaging.AdjustSaturation(img, options.Saturation)
+	}
+	if options.Grayscale {
+		img = imaging.Grayscale(img)
+	}
+	if options.Blur > 0 {
+		img = imaging.Blur(img, options.Blur)
+	}
+	if options.Sharpen > 0 {
+		img = imaging.Sharpen(img, options.Sharpen)
+	}
+	return img
+}
@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	// iccHeader starts the APP2 segments a JPEG's ICC profile is split across
+	iccHeader = "ICC_PROFILE\x00"
+	// iccSegmentSize is the most profile data one APP2 segment holds
+	iccSegmentSize = 65535 - 2 - len(iccHeader) - 2
+	// maxICCProfile bounds the size of a profile read from an image
+	maxICCProfile = 4 << 20
+)
+
+// xyzToSRGB converts XYZ, relative to the D50 white of ICC profiles, to linear sRGB
+var xyzToSRGB = [3][3]float64{
+	{3.1338561, -1.6168667, -0.4906146},
+	{-0.9787684, 1.9161415, 0.0334540},
+	{0.0719453, -0.2289914, 1.4052427},
+}
+
+// ICCProfile is an ICC color profile embedded in an image. Only RGB matrix/TRC profiles,
+// such as Display P3, Adobe RGB and ProPhoto RGB, can be converted to sRGB.
+type ICCProfile struct {
+	Data []byte // The profile as embedded
+
+	convertible bool
+	toSRGB      [3][3]float64 // Linear RGB of the profile to linear sRGB
+	linear      [3][256]float64
+}
+
+// ParseICCProfile reads an ICC profile. Profiles that can't be converted to sRGB are
+// still returned, so they can be embedded again.
+func ParseICCProfile(data []byte) *ICCProfile {
+	profile := &ICCProfile{Data: data}
+	if len(data) < 132 || string(data[16:20]) != "RGB " || string(data[20:24]) != "XYZ " {
+		return profile
+	}
+	tags := map[string][]byte{}
+	count := int(binary.BigEndian.Uint32(data[128:]))
+	for i := 0; i < count && 132+i*12+12 <= len(data); i++ {
+		entry := data[132+i*12:]
+		offset, size := int(binary.BigEndian.Uint32(entry[4:])), int(binary.BigEndian.Uint32(entry[8:]))
+		if offset >= 0 && size >= 0 && offset+size <= len(data) && offset+size >= offset {
+			tags[string(entry[:4])] = data[offset : offset+size]
+		}
+	}
+
+	// The colorants are the XYZ of the red, green and blue primaries, the matrix columns
+	var toXYZ [3][3]float64
+	for column, name := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz, ok := parseXYZTag(tags[name])
+		if !ok {
+			return profile
+		}
+		for row := range xyz {
+			toXYZ[row][column] = xyz[row]
+		}
+	}
+	for channel, name := range []string{"rTRC", "gTRC", "bTRC"} {
+		curve, ok := parseCurveTag(tags[name])
+		if !ok {
+			return profile
+		}
+		for i := range profile.linear[channel] {
+			profile.linear[channel][i] = curve(float64(i) / 255)
+		}
+	}
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			for k := 0; k < 3; k++ {
+				profile.toSRGB[row][column] += xyzToSRGB[row][k] * toXYZ[k][column]
+			}
+		}
+	}
+	profile.convertible = true
+	return profile
+}
+
+// parseXYZTag reads an XYZType tag
+func parseXYZTag(tag []byte) ([3]float64, bool) {
+	var xyz [3]float64
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return xyz, false
+	}
+	for i := range xyz {
+		xyz[i] = float64(int32(binary.BigEndian.Uint32(tag[8+i*4:]))) / 65536
+	}
+	return xyz, true
+}
+
+// parseCurveTag reads a curveType or parametricCurveType tag as a function from encoded
+// to linear values, both from 0 to 1
+func parseCurveTag(tag []byte) (func(float64) float64, bool) {
+	if len(tag) < 12 {
+		return nil, false
+	}
+	switch string(tag[:4]) {
+	case "curv":
+		count := int(binary.BigEndian.Uint32(tag[8:]))
+		switch {
+		case count == 0:
+			return func(x float64) float64 { return x }, true
+		case count == 1 && len(tag) >= 14:
+			gamma := float64(binary.BigEndian.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, true
+		case count > 1 && len(tag) >= 12+2*count:
+			table := make([]float64, count)
+			for i := range table {
+				table[i] = float64(binary.BigEndian.Uint16(tag[12+2*i:])) / 65535
+			}
+			return func(x float64) float64 {
+				pos := x * float64(count-1)
+				i := min(int(pos), count-2)
+				return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+			}, true
+		}
+	case "para":
+		params := map[uint16]int{0: 1, 1: 3, 2: 4, 3: 5, 4: 7}
+		function := binary.BigEndian.Uint16(tag[8:])
+		n, ok := params[function]
+		if !ok || len(tag) < 12+4*n {
+			return nil, false
+		}
+		var p [7]float64
+		for i := 0; i < n; i++ {
+			p[i] = float64(int32(binary.BigEndian.Uint32(tag[12+4*i:]))) / 65536
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		return func(x float64) float64 {
+			switch function {
+			case 0:
+				return math.Pow(x, g)
+			case 1:
+				if x >= -b/a {
+					return math.Pow(a*x+b, g)
+				}
+				return 0
+			case 2:
+				if x >= -b/a {
+					return math.Pow(a*x+b, g) + c
+				}
+				return c
+			case 3:
+				if x >= d {
+					return math.Pow(a*x+b, g)
+				}
+				return c * x
+			default:
+				if x >= d {
+					return math.Pow(a*x+b, g) + e
+				}
+				return c*x + f
+			}
+		}, true
+	}
+	return nil, false
+}
+
+// srgbLinear decodes an sRGB value from 0 to 1
+func srgbLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// srgbEncode encodes a linear value from 0 to 1 as sRGB
+func srgbEncode(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Convertible reports whether images in this profile can be converted to sRGB
+func (p *ICCProfile) Convertible() bool {
+	return p != nil && p.convertible
+}
+
+// IsSRGB reports whether the profile describes sRGB closely enough to be left out
+func (p *ICCProfile) IsSRGB() bool {
+	if !p.Convertible() {
+		return false
+	}
+	for row := 0; row < 3; row++ {
+		for column := 0; column < 3; column++ {
+			identity := 0.0
+			if row == column {
+				identity = 1
+			}
+			if math.Abs(p.toSRGB[row][column]-identity) > 0.01 {
+				return false
+			}
+		}
+	}
+	for channel := range p.linear {
+		for i, value := range p.linear[channel] {
+			if math.Abs(value-srgbLinear(float64(i)/255)) > 0.002 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ConvertToSRGB converts the pixels of img, in the colors of the profile, to sRGB in
+// place. Colors outside sRGB are clipped.
+func (p *ICCProfile) ConvertToSRGB(img *image.NRGBA) {
+	if !p.Convertible() {
+		return
+	}
+	var encode [4096]uint8
+	for i := range encode {
+		encode[i] = uint8(math.Round(srgbEncode(float64(i)/4095) * 255))
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(bounds.Min.X, y):img.PixOffset(bounds.Max.X, y)]
+		for i := 0; i+3 < len(row); i += 4 {
+			r, g, b := p.linear[0][row[i]], p.linear[1][row[i+1]], p.linear[2][row[i+2]]
+			for channel := 0; channel < 3; channel++ {
+				m := p.toSRGB[channel]
+				v := math.Max(0, math.Min(1, m[0]*r+m[1]*g+m[2]*b))
+				row[i+channel] = encode[int(v*4095+0.5)]
+			}
+		}
+	}
+}
+
+// ExtractICCProfile returns the ICC profile embedded in a JPEG or PNG, or nil
+func ExtractICCProfile(data []byte) *ICCProfile {
+	if segments, _, ok := splitJPEG(data); ok {
+		// Large profiles are split across segments numbered from 1
+		parts := map[int][]byte{}
+		for _, segment := range segments {
+			if payload := segment[4:]; segment[1] == 0xE2 && bytes.HasPrefix(payload, []byte(iccHeader)) && len(payload) > len(iccHeader)+2 {
+				parts[int(payload[len(iccHeader)])] = payload[len(iccHeader)+2:]
+			}
+		}
+		if len(parts) == 0 {
+			return nil
+		}
+		numbers := make([]int, 0, len(parts))
+		for number := range parts {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+		var profile []byte
+		for _, number := range numbers {
+			profile = append(profile, parts[number]...)
+		}
+		return ParseICCProfile(profile)
+	}
+	if chunks, ok := splitPNG(data); ok {
+		for _, chunk := range chunks {
+			if string(chunk[4:8]) != "iCCP" {
+				continue
+			}
+			// Profile name, a null byte, the compression method and the zlib stream
+			body := chunk[8 : len(chunk)-4]
+			name := bytes.IndexByte(body, 0)
+			if name < 0 || name+2 > len(body) {
+				return nil
+			}
+			r, err := zlib.NewReader(bytes.NewReader(body[name+2:]))
+			if err != nil {
+				return nil
+			}
+			profile, err := io.ReadAll(io.LimitReader(r, maxICCProfile))
+			if err != nil {
+				return nil
+			}
+			return ParseICCProfile(profile)
+		}
+	}
+	return nil
+}
+
+// EmbedICCProfile embeds an ICC profile in an encoded JPEG or PNG without one. Other
+// formats are returned as they are.
+func EmbedICCProfile(data []byte, profile []byte) []byte {
+	if _, _, ok := splitJPEG(data); ok {
+		count := (len(profile) + iccSegmentSize - 1) / iccSegmentSize
+		if count == 0 || count > 255 {
+			return data
+		}
+		out := make([]byte, 0, len(data)+len(profile)+count*20)
+		out = append(out, data[:2]...)
+		for i := 0; i < count; i++ {
+			part := profile[i*iccSegmentSize : min(len(profile), (i+1)*iccSegmentSize)]
+			length := 2 + len(iccHeader) + 2 + len(part)
+			out = append(out, 0xFF, 0xE2, byte(length>>8), byte(length))
+			out = append(out, iccHeader...)
+			out = append(out, byte(i+1), byte(count))
+			out = append(out, part...)
+		}
+		return append(out, data[2:]...)
+	}
+	if chunks, ok := splitPNG(data); ok && len(chunks) > 0 {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write(profile)
+		w.Close()
+		body := append([]byte("ICC Profile\x00\x00"), compressed.Bytes()...)
+
+		// iCCP goes right after IHDR, before the palette and image data
+		out := make([]byte, 0, len(data)+len(body)+12)
+		out = append(out, pngSignature...)
+		out = append(out, chunks[0]...)
+		out = binary.BigEndian.AppendUint32(out, uint32(len(body)))
+		start := len(out)
+		out = append(out, "iCCP"...)
+		out = append(out, body...)
+		out = binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+		for _, chunk := range chunks[1:] {
+			out = append(out, chunk...)
+		}
+		return out
+	}
+	return data
+}
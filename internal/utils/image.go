@@ -2,95 +2,200 @@ package utils
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"strings"
 
 	"github.com/disintegration/imaging"
+
+	"go-media-center-example/internal/config"
 )
 
+// ErrImageTooLarge is returned for source images above TRANSFORM_MAX_PIXELS
+var ErrImageTooLarge = errors.New("image is too large to transform")
+
 // TransformationOptions defines the available image transformation options
 type TransformationOptions struct {
-	Width   int    // Width in pixels
-	Height  int    // Height in pixels
-	Fit     string // Fit mode: "contain", "cover", "fill"
-	Crop    string // Crop position: "center", "top", "bottom", "left", "right"
-	Quality int    // JPEG quality (1-100)
-	Format  string // Output format: "jpeg", "png", "webp"
-	Preset  string // Predefined transformation preset
-	Fresh   bool   // Force fresh transformation
+	Width   int     // Width in pixels
+	Height  int     // Height in pixels
+	Fit     string  // Fit mode: "contain", "cover", "fill"
+	Crop    string  // Crop position: "center", "top", "bottom", "left", "right", or "smart" for saliency-based
+	Quality int     // JPEG quality (1-100)
+	Format  string  // Output format: "jpeg", "png", "webp", or "mp4"/"webm" for animated GIFs
+	Preset  string  // Predefined transformation preset
+	Rotate  float64 // Clockwise rotation in degrees; 90, 180 and 270 are lossless
+	Flip    string  // Mirror: "h" (horizontal), "v" (vertical) or "hv" (both)
+	DPR     float64 // Device pixel ratio (1-3) multiplying Width and Height, folded in by ApplyDPR
+	Strip   string  // "true" removes EXIF, ICC and XMP from the output, "false" keeps them; empty applies TRANSFORM_STRIP_METADATA
+
+	Colorspace string // "srgb" converts images with an embedded ICC profile to sRGB and drops the profile
+
+	Blur       float64 // Gaussian blur sigma (0-100)
+	Sharpen    float64 // Sharpen sigma (0-100)
+	Grayscale  bool    // Convert to grayscale
+	Brightness float64 // Brightness change in percent (-100 to 100)
+	Contrast   float64 // Contrast change in percent (-100 to 100)
+	Saturation float64 // Saturation change in percent (-100 to 100)
+	Fresh      bool    // Force fresh transformation
+
+	Watermark         string      // Watermark media ID, or "default" for the configured watermark
+	WatermarkPosition string      // "center", "top-left", "top-right", "bottom-left" or "bottom-right"
+	WatermarkOpacity  float64     // Watermark opacity (0-1)
+	WatermarkScale    float64     // Watermark width relative to the image width (0-1)
+	WatermarkImage    image.Image `json:"-"` // Decoded watermark, resolved by the caller from Watermark
 }
 
 // IsEmpty checks if any transformation options are set
 func (t *TransformationOptions) IsEmpty() bool {
 	return t.Width == 0 && t.Height == 0 && t.Fit == "" && t.Crop == "" &&
-		t.Quality == 0 && t.Format == "" && t.Preset == "" && !t.Fresh
+		t.Quality == 0 && t.Format == "" && t.Preset == "" && !t.Fresh && t.Strip != "true" && t.Colorspace == "" && !t.HasWatermark() && !t.HasOrientation() && !t.HasFilters()
+}
+
+// StripsMetadata reports whether the output is stripped of EXIF, ICC and XMP
+func (t *TransformationOptions) StripsMetadata() bool {
+	if t.Strip == "" {
+		return config.GetConfig().Transform.StripMetadata
+	}
+	return t.Strip == "true"
+}
+
+// OptionError is a transformation option with an invalid value
+type OptionError struct {
+	Option  string // Query parameter name of the option, such as fit
+	Message string
 }
 
-// Validate checks if the transformation options are valid
+func (e *OptionError) Error() string { return e.Message }
+
+// optionError reports an invalid value of option
+func optionError(option, format string, args ...interface{}) error {
+	return &OptionError{Option: option, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validate checks if the transformation options are valid. Errors are *OptionError.
 func (t *TransformationOptions) Validate() error {
 	// Check dimensions
-	if t.Width < 0 || t.Height < 0 {
-		return fmt.Errorf("width and height must be non-negative")
+	if t.Width < 0 {
+		return optionError("width", "width and height must be non-negative")
+	}
+	if t.Height < 0 {
+		return optionError("height", "width and height must be non-negative")
 	}
 
 	// Maximum dimension increased to 16384 (16K resolution)
 	maxDimension := 16384
-	if t.Width > maxDimension || t.Height > maxDimension {
-		return fmt.Errorf("maximum allowed dimension is %d pixels", maxDimension)
+	if t.Width > maxDimension {
+		return optionError("width", "maximum allowed dimension is %d pixels", maxDimension)
+	}
+	if t.Height > maxDimension {
+		return optionError("height", "maximum allowed dimension is %d pixels", maxDimension)
 	}
 
 	// Check fit mode
 	if t.Fit != "" && t.Fit != "contain" && t.Fit != "cover" && t.Fit != "fill" {
-		return fmt.Errorf("invalid fit mode: %s", t.Fit)
+		return optionError("fit", "invalid fit mode: %s (expected contain, cover or fill)", t.Fit)
 	}
 
 	// Check crop position
-	if t.Crop != "" && t.Crop != "center" && t.Crop != "top" && t.Crop != "bottom" && t.Crop != "left" && t.Crop != "right" {
-		return fmt.Errorf("invalid crop position: %s", t.Crop)
+	if t.Crop != "" && t.Crop != "center" && t.Crop != "top" && t.Crop != "bottom" && t.Crop != "left" && t.Crop != "right" && t.Crop != "smart" {
+		return optionError("crop", "invalid crop position: %s (expected center, top, bottom, left, right or smart)", t.Crop)
+	}
+	// A smart crop picks a window of the requested shape, so it needs both sides of it;
+	// presets supply their own size
+	if t.Crop == "smart" && t.Preset == "" && (t.Width == 0 || t.Height == 0) {
+		return optionError("crop", "crop=smart needs both width and height")
 	}
 
 	// Check quality
 	if t.Quality < 0 || t.Quality > 100 {
-		return fmt.Errorf("quality must be between 0 and 100")
+		return optionError("quality", "quality must be between 0 and 100")
 	}
 
 	// Check format
-	if t.Format != "" && t.Format != "jpeg" && t.Format != "jpg" && t.Format != "png" && t.Format != "webp" {
-		return fmt.Errorf("unsupported format: %s", t.Format)
+	if t.Format != "" && t.Format != "jpeg" && t.Format != "jpg" && t.Format != "png" && t.Format != "webp" && !t.IsVideoFormat() {
+		return optionError("format", "unsupported format: %s (expected jpeg, png, webp, mp4 or webm)", t.Format)
 	}
 
-	return nil
+	if t.Strip != "" && t.Strip != "true" && t.Strip != "false" {
+		return optionError("strip", "strip must be true or false")
+	}
+
+	if t.Colorspace != "" && t.Colorspace != "srgb" {
+		return optionError("colorspace", "unsupported colorspace: %s (expected srgb)", t.Colorspace)
+	}
+
+	if err := t.validateDPR(); err != nil {
+		return err
+	}
+
+	if err := t.validateOrientation(); err != nil {
+		return err
+	}
+
+	if err := t.validateFilters(); err != nil {
+		return err
+	}
+
+	return t.ValidateWatermark()
 }
 
 // TransformImage applies the specified transformations to an image
 func TransformImage(input io.Reader, options TransformationOptions) ([]byte, error) {
+	if options.IsVideoFormat() {
+		return nil, fmt.Errorf("%s output is only available for animated GIFs via the transform endpoint", options.Format)
+	}
+
+	originalBytes, err := io.ReadAll(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original image: %v", err)
+	}
+
+	// Images in another color space are converted to sRGB when asked to, and when their
+	// profile is stripped, as colors would shift without it
+	profile := ExtractICCProfile(originalBytes)
+	toSRGB := profile.Convertible() && !profile.IsSRGB() && (options.Colorspace == "srgb" || options.StripsMetadata())
 
 	// If no parameter header
-	if options.Width == 0 && options.Height == 0 && options.Fit == "" && options.Crop == "" && options.Format == "" {
-		originalBytes, err := io.ReadAll(input)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read original image: %v", err)
+	if options.Width == 0 && options.Height == 0 && options.Fit == "" && options.Crop == "" && options.Format == "" && options.WatermarkImage == nil && !options.HasOrientation() && !options.HasFilters() && !toSRGB {
+		if options.StripsMetadata() {
+			return StripMetadata(originalBytes), nil
 		}
 		return originalBytes, nil
 	}
 
+	// Refuse images whose decoded pixels alone would take too much memory
+	if maxPixels := config.GetConfig().Transform.MaxPixels; maxPixels > 0 {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(originalBytes)); err == nil && int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+			return nil, fmt.Errorf("%w: %dx%d is over %d pixels", ErrImageTooLarge, cfg.Width, cfg.Height, maxPixels)
+		}
+	}
+
 	// Decode the input image
-	src, format, err := image.Decode(input)
+	src, format, err := image.Decode(bytes.NewReader(originalBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %v", err)
 	}
 
+	// Convert to NRGBA to ensure consistent color space
+	img := imaging.Clone(src)
+	if toSRGB {
+		profile.ConvertToSRGB(img)
+	}
+
+	// Rotate and flip first so sizes and crops apply to the image as it will be seen
+	if options.HasOrientation() {
+		img = ApplyOrientation(img, options)
+	}
+
 	// Get original dimensions
-	bounds := src.Bounds()
+	bounds := img.Bounds()
 	origWidth := bounds.Dx()
 	origHeight := bounds.Dy()
 
-	// Convert to NRGBA to ensure consistent color space
-	img := imaging.Clone(src)
-
 	// Apply transformations
 	var transformed *image.NRGBA
 
@@ -113,13 +218,16 @@ func TransformImage(input io.Reader, options TransformationOptions) ([]byte, err
 
 		fmt.Printf("Target dimensions: %dx%d\n", targetWidth, targetHeight)
 
-		// Apply resize based on fit mode
-		switch options.Fit {
-		case "contain":
+		// Apply resize based on fit mode; smart crop picks the window itself and then scales it
+		switch {
+		case options.Crop == "smart":
+			window := SmartCropRect(img, targetWidth, targetHeight)
+			transformed = imaging.Resize(imaging.Crop(img, window), targetWidth, targetHeight, imaging.Lanczos)
+		case options.Fit == "contain":
 			transformed = imaging.Fit(img, targetWidth, targetHeight, imaging.Lanczos)
-		case "cover":
+		case options.Fit == "cover":
 			transformed = imaging.Fill(img, targetWidth, targetHeight, imaging.Center, imaging.Lanczos)
-		case "fill":
+		case options.Fit == "fill":
 			transformed = imaging.Resize(img, targetWidth, targetHeight, imaging.Lanczos)
 		default:
 			// Default to contain if no fit specified
@@ -133,8 +241,13 @@ func TransformImage(input io.Reader, options TransformationOptions) ([]byte, err
 
 	fmt.Println("Crop:", options.Crop)
 
-	// Handle cropping if specified
-	if options.Crop != "" {
+	// Without a resize, crops and format conversions start from the original
+	if transformed == nil {
+		transformed = img
+	}
+
+	// Handle cropping if specified (smart crops were applied while resizing)
+	if options.Crop != "" && options.Crop != "smart" {
 		currentBounds := transformed.Bounds()
 		currentWidth := currentBounds.Dx()
 		currentHeight := currentBounds.Dy()
@@ -178,6 +291,16 @@ func TransformImage(input io.Reader, options TransformationOptions) ([]byte, err
 		fmt.Printf("Final dimensions after crop: %dx%d\n", finalBounds.Dx(), finalBounds.Dy())
 	}
 
+	// Filter after resizing so blurs scale with the output and run on fewer pixels
+	if options.HasFilters() {
+		transformed = ApplyFilters(transformed, options)
+	}
+
+	// Watermark last so it keeps its size and position regardless of resizing and cropping
+	if options.WatermarkImage != nil {
+		transformed = ApplyWatermark(transformed, options.WatermarkImage, options.WatermarkPosition, options.WatermarkOpacity, options.WatermarkScale)
+	}
+
 	// Encode the transformed image
 	var buf bytes.Buffer
 	outputFormat := options.Format
@@ -209,37 +332,31 @@ func TransformImage(input io.Reader, options TransformationOptions) ([]byte, err
 		return nil, fmt.Errorf("failed to encode transformed image: %v", err)
 	}
 
-	finalSize := buf.Len()
+	// Encoders write no metadata; carry the original's over unless it is stripped. The
+	// profile goes along whatever the output format, unless the pixels are now sRGB.
+	output := buf.Bytes()
+	if !options.StripsMetadata() {
+		if profile != nil && !toSRGB {
+			output = EmbedICCProfile(output, profile.Data)
+		}
+		output = copyMetadata(originalBytes, output)
+	}
+
+	finalSize := len(output)
 	fmt.Printf("Final image size: %d bytes\n", finalSize)
 
-	return buf.Bytes(), nil
+	return output, nil
 }
 
-// ApplyPreset applies a predefined transformation preset
+// ApplyPreset applies a transformation preset of TRANSFORM_PRESETS
 func ApplyPreset(options *TransformationOptions, preset string) error {
-	switch preset {
-	case "thumbnail":
-		options.Width = 150
-		options.Height = 150
-		options.Fit = "cover"
-		options.Quality = 80
-	case "social":
-		options.Width = 1200
-		options.Height = 630
-		options.Fit = "contain"
-		options.Quality = 85
-	case "avatar":
-		options.Width = 300
-		options.Height = 300
-		options.Fit = "cover"
-		options.Quality = 85
-	case "banner":
-		options.Width = 1920
-		options.Height = 400
-		options.Fit = "cover"
-		options.Quality = 90
-	default:
+	values, ok := config.GetConfig().Transform.Presets[strings.ToLower(preset)]
+	if !ok {
 		return fmt.Errorf("unknown preset: %s", preset)
 	}
+	options.Width = values.Width
+	options.Height = values.Height
+	options.Fit = values.Fit
+	options.Quality = values.Quality
 	return nil
 }
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// jpegMetadataSegment reports whether a JPEG segment holds metadata: EXIF and XMP (APP1),
+// an ICC profile (APP2) or IPTC (APP13). JFIF and Adobe segments describe how to decode
+// the image and are kept.
+func jpegMetadataSegment(marker byte, payload []byte) bool {
+	switch marker {
+	case 0xE1:
+		return bytes.HasPrefix(payload, []byte("Exif\x00")) || bytes.HasPrefix(payload, []byte("http://ns.adobe.com/"))
+	case 0xE2:
+		return bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+	case 0xED:
+		return bytes.HasPrefix(payload, []byte("Photoshop 3.0\x00"))
+	}
+	return false
+}
+
+// pngMetadataChunk reports whether a PNG chunk holds metadata: EXIF, an ICC profile, or
+// text, which is also where XMP and some tools' EXIF go
+func pngMetadataChunk(kind string) bool {
+	switch kind {
+	case "eXIf", "iCCP", "tEXt", "zTXt", "iTXt":
+		return true
+	}
+	return false
+}
+
+// splitJPEG splits the header of a JPEG, everything before the image data, into its
+// segments, marker included. ok is false if data is not a well-formed JPEG.
+func splitJPEG(data []byte) (segments [][]byte, rest int, ok bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, 0, false
+	}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA { // Start of scan: the image data follows
+			return segments, pos, true
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, 0, false
+		}
+		segments = append(segments, data[pos:pos+2+length])
+		pos += 2 + length
+	}
+	return nil, 0, false
+}
+
+// splitPNG splits a PNG into its chunks, length and checksum included. ok is false if
+// data is not a well-formed PNG.
+func splitPNG(data []byte) (chunks [][]byte, ok bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, false
+	}
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return nil, false
+		}
+		chunks = append(chunks, data[pos:pos+12+length])
+		pos += 12 + length
+	}
+	return chunks, pos == len(data)
+}
+
+// StripMetadata removes EXIF, ICC profiles, XMP and IPTC from a JPEG or PNG without
+// re-encoding it. Other data is returned as is.
+func StripMetadata(data []byte) []byte {
+	if segments, rest, ok := splitJPEG(data); ok {
+		out := make([]byte, 0, len(data))
+		out = append(out, data[:2]...)
+		for _, segment := range segments {
+			if !jpegMetadataSegment(segment[1], segment[4:]) {
+				out = append(out, segment...)
+			}
+		}
+		return append(out, data[rest:]...)
+	}
+	if chunks, ok := splitPNG(data); ok {
+		out := make([]byte, 0, len(data))
+		out = append(out, pngSignature...)
+		for _, chunk := range chunks {
+			if !pngMetadataChunk(string(chunk[4:8])) {
+				out = append(out, chunk...)
+			}
+		}
+		return out
+	}
+	return data
+}
+
+// copyMetadata adds the EXIF, XMP and IPTC of the original image to an encoded
+// derivative of the same format, which Go's encoders write without. Derivatives in
+// another format are returned as they are. ICC profiles are left to EmbedICCProfile.
+func copyMetadata(original, derivative []byte) []byte {
+	if segments, _, ok := splitJPEG(original); ok {
+		if _, _, ok := splitJPEG(derivative); !ok {
+			return derivative
+		}
+		out := make([]byte, 0, len(derivative))
+		out = append(out, derivative[:2]...)
+		for _, segment := range segments {
+			if jpegMetadataSegment(segment[1], segment[4:]) && segment[1] != 0xE2 {
+				out = append(out, segment...)
+			}
+		}
+		return append(out, derivative[2:]...)
+	}
+	if chunks, ok := splitPNG(original); ok {
+		encoded, ok := splitPNG(derivative)
+		if !ok || len(encoded) == 0 {
+			return derivative
+		}
+		// Metadata goes right after IHDR, before the palette and image data
+		out := make([]byte, 0, len(derivative))
+		out = append(out, pngSignature...)
+		out = append(out, encoded[0]...)
+		for _, chunk := range chunks {
+			if kind := string(chunk[4:8]); pngMetadataChunk(kind) && kind != "iCCP" {
+				out = append(out, chunk...)
+			}
+		}
+		for _, chunk := range encoded[1:] {
+			out = append(out, chunk...)
+		}
+		return out
+	}
+	return derivative
+}
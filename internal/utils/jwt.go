@@ -1,17 +1,85 @@
 package utils
 
 import (
+	"errors"
 	"time"
-	"go-media-center-example/internal/config"
+
 	"github.com/golang-jwt/jwt/v4"
+
+	"go-media-center-example/internal/config"
 )
 
+// ErrInvalidToken is returned for tokens that fail to parse or verify, have expired or
+// carry no user
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// GenerateToken issues a token for a user, valid for JWT_EXPIRATION and signed with
+// JWT_SECRET. The token names its key with a kid header when JWT_KEY_ID is set, and
+// carries the JWT_ISSUER and JWT_AUDIENCE claims when they are.
 func GenerateToken(userID uint, cfg *config.Config) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"iat":     now.Unix(),
+		"exp":     now.Add(cfg.JWT.Expiration).Unix(),
+	}
+	if cfg.JWT.Issuer != "" {
+		claims["iss"] = cfg.JWT.Issuer
+	}
+	if cfg.JWT.Audience != "" {
+		claims["aud"] = cfg.JWT.Audience
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if cfg.JWT.KeyID != "" {
+		token.Header["kid"] = cfg.JWT.KeyID
+	}
 	return token.SignedString([]byte(cfg.JWT.Secret))
-}
\ No newline at end of file
+}
+
+// VerifyToken checks a token's signature against the key its kid header names, or every
+// verification key when it has none, then its claims, allowing JWT_CLOCK_SKEW of drift
+// between hosts. It returns the user the token was issued to.
+func VerifyToken(tokenString string, cfg *config.Config) (uint, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation())
+
+	var claims jwt.MapClaims
+	verified := false
+	unverified, _, err := parser.ParseUnverified(tokenString, jwt.MapClaims{})
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	kid, _ := unverified.Header["kid"].(string)
+	for _, secret := range cfg.JWT.VerificationKeys(kid) {
+		claims = jwt.MapClaims{}
+		token, err := parser.ParseWithClaims(tokenString, claims, func(*jwt.Token) (interface{}, error) {
+			return []byte(secret), nil
+		})
+		if err == nil && token.Valid {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return 0, ErrInvalidToken
+	}
+
+	now, skew := time.Now(), cfg.JWT.ClockSkew
+	if !claims.VerifyExpiresAt(now.Add(-skew).Unix(), true) ||
+		!claims.VerifyNotBefore(now.Add(skew).Unix(), false) ||
+		!claims.VerifyIssuedAt(now.Add(skew).Unix(), false) {
+		return 0, ErrInvalidToken
+	}
+	if cfg.JWT.Issuer != "" && !claims.VerifyIssuer(cfg.JWT.Issuer, true) {
+		return 0, ErrInvalidToken
+	}
+	if cfg.JWT.Audience != "" && !claims.VerifyAudience(cfg.JWT.Audience, true) {
+		return 0, ErrInvalidToken
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	return uint(userID), nil
+}
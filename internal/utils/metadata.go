@@ -1,12 +1,14 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -16,6 +18,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"go-media-center-example/internal/config"
 )
 
 // MediaMetadata holds technical details about media files
@@ -27,12 +31,18 @@ type MediaMetadata struct {
 	UploadedAt string      `json:"uploaded_at"`
 	Dimensions *Dimensions `json:"dimensions,omitempty"`
 	Format     string      `json:"format"`
+	SHA256     string      `json:"sha256,omitempty"` // Set for streamed URL uploads
 
 	// Image specific metadata
 	ColorSpace  string `json:"color_space,omitempty"`
 	ColorDepth  int    `json:"color_depth,omitempty"`
 	HasAlpha    bool   `json:"has_alpha,omitempty"`
 	Orientation string `json:"orientation,omitempty"`
+	// ContentClass is photo, screenshot, scan or graphic
+	ContentClass string `json:"content_class,omitempty"`
+	// Colors holds the palette, average color and placeholder of decodable images, and
+	// of the poster frame of videos
+	Colors *ImageColors `json:"colors,omitempty"`
 
 	// Video specific metadata
 	Duration    string `json:"duration,omitempty"`
@@ -49,8 +59,9 @@ type Dimensions struct {
 	Height int `json:"height"`
 }
 
-// ExtractMetadata extracts metadata from a media file
-func ExtractMetadata(file *multipart.FileHeader) (*MediaMetadata, error) {
+// ExtractMetadata extracts metadata from a media file. Videos are probed by ffprobe and
+// ffmpeg, which are stopped when ctx is done or they take longer than the probe timeout.
+func ExtractMetadata(ctx context.Context, file *multipart.FileHeader) (*MediaMetadata, error) {
 	f, err := file.Open()
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %v", err)
@@ -65,7 +76,9 @@ func ExtractMetadata(file *multipart.FileHeader) (*MediaMetadata, error) {
 	}
 
 	// Reset file pointer
-	f.Seek(0, 0)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind file: %v", err)
+	}
 
 	contentType := GetMimeType(buffer)
 	metadata := &MediaMetadata{
@@ -83,7 +96,7 @@ func ExtractMetadata(file *multipart.FileHeader) (*MediaMetadata, error) {
 			return nil, fmt.Errorf("failed to extract image metadata: %v", err)
 		}
 	case strings.HasPrefix(contentType, "video/"):
-		if err := extractVideoMetadata(f, metadata); err != nil {
+		if err := extractVideoMetadata(ctx, f, metadata); err != nil {
 			return nil, fmt.Errorf("failed to extract video metadata: %v", err)
 		}
 	}
@@ -93,6 +106,12 @@ func ExtractMetadata(file *multipart.FileHeader) (*MediaMetadata, error) {
 
 // extractImageMetadata extracts metadata specific to images
 func extractImageMetadata(f multipart.File, metadata *MediaMetadata) error {
+	// EXIF has to be read from the raw bytes before decoding
+	camera := hasCameraEXIF(f)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind image: %v", err)
+	}
+
 	// Decode image for dimensions and color info
 	img, format, err := image.Decode(f)
 	if err != nil {
@@ -129,11 +148,14 @@ func extractImageMetadata(f multipart.File, metadata *MediaMetadata) error {
 		metadata.HasAlpha = true
 	}
 
+	metadata.ContentClass = ContentClassifier(ClassifierInput{Image: img, Format: format, Camera: camera})
+	metadata.Colors = ExtractColors(img)
+
 	return nil
 }
 
 // extractVideoMetadata extracts metadata specific to videos using ffprobe
-func extractVideoMetadata(f multipart.File, metadata *MediaMetadata) error {
+func extractVideoMetadata(ctx context.Context, f multipart.File, metadata *MediaMetadata) error {
 	// Create a temporary file for FFmpeg to process
 	tempFile, err := SaveTempFile(f)
 	if err != nil {
@@ -141,8 +163,14 @@ func extractVideoMetadata(f multipart.File, metadata *MediaMetadata) error {
 	}
 	defer os.Remove(tempFile)
 
+	if timeout := config.GetConfig().Storage.ProbeTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
 	// Use ffprobe to get video metadata
-	cmd := exec.Command("ffprobe",
+	cmd := exec.CommandContext(ctx, "ffprobe",
 		"-v", "quiet",
 		"-print_format", "json",
 		"-show_format",
@@ -203,9 +231,33 @@ func extractVideoMetadata(f multipart.File, metadata *MediaMetadata) error {
 	metadata.Duration = result.Format.Duration
 	metadata.Bitrate = result.Format.BitRate
 
+	// Placeholders of videos show their poster frame; videos without one just go without
+	if metadata.VideoCodec != "" {
+		if poster, err := extractVideoPoster(ctx, tempFile); err == nil {
+			metadata.Colors = ExtractColors(poster)
+		}
+	}
+
 	return nil
 }
 
+// extractVideoPoster decodes a representative frame from the start of a video
+func extractVideoPoster(ctx context.Context, path string) (image.Image, error) {
+	// The thumbnail filter picks the most typical of the first 100 frames, skipping
+	// black or faded opening frames
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "error", "-i", path,
+		"-vf", "thumbnail", "-frames:v", "1", "-f", "image2pipe", "-c:v", "png", "pipe:1")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract video poster: %v", err)
+	}
+	poster, err := png.Decode(bytes.NewReader(output))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode video poster: %v", err)
+	}
+	return poster, nil
+}
+
 // SaveTempFile saves a multipart.File to a temporary file
 func SaveTempFile(f multipart.File) (string, error) {
 	tempFile, err := os.CreateTemp("", "media-*")
@@ -261,6 +313,16 @@ func DetectMimeType(resp *http.Response, file io.ReadSeeker, filename string) st
 		".mov":  "video/quicktime",
 		".avi":  "video/x-msvideo",
 		".pdf":  "application/pdf",
+		".doc":  "application/msword",
+		".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		".xls":  "application/vnd.ms-excel",
+		".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		".ppt":  "application/vnd.ms-powerpoint",
+		".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+		".odt":  "application/vnd.oasis.opendocument.text",
+		".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+		".odp":  "application/vnd.oasis.opendocument.presentation",
+		".rtf":  "application/rtf",
 		".txt":  "text/plain",
 	}
 
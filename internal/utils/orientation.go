@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// HasOrientation reports whether a rotation or flip was requested
+func (t *TransformationOptions) HasOrientation() bool {
+	return t.normalizedRotation() != 0 || t.Flip != ""
+}
+
+// validateOrientation checks the rotate and flip options
+func (t *TransformationOptions) validateOrientation() error {
+	if t.Rotate < -360 || t.Rotate > 360 {
+		return optionError("rotate", "rotate must be between -360 and 360 degrees")
+	}
+	switch t.Flip {
+	case "", "h", "v", "hv":
+	default:
+		return optionError("flip", "invalid flip: %s (expected h, v or hv)", t.Flip)
+	}
+	return nil
+}
+
+// normalizedRotation returns the clockwise rotation in the range [0, 360)
+func (t *TransformationOptions) normalizedRotation() float64 {
+	return math.Mod(math.Mod(t.Rotate, 360)+360, 360)
+}
+
+// ApplyOrientation flips and then rotates img clockwise. Right angles are lossless;
+// other angles enlarge the canvas and fill the corners with transparency.
+func ApplyOrientation(img *image.NRGBA, options TransformationOptions) *image.NRGBA {
+	switch options.Flip {
+	case "h":
+		img = imaging.FlipH(img)
+	case "v":
+		img = imaging.FlipV(img)
+	case "hv":
+		img = imaging.Rotate180(img)
+	}
+
+	// imaging rotates counter-clockwise
+	switch angle := options.normalizedRotation(); angle {
+	case 0:
+	case 90:
+		img = imaging.Rotate270(img)
+	case 180:
+		img = imaging.Rotate180(img)
+	case 270:
+		img = imaging.Rotate90(img)
+	default:
+		img = imaging.Rotate(img, 360-angle, color.Transparent)
+	}
+	return img
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// SignParams returns a URL-safe HMAC-SHA256 signature over the given values
+func SignParams(secret string, values ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join(values, "\n")))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyParams checks a signature produced by SignParams in constant time
+func VerifyParams(secret, signature string, values ...string) bool {
+	expected := SignParams(secret, values...)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// HashToken returns the SHA-256 of a bearer token, the form it is stored and looked up in
+// so a leaked database doesn't leak usable tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// smartCropAnalysisSize bounds the longest edge of the image the saliency map is computed on
+	smartCropAnalysisSize = 256
+	// smartCropSteps is the number of candidate positions tried along the free axis
+	smartCropSteps = 32
+	// smartCropCenterBias slightly favours central windows when scores are close
+	smartCropCenterBias = 0.15
+)
+
+// SmartCropRect picks the crop window of the given aspect ratio that covers the most
+// salient part of img. Saliency combines edge energy, which picks up detail such as
+// faces and product outlines, with color saturation, which separates subjects from
+// flat backgrounds. The returned rectangle is as large as img allows.
+func SmartCropRect(img image.Image, width, height int) image.Rectangle {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if width <= 0 || height <= 0 || srcW == 0 || srcH == 0 {
+		return bounds
+	}
+
+	// Largest window of the target aspect ratio that fits the source
+	cropW, cropH := srcW, srcW*height/width
+	if cropH > srcH {
+		cropW, cropH = srcH*width/height, srcH
+	}
+	if cropW == srcW && cropH == srcH {
+		return bounds
+	}
+
+	// Work on a downscaled copy; saliency does not need full resolution
+	scale := 1.0
+	if longest := max(srcW, srcH); longest > smartCropAnalysisSize {
+		scale = float64(smartCropAnalysisSize) / float64(longest)
+	}
+	small := imaging.Resize(img, max(1, int(float64(srcW)*scale)), max(1, int(float64(srcH)*scale)), imaging.Box)
+	integral, w, h := saliencyIntegral(small)
+
+	winW := max(1, min(w, int(math.Round(float64(cropW)*scale))))
+	winH := max(1, min(h, int(math.Round(float64(cropH)*scale))))
+
+	// Only one axis has slack, so scan candidate offsets along it starting from the
+	// centered window, which also wins on featureless images
+	slackX, slackY := w-winW, h-winH
+	bestX, bestY := slackX/2, slackY/2
+	bestScore := windowSum(integral, w, bestX, bestY, winW, winH)
+	for step := 0; step <= smartCropSteps; step++ {
+		x := slackX * step / smartCropSteps
+		y := slackY * step / smartCropSteps
+		score := windowSum(integral, w, x, y, winW, winH)
+
+		// Penalise distance from the center to avoid drifting to busy edges
+		offset := 0.0
+		if slackX > 0 {
+			offset = math.Abs(float64(x)/float64(slackX) - 0.5)
+		} else if slackY > 0 {
+			offset = math.Abs(float64(y)/float64(slackY) - 0.5)
+		}
+		score *= 1 - smartCropCenterBias*offset
+
+		if score > bestScore {
+			bestX, bestY, bestScore = x, y, score
+		}
+	}
+
+	// Map the winning window back to source coordinates
+	x0 := min(srcW-cropW, int(math.Round(float64(bestX)/scale)))
+	y0 := min(srcH-cropH, int(math.Round(float64(bestY)/scale)))
+	return image.Rect(x0, y0, x0+cropW, y0+cropH).Add(bounds.Min)
+}
+
+// saliencyIntegral computes a summed-area table of per-pixel saliency for img
+func saliencyIntegral(img *image.NRGBA) ([]float64, int, int) {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+
+	luma := make([]float64, w*h)
+	sat := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := y*img.Stride + x*4
+			r, g, b := float64(img.Pix[i]), float64(img.Pix[i+1]), float64(img.Pix[i+2])
+			luma[y*w+x] = 0.299*r + 0.587*g + 0.114*b
+			hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+			if hi > 0 {
+				sat[y*w+x] = (hi - lo) / hi
+			}
+		}
+	}
+
+	// integral has a zero row and column so window sums need no bounds checks
+	integral := make([]float64, (w+1)*(h+1))
+	for y := 0; y < h; y++ {
+		rowSum := 0.0
+		for x := 0; x < w; x++ {
+			dx := luma[y*w+min(x+1, w-1)] - luma[y*w+max(x-1, 0)]
+			dy := luma[min(y+1, h-1)*w+x] - luma[max(y-1, 0)*w+x]
+			edge := math.Sqrt(dx*dx + dy*dy)
+
+			rowSum += edge + 64*sat[y*w+x]
+			integral[(y+1)*(w+1)+x+1] = integral[y*(w+1)+x+1] + rowSum
+		}
+	}
+	return integral, w, h
+}
+
+// windowSum returns the total saliency inside a window using the summed-area table
+func windowSum(integral []float64, w, x, y, winW, winH int) float64 {
+	stride := w + 1
+	return integral[(y+winH)*stride+x+winW] - integral[y*stride+x+winW] -
+		integral[(y+winH)*stride+x] + integral[y*stride+x]
+}
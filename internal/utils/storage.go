@@ -93,6 +93,8 @@ func GetFileType(filename string) string {
 		return "image"
 	case ".mp4", ".mov", ".avi":
 		return "video"
+	case ".pdf", ".doc", ".docx", ".odt", ".rtf", ".xls", ".xlsx", ".ods", ".ppt", ".pptx", ".odp":
+		return "document"
 	default:
 		return "other"
 	}
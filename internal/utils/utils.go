@@ -15,3 +15,15 @@ func ParseIntOption(value string) int {
 	}
 	return num
 }
+
+// ParseFloatOption parses a string value to a float, returning 0 if the string is empty or invalid
+func ParseFloatOption(value string) float64 {
+	if value == "" {
+		return 0
+	}
+	num, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return num
+}
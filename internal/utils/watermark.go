@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// DefaultWatermark is the watermark value that selects the configured default watermark
+const DefaultWatermark = "default"
+
+// watermarkMargin is the gap between a corner-positioned watermark and the image edge,
+// relative to the shorter image side
+const watermarkMargin = 0.03
+
+// HasWatermark reports whether a watermark was requested
+func (t *TransformationOptions) HasWatermark() bool {
+	return t.Watermark != ""
+}
+
+// ValidateWatermark checks the watermark options
+func (t *TransformationOptions) ValidateWatermark() error {
+	if t.HasWatermark() && t.IsVideoFormat() {
+		return optionError("watermark", "watermarks are not supported for %s output", t.Format)
+	}
+	switch t.WatermarkPosition {
+	case "", "center", "top-left", "top-right", "bottom-left", "bottom-right":
+	default:
+		return optionError("watermark_position", "invalid watermark position: %s (expected center, top-left, top-right, bottom-left or bottom-right)", t.WatermarkPosition)
+	}
+	if t.WatermarkOpacity < 0 || t.WatermarkOpacity > 1 {
+		return optionError("watermark_opacity", "watermark opacity must be between 0 and 1")
+	}
+	if t.WatermarkScale < 0 || t.WatermarkScale > 1 {
+		return optionError("watermark_scale", "watermark scale must be between 0 and 1")
+	}
+	return nil
+}
+
+// ApplyWatermark overlays mark onto img, scaled to a fraction of the image width
+func ApplyWatermark(img *image.NRGBA, mark image.Image, position string, opacity, scale float64) *image.NRGBA {
+	bounds := img.Bounds()
+	markWidth := int(float64(bounds.Dx()) * scale)
+	if markWidth < 1 {
+		return img
+	}
+	resized := imaging.Resize(mark, markWidth, 0, imaging.Lanczos)
+
+	margin := int(float64(min(bounds.Dx(), bounds.Dy())) * watermarkMargin)
+	right := bounds.Dx() - resized.Bounds().Dx() - margin
+	bottom := bounds.Dy() - resized.Bounds().Dy() - margin
+
+	var pos image.Point
+	switch position {
+	case "center":
+		pos = image.Pt((bounds.Dx()-resized.Bounds().Dx())/2, (bounds.Dy()-resized.Bounds().Dy())/2)
+	case "top-left":
+		pos = image.Pt(margin, margin)
+	case "top-right":
+		pos = image.Pt(right, margin)
+	case "bottom-left":
+		pos = image.Pt(margin, bottom)
+	default: // "bottom-right"
+		pos = image.Pt(right, bottom)
+	}
+
+	return imaging.Overlay(img, resized, pos, opacity)
+}
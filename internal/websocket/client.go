@@ -0,0 +1,59 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// pongWait is how long a connection may stay silent before it is considered gone
+	pongWait = 60 * time.Second
+	// pingInterval must be shorter than pongWait so a live client always answers in time
+	pingInterval = pongWait / 2
+	// maxMessageSize bounds what a client may send; it only ever sends its auth message
+	maxMessageSize = 4096
+)
+
+// Serve registers an authenticated client and keeps its connection alive with pings until
+// it disconnects or stops answering, then unregisters and closes it. It blocks for the
+// life of the connection.
+func (m *Manager) Serve(client *Client) {
+	conn := client.Conn
+	m.RegisterClient(client)
+	defer func() {
+		m.UnregisterClient(client)
+		conn.Close()
+	}()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	// Reading processes pongs and close frames; anything else the client sends is ignored
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)) != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
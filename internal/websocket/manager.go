@@ -3,10 +3,14 @@ package websocket
 import (
 	"encoding/json"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// writeTimeout bounds a notification write, so a stalled client can't hold up an upload
+const writeTimeout = 10 * time.Second
+
 // NotificationType represents the type of notification
 type NotificationType string
 
@@ -16,6 +20,17 @@ const (
 	ProcessError     NotificationType = "process_error"
 	UploadComplete   NotificationType = "upload_complete"
 	ProcessingStatus NotificationType = "processing_status"
+	Connected        NotificationType = "connected"
+)
+
+// Library change events keep a user's open clients in sync without polling
+const (
+	MediaCreated  NotificationType = "media.created"
+	MediaUpdated  NotificationType = "media.updated"
+	MediaDeleted  NotificationType = "media.deleted"
+	FolderCreated NotificationType = "folder.created"
+	FolderUpdated NotificationType = "folder.updated"
+	FolderDeleted NotificationType = "folder.deleted"
 )
 
 // Notification represents a WebSocket notification
@@ -32,6 +47,8 @@ type Notification struct {
 type Client struct {
 	UserID uint
 	Conn   *websocket.Conn
+
+	writeMu sync.Mutex // Connections support one concurrent writer
 }
 
 // Manager handles WebSocket connections and notifications
@@ -99,10 +116,10 @@ func (m *Manager) UnregisterClient(client *Client) {
 // SendNotification sends a notification to a specific user
 func (m *Manager) SendNotification(userID uint, notification *Notification) error {
 	m.mu.RLock()
-	clients, ok := m.clients[userID]
+	clients := append([]*Client(nil), m.clients[userID]...)
 	m.mu.RUnlock()
 
-	if !ok {
+	if len(clients) == 0 {
 		return nil // No clients connected for this user
 	}
 
@@ -112,7 +129,7 @@ func (m *Manager) SendNotification(userID uint, notification *Notification) erro
 	}
 
 	for _, client := range clients {
-		if err := client.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		if err := client.write(data); err != nil {
 			// Handle error but continue sending to other clients
 			continue
 		}
@@ -121,13 +138,30 @@ func (m *Manager) SendNotification(userID uint, notification *Notification) erro
 	return nil
 }
 
-// SendUploadProgress sends an upload progress notification
-func (m *Manager) SendUploadProgress(userID uint, mediaID string, progress int) {
+// HasClients reports whether a user has any connection to notify
+func (m *Manager) HasClients(userID uint) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.clients[userID]) > 0
+}
+
+// write sends one text message, serialized with the client's other writes
+func (c *Client) write(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.Conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// SendUploadProgress sends an upload progress notification. The media ID is empty while
+// the file is being stored, so data identifies the file.
+func (m *Manager) SendUploadProgress(userID uint, mediaID string, progress int, data map[string]interface{}) {
 	notification := &Notification{
 		Type:     UploadProgress,
 		UserID:   userID,
 		MediaID:  mediaID,
 		Progress: progress,
+		Data:     data,
 	}
 	m.SendNotification(userID, notification)
 }
@@ -164,3 +198,14 @@ func (m *Manager) SendProcessError(userID uint, mediaID string, errorMsg string)
 	}
 	m.SendNotification(userID, notification)
 }
+
+// SendLibraryEvent sends a media or folder change to every connection of the owner
+func (m *Manager) SendLibraryEvent(userID uint, eventType NotificationType, mediaID string, data map[string]interface{}) {
+	notification := &Notification{
+		Type:    eventType,
+		UserID:  userID,
+		MediaID: mediaID,
+		Data:    data,
+	}
+	m.SendNotification(userID, notification)
+}
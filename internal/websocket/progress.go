@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"io"
+	"time"
+)
+
+// progressInterval is the least time between two progress notifications of one file
+const progressInterval = 250 * time.Millisecond
+
+// progressReader reports how much of a file has been read as upload progress
+type progressReader struct {
+	reader   io.Reader
+	manager  *Manager
+	userID   uint
+	filename string
+	total    int64 // Unknown when not positive
+
+	read         int64
+	lastPercent  int
+	lastReported time.Time
+}
+
+// TrackUpload wraps the reader of a file being stored so the uploading user's clients get
+// upload_progress notifications carrying the filename, the bytes read so far and, when
+// total is known, the percentage. Without a connected client the reader is returned as is.
+func (m *Manager) TrackUpload(userID uint, filename string, reader io.Reader, total int64) io.Reader {
+	if !m.HasClients(userID) {
+		return reader
+	}
+	return &progressReader{
+		reader:      reader,
+		manager:     m,
+		userID:      userID,
+		filename:    filename,
+		total:       total,
+		lastPercent: -1,
+	}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	percent := -1
+	if r.total > 0 {
+		percent = int(r.read * 100 / r.total)
+		if percent > 100 {
+			percent = 100
+		}
+	}
+
+	done := err == io.EOF || percent == 100
+	if (done || time.Since(r.lastReported) >= progressInterval) && (percent != r.lastPercent || percent < 0) {
+		r.report(percent)
+	}
+	return n, err
+}
+
+// report sends the progress so far; percent is negative when the total is unknown
+func (r *progressReader) report(percent int) {
+	r.lastPercent = percent
+	r.lastReported = time.Now()
+
+	data := map[string]interface{}{
+		"filename": r.filename,
+		"bytes":    r.read,
+	}
+	if r.total > 0 {
+		data["total"] = r.total
+	}
+	if percent < 0 {
+		percent = 0
+	}
+	r.manager.SendUploadProgress(r.userID, "", percent, data)
+}
@@ -0,0 +1,27 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// Usage returns the bytes the current user stores against their quota
+func (c *Client) Usage(ctx context.Context) (*StorageUsage, error) {
+	var usage StorageUsage
+	if err := c.do(ctx, http.MethodGet, "/account/usage", nil, nil, &usage); err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// SetUserQuota overrides the storage quota of a user in bytes, 0 for unlimited; nil
+// restores the configured default. It requires an admin token.
+func (c *Client) SetUserQuota(ctx context.Context, userID uint, quota *int64) (*UserQuota, error) {
+	in := map[string]interface{}{"quota": quota}
+	var result UserQuota
+	if err := c.do(ctx, http.MethodPut, "/admin/users/"+strconv.FormatUint(uint64(userID), 10)+"/quota", nil, in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,200 @@
+// Package client is a typed Go client for the Media Center API.
+//
+//	c := client.New("http://localhost:8080")
+//	if _, err := c.Login(ctx, "demo", "secret"); err != nil {
+//		return err
+//	}
+//	result, err := c.UploadFile(ctx, "photo.jpg", file, client.UploadOptions{Tags: []string{"travel"}})
+//
+//	for media, err := range c.AllMedia(ctx, client.ListMediaOptions{FolderID: "3"}) {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(media.ID, media.Filename)
+//	}
+//
+// Requests that are safe to repeat are retried after network errors and overload
+// responses; see RetryPolicy. The client depends only on the standard library so it can
+// be vendored into integrations.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiPrefix is the path of the versioned API below the base URL
+const apiPrefix = "/api/v1"
+
+// Client calls the Media Center API. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retry      RetryPolicy
+
+	mu    sync.RWMutex
+	token string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken authenticates requests with an existing JWT
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. to set timeouts or a transport
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// New creates a client for the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetToken replaces the JWT sent with requests
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+// Token returns the JWT sent with requests
+func (c *Client) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// APIError is returned for responses with a 4xx or 5xx status
+type APIError struct {
+	StatusCode int
+	Message    string       `json:"error"`
+	Code       string       `json:"code,omitempty"` // Machine-readable error code, such as not_found
+	Details    string       `json:"details,omitempty"`
+	Fields     []FieldError `json:"fields,omitempty"`     // Invalid fields of a validation_failed error
+	RequestID  string       `json:"request_id,omitempty"` // Matches the X-Request-ID response header
+
+	retryAfter time.Duration
+}
+
+// FieldError is one invalid field of a rejected request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("media center: %d %s: %s", e.StatusCode, e.Message, e.Details)
+	}
+	return fmt.Sprintf("media center: %d %s", e.StatusCode, e.Message)
+}
+
+// errStopIteration ends the Each iteration behind an All iterator whose loop stopped
+var errStopIteration = errors.New("iteration stopped")
+
+// newRequest builds a request for path below the API prefix
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := c.baseURL + apiPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// send performs req and returns the response, turning error statuses into APIError
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		apiErr := &APIError{StatusCode: resp.StatusCode, retryAfter: parseRetryAfter(resp.Header)}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+			if apiErr.Message == "" {
+				apiErr.Message = http.StatusText(resp.StatusCode)
+			}
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do sends a JSON request and decodes the JSON response into out, if given. POST
+// requests are not retried; see doIdempotent.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	return c.doJSON(ctx, method, path, query, in, out, method != http.MethodPost)
+}
+
+// doIdempotent is do for POST requests that are safe to repeat, such as completing a
+// direct upload
+func (c *Client) doIdempotent(ctx context.Context, path string, in, out interface{}) error {
+	return c.doJSON(ctx, http.MethodPost, path, nil, in, out, true)
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, query url.Values, in, out interface{}, retry bool) error {
+	var data []byte
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.sendWithRetry(ctx, retry, func(int) (*http.Request, error) {
+		var body io.Reader
+		if in != nil {
+			body = bytes.NewReader(data)
+		}
+		req, err := c.newRequest(ctx, method, path, query, body)
+		if err != nil {
+			return nil, err
+		}
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
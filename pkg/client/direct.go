@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// PresignUpload starts a direct upload of size bytes, which the client stores straight in
+// storage. Small files get an UploadToken and Upload, to send with SendPresigned and
+// finish with CompleteUpload. Files above the server's multipart threshold get a Session
+// instead, whose parts are presigned with PresignUploadParts. A server without direct
+// upload storage answers with an APIError of status 501.
+func (c *Client) PresignUpload(ctx context.Context, filename string, size int64, contentType string, opts UploadOptions) (*DirectUpload, error) {
+	in := map[string]interface{}{
+		"filename":     filename,
+		"size":         size,
+		"content_type": contentType,
+		"folder_id":    opts.FolderID,
+		"tags":         opts.Tags,
+		"conflict":     opts.Conflict,
+	}
+	var result DirectUpload
+	if err := c.do(ctx, http.MethodPost, "/media/uploads/presign", nil, in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CompleteUpload creates the media item of a file stored with a presigned upload
+func (c *Client) CompleteUpload(ctx context.Context, uploadToken string) (*MediaResult, error) {
+	var result MediaResult
+	in := map[string]string{"upload_token": uploadToken}
+	if err := c.doIdempotent(ctx, "/media/uploads/complete", in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetUploadSession returns the state of a multipart upload
+func (c *Client) GetUploadSession(ctx context.Context, id string) (*UploadSession, error) {
+	var result struct {
+		Session UploadSession `json:"session"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/media/uploads/"+url.PathEscape(id), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result.Session, nil
+}
+
+// PresignUploadParts returns presigned requests for up to 100 parts of a multipart
+// upload, numbered from 1
+func (c *Client) PresignUploadParts(ctx context.Context, id string, partNumbers []int32) ([]UploadPart, error) {
+	var result struct {
+		Parts []UploadPart `json:"parts"`
+	}
+	in := map[string]interface{}{"part_numbers": partNumbers}
+	if err := c.doIdempotent(ctx, "/media/uploads/"+url.PathEscape(id)+"/parts", in, &result); err != nil {
+		return nil, err
+	}
+	return result.Parts, nil
+}
+
+// CompleteMultipartUpload joins the stored parts of a multipart upload, which must list
+// every part once, and creates its media item
+func (c *Client) CompleteMultipartUpload(ctx context.Context, id string, parts []CompletedPart) (*MediaResult, error) {
+	var result MediaResult
+	in := map[string]interface{}{"parts": parts}
+	if err := c.doIdempotent(ctx, "/media/uploads/"+url.PathEscape(id)+"/complete", in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AbortUploadSession discards a multipart upload and its stored parts
+func (c *Client) AbortUploadSession(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/media/uploads/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// SendPresigned stores size bytes of body with a presigned request and returns the ETag
+// storage answered with, which CompleteMultipartUpload needs for every part. It is
+// retried when body is an io.ReaderAt that can seek, like an *os.File or a part of one
+// from io.NewSectionReader.
+func (c *Client) SendPresigned(ctx context.Context, upload PresignedUpload, body io.Reader, size int64) (string, error) {
+	// Every attempt reads its own section, so an attempt still being cleaned up cannot
+	// disturb the next one
+	newBody := func() io.Reader { return body }
+	retry := false
+	readerAt, ok := body.(io.ReaderAt)
+	if seeker, isSeeker := body.(io.Seeker); ok && isSeeker {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			newBody = func() io.Reader { return io.NewSectionReader(readerAt, offset, size) }
+			retry = true
+		}
+	}
+
+	resp, err := c.sendWithRetry(ctx, retry, func(int) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, upload.Method, upload.URL, io.NopCloser(newBody()))
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range upload.Headers {
+			if strings.EqualFold(name, "Content-Length") {
+				continue
+			}
+			req.Header.Set(name, value)
+		}
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+		return req, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.Header.Get("ETag"), nil
+}
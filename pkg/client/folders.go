@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// FolderInput is the body of CreateFolder and UpdateFolder
+type FolderInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ParentID    *uint  `json:"parent_id,omitempty"`
+}
+
+// CreateFolder creates a folder
+func (c *Client) CreateFolder(ctx context.Context, input FolderInput) (*Folder, error) {
+	var folder Folder
+	if err := c.do(ctx, http.MethodPost, "/folders", nil, input, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// ListFoldersOptions filters and pages ListFolders
+type ListFoldersOptions struct {
+	Page     int // Starts at 1
+	Limit    int
+	Search   string
+	ParentID string
+}
+
+// ListFolders returns one page of folders
+func (c *Client) ListFolders(ctx context.Context, opts ListFoldersOptions) (*FolderPage, error) {
+	query := url.Values{}
+	setInt(query, "page", opts.Page)
+	setInt(query, "limit", opts.Limit)
+	setString(query, "search", opts.Search)
+	setString(query, "parent_id", opts.ParentID)
+
+	var page FolderPage
+	if err := c.do(ctx, http.MethodGet, "/folders", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// EachFolder calls fn for every folder matching opts, fetching pages as needed.
+// Returning an error from fn stops the iteration.
+func (c *Client) EachFolder(ctx context.Context, opts ListFoldersOptions, fn func(Folder) error) error {
+	opts.Page = max(opts.Page, 1)
+	for {
+		page, err := c.ListFolders(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, folder := range page.Folders {
+			if err := fn(folder); err != nil {
+				return err
+			}
+		}
+		if len(page.Folders) == 0 || int64(opts.Page) >= page.Pagination.TotalPages {
+			return nil
+		}
+		opts.Page++
+	}
+}
+
+// AllFolders iterates over every folder matching opts, fetching pages as needed. An
+// error ends the iteration after being yielded with a zero Folder.
+func (c *Client) AllFolders(ctx context.Context, opts ListFoldersOptions) iter.Seq2[Folder, error] {
+	return func(yield func(Folder, error) bool) {
+		err := c.EachFolder(ctx, opts, func(folder Folder) error {
+			if !yield(folder, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && err != errStopIteration {
+			yield(Folder{}, err)
+		}
+	}
+}
+
+// GetFolder returns a folder with its media count
+func (c *Client) GetFolder(ctx context.Context, id uint) (*Folder, error) {
+	var folder Folder
+	if err := c.do(ctx, http.MethodGet, "/folders/"+strconv.FormatUint(uint64(id), 10), nil, nil, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// UpdateFolder changes a folder's name, description or parent
+func (c *Client) UpdateFolder(ctx context.Context, id uint, input FolderInput) (*Folder, error) {
+	var folder Folder
+	if err := c.do(ctx, http.MethodPut, "/folders/"+strconv.FormatUint(uint64(id), 10), nil, input, &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// DeleteFolder deletes a folder
+func (c *Client) DeleteFolder(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, "/folders/"+strconv.FormatUint(uint64(id), 10), nil, nil, nil)
+}
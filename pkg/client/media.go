@@ -0,0 +1,516 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"iter"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Name conflict policies for uploads and URL imports
+const (
+	ConflictRename  = "rename"
+	ConflictSkip    = "skip"
+	ConflictReplace = "replace"
+)
+
+// Register creates an account and authenticates the client with the returned token
+func (c *Client) Register(ctx context.Context, username, password, email string) (*AuthResult, error) {
+	var result AuthResult
+	in := map[string]string{"username": username, "password": password, "email": email}
+	if err := c.do(ctx, http.MethodPost, "/auth/register", nil, in, &result); err != nil {
+		return nil, err
+	}
+	c.SetToken(result.Token)
+	return &result, nil
+}
+
+// Login authenticates the client with the returned token
+func (c *Client) Login(ctx context.Context, username, password string) (*AuthResult, error) {
+	var result AuthResult
+	in := map[string]string{"username": username, "password": password}
+	if err := c.doIdempotent(ctx, "/auth/login", in, &result); err != nil {
+		return nil, err
+	}
+	c.SetToken(result.Token)
+	return &result, nil
+}
+
+// UploadOptions are the optional fields of an upload
+type UploadOptions struct {
+	FolderID string
+	Tags     []string
+	Conflict string // ConflictRename (default), ConflictSkip or ConflictReplace
+}
+
+// UploadFile uploads one file. The body is streamed, so large files are never held in
+// memory. Failed uploads are retried when r can seek, like an *os.File; a retry after a
+// lost response may store the file twice under ConflictRename.
+func (c *Client) UploadFile(ctx context.Context, filename string, r io.Reader, opts UploadOptions) (*MediaResult, error) {
+	var result MediaResult
+	err := c.upload(ctx, "/media/upload", opts, nil, func(w *multipart.Writer) error {
+		return copyFormFile(w, "file", filename, r)
+	}, rewinder(r), &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// UploadItem is one file of UploadFiles with optional per-file overrides
+type UploadItem struct {
+	Filename string
+	Reader   io.Reader
+	FolderID string                 // Overrides UploadOptions.FolderID
+	Tags     []string               // Added to UploadOptions.Tags
+	Metadata map[string]interface{} // Merged into the stored metadata
+}
+
+// UploadFiles uploads several files in one request and reports a result per file. It is
+// retried like UploadFile when every reader can seek.
+func (c *Client) UploadFiles(ctx context.Context, items []UploadItem, opts UploadOptions) (*BulkResult, error) {
+	overrides := map[string]interface{}{}
+	for _, item := range items {
+		if item.FolderID != "" || len(item.Tags) > 0 || len(item.Metadata) > 0 {
+			overrides[item.Filename] = map[string]interface{}{
+				"folder_id": item.FolderID,
+				"tags":      item.Tags,
+				"metadata":  item.Metadata,
+			}
+		}
+	}
+	fields := map[string]string{}
+	if len(overrides) > 0 {
+		data, err := json.Marshal(overrides)
+		if err != nil {
+			return nil, err
+		}
+		fields["file_metadata"] = string(data)
+	}
+
+	rewinds := make([]func() error, 0, len(items))
+	for _, item := range items {
+		if rewind := rewinder(item.Reader); rewind != nil {
+			rewinds = append(rewinds, rewind)
+		}
+	}
+	var rewind func() error
+	if len(rewinds) == len(items) {
+		rewind = func() error {
+			for _, rewind := range rewinds {
+				if err := rewind(); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	var result BulkResult
+	err := c.upload(ctx, "/media/batch", opts, fields, func(w *multipart.Writer) error {
+		for _, item := range items {
+			if err := copyFormFile(w, "files", item.Filename, item.Reader); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, rewind, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// upload streams a multipart request through a pipe and decodes the JSON response.
+// Failed attempts are retried when rewind is given, which must reset the files
+// writeFiles reads.
+func (c *Client) upload(ctx context.Context, path string, opts UploadOptions, fields map[string]string, writeFiles func(*multipart.Writer) error, rewind func() error, out interface{}) error {
+	var pr *io.PipeReader
+	var written chan struct{}
+	// stop ends the writer of the last attempt, which has to be done with the files
+	// before they are rewound
+	stop := func() {
+		if pr != nil {
+			pr.CloseWithError(errUploadStopped)
+			<-written
+		}
+	}
+	defer stop()
+
+	resp, err := c.sendWithRetry(ctx, rewind != nil, func(attempt int) (*http.Request, error) {
+		if attempt > 1 {
+			stop()
+			if err := rewind(); err != nil {
+				return nil, err
+			}
+		}
+		var pw *io.PipeWriter
+		pr, pw = io.Pipe()
+		written = make(chan struct{})
+		w := multipart.NewWriter(pw)
+		go func() {
+			defer close(written)
+			pw.CloseWithError(writeForm(w, opts, fields, writeFiles))
+		}()
+
+		req, err := c.newRequest(ctx, http.MethodPost, path, nil, pr)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		req.Header.Set("Accept", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// errUploadStopped ends the body of an upload attempt that is no longer read
+var errUploadStopped = errors.New("upload stopped")
+
+// writeForm writes the fields and files of an upload
+func writeForm(w *multipart.Writer, opts UploadOptions, fields map[string]string, writeFiles func(*multipart.Writer) error) error {
+	if opts.FolderID != "" {
+		if err := w.WriteField("folder_id", opts.FolderID); err != nil {
+			return err
+		}
+	}
+	for _, tag := range opts.Tags {
+		if err := w.WriteField("tags", tag); err != nil {
+			return err
+		}
+	}
+	if opts.Conflict != "" {
+		if err := w.WriteField("conflict", opts.Conflict); err != nil {
+			return err
+		}
+	}
+	for name, value := range fields {
+		if err := w.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	if err := writeFiles(w); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// copyFormFile adds a file part and copies r into it
+func copyFormFile(w *multipart.Writer, field, filename string, r io.Reader) error {
+	part, err := w.CreateFormFile(field, filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(part, r)
+	return err
+}
+
+// URLImport is one file to fetch from a URL
+type URLImport struct {
+	URL      string   `json:"url"`
+	Filename string   `json:"filename,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// ImportURL fetches a file from a URL and stores it
+func (c *Client) ImportURL(ctx context.Context, item URLImport, opts UploadOptions) (*MediaResult, error) {
+	in := map[string]interface{}{
+		"url":       item.URL,
+		"filename":  item.Filename,
+		"tags":      append(append([]string{}, opts.Tags...), item.Tags...),
+		"folder_id": opts.FolderID,
+		"conflict":  opts.Conflict,
+	}
+	var result MediaResult
+	if err := c.do(ctx, http.MethodPost, "/media/url", nil, in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ImportURLs fetches several files as one background batch job. The job survives server
+// restarts; follow it with GetBatch.
+func (c *Client) ImportURLs(ctx context.Context, items []URLImport, folderID string) (*BatchAccepted, error) {
+	in := map[string]interface{}{"urls": items, "folder_id": folderID}
+	var result BatchAccepted
+	if err := c.do(ctx, http.MethodPost, "/media/url/batch", nil, in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetImportJob returns a URL import job with the status of every URL
+func (c *Client) GetImportJob(ctx context.Context, id uint) (*ImportJob, error) {
+	var result struct {
+		Job ImportJob `json:"job"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/media/imports/"+strconv.FormatUint(uint64(id), 10), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result.Job, nil
+}
+
+// BatchTransform is one item of TransformMediaBatch. Transformations are keyed by the
+// server's option names, e.g. {"Width": 800, "Format": "webp"}.
+type BatchTransform struct {
+	MediaID         string                 `json:"media_id"`
+	Transformations map[string]interface{} `json:"transformations"`
+}
+
+// TransformMediaBatch stores a transformed copy of every item as a new media item in a
+// background batch job; follow it with GetBatch
+func (c *Client) TransformMediaBatch(ctx context.Context, items []BatchTransform) (*BatchAccepted, error) {
+	var result BatchAccepted
+	if err := c.do(ctx, http.MethodPost, "/media/batch/transform", nil, items, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListBatches returns a page of background batch jobs, newest first. An empty kind lists
+// all kinds.
+func (c *Client) ListBatches(ctx context.Context, kind string, page, limit int) ([]ImportJob, error) {
+	query := url.Values{}
+	setString(query, "kind", kind)
+	setInt(query, "page", page)
+	setInt(query, "limit", limit)
+
+	var result struct {
+		Batches []ImportJob `json:"batches"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/batches", query, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Batches, nil
+}
+
+// GetBatch returns a background batch job with the status of every item
+func (c *Client) GetBatch(ctx context.Context, id uint) (*ImportJob, error) {
+	var result struct {
+		Batch ImportJob `json:"batch"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/batches/"+strconv.FormatUint(uint64(id), 10), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result.Batch, nil
+}
+
+// ListMediaOptions filters and pages ListMedia
+type ListMediaOptions struct {
+	Page     int // Starts at 1
+	Limit    int
+	Type     string // MIME type filter
+	Search   string
+	FolderID string
+	Tags     []string
+	Classes  []string // Content classes: photo, screenshot, scan, graphic
+}
+
+// ListMedia returns one page of media
+func (c *Client) ListMedia(ctx context.Context, opts ListMediaOptions) (*MediaPage, error) {
+	query := url.Values{}
+	setInt(query, "page", opts.Page)
+	setInt(query, "limit", opts.Limit)
+	setString(query, "type", opts.Type)
+	setString(query, "search", opts.Search)
+	setString(query, "folder_id", opts.FolderID)
+	query["tags"] = opts.Tags
+	query["class"] = opts.Classes
+
+	var page MediaPage
+	if err := c.do(ctx, http.MethodGet, "/media/list", query, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// EachMedia calls fn for every media item matching opts, fetching pages as needed,
+// starting at opts.Page. Returning an error from fn stops the iteration.
+func (c *Client) EachMedia(ctx context.Context, opts ListMediaOptions, fn func(Media) error) error {
+	opts.Page = max(opts.Page, 1)
+	for {
+		page, err := c.ListMedia(ctx, opts)
+		if err != nil {
+			return err
+		}
+		for _, media := range page.Media {
+			if err := fn(media); err != nil {
+				return err
+			}
+		}
+		if len(page.Media) == 0 || int64(opts.Page) >= page.Pagination.TotalPages {
+			return nil
+		}
+		opts.Page++
+	}
+}
+
+// AllMedia iterates over every media item matching opts, fetching pages as needed. An
+// error ends the iteration after being yielded with a zero Media.
+func (c *Client) AllMedia(ctx context.Context, opts ListMediaOptions) iter.Seq2[Media, error] {
+	return func(yield func(Media, error) bool) {
+		err := c.EachMedia(ctx, opts, func(media Media) error {
+			if !yield(media, nil) {
+				return errStopIteration
+			}
+			return nil
+		})
+		if err != nil && err != errStopIteration {
+			yield(Media{}, err)
+		}
+	}
+}
+
+// GetMedia returns a media item. Its DownloadURL is a presigned URL valid for
+// expiresIn seconds, or the server default when zero.
+func (c *Client) GetMedia(ctx context.Context, id string, expiresIn int) (*MediaResult, error) {
+	query := url.Values{}
+	setInt(query, "expires", expiresIn)
+
+	var result MediaResult
+	if err := c.do(ctx, http.MethodGet, "/media/"+url.PathEscape(id), query, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Download fetches the original content of a media item through its presigned download
+// URL. The caller must close the returned body.
+func (c *Client) Download(ctx context.Context, id string) (io.ReadCloser, *Media, error) {
+	result, err := c.GetMedia(ctx, id, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := c.sendWithRetry(ctx, true, func(int) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, result.Media.DownloadURL, nil)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Body, &result.Media, nil
+}
+
+// MediaUpdate is the body of UpdateMedia. The server writes every field, so start from
+// the current values when changing only some of them.
+type MediaUpdate struct {
+	Filename string   `json:"filename"`
+	FolderID *string  `json:"folder_id"`
+	Metadata []byte   `json:"metadata,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// UpdateMedia changes a media item's filename, folder or metadata
+func (c *Client) UpdateMedia(ctx context.Context, id string, update MediaUpdate) (*Media, error) {
+	var media Media
+	if err := c.do(ctx, http.MethodPut, "/media/"+url.PathEscape(id), nil, update, &media); err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// DeleteMedia deletes a media item and its stored object
+func (c *Client) DeleteMedia(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/media/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// DeleteMediaBatch deletes several media items. Results report each ID; stored objects
+// are removed by the returned purge job, which GetPurgeJob follows.
+func (c *Client) DeleteMediaBatch(ctx context.Context, ids []string) (*BatchResult, error) {
+	in := map[string]interface{}{"operation": "delete", "media_ids": ids}
+	var result BatchResult
+	if err := c.do(ctx, http.MethodPost, "/media/batch/operation", nil, in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// MoveMedia moves several media items into a folder
+func (c *Client) MoveMedia(ctx context.Context, ids []string, folderID string) (*BatchResult, error) {
+	in := map[string]interface{}{"operation": "move", "media_ids": ids, "folder_id": folderID}
+	var result BatchResult
+	if err := c.do(ctx, http.MethodPost, "/media/batch/operation", nil, in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CopyMedia duplicates several media items into folderID, or next to each original when
+// folderID is empty. BatchResult.Copies maps source IDs to the new IDs.
+func (c *Client) CopyMedia(ctx context.Context, ids []string, folderID string) (*BatchResult, error) {
+	in := map[string]interface{}{"operation": "copy", "media_ids": ids}
+	if folderID != "" {
+		in["folder_id"] = folderID
+	}
+	var result BatchResult
+	if err := c.do(ctx, http.MethodPost, "/media/batch/operation", nil, in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TagMedia adds tags to several media items in one transaction
+func (c *Client) TagMedia(ctx context.Context, ids, tags []string) (*BatchResult, error) {
+	return c.batchTags(ctx, "add_tags", ids, tags)
+}
+
+// UntagMedia removes tags from several media items in one transaction
+func (c *Client) UntagMedia(ctx context.Context, ids, tags []string) (*BatchResult, error) {
+	return c.batchTags(ctx, "remove_tags", ids, tags)
+}
+
+// batchTags runs a tag batch operation
+func (c *Client) batchTags(ctx context.Context, operation string, ids, tags []string) (*BatchResult, error) {
+	in := map[string]interface{}{"operation": operation, "media_ids": ids, "tags": tags}
+	var result BatchResult
+	if err := c.do(ctx, http.MethodPost, "/media/batch/operation", nil, in, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetPurgeJob returns the progress of a background deletion
+func (c *Client) GetPurgeJob(ctx context.Context, id string) (*PurgeJob, error) {
+	var result struct {
+		Job PurgeJob `json:"job"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/media/purges/"+url.PathEscape(id), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result.Job, nil
+}
+
+// Transform renders a transformed copy of a media item, e.g. with params width=800 and
+// format=webp. The caller must close the returned body.
+func (c *Client) Transform(ctx context.Context, id string, params url.Values) (io.ReadCloser, string, error) {
+	// Rendering stores nothing, so the request is safe to repeat
+	resp, err := c.sendWithRetry(ctx, true, func(int) (*http.Request, error) {
+		return c.newRequest(ctx, http.MethodPost, "/media/"+url.PathEscape(id)+"/transform", params, nil)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// setInt adds a positive integer query parameter
+func setInt(query url.Values, name string, value int) {
+	if value > 0 {
+		query.Set(name, strconv.Itoa(value))
+	}
+}
+
+// setString adds a non-empty query parameter
+func setString(query url.Values, name, value string) {
+	if value != "" {
+		query.Set(name, value)
+	}
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy decides how often a failed request is sent again. Requests are retried
+// after network errors and for the statuses 429, 502, 503 and 504; other errors are
+// returned at once. Only requests that are safe to repeat are retried: reads, PUT and
+// DELETE requests, uploads whose files can be rewound, and completing direct uploads.
+type RetryPolicy struct {
+	MaxAttempts int           // Including the first; 1 disables retries
+	MinBackoff  time.Duration // Delay before the first retry, doubled for every further one
+	MaxBackoff  time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created without WithRetry
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, MinBackoff: 500 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// WithRetry replaces DefaultRetryPolicy
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
+}
+
+// backoff returns the delay before retrying after the given failed attempt. A
+// Retry-After header of the failed response takes precedence.
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+		return apiErr.retryAfter
+	}
+	delay := p.MaxBackoff
+	if shift := attempt - 1; shift < 30 && p.MinBackoff<<shift < p.MaxBackoff {
+		delay = p.MinBackoff << shift
+	}
+	// Jitter keeps clients that failed together from retrying together
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryable reports whether a request that failed with err may succeed when repeated
+func retryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// sendWithRetry sends the requests newRequest builds until one succeeds, one fails for
+// good or the retry policy gives up. newRequest is called for every attempt, numbered
+// from 1, so each gets a fresh body. Requests that must not be repeated pass retry false.
+func (c *Client) sendWithRetry(ctx context.Context, retry bool, newRequest func(attempt int) (*http.Request, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest(attempt)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.send(req)
+		if err == nil || !retry || attempt >= c.retry.MaxAttempts || !retryable(err) {
+			return resp, err
+		}
+
+		timer := time.NewTimer(c.retry.backoff(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds
+func parseRetryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// rewinder returns a function that seeks r back to its current offset, or nil when r
+// cannot seek, as pipes cannot
+func rewinder(r io.Reader) func() error {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	return func() error {
+		_, err := seeker.Seek(offset, io.SeekStart)
+		return err
+	}
+}
@@ -0,0 +1,251 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Media is a stored file
+type Media struct {
+	ID                   string          `json:"id"`
+	UserID               uint            `json:"user_id"`
+	FolderID             *string         `json:"folder_id"`
+	Filename             string          `json:"filename"`
+	MimeType             string          `json:"mime_type"`
+	Size                 int64           `json:"size"`
+	Metadata             json.RawMessage `json:"metadata"`
+	Tags                 []Tag           `json:"tags"`
+	Broken               bool            `json:"broken"`        // The stored object is missing
+	URL                  string          `json:"url"`           // Public URL of the stored object
+	ThumbnailURL         string          `json:"thumbnail_url"` // Empty for media without thumbnails
+	BlurHash             string          `json:"blurhash"`      // Placeholder to draw while loading, if any
+	DownloadURL          string          `json:"download_url"`  // Set by GetMedia only
+	DownloadURLExpiresAt *time.Time      `json:"download_url_expires_at"`
+	CreatedAt            time.Time       `json:"created_at"`
+	UpdatedAt            time.Time       `json:"updated_at"`
+}
+
+// Tag labels media
+type Tag struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// Folder groups media
+type Folder struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ParentID    *uint     `json:"parent_id"`
+	UserID      uint      `json:"user_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	MediaCount  int64     `json:"media_count"`
+}
+
+// FolderRef names the folder a media item is in
+type FolderRef struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// User is the account a token was issued for
+type User struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// AuthResult is returned by Register and Login
+type AuthResult struct {
+	Message string `json:"message"`
+	Token   string `json:"token"`
+	User    User   `json:"user"`
+}
+
+// StorageUsage is returned by Usage
+type StorageUsage struct {
+	Used       int64           `json:"used"`
+	Quota      int64           `json:"quota"`     // 0 is unlimited
+	Remaining  *int64          `json:"remaining"` // nil when unlimited
+	ByMimeType []MimeTypeUsage `json:"by_mime_type"`
+}
+
+// MimeTypeUsage is the storage taken by one MIME type
+type MimeTypeUsage struct {
+	MimeType string `json:"mime_type"`
+	Count    int64  `json:"count"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// UserQuota is returned by SetUserQuota
+type UserQuota struct {
+	Message  string `json:"message"`
+	UserID   uint   `json:"user_id"`
+	Override *int64 `json:"override"`
+	Quota    int64  `json:"quota"` // Quota in effect, 0 is unlimited
+}
+
+// Pagination describes one page of a list
+type Pagination struct {
+	CurrentPage int   `json:"current_page"`
+	TotalPages  int64 `json:"total_pages"`
+	TotalItems  int64 `json:"total_items"`
+	PerPage     int   `json:"per_page"`
+}
+
+// MediaPage is one page of ListMedia
+type MediaPage struct {
+	Media      []Media    `json:"media"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// FolderPage is one page of ListFolders
+type FolderPage struct {
+	Folders    []Folder   `json:"folders"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// MediaResult is returned by uploads, URL imports and GetMedia
+type MediaResult struct {
+	Message  string     `json:"message"`
+	Skipped  bool       `json:"skipped"`  // A file with the same name was kept
+	Replaced bool       `json:"replaced"` // A file with the same name was overwritten
+	Media    Media      `json:"media"`
+	Folder   *FolderRef `json:"folder"`
+}
+
+// ItemResult is the outcome for one item of a bulk request
+type ItemResult struct {
+	URL      string `json:"url"`
+	Filename string `json:"filename"`
+	MediaID  string `json:"media_id"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error"`
+}
+
+// BulkResult is returned by UploadFiles
+type BulkResult struct {
+	Message      string       `json:"message"`
+	Total        int          `json:"total"`
+	SuccessCount int          `json:"success_count"`
+	Results      []ItemResult `json:"results"`
+}
+
+// PurgeFailure is an object a purge could not delete
+type PurgeFailure struct {
+	Ref   string `json:"ref"`
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// PurgeJob reports the progress of a background deletion
+type PurgeJob struct {
+	ID          string         `json:"id"`
+	Status      string         `json:"status"` // running or completed
+	Total       int            `json:"total"`
+	Deleted     int            `json:"deleted"`
+	Failed      int            `json:"failed"`
+	Failures    []PurgeFailure `json:"failures"`
+	StartedAt   time.Time      `json:"started_at"`
+	CompletedAt *time.Time     `json:"completed_at"`
+}
+
+// BatchResult is returned by the batch operations: DeleteMediaBatch, MoveMedia,
+// CopyMedia, TagMedia and UntagMedia
+type BatchResult struct {
+	Message     string            `json:"message"`
+	Operation   string            `json:"operation"`
+	AffectedIDs []string          `json:"affected_ids"`
+	Results     []ItemResult      `json:"results"`
+	Copies      map[string]string `json:"copies"` // Copy ID by source ID
+	Tags        []string          `json:"tags"`
+	PurgeJob    *PurgeJob         `json:"purge_job"`
+}
+
+// BatchAccepted acknowledges a batch job started in the background by ImportURLs or
+// TransformMediaBatch
+type BatchAccepted struct {
+	Message   string `json:"message"`
+	BatchID   uint   `json:"batch_id"`
+	Kind      string `json:"kind"` // url_import or transform
+	Status    string `json:"status"`
+	Total     int    `json:"total"`
+	StatusURL string `json:"status_url"`
+	EventsURL string `json:"events_url"` // Websocket of progress events
+}
+
+// ImportJob is a background batch job: a bulk URL import or a batch transform
+type ImportJob struct {
+	ID          uint            `json:"id"`
+	Kind        string          `json:"kind"` // url_import or transform
+	FolderID    *string         `json:"folder_id"`
+	Status      string          `json:"status"` // pending, running or completed
+	Total       int             `json:"total"`
+	Succeeded   int             `json:"succeeded"`
+	Failed      int             `json:"failed"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	CompletedAt *time.Time      `json:"completed_at"`
+	Items       []ImportJobItem `json:"items"`
+}
+
+// ImportJobItem is one URL or source media item of a job
+type ImportJobItem struct {
+	ID       uint            `json:"id"`
+	Position int             `json:"position"`
+	URL      string          `json:"url"`
+	SourceID string          `json:"source_id"` // Transformed media item
+	Options  json.RawMessage `json:"options"`   // Transformations
+	Filename string          `json:"filename"`
+	Status   string          `json:"status"`
+	MediaID  string          `json:"media_id"`
+	Error    string          `json:"error"`
+}
+
+// PresignedUpload is a request that stores a file, or one part of it, straight in storage
+type PresignedUpload struct {
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers"` // Signed headers to send as given
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// DirectUpload is returned by PresignUpload. Small files get an UploadToken and Upload,
+// files above the multipart threshold a Session. When the skip conflict policy kept an
+// existing file, Skipped is set and Media is that file.
+type DirectUpload struct {
+	UploadToken string           `json:"upload_token"`
+	Upload      *PresignedUpload `json:"upload"`
+	Session     *UploadSession   `json:"session"`
+	ExpiresAt   time.Time        `json:"expires_at"`
+	Skipped     bool             `json:"skipped"`
+	Media       Media            `json:"media"`
+}
+
+// UploadSession is a multipart direct upload
+type UploadSession struct {
+	ID        string    `json:"id"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	PartSize  int64     `json:"part_size"` // Every part but the last has exactly this size
+	PartCount int       `json:"part_count"`
+	FolderID  *string   `json:"folder_id"`
+	Conflict  string    `json:"conflict"`
+	Status    string    `json:"status"` // active, assembled, completed or aborted
+	MediaID   string    `json:"media_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UploadPart is a presigned request storing one part of a multipart upload
+type UploadPart struct {
+	PartNumber int32 `json:"part_number"`
+	PresignedUpload
+}
+
+// CompletedPart is a stored part of a multipart upload
+type CompletedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+}